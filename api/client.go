@@ -244,6 +244,7 @@ type Client struct {
 	token              string
 	headers            http.Header
 	wrappingLookupFunc WrappingLookupFunc
+	mfaCreds           []string
 }
 
 // NewClient returns a new client for the given configuration.
@@ -355,6 +356,12 @@ func (c *Client) ClearToken() {
 	c.token = ""
 }
 
+// SetMFACreds sets the MFA credentials supplied with future requests. Each
+// value is of the form "method_name[:passcode]".
+func (c *Client) SetMFACreds(creds []string) {
+	c.mfaCreds = creds
+}
+
 // SetHeaders sets the headers to be used for future requests.
 func (c *Client) SetHeaders(headers http.Header) {
 	c.headers = headers
@@ -388,8 +395,9 @@ func (c *Client) NewRequest(method, requestPath string) *Request {
 			Host:   host,
 			Path:   path.Join(c.addr.Path, requestPath),
 		},
-		ClientToken: c.token,
-		Params:      make(map[string][]string),
+		ClientToken:   c.token,
+		MFAHeaderVals: c.mfaCreds,
+		Params:        make(map[string][]string),
 	}
 
 	var lookupPath string
@@ -19,11 +19,12 @@ func (c *Sys) Health() (*HealthResponse, error) {
 }
 
 type HealthResponse struct {
-	Initialized   bool   `json:"initialized"`
-	Sealed        bool   `json:"sealed"`
-	Standby       bool   `json:"standby"`
-	ServerTimeUTC int64  `json:"server_time_utc"`
-	Version       string `json:"version"`
-	ClusterName   string `json:"cluster_name,omitempty"`
-	ClusterID     string `json:"cluster_id,omitempty"`
+	Initialized        bool   `json:"initialized"`
+	Sealed             bool   `json:"sealed"`
+	Standby            bool   `json:"standby"`
+	PerformanceStandby bool   `json:"performance_standby,omitempty"`
+	ServerTimeUTC      int64  `json:"server_time_utc"`
+	Version            string `json:"version"`
+	ClusterName        string `json:"cluster_name,omitempty"`
+	ClusterID          string `json:"cluster_id,omitempty"`
 }
@@ -0,0 +1,83 @@
+package api
+
+import "fmt"
+
+// Loggers returns the global log level of the server and the subsystems that
+// have a level of their own
+func (c *Sys) Loggers() (*LoggersResponse, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/loggers")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	result := &LoggersResponse{
+		Subsystems: make(map[string]string),
+	}
+	result.Level, _ = secret.Data["level"].(string)
+	if subsystems, ok := secret.Data["subsystems"].(map[string]interface{}); ok {
+		for name, level := range subsystems {
+			result.Subsystems[name], _ = level.(string)
+		}
+	}
+	return result, nil
+}
+
+// SetLogLevel sets the global log level of the server
+func (c *Sys) SetLogLevel(level string) error {
+	return c.setLogLevel("/v1/sys/loggers", level)
+}
+
+// ResetLogLevels reverts all log levels to the one the server was started
+// with
+func (c *Sys) ResetLogLevels() error {
+	return c.resetLogLevel("/v1/sys/loggers")
+}
+
+// SetSubsystemLogLevel sets the log level of a subsystem, such as "core" or
+// "physical/consul", and of the subsystems nested in it
+func (c *Sys) SetSubsystemLogLevel(subsystem, level string) error {
+	return c.setLogLevel("/v1/sys/loggers/"+subsystem, level)
+}
+
+// ResetSubsystemLogLevel makes a subsystem use the log level of its parent,
+// or the global level, again
+func (c *Sys) ResetSubsystemLogLevel(subsystem string) error {
+	return c.resetLogLevel("/v1/sys/loggers/" + subsystem)
+}
+
+func (c *Sys) setLogLevel(path, level string) error {
+	r := c.c.NewRequest("PUT", path)
+	if err := r.SetJSONBody(map[string]interface{}{"level": level}); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) resetLogLevel(path string) error {
+	r := c.c.NewRequest("DELETE", path)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+type LoggersResponse struct {
+	Level      string            `json:"level"`
+	Subsystems map[string]string `json:"subsystems"`
+}
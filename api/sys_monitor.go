@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+)
+
+// Monitor streams the logs of the server at the given level or more severe,
+// formatted as "standard" text or "json"; empty values use the defaults of
+// the server. Lines are sent on the returned channel, which is closed once
+// the context is done or the server ends the stream. Unlike other requests
+// the stream is not subject to the timeout of the client.
+func (c *Sys) Monitor(ctx context.Context, logLevel, logFormat string) (<-chan string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/monitor")
+	if logLevel != "" {
+		r.Params.Set("log_level", logLevel)
+	}
+	if logFormat != "" {
+		r.Params.Set("log_format", logFormat)
+	}
+
+	req, err := r.ToHTTP()
+	if err != nil {
+		return nil, err
+	}
+
+	client := *c.c.config.HttpClient
+	client.Timeout = 0
+	httpResp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{Response: httpResp}
+	if err := resp.Error(); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			select {
+			case lines <- fmt.Sprintf("error reading the logs: %s", err):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return lines, nil
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"io"
+)
+
+// StorageSnapshot writes a snapshot of the storage of Vault to the given
+// writer. The snapshot is still encrypted by the barrier.
+func (c *Sys) StorageSnapshot(w io.Writer) error {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/snapshot")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// StorageSnapshotRestore replaces the storage of Vault with the snapshot read
+// from the given reader. Snapshots taken with a different keyring are only
+// restored if forced, after which Vault is sealed.
+func (c *Sys) StorageSnapshotRestore(snapshot io.Reader, force bool) error {
+	r := c.c.NewRequest("POST", "/v1/sys/storage/snapshot")
+	if force {
+		r.Params.Set("force", "true")
+	}
+	r.Body = snapshot
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
@@ -3,6 +3,7 @@ package audit
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 	"time"
 
@@ -135,6 +136,8 @@ func (f *AuditFormatter) FormatRequest(
 			Path:                req.Path,
 			Data:                req.Data,
 			RemoteAddr:          getRemoteAddr(req),
+			RemotePort:          getRemotePort(req),
+			UserAgent:           getUserAgent(req),
 			ReplicationCluster:  req.ReplicationCluster,
 			Headers:             req.Headers,
 		},
@@ -176,6 +179,9 @@ func (f *AuditFormatter) FormatResponse(
 		return errwrap.Wrapf("error fetching salt: {{err}}", err)
 	}
 
+	// Determine the status before the response is copied and hashed
+	status := ResponseStatus(req, resp, inErr)
+
 	if !config.Raw {
 		// Before we copy the structure we must nil out some data
 		// otherwise we will cause reflection to panic and die
@@ -281,6 +287,7 @@ func (f *AuditFormatter) FormatResponse(
 			Policies:    resp.Auth.Policies,
 			Metadata:    resp.Auth.Metadata,
 			NumUses:     resp.Auth.NumUses,
+			EntityID:    resp.Auth.EntityID,
 		}
 	}
 
@@ -327,16 +334,20 @@ func (f *AuditFormatter) FormatResponse(
 			Path:                req.Path,
 			Data:                req.Data,
 			RemoteAddr:          getRemoteAddr(req),
+			RemotePort:          getRemotePort(req),
+			UserAgent:           getUserAgent(req),
 			ReplicationCluster:  req.ReplicationCluster,
 			Headers:             req.Headers,
 		},
 
 		Response: AuditResponse{
-			Auth:     respAuth,
-			Secret:   respSecret,
-			Data:     resp.Data,
-			Redirect: resp.Redirect,
-			WrapInfo: respWrapInfo,
+			StatusCode: status,
+			LatencyMs:  getLatency(req),
+			Auth:       respAuth,
+			Secret:     respSecret,
+			Data:       resp.Data,
+			Redirect:   resp.Redirect,
+			WrapInfo:   respWrapInfo,
 		},
 	}
 
@@ -379,16 +390,20 @@ type AuditRequest struct {
 	Path                string                 `json:"path"`
 	Data                map[string]interface{} `json:"data"`
 	RemoteAddr          string                 `json:"remote_address"`
+	RemotePort          int                    `json:"remote_port,omitempty"`
+	UserAgent           string                 `json:"user_agent,omitempty"`
 	WrapTTL             int                    `json:"wrap_ttl"`
 	Headers             map[string][]string    `json:"headers"`
 }
 
 type AuditResponse struct {
-	Auth     *AuditAuth             `json:"auth,omitempty"`
-	Secret   *AuditSecret           `json:"secret,omitempty"`
-	Data     map[string]interface{} `json:"data,omitempty"`
-	Redirect string                 `json:"redirect,omitempty"`
-	WrapInfo *AuditResponseWrapInfo `json:"wrap_info,omitempty"`
+	StatusCode int                    `json:"status_code"`
+	LatencyMs  float64                `json:"latency_ms,omitempty"`
+	Auth       *AuditAuth             `json:"auth,omitempty"`
+	Secret     *AuditSecret           `json:"secret,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Redirect   string                 `json:"redirect,omitempty"`
+	WrapInfo   *AuditResponseWrapInfo `json:"wrap_info,omitempty"`
 }
 
 type AuditAuth struct {
@@ -422,6 +437,47 @@ func getRemoteAddr(req *logical.Request) string {
 	return ""
 }
 
+// getRemotePort safely gets the remote port avoiding a nil pointer
+func getRemotePort(req *logical.Request) int {
+	if req != nil && req.Connection != nil {
+		return req.Connection.RemotePort
+	}
+	return 0
+}
+
+// getUserAgent safely gets the user agent avoiding a nil pointer
+func getUserAgent(req *logical.Request) string {
+	if req != nil && req.Connection != nil {
+		return req.Connection.UserAgent
+	}
+	return ""
+}
+
+// getLatency returns how long the request has taken so far in milliseconds,
+// or zero if its start time is unknown
+func getLatency(req *logical.Request) float64 {
+	if req == nil || req.StartTime.IsZero() {
+		return 0
+	}
+	return float64(time.Since(req.StartTime)) / float64(time.Millisecond)
+}
+
+// ResponseStatus returns the HTTP status code a response is returned with,
+// given the error the request was handled with
+func ResponseStatus(req *logical.Request, resp *logical.Response, err error) int {
+	code, _ := logical.RespondErrorCommon(req, resp, err)
+	switch {
+	case code != 0:
+		return code
+	case err != nil || (resp != nil && resp.IsError()):
+		return http.StatusBadRequest
+	case resp == nil:
+		return http.StatusNoContent
+	default:
+		return http.StatusOK
+	}
+}
+
 // parseVaultTokenFromJWT returns a string iff the token was a JWT and we could
 // extract the original token ID from inside
 func parseVaultTokenFromJWT(token string) *string {
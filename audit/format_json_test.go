@@ -120,3 +120,109 @@ func TestFormatJSON_formatRequest(t *testing.T) {
 
 const testFormatJSONReqBasicStrFmt = `{"time":"2015-08-05T13:45:46Z","type":"request","auth":{"client_token":"%s","accessor":"bar","display_name":"testtoken","policies":["root"],"metadata":null},"request":{"operation":"update","path":"/foo","data":null,"wrap_ttl":60,"remote_address":"127.0.0.1","headers":{"foo":["bar"]}},"error":"this is an error"}
 `
+
+func TestFormatJSON_formatResponse(t *testing.T) {
+	salter, err := salt.NewSalt(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saltFunc := func() (*salt.Salt, error) {
+		return salter, nil
+	}
+
+	cases := map[string]struct {
+		Resp   *logical.Response
+		Err    error
+		Status int
+	}{
+		"ok": {
+			&logical.Response{
+				Auth: &logical.Auth{
+					ClientToken: "foo",
+					Accessor:    "bar",
+					Policies:    []string{"default"},
+					EntityID:    "entity",
+				},
+				Data: map[string]interface{}{
+					"foo": "bar",
+				},
+			},
+			nil,
+			200,
+		},
+		"no content": {
+			nil,
+			nil,
+			204,
+		},
+		"error response": {
+			logical.ErrorResponse("bad input"),
+			logical.ErrInvalidRequest,
+			400,
+		},
+		"permission denied": {
+			nil,
+			logical.ErrPermissionDenied,
+			403,
+		},
+	}
+
+	for name, tc := range cases {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "/foo",
+			Connection: &logical.Connection{
+				RemoteAddr: "127.0.0.1",
+				RemotePort: 52000,
+				UserAgent:  "vault-test",
+			},
+			StartTime: time.Now().Add(-10 * time.Millisecond),
+		}
+		auth := &logical.Auth{
+			ClientToken: "foo",
+			Policies:    []string{"root"},
+			EntityID:    "entity",
+		}
+
+		var buf bytes.Buffer
+		formatter := AuditFormatter{
+			AuditFormatWriter: &JSONFormatWriter{
+				SaltFunc: saltFunc,
+			},
+		}
+		if err := formatter.FormatResponse(&buf, FormatterConfig{HMACAccessor: true}, auth, req, tc.Resp, tc.Err); err != nil {
+			t.Fatalf("bad: %s\nerr: %s", name, err)
+		}
+
+		var entry AuditResponseEntry
+		if err := jsonutil.DecodeJSON(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("bad json: %s", err)
+		}
+
+		if entry.Response.StatusCode != tc.Status {
+			t.Fatalf("bad: %s: expected status %d, got %d", name, tc.Status, entry.Response.StatusCode)
+		}
+		if entry.Response.LatencyMs < 10 {
+			t.Fatalf("bad: %s: latency %f", name, entry.Response.LatencyMs)
+		}
+		if entry.Request.RemoteAddr != "127.0.0.1" || entry.Request.RemotePort != 52000 || entry.Request.UserAgent != "vault-test" {
+			t.Fatalf("bad: %s: %#v", name, entry.Request)
+		}
+		if entry.Auth.EntityID != "entity" || entry.Auth.ClientToken != salter.GetIdentifiedHMAC("foo") {
+			t.Fatalf("bad: %s: %#v", name, entry.Auth)
+		}
+
+		// Sensitive fields of the response are still hashed
+		if tc.Resp != nil && tc.Resp.Auth != nil {
+			respAuth := entry.Response.Auth
+			if respAuth == nil || respAuth.EntityID != "entity" ||
+				respAuth.ClientToken != salter.GetIdentifiedHMAC("foo") ||
+				respAuth.Accessor != salter.GetIdentifiedHMAC("bar") {
+				t.Fatalf("bad: %s: %#v", name, respAuth)
+			}
+			if entry.Response.Data["foo"] != salter.GetIdentifiedHMAC("bar") {
+				t.Fatalf("bad: %s: %#v", name, entry.Response.Data)
+			}
+		}
+	}
+}
@@ -104,3 +104,66 @@ func TestFormatJSONx_formatRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatJSONx_formatResponse(t *testing.T) {
+	salter, err := salt.NewSalt(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saltFunc := func() (*salt.Salt, error) {
+		return salter, nil
+	}
+
+	fooSalted := salter.GetIdentifiedHMAC("foo")
+	barSalted := salter.GetIdentifiedHMAC("bar")
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "/foo",
+		Connection: &logical.Connection{
+			RemoteAddr: "127.0.0.1",
+			RemotePort: 52000,
+			UserAgent:  "vault-test",
+		},
+	}
+	resp := &logical.Response{
+		Auth: &logical.Auth{
+			ClientToken: "foo",
+			Accessor:    "bar",
+			Policies:    []string{"default"},
+			EntityID:    "entity",
+		},
+	}
+	auth := &logical.Auth{ClientToken: "foo", DisplayName: "testtoken", Policies: []string{"root"}, EntityID: "entity"}
+
+	var buf bytes.Buffer
+	formatter := AuditFormatter{
+		AuditFormatWriter: &JSONxFormatWriter{
+			SaltFunc: saltFunc,
+		},
+	}
+	config := FormatterConfig{
+		OmitTime:     true,
+		HMACAccessor: true,
+	}
+	if err := formatter.FormatResponse(&buf, config, auth, req, resp, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a start time, no latency is reported
+	expected := fmt.Sprintf(`<json:object name="auth"><json:string name="accessor"></json:string><json:string name="client_token">%s</json:string><json:string name="display_name">testtoken</json:string><json:string name="entity_id">entity</json:string><json:null name="metadata" /><json:array name="policies"><json:string>root</json:string></json:array></json:object><json:string name="error"></json:string><json:object name="request"><json:string name="client_token"></json:string><json:string name="client_token_accessor"></json:string><json:null name="data" /><json:null name="headers" /><json:string name="id"></json:string><json:string name="operation">update</json:string><json:string name="path">/foo</json:string><json:string name="remote_address">127.0.0.1</json:string><json:number name="remote_port">52000</json:number><json:string name="user_agent">vault-test</json:string><json:number name="wrap_ttl">0</json:number></json:object><json:object name="response"><json:object name="auth"><json:string name="accessor">%s</json:string><json:string name="client_token">%s</json:string><json:string name="display_name"></json:string><json:string name="entity_id">entity</json:string><json:null name="metadata" /><json:array name="policies"><json:string>default</json:string></json:array></json:object><json:number name="status_code">200</json:number></json:object><json:string name="type">response</json:string>`,
+		fooSalted, barSalted, fooSalted)
+	if !strings.HasSuffix(strings.TrimSpace(buf.String()), expected) {
+		t.Fatalf("bad:\nResult:\n\n'%s'\n\nExpected:\n\n'%s'", strings.TrimSpace(buf.String()), expected)
+	}
+
+	// With a start time, the latency is reported
+	req.StartTime = time.Now()
+	buf.Reset()
+	if err := formatter.FormatResponse(&buf, config, auth, req, resp, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<json:number name="latency_ms">`) {
+		t.Fatalf("bad: no latency in %s", buf.String())
+	}
+}
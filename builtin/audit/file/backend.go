@@ -1,19 +1,29 @@
 package file
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/compressutil"
+	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
 )
 
+// rotatedTimeFormat is the format of the time of rotation in the name of
+// rotated files. It sorts lexically in chronological order.
+const rotatedTimeFormat = "20060102T150405.000000000"
+
 func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 	if conf.SaltConfig == nil {
 		return nil, fmt.Errorf("nil salt config")
@@ -78,11 +88,49 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		mode = os.FileMode(m)
 	}
 
+	// Check if rotation is configured
+	var maxBytes int64
+	if raw, ok := conf.Config["rotate_bytes"]; ok {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid rotate_bytes: %q", raw)
+		}
+		maxBytes = v
+	}
+	var maxDuration time.Duration
+	if raw, ok := conf.Config["rotate_duration"]; ok {
+		v, err := parseutil.ParseDurationSecond(raw)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid rotate_duration: %q", raw)
+		}
+		maxDuration = v
+	}
+	var maxFiles int
+	if raw, ok := conf.Config["rotate_max_files"]; ok {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid rotate_max_files: %q", raw)
+		}
+		maxFiles = v
+	}
+	compress := false
+	if raw, ok := conf.Config["rotate_compress"]; ok {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		compress = v
+	}
+
 	b := &Backend{
-		path:       path,
-		mode:       mode,
-		saltConfig: conf.SaltConfig,
-		saltView:   conf.SaltView,
+		path:        path,
+		mode:        mode,
+		maxBytes:    maxBytes,
+		maxDuration: maxDuration,
+		maxFiles:    maxFiles,
+		compress:    compress,
+		saltConfig:  conf.SaltConfig,
+		saltView:    conf.SaltView,
 		formatConfig: audit.FormatterConfig{
 			Raw:          logRaw,
 			HMACAccessor: hmacAccessor,
@@ -112,6 +160,17 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		if err := b.open(); err != nil {
 			return nil, fmt.Errorf("sanity check failed; unable to open %s for writing: %v", path, err)
 		}
+
+		// Only regular files can be rotated
+		if maxBytes > 0 || maxDuration > 0 {
+			info, err := b.f.Stat()
+			if err != nil {
+				return nil, err
+			}
+			if !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("rotation is only supported for regular files")
+			}
+		}
 	}
 
 	return b, nil
@@ -119,9 +178,10 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 
 // Backend is the audit backend for the file-based audit store.
 //
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// The backend appends to a file. The file can be rotated externally, by
+// moving it and calling Reload, or by the backend itself once it reaches a
+// size or age. Rotated files are renamed with the time of rotation, and can
+// be compressed and pruned in the background.
 type Backend struct {
 	path string
 
@@ -132,6 +192,24 @@ type Backend struct {
 	f        *os.File
 	mode     os.FileMode
 
+	// size is the size of the file, used to decide when to rotate it by size
+	size int64
+
+	// opened is the time of the first entry of the file, used to decide when
+	// to rotate it by age
+	opened time.Time
+
+	// Rotation configuration; a zero value disables the limit
+	maxBytes    int64
+	maxDuration time.Duration
+	maxFiles    int
+	compress    bool
+
+	// rotatedLock serializes the compression and pruning of rotated files,
+	// which happens in the background and is tracked by rotatedWg
+	rotatedLock sync.Mutex
+	rotatedWg   sync.WaitGroup
+
 	saltMutex  sync.RWMutex
 	salt       *salt.Salt
 	saltConfig *salt.Config
@@ -177,11 +255,12 @@ func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr
 		return b.formatter.FormatRequest(ioutil.Discard, b.formatConfig, auth, req, outerErr)
 	}
 
+	b.rotate()
 	if err := b.open(); err != nil {
 		return err
 	}
 
-	if err := b.formatter.FormatRequest(b.f, b.formatConfig, auth, req, outerErr); err == nil {
+	if err := b.formatter.FormatRequest(fileWriter{b}, b.formatConfig, auth, req, outerErr); err == nil {
 		return nil
 	}
 
@@ -193,7 +272,7 @@ func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr
 		return err
 	}
 
-	return b.formatter.FormatRequest(b.f, b.formatConfig, auth, req, outerErr)
+	return b.formatter.FormatRequest(fileWriter{b}, b.formatConfig, auth, req, outerErr)
 }
 
 func (b *Backend) LogResponse(
@@ -212,11 +291,12 @@ func (b *Backend) LogResponse(
 		return b.formatter.FormatResponse(ioutil.Discard, b.formatConfig, auth, req, resp, err)
 	}
 
+	b.rotate()
 	if err := b.open(); err != nil {
 		return err
 	}
 
-	if err := b.formatter.FormatResponse(b.f, b.formatConfig, auth, req, resp, err); err == nil {
+	if err := b.formatter.FormatResponse(fileWriter{b}, b.formatConfig, auth, req, resp, err); err == nil {
 		return nil
 	}
 
@@ -228,7 +308,7 @@ func (b *Backend) LogResponse(
 		return err
 	}
 
-	return b.formatter.FormatResponse(b.f, b.formatConfig, auth, req, resp, err)
+	return b.formatter.FormatResponse(fileWriter{b}, b.formatConfig, auth, req, resp, err)
 }
 
 // The file lock must be held before calling this
@@ -257,6 +337,165 @@ func (b *Backend) open() error {
 		}
 	}
 
+	info, err := b.f.Stat()
+	if err != nil {
+		return err
+	}
+	b.size = info.Size()
+
+	// The age of a file is counted from its first entry, or from when it
+	// was first opened if it already had entries
+	if b.size > 0 && b.opened.IsZero() {
+		b.opened = time.Now()
+	}
+
+	return nil
+}
+
+// fileWriter writes to the audit file, keeping track of its size. The file
+// lock must be held while writing.
+type fileWriter struct {
+	b *Backend
+}
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	if w.b.size == 0 {
+		w.b.opened = time.Now()
+	}
+	n, err := w.b.f.Write(p)
+	w.b.size += int64(n)
+	return n, err
+}
+
+// rotate closes the file and moves it aside if it has reached the maximum
+// size or age, so that the next call to open starts a new one. As this is
+// done under the file lock, every entry is written whole to exactly one
+// file. If the file cannot be moved, the next call to open reopens it and
+// writing to it carries on. The file lock must be held before calling this.
+func (b *Backend) rotate() {
+	if b.f == nil || b.size == 0 {
+		return
+	}
+	switch {
+	case b.maxBytes > 0 && b.size >= b.maxBytes:
+	case b.maxDuration > 0 && time.Since(b.opened) >= b.maxDuration:
+	default:
+		return
+	}
+
+	b.f.Close()
+	b.f = nil
+
+	rotated := b.rotatedPath(time.Now())
+	if err := os.Rename(b.path, rotated); err != nil {
+		metrics.IncrCounter([]string{"audit", "file", "rotate_failure"}, 1)
+		return
+	}
+
+	b.rotatedWg.Add(1)
+	go b.processRotated(rotated)
+}
+
+// rotatedPath returns the path a file rotated at the given time is moved to
+func (b *Backend) rotatedPath(t time.Time) string {
+	ext := filepath.Ext(b.path)
+	base := strings.TrimSuffix(b.path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.UTC().Format(rotatedTimeFormat), ext)
+}
+
+// processRotated compresses a rotated file if configured, then removes the
+// oldest rotated files beyond the maximum number to keep
+func (b *Backend) processRotated(rotated string) {
+	defer b.rotatedWg.Done()
+
+	b.rotatedLock.Lock()
+	defer b.rotatedLock.Unlock()
+
+	if b.compress {
+		if err := b.compressRotated(rotated); err != nil {
+			metrics.IncrCounter([]string{"audit", "file", "compress_failure"}, 1)
+		}
+	}
+
+	if b.maxFiles > 0 {
+		if err := b.pruneRotated(); err != nil {
+			metrics.IncrCounter([]string{"audit", "file", "prune_failure"}, 1)
+		}
+	}
+}
+
+// compressRotated gzips a rotated file, replacing it with a .gz file
+func (b *Backend) compressRotated(rotated string) error {
+	src, err := os.Open(rotated)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := rotated + ".gz.tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, b.mode)
+	if err != nil {
+		return err
+	}
+	err = compressutil.CompressStream(dst, src, &compressutil.CompressionConfig{
+		Type:                 compressutil.CompressionTypeGzip,
+		GzipCompressionLevel: gzip.DefaultCompression,
+	})
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, rotated+".gz"); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(rotated)
+}
+
+// pruneRotated removes the oldest rotated files, compressed or not, beyond
+// the maximum number to keep
+func (b *Backend) pruneRotated() error {
+	dir := filepath.Dir(b.path)
+	ext := filepath.Ext(b.path)
+	prefix := strings.TrimSuffix(filepath.Base(b.path), ext) + "-"
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var rotated []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ext)
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		rotated = append(rotated, name)
+	}
+	if len(rotated) <= b.maxFiles {
+		return nil
+	}
+
+	// Names sort in the order the files were rotated
+	sort.Strings(rotated)
+	for _, name := range rotated[:len(rotated)-b.maxFiles] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -284,6 +523,21 @@ func (b *Backend) Reload() error {
 	return b.open()
 }
 
+// Close waits for rotated files to be processed and closes the file
+func (b *Backend) Close() error {
+	b.rotatedWg.Wait()
+
+	b.fileLock.Lock()
+	defer b.fileLock.Unlock()
+
+	if b.f == nil {
+		return nil
+	}
+	err := b.f.Close()
+	b.f = nil
+	return err
+}
+
 func (b *Backend) Invalidate() {
 	b.saltMutex.Lock()
 	defer b.saltMutex.Unlock()
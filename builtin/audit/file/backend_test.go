@@ -1,11 +1,18 @@
 package file
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/salt"
@@ -89,3 +96,222 @@ func TestAuditFile_fileModeExisting(t *testing.T) {
 		t.Fatalf("File mode does not match.")
 	}
 }
+
+func testRotateBackend(t *testing.T, config map[string]string) *Backend {
+	b, err := Factory(&audit.BackendConfig{
+		Config:     config,
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend)
+}
+
+func testLogRequest(b *Backend, path string) error {
+	return b.LogRequest(nil, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      path,
+	}, nil)
+}
+
+// testReadLogs returns the names of the files in dir along with the lines
+// they hold, decompressing rotated files if needed
+func testReadLogs(t *testing.T, dir string) ([]string, []string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names, lines []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(info.Name(), ".gz") {
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = ioutil.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, lines
+}
+
+func TestAuditFile_rotateSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_file-rotate_size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := testRotateBackend(t, map[string]string{
+		"path":            filepath.Join(dir, "audit.log"),
+		"rotate_bytes":    "2048",
+		"rotate_compress": "true",
+	})
+
+	// Log concurrently so that rotations happen with requests in flight
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := testLogRequest(b, fmt.Sprintf("secret/%d/%d", i, j)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, lines := testReadLogs(t, dir)
+	if len(names) < 3 {
+		t.Fatalf("expected the file to be rotated, got %v", names)
+	}
+	for _, name := range names {
+		if name != "audit.log" && (!strings.HasPrefix(name, "audit-") || !strings.HasSuffix(name, ".log.gz")) {
+			t.Fatalf("unexpected file %q", name)
+		}
+	}
+
+	// Every entry is logged exactly once
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		for i := 0; i < 10; i++ {
+			for j := 0; j < 20; j++ {
+				path := fmt.Sprintf(`"path":"secret/%d/%d"`, i, j)
+				if strings.Contains(line, path) {
+					if seen[path] {
+						t.Fatalf("duplicate entry %s", path)
+					}
+					seen[path] = true
+				}
+			}
+		}
+	}
+	if len(lines) != 200 || len(seen) != 200 {
+		t.Fatalf("expected 200 entries, got %d lines and %d distinct entries", len(lines), len(seen))
+	}
+}
+
+func TestAuditFile_rotateDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_file-rotate_duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := testRotateBackend(t, map[string]string{
+		"path":            filepath.Join(dir, "audit"),
+		"rotate_duration": "50ms",
+	})
+	defer b.Close()
+
+	// An empty file is not rotated
+	time.Sleep(60 * time.Millisecond)
+	if err := testLogRequest(b, "secret/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := testLogRequest(b, "secret/b"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := testLogRequest(b, "secret/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, lines := testReadLogs(t, dir)
+	if len(names) != 2 || names[0] != "audit" || !strings.HasPrefix(names[1], "audit-") {
+		t.Fatalf("bad: %v", names)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("bad: %v", lines)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "secret/c") || strings.Contains(string(data), "secret/a") {
+		t.Fatalf("bad: %s", data)
+	}
+}
+
+func TestAuditFile_rotateMaxFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_file-rotate_max_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Unrelated files are left alone
+	if err := ioutil.WriteFile(filepath.Join(dir, "audit-other.log"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := testRotateBackend(t, map[string]string{
+		"path":             filepath.Join(dir, "audit.log"),
+		"rotate_bytes":     "1",
+		"rotate_max_files": "2",
+	})
+	for i := 0; i < 6; i++ {
+		if err := testLogRequest(b, fmt.Sprintf("secret/%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, lines := testReadLogs(t, dir)
+	if len(names) != 4 || names[2] != "audit-other.log" || names[3] != "audit.log" {
+		t.Fatalf("bad: %v", names)
+	}
+
+	// The most recent entries are kept
+	if len(lines) != 3 {
+		t.Fatalf("bad: %v", lines)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, fmt.Sprintf(`"path":"secret/%d"`, i+3)) {
+			t.Fatalf("bad: %v", lines)
+		}
+	}
+}
+
+func TestAuditFile_rotateInvalid(t *testing.T) {
+	cases := []map[string]string{
+		{"path": "/dev/null", "rotate_bytes": "1024"},
+		{"path": "stdout", "rotate_bytes": "-1"},
+		{"path": "stdout", "rotate_duration": "soon"},
+		{"path": "stdout", "rotate_max_files": "many"},
+		{"path": "stdout", "rotate_compress": "maybe"},
+	}
+	for _, config := range cases {
+		_, err := Factory(&audit.BackendConfig{
+			Config:     config,
+			SaltConfig: &salt.Config{},
+			SaltView:   &logical.InmemStorage{},
+		})
+		if err == nil {
+			t.Fatalf("expected error for %v", config)
+		}
+	}
+}
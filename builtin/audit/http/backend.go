@@ -0,0 +1,547 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-rootcerts"
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// overflowBlock makes requests wait for room in the queue when it is
+	// full, while overflowDrop drops their entries
+	overflowBlock = "block"
+	overflowDrop  = "drop"
+)
+
+func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.SaltConfig == nil {
+		return nil, fmt.Errorf("nil salt config")
+	}
+	if conf.SaltView == nil {
+		return nil, fmt.Errorf("nil salt view")
+	}
+
+	address, ok := conf.Config["address"]
+	if !ok {
+		return nil, fmt.Errorf("address is required")
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("address must be an http or https URL")
+	}
+
+	format, ok := conf.Config["format"]
+	if !ok {
+		format = "json"
+	}
+	switch format {
+	case "json", "jsonx":
+	default:
+		return nil, fmt.Errorf("unknown format type %s", format)
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	headers := make(http.Header)
+	if raw, ok := conf.Config["headers"]; ok {
+		var values map[string]string
+		if err := jsonutil.DecodeJSON([]byte(raw), &values); err != nil {
+			return nil, fmt.Errorf("headers must be a JSON object of strings: %v", err)
+		}
+		for name, value := range values {
+			headers.Set(name, value)
+		}
+	}
+	switch format {
+	case "json":
+		headers.Set("Content-Type", "application/x-ndjson")
+	case "jsonx":
+		headers.Set("Content-Type", "application/xml")
+	}
+
+	timeout, err := durationOption(conf.Config, "timeout", "5s")
+	if err != nil {
+		return nil, err
+	}
+	batchInterval, err := durationOption(conf.Config, "batch_interval", "1s")
+	if err != nil {
+		return nil, err
+	}
+	retryBackoff, err := durationOption(conf.Config, "retry_backoff", "250ms")
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := intOption(conf.Config, "batch_size", 100)
+	if err != nil {
+		return nil, err
+	}
+	queueSize, err := intOption(conf.Config, "queue_size", 1024)
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, err := intOption(conf.Config, "max_retries", 3)
+	if err != nil {
+		return nil, err
+	}
+	bufferMaxSize, err := intOption(conf.Config, "buffer_max_size", 100*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize < 1 || queueSize < 1 || batchInterval <= 0 {
+		return nil, fmt.Errorf("batch_size, queue_size and batch_interval must be positive")
+	}
+
+	overflow, ok := conf.Config["overflow"]
+	if !ok {
+		overflow = overflowBlock
+	}
+	switch overflow {
+	case overflowBlock, overflowDrop:
+	default:
+		return nil, fmt.Errorf("overflow must be %q or %q", overflowBlock, overflowDrop)
+	}
+
+	client, err := newClient(conf.Config, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backend{
+		saltConfig: conf.SaltConfig,
+		saltView:   conf.SaltView,
+		formatConfig: audit.FormatterConfig{
+			Raw:          logRaw,
+			HMACAccessor: hmacAccessor,
+		},
+
+		client:         client,
+		address:        address,
+		headers:        headers,
+		batchSize:      batchSize,
+		batchInterval:  batchInterval,
+		maxRetries:     maxRetries,
+		retryBackoff:   retryBackoff,
+		dropOnOverflow: overflow == overflowDrop,
+		queue:          make(chan []byte, queueSize),
+		quitCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+
+	if path, ok := conf.Config["buffer_path"]; ok && path != "" {
+		b.spill, err = newSpillBuffer(path, int64(bufferMaxSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case "json":
+		b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "jsonx":
+		b.formatter.AuditFormatWriter = &audit.JSONxFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+// newClient creates the HTTP client used to send entries, configured with
+// the TLS options
+func newClient(config map[string]string, timeout time.Duration) (*http.Client, error) {
+	transport := cleanhttp.DefaultPooledTransport()
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config["tls_server_name"],
+	}
+
+	if err := rootcerts.ConfigureTLS(tlsConfig, &rootcerts.Config{
+		CAFile: config["tls_ca_cert"],
+		CAPath: config["tls_ca_path"],
+	}); err != nil {
+		return nil, err
+	}
+
+	if raw, ok := config["tls_skip_verify"]; ok {
+		skip, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = skip
+	}
+
+	certFile, keyFile := config["tls_client_cert"], config["tls_client_key"]
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case certFile != "" || keyFile != "":
+		return nil, fmt.Errorf("both tls_client_cert and tls_client_key must be provided")
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+func durationOption(config map[string]string, name, def string) (time.Duration, error) {
+	raw, ok := config[name]
+	if !ok {
+		raw = def
+	}
+	d, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return d, nil
+}
+
+func intOption(config map[string]string, name string, def int) (int, error) {
+	raw, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	i, err := strconv.Atoi(raw)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return i, nil
+}
+
+// Backend is the audit backend for the HTTP audit transport. Entries are
+// queued and sent in batches to the collector by a background goroutine,
+// so that requests are not held up by the collector. When the collector
+// cannot be reached, batches are spilled to disk if a buffer is configured,
+// and sent once it is back. When the queue is full, requests either wait
+// for room in it or have their entries dropped.
+type Backend struct {
+	formatter    audit.AuditFormatter
+	formatConfig audit.FormatterConfig
+
+	client  *http.Client
+	address string
+	headers http.Header
+
+	batchSize      int
+	batchInterval  time.Duration
+	maxRetries     int
+	retryBackoff   time.Duration
+	dropOnOverflow bool
+
+	// queue holds the formatted entries waiting to be sent
+	queue chan []byte
+
+	// spill holds the batches that could not be sent, if configured
+	spill *spillBuffer
+
+	quitCh    chan struct{}
+	doneCh    chan struct{}
+	closeOnce sync.Once
+
+	saltMutex  sync.RWMutex
+	salt       *salt.Salt
+	saltConfig *salt.Config
+	saltView   logical.Storage
+}
+
+func (b *Backend) GetHash(data string) (string, error) {
+	salt, err := b.Salt()
+	if err != nil {
+		return "", err
+	}
+	return audit.HashString(salt, data), nil
+}
+
+func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatRequest(&buf, b.formatConfig, auth, req, outerErr); err != nil {
+		return err
+	}
+	return b.enqueue(buf.Bytes())
+}
+
+func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
+	resp *logical.Response, outerErr error) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatResponse(&buf, b.formatConfig, auth, req, resp, outerErr); err != nil {
+		return err
+	}
+	return b.enqueue(buf.Bytes())
+}
+
+// enqueue queues an entry to be sent, applying the overflow policy if the
+// queue is full
+func (b *Backend) enqueue(entry []byte) error {
+	// Entries are sent separated by newlines
+	if !bytes.HasSuffix(entry, []byte("\n")) {
+		entry = append(entry, '\n')
+	}
+
+	select {
+	case <-b.quitCh:
+		return fmt.Errorf("audit backend is closed")
+	default:
+	}
+
+	select {
+	case b.queue <- entry:
+		return nil
+	default:
+	}
+
+	if b.dropOnOverflow {
+		metrics.IncrCounter([]string{"audit", "http", "dropped"}, 1)
+		return nil
+	}
+
+	metrics.IncrCounter([]string{"audit", "http", "blocked"}, 1)
+	select {
+	case b.queue <- entry:
+		return nil
+	case <-b.quitCh:
+		return fmt.Errorf("audit backend is closed")
+	}
+}
+
+// run collects queued entries in batches and sends them, until the backend
+// is closed
+func (b *Backend) run() {
+	defer close(b.doneCh)
+
+	ticker := time.NewTicker(b.batchInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case entry := <-b.queue:
+			batch = append(batch, entry)
+			if len(batch) < b.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-b.quitCh:
+			// Send what is left once, spilling it if that fails
+		drain:
+			for {
+				select {
+				case entry := <-b.queue:
+					batch = append(batch, entry)
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				if err := b.send(batch); err != nil {
+					b.spillOrDrop(batch)
+				}
+			}
+			return
+		}
+
+		b.flush(batch)
+		batch = nil
+	}
+}
+
+// flush sends the spilled batches, then the given one. Spilled batches go
+// first so that entries are received in order; while they cannot be sent,
+// new batches are spilled after them.
+func (b *Backend) flush(batch [][]byte) {
+	if b.spill != nil && !b.spill.empty() {
+		if err := b.spill.drain(b.batchSize, b.send); err != nil {
+			b.spillOrWait(batch)
+			return
+		}
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := b.sendWithRetry(batch); err != nil {
+		b.spillOrWait(batch)
+	}
+}
+
+// spillOrWait spills a batch that could not be sent. If the spill buffer is
+// full, sending is retried until it succeeds or room is made, holding up
+// the queue so that the overflow policy applies to new entries.
+func (b *Backend) spillOrWait(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+	if b.spill == nil {
+		b.drop(batch)
+		return
+	}
+
+	backoff := b.retryBackoff
+	for b.spill.full() {
+		select {
+		case <-b.quitCh:
+			b.drop(batch)
+			return
+		case <-time.After(backoff):
+		}
+		if b.spill.drain(b.batchSize, b.send) == nil {
+			if b.send(batch) == nil {
+				return
+			}
+		}
+		if backoff < b.batchInterval {
+			backoff *= 2
+		}
+	}
+
+	b.spillOrDrop(batch)
+}
+
+// spillOrDrop spills a batch if possible, dropping it otherwise
+func (b *Backend) spillOrDrop(batch [][]byte) {
+	if b.spill == nil || b.spill.full() {
+		b.drop(batch)
+		return
+	}
+	if err := b.spill.append(batch); err != nil {
+		b.drop(batch)
+		return
+	}
+	metrics.IncrCounter([]string{"audit", "http", "spilled"}, float32(len(batch)))
+}
+
+func (b *Backend) drop(batch [][]byte) {
+	metrics.IncrCounter([]string{"audit", "http", "dropped"}, float32(len(batch)))
+}
+
+// sendWithRetry sends a batch, retrying with exponential backoff
+func (b *Backend) sendWithRetry(batch [][]byte) error {
+	backoff := b.retryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = b.send(batch); err == nil {
+			return nil
+		}
+		metrics.IncrCounter([]string{"audit", "http", "send_failure"}, 1)
+		if attempt >= b.maxRetries {
+			return err
+		}
+
+		select {
+		case <-b.quitCh:
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send posts a batch of entries to the collector
+func (b *Backend) send(batch [][]byte) error {
+	defer metrics.MeasureSince([]string{"audit", "http", "send"}, time.Now())
+
+	body := bytes.Join(batch, nil)
+	req, err := http.NewRequest("POST", b.address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range b.headers {
+		req.Header[name] = values
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close stops sending entries. Entries still queued are sent once, or
+// spilled if that fails.
+func (b *Backend) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.quitCh)
+	})
+	<-b.doneCh
+	return nil
+}
+
+func (b *Backend) Reload() error {
+	return nil
+}
+
+func (b *Backend) Salt() (*salt.Salt, error) {
+	b.saltMutex.RLock()
+	if b.salt != nil {
+		defer b.saltMutex.RUnlock()
+		return b.salt, nil
+	}
+	b.saltMutex.RUnlock()
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	if b.salt != nil {
+		return b.salt, nil
+	}
+	salt, err := salt.NewSalt(b.saltView, b.saltConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.salt = salt
+	return salt, nil
+}
+
+func (b *Backend) Invalidate() {
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	b.salt = nil
+}
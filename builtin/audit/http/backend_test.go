@@ -0,0 +1,364 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testCollector is a stub collector recording the entries it receives
+type testCollector struct {
+	l       sync.Mutex
+	status  int
+	paths   []string
+	headers []http.Header
+
+	// block, if set, holds up requests until it is closed
+	block chan struct{}
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.block != nil {
+		<-c.block
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.status != 0 && c.status != http.StatusOK {
+		w.WriteHeader(c.status)
+		return
+	}
+	c.headers = append(c.headers, r.Header)
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		var entry struct {
+			Request struct {
+				Path string `json:"path"`
+			} `json:"request"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.paths = append(c.paths, entry.Request.Path)
+	}
+}
+
+func (c *testCollector) setStatus(status int) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.status = status
+}
+
+func (c *testCollector) received() ([]string, []http.Header) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return append([]string(nil), c.paths...), append([]http.Header(nil), c.headers...)
+}
+
+// waitReceived waits for the collector to receive the given number of
+// entries
+func (c *testCollector) waitReceived(t *testing.T, count int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		paths, _ := c.received()
+		if len(paths) >= count {
+			return paths
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d entries, got %d", count, len(paths))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testBackend(t *testing.T, config map[string]string) *Backend {
+	b, err := Factory(&audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend)
+}
+
+func testLogRequest(b *Backend, i int) error {
+	return b.LogRequest(nil, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      fmt.Sprintf("secret/%d", i),
+	}, nil)
+}
+
+func TestAuditHTTP_Factory(t *testing.T) {
+	cases := []map[string]string{
+		{},
+		{"address": "tcp://127.0.0.1:9090"},
+		{"address": "http://127.0.0.1:9090", "format": "xml"},
+		{"address": "http://127.0.0.1:9090", "headers": "foo"},
+		{"address": "http://127.0.0.1:9090", "batch_size": "0"},
+		{"address": "http://127.0.0.1:9090", "timeout": "soon"},
+		{"address": "http://127.0.0.1:9090", "overflow": "wait"},
+		{"address": "http://127.0.0.1:9090", "tls_client_cert": "cert.pem"},
+	}
+	for _, config := range cases {
+		_, err := Factory(&audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   &logical.InmemStorage{},
+			Config:     config,
+		})
+		if err == nil {
+			t.Fatalf("expected error for %v", config)
+		}
+	}
+}
+
+func TestAuditHTTP_Batch(t *testing.T) {
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"headers":        `{"X-Collector-Token": "foo"}`,
+		"batch_size":     "3",
+		"batch_interval": "1h",
+	})
+
+	// A full batch is sent right away
+	for i := 0; i < 4; i++ {
+		if err := testLogRequest(b, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collector.waitReceived(t, 3)
+	_, headers := collector.received()
+	if len(headers) != 1 {
+		t.Fatalf("expected a single batch, got %d", len(headers))
+	}
+	if v := headers[0].Get("X-Collector-Token"); v != "foo" {
+		t.Fatalf("bad: X-Collector-Token %q", v)
+	}
+	if v := headers[0].Get("Content-Type"); v != "application/x-ndjson" {
+		t.Fatalf("bad: Content-Type %q", v)
+	}
+
+	// The rest is sent on close
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	paths, headers := collector.received()
+	if len(paths) != 4 || len(headers) != 2 {
+		t.Fatalf("bad: %v", paths)
+	}
+	for i, path := range paths {
+		if path != "secret/"+strconv.Itoa(i) {
+			t.Fatalf("bad: %v", paths)
+		}
+	}
+
+	if err := b.LogRequest(nil, &logical.Request{Path: "foo"}, nil); err == nil {
+		t.Fatalf("expected error logging to a closed backend")
+	}
+}
+
+func TestAuditHTTP_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_http-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bufferPath := filepath.Join(dir, "buffer")
+
+	collector := &testCollector{status: http.StatusInternalServerError}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"batch_size":     "2",
+		"batch_interval": "10ms",
+		"max_retries":    "0",
+		"buffer_path":    bufferPath,
+	})
+	defer b.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := testLogRequest(b, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Entries are spilled while the collector is down
+	deadline := time.Now().Add(5 * time.Second)
+	for b.spill.empty() || len(b.queue) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for entries to be spilled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Once it is back, they are sent in order, followed by new entries
+	collector.setStatus(http.StatusOK)
+	if err := testLogRequest(b, 5); err != nil {
+		t.Fatal(err)
+	}
+	paths := collector.waitReceived(t, 6)
+	for i, path := range paths {
+		if path != "secret/"+strconv.Itoa(i) {
+			t.Fatalf("bad: %v", paths)
+		}
+	}
+	if !b.spill.empty() {
+		t.Fatalf("expected the buffer to be empty")
+	}
+	if _, err := os.Stat(bufferPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the buffer to be removed: %v", err)
+	}
+}
+
+func TestAuditHTTP_SpillRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_http-spill_restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bufferPath := filepath.Join(dir, "buffer")
+
+	// Entries left in the buffer by a previous run are sent first, and a
+	// partial entry at its end is ignored
+	spill, err := newSpillBuffer(bufferPath, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spill.append([][]byte{
+		[]byte(`{"request":{"path":"secret/0"}}` + "\n"),
+		[]byte(`{"request":{"path":"secret/1"}}` + "\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(bufferPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"batch_interval": "10ms",
+		"buffer_path":    bufferPath,
+	})
+	defer b.Close()
+
+	if err := testLogRequest(b, 2); err != nil {
+		t.Fatal(err)
+	}
+	paths := collector.waitReceived(t, 3)
+	for i, path := range paths {
+		if path != "secret/"+strconv.Itoa(i) {
+			t.Fatalf("bad: %v", paths)
+		}
+	}
+}
+
+func TestAuditHTTP_OverflowDrop(t *testing.T) {
+	collector := &testCollector{block: make(chan struct{})}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	defer close(collector.block)
+
+	b := testBackend(t, map[string]string{
+		"address":    server.URL,
+		"batch_size": "1",
+		"queue_size": "1",
+		"overflow":   "drop",
+	})
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for i := 0; i < 10; i++ {
+			if err := testLogRequest(b, i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("requests blocked with the drop overflow policy")
+	}
+}
+
+func TestAuditHTTP_OverflowBlock(t *testing.T) {
+	collector := &testCollector{block: make(chan struct{})}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":    server.URL,
+		"batch_size": "1",
+		"queue_size": "1",
+		"timeout":    "10s",
+	})
+	defer b.Close()
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for i := 0; i < 5; i++ {
+			if err := testLogRequest(b, i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-doneCh:
+		t.Fatalf("requests did not block with the block overflow policy")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(collector.block)
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("requests still blocked after the collector caught up")
+	}
+
+	paths := collector.waitReceived(t, 5)
+	for i, path := range paths {
+		if path != "secret/"+strconv.Itoa(i) {
+			t.Fatalf("bad: %v", paths)
+		}
+	}
+}
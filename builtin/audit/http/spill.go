@@ -0,0 +1,184 @@
+package http
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// spillBuffer is an on-disk buffer of the entries that could not be sent to
+// the collector. Entries are appended to a file as length-prefixed records,
+// so that they are kept across restarts, and are removed once sent.
+type spillBuffer struct {
+	l       sync.Mutex
+	path    string
+	maxSize int64
+	size    int64
+}
+
+// newSpillBuffer opens the spill buffer at the given path, picking up the
+// entries left over by a previous run
+func newSpillBuffer(path string, maxSize int64) (*spillBuffer, error) {
+	s := &spillBuffer{
+		path:    path,
+		maxSize: maxSize,
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to open buffer: %v", err)
+	default:
+		s.size = info.Size()
+	}
+	return s, nil
+}
+
+// empty returns whether there are no spilled entries
+func (s *spillBuffer) empty() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.size == 0
+}
+
+// full returns whether the buffer has reached its maximum size
+func (s *spillBuffer) full() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.size >= s.maxSize
+}
+
+// append adds entries to the end of the buffer
+func (s *spillBuffer) append(entries [][]byte) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	var written int64
+	for _, entry := range entries {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(entry)))
+		if _, err := w.Write(length[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+		written += int64(len(length) + len(entry))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	s.size += written
+	return nil
+}
+
+// drain sends the spilled entries in batches of the given size, in the
+// order they were spilled. If sending fails, the entries that were not sent
+// are kept and the error is returned.
+func (s *spillBuffer) drain(batchSize int, send func([][]byte) error) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.size == 0 {
+		return nil
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		batch, n, err := readBatch(r, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err := send(batch); err != nil {
+			if offset > 0 {
+				if tErr := s.truncateFront(f, offset); tErr != nil {
+					return tErr
+				}
+			}
+			return err
+		}
+		offset += n
+	}
+
+	f.Close()
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.size = 0
+	return nil
+}
+
+// truncateFront removes the entries before the offset from the buffer. The
+// caller must hold the lock.
+func (s *spillBuffer) truncateFront(f *os.File, offset int64) error {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, f)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+	s.size = n
+	return nil
+}
+
+// readBatch reads up to batchSize entries, returning them along with the
+// number of bytes read. A partial entry left at the end of the buffer by an
+// interrupted write is ignored.
+func readBatch(r *bufio.Reader, batchSize int) ([][]byte, int64, error) {
+	var batch [][]byte
+	var n int64
+	for len(batch) < batchSize {
+		var length [4]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, 0, fmt.Errorf("failed to read buffer: %v", err)
+		}
+		entry := make([]byte, binary.BigEndian.Uint32(length[:]))
+		if _, err := io.ReadFull(r, entry); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, 0, fmt.Errorf("failed to read buffer: %v", err)
+		}
+		batch = append(batch, entry)
+		n += int64(len(length) + len(entry))
+	}
+	return batch, n, nil
+}
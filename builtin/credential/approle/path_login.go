@@ -55,6 +55,7 @@ func (b *backend) pathLoginUpdate(req *logical.Request, data *framework.FieldDat
 		Alias: &logical.Alias{
 			Name: role.RoleID,
 		},
+		TokenType: role.TokenType,
 	}
 
 	// If 'Period' is set, use the value of 'Period' as the TTL.
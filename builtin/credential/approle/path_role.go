@@ -57,6 +57,9 @@ type roleStorageEntry struct {
 	// value is not modified on the role. If the `Period` in the role is modified,
 	// a token will pick up the new value during its next renewal.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
+
+	// TokenType is the type of token issued on login
+	TokenType logical.TokenType `json:"token_type" mapstructure:"token_type" structs:"token_type"`
 }
 
 // roleIDStorageEntry represents the reverse mapping from RoleID to Role
@@ -148,6 +151,12 @@ be renewed. Defaults to 0, in which case the value will fall back to the system/
 should never expire. The token should be renewed within the
 duration specified by this value. At each renewal, the token's
 TTL will be set to the value of this parameter.`,
+				},
+				"token_type": &framework.FieldSchema{
+					Type:    framework.TypeString,
+					Default: string(logical.TokenTypeDefaultService),
+					Description: `The type of token to issue on login: "service", "batch",
+"default-service" or "default-batch". Defaults to "default-service".`,
 				},
 				"role_id": &framework.FieldSchema{
 					Type:        framework.TypeString,
@@ -783,6 +792,21 @@ func (b *backend) pathRoleCreateUpdate(req *logical.Request, data *framework.Fie
 		return logical.ErrorResponse(fmt.Sprintf("'period' of '%s' is greater than the backend's maximum lease TTL of '%s'", role.Period.String(), b.System().MaxLeaseTTL().String())), nil
 	}
 
+	tokenTypeRaw, ok := data.GetOk("token_type")
+	if !ok && req.Operation == logical.CreateOperation {
+		tokenTypeRaw, ok = data.Get("token_type"), true
+	}
+	if ok {
+		tokenType, err := logical.ParseTokenType(tokenTypeRaw.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if tokenType == logical.TokenTypeDefault {
+			tokenType = logical.TokenTypeDefaultService
+		}
+		role.TokenType = tokenType
+	}
+
 	if secretIDNumUsesRaw, ok := data.GetOk("secret_id_num_uses"); ok {
 		role.SecretIDNumUses = secretIDNumUsesRaw.(int)
 	} else if req.Operation == logical.CreateOperation {
@@ -807,6 +831,10 @@ func (b *backend) pathRoleCreateUpdate(req *logical.Request, data *framework.Fie
 		return logical.ErrorResponse("token_num_uses cannot be negative"), nil
 	}
 
+	if role.TokenType == logical.TokenTypeBatch && (role.Period != 0 || role.TokenNumUses != 0) {
+		return logical.ErrorResponse("batch tokens cannot be periodic or have a use limit"), nil
+	}
+
 	if tokenTTLRaw, ok := data.GetOk("token_ttl"); ok {
 		role.TokenTTL = time.Second * time.Duration(tokenTTLRaw.(int))
 	} else if req.Operation == logical.CreateOperation {
@@ -854,6 +882,11 @@ func (b *backend) pathRoleRead(req *logical.Request, data *framework.FieldData)
 		role.TokenMaxTTL /= time.Second
 		role.Period /= time.Second
 
+		// Roles created before token types existed issue service tokens
+		if role.TokenType == logical.TokenTypeDefault {
+			role.TokenType = logical.TokenTypeDefaultService
+		}
+
 		// Create a map of data to be returned and remove sensitive information from it
 		data := structs.New(role).Map()
 		delete(data, "role_id")
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	auditFile "github.com/hashicorp/vault/builtin/audit/file"
+	auditHTTP "github.com/hashicorp/vault/builtin/audit/http"
 	auditSocket "github.com/hashicorp/vault/builtin/audit/socket"
 	auditSyslog "github.com/hashicorp/vault/builtin/audit/syslog"
 	"github.com/hashicorp/vault/physical"
@@ -38,6 +39,10 @@ import (
 	physSwift "github.com/hashicorp/vault/physical/swift"
 	physZooKeeper "github.com/hashicorp/vault/physical/zookeeper"
 
+	sr "github.com/hashicorp/vault/serviceregistration"
+	srConsul "github.com/hashicorp/vault/serviceregistration/consul"
+	srKubernetes "github.com/hashicorp/vault/serviceregistration/kubernetes"
+
 	"github.com/hashicorp/vault/builtin/logical/aws"
 	"github.com/hashicorp/vault/builtin/logical/cassandra"
 	"github.com/hashicorp/vault/builtin/logical/consul"
@@ -60,6 +65,32 @@ import (
 	"github.com/mitchellh/cli"
 )
 
+// physicalBackends are the storage backends available to the server and to
+// storage migrations.
+var physicalBackends = map[string]physical.Factory{
+	"azure":                  physAzure.NewAzureBackend,
+	"cassandra":              physCassandra.NewCassandraBackend,
+	"cockroachdb":            physCockroachDB.NewCockroachDBBackend,
+	"consul":                 physConsul.NewConsulBackend,
+	"couchdb":                physCouchDB.NewCouchDBBackend,
+	"couchdb_transactional":  physCouchDB.NewTransactionalCouchDBBackend,
+	"dynamodb":               physDynamoDB.NewDynamoDBBackend,
+	"etcd":                   physEtcd.NewEtcdBackend,
+	"file":                   physFile.NewFileBackend,
+	"file_transactional":     physFile.NewTransactionalFileBackend,
+	"gcs":                    physGCS.NewGCSBackend,
+	"inmem":                  physInmem.NewInmem,
+	"inmem_ha":               physInmem.NewInmemHA,
+	"inmem_transactional":    physInmem.NewTransactionalInmem,
+	"inmem_transactional_ha": physInmem.NewTransactionalInmemHA,
+	"mssql":                  physMSSQL.NewMSSQLBackend,
+	"mysql":                  physMySQL.NewMySQLBackend,
+	"postgresql":             physPostgreSQL.NewPostgreSQLBackend,
+	"s3":                     physS3.NewS3Backend,
+	"swift":                  physSwift.NewSwiftBackend,
+	"zookeeper":              physZooKeeper.NewZooKeeperBackend,
+}
+
 // Commands returns the mapping of CLI commands for Vault. The meta
 // parameter lets you set meta options for all commands.
 func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
@@ -89,6 +120,7 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"file":   auditFile.Factory,
 					"syslog": auditSyslog.Factory,
 					"socket": auditSocket.Factory,
+					"http":   auditHTTP.Factory,
 				},
 				CredentialBackends: map[string]logical.Factory{
 					"approle":    credAppRole.Factory,
@@ -104,6 +136,10 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"kubernetes": credKube.Factory,
 					"plugin":     plugin.Factory,
 				},
+				ServiceRegistrations: map[string]sr.Factory{
+					"consul":     srConsul.NewServiceRegistration,
+					"kubernetes": srKubernetes.NewServiceRegistration,
+				},
 				LogicalBackends: map[string]logical.Factory{
 					"aws":        aws.Factory,
 					"consul":     consul.Factory,
@@ -125,29 +161,7 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 				SighupCh:   command.MakeSighupCh(),
 			}
 
-			c.PhysicalBackends = map[string]physical.Factory{
-				"azure":                  physAzure.NewAzureBackend,
-				"cassandra":              physCassandra.NewCassandraBackend,
-				"cockroachdb":            physCockroachDB.NewCockroachDBBackend,
-				"consul":                 physConsul.NewConsulBackend,
-				"couchdb":                physCouchDB.NewCouchDBBackend,
-				"couchdb_transactional":  physCouchDB.NewTransactionalCouchDBBackend,
-				"dynamodb":               physDynamoDB.NewDynamoDBBackend,
-				"etcd":                   physEtcd.NewEtcdBackend,
-				"file":                   physFile.NewFileBackend,
-				"file_transactional":     physFile.NewTransactionalFileBackend,
-				"gcs":                    physGCS.NewGCSBackend,
-				"inmem":                  physInmem.NewInmem,
-				"inmem_ha":               physInmem.NewInmemHA,
-				"inmem_transactional":    physInmem.NewTransactionalInmem,
-				"inmem_transactional_ha": physInmem.NewTransactionalInmemHA,
-				"mssql":                  physMSSQL.NewMSSQLBackend,
-				"mysql":                  physMySQL.NewMySQLBackend,
-				"postgresql":             physPostgreSQL.NewPostgreSQLBackend,
-				"s3":                     physS3.NewS3Backend,
-				"swift":                  physSwift.NewSwiftBackend,
-				"zookeeper":              physZooKeeper.NewZooKeeperBackend,
-			}
+			c.PhysicalBackends = physicalBackends
 
 			return c, nil
 		},
@@ -311,6 +325,20 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"debug": func() (cli.Command, error) {
+			return &command.DebugCommand{
+				Meta:       *metaPtr,
+				ShutdownCh: command.MakeShutdownCh(),
+			}, nil
+		},
+
+		"monitor": func() (cli.Command, error) {
+			return &command.MonitorCommand{
+				Meta:       *metaPtr,
+				ShutdownCh: command.MakeShutdownCh(),
+			}, nil
+		},
+
 		"mount": func() (cli.Command, error) {
 			return &command.MountCommand{
 				Meta: *metaPtr,
@@ -335,6 +363,25 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"operator migrate": func() (cli.Command, error) {
+			return &command.OperatorMigrateCommand{
+				Meta:             *metaPtr,
+				PhysicalBackends: physicalBackends,
+			}, nil
+		},
+
+		"operator snapshot save": func() (cli.Command, error) {
+			return &command.OperatorSnapshotSaveCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
+		"operator snapshot restore": func() (cli.Command, error) {
+			return &command.OperatorSnapshotRestoreCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
 		"rotate": func() (cli.Command, error) {
 			return &command.RotateCommand{
 				Meta: *metaPtr,
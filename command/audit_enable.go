@@ -134,6 +134,7 @@ func (c *AuditEnableCommand) AutocompleteArgs() complete.Predictor {
 		"file",
 		"syslog",
 		"socket",
+		"http",
 	)
 }
 
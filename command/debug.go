@@ -0,0 +1,526 @@
+package command
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/meta"
+)
+
+const (
+	// debugTimestampFormat names the bundle and the directories of each
+	// capture; it avoids colons so that the names are valid everywhere
+	debugTimestampFormat = "2006-01-02T15-04-05Z"
+
+	// debugMaxProfileDuration bounds how long each CPU profile runs for so
+	// that the requests stay short
+	debugMaxProfileDuration = 30 * time.Second
+
+	// debugProfileMargin is how much shorter than the interval a CPU profile
+	// is, so that it is done before the next capture starts one: the server
+	// only runs a single CPU profile at a time
+	debugProfileMargin = 5 * time.Second
+)
+
+// debugTargets are the targets collected by default
+var debugTargets = []string{"config", "host", "metrics", "pprof", "replication-status", "server-status"}
+
+// DebugCommand is a Command that collects diagnostics from a Vault server
+// into a bundle.
+type DebugCommand struct {
+	meta.Meta
+
+	// ShutdownCh stops the collection early when closed; the bundle is
+	// still written
+	ShutdownCh chan struct{}
+}
+
+// debugCapture is an entry of the files of polled targets
+type debugCapture struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// debugIndex describes the bundle
+type debugIndex struct {
+	VaultAddress    string    `json:"vault_address"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	Duration        string    `json:"duration"`
+	Interval        string    `json:"interval"`
+	MetricsInterval string    `json:"metrics_interval"`
+	Targets         []string  `json:"targets"`
+	Errors          []string  `json:"errors"`
+}
+
+// debugCollector holds the state of a collection
+type debugCollector struct {
+	client *api.Client
+	dir    string
+
+	l        sync.Mutex
+	captures map[string][]debugCapture
+	errors   []string
+
+	// profileLock and traceLock serialize CPU profiles and traces, which the
+	// server refuses to run concurrently, in case one outlasts the interval
+	profileLock sync.Mutex
+	traceLock   sync.Mutex
+}
+
+func (c *DebugCommand) Run(args []string) int {
+	var duration, interval, metricsInterval time.Duration
+	var output, targetsRaw string
+	flags := c.Meta.FlagSet("debug", meta.FlagSetDefault)
+	flags.DurationVar(&duration, "duration", 2*time.Minute, "")
+	flags.DurationVar(&interval, "interval", 30*time.Second, "")
+	flags.DurationVar(&metricsInterval, "metrics-interval", 10*time.Second, "")
+	flags.StringVar(&output, "output", "", "")
+	flags.StringVar(&targetsRaw, "targets", strings.Join(debugTargets, ","), "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\ndebug expects no arguments"))
+		return 1
+	}
+
+	if interval < time.Second || metricsInterval < time.Second {
+		c.Ui.Error("The intervals must be at least one second")
+		return 1
+	}
+	if duration < interval || duration < metricsInterval {
+		c.Ui.Error("The duration must be at least as long as the intervals")
+		return 1
+	}
+
+	targets := strutil.RemoveDuplicates(strutil.ParseStringSlice(targetsRaw, ","), true)
+	for _, target := range targets {
+		if !strutil.StrListContains(debugTargets, target) {
+			c.Ui.Error(fmt.Sprintf(
+				"Unknown target %q, expected one of %s", target, strings.Join(debugTargets, ", ")))
+			return 1
+		}
+	}
+	if len(targets) == 0 {
+		c.Ui.Error("At least one target must be given")
+		return 1
+	}
+
+	startTime := time.Now().UTC()
+	bundleName := "vault-debug-" + startTime.Format(debugTimestampFormat)
+	if output == "" {
+		output = bundleName + ".tar.gz"
+	}
+	if _, err := os.Stat(output); err == nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Output file %s already exists", output))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing client: %s", err))
+		return 2
+	}
+
+	// Captures are staged in a temporary directory and archived at the end
+	stagingDir, err := ioutil.TempDir("", "vault-debug")
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error creating staging directory: %s", err))
+		return 1
+	}
+	defer os.RemoveAll(stagingDir)
+
+	collector := &debugCollector{
+		client:   client,
+		dir:      filepath.Join(stagingDir, bundleName),
+		captures: make(map[string][]debugCapture),
+	}
+	if err := os.Mkdir(collector.dir, 0700); err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error creating staging directory: %s", err))
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf(
+		"Collecting %s from %s for %s, press Ctrl-C to stop early",
+		strings.Join(targets, ", "), client.Address(), duration))
+
+	if strutil.StrListContains(targets, "config") {
+		collector.capture("config", func() (interface{}, error) {
+			return collector.read("sys/config/state/sanitized")
+		})
+	}
+
+	// Metrics are polled on their own interval, everything else on the
+	// main one; captures run in the background so that slow ones, such as
+	// CPU profiles, do not delay the others
+	var wg sync.WaitGroup
+	collect := func(metricsOnly bool) {
+		for _, target := range targets {
+			if (target == "metrics") != metricsOnly {
+				continue
+			}
+			wg.Add(1)
+			go func(target string) {
+				defer wg.Done()
+				collector.collect(target, interval)
+			}(target)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	metricsTicker := time.NewTicker(metricsInterval)
+	defer metricsTicker.Stop()
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+
+	collect(false)
+	collect(true)
+LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			collect(false)
+		case <-metricsTicker.C:
+			collect(true)
+		case <-deadline.C:
+			break LOOP
+		case <-c.ShutdownCh:
+			c.Ui.Output("Interrupted, writing the collected data")
+			break LOOP
+		}
+	}
+	wg.Wait()
+
+	index := &debugIndex{
+		VaultAddress:    client.Address(),
+		StartTime:       startTime,
+		EndTime:         time.Now().UTC(),
+		Duration:        duration.String(),
+		Interval:        interval.String(),
+		MetricsInterval: metricsInterval.String(),
+		Targets:         targets,
+		Errors:          collector.errors,
+	}
+	if err := collector.writeFiles(index); err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error writing the collected data: %s", err))
+		return 1
+	}
+
+	if err := writeTarGz(output, stagingDir, bundleName); err != nil {
+		os.Remove(output)
+		c.Ui.Error(fmt.Sprintf(
+			"Error writing the bundle: %s", err))
+		return 1
+	}
+
+	for _, err := range collector.errors {
+		c.Ui.Error(err)
+	}
+	c.Ui.Output(fmt.Sprintf("Saved debug bundle to %s", output))
+	return 0
+}
+
+// collect captures a target once
+func (d *debugCollector) collect(target string, interval time.Duration) {
+	switch target {
+	case "host":
+		d.capture("host_info", func() (interface{}, error) {
+			return d.read("sys/host-info")
+		})
+	case "metrics":
+		d.capture("metrics", func() (interface{}, error) {
+			var metrics interface{}
+			err := d.rawRequest("/v1/sys/metrics", nil, func(r io.Reader) error {
+				return json.NewDecoder(r).Decode(&metrics)
+			})
+			return metrics, err
+		})
+	case "pprof":
+		d.capturePprof(interval)
+	case "replication-status":
+		d.capture("replication_status", func() (interface{}, error) {
+			return d.read("sys/replication/status")
+		})
+	case "server-status":
+		d.capture("server_status", func() (interface{}, error) {
+			sealStatus, err := d.client.Sys().SealStatus()
+			if err != nil {
+				return nil, err
+			}
+			leader, err := d.client.Sys().Leader()
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"seal_status": sealStatus,
+				"leader":      leader,
+			}, nil
+		})
+	}
+}
+
+// capture records the result of f under the given name
+func (d *debugCollector) capture(name string, f func() (interface{}, error)) {
+	timestamp := time.Now().UTC()
+	data, err := f()
+	if err != nil {
+		d.addError(fmt.Errorf("Error collecting %s: %s", name, err))
+		return
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.captures[name] = append(d.captures[name], debugCapture{
+		Timestamp: timestamp,
+		Data:      data,
+	})
+}
+
+// debugProfileDuration returns how long the CPU profiles of captures taken at
+// the given interval run for: a margin shorter than the interval, between one
+// second and debugMaxProfileDuration
+func debugProfileDuration(interval time.Duration) time.Duration {
+	duration := interval - debugProfileMargin
+	if duration > debugMaxProfileDuration {
+		duration = debugMaxProfileDuration
+	}
+	if duration < time.Second {
+		duration = time.Second
+	}
+	return duration
+}
+
+// capturePprof writes the profiles of the server to a directory named after
+// the time of the capture
+func (d *debugCollector) capturePprof(interval time.Duration) {
+	dir := filepath.Join(d.dir, time.Now().UTC().Format(debugTimestampFormat))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		d.addError(fmt.Errorf("Error collecting pprof: %s", err))
+		return
+	}
+
+	profileDuration := debugProfileDuration(interval)
+
+	profiles := []struct {
+		file   string
+		name   string
+		params map[string]string
+		lock   *sync.Mutex
+	}{
+		{"goroutine.prof", "goroutine", nil, nil},
+		{"goroutines.txt", "goroutine", map[string]string{"debug": "2"}, nil},
+		{"heap.prof", "heap", nil, nil},
+		{"profile.prof", "profile", map[string]string{"seconds": strconv.Itoa(int(profileDuration.Seconds()))}, &d.profileLock},
+		{"trace.out", "trace", map[string]string{"seconds": "1"}, &d.traceLock},
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range profiles {
+		wg.Add(1)
+		go func(file, name string, params map[string]string, lock *sync.Mutex) {
+			defer wg.Done()
+			if lock != nil {
+				lock.Lock()
+				defer lock.Unlock()
+			}
+			err := d.rawRequest("/v1/sys/pprof/"+name, params, func(r io.Reader) error {
+				f, err := os.OpenFile(filepath.Join(dir, file), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(f, r)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				return err
+			})
+			if err != nil {
+				d.addError(fmt.Errorf("Error collecting pprof %s: %s", name, err))
+			}
+		}(p.file, p.name, p.params, p.lock)
+	}
+	wg.Wait()
+}
+
+// read reads a path and returns its data
+func (d *debugCollector) read(path string) (interface{}, error) {
+	secret, err := d.client.Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no data returned")
+	}
+	return secret.Data, nil
+}
+
+// rawRequest makes a GET request and hands the body of the response to f
+func (d *debugCollector) rawRequest(path string, params map[string]string, f func(io.Reader) error) error {
+	r := d.client.NewRequest("GET", path)
+	for key, value := range params {
+		r.Params.Set(key, value)
+	}
+	resp, err := d.client.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return f(resp.Body)
+}
+
+func (d *debugCollector) addError(err error) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.errors = append(d.errors, err.Error())
+}
+
+// writeFiles writes the index and the captures of the polled targets
+func (d *debugCollector) writeFiles(index *debugIndex) error {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	files := map[string]interface{}{
+		"index.json": index,
+	}
+	for name, captures := range d.captures {
+		files[name+".json"] = captures
+	}
+
+	for file, data := range files {
+		out, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(d.dir, file), out, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTarGz archives the directory name under baseDir into a gzipped tarball
+func writeTarGz(output, baseDir, name string) error {
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(filepath.Join(baseDir, name), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(tw, in)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (c *DebugCommand) Synopsis() string {
+	return "Collect diagnostics from a Vault server into a bundle"
+}
+
+func (c *DebugCommand) Help() string {
+	helpText := `
+Usage: vault debug [options]
+
+  Polls the Vault server the client is connected to for the given duration
+  and writes what it collected to a timestamped gzipped tarball, to be shared
+  when troubleshooting a node. The bundle holds an index.json describing the
+  collection, a JSON file for each polled target with one entry per capture,
+  and a directory of runtime profiles for each capture, which can be read
+  with "go tool pprof".
+
+  Errors collecting a target are reported and listed in the index, but do not
+  stop the collection. Interrupting the command stops the collection early
+  and still writes the bundle.
+
+  This requires a token with sudo privileges on sys/pprof, sys/host-info and
+  sys/config/state/sanitized, and read access to sys/metrics and
+  sys/replication/status. Profiles, host information and the configuration
+  are those of the node the command talks to, standby nodes included, so run
+  the command against the address of the node to inspect.
+
+General Options:
+` + meta.GeneralOptionsUsage() + `
+Debug Options:
+
+  -duration=<duration>    How long to collect for. Defaults to "2m".
+
+  -interval=<duration>    How often to capture the targets other than the
+                          metrics. CPU profiles run for 5 seconds less, between
+                          1 and 30 seconds. Defaults to "30s".
+
+  -metrics-interval=<duration>
+                          How often to capture the metrics. Defaults to "10s".
+
+  -output=<path>          The file to write the bundle to, which must not
+                          exist. Defaults to vault-debug-<timestamp>.tar.gz
+                          in the current directory.
+
+  -targets=<list>         Comma-separated targets to collect, among "config",
+                          "host", "metrics", "pprof", "replication-status" and
+                          "server-status". Defaults to all of them.
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+	"github.com/mitchellh/cli"
+)
+
+func TestDebug(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	dir, err := ioutil.TempDir("", "vault-debug-test")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "bundle.tar.gz")
+
+	ui := new(cli.MockUi)
+	c := &DebugCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+
+	args := []string{
+		"-address", addr,
+		"-duration", "1s",
+		"-interval", "1s",
+		"-metrics-interval", "1s",
+		"-targets", "config,host,pprof,server-status",
+		"-output", output,
+	}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		// Strip the name of the bundle and, for profiles, the timestamp
+		parts := strings.Split(strings.TrimSuffix(header.Name, "/"), "/")
+		if !strings.HasPrefix(parts[0], "vault-debug-") {
+			t.Fatalf("bad: %s", header.Name)
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		files[parts[len(parts)-1]] = body
+	}
+
+	for _, name := range []string{"index.json", "config.json", "host_info.json", "server_status.json", "goroutine.prof", "goroutines.txt", "heap.prof", "profile.prof", "trace.out"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("missing %s in bundle", name)
+		}
+	}
+	if _, ok := files["metrics.json"]; ok {
+		t.Fatal("metrics should not have been collected")
+	}
+
+	var index debugIndex
+	if err := json.Unmarshal(files["index.json"], &index); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(index.Errors) != 0 || len(index.Targets) != 4 {
+		t.Fatalf("bad: %#v", index)
+	}
+	var hostInfo []debugCapture
+	if err := json.Unmarshal(files["host_info.json"], &hostInfo); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(hostInfo) == 0 || hostInfo[0].Data.(map[string]interface{})["hostname"] == nil {
+		t.Fatalf("bad: %#v", hostInfo)
+	}
+}
+
+func TestDebug_ProfileDuration(t *testing.T) {
+	cases := map[time.Duration]time.Duration{
+		// The defaults leave room for the profile to finish before the next
+		// capture
+		30 * time.Second: 25 * time.Second,
+		time.Minute:      30 * time.Second,
+		10 * time.Second: 5 * time.Second,
+		5 * time.Second:  time.Second,
+		time.Second:      time.Second,
+	}
+	for interval, expected := range cases {
+		if actual := debugProfileDuration(interval); actual != expected {
+			t.Fatalf("%s: expected %s, got %s", interval, expected, actual)
+		}
+	}
+}
+
+func TestDebug_BadTarget(t *testing.T) {
+	ui := new(cli.MockUi)
+	c := &DebugCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+	}
+
+	if code := c.Run([]string{"-targets", "host,logs"}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), `Unknown target "logs"`) {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+}
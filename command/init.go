@@ -11,7 +11,7 @@ import (
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/helper/pgpkeys"
 	"github.com/hashicorp/vault/meta"
-	"github.com/hashicorp/vault/physical/consul"
+	"github.com/hashicorp/vault/serviceregistration/consul"
 	"github.com/posener/complete"
 )
 
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/meta"
+)
+
+// MonitorCommand is a Command that streams the logs of a Vault server.
+type MonitorCommand struct {
+	meta.Meta
+
+	// ShutdownCh stops the stream when closed
+	ShutdownCh chan struct{}
+}
+
+func (c *MonitorCommand) Run(args []string) int {
+	var logLevel, logFormat string
+	flags := c.Meta.FlagSet("monitor", meta.FlagSetDefault)
+	flags.StringVar(&logLevel, "log-level", "info", "")
+	flags.StringVar(&logFormat, "log-format", "standard", "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\nmonitor expects no arguments"))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing client: %s", err))
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lines, err := client.Sys().Monitor(ctx, logLevel, logFormat)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error starting the log stream: %s", err))
+		return 2
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// The server went away or ended the stream
+				c.Ui.Error("Log stream ended")
+				return 2
+			}
+			c.Ui.Output(line)
+		case <-c.ShutdownCh:
+			return 0
+		}
+	}
+}
+
+func (c *MonitorCommand) Synopsis() string {
+	return "Stream the logs of a Vault server"
+}
+
+func (c *MonitorCommand) Help() string {
+	helpText := `
+Usage: vault monitor [options]
+
+  Streams the logs of the Vault server the client is connected to until
+  interrupted. The logs are streamed at the requested level whatever the
+  level the server logs at, without changing what the server itself writes
+  out. Lines are dropped rather than slowing down the server if the client
+  cannot keep up.
+
+  This requires a token with sudo privileges on sys/monitor. Standby nodes
+  redirect to the active node, so the logs of a standby can only be streamed
+  when its address is not behind a load balancer.
+
+General Options:
+` + meta.GeneralOptionsUsage() + `
+Monitor Options:
+
+  -log-level=<level>      The least severe level of the streamed logs: one of
+                          "trace", "debug", "info", "notice", "warn" or "err".
+                          Defaults to "info".
+
+  -log-format=<format>    The format of the streamed logs, either "standard"
+                          or "json". Defaults to "standard".
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+	log "github.com/mgutz/logxi/v1"
+	"github.com/mitchellh/cli"
+)
+
+func TestMonitor(t *testing.T) {
+	logger := logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo)
+	core, _, token := vault.TestCoreUnsealedWithLogger(t, logger)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := cli.NewMockUi()
+	shutdownCh := make(chan struct{})
+	c := &MonitorCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+		ShutdownCh: shutdownCh,
+	}
+
+	args := []string{
+		"-address", addr,
+		"-log-level", "debug",
+	}
+	codeCh := make(chan int)
+	go func() {
+		codeCh <- c.Run(args)
+	}()
+
+	// Log until the stream has started and the line shows up
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(ui.OutputWriter.String(), "[DEBUG] core: for the monitor"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("missing log line: %s\n\n%s", ui.OutputWriter.String(), ui.ErrorWriter.String())
+		}
+		logger.Debug("core: for the monitor")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(shutdownCh)
+	if code := <-codeCh; code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+}
+
+func TestMonitor_BadLevel(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealedWithLogger(t, logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo))
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := cli.NewMockUi()
+	c := &MonitorCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+
+	args := []string{
+		"-address", addr,
+		"-log-level", "verbose",
+	}
+	if code := c.Run(args); code != 2 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+}
@@ -0,0 +1,526 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// migrationCheckpointPath is where the progress of a migration is stored
+	// in the destination, so that an interrupted migration can be resumed.
+	migrationCheckpointPath = "core/migration"
+
+	// migrationLockPath is the HA lock held by the active Vault node.
+	migrationLockPath = "core/lock"
+
+	// migrationBatchSize is the number of entries copied between two
+	// checkpoints.
+	migrationBatchSize = 1000
+
+	// migrationLockTimeout is how long to wait for the HA lock of the
+	// source once it was found to be free.
+	migrationLockTimeout = 10 * time.Second
+)
+
+// errMigrationLockLost is returned when the HA lock of the source is lost
+// during a migration, which may mean that a Vault node became active.
+var errMigrationLockLost = errors.New("lost the HA lock of the source storage; a Vault node may have become active, so the migration was stopped")
+
+// OperatorMigrateCommand is a Command that copies the data of Vault from one
+// storage backend to another while Vault is offline.
+type OperatorMigrateCommand struct {
+	meta.Meta
+
+	PhysicalBackends map[string]physical.Factory
+
+	logger log.Logger
+}
+
+// migratorConfig is the configuration of a migration.
+type migratorConfig struct {
+	StorageSource      *server.Storage
+	StorageDestination *server.Storage
+}
+
+// migrationCheckpoint records the last key copied by a migration.
+type migrationCheckpoint struct {
+	LastKey   string    `json:"last_key"`
+	StartTime time.Time `json:"start_time"`
+}
+
+func (c *OperatorMigrateCommand) Run(args []string) int {
+	var configPath string
+	var parallel int
+	flags := c.Meta.FlagSet("operator migrate", meta.FlagSetNone)
+	flags.StringVar(&configPath, "config", "", "")
+	flags.IntVar(&parallel, "parallel", 10, "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if configPath == "" {
+		flags.Usage()
+		c.Ui.Error("\noperator migrate requires a -config file")
+		return 1
+	}
+	if parallel < 1 {
+		c.Ui.Error(fmt.Sprintf("-parallel must be at least 1, got %d", parallel))
+		return 1
+	}
+
+	if c.logger == nil {
+		c.logger = logformat.NewVaultLogger(log.LevelInfo)
+	}
+
+	config, err := loadMigratorConfig(configPath)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading configuration: %s", err))
+		return 1
+	}
+
+	source, err := c.newBackend(config.StorageSource)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing source storage: %s", err))
+		return 1
+	}
+	destination, err := c.newBackend(config.StorageDestination)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing destination storage: %s", err))
+		return 1
+	}
+
+	if err := checkMigrationLock(destination); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error checking destination storage: %s", err))
+		return 1
+	}
+	leaderLostCh, unlock, err := acquireMigrationLock(source)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error checking source storage: %s", err))
+		return 1
+	}
+	defer unlock()
+
+	ctx, lockLost, cancel := migrationContext(leaderLostCh)
+	defer cancel()
+
+	count, err := c.migrate(ctx, source, destination, parallel)
+	if lockLost() {
+		err = errMigrationLockLost
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error migrating storage: %s", err))
+		return 2
+	}
+
+	c.Ui.Output(fmt.Sprintf(
+		"Success! Migrated %d entries from %s storage to %s storage.",
+		count, config.StorageSource.Type, config.StorageDestination.Type))
+	return 0
+}
+
+func (c *OperatorMigrateCommand) newBackend(storage *server.Storage) (physical.Backend, error) {
+	factory, ok := c.PhysicalBackends[storage.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage type %s", storage.Type)
+	}
+	return factory(storage.Config, c.logger)
+}
+
+// migrate copies all entries of the source to the destination, resuming from
+// the checkpoint left by an interrupted migration, and verifies that both
+// hold the same number of entries. It returns the number of entries copied.
+func (c *OperatorMigrateCommand) migrate(ctx context.Context, source, destination physical.Backend, parallel int) (int, error) {
+	checkpoint, err := readMigrationCheckpoint(ctx, destination)
+	if err != nil {
+		return 0, err
+	}
+	if checkpoint == nil {
+		keys, err := physical.ListPage(ctx, destination, "", "", 1)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list destination storage: %v", err)
+		}
+		if len(keys) > 0 {
+			return 0, fmt.Errorf("destination storage is not empty")
+		}
+		checkpoint = &migrationCheckpoint{
+			StartTime: time.Now().UTC(),
+		}
+		if err := writeMigrationCheckpoint(ctx, destination, checkpoint); err != nil {
+			return 0, err
+		}
+	} else {
+		c.logger.Info("migration: resuming interrupted migration", "last_key", checkpoint.LastKey, "start_time", checkpoint.StartTime)
+	}
+
+	var copied int
+	batch := make([]string, 0, migrationBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := copyMigrationEntries(ctx, source, destination, batch, parallel); err != nil {
+			return err
+		}
+		copied += len(batch)
+		checkpoint.LastKey = batch[len(batch)-1]
+		if err := writeMigrationCheckpoint(ctx, destination, checkpoint); err != nil {
+			return err
+		}
+		c.logger.Info("migration: copied entries", "count", copied, "last_key", checkpoint.LastKey)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = walkMigrationKeys(ctx, source, "", checkpoint.LastKey, func(key string) error {
+		batch = append(batch, key)
+		if len(batch) < migrationBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return copied, err
+	}
+
+	sourceCount, err := countMigrationKeys(ctx, source)
+	if err != nil {
+		return copied, fmt.Errorf("failed to count source entries: %v", err)
+	}
+	destinationCount, err := countMigrationKeys(ctx, destination)
+	if err != nil {
+		return copied, fmt.Errorf("failed to count destination entries: %v", err)
+	}
+	if sourceCount != destinationCount {
+		return copied, fmt.Errorf("verification failed: source has %d entries, destination has %d", sourceCount, destinationCount)
+	}
+
+	// The migration is only complete if the source was not given up meanwhile
+	if err := ctx.Err(); err != nil {
+		return copied, err
+	}
+
+	if err := destination.Delete(ctx, migrationCheckpointPath); err != nil {
+		return copied, fmt.Errorf("failed to remove migration checkpoint: %v", err)
+	}
+	return copied, nil
+}
+
+// migrationSkippedKey returns whether the key belongs to the HA state of a
+// cluster or the migration itself, and is not copied.
+func migrationSkippedKey(key string) bool {
+	return key == migrationLockPath ||
+		key == migrationCheckpointPath ||
+		strings.HasPrefix(key, "core/leader/")
+}
+
+// walkMigrationKeys calls f with every key under the prefix in lexical
+// order, skipping the keys up to and including after. Keys are listed a
+// batch at a time so that large prefixes are not held in memory at once.
+func walkMigrationKeys(ctx context.Context, b physical.Backend, prefix, after string, f func(string) error) error {
+	// Start listing at the key or folder holding after
+	var start string
+	if strings.HasPrefix(after, prefix) {
+		start = after[len(prefix):]
+		if i := strings.Index(start, "/"); i != -1 {
+			start = start[:i]
+		}
+	}
+
+	for {
+		keys, err := physical.ListPage(ctx, b, prefix, start, migrationBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list %q: %v", prefix, err)
+		}
+
+		for _, key := range keys {
+			full := prefix + key
+			if strings.HasSuffix(key, "/") {
+				// Every key of a folder sorts before after unless after is in it
+				if full < after && !strings.HasPrefix(after, full) {
+					continue
+				}
+				if err := walkMigrationKeys(ctx, b, full, after, f); err != nil {
+					return err
+				}
+				continue
+			}
+			if full <= after || migrationSkippedKey(full) {
+				continue
+			}
+			if err := f(full); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < migrationBatchSize {
+			return nil
+		}
+		start = keys[len(keys)-1]
+	}
+}
+
+// countMigrationKeys returns the number of entries of the backend that are
+// copied by a migration.
+func countMigrationKeys(ctx context.Context, b physical.Backend) (int, error) {
+	var count int
+	err := walkMigrationKeys(ctx, b, "", "", func(string) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// copyMigrationEntries copies the given keys using parallel workers.
+func copyMigrationEntries(ctx context.Context, source, destination physical.Backend, keys []string, parallel int) error {
+	keyCh := make(chan string)
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyCh {
+				if ctx.Err() != nil {
+					continue
+				}
+				entry, err := source.Get(ctx, key)
+				if err == nil {
+					err = ctx.Err()
+				}
+				if err == nil && entry != nil {
+					err = destination.Put(ctx, entry)
+				}
+				if err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("failed to copy %q: %v", key, err)
+					}
+					errLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		keyCh <- key
+	}
+	close(keyCh)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+func readMigrationCheckpoint(ctx context.Context, b physical.Backend) (*migrationCheckpoint, error) {
+	entry, err := b.Get(ctx, migrationCheckpointPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration checkpoint: %v", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var checkpoint migrationCheckpoint
+	if err := json.Unmarshal(entry.Value, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode migration checkpoint: %v", err)
+	}
+	return &checkpoint, nil
+}
+
+func writeMigrationCheckpoint(ctx context.Context, b physical.Backend, checkpoint *migrationCheckpoint) error {
+	// Nothing is recorded once the migration is canceled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(ctx, &physical.Entry{Key: migrationCheckpointPath, Value: value}); err != nil {
+		return fmt.Errorf("failed to write migration checkpoint: %v", err)
+	}
+	return nil
+}
+
+// checkMigrationLock returns an error if a Vault node holds the HA lock of
+// the backend.
+func checkMigrationLock(b physical.Backend) error {
+	ha, ok := b.(physical.HABackend)
+	if !ok || !ha.HAEnabled() {
+		return nil
+	}
+
+	lock, err := ha.LockWith(migrationLockPath, "migration")
+	if err != nil {
+		return err
+	}
+	held, _, err := lock.Value()
+	if err != nil {
+		return fmt.Errorf("failed to check the HA lock: %v", err)
+	}
+	if held {
+		return fmt.Errorf("storage is in use by an active Vault node")
+	}
+	return nil
+}
+
+// acquireMigrationLock checks that no Vault node holds the HA lock of the
+// backend, and holds it for the duration of the migration so that no node
+// becomes active meanwhile. It returns a channel that is closed if the lock
+// is lost, which is nil for backends without HA, and a function that
+// releases the lock.
+func acquireMigrationLock(b physical.Backend) (<-chan struct{}, func(), error) {
+	if err := checkMigrationLock(b); err != nil {
+		return nil, nil, err
+	}
+
+	ha, ok := b.(physical.HABackend)
+	if !ok || !ha.HAEnabled() {
+		return nil, func() {}, nil
+	}
+
+	lock, err := ha.LockWith(migrationLockPath, "migration")
+	if err != nil {
+		return nil, nil, err
+	}
+	stopCh := make(chan struct{})
+	timer := time.AfterFunc(migrationLockTimeout, func() { close(stopCh) })
+	leaderLostCh, err := lock.Lock(stopCh)
+	timer.Stop()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to acquire the HA lock: %v", err)
+	}
+	if leaderLostCh == nil {
+		return nil, nil, fmt.Errorf("storage is in use by an active Vault node")
+	}
+	return leaderLostCh, func() { lock.Unlock() }, nil
+}
+
+// migrationContext returns the context of a migration, which is canceled if
+// the HA lock of the source is lost so that nothing more is written to the
+// destination, along with a function that returns whether that happened and
+// one that releases the context.
+func migrationContext(leaderLostCh <-chan struct{}) (context.Context, func() bool, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var lost int32
+	go func() {
+		select {
+		case <-leaderLostCh:
+			atomic.StoreInt32(&lost, 1)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() bool { return atomic.LoadInt32(&lost) == 1 }, cancel
+}
+
+// loadMigratorConfig loads the migration configuration from the given file.
+func loadMigratorConfig(path string) (*migratorConfig, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMigratorConfig(string(d))
+}
+
+func parseMigratorConfig(d string) (*migratorConfig, error) {
+	obj, err := hcl.Parse(d)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error parsing: file doesn't contain a root object")
+	}
+
+	valid := []string{
+		"storage_source",
+		"storage_destination",
+	}
+	if err := checkHCLKeys(list, valid); err != nil {
+		return nil, err
+	}
+
+	var result migratorConfig
+	for _, name := range valid {
+		o := list.Filter(name)
+		if len(o.Items) == 0 {
+			return nil, fmt.Errorf("missing %q block", name)
+		}
+		storage, err := server.ParseStorage(o, name)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %q: %s", name, err)
+		}
+		if name == "storage_source" {
+			result.StorageSource = storage
+		} else {
+			result.StorageDestination = storage
+		}
+	}
+
+	return &result, nil
+}
+
+func (c *OperatorMigrateCommand) Synopsis() string {
+	return "Migrate Vault data between storage backends"
+}
+
+func (c *OperatorMigrateCommand) Help() string {
+	helpText := `
+Usage: vault operator migrate [options]
+
+  Copies all data of Vault from one storage backend to another. The source
+  and destination are given in a configuration file as "storage_source" and
+  "storage_destination" blocks, which take the same settings as the "storage"
+  block of the server configuration:
+
+      storage_source "file" {
+        path = "/var/lib/vault"
+      }
+
+      storage_destination "consul" {
+        address = "127.0.0.1:8500"
+        path    = "vault/"
+      }
+
+  Vault must be offline during the migration: the command refuses to run
+  while a Vault node holds the HA lock of either backend, and holds the lock
+  of the source until it is done. The destination must be empty.
+
+  Progress is recorded in the destination, and an interrupted migration
+  resumes where it stopped when run again with the same configuration. The
+  number of entries in both backends is compared once all are copied.
+
+Operator Migrate Options:
+
+  -config=<path>          Path to the migration configuration file.
+
+  -parallel=10            Number of entries copied concurrently.
+`
+	return strings.TrimSpace(helpText)
+}
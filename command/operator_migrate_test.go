@@ -0,0 +1,291 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/physical/inmem"
+	"github.com/mitchellh/cli"
+
+	log "github.com/mgutz/logxi/v1"
+)
+
+// testMigrateCommand returns a migrate command whose "source" and
+// "destination" storage types are the given backends.
+func testMigrateCommand(t *testing.T, source, destination physical.Backend) (*cli.MockUi, *OperatorMigrateCommand, string) {
+	dir, err := ioutil.TempDir("", "vault-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "migrate.hcl")
+	config := `
+storage_source "source" {}
+storage_destination "destination" {}
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ui := new(cli.MockUi)
+	c := &OperatorMigrateCommand{
+		PhysicalBackends: map[string]physical.Factory{
+			"source": func(map[string]string, log.Logger) (physical.Backend, error) {
+				return source, nil
+			},
+			"destination": func(map[string]string, log.Logger) (physical.Backend, error) {
+				return destination, nil
+			},
+		},
+		logger: logformat.NewVaultLogger(log.LevelTrace),
+	}
+	c.Meta.Ui = ui
+	return ui, c, dir
+}
+
+func testMigrateBackend(t *testing.T) physical.Backend {
+	b, err := inmem.NewInmemHA(nil, logformat.NewVaultLogger(log.LevelTrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testMigratePut(t *testing.T, b physical.Backend, key, value string) {
+	if err := b.Put(context.Background(), &physical.Entry{Key: key, Value: []byte(value)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testMigrateGet(t *testing.T, b physical.Backend, key string) string {
+	entry, err := b.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		return ""
+	}
+	return string(entry.Value)
+}
+
+func testMigrateKeys() []string {
+	var keys []string
+	for i := 0; i < 2500; i++ {
+		keys = append(keys, fmt.Sprintf("logical/%d/key%04d", i%7, i))
+	}
+	return append(keys, "core/keyring", "core/mounts", "sys/token/id/foo")
+}
+
+func TestOperatorMigrate(t *testing.T) {
+	source := testMigrateBackend(t)
+	destination := testMigrateBackend(t)
+	keys := testMigrateKeys()
+	for _, key := range keys {
+		testMigratePut(t, source, key, key)
+	}
+	testMigratePut(t, source, "core/leader/1234", "foo")
+
+	ui, c, dir := testMigrateCommand(t, source, destination)
+	defer os.RemoveAll(dir)
+	args := []string{"-config", filepath.Join(dir, "migrate.hcl"), "-parallel", "4"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	for _, key := range keys {
+		if actual := testMigrateGet(t, destination, key); actual != key {
+			t.Fatalf("%s: expected %q, got %q", key, key, actual)
+		}
+	}
+	for _, key := range []string{"core/leader/1234", migrationCheckpointPath} {
+		if actual := testMigrateGet(t, destination, key); actual != "" {
+			t.Fatalf("%s: should not exist, got %q", key, actual)
+		}
+	}
+
+	// The destination is no longer empty
+	ui, c, dir = testMigrateCommand(t, source, destination)
+	defer os.RemoveAll(dir)
+	args = []string{"-config", filepath.Join(dir, "migrate.hcl")}
+	if code := c.Run(args); code == 0 {
+		t.Fatal("expected error migrating to a non-empty destination")
+	}
+}
+
+func TestOperatorMigrate_Resume(t *testing.T) {
+	source := testMigrateBackend(t)
+	destination := testMigrateBackend(t)
+	keys := testMigrateKeys()
+	for _, key := range keys {
+		testMigratePut(t, source, key, key)
+	}
+
+	// An interrupted migration copied everything up to logical/3/
+	for _, key := range keys {
+		if key < "logical/3/" {
+			testMigratePut(t, destination, key, "copied")
+		}
+	}
+	if err := writeMigrationCheckpoint(context.Background(), destination, &migrationCheckpoint{LastKey: "logical/2/key2497"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ui, c, dir := testMigrateCommand(t, source, destination)
+	defer os.RemoveAll(dir)
+	args := []string{"-config", filepath.Join(dir, "migrate.hcl")}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	for _, key := range keys {
+		expected := key
+		if key < "logical/3/" {
+			expected = "copied"
+		}
+		if actual := testMigrateGet(t, destination, key); actual != expected {
+			t.Fatalf("%s: expected %q, got %q", key, expected, actual)
+		}
+	}
+}
+
+func TestOperatorMigrate_Verify(t *testing.T) {
+	source := testMigrateBackend(t)
+	destination := testMigrateBackend(t)
+	testMigratePut(t, source, "core/mounts", "foo")
+
+	// Entries the source does not have fail the verification
+	testMigratePut(t, destination, "core/other", "foo")
+	if err := writeMigrationCheckpoint(context.Background(), destination, &migrationCheckpoint{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ui, c, dir := testMigrateCommand(t, source, destination)
+	defer os.RemoveAll(dir)
+	args := []string{"-config", filepath.Join(dir, "migrate.hcl")}
+	if code := c.Run(args); code == 0 {
+		t.Fatal("expected verification error")
+	}
+	if actual := testMigrateGet(t, destination, migrationCheckpointPath); actual == "" {
+		t.Fatalf("checkpoint should be kept: %s", ui.ErrorWriter.String())
+	}
+}
+
+func TestOperatorMigrate_Active(t *testing.T) {
+	source := testMigrateBackend(t)
+	destination := testMigrateBackend(t)
+	testMigratePut(t, source, "core/mounts", "foo")
+
+	lock, err := source.(physical.HABackend).LockWith(migrationLockPath, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ui, c, dir := testMigrateCommand(t, source, destination)
+	defer os.RemoveAll(dir)
+	args := []string{"-config", filepath.Join(dir, "migrate.hcl")}
+	if code := c.Run(args); code == 0 {
+		t.Fatal("expected error migrating from an active cluster")
+	}
+	if actual := testMigrateGet(t, destination, "core/mounts"); actual != "" {
+		t.Fatalf("should not be copied: %s", ui.OutputWriter.String())
+	}
+
+	lock.Unlock()
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+}
+
+func TestParseMigratorConfig(t *testing.T) {
+	config, err := parseMigratorConfig(`
+storage_source "file" {
+  path = "/var/lib/vault"
+}
+
+storage_destination "consul" {
+  address = "127.0.0.1:8500"
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StorageSource.Type != "file" || config.StorageSource.Config["path"] != "/var/lib/vault" {
+		t.Fatalf("bad: %#v", config.StorageSource)
+	}
+	if config.StorageDestination.Type != "consul" || config.StorageDestination.Config["address"] != "127.0.0.1:8500" {
+		t.Fatalf("bad: %#v", config.StorageDestination)
+	}
+
+	if _, err := parseMigratorConfig(`storage_source "file" {}`); err == nil {
+		t.Fatal("expected error for a missing destination")
+	}
+	if _, err := parseMigratorConfig(`
+storage_source "file" {}
+storage_destination "file" {}
+storage "file" {}
+`); err == nil {
+		t.Fatal("expected error for an unknown block")
+	}
+}
+
+// lockLosingBackend closes lostCh, as the HA lock would be on loss, when the
+// first entry is read
+type lockLosingBackend struct {
+	physical.Backend
+	once   sync.Once
+	lostCh chan struct{}
+}
+
+func (b *lockLosingBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
+	b.once.Do(func() {
+		close(b.lostCh)
+		<-ctx.Done()
+	})
+	return b.Backend.Get(ctx, key)
+}
+
+func TestOperatorMigrate_LockLost(t *testing.T) {
+	source := &lockLosingBackend{
+		Backend: testMigrateBackend(t),
+		lostCh:  make(chan struct{}),
+	}
+	destination := testMigrateBackend(t)
+	keys := testMigrateKeys()
+	for _, key := range keys {
+		testMigratePut(t, source, key, key)
+	}
+
+	ui, c, dir := testMigrateCommand(t, source, destination)
+	defer os.RemoveAll(dir)
+	ctx, lockLost, cancel := migrationContext(source.lostCh)
+	defer cancel()
+	if _, err := c.migrate(ctx, source, destination, 4); err == nil {
+		t.Fatalf("expected error once the lock is lost\n\n%s", ui.ErrorWriter.String())
+	}
+	if !lockLost() {
+		t.Fatal("expected the lock to be reported lost")
+	}
+
+	// Nothing was copied, and the checkpoint records no progress
+	checkpoint, err := readMigrationCheckpoint(context.Background(), destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint == nil || checkpoint.LastKey != "" {
+		t.Fatalf("bad: %#v", checkpoint)
+	}
+	for _, key := range keys {
+		if actual := testMigrateGet(t, destination, key); actual != "" {
+			t.Fatalf("%s: should not have been copied, got %q", key, actual)
+		}
+	}
+}
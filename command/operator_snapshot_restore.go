@@ -0,0 +1,89 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/meta"
+)
+
+// OperatorSnapshotRestoreCommand is a Command that restores a snapshot of
+// the storage of Vault.
+type OperatorSnapshotRestoreCommand struct {
+	meta.Meta
+}
+
+func (c *OperatorSnapshotRestoreCommand) Run(args []string) int {
+	var force bool
+	flags := c.Meta.FlagSet("operator snapshot restore", meta.FlagSetDefault)
+	flags.BoolVar(&force, "force", false, "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\noperator snapshot restore expects one argument: the snapshot file"))
+		return 1
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error opening snapshot file: %s", err))
+		return 1
+	}
+	defer f.Close()
+
+	client, err := c.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing client: %s", err))
+		return 2
+	}
+
+	if err := client.Sys().StorageSnapshotRestore(f, force); err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error restoring snapshot: %s", err))
+		return 2
+	}
+
+	if force {
+		c.Ui.Output("Restored snapshot; if it was taken on another cluster, Vault is now sealed")
+	} else {
+		c.Ui.Output("Restored snapshot")
+	}
+	return 0
+}
+
+func (c *OperatorSnapshotRestoreCommand) Synopsis() string {
+	return "Restore a snapshot of the storage of Vault"
+}
+
+func (c *OperatorSnapshotRestoreCommand) Help() string {
+	helpText := `
+Usage: vault operator snapshot restore [options] FILE
+
+  Replaces all data in the storage backend of Vault with the given snapshot,
+  taken with "vault operator snapshot save". Vault reloads its state from the
+  restored data once done.
+
+  Snapshots taken with a different keyring, for instance on another cluster
+  or before a rekey, are rejected unless -force is given. Vault is then
+  sealed, and has to be unsealed with the keys the snapshot was taken with.
+
+  This requires a token with sudo privileges on sys/storage/snapshot.
+
+General Options:
+` + meta.GeneralOptionsUsage() + `
+Operator Snapshot Restore Options:
+
+  -force                  Restore the snapshot even if it was taken with a
+                          different keyring.
+`
+	return strings.TrimSpace(helpText)
+}
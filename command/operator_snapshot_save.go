@@ -0,0 +1,80 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/meta"
+)
+
+// OperatorSnapshotSaveCommand is a Command that saves a snapshot of the
+// storage of Vault.
+type OperatorSnapshotSaveCommand struct {
+	meta.Meta
+}
+
+func (c *OperatorSnapshotSaveCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("operator snapshot save", meta.FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\noperator snapshot save expects one argument: the file to write"))
+		return 1
+	}
+	path := args[0]
+
+	client, err := c.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing client: %s", err))
+		return 2
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error creating snapshot file: %s", err))
+		return 1
+	}
+
+	err = client.Sys().StorageSnapshot(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		c.Ui.Error(fmt.Sprintf(
+			"Error saving snapshot: %s", err))
+		return 2
+	}
+
+	c.Ui.Output(fmt.Sprintf("Saved snapshot to %s", path))
+	return 0
+}
+
+func (c *OperatorSnapshotSaveCommand) Synopsis() string {
+	return "Save a snapshot of the storage of Vault"
+}
+
+func (c *OperatorSnapshotSaveCommand) Help() string {
+	helpText := `
+Usage: vault operator snapshot save [options] FILE
+
+  Saves a snapshot of all data in the storage backend of Vault to the given
+  file, which must not exist yet. The snapshot is consistent and its entries
+  are still encrypted by the barrier, so it can only be used together with
+  the unseal keys of this cluster.
+
+  This requires a token with sudo privileges on sys/storage/snapshot.
+
+General Options:
+` + meta.GeneralOptionsUsage()
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+	"github.com/mitchellh/cli"
+)
+
+func TestOperatorSnapshot(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	dir, err := ioutil.TempDir("", "vault-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.snap")
+
+	ui := new(cli.MockUi)
+	save := &OperatorSnapshotSaveCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+	args := []string{
+		"-address", addr,
+		path,
+	}
+	if code := save.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	// Existing files are not overwritten
+	ui = new(cli.MockUi)
+	save.Meta.Ui = ui
+	if code := save.Run(args); code == 0 {
+		t.Fatal("expected error saving over an existing file")
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = token
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	ui = new(cli.MockUi)
+	restore := &OperatorSnapshotRestoreCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+	if code := restore.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = token
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil {
+		t.Fatalf("secret written after the snapshot was restored: %#v", resp)
+	}
+}
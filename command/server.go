@@ -37,6 +37,7 @@ import (
 	"github.com/hashicorp/vault/helper/flag-slice"
 	"github.com/hashicorp/vault/helper/gated-writer"
 	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/reload"
@@ -44,6 +45,7 @@ import (
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/meta"
 	"github.com/hashicorp/vault/physical"
+	sr "github.com/hashicorp/vault/serviceregistration"
 	"github.com/hashicorp/vault/vault"
 	"github.com/hashicorp/vault/version"
 )
@@ -55,6 +57,8 @@ type ServerCommand struct {
 	LogicalBackends    map[string]logical.Factory
 	PhysicalBackends   map[string]physical.Factory
 
+	ServiceRegistrations map[string]sr.Factory
+
 	ShutdownCh chan struct{}
 	SighupCh   chan struct{}
 
@@ -99,22 +103,9 @@ func (c *ServerCommand) Run(args []string) int {
 	// Create a logger. We wrap it in a gated writer so that it doesn't
 	// start logging too early.
 	c.logGate = &gatedwriter.Writer{Writer: colorable.NewColorable(os.Stderr)}
-	var level int
 	logLevel = strings.ToLower(strings.TrimSpace(logLevel))
-	switch logLevel {
-	case "trace":
-		level = log.LevelTrace
-	case "debug":
-		level = log.LevelDebug
-	case "info":
-		level = log.LevelInfo
-	case "notice":
-		level = log.LevelNotice
-	case "warn":
-		level = log.LevelWarn
-	case "err":
-		level = log.LevelError
-	default:
+	level, err := logformat.ParseLevel(logLevel)
+	if err != nil {
 		c.Ui.Output(fmt.Sprintf("Unknown log level %s", logLevel))
 		return 1
 	}
@@ -125,7 +116,9 @@ func (c *ServerCommand) Run(args []string) int {
 	}
 	switch strings.ToLower(logFormat) {
 	case "vault", "vault_json", "vault-json", "vaultjson", "json", "":
-		c.logger = logformat.NewVaultLoggerWithWriter(c.logGate, level)
+		// The level of this logger can be changed at runtime with
+		// sys/loggers and its output streamed with sys/monitor
+		c.logger = logformat.NewControlledVaultLogger(c.logGate, level)
 	default:
 		c.logger = log.NewLogger(c.logGate, "vault")
 		c.logger.SetLevel(level)
@@ -205,7 +198,8 @@ func (c *ServerCommand) Run(args []string) int {
 		c.Ui.Output("  Vault on an mlockall(2) enabled system is much more secure.\n")
 	}
 
-	if err := c.setupTelemetry(config); err != nil {
+	metricsHelper, err := c.setupTelemetry(config)
+	if err != nil {
 		c.Ui.Output(fmt.Sprintf("Error initializing telemetry: %s", err))
 		return 1
 	}
@@ -263,6 +257,10 @@ func (c *ServerCommand) Run(args []string) int {
 		CacheSize:          config.CacheSize,
 		PluginDirectory:    config.PluginDirectory,
 		EnableRaw:          config.EnableRawEndpoint,
+		PerformanceStandby: config.PerformanceStandby,
+		MetricsHelper:      metricsHelper,
+		SanitizedConfig:    config.Sanitized(),
+		DrainTimeout:       config.DrainTimeout,
 	}
 	if dev {
 		coreConfig.DevToken = devRootTokenID
@@ -414,6 +412,30 @@ CLUSTER_SYNTHESIS_COMPLETE:
 		coreConfig.ClusterAddr = u.String()
 	}
 
+	// Initialize the service registration, if any
+	srConfig := config.ServiceRegistration
+	if srConfig == nil {
+		srConfig = implicitServiceRegistration(config)
+	}
+	if srConfig != nil {
+		factory, exists := c.ServiceRegistrations[srConfig.Type]
+		if !exists {
+			c.Ui.Output(fmt.Sprintf(
+				"Unknown service_registration type %s",
+				srConfig.Type))
+			return 1
+		}
+		coreConfig.ServiceRegistration, err = factory(srConfig.Config, c.logger)
+		if err != nil {
+			c.Ui.Output(fmt.Sprintf(
+				"Error initializing service_registration of type %s: %s",
+				srConfig.Type, err))
+			return 1
+		}
+		info["service registration"] = srConfig.Type
+		infoKeys = append(infoKeys, "service registration")
+	}
+
 	// Initialize the core
 	core, newCoreError := vault.NewCore(coreConfig)
 	if newCoreError != nil {
@@ -463,6 +485,7 @@ CLUSTER_SYNTHESIS_COMPLETE:
 	// Initialize the listeners
 	c.reloadFuncsLock.Lock()
 	lns := make([]net.Listener, 0, len(config.Listeners))
+	lnHandlerProps := make([]*vaulthttp.HandlerProperties, 0, len(config.Listeners))
 	for i, lnConfig := range config.Listeners {
 		ln, props, reloadFunc, err := server.NewListener(lnConfig.Type, lnConfig.Config, c.logGate)
 		if err != nil {
@@ -472,7 +495,20 @@ CLUSTER_SYNTHESIS_COMPLETE:
 			return 1
 		}
 
+		var unauthenticatedMetricsAccess bool
+		if raw, ok := lnConfig.Config["unauthenticated_metrics_access"]; ok {
+			if unauthenticatedMetricsAccess, err = parseutil.ParseBool(raw); err != nil {
+				c.Ui.Output(fmt.Sprintf(
+					"Error parsing unauthenticated_metrics_access of listener of type %s: %s",
+					lnConfig.Type, err))
+				return 1
+			}
+		}
+
 		lns = append(lns, ln)
+		lnHandlerProps = append(lnHandlerProps, &vaulthttp.HandlerProperties{
+			UnauthenticatedMetricsAccess: unauthenticatedMetricsAccess,
+		})
 
 		if reloadFunc != nil {
 			relSlice := (*c.reloadFuncs)["listener|"+lnConfig.Type]
@@ -582,28 +618,31 @@ CLUSTER_SYNTHESIS_COMPLETE:
 	// Instantiate the wait group
 	c.WaitGroup = &sync.WaitGroup{}
 
-	// If the backend supports service discovery, run service discovery
-	if coreConfig.HAPhysical != nil && coreConfig.HAPhysical.HAEnabled() {
-		sd, ok := coreConfig.HAPhysical.(physical.ServiceDiscovery)
-		if ok {
-			activeFunc := func() bool {
-				if isLeader, _, _, err := core.Leader(); err == nil {
-					return isLeader
-				}
-				return false
+	// Advertise the state of the server, if configured
+	if coreConfig.ServiceRegistration != nil {
+		activeFunc := func() bool {
+			isLeader, _, _, err := core.Leader()
+			switch err {
+			case nil:
+				return isLeader
+			case vault.ErrHANotEnabled:
+				// Without HA, every unsealed server is active
+				sealed, err := core.Sealed()
+				return err == nil && !sealed
 			}
+			return false
+		}
 
-			sealedFunc := func() bool {
-				if sealed, err := core.Sealed(); err == nil {
-					return sealed
-				}
-				return true
+		sealedFunc := func() bool {
+			if sealed, err := core.Sealed(); err == nil {
+				return sealed
 			}
+			return true
+		}
 
-			if err := sd.RunServiceDiscovery(c.WaitGroup, c.ShutdownCh, coreConfig.RedirectAddr, activeFunc, sealedFunc); err != nil {
-				c.Ui.Output(fmt.Sprintf("Error initializing service discovery: %v", err))
-				return 1
-			}
+		if err := coreConfig.ServiceRegistration.Run(c.WaitGroup, c.ShutdownCh, coreConfig.RedirectAddr, activeFunc, sealedFunc); err != nil {
+			c.Ui.Output(fmt.Sprintf("Error initializing service registration: %v", err))
+			return 1
 		}
 	}
 
@@ -657,14 +696,21 @@ CLUSTER_SYNTHESIS_COMPLETE:
 		))
 	}
 
-	// Initialize the HTTP server
-	server := &http.Server{}
-	if err := http2.ConfigureServer(server, nil); err != nil {
-		c.Ui.Output(fmt.Sprintf("Error configuring server for HTTP/2: %s", err))
-		return 1
-	}
-	server.Handler = handler
-	for _, ln := range lns {
+	// Initialize the HTTP servers; each listener has its own handler as
+	// they may be configured differently
+	servers := make([]*http.Server, 0, len(lns))
+	for i, ln := range lns {
+		props := lnHandlerProps[i]
+		props.Core = core
+
+		server := &http.Server{
+			Handler: vaulthttp.HandlerWithProperties(props),
+		}
+		if err := http2.ConfigureServer(server, nil); err != nil {
+			c.Ui.Output(fmt.Sprintf("Error configuring server for HTTP/2: %s", err))
+			return 1
+		}
+		servers = append(servers, server)
 		go server.Serve(ln)
 	}
 
@@ -699,8 +745,22 @@ CLUSTER_SYNTHESIS_COMPLETE:
 		case <-c.ShutdownCh:
 			c.Ui.Output("==> Vault shutdown triggered")
 
-			// Stop the listners so that we don't process further client requests.
+			// Stop the listners so that we don't process further client
+			// requests, and close the connections kept alive once their
+			// current request is served.
 			c.cleanupGuard.Do(listenerCloseFunc)
+			for _, server := range servers {
+				server.SetKeepAlivesEnabled(false)
+			}
+
+			// Let the requests being served complete before sealing
+			drainTimeout := config.DrainTimeout
+			if drainTimeout == 0 {
+				drainTimeout = vault.DefaultDrainTimeout
+			}
+			if remaining := core.DrainRequests(drainTimeout); remaining > 0 {
+				c.Ui.Output(fmt.Sprintf("==> Sealing with %d requests still in flight", remaining))
+			}
 
 			// Shutdown will wait until after Vault is sealed, which means the
 			// request forwarding listeners will also be closed (and also
@@ -1013,6 +1073,24 @@ func (c *ServerCommand) enableThreeNodeDevCluster(base *vault.CoreConfig, info m
 	return 0
 }
 
+// implicitServiceRegistration returns the service registration used when
+// none is configured. Consul used for HA registers the server with the
+// settings of its storage block, as it did before service registration was
+// configured separately.
+func implicitServiceRegistration(config *server.Config) *server.ServiceRegistration {
+	storage := config.HAStorage
+	if storage == nil {
+		storage = config.Storage
+	}
+	if storage == nil || storage.Type != "consul" {
+		return nil
+	}
+	return &server.ServiceRegistration{
+		Type:   "consul",
+		Config: storage.Config,
+	}
+}
+
 // detectRedirect is used to attempt redirect address detection
 func (c *ServerCommand) detectRedirect(detect physical.RedirectDetect,
 	config *server.Config) (string, error) {
@@ -1086,8 +1164,9 @@ func (c *ServerCommand) detectRedirect(detect physical.RedirectDetect,
 	return url.String(), nil
 }
 
-// setupTelemetry is used to setup the telemetry sub-systems
-func (c *ServerCommand) setupTelemetry(config *server.Config) error {
+// setupTelemetry is used to setup the telemetry sub-systems and returns the
+// helper giving access to the in-memory metrics
+func (c *ServerCommand) setupTelemetry(config *server.Config) (*metricsutil.MetricsHelper, error) {
 	/* Setup telemetry
 	Aggregate on 10 second intervals for 1 minute. Expose the
 	metrics over stderr when there is a SIGUSR1 received.
@@ -1110,7 +1189,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsiteAddr != "" {
 		sink, err := metrics.NewStatsiteSink(telConfig.StatsiteAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -1119,7 +1198,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsdAddr != "" {
 		sink, err := metrics.NewStatsdSink(telConfig.StatsdAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -1155,7 +1234,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 
 		sink, err := circonus.NewCirconusSink(cfg)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		sink.Start()
 		fanout = append(fanout, sink)
@@ -1170,12 +1249,26 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 
 		sink, err := datadog.NewDogStatsdSink(telConfig.DogStatsDAddr, metricsConf.HostName)
 		if err != nil {
-			return fmt.Errorf("failed to start DogStatsD sink. Got: %s", err)
+			return nil, fmt.Errorf("failed to start DogStatsD sink. Got: %s", err)
 		}
 		sink.SetTags(tags)
 		fanout = append(fanout, sink)
 	}
 
+	// Configure the Prometheus sink
+	var prometheusSink *metricsutil.PrometheusSink
+	if telConfig.PrometheusRetentionTime > 0 {
+		prometheusSink = metricsutil.NewPrometheusSink(telConfig.PrometheusRetentionTime)
+		fanout = append(fanout, prometheusSink)
+
+		// Prometheus metric names must not vary between hosts, so the
+		// hostname is given as a label instead
+		if metricsConf.EnableHostname {
+			metricsConf.EnableHostname = false
+			metricsConf.EnableHostnameLabel = true
+		}
+	}
+
 	// Initialize the global sink
 	if len(fanout) > 0 {
 		fanout = append(fanout, inm)
@@ -1184,7 +1277,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 		metricsConf.EnableHostname = false
 		metrics.NewGlobal(metricsConf, inm)
 	}
-	return nil
+	return metricsutil.NewMetricsHelper(inm, prometheusSink), nil
 }
 
 func (c *ServerCommand) Reload(lock *sync.RWMutex, reloadFuncs *map[string][]reload.ReloadFunc, configPath []string) error {
@@ -24,6 +24,8 @@ type Config struct {
 	Storage   *Storage    `hcl:"-"`
 	HAStorage *Storage    `hcl:"-"`
 
+	ServiceRegistration *ServiceRegistration `hcl:"-"`
+
 	HSM *HSM `hcl:"-"`
 
 	CacheSize       int         `hcl:"cache_size"`
@@ -50,6 +52,12 @@ type Config struct {
 	PidFile              string      `hcl:"pid_file"`
 	EnableRawEndpoint    bool        `hcl:"-"`
 	EnableRawEndpointRaw interface{} `hcl:"raw_storage_endpoint"`
+
+	PerformanceStandby    bool        `hcl:"-"`
+	PerformanceStandbyRaw interface{} `hcl:"performance_standby"`
+
+	DrainTimeout    time.Duration `hcl:"-"`
+	DrainTimeoutRaw interface{}   `hcl:"drain_timeout"`
 }
 
 // DevConfig is a Config that is used for dev mode of Vault.
@@ -115,6 +123,17 @@ func (b *Storage) GoString() string {
 	return fmt.Sprintf("*%#v", *b)
 }
 
+// ServiceRegistration is the configuration for advertising the state of the
+// server to a service discovery system.
+type ServiceRegistration struct {
+	Type   string
+	Config map[string]string
+}
+
+func (s *ServiceRegistration) GoString() string {
+	return fmt.Sprintf("*%#v", *s)
+}
+
 // HSM contains HSM configuration for the server
 type HSM struct {
 	Type   string
@@ -211,6 +230,12 @@ type Telemetry struct {
 	// DogStatsdTags are the global tags that should be sent with each packet to dogstatsd
 	// It is a list of strings, where each string looks like "my_tag_name:my_tag_value"
 	DogStatsDTags []string `hcl:"dogstatsd_tags"`
+
+	// Prometheus:
+	// PrometheusRetentionTime is the retention time for prometheus metrics if greater than 0.
+	// Default: 0s (disabled)
+	PrometheusRetentionTime    time.Duration `hcl:"-"`
+	PrometheusRetentionTimeRaw interface{}   `hcl:"prometheus_retention_time"`
 }
 
 func (s *Telemetry) GoString() string {
@@ -241,6 +266,11 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.HAStorage = c2.HAStorage
 	}
 
+	result.ServiceRegistration = c.ServiceRegistration
+	if c2.ServiceRegistration != nil {
+		result.ServiceRegistration = c2.ServiceRegistration
+	}
+
 	result.HSM = c.HSM
 	if c2.HSM != nil {
 		result.HSM = c2.HSM
@@ -298,6 +328,11 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.EnableRawEndpoint = c2.EnableRawEndpoint
 	}
 
+	result.PerformanceStandby = c.PerformanceStandby
+	if c2.PerformanceStandby {
+		result.PerformanceStandby = c2.PerformanceStandby
+	}
+
 	result.PluginDirectory = c.PluginDirectory
 	if c2.PluginDirectory != "" {
 		result.PluginDirectory = c2.PluginDirectory
@@ -308,6 +343,86 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.PidFile = c2.PidFile
 	}
 
+	result.DrainTimeout = c.DrainTimeout
+	if c2.DrainTimeout != 0 {
+		result.DrainTimeout = c2.DrainTimeout
+	}
+
+	return result
+}
+
+// Sanitized returns a copy of the configuration that is safe to expose
+// through the API. The options of the storage, seal and service registration
+// stanzas are left out as they commonly hold credentials, and so are the
+// credentials of the telemetry providers.
+func (c *Config) Sanitized() map[string]interface{} {
+	result := map[string]interface{}{
+		"cache_size":            c.CacheSize,
+		"disable_cache":         c.DisableCache,
+		"disable_mlock":         c.DisableMlock,
+		"ui":                    c.EnableUI,
+		"max_lease_ttl":         int64(c.MaxLeaseTTL.Seconds()),
+		"default_lease_ttl":     int64(c.DefaultLeaseTTL.Seconds()),
+		"cluster_name":          c.ClusterName,
+		"cluster_cipher_suites": c.ClusterCipherSuites,
+		"plugin_directory":      c.PluginDirectory,
+		"pid_file":              c.PidFile,
+		"raw_storage_endpoint":  c.EnableRawEndpoint,
+		"performance_standby":   c.PerformanceStandby,
+		"drain_timeout":         int64(c.DrainTimeout.Seconds()),
+	}
+
+	var listeners []interface{}
+	for _, l := range c.Listeners {
+		listeners = append(listeners, map[string]interface{}{
+			"type":   l.Type,
+			"config": l.Config,
+		})
+	}
+	result["listeners"] = listeners
+
+	sanitizeStorage := func(s *Storage) map[string]interface{} {
+		return map[string]interface{}{
+			"type":               s.Type,
+			"redirect_addr":      s.RedirectAddr,
+			"cluster_addr":       s.ClusterAddr,
+			"disable_clustering": s.DisableClustering,
+		}
+	}
+	if c.Storage != nil {
+		result["storage"] = sanitizeStorage(c.Storage)
+	}
+	if c.HAStorage != nil {
+		result["ha_storage"] = sanitizeStorage(c.HAStorage)
+	}
+
+	if c.HSM != nil {
+		result["seal"] = map[string]interface{}{
+			"type": c.HSM.Type,
+		}
+	}
+
+	if c.ServiceRegistration != nil {
+		result["service_registration"] = map[string]interface{}{
+			"type": c.ServiceRegistration.Type,
+		}
+	}
+
+	if c.Telemetry != nil {
+		result["telemetry"] = map[string]interface{}{
+			"statsite_address":          c.Telemetry.StatsiteAddr,
+			"statsd_address":            c.Telemetry.StatsdAddr,
+			"disable_hostname":          c.Telemetry.DisableHostname,
+			"circonus_api_app":          c.Telemetry.CirconusAPIApp,
+			"circonus_api_url":          c.Telemetry.CirconusAPIURL,
+			"circonus_submission_url":   c.Telemetry.CirconusCheckSubmissionURL,
+			"circonus_check_id":         c.Telemetry.CirconusCheckID,
+			"dogstatsd_addr":            c.Telemetry.DogStatsDAddr,
+			"dogstatsd_tags":            c.Telemetry.DogStatsDTags,
+			"prometheus_retention_time": int64(c.Telemetry.PrometheusRetentionTime.Seconds()),
+		}
+	}
+
 	return result
 }
 
@@ -358,6 +473,14 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 			return nil, err
 		}
 	}
+	if result.DrainTimeoutRaw != nil {
+		if result.DrainTimeout, err = parseutil.ParseDurationSecond(result.DrainTimeoutRaw); err != nil {
+			return nil, err
+		}
+		if result.DrainTimeout <= 0 {
+			return nil, fmt.Errorf("drain_timeout must be positive")
+		}
+	}
 
 	if result.EnableUIRaw != nil {
 		if result.EnableUI, err = parseutil.ParseBool(result.EnableUIRaw); err != nil {
@@ -383,6 +506,12 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		}
 	}
 
+	if result.PerformanceStandbyRaw != nil {
+		if result.PerformanceStandby, err = parseutil.ParseBool(result.PerformanceStandbyRaw); err != nil {
+			return nil, err
+		}
+	}
+
 	list, ok := obj.Node.(*ast.ObjectList)
 	if !ok {
 		return nil, fmt.Errorf("error parsing: file doesn't contain a root object")
@@ -393,6 +522,7 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		"ha_storage",
 		"backend",
 		"ha_backend",
+		"service_registration",
 		"hsm",
 		"listener",
 		"cache_size",
@@ -407,6 +537,8 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		"plugin_directory",
 		"pid_file",
 		"raw_storage_endpoint",
+		"performance_standby",
+		"drain_timeout",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return nil, err
@@ -437,6 +569,12 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		}
 	}
 
+	if o := list.Filter("service_registration"); len(o.Items) > 0 {
+		if err := parseServiceRegistration(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'service_registration': %s", err)
+		}
+	}
+
 	if o := list.Filter("hsm"); len(o.Items) > 0 {
 		if err := parseHSMs(&result, o); err != nil {
 			return nil, fmt.Errorf("error parsing 'hsm': %s", err)
@@ -536,8 +674,19 @@ func isTemporaryFile(name string) bool {
 }
 
 func parseStorage(result *Config, list *ast.ObjectList, name string) error {
+	storage, err := ParseStorage(list, name)
+	if err != nil {
+		return err
+	}
+	result.Storage = storage
+	return nil
+}
+
+// ParseStorage parses a single storage block with the given name, such as
+// the "storage" block of the server configuration.
+func ParseStorage(list *ast.ObjectList, name string) (*Storage, error) {
 	if len(list.Items) > 1 {
-		return fmt.Errorf("only one %q block is permitted", name)
+		return nil, fmt.Errorf("only one %q block is permitted", name)
 	}
 
 	// Get our item
@@ -550,7 +699,7 @@ func parseStorage(result *Config, list *ast.ObjectList, name string) error {
 
 	var m map[string]string
 	if err := hcl.DecodeObject(&m, item.Val); err != nil {
-		return multierror.Prefix(err, fmt.Sprintf("%s.%s:", name, key))
+		return nil, multierror.Prefix(err, fmt.Sprintf("%s.%s:", name, key))
 	}
 
 	// Pull out the redirect address since it's common to all backends
@@ -575,19 +724,18 @@ func parseStorage(result *Config, list *ast.ObjectList, name string) error {
 	if v, ok := m["disable_clustering"]; ok {
 		disableClustering, err = strconv.ParseBool(v)
 		if err != nil {
-			return multierror.Prefix(err, fmt.Sprintf("%s.%s:", name, key))
+			return nil, multierror.Prefix(err, fmt.Sprintf("%s.%s:", name, key))
 		}
 		delete(m, "disable_clustering")
 	}
 
-	result.Storage = &Storage{
+	return &Storage{
 		RedirectAddr:      redirectAddr,
 		ClusterAddr:       clusterAddr,
 		DisableClustering: disableClustering,
 		Type:              strings.ToLower(key),
 		Config:            m,
-	}
-	return nil
+	}, nil
 }
 
 func parseHAStorage(result *Config, list *ast.ObjectList, name string) error {
@@ -645,6 +793,31 @@ func parseHAStorage(result *Config, list *ast.ObjectList, name string) error {
 	return nil
 }
 
+func parseServiceRegistration(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'service_registration' block is permitted")
+	}
+
+	// Get our item
+	item := list.Items[0]
+
+	if len(item.Keys) == 0 {
+		return fmt.Errorf("'service_registration' block must specify a type")
+	}
+	key := item.Keys[0].Token.Value().(string)
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return multierror.Prefix(err, fmt.Sprintf("service_registration.%s:", key))
+	}
+
+	result.ServiceRegistration = &ServiceRegistration{
+		Type:   strings.ToLower(key),
+		Config: m,
+	}
+	return nil
+}
+
 func parseHSMs(result *Config, list *ast.ObjectList) error {
 	if len(list.Items) > 1 {
 		return fmt.Errorf("only one 'hsm' block is permitted")
@@ -710,6 +883,7 @@ func parseListeners(result *Config, list *ast.ObjectList) error {
 			"tls_disable_client_certs",
 			"tls_client_ca_file",
 			"token",
+			"unauthenticated_metrics_access",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("listeners.%s:", key))
@@ -758,6 +932,7 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 		"disable_hostname",
 		"dogstatsd_addr",
 		"dogstatsd_tags",
+		"prometheus_retention_time",
 		"statsd_address",
 		"statsite_address",
 	}
@@ -777,6 +952,13 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 	if err := hcl.DecodeObject(&result.Telemetry, item.Val); err != nil {
 		return multierror.Prefix(err, "telemetry:")
 	}
+
+	if result.Telemetry.PrometheusRetentionTimeRaw != nil {
+		var err error
+		if result.Telemetry.PrometheusRetentionTime, err = parseutil.ParseDurationSecond(result.Telemetry.PrometheusRetentionTimeRaw); err != nil {
+			return multierror.Prefix(err, "telemetry:")
+		}
+	}
 	return nil
 }
 
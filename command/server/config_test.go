@@ -25,7 +25,8 @@ func TestLoadConfigFile(t *testing.T) {
 			&Listener{
 				Type: "tcp",
 				Config: map[string]interface{}{
-					"address": "127.0.0.1:443",
+					"address":                        "127.0.0.1:443",
+					"unauthenticated_metrics_access": true,
 				},
 			},
 		},
@@ -47,12 +48,22 @@ func TestLoadConfigFile(t *testing.T) {
 			DisableClustering: true,
 		},
 
+		ServiceRegistration: &ServiceRegistration{
+			Type: "consul",
+			Config: map[string]string{
+				"foo": "bar",
+			},
+		},
+
 		Telemetry: &Telemetry{
 			StatsdAddr:      "bar",
 			StatsiteAddr:    "foo",
 			DisableHostname: false,
 			DogStatsDAddr:   "127.0.0.1:7254",
 			DogStatsDTags:   []string{"tag_1:val_1", "tag_2:val_2"},
+
+			PrometheusRetentionTime:    30 * time.Second,
+			PrometheusRetentionTimeRaw: "30s",
 		},
 
 		DisableCache:    true,
@@ -72,12 +83,51 @@ func TestLoadConfigFile(t *testing.T) {
 		ClusterName:        "testcluster",
 
 		PidFile: "./pidfile",
+
+		DrainTimeout:    20 * time.Second,
+		DrainTimeoutRaw: "20s",
 	}
 	if !reflect.DeepEqual(config, expected) {
 		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config, expected)
 	}
 }
 
+func TestConfig_Sanitized(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	config, err := LoadConfigFile("./test-fixtures/config.hcl", logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sanitized := config.Sanitized()
+	expectedStorage := map[string]interface{}{
+		"type":               "consul",
+		"redirect_addr":      "foo",
+		"cluster_addr":       "",
+		"disable_clustering": false,
+	}
+	if !reflect.DeepEqual(sanitized["storage"], expectedStorage) {
+		t.Fatalf("bad: %#v", sanitized["storage"])
+	}
+	expectedServiceRegistration := map[string]interface{}{
+		"type": "consul",
+	}
+	if !reflect.DeepEqual(sanitized["service_registration"], expectedServiceRegistration) {
+		t.Fatalf("bad: %#v", sanitized["service_registration"])
+	}
+	telemetry := sanitized["telemetry"].(map[string]interface{})
+	if telemetry["prometheus_retention_time"] != int64(30) {
+		t.Fatalf("bad: %#v", telemetry)
+	}
+	if _, ok := telemetry["circonus_api_token"]; ok {
+		t.Fatalf("credentials should not be exposed: %#v", telemetry)
+	}
+	if sanitized["max_lease_ttl"] != int64(36000) || sanitized["ui"] != true {
+		t.Fatalf("bad: %#v", sanitized)
+	}
+}
+
 func TestLoadConfigFile_json(t *testing.T) {
 	logger := logformat.NewVaultLogger(log.LevelTrace)
 
@@ -311,6 +361,39 @@ listener "tcp" {
 
 }
 
+func TestParseServiceRegistration(t *testing.T) {
+	obj, _ := hcl.Parse(strings.TrimSpace(`
+service_registration "Kubernetes" {
+	namespace = "vault"
+	pod_name = "vault-0"
+}`))
+
+	var config Config
+	list, _ := obj.Node.(*ast.ObjectList)
+	if err := parseServiceRegistration(&config, list.Filter("service_registration")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &ServiceRegistration{
+		Type: "kubernetes",
+		Config: map[string]string{
+			"namespace": "vault",
+			"pod_name":  "vault-0",
+		},
+	}
+	if !reflect.DeepEqual(config.ServiceRegistration, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.ServiceRegistration, expected)
+	}
+
+	obj, _ = hcl.Parse(strings.TrimSpace(`
+service_registration "consul" {}
+service_registration "kubernetes" {}`))
+	list, _ = obj.Node.(*ast.ObjectList)
+	if err := parseServiceRegistration(&config, list.Filter("service_registration")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 func TestParseConfig_badTopLevel(t *testing.T) {
 	logger := logformat.NewVaultLogger(log.LevelTrace)
 
@@ -380,3 +463,12 @@ telemetry {
 		t.Errorf("bad error: %q", err)
 	}
 }
+
+func TestParseConfig_badDrainTimeout(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	_, err := ParseConfig(`drain_timeout = "0s"`, logger)
+	if err == nil || !strings.Contains(err.Error(), "drain_timeout must be positive") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
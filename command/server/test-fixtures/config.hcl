@@ -5,6 +5,7 @@ ui = true
 
 listener "tcp" {
     address = "127.0.0.1:443"
+    unauthenticated_metrics_access = true
 }
 
 backend "consul" {
@@ -18,11 +19,16 @@ ha_backend "consul" {
     disable_clustering = "true"
 }
 
+service_registration "consul" {
+    foo = "bar"
+}
+
 telemetry {
     statsd_address = "bar"
     statsite_address = "foo"
     dogstatsd_addr = "127.0.0.1:7254"
     dogstatsd_tags = ["tag_1:val_1", "tag_2:val_2"]
+    prometheus_retention_time = "30s"
 }
 
 max_lease_ttl = "10h"
@@ -30,3 +36,4 @@ default_lease_ttl = "10h"
 cluster_name = "testcluster"
 pid_file = "./pidfile"
 raw_storage_endpoint = true
+drain_timeout = "20s"
@@ -10,9 +10,11 @@ import (
 
 	"github.com/hashicorp/vault/meta"
 	"github.com/hashicorp/vault/physical"
+	sr "github.com/hashicorp/vault/serviceregistration"
 	"github.com/mitchellh/cli"
 
 	physConsul "github.com/hashicorp/vault/physical/consul"
+	srConsul "github.com/hashicorp/vault/serviceregistration/consul"
 )
 
 // The following tests have a go-metrics/exp manager race condition
@@ -25,6 +27,9 @@ func TestServer_CommonHA(t *testing.T) {
 		PhysicalBackends: map[string]physical.Factory{
 			"consul": physConsul.NewConsulBackend,
 		},
+		ServiceRegistrations: map[string]sr.Factory{
+			"consul": srConsul.NewServiceRegistration,
+		},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "")
@@ -56,6 +61,9 @@ func TestServer_GoodSeparateHA(t *testing.T) {
 		PhysicalBackends: map[string]physical.Factory{
 			"consul": physConsul.NewConsulBackend,
 		},
+		ServiceRegistrations: map[string]sr.Factory{
+			"consul": srConsul.NewServiceRegistration,
+		},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "")
@@ -87,6 +95,9 @@ func TestServer_BadSeparateHA(t *testing.T) {
 		PhysicalBackends: map[string]physical.Factory{
 			"consul": physConsul.NewConsulBackend,
 		},
+		ServiceRegistrations: map[string]sr.Factory{
+			"consul": srConsul.NewServiceRegistration,
+		},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "")
@@ -104,3 +115,76 @@ func TestServer_BadSeparateHA(t *testing.T) {
 		t.Fatalf("bad: should have gotten an error on a bad HA config")
 	}
 }
+
+func TestServer_ServiceRegistration(t *testing.T) {
+	ui := new(cli.MockUi)
+	c := &ServerCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+		PhysicalBackends: map[string]physical.Factory{
+			"consul": physConsul.NewConsulBackend,
+		},
+		ServiceRegistrations: map[string]sr.Factory{
+			"consul": srConsul.NewServiceRegistration,
+		},
+	}
+
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+
+	tmpfile.WriteString(basehcl + consulhcl + `
+service_registration "consul" {
+    service = "vault-test"
+}
+`)
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	args := []string{"-config", tmpfile.Name(), "-verify-only", "true"}
+
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s\n\n%s", code, ui.ErrorWriter.String(), ui.OutputWriter.String())
+	}
+
+	if !strings.Contains(ui.OutputWriter.String(), "Service Registration: consul") {
+		t.Fatalf("did not find Service Registration: %s", ui.OutputWriter.String())
+	}
+}
+
+func TestServer_BadServiceRegistration(t *testing.T) {
+	ui := new(cli.MockUi)
+	c := &ServerCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+		PhysicalBackends: map[string]physical.Factory{
+			"consul": physConsul.NewConsulBackend,
+		},
+		ServiceRegistrations: map[string]sr.Factory{
+			"consul": srConsul.NewServiceRegistration,
+		},
+	}
+
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+
+	tmpfile.WriteString(basehcl + consulhcl + `
+service_registration "zookeeper" {}
+`)
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	args := []string{"-config", tmpfile.Name(), "-verify-only", "true"}
+
+	if code := c.Run(args); code == 0 {
+		t.Fatalf("bad: should have gotten an error on an unknown service registration")
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "Unknown service_registration type zookeeper") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+}
@@ -177,3 +177,45 @@ func TestServer_ReloadListener(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestServer_BadUnauthenticatedMetricsAccess(t *testing.T) {
+	ui := new(cli.MockUi)
+	c := &ServerCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+		PhysicalBackends: map[string]physical.Factory{
+			"file": physFile.NewFileBackend,
+		},
+	}
+
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+
+	tmpfile.WriteString(`
+disable_mlock = true
+
+backend "file" {
+    path = "/dev/null"
+}
+
+listener "tcp" {
+    address = "127.0.0.1:8204"
+    tls_disable = "true"
+    unauthenticated_metrics_access = "sometimes"
+}
+`)
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	args := []string{"-config", tmpfile.Name(), "-verify-only", "true"}
+
+	if code := c.Run(args); code == 0 {
+		t.Fatalf("bad: should have gotten an error on an invalid unauthenticated_metrics_access")
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "Error parsing unauthenticated_metrics_access") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+}
@@ -17,7 +17,7 @@ type TokenCreateCommand struct {
 
 func (c *TokenCreateCommand) Run(args []string) int {
 	var format string
-	var id, displayName, lease, ttl, explicitMaxTTL, period, role string
+	var id, displayName, lease, ttl, explicitMaxTTL, period, role, tokenType string
 	var orphan, noDefaultPolicy, renewable bool
 	var metadata map[string]string
 	var numUses int
@@ -31,6 +31,7 @@ func (c *TokenCreateCommand) Run(args []string) int {
 	flags.StringVar(&explicitMaxTTL, "explicit-max-ttl", "", "")
 	flags.StringVar(&period, "period", "", "")
 	flags.StringVar(&role, "role", "", "")
+	flags.StringVar(&tokenType, "type", "", "")
 	flags.BoolVar(&orphan, "orphan", false, "")
 	flags.BoolVar(&renewable, "renewable", true, "")
 	flags.BoolVar(&noDefaultPolicy, "no-default-policy", false, "")
@@ -73,6 +74,7 @@ func (c *TokenCreateCommand) Run(args []string) int {
 		Renewable:       new(bool),
 		ExplicitMaxTTL:  explicitMaxTTL,
 		Period:          period,
+		Type:            tokenType,
 	}
 	*tcr.Renewable = renewable
 
@@ -164,6 +166,12 @@ Token Options:
   -use-limit=5            The number of times this token can be used until
                           it is automatically revoked.
 
+  -type="batch"           The type of token to create, "service" or "batch".
+                          Batch tokens are not persisted, cannot be renewed
+                          or revoked and cannot create child tokens. If a
+                          role is given, it decides which types are allowed.
+                          Defaults to "service".
+
   -format=table           The format for output. By default it is a whitespace-
                           delimited table. This can also be json or yaml.
 
@@ -71,8 +71,6 @@ type CompressionConfig struct {
 // be assumed.
 func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 	var buf bytes.Buffer
-	var writer io.WriteCloser
-	var err error
 
 	if config == nil {
 		return nil, fmt.Errorf("config is nil")
@@ -83,11 +81,63 @@ func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 	switch config.Type {
 	case CompressionTypeLzw:
 		buf.Write([]byte{CompressionCanaryLzw})
-
-		writer = lzw.NewWriter(&buf, lzw.LSB, 8)
 	case CompressionTypeGzip:
 		buf.Write([]byte{CompressionCanaryGzip})
+	case CompressionTypeSnappy:
+		buf.Write([]byte{CompressionCanarySnappy})
+	}
+
+	writer, err := newWriter(&buf, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compress the input and place it in the same buffer containing the
+	// canary byte.
+	if _, err = writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress input data; err: %v", err)
+	}
+
+	// Close the io.WriteCloser
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// Return the compressed bytes with canary byte at the start
+	return buf.Bytes(), nil
+}
+
+// CompressStream compresses everything read from r into w based on the
+// configured type. Unlike Compress, no canary byte is written, so the output
+// is in the standard format of the compression type and can be read by
+// other tools, such as gunzip for CompressionTypeGzip.
+func CompressStream(w io.Writer, r io.Reader, config *CompressionConfig) error {
+	if config == nil {
+		return fmt.Errorf("config is nil")
+	}
 
+	writer, err := newWriter(w, config)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(writer, r); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to compress input data; err: %v", err)
+	}
+
+	return writer.Close()
+}
+
+// newWriter creates a writer compressing into w based on the configured type
+func newWriter(w io.Writer, config *CompressionConfig) (io.WriteCloser, error) {
+	var writer io.WriteCloser
+	var err error
+
+	switch config.Type {
+	case CompressionTypeLzw:
+		writer = lzw.NewWriter(w, lzw.LSB, 8)
+	case CompressionTypeGzip:
 		switch {
 		case config.GzipCompressionLevel == gzip.BestCompression,
 			config.GzipCompressionLevel == gzip.BestSpeed,
@@ -98,10 +148,9 @@ func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 			// any invalid value, fallback to Defaultcompression
 			config.GzipCompressionLevel = gzip.DefaultCompression
 		}
-		writer, err = gzip.NewWriterLevel(&buf, config.GzipCompressionLevel)
+		writer, err = gzip.NewWriterLevel(w, config.GzipCompressionLevel)
 	case CompressionTypeSnappy:
-		buf.Write([]byte{CompressionCanarySnappy})
-		writer = snappy.NewBufferedWriter(&buf)
+		writer = snappy.NewBufferedWriter(w)
 	default:
 		return nil, fmt.Errorf("unsupported compression type")
 	}
@@ -114,19 +163,7 @@ func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 		return nil, fmt.Errorf("failed to create a compression writer")
 	}
 
-	// Compress the input and place it in the same buffer containing the
-	// canary byte.
-	if _, err = writer.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to compress input data; err: %v", err)
-	}
-
-	// Close the io.WriteCloser
-	if err = writer.Close(); err != nil {
-		return nil, err
-	}
-
-	// Return the compressed bytes with canary byte at the start
-	return buf.Bytes(), nil
+	return writer, nil
 }
 
 // Decompress checks if the first byte in the input matches the canary byte.
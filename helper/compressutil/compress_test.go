@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -231,3 +233,37 @@ func TestCompressUtil_CompressDecompress(t *testing.T) {
 		t.Fatalf("bad: mismatch: inputJSONBytes: %s\n decompressedJSONBytes: %s", string(inputJSONBytes), string(decompressedJSONBytes))
 	}
 }
+
+func TestCompressUtil_CompressStream(t *testing.T) {
+	input := []byte(strings.Repeat("sample data\n", 100))
+
+	if err := CompressStream(ioutil.Discard, bytes.NewReader(input), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := CompressStream(ioutil.Discard, bytes.NewReader(input), &CompressionConfig{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The output has no canary and can be read by the standard gzip reader
+	var buf bytes.Buffer
+	if err := CompressStream(&buf, bytes.NewReader(input), &CompressionConfig{
+		Type: CompressionTypeGzip,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Bytes()[0] == CompressionCanaryGzip {
+		t.Fatalf("bad: unexpected canary")
+	}
+
+	reader, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatalf("bad: decompressed value;\nexpected: %q\nactual: %q", input, output)
+	}
+}
@@ -0,0 +1,339 @@
+package logformat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/mgutz/logxi/v1"
+)
+
+var levelNames = map[int]string{
+	log.LevelTrace:  "trace",
+	log.LevelDebug:  "debug",
+	log.LevelInfo:   "info",
+	log.LevelNotice: "notice",
+	log.LevelWarn:   "warn",
+	log.LevelError:  "err",
+}
+
+// ParseLevel returns the level with the given name, as accepted by the
+// -log-level flag of the server
+func ParseLevel(name string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return log.LevelTrace, nil
+	case "debug":
+		return log.LevelDebug, nil
+	case "info":
+		return log.LevelInfo, nil
+	case "notice":
+		return log.LevelNotice, nil
+	case "warn":
+		return log.LevelWarn, nil
+	case "err", "error":
+		return log.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// LevelName returns the name of the level
+func LevelName(level int) string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", level)
+}
+
+// ControlledLogger is a Vault logger whose level can be changed at runtime,
+// both globally and for each subsystem, and whose messages can be streamed
+// to monitors besides being written out. The subsystem of a message is given
+// by its prefix, such as "core" for "core: post-unseal setup complete";
+// subsystems are nested with slashes, so that the level of "physical" also
+// applies to "physical/consul".
+type ControlledLogger struct {
+	writer       io.Writer
+	formatter    log.Formatter
+	defaultLevel int
+
+	l          sync.RWMutex
+	level      int
+	subsystems map[string]int
+	monitors   map[*LogMonitor]struct{}
+
+	// effective is the most verbose level wanted by any output, so that
+	// messages nothing wants are dropped without taking the lock
+	effective int32
+}
+
+// NewControlledVaultLogger creates a logger with the Vault formatter that
+// writes to the given writer. Resetting the logger reverts to the given
+// level.
+func NewControlledVaultLogger(w io.Writer, level int) *ControlledLogger {
+	l := &ControlledLogger{
+		writer:       w,
+		formatter:    createVaultFormatter(),
+		defaultLevel: level,
+		level:        level,
+		subsystems:   make(map[string]int),
+		monitors:     make(map[*LogMonitor]struct{}),
+	}
+	l.updateEffectiveLevel()
+	return l
+}
+
+// updateEffectiveLevel must be called with the lock held for writing, or
+// before the logger is shared
+func (l *ControlledLogger) updateEffectiveLevel() {
+	effective := l.level
+	for _, level := range l.subsystems {
+		if level > effective {
+			effective = level
+		}
+	}
+	for m := range l.monitors {
+		if m.level > effective {
+			effective = m.level
+		}
+	}
+	atomic.StoreInt32(&l.effective, int32(effective))
+}
+
+// levelFor returns the level applying to the subsystem. The lock must be
+// held.
+func (l *ControlledLogger) levelFor(subsystem string) int {
+	for subsystem != "" {
+		if level, ok := l.subsystems[subsystem]; ok {
+			return level
+		}
+		i := strings.LastIndex(subsystem, "/")
+		if i < 0 {
+			break
+		}
+		subsystem = subsystem[:i]
+	}
+	return l.level
+}
+
+// subsystemOf returns the subsystem logging the message, or an empty string
+// if the message has no prefix
+func subsystemOf(msg string) string {
+	i := strings.Index(msg, ": ")
+	if i <= 0 {
+		return ""
+	}
+	if strings.ContainsAny(msg[:i], " \t") {
+		return ""
+	}
+	return msg[:i]
+}
+
+func (l *ControlledLogger) Trace(msg string, args ...interface{}) {
+	l.Log(log.LevelTrace, msg, args)
+}
+
+func (l *ControlledLogger) Debug(msg string, args ...interface{}) {
+	l.Log(log.LevelDebug, msg, args)
+}
+
+func (l *ControlledLogger) Info(msg string, args ...interface{}) {
+	l.Log(log.LevelInfo, msg, args)
+}
+
+// Warn logs a warning and returns the first error among the arguments
+func (l *ControlledLogger) Warn(msg string, args ...interface{}) error {
+	l.Log(log.LevelWarn, msg, args)
+	return firstError(args)
+}
+
+// Error logs an error and returns the first error among the arguments, or
+// one made of the message
+func (l *ControlledLogger) Error(msg string, args ...interface{}) error {
+	l.Log(log.LevelError, msg, args)
+	if err := firstError(args); err != nil {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// Fatal logs the message and panics
+func (l *ControlledLogger) Fatal(msg string, args ...interface{}) {
+	l.Log(log.LevelFatal, msg, args)
+	panic("Exit due to fatal error: ")
+}
+
+func firstError(args []interface{}) error {
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *ControlledLogger) Log(level int, msg string, args []interface{}) {
+	if int32(level) > atomic.LoadInt32(&l.effective) {
+		return
+	}
+
+	l.l.RLock()
+	defer l.l.RUnlock()
+
+	if level <= l.levelFor(subsystemOf(msg)) {
+		l.formatter.Format(l.writer, level, msg, args)
+	}
+	for m := range l.monitors {
+		if level <= m.level {
+			m.write(level, msg, args)
+		}
+	}
+}
+
+// SetLevel sets the global level, which applies to the subsystems that have
+// no level of their own
+func (l *ControlledLogger) SetLevel(level int) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.level = level
+	l.updateEffectiveLevel()
+}
+
+// Level returns the global level
+func (l *ControlledLogger) Level() int {
+	l.l.RLock()
+	defer l.l.RUnlock()
+	return l.level
+}
+
+// SetSubsystemLevel sets the level of a subsystem and the subsystems nested
+// in it
+func (l *ControlledLogger) SetSubsystemLevel(subsystem string, level int) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.subsystems[subsystem] = level
+	l.updateEffectiveLevel()
+}
+
+// ResetSubsystemLevel makes the subsystem use the level of its parent, or
+// the global level, again
+func (l *ControlledLogger) ResetSubsystemLevel(subsystem string) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	delete(l.subsystems, subsystem)
+	l.updateEffectiveLevel()
+}
+
+// SubsystemLevels returns the subsystems that have a level of their own
+func (l *ControlledLogger) SubsystemLevels() map[string]int {
+	l.l.RLock()
+	defer l.l.RUnlock()
+	levels := make(map[string]int, len(l.subsystems))
+	for subsystem, level := range l.subsystems {
+		levels[subsystem] = level
+	}
+	return levels
+}
+
+// Reset reverts to the level the logger was created with and removes the
+// levels of all subsystems
+func (l *ControlledLogger) Reset() {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.level = l.defaultLevel
+	l.subsystems = make(map[string]int)
+	l.updateEffectiveLevel()
+}
+
+func (l *ControlledLogger) IsTrace() bool {
+	return atomic.LoadInt32(&l.effective) >= log.LevelTrace
+}
+
+func (l *ControlledLogger) IsDebug() bool {
+	return atomic.LoadInt32(&l.effective) >= log.LevelDebug
+}
+
+func (l *ControlledLogger) IsInfo() bool {
+	return atomic.LoadInt32(&l.effective) >= log.LevelInfo
+}
+
+func (l *ControlledLogger) IsWarn() bool {
+	return atomic.LoadInt32(&l.effective) >= log.LevelWarn
+}
+
+// Monitor starts streaming the messages at the given level or more severe,
+// whatever the levels of the logger, formatted as text or JSON. Up to
+// bufferSize messages are buffered; messages that do not fit are dropped
+// rather than slowing down the server.
+func (l *ControlledLogger) Monitor(level int, jsonFormat bool, bufferSize int) *LogMonitor {
+	formatter := &vaultFormatter{
+		Mutex: &sync.Mutex{},
+		style: styledefault,
+	}
+	if jsonFormat {
+		formatter.style = stylejson
+	}
+
+	m := &LogMonitor{
+		logger:    l,
+		level:     level,
+		formatter: formatter,
+		ch:        make(chan []byte, bufferSize),
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.monitors[m] = struct{}{}
+	l.updateEffectiveLevel()
+	return m
+}
+
+// LogMonitor receives the messages of a ControlledLogger
+type LogMonitor struct {
+	logger    *ControlledLogger
+	level     int
+	formatter *vaultFormatter
+	ch        chan []byte
+	dropped   uint64
+	stopOnce  sync.Once
+}
+
+// C returns the channel the formatted messages are sent on. It is closed
+// once the monitor is stopped.
+func (m *LogMonitor) C() <-chan []byte {
+	return m.ch
+}
+
+// Dropped returns the number of messages dropped because the buffer was full
+func (m *LogMonitor) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// Stop stops streaming messages to the monitor
+func (m *LogMonitor) Stop() {
+	m.stopOnce.Do(func() {
+		m.logger.l.Lock()
+		defer m.logger.l.Unlock()
+		delete(m.logger.monitors, m)
+		m.logger.updateEffectiveLevel()
+
+		// Messages are only sent with the lock held, so none can be sent
+		// on the closed channel
+		close(m.ch)
+	})
+}
+
+// write is called with the lock of the logger held for reading
+func (m *LogMonitor) write(level int, msg string, args []interface{}) {
+	var buf bytes.Buffer
+	m.formatter.Format(&buf, level, msg, args)
+	select {
+	case m.ch <- buf.Bytes():
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+	}
+}
@@ -0,0 +1,156 @@
+package logformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/mgutz/logxi/v1"
+)
+
+// lockedBuffer is a buffer that is safe to read while being logged to
+type lockedBuffer struct {
+	l   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.buf.String()
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"trace", "debug", "info", "notice", "warn", "err"} {
+		level, err := ParseLevel(name)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if LevelName(level) != name {
+			t.Fatalf("bad: %s: %s", name, LevelName(level))
+		}
+	}
+	if level, err := ParseLevel(" ERROR "); err != nil || level != log.LevelError {
+		t.Fatalf("bad: %d, %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestControlledLogger_Levels(t *testing.T) {
+	var buf lockedBuffer
+	logger := NewControlledVaultLogger(&buf, log.LevelInfo)
+
+	logger.Debug("core: hidden")
+	logger.Info("core: shown")
+	if logger.IsDebug() {
+		t.Fatal("debug should not be enabled")
+	}
+
+	// A subsystem can be more verbose than the rest, including the
+	// subsystems nested in it
+	logger.SetSubsystemLevel("physical", log.LevelTrace)
+	if !logger.IsTrace() {
+		t.Fatal("trace should be enabled for the subsystem")
+	}
+	logger.Trace("physical/consul: nested trace")
+	logger.Debug("core: still hidden")
+
+	// Or less verbose
+	logger.SetSubsystemLevel("expiration", log.LevelError)
+	logger.Info("expiration: hidden info")
+	logger.Error("expiration: shown error")
+
+	// Messages without a prefix use the global level
+	logger.Info("no prefix here")
+	logger.Info("not a prefix: as it has spaces")
+
+	logger.SetLevel(log.LevelWarn)
+	logger.Info("core: hidden after raising the level")
+	if levels := logger.SubsystemLevels(); len(levels) != 2 || levels["physical"] != log.LevelTrace {
+		t.Fatalf("bad: %#v", levels)
+	}
+
+	logger.Reset()
+	if logger.Level() != log.LevelInfo || len(logger.SubsystemLevels()) != 0 {
+		t.Fatalf("bad: %d %#v", logger.Level(), logger.SubsystemLevels())
+	}
+	logger.Trace("physical/consul: hidden after reset")
+	if logger.IsDebug() {
+		t.Fatal("debug should not be enabled after reset")
+	}
+
+	out := buf.String()
+	for _, msg := range []string{"core: shown", "physical/consul: nested trace", "expiration: shown error", "no prefix here", "not a prefix: as it has spaces"} {
+		if !strings.Contains(out, msg) {
+			t.Fatalf("missing %q in:\n%s", msg, out)
+		}
+	}
+	for _, msg := range []string{"hidden"} {
+		if strings.Contains(out, msg) {
+			t.Fatalf("unexpected %q in:\n%s", msg, out)
+		}
+	}
+}
+
+func TestControlledLogger_Monitor(t *testing.T) {
+	var buf lockedBuffer
+	logger := NewControlledVaultLogger(&buf, log.LevelInfo)
+
+	// Monitors get the messages at their own level
+	m := logger.Monitor(log.LevelDebug, true, 2)
+	if !logger.IsDebug() {
+		t.Fatal("debug should be enabled while monitored")
+	}
+	logger.Debug("core: for the monitor", "key", "value")
+	logger.Trace("core: for nobody")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(<-m.C(), &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry["@message"] != "core: for the monitor" || entry["@level"] != "debug" || entry["key"] != "value" {
+		t.Fatalf("bad: %#v", entry)
+	}
+	if strings.Contains(buf.String(), "for the monitor") {
+		t.Fatalf("monitored message should not have been written: %s", buf.String())
+	}
+
+	// Messages are dropped when the buffer is full
+	logger.Info("core: one")
+	logger.Info("core: two")
+	logger.Info("core: three")
+	if m.Dropped() != 1 {
+		t.Fatalf("bad: %d", m.Dropped())
+	}
+
+	m.Stop()
+	m.Stop()
+	if logger.IsDebug() {
+		t.Fatal("debug should not be enabled once the monitor stopped")
+	}
+	var count int
+	for range m.C() {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	// Text format
+	m = logger.Monitor(log.LevelInfo, false, 1)
+	defer m.Stop()
+	logger.Info("core: as text")
+	if line := string(<-m.C()); !strings.Contains(line, "[INFO ] core: as text") || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("bad: %q", line)
+	}
+}
@@ -0,0 +1,87 @@
+package metricsutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// The formats that metrics can be requested in
+	FormatJSON       = "json"
+	FormatPrometheus = "prometheus"
+
+	jsonContentType = "application/json"
+)
+
+// MetricsHelper gives access to the metrics kept in memory by the server
+type MetricsHelper struct {
+	inMemSink  *metrics.InmemSink
+	prometheus *PrometheusSink
+}
+
+// NewMetricsHelper returns a helper for the given sinks. The Prometheus sink
+// is nil if Prometheus metrics are not enabled.
+func NewMetricsHelper(inMemSink *metrics.InmemSink, prometheus *PrometheusSink) *MetricsHelper {
+	return &MetricsHelper{
+		inMemSink:  inMemSink,
+		prometheus: prometheus,
+	}
+}
+
+// PrometheusEnabled returns whether metrics can be requested in the
+// Prometheus format
+func (m *MetricsHelper) PrometheusEnabled() bool {
+	return m.prometheus != nil
+}
+
+// ResponseForFormat returns a raw response containing the metrics in the
+// given format; JSON is used if no format is given
+func (m *MetricsHelper) ResponseForFormat(format string) (*logical.Response, error) {
+	switch format {
+	case FormatPrometheus:
+		return m.prometheusResponse()
+	case FormatJSON, "":
+		return m.jsonResponse()
+	default:
+		return nil, fmt.Errorf("metrics are not supported in the %q format", format)
+	}
+}
+
+func (m *MetricsHelper) prometheusResponse() (*logical.Response, error) {
+	if !m.PrometheusEnabled() {
+		return nil, fmt.Errorf("prometheus is not enabled; set prometheus_retention_time in the telemetry configuration")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: PrometheusContentType,
+			logical.HTTPRawBody:     m.prometheus.Expose(),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+func (m *MetricsHelper) jsonResponse() (*logical.Response, error) {
+	summary, err := m.inMemSink.DisplayMetrics(nil, nil)
+	if err != nil {
+		return nil, errwrap.Wrapf("error while fetching the in-memory metrics: {{err}}", err)
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return nil, errwrap.Wrapf("error while marshalling the in-memory metrics: {{err}}", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: jsonContentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
@@ -0,0 +1,59 @@
+package metricsutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestMetricsHelper_ResponseForFormat(t *testing.T) {
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	inm.SetGauge([]string{"vault", "core", "unsealed"}, 1)
+
+	// Without Prometheus
+	m := NewMetricsHelper(inm, nil)
+	if m.PrometheusEnabled() {
+		t.Fatal("prometheus should not be enabled")
+	}
+	if _, err := m.ResponseForFormat(FormatPrometheus); err == nil {
+		t.Fatal("expected error when prometheus is not enabled")
+	}
+	if _, err := m.ResponseForFormat("xml"); err == nil {
+		t.Fatal("expected error for an unknown format")
+	}
+
+	for _, format := range []string{"", FormatJSON} {
+		resp, err := m.ResponseForFormat(format)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp.Data[logical.HTTPContentType] != "application/json" {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+		var summary metrics.MetricsSummary
+		if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &summary); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if len(summary.Gauges) != 1 || summary.Gauges[0].Name != "vault.core.unsealed" {
+			t.Fatalf("bad: %#v", summary)
+		}
+	}
+
+	// With Prometheus
+	p := NewPrometheusSink(time.Minute)
+	p.SetGauge([]string{"vault", "core", "unsealed"}, 1)
+	m = NewMetricsHelper(inm, p)
+	resp, err := m.ResponseForFormat(FormatPrometheus)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data[logical.HTTPContentType] != PrometheusContentType {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if body := string(resp.Data[logical.HTTPRawBody].([]byte)); body != "# TYPE vault_core_unsealed gauge\nvault_core_unsealed 1\n" {
+		t.Fatalf("bad: %q", body)
+	}
+}
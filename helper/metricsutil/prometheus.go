@@ -0,0 +1,239 @@
+package metricsutil
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+const (
+	// PrometheusContentType is the content type of the Prometheus text
+	// exposition format
+	PrometheusContentType = "text/plain; version=0.0.4"
+
+	prometheusGauge   = "gauge"
+	prometheusCounter = "counter"
+	prometheusSummary = "summary"
+)
+
+// prometheusSeries is a single time series, that is a metric name along with
+// one set of label values
+type prometheusSeries struct {
+	name    string
+	kind    string
+	labels  []metrics.Label
+	value   float64
+	sum     float64
+	count   uint64
+	updated time.Time
+}
+
+// PrometheusSink is a metrics sink that keeps the latest value of every time
+// series so that it can be scraped in the Prometheus text format. Gauges keep
+// the last value set, counters accumulate and samples are exposed as
+// summaries with a sum and a count. Series that have not been updated within
+// the retention time are dropped.
+type PrometheusSink struct {
+	retention time.Duration
+
+	l      sync.Mutex
+	series map[string]*prometheusSeries
+
+	// now is used in place of time.Now so that tests can control time
+	now func() time.Time
+}
+
+// NewPrometheusSink returns a sink that retains series for the given time
+// after their last update
+func NewPrometheusSink(retention time.Duration) *PrometheusSink {
+	return &PrometheusSink{
+		retention: retention,
+		series:    make(map[string]*prometheusSeries),
+		now:       time.Now,
+	}
+}
+
+func (p *PrometheusSink) SetGauge(key []string, val float32) {
+	p.SetGaugeWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	s := p.getSeries(prometheusGauge, key, labels)
+	s.value = float64(val)
+}
+
+// EmitKey is not supported as key/value pairs have no equivalent in
+// Prometheus
+func (p *PrometheusSink) EmitKey(key []string, val float32) {
+}
+
+func (p *PrometheusSink) IncrCounter(key []string, val float32) {
+	p.IncrCounterWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	s := p.getSeries(prometheusCounter, key, labels)
+	s.value += float64(val)
+}
+
+func (p *PrometheusSink) AddSample(key []string, val float32) {
+	p.AddSampleWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	s := p.getSeries(prometheusSummary, key, labels)
+	s.sum += float64(val)
+	s.count++
+}
+
+// getSeries returns the series for the given key and labels, creating it if
+// needed, and marks it as updated. The lock must be held.
+func (p *PrometheusSink) getSeries(kind string, key []string, labels []metrics.Label) *prometheusSeries {
+	name := prometheusName(strings.Join(key, "_"))
+	sorted := prometheusLabels(labels)
+
+	id := kind + "\x00" + name
+	for _, label := range sorted {
+		id += "\x00" + label.Name + "\x00" + label.Value
+	}
+
+	s, ok := p.series[id]
+	if !ok {
+		s = &prometheusSeries{
+			name:   name,
+			kind:   kind,
+			labels: sorted,
+		}
+		p.series[id] = s
+	}
+	s.updated = p.now()
+	return s
+}
+
+// Expose returns all retained series in the Prometheus text format, grouped
+// by metric name and sorted so that the output is stable
+func (p *PrometheusSink) Expose() []byte {
+	p.l.Lock()
+	var series []*prometheusSeries
+	cutoff := p.now().Add(-p.retention)
+	for id, s := range p.series {
+		if s.updated.Before(cutoff) {
+			delete(p.series, id)
+			continue
+		}
+		copied := *s
+		series = append(series, &copied)
+	}
+	p.l.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		if series[i].kind != series[j].kind {
+			return series[i].kind < series[j].kind
+		}
+		return formatLabels(series[i].labels, "", "") < formatLabels(series[j].labels, "", "")
+	})
+
+	var buf bytes.Buffer
+	var lastName, lastKind string
+	for _, s := range series {
+		// A name can only have a single type; the first one wins if the
+		// same key was used for different kinds of metrics
+		if s.name == lastName && s.kind != lastKind {
+			continue
+		}
+		if s.name != lastName {
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", s.name, s.kind)
+			lastName, lastKind = s.name, s.kind
+		}
+
+		switch s.kind {
+		case prometheusSummary:
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", s.name, formatLabels(s.labels, "{", "}"), formatValue(s.sum))
+			fmt.Fprintf(&buf, "%s_count%s %d\n", s.name, formatLabels(s.labels, "{", "}"), s.count)
+		default:
+			fmt.Fprintf(&buf, "%s%s %s\n", s.name, formatLabels(s.labels, "{", "}"), formatValue(s.value))
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// prometheusName replaces the characters that are not allowed in Prometheus
+// metric and label names with underscores
+func prometheusName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			return r
+		case r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if mapped == "" || (mapped[0] >= '0' && mapped[0] <= '9') {
+		mapped = "_" + mapped
+	}
+	return mapped
+}
+
+// prometheusLabels returns a sanitized copy of the labels sorted by name
+func prometheusLabels(labels []metrics.Label) []metrics.Label {
+	sorted := make([]metrics.Label, 0, len(labels))
+	for _, label := range labels {
+		sorted = append(sorted, metrics.Label{
+			Name:  strings.Replace(prometheusName(label.Name), ":", "_", -1),
+			Value: label.Value,
+		})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func formatLabels(labels []metrics.Label, open, close string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label.Name, labelValueEscaper.Replace(label.Value)))
+	}
+	return open + strings.Join(pairs, ",") + close
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,77 @@
+package metricsutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+func TestPrometheusSink_Expose(t *testing.T) {
+	p := NewPrometheusSink(time.Minute)
+
+	p.SetGauge([]string{"vault", "core", "unsealed"}, 1)
+	p.SetGaugeWithLabels([]string{"vault", "expire", "num_leases"}, 3, []metrics.Label{
+		{Name: "mount_point", Value: `secret/"quoted"`},
+		{Name: "cluster", Value: "vault-cluster"},
+	})
+	p.IncrCounter([]string{"vault", "route", "read-secret"}, 1)
+	p.IncrCounter([]string{"vault", "route", "read-secret"}, 2)
+	p.AddSample([]string{"vault", "core", "handle_request"}, 1.5)
+	p.AddSample([]string{"vault", "core", "handle_request"}, 2.5)
+	p.EmitKey([]string{"vault", "ignored"}, 1)
+
+	expected := `# TYPE vault_core_handle_request summary
+vault_core_handle_request_sum 4
+vault_core_handle_request_count 2
+# TYPE vault_core_unsealed gauge
+vault_core_unsealed 1
+# TYPE vault_expire_num_leases gauge
+vault_expire_num_leases{cluster="vault-cluster",mount_point="secret/\"quoted\""} 3
+# TYPE vault_route_read_secret counter
+vault_route_read_secret 3
+`
+	if actual := string(p.Expose()); actual != expected {
+		t.Fatalf("bad: expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
+
+func TestPrometheusSink_Retention(t *testing.T) {
+	now := time.Now()
+	p := NewPrometheusSink(time.Minute)
+	p.now = func() time.Time { return now }
+
+	p.SetGauge([]string{"old"}, 1)
+	now = now.Add(30 * time.Second)
+	p.SetGauge([]string{"new"}, 1)
+
+	out := string(p.Expose())
+	if !strings.Contains(out, "old 1") || !strings.Contains(out, "new 1") {
+		t.Fatalf("bad: %s", out)
+	}
+
+	now = now.Add(45 * time.Second)
+	out = string(p.Expose())
+	if strings.Contains(out, "old") {
+		t.Fatalf("expired series should have been dropped: %s", out)
+	}
+	if !strings.Contains(out, "new 1") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestPrometheusName(t *testing.T) {
+	cases := map[string]string{
+		"vault_core_unseal":    "vault_core_unseal",
+		"vault_route_read-sys": "vault_route_read_sys",
+		"host.name:metric":     "host_name:metric",
+		"1st":                  "_1st",
+		"":                     "_",
+	}
+	for in, expected := range cases {
+		if actual := prometheusName(in); actual != expected {
+			t.Fatalf("bad: %q: expected %q, got %q", in, expected, actual)
+		}
+	}
+}
@@ -573,3 +573,80 @@ func TestHTTP_Forwarding_HelpOperation(t *testing.T) {
 	testHelp(cores[0].Client)
 	testHelp(cores[1].Client)
 }
+
+func TestHTTP_PerfStandby(t *testing.T) {
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		PerformanceStandby: true,
+	}, &vault.TestClusterOptions{
+		HandlerFunc: Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	cores := cluster.Cores
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	config := api.DefaultConfig()
+	config.Address = fmt.Sprintf("https://127.0.0.1:%d", cores[1].Listeners[0].Address.Port)
+	config.HttpClient = cleanhttp.DefaultClient()
+	config.HttpClient.Transport.(*http.Transport).TLSClientConfig = cores[1].TLSConfig
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(cluster.RootToken)
+
+	var health *api.HealthResponse
+	for i := 0; i < 100; i++ {
+		r := client.NewRequest("GET", "/v1/sys/health")
+		r.Params.Add("perfstandbyok", "")
+		resp, err := client.RawRequest(r)
+		if err == nil {
+			health = &api.HealthResponse{}
+			err = resp.DecodeJSON(health)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if health == nil || !health.Standby || !health.PerformanceStandby {
+		t.Fatalf("bad: %#v", health)
+	}
+
+	// The write is forwarded to the active node
+	_, err = client.Logical().Write("secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The read is served by the standby once it sees the write
+	var value interface{}
+	for i := 0; i < 100; i++ {
+		secret, err := client.Logical().Read("secret/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != nil {
+			value = secret.Data["value"]
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if value != "bar" {
+		t.Fatalf("bad: %#v", value)
+	}
+
+	// Token creation is forwarded as well
+	secret, err := client.Auth().Token().Create(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		t.Fatalf("bad: %#v", secret)
+	}
+}
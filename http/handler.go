@@ -1,14 +1,17 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/parseutil"
@@ -28,6 +31,11 @@ const (
 	// wrap in; has no effect if the wrap TTL is not set
 	WrapFormatHeaderName = "X-Vault-Wrap-Format"
 
+	// MFAHeaderName is the name of the header containing the credentials of
+	// an MFA method, in the form "method_name[:passcode]". It may be repeated
+	// for each method to be validated.
+	MFAHeaderName = "X-Vault-MFA"
+
 	// NoRequestForwardingHeaderName is the name of the header telling Vault
 	// not to use request forwarding
 	NoRequestForwardingHeaderName = "X-Vault-No-Request-Forwarding"
@@ -38,9 +46,28 @@ const (
 	MaxRequestSize = 32 * 1024 * 1024
 )
 
+// HandlerProperties are the options of the handler serving the API on a
+// listener
+type HandlerProperties struct {
+	Core *vault.Core
+
+	// UnauthenticatedMetricsAccess allows reading sys/metrics without a token
+	UnauthenticatedMetricsAccess bool
+}
+
 // Handler returns an http.Handler for the API. This can be used on
 // its own to mount the Vault API within another web server.
 func Handler(core *vault.Core) http.Handler {
+	return HandlerWithProperties(&HandlerProperties{
+		Core: core,
+	})
+}
+
+// HandlerWithProperties returns an http.Handler for the API configured with
+// the given properties
+func HandlerWithProperties(props *HandlerProperties) http.Handler {
+	core := props.Core
+
 	// Create the muxer to handle the actual endpoints
 	mux := http.NewServeMux()
 	mux.Handle("/v1/sys/init", handleSysInit(core))
@@ -56,14 +83,28 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/rekey/update", handleRequestForwarding(core, handleSysRekeyUpdate(core, false)))
 	mux.Handle("/v1/sys/rekey-recovery-key/init", handleRequestForwarding(core, handleSysRekeyInit(core, true)))
 	mux.Handle("/v1/sys/rekey-recovery-key/update", handleRequestForwarding(core, handleSysRekeyUpdate(core, true)))
+	mux.Handle("/v1/sys/storage/snapshot", handleRequestForwarding(core, handleSysStorageSnapshot(core)))
+	if props.UnauthenticatedMetricsAccess {
+		mux.Handle("/v1/sys/metrics", handleMetricsUnauthenticated(core))
+	} else {
+		mux.Handle("/v1/sys/metrics", handleRequestForwarding(core, handleSysMetrics(core)))
+	}
+	mux.Handle("/v1/sys/loggers", handleSysNode(core))
+	mux.Handle("/v1/sys/loggers/", handleSysNode(core))
+	mux.Handle("/v1/sys/monitor", handleSysMonitor(core))
+	mux.Handle("/v1/sys/pprof", handleSysPprof(core))
+	mux.Handle("/v1/sys/pprof/", handleSysPprof(core))
+	mux.Handle("/v1/sys/host-info", handleSysNode(core))
+	mux.Handle("/v1/sys/in-flight-req", handleSysNode(core))
+	mux.Handle("/v1/sys/config/state/sanitized", handleSysNode(core))
 	mux.Handle("/v1/sys/wrapping/lookup", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	mux.Handle("/v1/sys/wrapping/rewrap", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	mux.Handle("/v1/sys/wrapping/unwrap", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	for _, path := range injectDataIntoTopRoutes {
-		mux.Handle(path, handleRequestForwarding(core, handleLogical(core, true, nil)))
+		mux.Handle(path, handlePerfStandbyReads(core, handleLogical(core, true, nil)))
 	}
-	mux.Handle("/v1/sys/", handleRequestForwarding(core, handleLogical(core, false, nil)))
-	mux.Handle("/v1/", handleRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/sys/", handlePerfStandbyReads(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/", handlePerfStandbyReads(core, handleLogical(core, false, nil)))
 
 	// Wrap the handler in another handler to trigger all help paths.
 	helpWrappedHandler := wrapHelpHandler(mux, core)
@@ -73,7 +114,47 @@ func Handler(core *vault.Core) http.Handler {
 	// handler
 	genericWrappedHandler := wrapGenericHandler(corsWrappedHandler)
 
-	return genericWrappedHandler
+	// Track the requests being served, outermost so that they are tracked
+	// for as long as they are handled
+	return wrapInFlightHandler(core, genericWrappedHandler)
+}
+
+// inFlightRequestIDKey is the key of the ID of the in-flight request in the
+// context of HTTP requests
+type inFlightRequestIDKey struct{}
+
+// wrapInFlightHandler records the requests being served with the core, which
+// lists them in sys/in-flight-req and waits for them when draining. Requests
+// received while draining are rejected.
+func wrapInFlightHandler(core *vault.Core, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, errwrap.Wrapf("failed to generate identifier for the request: {{err}}", err))
+			return
+		}
+
+		started := core.StartInFlightRequest(id, &vault.InFlightRequest{
+			Method:           r.Method,
+			Path:             r.URL.Path,
+			ClientRemoteAddr: r.RemoteAddr,
+			StartTime:        time.Now(),
+		})
+		if !started {
+			respondError(w, http.StatusServiceUnavailable, fmt.Errorf("Vault is not accepting new requests while draining"))
+			return
+		}
+		defer core.FinishInFlightRequest(id)
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), inFlightRequestIDKey{}, id)))
+	})
+}
+
+// inFlightRequestID returns the ID under which the request is tracked by the
+// core, if any
+func inFlightRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(inFlightRequestIDKey{}).(string)
+	return id
 }
 
 // wrapGenericHandler wraps the handler with an extra layer of handler where
@@ -174,44 +255,94 @@ func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handle
 			return
 		}
 
-		// Attempt forwarding the request. If we cannot forward -- perhaps it's
-		// been disabled on the active node -- this will return with an
-		// ErrCannotForward and we simply fall back
-		statusCode, header, retBytes, err := core.ForwardRequest(r)
-		if err != nil {
-			if err == vault.ErrCannotForward {
-				core.Logger().Trace("http/handleRequestForwarding: cannot forward (possibly disabled on active node), falling back")
-			} else {
-				core.Logger().Error("http/handleRequestForwarding: error forwarding request", "error", err)
+		forwardRequest(core, w, r, handler)
+	})
+}
+
+// handlePerfStandbyReads serves read requests locally when this node is a
+// performance standby, and otherwise hands requests to
+// handleRequestForwarding. Reads that turn out to need the active node are
+// forwarded by request, and audited by the active node only. Reads served
+// locally may miss the writes made on the active node in the last 500ms or
+// so.
+func handlePerfStandbyReads(core *vault.Core, handler http.Handler) http.Handler {
+	forwardingHandler := handleRequestForwarding(core, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "LIST":
+			if core.PerfStandby() {
+				handler.ServeHTTP(w, r)
+				return
 			}
+		}
+		forwardingHandler.ServeHTTP(w, r)
+	})
+}
 
-			// Fall back to redirection
-			handler.ServeHTTP(w, r)
-			return
+// forwardRequest forwards a request to the active node and writes out its
+// response, falling back to the given handler if that fails
+func forwardRequest(core *vault.Core, w http.ResponseWriter, r *http.Request, fallback http.Handler) {
+	// Attempt forwarding the request. If we cannot forward -- perhaps it's
+	// been disabled on the active node -- this will return with an
+	// ErrCannotForward and we simply fall back
+	statusCode, header, retBytes, err := core.ForwardRequest(r)
+	if err != nil {
+		if err == vault.ErrCannotForward {
+			core.Logger().Trace("http/forwardRequest: cannot forward (possibly disabled on active node), falling back")
+		} else {
+			core.Logger().Error("http/forwardRequest: error forwarding request", "error", err)
 		}
 
-		if header != nil {
-			for k, v := range header {
-				for _, j := range v {
-					w.Header().Add(k, j)
-				}
+		// Fall back to redirection
+		fallback.ServeHTTP(w, r)
+		return
+	}
+
+	if header != nil {
+		for k, v := range header {
+			for _, j := range v {
+				w.Header().Add(k, j)
 			}
 		}
+	}
 
-		w.WriteHeader(statusCode)
-		w.Write(retBytes)
-		return
-	})
+	w.WriteHeader(statusCode)
+	w.Write(retBytes)
 }
 
 // request is a helper to perform a request and properly exit in the
 // case of an error.
 func request(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *logical.Request) (*logical.Response, bool) {
 	resp, err := core.HandleRequest(r)
+	return respondRequest(core, w, rawReq, r, resp, err)
+}
+
+// nodeRequest is like request for the paths about the node handling the
+// request, which standbys serve themselves
+func nodeRequest(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *logical.Request) (*logical.Response, bool) {
+	resp, err := core.HandleNodeRequest(r)
+	return respondRequest(core, w, rawReq, r, resp, err)
+}
+
+// respondRequest responds to the errors of a request, redirecting or
+// forwarding it if it must be handled by the active node. It returns false if
+// a response was written.
+func respondRequest(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *logical.Request, resp *logical.Response, err error) (*logical.Response, bool) {
 	if errwrap.Contains(err, consts.ErrStandby.Error()) {
 		respondStandby(core, w, rawReq.URL)
 		return resp, false
 	}
+	if err == vault.ErrPerfStandbyForward {
+		redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			respondStandby(core, w, r.URL)
+		})
+		if rawReq.Header.Get(NoRequestForwardingHeaderName) != "" {
+			redirect.ServeHTTP(w, rawReq)
+		} else {
+			forwardRequest(core, w, rawReq, redirect)
+		}
+		return resp, false
+	}
 	if respondErrorCommon(w, r, resp, err) {
 		return resp, false
 	}
@@ -262,26 +393,35 @@ func respondStandby(core *vault.Core, w http.ResponseWriter, reqURL *url.URL) {
 	w.WriteHeader(307)
 }
 
-// requestAuth adds the token to the logical.Request if it exists.
+// requestAuth adds the token to the logical.Request if it exists. It also
+// attaches the context of the HTTP request, so that storage calls made on
+// its behalf stop when the client goes away.
 func requestAuth(core *vault.Core, r *http.Request, req *logical.Request) *logical.Request {
+	req.SetContext(r.Context())
+
 	// Attach the header value if we have it
 	if v := r.Header.Get(AuthHeaderName); v != "" {
-		req.ClientToken = v
-
-		// Also attach the accessor if we have it. This doesn't fail if it
-		// doesn't exist because the request may be to an unauthenticated
-		// endpoint/login endpoint where a bad current token doesn't matter, or
-		// a token from a Vault version pre-accessors.
-		te, err := core.LookupToken(v)
-		if err == nil && te != nil {
-			req.ClientTokenAccessor = te.Accessor
-			req.ClientTokenRemainingUses = te.NumUses
-		}
+		requestAuthToken(core, req, v)
 	}
 
 	return req
 }
 
+// requestAuthToken sets the client token of the request
+func requestAuthToken(core *vault.Core, req *logical.Request, token string) {
+	req.ClientToken = token
+
+	// Also attach the accessor if we have it. This doesn't fail if it
+	// doesn't exist because the request may be to an unauthenticated
+	// endpoint/login endpoint where a bad current token doesn't matter, or
+	// a token from a Vault version pre-accessors.
+	te, err := core.LookupToken(token)
+	if err == nil && te != nil {
+		req.ClientTokenAccessor = te.Accessor
+		req.ClientTokenRemainingUses = te.NumUses
+	}
+}
+
 // requestWrapInfo adds the WrapInfo value to the logical.Request if wrap info exists
 func requestWrapInfo(r *http.Request, req *logical.Request) (*logical.Request, error) {
 	// First try for the header value
@@ -312,6 +452,31 @@ func requestWrapInfo(r *http.Request, req *logical.Request) (*logical.Request, e
 	return req, nil
 }
 
+// requestMFACreds adds the MFA credentials to the logical.Request if any
+// were supplied
+func requestMFACreds(r *http.Request, req *logical.Request) (*logical.Request, error) {
+	values := r.Header[http.CanonicalHeaderKey(MFAHeaderName)]
+	if len(values) == 0 {
+		return req, nil
+	}
+
+	req.MFACreds = make(logical.MFACreds, len(values))
+	for _, value := range values {
+		splitValue := strings.SplitN(value, ":", 2)
+		name := strings.TrimSpace(splitValue[0])
+		if name == "" {
+			return req, fmt.Errorf("missing MFA method name")
+		}
+		if len(splitValue) == 2 {
+			req.MFACreds[name] = append(req.MFACreds[name], splitValue[1])
+		} else if _, ok := req.MFACreds[name]; !ok {
+			req.MFACreds[name] = []string{}
+		}
+	}
+
+	return req, nil
+}
+
 func respondError(w http.ResponseWriter, status int, err error) {
 	logical.AdjustErrorStatusCode(&status, err)
 
@@ -297,6 +297,12 @@ func TestSysMounts_headerAuth_Wrapped(t *testing.T) {
 	}
 	expected["wrap_info"].(map[string]interface{})["token"] = actualToken
 
+	actualAccessor, ok := actual["wrap_info"].(map[string]interface{})["accessor"]
+	if !ok || actualAccessor == "" {
+		t.Fatal("accessor missing in wrap info")
+	}
+	expected["wrap_info"].(map[string]interface{})["accessor"] = actualAccessor
+
 	actualCreationTime, ok := actual["wrap_info"].(map[string]interface{})["creation_time"]
 	if !ok || actualCreationTime == "" {
 		t.Fatal("creation_time missing in wrap info")
@@ -358,3 +364,32 @@ func TestHandler_error(t *testing.T) {
 	}
 
 }
+
+func TestHandler_requestMFACreds(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://127.0.0.1/v1/secret/foo", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.Header.Add(MFAHeaderName, "my_totp:123456")
+	r.Header.Add(MFAHeaderName, "my_okta")
+	r.Header.Add(MFAHeaderName, "my_duo:passcode:with:colons")
+
+	req, err := requestMFACreds(r, &logical.Request{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := logical.MFACreds{
+		"my_totp": []string{"123456"},
+		"my_okta": []string{},
+		"my_duo":  []string{"passcode:with:colons"},
+	}
+	if !reflect.DeepEqual(req.MFACreds, expected) {
+		t.Fatalf("bad: %#v", req.MFACreds)
+	}
+
+	r.Header.Add(MFAHeaderName, ":123456")
+	if _, err := requestMFACreds(r, &logical.Request{}); err == nil {
+		t.Fatalf("expected error for missing method name")
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
@@ -17,6 +18,8 @@ import (
 type PrepareRequestFunc func(*vault.Core, *logical.Request) error
 
 func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Request) (*logical.Request, int, error) {
+	start := time.Now()
+
 	// Determine the path...
 	if !strings.HasPrefix(r.URL.Path, "/v1/") {
 		return nil, http.StatusNotFound, nil
@@ -86,6 +89,7 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 		Data:       data,
 		Connection: getConnection(r),
 		Headers:    r.Header,
+		StartTime:  start,
 	})
 
 	req, err = requestWrapInfo(r, req)
@@ -93,6 +97,11 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 		return nil, http.StatusBadRequest, errwrap.Wrapf("error parsing X-Vault-Wrap-TTL header: {{err}}", err)
 	}
 
+	req, err = requestMFACreds(r, req)
+	if err != nil {
+		return nil, http.StatusBadRequest, errwrap.Wrapf("error parsing X-Vault-MFA header: {{err}}", err)
+	}
+
 	return req, 0, nil
 }
 
@@ -114,6 +123,12 @@ func handleLogical(core *vault.Core, injectDataIntoTopLevel bool, prepareRequest
 			}
 		}
 
+		// Reject the request before doing any work if it exceeds a rate
+		// limit quota
+		if !applyRateLimitQuota(core, w, req) {
+			return
+		}
+
 		// Make the internal request. We attach the connection info
 		// as well in case this is an authentication request that requires
 		// it. Vault core handles stripping this if we need to. This also
@@ -129,6 +144,27 @@ func handleLogical(core *vault.Core, injectDataIntoTopLevel bool, prepareRequest
 	})
 }
 
+// applyRateLimitQuota applies the rate limit quota matching the request,
+// sets the rate limit headers and responds with a 429 if the request must be
+// rejected. It returns false if the request was rejected.
+func applyRateLimitQuota(core *vault.Core, w http.ResponseWriter, req *logical.Request) bool {
+	result := core.ApplyRateLimitQuota(req.Path)
+	if result == nil {
+		return true
+	}
+
+	w.Header().Set("X-Ratelimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-Ratelimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-Ratelimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+	if result.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+	respondError(w, http.StatusTooManyRequests, vault.ErrRateLimitQuotaExceeded)
+	return false
+}
+
 func respondLogical(w http.ResponseWriter, r *http.Request, req *logical.Request, injectDataIntoTopLevel bool, resp *logical.Response) {
 	var httpResp *logical.HTTPResponse
 	var ret interface{}
@@ -151,6 +187,7 @@ func respondLogical(w http.ResponseWriter, r *http.Request, req *logical.Request
 			httpResp = &logical.HTTPResponse{
 				WrapInfo: &logical.HTTPWrapInfo{
 					Token:           resp.WrapInfo.Token,
+					Accessor:        resp.WrapInfo.Accessor,
 					TTL:             int(resp.WrapInfo.TTL.Seconds()),
 					CreationTime:    resp.WrapInfo.CreationTime.Format(time.RFC3339Nano),
 					CreationPath:    resp.WrapInfo.CreationPath,
@@ -251,14 +288,19 @@ func respondRaw(w http.ResponseWriter, r *http.Request, resp *logical.Response)
 // attaching to a logical request
 func getConnection(r *http.Request) (connection *logical.Connection) {
 	var remoteAddr string
+	var remotePort int
 
-	remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	remoteAddr, port, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		remoteAddr = ""
+	} else {
+		remotePort, _ = strconv.Atoi(port)
 	}
 
 	connection = &logical.Connection{
 		RemoteAddr: remoteAddr,
+		RemotePort: remotePort,
+		UserAgent:  r.UserAgent(),
 		ConnState:  r.TLS,
 	}
 	return
@@ -158,6 +158,7 @@ func TestLogical_StandbyRedirect(t *testing.T) {
 			"explicit_max_ttl": json.Number("0"),
 			"expire_time":      nil,
 			"entity_id":        "",
+			"type":             "service",
 		},
 		"warnings":  nilWarnings,
 		"wrap_info": nil,
@@ -300,3 +301,62 @@ func TestLogical_ListSuffix(t *testing.T) {
 		t.Fatal("trailing slash not found on path")
 	}
 }
+
+func TestLogical_RateLimitQuota(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/secret", map[string]interface{}{
+		"path":     "secret/",
+		"rate":     2,
+		"interval": "1h",
+	})
+	testResponseStatus(t, resp, 204)
+
+	for i := 0; i < 2; i++ {
+		resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+		testResponseStatus(t, resp, 404)
+		if resp.Header.Get("X-Ratelimit-Limit") != "2" {
+			t.Fatalf("bad: %#v", resp.Header)
+		}
+		if resp.Header.Get("X-Ratelimit-Remaining") != strconv.Itoa(1-i) {
+			t.Fatalf("bad: %#v", resp.Header)
+		}
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 429)
+	if retry, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retry <= 0 {
+		t.Fatalf("bad: %#v", resp.Header)
+	}
+
+	// Requests outside of the quota and to sys paths are not limited
+	resp = testHttpGet(t, token, addr+"/v1/cubbyhole/foo")
+	testResponseStatus(t, resp, 404)
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/rate-limit/secret")
+	testResponseStatus(t, resp, 200)
+	if resp.Header.Get("X-Ratelimit-Limit") != "" {
+		t.Fatalf("bad: %#v", resp.Header)
+	}
+}
+
+func TestLogical_LeaseCountQuota(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/lease-count/tokens", map[string]interface{}{
+		"path":       "auth/token/create",
+		"max_leases": 1,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", nil)
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", nil)
+	testResponseStatus(t, resp, 429)
+}
@@ -73,6 +73,10 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 	// Check if being a standby is allowed for the purpose of a 200 OK
 	_, standbyOK := r.URL.Query()["standbyok"]
 
+	// Check if being a performance standby is allowed for the purpose of a
+	// 200 OK
+	_, perfStandbyOK := r.URL.Query()["perfstandbyok"]
+
 	uninitCode := http.StatusNotImplemented
 	if code, found, ok := fetchStatusCode(r, "uninitcode"); !ok {
 		return http.StatusBadRequest, nil, nil
@@ -104,6 +108,7 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 	// Check system status
 	sealed, _ := core.Sealed()
 	standby, _ := core.Standby()
+	perfStandby := core.PerfStandby()
 	init, err := core.Initialized()
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
@@ -116,7 +121,7 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 		code = uninitCode
 	case sealed:
 		code = sealedCode
-	case !standbyOK && standby:
+	case !standbyOK && standby && !(perfStandbyOK && perfStandby):
 		code = standbyCode
 	}
 
@@ -136,23 +141,25 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 
 	// Format the body
 	body := &HealthResponse{
-		Initialized:   init,
-		Sealed:        sealed,
-		Standby:       standby,
-		ServerTimeUTC: time.Now().UTC().Unix(),
-		Version:       version.GetVersion().VersionNumber(),
-		ClusterName:   clusterName,
-		ClusterID:     clusterID,
+		Initialized:        init,
+		Sealed:             sealed,
+		Standby:            standby,
+		PerformanceStandby: perfStandby,
+		ServerTimeUTC:      time.Now().UTC().Unix(),
+		Version:            version.GetVersion().VersionNumber(),
+		ClusterName:        clusterName,
+		ClusterID:          clusterID,
 	}
 	return code, body, nil
 }
 
 type HealthResponse struct {
-	Initialized   bool   `json:"initialized"`
-	Sealed        bool   `json:"sealed"`
-	Standby       bool   `json:"standby"`
-	ServerTimeUTC int64  `json:"server_time_utc"`
-	Version       string `json:"version"`
-	ClusterName   string `json:"cluster_name,omitempty"`
-	ClusterID     string `json:"cluster_id,omitempty"`
+	Initialized        bool   `json:"initialized"`
+	Sealed             bool   `json:"sealed"`
+	Standby            bool   `json:"standby"`
+	PerformanceStandby bool   `json:"performance_standby,omitempty"`
+	ServerTimeUTC      int64  `json:"server_time_utc"`
+	Version            string `json:"version"`
+	ClusterName        string `json:"cluster_name,omitempty"`
+	ClusterID          string `json:"cluster_id,omitempty"`
 }
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysInFlightRequests(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	// The listing includes the request itself
+	resp := testHttpGet(t, token, addr+"/v1/sys/in-flight-req")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	reqs := actual["data"].(map[string]interface{})
+	if len(reqs) != 1 {
+		t.Fatalf("bad: %#v", reqs)
+	}
+	for _, v := range reqs {
+		req := v.(map[string]interface{})
+		if req["method"] != "GET" || req["path"] != "/v1/sys/in-flight-req" || req["client_remote_address"] == "" {
+			t.Fatalf("bad: %#v", req)
+		}
+	}
+
+	// Finished requests are no longer listed
+	if reqs := core.InFlightRequests(); len(reqs) != 0 {
+		t.Fatalf("bad: %#v", reqs)
+	}
+
+	// New requests are rejected while draining
+	if remaining := core.DrainRequests(time.Second); remaining != 0 {
+		t.Fatalf("bad: %d", remaining)
+	}
+	resp = testHttpGet(t, token, addr+"/v1/sys/in-flight-req")
+	testResponseStatus(t, resp, 503)
+
+	core.ResumeRequests()
+	resp = testHttpGet(t, token, addr+"/v1/sys/in-flight-req")
+	testResponseStatus(t, resp, 200)
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleSysMetrics serves sys/metrics through the system backend so that the
+// token of the request is checked. The format is taken from the query
+// string, which is not otherwise passed along for reads, and the token may
+// also be given in an Authorization header.
+func handleSysMetrics(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		req, statusCode, err := buildLogicalRequest(core, w, r)
+		if err != nil || statusCode != 0 {
+			respondError(w, statusCode, err)
+			return
+		}
+		req.Data = map[string]interface{}{
+			"format": r.URL.Query().Get("format"),
+		}
+
+		// Prometheus can only send a token as a bearer token
+		if req.ClientToken == "" {
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				requestAuthToken(core, req, strings.TrimSpace(auth[len("Bearer "):]))
+			}
+		}
+
+		if !applyRateLimitQuota(core, w, req) {
+			return
+		}
+
+		resp, ok := request(core, w, r, req)
+		if !ok {
+			return
+		}
+		respondLogical(w, r, req, false, resp)
+	})
+}
+
+// handleMetricsUnauthenticated serves the metrics of this node without
+// requiring a token, for listeners that allow it. As no request is made to
+// the core, this works on sealed and standby nodes as well.
+func handleMetricsUnauthenticated(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		metricsHelper := core.MetricsHelper()
+		if metricsHelper == nil {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("metrics are not enabled on this server"))
+			return
+		}
+
+		resp, err := metricsHelper.ResponseForFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondRaw(w, r, resp)
+	})
+}
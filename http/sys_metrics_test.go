@@ -0,0 +1,114 @@
+package http
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/vault"
+)
+
+func testMetricsHelper() *metricsutil.MetricsHelper {
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	inm.SetGauge([]string{"vault", "core", "unsealed"}, 1)
+	prometheus := metricsutil.NewPrometheusSink(time.Minute)
+	prometheus.SetGauge([]string{"vault", "core", "unsealed"}, 1)
+	return metricsutil.NewMetricsHelper(inm, prometheus)
+}
+
+func testMetricsServer(t *testing.T, core *vault.Core, unauthenticated bool) (net.Listener, string) {
+	ln, addr := TestListener(t)
+	server := &http.Server{
+		Handler: HandlerWithProperties(&HandlerProperties{
+			Core:                         core,
+			UnauthenticatedMetricsAccess: unauthenticated,
+		}),
+	}
+	go server.Serve(ln)
+	return ln, addr
+}
+
+func TestSysMetrics(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealedWithMetrics(t, testMetricsHelper())
+	ln, addr := testMetricsServer(t, core, false)
+	defer ln.Close()
+
+	// A token is required
+	resp := testHttpGet(t, "", addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("bad: %s", ct)
+	}
+	var summary metrics.MetricsSummary
+	testResponseBody(t, resp, &summary)
+	if len(summary.Gauges) != 1 || summary.Gauges[0].Name != "vault.core.unsealed" {
+		t.Fatalf("bad: %#v", summary)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/metrics?format=prometheus")
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != metricsutil.PrometheusContentType {
+		t.Fatalf("bad: %s", ct)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(body) != "# TYPE vault_core_unsealed gauge\nvault_core_unsealed 1\n" {
+		t.Fatalf("bad: %q", body)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/metrics?format=xml")
+	testResponseStatus(t, resp, 400)
+
+	// The token can be given as a bearer token
+	req, err := http.NewRequest("GET", addr+"/v1/sys/metrics?format=prometheus", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testResponseStatus(t, resp, 200)
+	resp.Body.Close()
+}
+
+func TestSysMetrics_Unauthenticated(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealedWithMetrics(t, testMetricsHelper())
+	ln, addr := testMetricsServer(t, core, true)
+	defer ln.Close()
+
+	resp := testHttpGet(t, "", addr+"/v1/sys/metrics?format=prometheus")
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != metricsutil.PrometheusContentType {
+		t.Fatalf("bad: %s", ct)
+	}
+	resp.Body.Close()
+
+	// Still available once sealed
+	if err := core.Seal(token); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp = testHttpGet(t, "", addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 200)
+	resp.Body.Close()
+}
+
+func TestSysMetrics_NotEnabled(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp := testHttpGet(t, token, addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 400)
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/vault"
+)
+
+// monitorBufferSize is the number of log lines buffered for each client of
+// sys/monitor; lines that do not fit are dropped
+const monitorBufferSize = 512
+
+// handleSysMonitor streams the logs of this node. The request goes through
+// the system backend first so that the token, the policies and the audit
+// devices see it like any other, and the logs are then streamed until the
+// client goes away. Streams are served by standbys too since the logs are
+// those of the node the client is connected to.
+func handleSysMonitor(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		req, statusCode, err := buildLogicalRequest(core, w, r)
+		if err != nil || statusCode != 0 {
+			respondError(w, statusCode, err)
+			return
+		}
+		query := r.URL.Query()
+		req.Data = map[string]interface{}{}
+		for _, key := range []string{"log_level", "log_format"} {
+			if value := query.Get(key); value != "" {
+				req.Data[key] = value
+			}
+		}
+
+		resp, ok := nodeRequest(core, w, r, req)
+		if !ok {
+			return
+		}
+
+		logger, ok := core.Logger().(*logformat.ControlledLogger)
+		if !ok {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("the logger of this server does not support streaming"))
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+			return
+		}
+
+		// The system backend has validated the parameters already
+		level, _ := logformat.ParseLevel(resp.Data["log_level"].(string))
+		jsonFormat := resp.Data["log_format"].(string) == "json"
+
+		m := logger.Monitor(level, jsonFormat, monitorBufferSize)
+		defer m.Stop()
+
+		// Streams last as long as the client wants, so draining does not
+		// wait for them
+		core.MarkInFlightRequestStreaming(inFlightRequestID(r))
+
+		if jsonFormat {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case line, ok := <-m.C():
+				if !ok {
+					return
+				}
+				if _, err := w.Write(line); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
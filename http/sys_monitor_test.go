@@ -0,0 +1,69 @@
+package http
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/vault"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestSysMonitor(t *testing.T) {
+	logger := logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo)
+	core, _, token := vault.TestCoreUnsealedWithLogger(t, logger)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	// A token is required
+	resp := testHttpGet(t, "", addr+"/v1/sys/monitor")
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/monitor?log_level=debug&log_format=json")
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("bad: %s", ct)
+	}
+	if !logger.IsDebug() {
+		t.Fatal("debug should be enabled while monitored")
+	}
+
+	logger.Debug("core: for the monitor")
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	timeout := time.After(5 * time.Second)
+	for found := false; !found; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed")
+			}
+			found = strings.Contains(line, `"@message":"core: for the monitor"`)
+		case <-timeout:
+			t.Fatal("timed out waiting for the log line")
+		}
+	}
+
+	// The monitor goes away with the client
+	resp.Body.Close()
+	for range lines {
+	}
+	for deadline := time.Now().Add(5 * time.Second); logger.IsDebug(); {
+		if time.Now().After(deadline) {
+			t.Fatal("monitor was not stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/monitor?log_level=verbose")
+	testResponseStatus(t, resp, 400)
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleSysNode serves the sys paths that report on or control the node the
+// client is connected to, such as its log levels. Requests are neither
+// forwarded nor redirected: standbys check the token themselves and serve
+// them.
+func handleSysNode(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, statusCode, err := buildLogicalRequest(core, w, r)
+		if err != nil || statusCode != 0 {
+			respondError(w, statusCode, err)
+			return
+		}
+
+		resp, ok := nodeRequest(core, w, r, req)
+		if !ok {
+			return
+		}
+		respondLogical(w, r, req, false, resp)
+	})
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/vault"
+	log "github.com/mgutz/logxi/v1"
+	"golang.org/x/net/http2"
+)
+
+func TestSysNode_Standby(t *testing.T) {
+	logger := logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo)
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		Logger: logger,
+	}, &vault.TestClusterOptions{
+		HandlerFunc: Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	cores := cluster.Cores
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	transport := &http.Transport{
+		TLSClientConfig: cores[1].TLSConfig,
+	}
+	if err := http2.ConfigureTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	addr := fmt.Sprintf("https://127.0.0.1:%d", cores[1].Listeners[0].Address.Port)
+	get := func(path string) *http.Response {
+		req, err := http.NewRequest("GET", addr+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(AuthHeaderName, cluster.RootToken)
+		req.Header.Set(NoRequestForwardingHeaderName, "true")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// The standby serves the node paths itself even when it may not forward
+	resp := get("/v1/sys/loggers")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	if data, ok := actual["data"].(map[string]interface{}); !ok || data["level"] != "info" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	resp = get("/v1/sys/monitor")
+	testResponseStatus(t, resp, 200)
+	resp.Body.Close()
+
+	for _, path := range []string{"/v1/sys/host-info", "/v1/sys/in-flight-req", "/v1/sys/config/state/sanitized", "/v1/sys/pprof/goroutine"} {
+		resp = get(path)
+		testResponseStatus(t, resp, 200)
+		resp.Body.Close()
+	}
+
+	// Other requests are still redirected
+	resp = get("/v1/sys/mounts")
+	testResponseStatus(t, resp, 307)
+	resp.Body.Close()
+}
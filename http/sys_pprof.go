@@ -0,0 +1,57 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleSysPprof serves the runtime profiles under sys/pprof through the
+// system backend so that the token of the request is checked. The options of
+// net/http/pprof are taken from the query string, which is not otherwise
+// passed along for reads. Requests are neither forwarded nor redirected since
+// the profiles are those of the node the client is connected to. The CPU
+// profile and the execution trace are collected once the request is done so
+// that the node is not held up while they run.
+func handleSysPprof(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		req, statusCode, err := buildLogicalRequest(core, w, r)
+		if err != nil || statusCode != 0 {
+			respondError(w, statusCode, err)
+			return
+		}
+		query := r.URL.Query()
+		req.Data = map[string]interface{}{}
+		for _, key := range []string{"seconds", "debug"} {
+			if value := query.Get(key); value != "" {
+				req.Data[key] = value
+			}
+		}
+
+		resp, ok := nodeRequest(core, w, r, req)
+		if !ok {
+			return
+		}
+
+		// The system backend has validated the parameters already
+		if seconds, ok := resp.Data["seconds"].(int); ok {
+			body, err := vault.Profile(r.Context(), resp.Data["name"].(string), seconds)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err)
+				return
+			}
+			resp.Data = map[string]interface{}{
+				logical.HTTPContentType: "application/octet-stream",
+				logical.HTTPRawBody:     body,
+				logical.HTTPStatusCode:  http.StatusOK,
+			}
+		}
+		respondLogical(w, r, req, false, resp)
+	})
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysPprof(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	// A token is required
+	resp := testHttpGet(t, "", addr+"/v1/sys/pprof/goroutine")
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/pprof/goroutine?debug=2")
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Fatalf("bad: %s", ct)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(string(body), "goroutine ") {
+		t.Fatalf("bad: %s", body)
+	}
+
+	// Profiles are gzipped protobufs by default
+	resp = testHttpGet(t, token, addr+"/v1/sys/pprof/heap")
+	testResponseStatus(t, resp, 200)
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		t.Fatalf("bad: %q", body)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/pprof/")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	if _, ok := actual["data"].(map[string]interface{})["profiles"]; !ok {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The CPU profile is collected once the request is done
+	resp = testHttpGet(t, token, addr+"/v1/sys/pprof/profile?seconds=1")
+	testResponseStatus(t, resp, 200)
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		t.Fatalf("bad: %q", body)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/pprof/profile?seconds=61")
+	testResponseStatus(t, resp, 400)
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func handleSysStorageSnapshot(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleSysStorageSnapshotSave(core, w, r)
+		case "PUT", "POST":
+			handleSysStorageSnapshotRestore(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, nil)
+		}
+	})
+}
+
+func handleSysStorageSnapshotSave(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	req, statusCode, err := buildLogicalRequest(core, w, r)
+	if err != nil || statusCode != 0 {
+		respondError(w, statusCode, err)
+		return
+	}
+
+	// The archive is only written once the snapshot has been taken, so
+	// errors can still be reported with a status code
+	w.Header().Set("Content-Type", "application/gzip")
+	if err := core.SaveSnapshot(req, w); err != nil {
+		w.Header().Del("Content-Type")
+		respondSnapshotError(w, err)
+	}
+}
+
+func handleSysStorageSnapshotRestore(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	// The body is the snapshot archive rather than JSON, so the request is
+	// not built by buildLogicalRequest
+	requestID, err := uuid.GenerateUUID()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errwrap.Wrapf("failed to generate identifier for the request: {{err}}", err))
+		return
+	}
+	req := requestAuth(core, r, &logical.Request{
+		ID:         requestID,
+		Operation:  logical.UpdateOperation,
+		Path:       r.URL.Path[len("/v1/"):],
+		Connection: getConnection(r),
+		Headers:    r.Header,
+		StartTime:  time.Now(),
+	})
+
+	var force bool
+	if forceStr := r.URL.Query().Get("force"); forceStr != "" {
+		force, err = strconv.ParseBool(forceStr)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errwrap.Wrapf("invalid force parameter: {{err}}", err))
+			return
+		}
+	}
+
+	if err := core.RestoreSnapshot(req, r.Body, force); err != nil {
+		respondSnapshotError(w, err)
+		return
+	}
+
+	respondOk(w, nil)
+}
+
+func respondSnapshotError(w http.ResponseWriter, err error) {
+	if errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		respondError(w, http.StatusForbidden, err)
+		return
+	}
+	respondError(w, http.StatusInternalServerError, err)
+}
@@ -59,6 +59,10 @@ type Auth struct {
 	// Alias is the information about the authenticated client returned by
 	// the auth backend
 	Alias *Alias `json:"alias" structs:"alias" mapstructure:"alias"`
+
+	// TokenType is the type of token to issue, typically taken from the
+	// role of the auth backend. The default results in a service token.
+	TokenType TokenType `json:"token_type" mapstructure:"token_type" structs:"token_type"`
 }
 
 func (a *Auth) GoString() string {
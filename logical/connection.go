@@ -10,6 +10,12 @@ type Connection struct {
 	// RemoteAddr is the network address that sent the request.
 	RemoteAddr string `json:"remote_addr"`
 
+	// RemotePort is the port number that sent the request.
+	RemotePort int `json:"remote_port"`
+
+	// UserAgent is the user agent the client identified itself with.
+	UserAgent string `json:"user_agent"`
+
 	// ConnState is the TLS connection state if applicable.
 	ConnState *tls.ConnectionState
 }
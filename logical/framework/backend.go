@@ -344,6 +344,12 @@ func (b *Backend) Route(path string) *Path {
 	return result
 }
 
+// GeneratesLeases returns whether the backend may return leased secrets,
+// which is the case if it has any secret types.
+func (b *Backend) GeneratesLeases() bool {
+	return len(b.Secrets) > 0
+}
+
 // Secret is used to look up the secret with the given type.
 func (b *Backend) Secret(k string) *Secret {
 	for _, s := range b.Secrets {
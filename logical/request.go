@@ -1,6 +1,7 @@
 package logical
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -18,6 +19,10 @@ type RequestWrapInfo struct {
 	Format string `json:"format" structs:"format" mapstructure:"format"`
 }
 
+// MFACreds holds the credentials supplied for MFA methods, keyed by the
+// method name. Push based methods may be given without any credentials.
+type MFACreds map[string][]string
+
 // Request is a struct that stores the parameters and context
 // of a request being made to Vault. It is used to abstract
 // the details of the higher level request protocol from the handlers.
@@ -102,9 +107,22 @@ type Request struct {
 	// to make this request
 	EntityID string `json:"entity_id" structs:"entity_id" mapstructure:"entity_id"`
 
+	// MFACreds holds the credentials supplied for MFA methods, keyed by the
+	// method name
+	MFACreds MFACreds `json:"mfa_creds" structs:"mfa_creds" mapstructure:"mfa_creds"`
+
+	// StartTime is the time the request was received, used to report how
+	// long it took in the audit log. If not set, the core sets it when it
+	// starts handling the request.
+	StartTime time.Time `json:"-" structs:"-" mapstructure:"-"`
+
 	// For replication, contains the last WAL on the remote side after handling
 	// the request, used for best-effort avoidance of stale read-after-write
 	lastRemoteWAL uint64
+
+	// ctx is the context of the client request, used to cancel the storage
+	// calls made on its behalf
+	ctx context.Context
 }
 
 // Get returns a data field and guards for nil Data
@@ -134,6 +152,19 @@ func (r *Request) SetLastRemoteWAL(last uint64) {
 	r.lastRemoteWAL = last
 }
 
+// Context returns the context of the request. If none was set, the
+// background context is returned.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 // RenewRequest creates the structure of the renew request.
 func RenewRequest(
 	path string, secret *Secret, data map[string]interface{}) *Request {
@@ -210,4 +241,8 @@ var (
 
 	// ErrPermissionDenied is returned if the client is not authorized
 	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrLeaseCountQuotaExceeded is returned if a request would create a
+	// lease beyond the maximum allowed by a lease count quota
+	ErrLeaseCountQuotaExceeded = errors.New("lease count quota exceeded")
 )
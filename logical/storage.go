@@ -3,6 +3,7 @@ package logical
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/vault/helper/jsonutil"
@@ -14,6 +15,10 @@ import (
 var ErrReadOnly = errors.New("Cannot write to readonly storage")
 
 // Storage is the way that logical backends are able read/write data.
+// Its methods take no context. The router binds the context of the request
+// to the storage view it passes to backends, so storage calls made while
+// serving a request are cancelled with it, while calls made through other
+// storage, such as in background goroutines, are not.
 type Storage interface {
 	List(prefix string) ([]string, error)
 	Get(string) (*StorageEntry, error)
@@ -21,6 +26,41 @@ type Storage interface {
 	Delete(string) error
 }
 
+// PaginatedStorage is an optional interface for storage that can list the
+// keys under a prefix a page at a time. Backends with large numbers of
+// entries should use ListPage rather than List.
+type PaginatedStorage interface {
+	// ListPage returns, in lexical order, up to limit of the keys that List
+	// would return for the prefix and that sort after the given key. An
+	// empty after starts at the first key, and a limit of zero or less
+	// returns all remaining keys.
+	ListPage(prefix, after string, limit int) ([]string, error)
+}
+
+// ListPage returns a page of the keys under the prefix, as described by
+// PaginatedStorage. Storage that is not paginated lists all keys and
+// returns the requested page of them.
+func ListPage(s Storage, prefix, after string, limit int) ([]string, error) {
+	if p, ok := s.(PaginatedStorage); ok {
+		return p.ListPage(prefix, after, limit)
+	}
+
+	keys, err := s.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	start := sort.SearchStrings(keys, after)
+	if start < len(keys) && keys[start] == after {
+		start++
+	}
+	keys = keys[start:]
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
 // StorageEntry is the entry for an item in a Storage implementation.
 type StorageEntry struct {
 	Key   string
@@ -50,28 +90,49 @@ type ClearableView interface {
 	Delete(string) error
 }
 
-// ScanView is used to scan all the keys in a view iteratively
+// scanPageSize is the number of keys ScanView lists at once from views
+// that support paginated listing
+const scanPageSize = 1000
+
+// ScanView is used to scan all the keys in a view iteratively. Views that
+// implement PaginatedStorage are listed a page at a time.
 func ScanView(view ClearableView, cb func(path string)) error {
+	paginated, isPaginated := view.(PaginatedStorage)
+
 	frontier := []string{""}
 	for len(frontier) > 0 {
 		n := len(frontier)
 		current := frontier[n-1]
 		frontier = frontier[:n-1]
 
-		// List the contents
-		contents, err := view.List(current)
-		if err != nil {
-			return fmt.Errorf("list failed at path '%s': %v", current, err)
-		}
-
-		// Handle the contents in the directory
-		for _, c := range contents {
-			fullPath := current + c
-			if strings.HasSuffix(c, "/") {
-				frontier = append(frontier, fullPath)
+		var after string
+		for {
+			// List the contents
+			var contents []string
+			var err error
+			if isPaginated {
+				contents, err = paginated.ListPage(current, after, scanPageSize)
 			} else {
-				cb(fullPath)
+				contents, err = view.List(current)
+			}
+			if err != nil {
+				return fmt.Errorf("list failed at path '%s': %v", current, err)
+			}
+
+			// Handle the contents in the directory
+			for _, c := range contents {
+				fullPath := current + c
+				if strings.HasSuffix(c, "/") {
+					frontier = append(frontier, fullPath)
+				} else {
+					cb(fullPath)
+				}
+			}
+
+			if !isPaginated || len(contents) < scanPageSize {
+				break
 			}
+			after = contents[len(contents)-1]
 		}
 	}
 	return nil
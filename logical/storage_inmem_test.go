@@ -1,9 +1,35 @@
 package logical
 
 import (
+	"reflect"
 	"testing"
 )
 
 func TestInmemStorage(t *testing.T) {
 	TestStorage(t, new(InmemStorage))
 }
+
+func TestInmemStorage_ListPage(t *testing.T) {
+	s := new(InmemStorage)
+	for _, key := range []string{"foo/c", "foo/a", "foo/d/e", "foo/b", "bar"} {
+		if err := s.Put(&StorageEntry{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := ListPage(s, "foo/", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	keys, err = ListPage(s, "foo/", "b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"c", "d/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+}
@@ -0,0 +1,68 @@
+package logical
+
+import "fmt"
+
+// TokenType is the type of a token, which determines how it is stored and
+// what it can be used for
+type TokenType string
+
+const (
+	// TokenTypeDefault leaves the choice of the token type to the
+	// configuration further up, which ends up being a service token
+	TokenTypeDefault TokenType = ""
+
+	// TokenTypeService is a token that is persisted in storage, can be
+	// renewed and revoked, and can create child tokens
+	TokenTypeService TokenType = "service"
+
+	// TokenTypeBatch is an encrypted, self-contained token that is not
+	// persisted. It cannot be renewed or revoked, has no accessor and cannot
+	// create child tokens.
+	TokenTypeBatch TokenType = "batch"
+
+	// TokenTypeDefaultService is used in roles to issue service tokens
+	// unless the login or creation request asks for another type
+	TokenTypeDefaultService TokenType = "default-service"
+
+	// TokenTypeDefaultBatch is used in roles to issue batch tokens unless
+	// the login or creation request asks for another type
+	TokenTypeDefaultBatch TokenType = "default-batch"
+)
+
+// ParseTokenType parses the string representation of a token type
+func ParseTokenType(s string) (TokenType, error) {
+	switch t := TokenType(s); t {
+	case TokenTypeDefault, TokenTypeService, TokenTypeBatch, TokenTypeDefaultService, TokenTypeDefaultBatch:
+		return t, nil
+	case "default":
+		return TokenTypeDefault, nil
+	default:
+		return TokenTypeDefault, fmt.Errorf("invalid token type %q", s)
+	}
+}
+
+// Resolve returns the token type to issue when t is configured and the
+// request asks for requested. Types prefixed with "default-" can be
+// overridden by the request, other types cannot.
+func (t TokenType) Resolve(requested TokenType) (TokenType, error) {
+	switch t {
+	case TokenTypeService, TokenTypeBatch:
+		if requested != TokenTypeDefault && requested != t {
+			return TokenTypeDefault, fmt.Errorf("%s tokens cannot be requested, only %s tokens are allowed", requested, t)
+		}
+		return t, nil
+	}
+
+	switch requested {
+	case TokenTypeService, TokenTypeBatch:
+		return requested, nil
+	case TokenTypeDefault:
+	default:
+		return TokenTypeDefault, fmt.Errorf("invalid requested token type %q", requested)
+	}
+
+	if t == TokenTypeDefaultBatch {
+		return TokenTypeBatch, nil
+	}
+	return TokenTypeService, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/command/token"
+	"github.com/hashicorp/vault/helper/flag-slice"
 	"github.com/mitchellh/cli"
 )
 
@@ -34,6 +35,11 @@ var (
                           "s", "m", or "h"; if no suffix is specified it will
                           be parsed as seconds. May also be specified via
                           VAULT_WRAP_TTL.
+
+  -mfa=""                 Credentials of an MFA method required by the request,
+                          in the form "method_name[:passcode]". Push based
+                          methods only need the method name. May be specified
+                          multiple times.
 `
 	}
 )
@@ -54,6 +60,7 @@ type Meta struct {
 	flagClientCert string
 	flagClientKey  string
 	flagWrapTTL    string
+	flagMFA        []string
 	flagInsecure   bool
 
 	// Queried if no token can be found
@@ -105,6 +112,10 @@ func (m *Meta) Client() (*api.Client, error) {
 
 	client.SetWrappingLookupFunc(m.DefaultWrappingLookupFunc)
 
+	if len(m.flagMFA) > 0 {
+		client.SetMFACreds(m.flagMFA)
+	}
+
 	// If we have a token directly, then set that
 	token := m.ClientToken
 
@@ -152,6 +163,7 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 		f.StringVar(&m.flagClientCert, "client-cert", "", "")
 		f.StringVar(&m.flagClientKey, "client-key", "", "")
 		f.StringVar(&m.flagWrapTTL, "wrap-ttl", "", "")
+		f.Var((*sliceflag.StringFlag)(&m.flagMFA), "mfa", "")
 		f.BoolVar(&m.flagInsecure, "insecure", false, "")
 		f.BoolVar(&m.flagInsecure, "tls-skip-verify", false, "")
 	}
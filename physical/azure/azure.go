@@ -1,9 +1,12 @@
 package azure
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"sort"
 	"strconv"
@@ -29,6 +32,7 @@ type AzureBackend struct {
 	container  *storage.Container
 	logger     log.Logger
 	permitPool *physical.PermitPool
+	haEnabled  bool
 }
 
 // NewAzureBackend constructs an Azure backend using a pre-existing
@@ -86,16 +90,25 @@ func NewAzureBackend(conf map[string]string, logger log.Logger) (physical.Backen
 		}
 	}
 
+	var haEnabled bool
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
 	a := &AzureBackend{
 		container:  container,
 		logger:     logger,
 		permitPool: physical.NewPermitPool(maxParInt),
+		haEnabled:  haEnabled,
 	}
 	return a, nil
 }
 
 // Put is used to insert or update an entry
-func (a *AzureBackend) Put(entry *physical.Entry) error {
+func (a *AzureBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"azure", "put"}, time.Now())
 
 	if len(entry.Value) >= MaxBlobSize {
@@ -121,7 +134,7 @@ func (a *AzureBackend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch an entry
-func (a *AzureBackend) Get(key string) (*physical.Entry, error) {
+func (a *AzureBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"azure", "get"}, time.Now())
 
 	a.permitPool.Acquire()
@@ -155,7 +168,7 @@ func (a *AzureBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (a *AzureBackend) Delete(key string) error {
+func (a *AzureBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"azure", "delete"}, time.Now())
 
 	blob := &storage.Blob{
@@ -172,7 +185,7 @@ func (a *AzureBackend) Delete(key string) error {
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (a *AzureBackend) List(prefix string) ([]string, error) {
+func (a *AzureBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"azure", "list"}, time.Now())
 
 	a.permitPool.Acquire()
@@ -197,3 +210,103 @@ func (a *AzureBackend) List(prefix string) ([]string, error) {
 	sort.Strings(keys)
 	return keys, nil
 }
+
+// GetVersion is used to fetch an entry along with its ETag
+func (a *AzureBackend) GetVersion(ctx context.Context, key string) (*physical.Entry, string, error) {
+	defer metrics.MeasureSince([]string{"azure", "get-version"}, time.Now())
+
+	a.permitPool.Acquire()
+	defer a.permitPool.Release()
+
+	blob := &storage.Blob{
+		Container: a.container,
+		Name:      key,
+	}
+	reader, err := blob.Get(nil)
+	if storageErr, ok := err.(storage.AzureStorageServiceError); ok && storageErr.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ent := &physical.Entry{
+		Key:   key,
+		Value: data,
+	}
+	return ent, blob.Properties.Etag, nil
+}
+
+// PutIfVersion is used to insert or update an entry only if its ETag
+// matches the given one
+func (a *AzureBackend) PutIfVersion(ctx context.Context, entry *physical.Entry, version string) error {
+	defer metrics.MeasureSince([]string{"azure", "put-if-version"}, time.Now())
+
+	if len(entry.Value) >= MaxBlobSize {
+		return fmt.Errorf("value is bigger than the current supported limit of 4MBytes")
+	}
+
+	a.permitPool.Acquire()
+	defer a.permitPool.Release()
+
+	options := &storage.PutBlobOptions{}
+	if version == "" {
+		options.IfNoneMatch = "*"
+	} else {
+		options.IfMatch = version
+	}
+
+	blob := &storage.Blob{
+		Container: a.container,
+		Name:      entry.Key,
+	}
+	err := blob.CreateBlockBlobFromReader(bytes.NewReader(entry.Value), options)
+	return conditionError(err)
+}
+
+// DeleteIfVersion is used to permanently delete an entry only if its ETag
+// matches the given one
+func (a *AzureBackend) DeleteIfVersion(ctx context.Context, key, version string) error {
+	defer metrics.MeasureSince([]string{"azure", "delete-if-version"}, time.Now())
+
+	a.permitPool.Acquire()
+	defer a.permitPool.Release()
+
+	blob := &storage.Blob{
+		Container: a.container,
+		Name:      key,
+	}
+	err := blob.Delete(&storage.DeleteBlobOptions{
+		IfMatch: version,
+	})
+	return conditionError(err)
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (a *AzureBackend) LockWith(key, value string) (physical.Lock, error) {
+	return physical.NewConditionalLock(a, a.logger, "azure", key, value)
+}
+
+// HAEnabled returns whether conditional writes are used for locking.
+func (a *AzureBackend) HAEnabled() bool {
+	return a.haEnabled
+}
+
+// conditionError translates the errors of conditional requests. Azure
+// returns 412 when the ETag does not match, 409 when the blob already
+// exists, and 404 when deleting a blob that no longer exists.
+func conditionError(err error) error {
+	if storageErr, ok := err.(storage.AzureStorageServiceError); ok {
+		switch storageErr.StatusCode {
+		case http.StatusPreconditionFailed, http.StatusConflict, http.StatusNotFound:
+			return physical.ErrConditionFailed
+		}
+	}
+	return err
+}
@@ -1,8 +1,15 @@
 package azure
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -50,3 +57,197 @@ func TestAzureBackend(t *testing.T) {
 	physical.ExerciseBackend(t, backend)
 	physical.ExerciseBackend_ListPrefix(t, backend)
 }
+
+// fakeBlobStorage is a minimal Azure blob storage server that supports
+// getting, putting and deleting blobs, including the If-Match and
+// If-None-Match conditions
+type fakeBlobStorage struct {
+	l       sync.Mutex
+	blobs   map[string][]byte
+	etags   map[string]string
+	counter int
+}
+
+func (f *fakeBlobStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	key := r.URL.Path
+	etag, exists := f.etags[key]
+
+	// Check the conditions of writes
+	if r.Method != "GET" {
+		if match := r.Header.Get("If-Match"); match != "" && match != etag {
+			if !exists {
+				f.writeError(w, http.StatusNotFound, "BlobNotFound")
+			} else {
+				f.writeError(w, http.StatusPreconditionFailed, "ConditionNotMet")
+			}
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			f.writeError(w, http.StatusConflict, "BlobAlreadyExists")
+			return
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+		if !exists {
+			f.writeError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		w.Header().Set("Etag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.blobs[key])))
+		w.Write(f.blobs[key])
+	case "PUT":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		f.counter++
+		f.blobs[key] = data
+		f.etags[key] = fmt.Sprintf("%q", strconv.Itoa(f.counter))
+		w.Header().Set("Etag", f.etags[key])
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if !exists {
+			f.writeError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(f.blobs, key)
+		delete(f.etags, key)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "UnsupportedHttpVerb")
+	}
+}
+
+func (f *fakeBlobStorage) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+}
+
+// fakeBlobTransport sends all requests to the fake server, whatever the
+// host of the storage account is
+type fakeBlobTransport struct {
+	addr string
+}
+
+func (t *fakeBlobTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Host = t.addr
+	r.URL = &u
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// testFakeAzureBackend returns a backend with HA enabled that uses the
+// given fake server
+func testFakeAzureBackend(t *testing.T, srv *httptest.Server) *AzureBackend {
+	accountKey := base64.StdEncoding.EncodeToString([]byte("secret"))
+	client, err := storage.NewClient("vaulttest", accountKey, storage.DefaultBaseURL, storage.DefaultAPIVersion, false)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	client.HTTPClient = &http.Client{
+		Transport: &fakeBlobTransport{addr: srv.Listener.Addr().String()},
+	}
+
+	blobClient := client.GetBlobService()
+	return &AzureBackend{
+		container:  blobClient.GetContainerReference("vault"),
+		logger:     logformat.NewVaultLogger(log.LevelTrace),
+		permitPool: physical.NewPermitPool(0),
+		haEnabled:  true,
+	}
+}
+
+func TestAzureHABackend(t *testing.T) {
+	srv := httptest.NewServer(&fakeBlobStorage{
+		blobs: make(map[string][]byte),
+		etags: make(map[string]string),
+	})
+	defer srv.Close()
+
+	b := testFakeAzureBackend(t, srv)
+	b2 := testFakeAzureBackend(t, srv)
+	physical.ExerciseHABackend(t, b, b2)
+}
+
+func TestAzureHABackend_Takeover(t *testing.T) {
+	srv := httptest.NewServer(&fakeBlobStorage{
+		blobs: make(map[string][]byte),
+		etags: make(map[string]string),
+	})
+	defer srv.Close()
+
+	b := testFakeAzureBackend(t, srv)
+	raw, err := b.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock := raw.(*physical.ConditionalLock)
+
+	// The lock expires before it is renewed
+	lock.TTL = 200 * time.Millisecond
+	lock.RenewInterval = time.Second
+	lock.ExpiryMargin = 0
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh == nil {
+		t.Fatal("failed to get leader ch")
+	}
+
+	raw, err = testFakeAzureBackend(t, srv).LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock2 := raw.(*physical.ConditionalLock)
+	lock2.RetryInterval = 50 * time.Millisecond
+	stopCh := make(chan struct{})
+	time.AfterFunc(2*time.Second, func() { close(stopCh) })
+	leaderCh2, err := lock2.Lock(stopCh)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh2 == nil {
+		t.Fatal("expired lock should be taken over")
+	}
+	defer lock2.Unlock()
+
+	select {
+	case <-leaderCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("leadership should be lost")
+	}
+	lock.Unlock()
+
+	held, val, err := lock2.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "baz" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+
+	// Writing the lock blob is conditional on its ETag
+	entry, etag, err := b.GetVersion(context.Background(), "core/lock")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil || etag == "" {
+		t.Fatalf("bad: %v %q", entry, etag)
+	}
+	if err := b.PutIfVersion(context.Background(), entry, ""); err != physical.ErrConditionFailed {
+		t.Fatalf("expected condition failure, got: %v", err)
+	}
+	if err := b.DeleteIfVersion(context.Background(), "core/lock", `"stale"`); err != physical.ErrConditionFailed {
+		t.Fatalf("expected condition failure, got: %v", err)
+	}
+}
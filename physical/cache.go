@@ -1,6 +1,7 @@
 package physical
 
 import (
+	"context"
 	"strings"
 
 	"github.com/hashicorp/golang-lru"
@@ -13,6 +14,15 @@ const (
 	DefaultCacheSize = 32 * 1024
 )
 
+type cacheRefreshContextKey struct{}
+
+// CacheRefreshContext returns a context that makes the cache read entries
+// from the underlying backend and refresh its copy of them. It is used by
+// nodes whose cache is not kept up to date with the writes of another node.
+func CacheRefreshContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheRefreshContextKey{}, true)
+}
+
 // Cache is used to wrap an underlying physical backend
 // and provide an LRU cache layer on top. Most of the reads done by
 // Vault are for policy objects so there is a large read reduction
@@ -69,19 +79,28 @@ func (c *Cache) Purge() {
 	c.lru.Purge()
 }
 
-func (c *Cache) Put(entry *Entry) error {
+// Invalidate is used to drop a key from the cache
+func (c *Cache) Invalidate(key string) {
+	lock := locksutil.LockForKey(c.locks, key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	c.lru.Remove(key)
+}
+
+func (c *Cache) Put(ctx context.Context, entry *Entry) error {
 	lock := locksutil.LockForKey(c.locks, entry.Key)
 	lock.Lock()
 	defer lock.Unlock()
 
-	err := c.backend.Put(entry)
+	err := c.backend.Put(ctx, entry)
 	if err == nil && !strings.HasPrefix(entry.Key, "core/") {
 		c.lru.Add(entry.Key, entry)
 	}
 	return err
 }
 
-func (c *Cache) Get(key string) (*Entry, error) {
+func (c *Cache) Get(ctx context.Context, key string) (*Entry, error) {
 	lock := locksutil.LockForKey(c.locks, key)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -91,59 +110,70 @@ func (c *Cache) Get(key string) (*Entry, error) {
 	// with the HA mode, we could potentially negatively cache the leader entry
 	// and cause leader discovery to fail.
 	if strings.HasPrefix(key, "core/") {
-		return c.backend.Get(key)
+		return c.backend.Get(ctx, key)
 	}
 
-	// Check the LRU first
-	if raw, ok := c.lru.Get(key); ok {
-		if raw == nil {
-			return nil, nil
-		} else {
-			return raw.(*Entry), nil
+	// Check the LRU first, unless it has to be refreshed
+	refresh, _ := ctx.Value(cacheRefreshContextKey{}).(bool)
+	if !refresh {
+		if raw, ok := c.lru.Get(key); ok {
+			if raw == nil {
+				return nil, nil
+			} else {
+				return raw.(*Entry), nil
+			}
 		}
 	}
 
 	// Read from the underlying backend
-	ent, err := c.backend.Get(key)
+	ent, err := c.backend.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 
 	// Cache the result
-	if ent != nil {
+	switch {
+	case ent != nil:
 		c.lru.Add(key, ent)
+	case refresh:
+		c.lru.Remove(key)
 	}
 
 	return ent, nil
 }
 
-func (c *Cache) Delete(key string) error {
+func (c *Cache) Delete(ctx context.Context, key string) error {
 	lock := locksutil.LockForKey(c.locks, key)
 	lock.Lock()
 	defer lock.Unlock()
 
-	err := c.backend.Delete(key)
+	err := c.backend.Delete(ctx, key)
 	if err == nil && !strings.HasPrefix(key, "core/") {
 		c.lru.Remove(key)
 	}
 	return err
 }
 
-func (c *Cache) List(prefix string) ([]string, error) {
+func (c *Cache) List(ctx context.Context, prefix string) ([]string, error) {
 	// Always pass-through as this would be difficult to cache. For the same
 	// reason we don't lock as we can't reasonably know which locks to readlock
 	// ahead of time.
-	return c.backend.List(prefix)
+	return c.backend.List(ctx, prefix)
+}
+
+// ListPage passes through to the underlying backend, paginated or not
+func (c *Cache) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	return ListPage(ctx, c.backend, prefix, after, limit)
 }
 
-func (c *TransactionalCache) Transaction(txns []TxnEntry) error {
+func (c *TransactionalCache) Transaction(ctx context.Context, txns []TxnEntry) error {
 	// Lock the world
 	for _, lock := range c.locks {
 		lock.Lock()
 		defer lock.Unlock()
 	}
 
-	if err := c.Transactional.Transaction(txns); err != nil {
+	if err := c.Transactional.Transaction(ctx, txns); err != nil {
 		return err
 	}
 
@@ -1,6 +1,7 @@
 package cassandra
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
@@ -245,7 +246,7 @@ func (c *CassandraBackend) bucket(key string) string {
 }
 
 // Put is used to insert or update an entry
-func (c *CassandraBackend) Put(entry *physical.Entry) error {
+func (c *CassandraBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"cassandra", "put"}, time.Now())
 
 	// Execute inserts to each key prefix simultaneously
@@ -254,7 +255,7 @@ func (c *CassandraBackend) Put(entry *physical.Entry) error {
 	buckets := c.buckets(entry.Key)
 	for _, _bucket := range buckets {
 		go func(bucket string) {
-			results <- c.sess.Query(stmt, bucket, entry.Key, entry.Value).Exec()
+			results <- c.sess.Query(stmt, bucket, entry.Key, entry.Value).WithContext(ctx).Exec()
 		}(_bucket)
 	}
 	for i := 0; i < len(buckets); i++ {
@@ -266,12 +267,12 @@ func (c *CassandraBackend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch an entry
-func (c *CassandraBackend) Get(key string) (*physical.Entry, error) {
+func (c *CassandraBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"cassandra", "get"}, time.Now())
 
 	v := []byte(nil)
 	stmt := fmt.Sprintf(`SELECT value FROM "%s" WHERE bucket = ? AND key = ? LIMIT 1`, c.table)
-	q := c.sess.Query(stmt, c.bucket(key), key)
+	q := c.sess.Query(stmt, c.bucket(key), key).WithContext(ctx)
 	if err := q.Scan(&v); err != nil {
 		if err == gocql.ErrNotFound {
 			return nil, nil
@@ -286,11 +287,11 @@ func (c *CassandraBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (c *CassandraBackend) Delete(key string) error {
+func (c *CassandraBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"cassandra", "delete"}, time.Now())
 
 	stmt := fmt.Sprintf(`DELETE FROM "%s" WHERE bucket = ? AND key = ?`, c.table)
-	batch := gocql.NewBatch(gocql.LoggedBatch)
+	batch := gocql.NewBatch(gocql.LoggedBatch).WithContext(ctx)
 	for _, bucket := range c.buckets(key) {
 		batch.Entries = append(batch.Entries, gocql.BatchEntry{
 			Stmt: stmt,
@@ -301,11 +302,11 @@ func (c *CassandraBackend) Delete(key string) error {
 
 // List is used ot list all the keys under a given
 // prefix, up to the next prefix.
-func (c *CassandraBackend) List(prefix string) ([]string, error) {
+func (c *CassandraBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"cassandra", "list"}, time.Now())
 
 	stmt := fmt.Sprintf(`SELECT key FROM "%s" WHERE bucket = ?`, c.table)
-	q := c.sess.Query(stmt, c.bucketName(prefix))
+	q := c.sess.Query(stmt, c.bucketName(prefix)).WithContext(ctx)
 	iter := q.Iter()
 	k, keys := "", []string{}
 	for iter.Scan(&k) {
@@ -108,13 +108,13 @@ func (c *CockroachDBBackend) prepare(name, query string) error {
 }
 
 // Put is used to insert or update an entry.
-func (c *CockroachDBBackend) Put(entry *physical.Entry) error {
+func (c *CockroachDBBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"cockroachdb", "put"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	_, err := c.statements["put"].Exec(entry.Key, entry.Value)
+	_, err := c.statements["put"].ExecContext(ctx, entry.Key, entry.Value)
 	if err != nil {
 		return err
 	}
@@ -122,14 +122,14 @@ func (c *CockroachDBBackend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch and entry.
-func (c *CockroachDBBackend) Get(key string) (*physical.Entry, error) {
+func (c *CockroachDBBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"cockroachdb", "get"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
 	var result []byte
-	err := c.statements["get"].QueryRow(key).Scan(&result)
+	err := c.statements["get"].QueryRowContext(ctx, key).Scan(&result)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -145,13 +145,13 @@ func (c *CockroachDBBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (c *CockroachDBBackend) Delete(key string) error {
+func (c *CockroachDBBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"cockroachdb", "delete"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	_, err := c.statements["delete"].Exec(key)
+	_, err := c.statements["delete"].ExecContext(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -160,14 +160,14 @@ func (c *CockroachDBBackend) Delete(key string) error {
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (c *CockroachDBBackend) List(prefix string) ([]string, error) {
+func (c *CockroachDBBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"cockroachdb", "list"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
 	likePrefix := prefix + "%"
-	rows, err := c.statements["list"].Query(likePrefix)
+	rows, err := c.statements["list"].QueryContext(ctx, likePrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +196,7 @@ func (c *CockroachDBBackend) List(prefix string) ([]string, error) {
 }
 
 // Transaction is used to run multiple entries via a transaction
-func (c *CockroachDBBackend) Transaction(txns []physical.TxnEntry) error {
+func (c *CockroachDBBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
 	defer metrics.MeasureSince([]string{"cockroachdb", "transaction"}, time.Now())
 	if len(txns) == 0 {
 		return nil
@@ -205,17 +205,17 @@ func (c *CockroachDBBackend) Transaction(txns []physical.TxnEntry) error {
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	return crdb.ExecuteTx(context.Background(), c.client, nil, func(tx *sql.Tx) error {
-		return c.transaction(tx, txns)
+	return crdb.ExecuteTx(ctx, c.client, nil, func(tx *sql.Tx) error {
+		return c.transaction(ctx, tx, txns)
 	})
 }
 
-func (c *CockroachDBBackend) transaction(tx *sql.Tx, txns []physical.TxnEntry) error {
-	deleteStmt, err := tx.Prepare(c.rawStatements["delete"])
+func (c *CockroachDBBackend) transaction(ctx context.Context, tx *sql.Tx, txns []physical.TxnEntry) error {
+	deleteStmt, err := tx.PrepareContext(ctx, c.rawStatements["delete"])
 	if err != nil {
 		return err
 	}
-	putStmt, err := tx.Prepare(c.rawStatements["put"])
+	putStmt, err := tx.PrepareContext(ctx, c.rawStatements["put"])
 	if err != nil {
 		return err
 	}
@@ -223,9 +223,9 @@ func (c *CockroachDBBackend) transaction(tx *sql.Tx, txns []physical.TxnEntry) e
 	for _, op := range txns {
 		switch op.Operation {
 		case physical.DeleteOperation:
-			_, err = deleteStmt.Exec(op.Entry.Key)
+			_, err = deleteStmt.ExecContext(ctx, op.Entry.Key)
 		case physical.PutOperation:
-			_, err = putStmt.Exec(op.Entry.Key, op.Entry.Value)
+			_, err = putStmt.ExecContext(ctx, op.Entry.Key, op.Entry.Value)
 		default:
 			return fmt.Errorf("%q is not a supported transaction operation", op.Operation)
 		}
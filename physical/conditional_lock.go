@@ -0,0 +1,220 @@
+package physical
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// ConditionalLockTTL is the time a lock is valid for without being
+	// renewed
+	ConditionalLockTTL = 15 * time.Second
+
+	// ConditionalLockRenewInterval is the amount of time to wait between
+	// lock renewals
+	ConditionalLockRenewInterval = 5 * time.Second
+
+	// ConditionalLockRetryInterval is the amount of time to wait before
+	// trying again to acquire a lock held by another node
+	ConditionalLockRetryInterval = time.Second
+
+	// ConditionalLockExpiryMargin is how long before the lock expires that
+	// its leadership is given up if it could not be renewed, so that the
+	// node has stepped down by the time another node can take it over
+	ConditionalLockExpiryMargin = 3 * time.Second
+)
+
+// ErrConditionFailed is returned by the conditional operations of a
+// ConditionalBackend when the object was modified since the given version
+// was read.
+var ErrConditionFailed = errors.New("version of the object does not match")
+
+// ConditionalBackend is an optional interface for backends that can make
+// writes conditional on the version of an object, such as object stores
+// that support ETag or generation preconditions. It is used to implement
+// ConditionalLock.
+type ConditionalBackend interface {
+	// GetVersion returns the entry for the key along with an opaque
+	// version of it. A nil entry is returned if the key does not exist.
+	GetVersion(ctx context.Context, key string) (*Entry, string, error)
+
+	// PutIfVersion writes the entry only if the current version of its
+	// key matches the given one. An empty version requires that the key
+	// does not exist. ErrConditionFailed is returned if the condition
+	// does not hold.
+	PutIfVersion(ctx context.Context, entry *Entry, version string) error
+
+	// DeleteIfVersion deletes the key only if its current version matches
+	// the given one. ErrConditionFailed is returned if the condition does
+	// not hold.
+	DeleteIfVersion(ctx context.Context, key, version string) error
+}
+
+// ConditionalLock implements a lock on top of a ConditionalBackend. The lock
+// is an object that holds the identity of its holder and the time until
+// which it is valid, which the holder extends periodically. All changes to
+// the object are conditional on the version that was last read, so only one
+// node can acquire, renew or take over the lock at a time. As the validity
+// is computed using the clocks of the nodes, these must be roughly in sync.
+type ConditionalLock struct {
+	// TTLLock durations default to the ConditionalLock constants
+	TTLLock
+
+	backend  ConditionalBackend
+	key      string
+	value    string
+	identity string
+}
+
+// conditionalLockRecord is the content of the object of a ConditionalLock
+type conditionalLockRecord struct {
+	Identity string `json:"identity"`
+	Value    string `json:"value"`
+	Expires  int64  `json:"expires"`
+}
+
+// NewConditionalLock returns a lock for the given key, which holds the given
+// value while it is held. Log messages are prefixed with the name of the
+// backend.
+func NewConditionalLock(b ConditionalBackend, logger log.Logger, name, key, value string) (*ConditionalLock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	l := &ConditionalLock{
+		backend:  b,
+		key:      key,
+		value:    value,
+		identity: identity,
+	}
+	l.TTLLock = TTLLock{
+		TryToLock:     l.tryToLock,
+		Renew:         l.renew,
+		Release:       l.release,
+		Logger:        logger,
+		Name:          name,
+		TTL:           ConditionalLockTTL,
+		RenewInterval: ConditionalLockRenewInterval,
+		RetryInterval: ConditionalLockRetryInterval,
+		ExpiryMargin:  ConditionalLockExpiryMargin,
+	}
+	return l, nil
+}
+
+// release deletes the object of the lock, unless it was taken over by
+// another node in the meantime.
+func (l *ConditionalLock) release() error {
+	record, version, err := l.read(context.Background())
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Identity != l.identity {
+		return nil
+	}
+	err = l.backend.DeleteIfVersion(context.Background(), l.key, version)
+	if err == ErrConditionFailed {
+		return nil
+	}
+	return err
+}
+
+// Value checks whether or not the lock is held by any node, including this
+// one, and returns the current value.
+func (l *ConditionalLock) Value() (bool, string, error) {
+	record, _, err := l.read(context.Background())
+	if err != nil {
+		return false, "", err
+	}
+	if record == nil || record.expired() {
+		return false, "", nil
+	}
+	return true, record.Value, nil
+}
+
+// tryToLock writes the object of this lock if there is none, or if the
+// existing one has expired. It returns false if another node holds the
+// lock.
+func (l *ConditionalLock) tryToLock(ctx context.Context) (bool, error) {
+	record, version, err := l.read(ctx)
+	if err != nil {
+		return false, err
+	}
+	if record != nil && !record.expired() {
+		return false, nil
+	}
+
+	err = l.write(ctx, version)
+	if err == ErrConditionFailed {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// renew extends the validity of the lock. It returns false if the lock was
+// taken over by another node.
+func (l *ConditionalLock) renew(ctx context.Context) (bool, error) {
+	record, version, err := l.read(ctx)
+	if err != nil {
+		return false, err
+	}
+	if record == nil || record.Identity != l.identity {
+		return false, nil
+	}
+
+	err = l.write(ctx, version)
+	if err == ErrConditionFailed {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// read returns the current object of the lock and its version
+func (l *ConditionalLock) read(ctx context.Context) (*conditionalLockRecord, string, error) {
+	entry, version, err := l.backend.GetVersion(ctx, l.key)
+	if err != nil {
+		return nil, "", err
+	}
+	if entry == nil {
+		return nil, "", nil
+	}
+
+	var record conditionalLockRecord
+	if err := json.Unmarshal(entry.Value, &record); err != nil {
+		return nil, "", fmt.Errorf("failed to decode HA lock: %v", err)
+	}
+	return &record, version, nil
+}
+
+// write replaces the object of the lock with one held by this node, if its
+// version still matches
+func (l *ConditionalLock) write(ctx context.Context, version string) error {
+	value, err := json.Marshal(&conditionalLockRecord{
+		Identity: l.identity,
+		Value:    l.value,
+		Expires:  time.Now().Add(l.TTL).UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+	return l.backend.PutIfVersion(ctx, &Entry{
+		Key:   l.key,
+		Value: value,
+	}, version)
+}
+
+// expired returns whether the holder of the lock failed to renew it in time
+func (r *conditionalLockRecord) expired() bool {
+	return time.Now().UnixNano() >= r.Expires
+}
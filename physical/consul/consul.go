@@ -1,16 +1,14 @@
 package consul
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -22,38 +20,14 @@ import (
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/consul/api"
-	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/errwrap"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/helper/consts"
-	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/helper/tlsutil"
 	"github.com/hashicorp/vault/physical"
 )
 
 const (
-	// checkJitterFactor specifies the jitter factor used to stagger checks
-	checkJitterFactor = 16
-
-	// checkMinBuffer specifies provides a guarantee that a check will not
-	// be executed too close to the TTL check timeout
-	checkMinBuffer = 100 * time.Millisecond
-
-	// consulRetryInterval specifies the retry duration to use when an
-	// API call to the Consul agent fails.
-	consulRetryInterval = 1 * time.Second
-
-	// defaultCheckTimeout changes the timeout of TTL checks
-	defaultCheckTimeout = 5 * time.Second
-
-	// DefaultServiceName is the default Consul service name used when
-	// advertising a Vault instance.
-	DefaultServiceName = "vault"
-
-	// reconcileTimeout is how often Vault should query Consul to detect
-	// and fix any state drift.
-	reconcileTimeout = 60 * time.Second
-
 	// consistencyModeDefault is the configuration value used to tell
 	// consul to use default consistency.
 	consistencyModeDefault = "default"
@@ -63,28 +37,16 @@ const (
 	consistencyModeStrong = "strong"
 )
 
-type notifyEvent struct{}
-
 // ConsulBackend is a physical backend that stores data at specific
 // prefix within Consul. It is used for most production situations as
 // it allows Vault to run on multiple machines in a highly-available manner.
 type ConsulBackend struct {
-	path                string
-	logger              log.Logger
-	client              *api.Client
-	kv                  *api.KV
-	permitPool          *physical.PermitPool
-	serviceLock         sync.RWMutex
-	redirectHost        string
-	redirectPort        int64
-	serviceName         string
-	serviceTags         []string
-	disableRegistration bool
-	checkTimeout        time.Duration
-	consistencyMode     string
-
-	notifyActiveCh chan notifyEvent
-	notifySealedCh chan notifyEvent
+	path            string
+	logger          log.Logger
+	client          *api.Client
+	kv              *api.KV
+	permitPool      *physical.PermitPool
+	consistencyMode string
 }
 
 // NewConsulBackend constructs a Consul backend using the given API client
@@ -109,55 +71,6 @@ func NewConsulBackend(conf map[string]string, logger log.Logger) (physical.Backe
 		path = strings.TrimPrefix(path, "/")
 	}
 
-	// Allow admins to disable consul integration
-	disableReg, ok := conf["disable_registration"]
-	var disableRegistration bool
-	if ok && disableReg != "" {
-		b, err := strconv.ParseBool(disableReg)
-		if err != nil {
-			return nil, errwrap.Wrapf("failed parsing disable_registration parameter: {{err}}", err)
-		}
-		disableRegistration = b
-	}
-	if logger.IsDebug() {
-		logger.Debug("physical/consul: config disable_registration set", "disable_registration", disableRegistration)
-	}
-
-	// Get the service name to advertise in Consul
-	service, ok := conf["service"]
-	if !ok {
-		service = DefaultServiceName
-	}
-	if logger.IsDebug() {
-		logger.Debug("physical/consul: config service set", "service", service)
-	}
-
-	// Get the additional tags to attach to the registered service name
-	tags := conf["service_tags"]
-
-	if logger.IsDebug() {
-		logger.Debug("physical/consul: config service_tags set", "service_tags", tags)
-	}
-
-	checkTimeout := defaultCheckTimeout
-	checkTimeoutStr, ok := conf["check_timeout"]
-	if ok {
-		d, err := time.ParseDuration(checkTimeoutStr)
-		if err != nil {
-			return nil, err
-		}
-
-		min, _ := lib.DurationMinusBufferDomain(d, checkMinBuffer, checkJitterFactor)
-		if min < checkMinBuffer {
-			return nil, fmt.Errorf("Consul check_timeout must be greater than %v", min)
-		}
-
-		checkTimeout = d
-		if logger.IsDebug() {
-			logger.Debug("physical/consul: config check_timeout set", "check_timeout", d)
-		}
-	}
-
 	// Configure the client
 	consulConf := api.DefaultConfig()
 	// Set MaxIdleConnsPerHost to the number of processes used in expiration.Restore
@@ -181,7 +94,7 @@ func NewConsulBackend(conf map[string]string, logger log.Logger) (physical.Backe
 	}
 
 	if consulConf.Scheme == "https" {
-		tlsClientConfig, err := setupTLSConfig(conf)
+		tlsClientConfig, err := SetupTLSConfig(conf)
 		if err != nil {
 			return nil, err
 		}
@@ -224,23 +137,19 @@ func NewConsulBackend(conf map[string]string, logger log.Logger) (physical.Backe
 
 	// Setup the backend
 	c := &ConsulBackend{
-		path:                path,
-		logger:              logger,
-		client:              client,
-		kv:                  client.KV(),
-		permitPool:          physical.NewPermitPool(maxParInt),
-		serviceName:         service,
-		serviceTags:         strutil.ParseDedupLowercaseAndSortStrings(tags, ","),
-		checkTimeout:        checkTimeout,
-		disableRegistration: disableRegistration,
-		consistencyMode:     consistencyMode,
-		notifyActiveCh:      make(chan notifyEvent),
-		notifySealedCh:      make(chan notifyEvent),
+		path:            path,
+		logger:          logger,
+		client:          client,
+		kv:              client.KV(),
+		permitPool:      physical.NewPermitPool(maxParInt),
+		consistencyMode: consistencyMode,
 	}
 	return c, nil
 }
 
-func setupTLSConfig(conf map[string]string) (*tls.Config, error) {
+// SetupTLSConfig builds the TLS configuration of a Consul client from the
+// tls_* parameters of the given configuration.
+func SetupTLSConfig(conf map[string]string) (*tls.Config, error) {
 	serverName, _, err := net.SplitHostPort(conf["address"])
 	switch {
 	case err == nil:
@@ -303,7 +212,7 @@ func setupTLSConfig(conf map[string]string) (*tls.Config, error) {
 }
 
 // Used to run multiple entries via a transaction
-func (c *ConsulBackend) Transaction(txns []physical.TxnEntry) error {
+func (c *ConsulBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
 	if len(txns) == 0 {
 		return nil
 	}
@@ -330,7 +239,10 @@ func (c *ConsulBackend) Transaction(txns []physical.TxnEntry) error {
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	ok, resp, _, err := c.kv.Txn(ops, nil)
+	queryOpts := &api.QueryOptions{}
+	queryOpts = queryOpts.WithContext(ctx)
+
+	ok, resp, _, err := c.kv.Txn(ops, queryOpts)
 	if err != nil {
 		return err
 	}
@@ -347,7 +259,7 @@ func (c *ConsulBackend) Transaction(txns []physical.TxnEntry) error {
 }
 
 // Put is used to insert or update an entry
-func (c *ConsulBackend) Put(entry *physical.Entry) error {
+func (c *ConsulBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"consul", "put"}, time.Now())
 
 	c.permitPool.Acquire()
@@ -358,25 +270,27 @@ func (c *ConsulBackend) Put(entry *physical.Entry) error {
 		Value: entry.Value,
 	}
 
-	_, err := c.kv.Put(pair, nil)
+	writeOpts := &api.WriteOptions{}
+	writeOpts = writeOpts.WithContext(ctx)
+
+	_, err := c.kv.Put(pair, writeOpts)
 	return err
 }
 
 // Get is used to fetch an entry
-func (c *ConsulBackend) Get(key string) (*physical.Entry, error) {
+func (c *ConsulBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"consul", "get"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	var queryOptions *api.QueryOptions
+	queryOpts := &api.QueryOptions{}
+	queryOpts = queryOpts.WithContext(ctx)
 	if c.consistencyMode == consistencyModeStrong {
-		queryOptions = &api.QueryOptions{
-			RequireConsistent: true,
-		}
+		queryOpts.RequireConsistent = true
 	}
 
-	pair, _, err := c.kv.Get(c.path+key, queryOptions)
+	pair, _, err := c.kv.Get(c.path+key, queryOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -391,19 +305,24 @@ func (c *ConsulBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (c *ConsulBackend) Delete(key string) error {
+func (c *ConsulBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"consul", "delete"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	_, err := c.kv.Delete(c.path+key, nil)
+	writeOpts := &api.WriteOptions{}
+	writeOpts = writeOpts.WithContext(ctx)
+
+	_, err := c.kv.Delete(c.path+key, writeOpts)
 	return err
 }
 
 // List is used to list all the keys under a given
-// prefix, up to the next prefix.
-func (c *ConsulBackend) List(prefix string) ([]string, error) {
+// prefix, up to the next prefix. Consul has no paginated key listing, so
+// the backend is not Paginated and physical.ListPage pages the result of
+// List.
+func (c *ConsulBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"consul", "list"}, time.Now())
 	scan := c.path + prefix
 
@@ -417,7 +336,10 @@ func (c *ConsulBackend) List(prefix string) ([]string, error) {
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	out, _, err := c.kv.Keys(scan, "/", nil)
+	queryOpts := &api.QueryOptions{}
+	queryOpts = queryOpts.WithContext(ctx)
+
+	out, _, err := c.kv.Keys(scan, "/", queryOpts)
 	for idx, val := range out {
 		out[idx] = strings.TrimPrefix(val, scan)
 	}
@@ -504,290 +426,3 @@ func (c *ConsulLock) Value() (bool, string, error) {
 	value := string(pair.Value)
 	return held, value, nil
 }
-
-func (c *ConsulBackend) NotifyActiveStateChange() error {
-	select {
-	case c.notifyActiveCh <- notifyEvent{}:
-	default:
-		// NOTE: If this occurs Vault's active status could be out of
-		// sync with Consul until reconcileTimer expires.
-		c.logger.Warn("physical/consul: Concurrent state change notify dropped")
-	}
-
-	return nil
-}
-
-func (c *ConsulBackend) NotifySealedStateChange() error {
-	select {
-	case c.notifySealedCh <- notifyEvent{}:
-	default:
-		// NOTE: If this occurs Vault's sealed status could be out of
-		// sync with Consul until checkTimer expires.
-		c.logger.Warn("physical/consul: Concurrent sealed state change notify dropped")
-	}
-
-	return nil
-}
-
-func (c *ConsulBackend) checkDuration() time.Duration {
-	return lib.DurationMinusBuffer(c.checkTimeout, checkMinBuffer, checkJitterFactor)
-}
-
-func (c *ConsulBackend) RunServiceDiscovery(waitGroup *sync.WaitGroup, shutdownCh physical.ShutdownChannel, redirectAddr string, activeFunc physical.ActiveFunction, sealedFunc physical.SealedFunction) (err error) {
-	if err := c.setRedirectAddr(redirectAddr); err != nil {
-		return err
-	}
-
-	// 'server' command will wait for the below goroutine to complete
-	waitGroup.Add(1)
-
-	go c.runEventDemuxer(waitGroup, shutdownCh, redirectAddr, activeFunc, sealedFunc)
-
-	return nil
-}
-
-func (c *ConsulBackend) runEventDemuxer(waitGroup *sync.WaitGroup, shutdownCh physical.ShutdownChannel, redirectAddr string, activeFunc physical.ActiveFunction, sealedFunc physical.SealedFunction) {
-	// This defer statement should be executed last. So push it first.
-	defer waitGroup.Done()
-
-	// Fire the reconcileTimer immediately upon starting the event demuxer
-	reconcileTimer := time.NewTimer(0)
-	defer reconcileTimer.Stop()
-
-	// Schedule the first check.  Consul TTL checks are passing by
-	// default, checkTimer does not need to be run immediately.
-	checkTimer := time.NewTimer(c.checkDuration())
-	defer checkTimer.Stop()
-
-	// Use a reactor pattern to handle and dispatch events to singleton
-	// goroutine handlers for execution.  It is not acceptable to drop
-	// inbound events from Notify*().
-	//
-	// goroutines are dispatched if the demuxer can acquire a lock (via
-	// an atomic CAS incr) on the handler.  Handlers are responsible for
-	// deregistering themselves (atomic CAS decr).  Handlers and the
-	// demuxer share a lock to synchronize information at the beginning
-	// and end of a handler's life (or after a handler wakes up from
-	// sleeping during a back-off/retry).
-	var shutdown bool
-	var checkLock int64
-	var registeredServiceID string
-	var serviceRegLock int64
-
-	for !shutdown {
-		select {
-		case <-c.notifyActiveCh:
-			// Run reconcile immediately upon active state change notification
-			reconcileTimer.Reset(0)
-		case <-c.notifySealedCh:
-			// Run check timer immediately upon a seal state change notification
-			checkTimer.Reset(0)
-		case <-reconcileTimer.C:
-			// Unconditionally rearm the reconcileTimer
-			reconcileTimer.Reset(reconcileTimeout - lib.RandomStagger(reconcileTimeout/checkJitterFactor))
-
-			// Abort if service discovery is disabled or a
-			// reconcile handler is already active
-			if !c.disableRegistration && atomic.CompareAndSwapInt64(&serviceRegLock, 0, 1) {
-				// Enter handler with serviceRegLock held
-				go func() {
-					defer atomic.CompareAndSwapInt64(&serviceRegLock, 1, 0)
-					for !shutdown {
-						serviceID, err := c.reconcileConsul(registeredServiceID, activeFunc, sealedFunc)
-						if err != nil {
-							if c.logger.IsWarn() {
-								c.logger.Warn("physical/consul: reconcile unable to talk with Consul backend", "error", err)
-							}
-							time.Sleep(consulRetryInterval)
-							continue
-						}
-
-						c.serviceLock.Lock()
-						defer c.serviceLock.Unlock()
-
-						registeredServiceID = serviceID
-						return
-					}
-				}()
-			}
-		case <-checkTimer.C:
-			checkTimer.Reset(c.checkDuration())
-			// Abort if service discovery is disabled or a
-			// reconcile handler is active
-			if !c.disableRegistration && atomic.CompareAndSwapInt64(&checkLock, 0, 1) {
-				// Enter handler with checkLock held
-				go func() {
-					defer atomic.CompareAndSwapInt64(&checkLock, 1, 0)
-					for !shutdown {
-						sealed := sealedFunc()
-						if err := c.runCheck(sealed); err != nil {
-							if c.logger.IsWarn() {
-								c.logger.Warn("physical/consul: check unable to talk with Consul backend", "error", err)
-							}
-							time.Sleep(consulRetryInterval)
-							continue
-						}
-						return
-					}
-				}()
-			}
-		case <-shutdownCh:
-			c.logger.Info("physical/consul: Shutting down consul backend")
-			shutdown = true
-		}
-	}
-
-	c.serviceLock.RLock()
-	defer c.serviceLock.RUnlock()
-	if err := c.client.Agent().ServiceDeregister(registeredServiceID); err != nil {
-		if c.logger.IsWarn() {
-			c.logger.Warn("physical/consul: service deregistration failed", "error", err)
-		}
-	}
-}
-
-// checkID returns the ID used for a Consul Check.  Assume at least a read
-// lock is held.
-func (c *ConsulBackend) checkID() string {
-	return fmt.Sprintf("%s:vault-sealed-check", c.serviceID())
-}
-
-// serviceID returns the Vault ServiceID for use in Consul.  Assume at least
-// a read lock is held.
-func (c *ConsulBackend) serviceID() string {
-	return fmt.Sprintf("%s:%s:%d", c.serviceName, c.redirectHost, c.redirectPort)
-}
-
-// reconcileConsul queries the state of Vault Core and Consul and fixes up
-// Consul's state according to what's in Vault.  reconcileConsul is called
-// without any locks held and can be run concurrently, therefore no changes
-// to ConsulBackend can be made in this method (i.e. wtb const receiver for
-// compiler enforced safety).
-func (c *ConsulBackend) reconcileConsul(registeredServiceID string, activeFunc physical.ActiveFunction, sealedFunc physical.SealedFunction) (serviceID string, err error) {
-	// Query vault Core for its current state
-	active := activeFunc()
-	sealed := sealedFunc()
-
-	agent := c.client.Agent()
-	catalog := c.client.Catalog()
-
-	serviceID = c.serviceID()
-
-	// Get the current state of Vault from Consul
-	var currentVaultService *api.CatalogService
-	if services, _, err := catalog.Service(c.serviceName, "", &api.QueryOptions{AllowStale: true}); err == nil {
-		for _, service := range services {
-			if serviceID == service.ServiceID {
-				currentVaultService = service
-				break
-			}
-		}
-	}
-
-	tags := c.fetchServiceTags(active)
-
-	var reregister bool
-
-	switch {
-	case currentVaultService == nil, registeredServiceID == "":
-		reregister = true
-	default:
-		switch {
-		case !strutil.EquivalentSlices(currentVaultService.ServiceTags, tags):
-			reregister = true
-		}
-	}
-
-	if !reregister {
-		// When re-registration is not required, return a valid serviceID
-		// to avoid registration in the next cycle.
-		return serviceID, nil
-	}
-
-	service := &api.AgentServiceRegistration{
-		ID:                serviceID,
-		Name:              c.serviceName,
-		Tags:              tags,
-		Port:              int(c.redirectPort),
-		Address:           c.redirectHost,
-		EnableTagOverride: false,
-	}
-
-	checkStatus := api.HealthCritical
-	if !sealed {
-		checkStatus = api.HealthPassing
-	}
-
-	sealedCheck := &api.AgentCheckRegistration{
-		ID:        c.checkID(),
-		Name:      "Vault Sealed Status",
-		Notes:     "Vault service is healthy when Vault is in an unsealed status and can become an active Vault server",
-		ServiceID: serviceID,
-		AgentServiceCheck: api.AgentServiceCheck{
-			TTL:    c.checkTimeout.String(),
-			Status: checkStatus,
-		},
-	}
-
-	if err := agent.ServiceRegister(service); err != nil {
-		return "", errwrap.Wrapf(`service registration failed: {{err}}`, err)
-	}
-
-	if err := agent.CheckRegister(sealedCheck); err != nil {
-		return serviceID, errwrap.Wrapf(`service check registration failed: {{err}}`, err)
-	}
-
-	return serviceID, nil
-}
-
-// runCheck immediately pushes a TTL check.
-func (c *ConsulBackend) runCheck(sealed bool) error {
-	// Run a TTL check
-	agent := c.client.Agent()
-	if !sealed {
-		return agent.PassTTL(c.checkID(), "Vault Unsealed")
-	} else {
-		return agent.FailTTL(c.checkID(), "Vault Sealed")
-	}
-}
-
-// fetchServiceTags returns all of the relevant tags for Consul.
-func (c *ConsulBackend) fetchServiceTags(active bool) []string {
-	activeTag := "standby"
-	if active {
-		activeTag = "active"
-	}
-	return append(c.serviceTags, activeTag)
-}
-
-func (c *ConsulBackend) setRedirectAddr(addr string) (err error) {
-	if addr == "" {
-		return fmt.Errorf("redirect address must not be empty")
-	}
-
-	url, err := url.Parse(addr)
-	if err != nil {
-		return errwrap.Wrapf(fmt.Sprintf(`failed to parse redirect URL "%v": {{err}}`, addr), err)
-	}
-
-	var portStr string
-	c.redirectHost, portStr, err = net.SplitHostPort(url.Host)
-	if err != nil {
-		if url.Scheme == "http" {
-			portStr = "80"
-		} else if url.Scheme == "https" {
-			portStr = "443"
-		} else if url.Scheme == "unix" {
-			portStr = "-1"
-			c.redirectHost = url.Path
-		} else {
-			return errwrap.Wrapf(fmt.Sprintf(`failed to find a host:port in redirect address "%v": {{err}}`, url.Host), err)
-		}
-	}
-	c.redirectPort, err = strconv.ParseInt(portStr, 10, 0)
-	if err != nil || c.redirectPort < -1 || c.redirectPort > 65535 {
-		return errwrap.Wrapf(fmt.Sprintf(`failed to parse valid port "%v": {{err}}`, portStr), err)
-	}
-
-	return nil
-}
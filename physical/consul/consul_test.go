@@ -2,9 +2,7 @@ package consul
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
-	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -13,7 +11,6 @@ import (
 
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/vault/helper/logformat"
-	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/physical"
 	dockertest "gopkg.in/ory-am/dockertest.v2"
 )
@@ -58,113 +55,39 @@ func testConsul_testConsulBackend(t *testing.T) {
 	}
 }
 
-func testActiveFunc(activePct float64) physical.ActiveFunction {
-	return func() bool {
-		var active bool
-		standbyProb := rand.Float64()
-		if standbyProb > activePct {
-			active = true
-		}
-		return active
-	}
-}
-
-func testSealedFunc(sealedPct float64) physical.SealedFunction {
-	return func() bool {
-		var sealed bool
-		unsealedProb := rand.Float64()
-		if unsealedProb > sealedPct {
-			sealed = true
-		}
-		return sealed
-	}
-}
-
-func TestConsul_ServiceTags(t *testing.T) {
-	consulConfig := map[string]string{
-		"path":                 "seaTech/",
-		"service":              "astronomy",
-		"service_tags":         "deadbeef, cafeefac, deadc0de, feedface",
-		"redirect_addr":        "http://127.0.0.2:8200",
-		"check_timeout":        "6s",
-		"address":              "127.0.0.2",
-		"scheme":               "https",
-		"token":                "deadbeef-cafeefac-deadc0de-feedface",
-		"max_parallel":         "4",
-		"disable_registration": "false",
-	}
-	logger := logformat.NewVaultLogger(log.LevelTrace)
-
-	be, err := NewConsulBackend(consulConfig, logger)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	c, ok := be.(*ConsulBackend)
-	if !ok {
-		t.Fatalf("failed to create physical Consul backend")
-	}
-
-	expected := []string{"deadbeef", "cafeefac", "deadc0de", "feedface"}
-	actual := c.fetchServiceTags(false)
-	if !strutil.EquivalentSlices(actual, append(expected, "standby")) {
-		t.Fatalf("bad: expected:%s actual:%s", append(expected, "standby"), actual)
-	}
-
-	actual = c.fetchServiceTags(true)
-	if !strutil.EquivalentSlices(actual, append(expected, "active")) {
-		t.Fatalf("bad: expected:%s actual:%s", append(expected, "active"), actual)
-	}
-}
-
 func TestConsul_newConsulBackend(t *testing.T) {
 	tests := []struct {
 		name            string
 		consulConfig    map[string]string
 		fail            bool
-		redirectAddr    string
-		checkTimeout    time.Duration
 		path            string
-		service         string
 		address         string
 		scheme          string
 		token           string
 		max_parallel    int
-		disableReg      bool
 		consistencyMode string
 	}{
 		{
 			name:            "Valid default config",
 			consulConfig:    map[string]string{},
-			checkTimeout:    5 * time.Second,
-			redirectAddr:    "http://127.0.0.1:8200",
 			path:            "vault/",
-			service:         "vault",
 			address:         "127.0.0.1:8500",
 			scheme:          "http",
 			token:           "",
 			max_parallel:    4,
-			disableReg:      false,
 			consistencyMode: "default",
 		},
 		{
 			name: "Valid modified config",
 			consulConfig: map[string]string{
-				"path":                 "seaTech/",
-				"service":              "astronomy",
-				"redirect_addr":        "http://127.0.0.2:8200",
-				"check_timeout":        "6s",
-				"address":              "127.0.0.2",
-				"scheme":               "https",
-				"token":                "deadbeef-cafeefac-deadc0de-feedface",
-				"max_parallel":         "4",
-				"disable_registration": "false",
-				"consistency_mode":     "strong",
+				"path":             "seaTech/",
+				"address":          "127.0.0.2",
+				"scheme":           "https",
+				"token":            "deadbeef-cafeefac-deadc0de-feedface",
+				"max_parallel":     "4",
+				"consistency_mode": "strong",
 			},
-			checkTimeout:    6 * time.Second,
 			path:            "seaTech/",
-			service:         "astronomy",
-			redirectAddr:    "http://127.0.0.2:8200",
 			address:         "127.0.0.2",
 			scheme:          "https",
 			token:           "deadbeef-cafeefac-deadc0de-feedface",
@@ -172,10 +95,10 @@ func TestConsul_newConsulBackend(t *testing.T) {
 			consistencyMode: "strong",
 		},
 		{
-			name: "check timeout too short",
+			name: "invalid consistency mode",
 			fail: true,
 			consulConfig: map[string]string{
-				"check_timeout": "99ms",
+				"consistency_mode": "eventual",
 			},
 		},
 	}
@@ -198,33 +121,11 @@ func TestConsul_newConsulBackend(t *testing.T) {
 		if !ok {
 			t.Fatalf("Expected ConsulBackend: %s", test.name)
 		}
-		c.disableRegistration = true
-
-		if c.disableRegistration == false {
-			addr := os.Getenv("CONSUL_HTTP_ADDR")
-			if addr == "" {
-				continue
-			}
-		}
-
-		var shutdownCh physical.ShutdownChannel
-		waitGroup := &sync.WaitGroup{}
-		if err := c.RunServiceDiscovery(waitGroup, shutdownCh, test.redirectAddr, testActiveFunc(0.5), testSealedFunc(0.5)); err != nil {
-			t.Fatalf("bad: %v", err)
-		}
-
-		if test.checkTimeout != c.checkTimeout {
-			t.Errorf("bad: %v != %v", test.checkTimeout, c.checkTimeout)
-		}
 
 		if test.path != c.path {
 			t.Errorf("bad: %s %v != %v", test.name, test.path, c.path)
 		}
 
-		if test.service != c.serviceName {
-			t.Errorf("bad: %v != %v", test.service, c.serviceName)
-		}
-
 		if test.consistencyMode != c.consistencyMode {
 			t.Errorf("bad consistency_mode value: %v != %v", test.consistencyMode, c.consistencyMode)
 		}
@@ -236,155 +137,6 @@ func TestConsul_newConsulBackend(t *testing.T) {
 	}
 }
 
-func TestConsul_serviceTags(t *testing.T) {
-	tests := []struct {
-		active bool
-		tags   []string
-	}{
-		{
-			active: true,
-			tags:   []string{"active"},
-		},
-		{
-			active: false,
-			tags:   []string{"standby"},
-		},
-	}
-
-	c := testConsulBackend(t)
-
-	for _, test := range tests {
-		tags := c.fetchServiceTags(test.active)
-		if !reflect.DeepEqual(tags[:], test.tags[:]) {
-			t.Errorf("Bad %v: %v %v", test.active, tags, test.tags)
-		}
-	}
-}
-
-func TestConsul_setRedirectAddr(t *testing.T) {
-	tests := []struct {
-		addr string
-		host string
-		port int64
-		pass bool
-	}{
-		{
-			addr: "http://127.0.0.1:8200/",
-			host: "127.0.0.1",
-			port: 8200,
-			pass: true,
-		},
-		{
-			addr: "http://127.0.0.1:8200",
-			host: "127.0.0.1",
-			port: 8200,
-			pass: true,
-		},
-		{
-			addr: "https://127.0.0.1:8200",
-			host: "127.0.0.1",
-			port: 8200,
-			pass: true,
-		},
-		{
-			addr: "unix:///tmp/.vault.addr.sock",
-			host: "/tmp/.vault.addr.sock",
-			port: -1,
-			pass: true,
-		},
-		{
-			addr: "127.0.0.1:8200",
-			pass: false,
-		},
-		{
-			addr: "127.0.0.1",
-			pass: false,
-		},
-	}
-	for _, test := range tests {
-		c := testConsulBackend(t)
-		err := c.setRedirectAddr(test.addr)
-		if test.pass {
-			if err != nil {
-				t.Fatalf("bad: %v", err)
-			}
-		} else {
-			if err == nil {
-				t.Fatalf("bad, expected fail")
-			} else {
-				continue
-			}
-		}
-
-		if c.redirectHost != test.host {
-			t.Fatalf("bad: %v != %v", c.redirectHost, test.host)
-		}
-
-		if c.redirectPort != test.port {
-			t.Fatalf("bad: %v != %v", c.redirectPort, test.port)
-		}
-	}
-}
-
-func TestConsul_NotifyActiveStateChange(t *testing.T) {
-	c := testConsulBackend(t)
-
-	if err := c.NotifyActiveStateChange(); err != nil {
-		t.Fatalf("bad: %v", err)
-	}
-}
-
-func TestConsul_NotifySealedStateChange(t *testing.T) {
-	c := testConsulBackend(t)
-
-	if err := c.NotifySealedStateChange(); err != nil {
-		t.Fatalf("bad: %v", err)
-	}
-}
-
-func TestConsul_serviceID(t *testing.T) {
-	passingTests := []struct {
-		name         string
-		redirectAddr string
-		serviceName  string
-		expected     string
-	}{
-		{
-			name:         "valid host w/o slash",
-			redirectAddr: "http://127.0.0.1:8200",
-			serviceName:  "sea-tech-astronomy",
-			expected:     "sea-tech-astronomy:127.0.0.1:8200",
-		},
-		{
-			name:         "valid host w/ slash",
-			redirectAddr: "http://127.0.0.1:8200/",
-			serviceName:  "sea-tech-astronomy",
-			expected:     "sea-tech-astronomy:127.0.0.1:8200",
-		},
-		{
-			name:         "valid https host w/ slash",
-			redirectAddr: "https://127.0.0.1:8200/",
-			serviceName:  "sea-tech-astronomy",
-			expected:     "sea-tech-astronomy:127.0.0.1:8200",
-		},
-	}
-
-	for _, test := range passingTests {
-		c := testConsulBackendConfig(t, &consulConf{
-			"service": test.serviceName,
-		})
-
-		if err := c.setRedirectAddr(test.redirectAddr); err != nil {
-			t.Fatalf("bad: %s %v", test.name, err)
-		}
-
-		serviceID := c.serviceID()
-		if serviceID != test.expected {
-			t.Fatalf("bad: %v != %v", serviceID, test.expected)
-		}
-	}
-}
-
 func TestConsulBackend(t *testing.T) {
 	var token string
 	addr := os.Getenv("CONSUL_HTTP_ADDR")
@@ -424,6 +176,7 @@ func TestConsulBackend(t *testing.T) {
 
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
+	physical.ExerciseBackend_ListPage(t, b)
 }
 
 func TestConsulHABackend(t *testing.T) {
@@ -2,6 +2,7 @@ package couchdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -47,11 +48,12 @@ type couchDBList struct {
 	Rows      []couchDBListItem `json:"rows"`
 }
 
-func (m *couchDBClient) rev(key string) (string, error) {
+func (m *couchDBClient) rev(ctx context.Context, key string) (string, error) {
 	req, err := http.NewRequest("HEAD", fmt.Sprintf("%s/%s", m.endpoint, key), nil)
 	if err != nil {
 		return "", err
 	}
+	req = req.WithContext(ctx)
 	req.SetBasicAuth(m.username, m.password)
 
 	resp, err := m.Client.Do(req)
@@ -69,7 +71,7 @@ func (m *couchDBClient) rev(key string) (string, error) {
 	return etag[1 : len(etag)-1], nil
 }
 
-func (m *couchDBClient) put(e couchDBEntry) error {
+func (m *couchDBClient) put(ctx context.Context, e couchDBEntry) error {
 	bs, err := json.Marshal(e)
 	if err != nil {
 		return err
@@ -79,17 +81,19 @@ func (m *couchDBClient) put(e couchDBEntry) error {
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 	req.SetBasicAuth(m.username, m.password)
 	_, err = m.Client.Do(req)
 
 	return err
 }
 
-func (m *couchDBClient) get(key string) (*physical.Entry, error) {
+func (m *couchDBClient) get(ctx context.Context, key string) (*physical.Entry, error) {
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", m.endpoint, url.PathEscape(key)), nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	req.SetBasicAuth(m.username, m.password)
 	resp, err := m.Client.Do(req)
 	if err != nil {
@@ -112,8 +116,9 @@ func (m *couchDBClient) get(key string) (*physical.Entry, error) {
 	return entry.Entry, nil
 }
 
-func (m *couchDBClient) list(prefix string) ([]couchDBListItem, error) {
+func (m *couchDBClient) list(ctx context.Context, prefix string) ([]couchDBListItem, error) {
 	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/_all_docs", m.endpoint), nil)
+	req = req.WithContext(ctx)
 	req.SetBasicAuth(m.username, m.password)
 	values := req.URL.Query()
 	values.Set("skip", "0")
@@ -200,37 +205,37 @@ type couchDBEntry struct {
 }
 
 // Put is used to insert or update an entry
-func (m *CouchDBBackend) Put(entry *physical.Entry) error {
+func (m *CouchDBBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	return m.PutInternal(entry)
+	return m.PutInternal(ctx, entry)
 }
 
 // Get is used to fetch an entry
-func (m *CouchDBBackend) Get(key string) (*physical.Entry, error) {
+func (m *CouchDBBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	return m.GetInternal(key)
+	return m.GetInternal(ctx, key)
 }
 
 // Delete is used to permanently delete an entry
-func (m *CouchDBBackend) Delete(key string) error {
+func (m *CouchDBBackend) Delete(ctx context.Context, key string) error {
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	return m.DeleteInternal(key)
+	return m.DeleteInternal(ctx, key)
 }
 
 // List is used to list all the keys under a given prefix
-func (m *CouchDBBackend) List(prefix string) ([]string, error) {
+func (m *CouchDBBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"couchdb", "list"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	items, err := m.client.list(prefix)
+	items, err := m.client.list(ctx, prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -272,19 +277,19 @@ func NewTransactionalCouchDBBackend(conf map[string]string, logger log.Logger) (
 }
 
 // GetInternal is used to fetch an entry
-func (m *CouchDBBackend) GetInternal(key string) (*physical.Entry, error) {
+func (m *CouchDBBackend) GetInternal(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"couchdb", "get"}, time.Now())
 
-	return m.client.get(key)
+	return m.client.get(ctx, key)
 }
 
 // PutInternal is used to insert or update an entry
-func (m *CouchDBBackend) PutInternal(entry *physical.Entry) error {
+func (m *CouchDBBackend) PutInternal(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"couchdb", "put"}, time.Now())
 
-	revision, _ := m.client.rev(url.PathEscape(entry.Key))
+	revision, _ := m.client.rev(ctx, url.PathEscape(entry.Key))
 
-	return m.client.put(couchDBEntry{
+	return m.client.put(ctx, couchDBEntry{
 		Entry: entry,
 		Rev:   revision,
 		ID:    url.PathEscape(entry.Key),
@@ -292,12 +297,12 @@ func (m *CouchDBBackend) PutInternal(entry *physical.Entry) error {
 }
 
 // DeleteInternal is used to permanently delete an entry
-func (m *CouchDBBackend) DeleteInternal(key string) error {
+func (m *CouchDBBackend) DeleteInternal(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"couchdb", "delete"}, time.Now())
 
-	revision, _ := m.client.rev(url.PathEscape(key))
+	revision, _ := m.client.rev(ctx, url.PathEscape(key))
 	deleted := true
-	return m.client.put(couchDBEntry{
+	return m.client.put(ctx, couchDBEntry{
 		ID:      url.PathEscape(key),
 		Rev:     revision,
 		Deleted: &deleted,
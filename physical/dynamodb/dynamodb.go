@@ -1,6 +1,7 @@
 package dynamodb
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"net/http"
@@ -66,6 +67,10 @@ const (
 	// DynamoDBWatchRetryInterval is the amount of time to wait
 	// if a watch fails before trying again.
 	DynamoDBWatchRetryInterval = 5 * time.Second
+
+	// DynamoDBMaxTransactItems is the maximum number of items that a single
+	// TransactWriteItems request may write, directory records included.
+	DynamoDBMaxTransactItems = 10
 )
 
 // DynamoDBBackend is a physical backend that stores data in
@@ -240,7 +245,7 @@ func NewDynamoDBBackend(conf map[string]string, logger log.Logger) (physical.Bac
 }
 
 // Put is used to insert or update an entry
-func (d *DynamoDBBackend) Put(entry *physical.Entry) error {
+func (d *DynamoDBBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"dynamodb", "put"}, time.Now())
 
 	record := DynamoDBRecord{
@@ -274,17 +279,17 @@ func (d *DynamoDBBackend) Put(entry *physical.Entry) error {
 		})
 	}
 
-	return d.batchWriteRequests(requests)
+	return d.batchWriteRequests(ctx, requests)
 }
 
 // Get is used to fetch an entry
-func (d *DynamoDBBackend) Get(key string) (*physical.Entry, error) {
+func (d *DynamoDBBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"dynamodb", "get"}, time.Now())
 
 	d.permitPool.Acquire()
 	defer d.permitPool.Release()
 
-	resp, err := d.client.GetItem(&dynamodb.GetItemInput{
+	resp, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName:      aws.String(d.table),
 		ConsistentRead: aws.Bool(true),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -311,7 +316,7 @@ func (d *DynamoDBBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (d *DynamoDBBackend) Delete(key string) error {
+func (d *DynamoDBBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"dynamodb", "delete"}, time.Now())
 
 	requests := []*dynamodb.WriteRequest{{
@@ -327,7 +332,7 @@ func (d *DynamoDBBackend) Delete(key string) error {
 	prefixes := physical.Prefixes(key)
 	sort.Sort(sort.Reverse(sort.StringSlice(prefixes)))
 	for _, prefix := range prefixes {
-		hasChildren, err := d.hasChildren(prefix)
+		hasChildren, err := d.hasChildren(ctx, prefix)
 		if err != nil {
 			return err
 		}
@@ -343,12 +348,152 @@ func (d *DynamoDBBackend) Delete(key string) error {
 		}
 	}
 
-	return d.batchWriteRequests(requests)
+	return d.batchWriteRequests(ctx, requests)
+}
+
+// Transaction is used to run multiple entries atomically with a single
+// TransactWriteItems request. Entries on the same key are coalesced, and the
+// directory records added for the written keys count towards the limit of
+// DynamoDBMaxTransactItems items along with the entries. Directories left
+// empty by deletions are cleaned up once the transaction is committed.
+func (d *DynamoDBBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
+	defer metrics.MeasureSince([]string{"dynamodb", "transaction"}, time.Now())
+
+	items, deleted, directories, err := d.transactItems(txns)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	d.permitPool.Acquire()
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	d.permitPool.Release()
+	if err != nil {
+		return err
+	}
+
+	// clean up now empty 'folders'
+	var prefixes []string
+	seen := make(map[string]struct{})
+	for _, key := range deleted {
+		for _, prefix := range physical.Prefixes(key) {
+			if _, ok := directories[prefix]; ok {
+				continue
+			}
+			if _, ok := seen[prefix]; ok {
+				continue
+			}
+			seen[prefix] = struct{}{}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(prefixes)))
+	var requests []*dynamodb.WriteRequest
+	for _, prefix := range prefixes {
+		hasChildren, err := d.hasChildren(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		if !hasChildren {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: map[string]*dynamodb.AttributeValue{
+						"Path": {S: aws.String(recordPathForVaultKey(prefix))},
+						"Key":  {S: aws.String(fmt.Sprintf("%s/", recordKeyForVaultKey(prefix)))},
+					},
+				},
+			})
+		}
+	}
+
+	return d.batchWriteRequests(ctx, requests)
+}
+
+// transactItems returns the items written by a transaction of the entries,
+// along with the keys it deletes and the directories it writes records for.
+// It fails if that is more than DynamoDBMaxTransactItems items.
+func (d *DynamoDBBackend) transactItems(txns []physical.TxnEntry) ([]*dynamodb.TransactWriteItem, []string, map[string]struct{}, error) {
+	// The last entry on a key wins, and a single request may not touch the
+	// same item twice
+	var keys []string
+	last := make(map[string]*physical.TxnEntry, len(txns))
+	for i := range txns {
+		key := txns[i].Entry.Key
+		if _, ok := last[key]; !ok {
+			keys = append(keys, key)
+		}
+		last[key] = &txns[i]
+	}
+
+	var items []*dynamodb.TransactWriteItem
+	var deleted []string
+	directories := make(map[string]struct{})
+	for _, key := range keys {
+		txn := last[key]
+		switch txn.Operation {
+		case physical.PutOperation:
+			item, err := dynamodbattribute.ConvertToMap(DynamoDBRecord{
+				Path:  recordPathForVaultKey(key),
+				Key:   recordKeyForVaultKey(key),
+				Value: txn.Entry.Value,
+			})
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("could not convert record to DynamoDB item: %s", err)
+			}
+			items = append(items, &dynamodb.TransactWriteItem{
+				Put: &dynamodb.Put{
+					TableName: aws.String(d.table),
+					Item:      item,
+				},
+			})
+
+			for _, prefix := range physical.Prefixes(key) {
+				if _, ok := directories[prefix]; ok {
+					continue
+				}
+				directories[prefix] = struct{}{}
+				item, err := dynamodbattribute.ConvertToMap(DynamoDBRecord{
+					Path: recordPathForVaultKey(prefix),
+					Key:  fmt.Sprintf("%s/", recordKeyForVaultKey(prefix)),
+				})
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("could not convert prefix record to DynamoDB item: %s", err)
+				}
+				items = append(items, &dynamodb.TransactWriteItem{
+					Put: &dynamodb.Put{
+						TableName: aws.String(d.table),
+						Item:      item,
+					},
+				})
+			}
+		case physical.DeleteOperation:
+			items = append(items, &dynamodb.TransactWriteItem{
+				Delete: &dynamodb.Delete{
+					TableName: aws.String(d.table),
+					Key: map[string]*dynamodb.AttributeValue{
+						"Path": {S: aws.String(recordPathForVaultKey(key))},
+						"Key":  {S: aws.String(recordKeyForVaultKey(key))},
+					},
+				},
+			})
+			deleted = append(deleted, key)
+		default:
+			return nil, nil, nil, fmt.Errorf("%q is not a supported transaction operation", txn.Operation)
+		}
+	}
+	if len(items) > DynamoDBMaxTransactItems {
+		return nil, nil, nil, fmt.Errorf("transaction writes %d items including %d directory records, more than the %d DynamoDB supports", len(items), len(directories), DynamoDBMaxTransactItems)
+	}
+	return items, deleted, directories, nil
 }
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (d *DynamoDBBackend) List(prefix string) ([]string, error) {
+func (d *DynamoDBBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"dynamodb", "list"}, time.Now())
 
 	prefix = strings.TrimSuffix(prefix, "/")
@@ -371,13 +516,70 @@ func (d *DynamoDBBackend) List(prefix string) ([]string, error) {
 	d.permitPool.Acquire()
 	defer d.permitPool.Release()
 
-	err := d.client.QueryPages(queryInput, func(out *dynamodb.QueryOutput, lastPage bool) bool {
+	err := d.client.QueryPagesWithContext(ctx, queryInput, func(out *dynamodb.QueryOutput, lastPage bool) bool {
+		var record DynamoDBRecord
+		for _, item := range out.Items {
+			dynamodbattribute.ConvertFromMap(item, &record)
+			if !strings.HasPrefix(record.Key, DynamoDBLockPrefix) {
+				keys = append(keys, record.Key)
+			}
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ListPage is used to list a page of the keys under a given prefix. The
+// keys of a path are the sort key of the table, so DynamoDB returns them in
+// order starting after the given key.
+func (d *DynamoDBBackend) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	defer metrics.MeasureSince([]string{"dynamodb", "list-page"}, time.Now())
+
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	keys := []string{}
+	prefix = escapeEmptyPath(prefix)
+	queryInput := &dynamodb.QueryInput{
+		TableName:      aws.String(d.table),
+		ConsistentRead: aws.Bool(true),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"Path": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{{
+					S: aws.String(prefix),
+				}},
+			},
+		},
+	}
+	if after != "" {
+		queryInput.KeyConditions["Key"] = &dynamodb.Condition{
+			ComparisonOperator: aws.String("GT"),
+			AttributeValueList: []*dynamodb.AttributeValue{{
+				S: aws.String(after),
+			}},
+		}
+	}
+	if limit > 0 {
+		queryInput.Limit = aws.Int64(int64(limit))
+	}
+
+	d.permitPool.Acquire()
+	defer d.permitPool.Release()
+
+	err := d.client.QueryPagesWithContext(ctx, queryInput, func(out *dynamodb.QueryOutput, lastPage bool) bool {
 		var record DynamoDBRecord
 		for _, item := range out.Items {
 			dynamodbattribute.ConvertFromMap(item, &record)
 			if !strings.HasPrefix(record.Key, DynamoDBLockPrefix) {
 				keys = append(keys, record.Key)
 			}
+			if limit > 0 && len(keys) >= limit {
+				return false
+			}
 		}
 		return !lastPage
 	})
@@ -391,7 +593,7 @@ func (d *DynamoDBBackend) List(prefix string) ([]string, error) {
 // hasChildren returns true if there exist items below a certain path prefix.
 // To do so, the method fetches such items from DynamoDB. If there are more
 // than one item (which is the "directory" item), there are children.
-func (d *DynamoDBBackend) hasChildren(prefix string) (bool, error) {
+func (d *DynamoDBBackend) hasChildren(ctx context.Context, prefix string) (bool, error) {
 	prefix = strings.TrimSuffix(prefix, "/")
 	prefix = escapeEmptyPath(prefix)
 
@@ -415,7 +617,7 @@ func (d *DynamoDBBackend) hasChildren(prefix string) (bool, error) {
 	d.permitPool.Acquire()
 	defer d.permitPool.Release()
 
-	out, err := d.client.Query(queryInput)
+	out, err := d.client.QueryWithContext(ctx, queryInput)
 	if err != nil {
 		return false, err
 	}
@@ -446,14 +648,14 @@ func (d *DynamoDBBackend) HAEnabled() bool {
 
 // batchWriteRequests takes a list of write requests and executes them in badges
 // with a maximum size of 25 (which is the limit of BatchWriteItem requests).
-func (d *DynamoDBBackend) batchWriteRequests(requests []*dynamodb.WriteRequest) error {
+func (d *DynamoDBBackend) batchWriteRequests(ctx context.Context, requests []*dynamodb.WriteRequest) error {
 	for len(requests) > 0 {
 		batchSize := int(math.Min(float64(len(requests)), 25))
 		batch := requests[:batchSize]
 		requests = requests[batchSize:]
 
 		d.permitPool.Acquire()
-		_, err := d.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		_, err := d.client.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
 			RequestItems: map[string][]*dynamodb.WriteRequest{
 				d.table: batch,
 			},
@@ -524,7 +726,7 @@ func (l *DynamoDBLock) Unlock() error {
 	}
 
 	l.held = false
-	if err := l.backend.Delete(l.key); err != nil {
+	if err := l.backend.Delete(context.Background(), l.key); err != nil {
 		return err
 	}
 	return nil
@@ -533,7 +735,7 @@ func (l *DynamoDBLock) Unlock() error {
 // Value checks whether or not the lock is held by any instance of DynamoDBLock,
 // including this one, and returns the current value.
 func (l *DynamoDBLock) Value() (bool, string, error) {
-	entry, err := l.backend.Get(l.key)
+	entry, err := l.backend.Get(context.Background(), l.key)
 	if err != nil {
 		return false, "", err
 	}
@@ -64,6 +64,8 @@ func TestDynamoDBBackend(t *testing.T) {
 
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
+	physical.ExerciseBackend_ListPage(t, b)
+	physical.ExerciseTransactionalBackend(t, b)
 }
 
 func TestDynamoDBHABackend(t *testing.T) {
@@ -119,6 +121,32 @@ func TestDynamoDBHABackend(t *testing.T) {
 // Similar to testHABackend, but using internal implementation details to
 // trigger the lock failure scenario by setting the lock renew period for one
 // of the locks to a higher value than the lock TTL.
+func TestDynamoDBBackend_TransactItems(t *testing.T) {
+	b := &DynamoDBBackend{table: "vault"}
+
+	var txns []physical.TxnEntry
+	for i := 0; i < DynamoDBMaxTransactItems; i++ {
+		txns = append(txns, physical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry:     &physical.Entry{Key: fmt.Sprintf("key%d", i)},
+		})
+	}
+	items, _, _, err := b.transactItems(txns)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(items) != DynamoDBMaxTransactItems {
+		t.Fatalf("bad: %d items", len(items))
+	}
+
+	// The directory record of the nested key pushes the transaction over
+	// the limit
+	txns[0].Entry.Key = "dir/key0"
+	if _, _, _, err := b.transactItems(txns); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 func testDynamoDBLockTTL(t *testing.T, ha physical.HABackend) {
 	// Set much smaller lock times to speed up the test.
 	lockTTL := time.Second * 3
@@ -170,19 +170,19 @@ func newEtcdV2Client(conf map[string]string) (client.Client, error) {
 }
 
 // Put is used to insert or update an entry.
-func (c *Etcd2Backend) Put(entry *physical.Entry) error {
+func (c *Etcd2Backend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"etcd", "put"}, time.Now())
 	value := base64.StdEncoding.EncodeToString(entry.Value)
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	_, err := c.kAPI.Set(context.Background(), c.nodePath(entry.Key), value, nil)
+	_, err := c.kAPI.Set(ctx, c.nodePath(entry.Key), value, nil)
 	return err
 }
 
 // Get is used to fetch an entry.
-func (c *Etcd2Backend) Get(key string) (*physical.Entry, error) {
+func (c *Etcd2Backend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"etcd", "get"}, time.Now())
 
 	c.permitPool.Acquire()
@@ -192,7 +192,7 @@ func (c *Etcd2Backend) Get(key string) (*physical.Entry, error) {
 		Recursive: false,
 		Sort:      false,
 	}
-	response, err := c.kAPI.Get(context.Background(), c.nodePath(key), getOpts)
+	response, err := c.kAPI.Get(ctx, c.nodePath(key), getOpts)
 	if err != nil {
 		if errorIsMissingKey(err) {
 			return nil, nil
@@ -214,7 +214,7 @@ func (c *Etcd2Backend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry.
-func (c *Etcd2Backend) Delete(key string) error {
+func (c *Etcd2Backend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"etcd", "delete"}, time.Now())
 
 	c.permitPool.Acquire()
@@ -224,7 +224,7 @@ func (c *Etcd2Backend) Delete(key string) error {
 	delOpts := &client.DeleteOptions{
 		Recursive: false,
 	}
-	_, err := c.kAPI.Delete(context.Background(), c.nodePath(key), delOpts)
+	_, err := c.kAPI.Delete(ctx, c.nodePath(key), delOpts)
 	if err != nil && !errorIsMissingKey(err) {
 		return err
 	}
@@ -233,7 +233,7 @@ func (c *Etcd2Backend) Delete(key string) error {
 
 // List is used to list all the keys under a given prefix, up to the next
 // prefix.
-func (c *Etcd2Backend) List(prefix string) ([]string, error) {
+func (c *Etcd2Backend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"etcd", "list"}, time.Now())
 
 	// Set a directory path from the given prefix.
@@ -248,7 +248,7 @@ func (c *Etcd2Backend) List(prefix string) ([]string, error) {
 		Recursive: false,
 		Sort:      true,
 	}
-	response, err := c.kAPI.Get(context.Background(), path, getOpts)
+	response, err := c.kAPI.Get(ctx, path, getOpts)
 	if err != nil {
 		if errorIsMissingKey(err) {
 			return []string{}, nil
@@ -20,6 +20,10 @@ import (
 	"golang.org/x/net/context"
 )
 
+// etcd3ListBatchSize is the number of keys read at once by paginated
+// listings.
+const etcd3ListBatchSize = 1000
+
 // EtcdBackend is a physical backend that stores data at specific
 // prefix within etcd. It is used for most production situations as
 // it allows Vault to run on multiple machines in a highly-available manner.
@@ -140,25 +144,25 @@ func newEtcd3Backend(conf map[string]string, logger log.Logger) (physical.Backen
 	}, nil
 }
 
-func (c *EtcdBackend) Put(entry *physical.Entry) error {
+func (c *EtcdBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"etcd", "put"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	ctx, cancel := context.WithTimeout(ctx, etcd3RequestTimeout)
 	defer cancel()
 	_, err := c.etcd.Put(ctx, path.Join(c.path, entry.Key), string(entry.Value))
 	return err
 }
 
-func (c *EtcdBackend) Get(key string) (*physical.Entry, error) {
+func (c *EtcdBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"etcd", "get"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	ctx, cancel := context.WithTimeout(ctx, etcd3RequestTimeout)
 	defer cancel()
 	resp, err := c.etcd.Get(ctx, path.Join(c.path, key))
 	if err != nil {
@@ -177,13 +181,13 @@ func (c *EtcdBackend) Get(key string) (*physical.Entry, error) {
 	}, nil
 }
 
-func (c *EtcdBackend) Delete(key string) error {
+func (c *EtcdBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"etcd", "delete"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	ctx, cancel := context.WithTimeout(ctx, etcd3RequestTimeout)
 	defer cancel()
 	_, err := c.etcd.Delete(ctx, path.Join(c.path, key))
 	if err != nil {
@@ -192,13 +196,13 @@ func (c *EtcdBackend) Delete(key string) error {
 	return nil
 }
 
-func (c *EtcdBackend) List(prefix string) ([]string, error) {
+func (c *EtcdBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"etcd", "list"}, time.Now())
 
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	ctx, cancel := context.WithTimeout(ctx, etcd3RequestTimeout)
 	defer cancel()
 	prefix = path.Join(c.path, prefix) + "/"
 	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix())
@@ -224,6 +228,73 @@ func (c *EtcdBackend) List(prefix string) ([]string, error) {
 	return keys, nil
 }
 
+// ListPage is used to list a page of the keys under a given prefix. Keys
+// are read from etcd in sorted batches, skipping over the contents of the
+// folders found along the way.
+func (c *EtcdBackend) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	defer metrics.MeasureSince([]string{"etcd", "list-page"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	prefix = path.Join(c.path, prefix) + "/"
+	end := clientv3.GetPrefixRangeEnd(prefix)
+	start := prefix
+	if after != "" {
+		start = etcdKeyAfter(prefix + after)
+	}
+
+	keys := []string{}
+	for limit <= 0 || len(keys) < limit {
+		reqCtx, cancel := context.WithTimeout(ctx, etcd3RequestTimeout)
+		resp, err := c.etcd.Get(reqCtx, start, clientv3.WithRange(end), clientv3.WithKeysOnly(), clientv3.WithLimit(etcd3ListBatchSize))
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Kvs) == 0 {
+			break
+		}
+
+		next := ""
+		for _, kv := range resp.Kvs {
+			key := strings.TrimPrefix(string(kv.Key), prefix)
+			key = strings.TrimPrefix(key, "/")
+			if len(key) == 0 {
+				continue
+			}
+
+			if i := strings.Index(key, "/"); i != -1 {
+				// Continue after the contents of the folder
+				keys = append(keys, key[:i+1])
+				next = etcdKeyAfter(prefix + key[:i+1])
+				break
+			}
+			keys = append(keys, key)
+			if limit > 0 && len(keys) >= limit {
+				break
+			}
+		}
+		if next == "" {
+			if !resp.More {
+				break
+			}
+			next = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+		}
+		start = next
+	}
+	return keys, nil
+}
+
+// etcdKeyAfter returns the first possible key sorting after the given key
+// and, for a folder, after all keys in it.
+func etcdKeyAfter(key string) string {
+	if strings.HasSuffix(key, "/") {
+		return key[:len(key)-1] + string('/'+1)
+	}
+	return key + "\x00"
+}
+
 func (e *EtcdBackend) HAEnabled() bool {
 	return e.haEnabled
 }
@@ -29,6 +29,7 @@ func TestEtcd3Backend(t *testing.T) {
 
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
+	physical.ExerciseBackend_ListPage(t, b)
 
 	ha, ok := b.(physical.HABackend)
 	if !ok {
@@ -1,14 +1,17 @@
 package file
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
+	multierror "github.com/hashicorp/go-multierror"
 	log "github.com/mgutz/logxi/v1"
 
 	"github.com/hashicorp/vault/helper/consts"
@@ -16,6 +19,15 @@ import (
 	"github.com/hashicorp/vault/physical"
 )
 
+// fileListBatchSize is the number of directory entries read at once when
+// listing keys.
+const fileListBatchSize = 1024
+
+// fileJournalName is the name of the file that holds the journal of the
+// transaction being applied. Keys cannot contain "..", so it never collides
+// with the files of entries.
+const fileJournalName = "..journal"
+
 // FileBackend is a physical backend that stores data on disk
 // at a given file path. It can be used for durable single server
 // situations, or to develop locally where durability is not critical.
@@ -41,11 +53,15 @@ func NewFileBackend(conf map[string]string, logger log.Logger) (physical.Backend
 		return nil, fmt.Errorf("'path' must be set")
 	}
 
-	return &FileBackend{
+	b := &FileBackend{
 		path:       path,
 		logger:     logger,
 		permitPool: physical.NewPermitPool(physical.DefaultParallelOperations),
-	}, nil
+	}
+	if err := b.recoverJournal(); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
 func NewTransactionalFileBackend(conf map[string]string, logger log.Logger) (physical.Backend, error) {
@@ -55,30 +71,38 @@ func NewTransactionalFileBackend(conf map[string]string, logger log.Logger) (phy
 	}
 
 	// Create a pool of size 1 so only one operation runs at a time
-	return &TransactionalFileBackend{
+	b := &TransactionalFileBackend{
 		FileBackend: FileBackend{
 			path:       path,
 			logger:     logger,
 			permitPool: physical.NewPermitPool(1),
 		},
-	}, nil
+	}
+	if err := b.recoverJournal(); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
-func (b *FileBackend) Delete(path string) error {
+func (b *FileBackend) Delete(ctx context.Context, path string) error {
 	b.permitPool.Acquire()
 	defer b.permitPool.Release()
 
 	b.Lock()
 	defer b.Unlock()
 
-	return b.DeleteInternal(path)
+	return b.DeleteInternal(ctx, path)
 }
 
-func (b *FileBackend) DeleteInternal(path string) error {
+func (b *FileBackend) DeleteInternal(ctx context.Context, path string) error {
 	if path == "" {
 		return nil
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if err := b.validatePath(path); err != nil {
 		return err
 	}
@@ -133,17 +157,21 @@ func (b *FileBackend) cleanupLogicalPath(path string) error {
 	return nil
 }
 
-func (b *FileBackend) Get(k string) (*physical.Entry, error) {
+func (b *FileBackend) Get(ctx context.Context, k string) (*physical.Entry, error) {
 	b.permitPool.Acquire()
 	defer b.permitPool.Release()
 
 	b.RLock()
 	defer b.RUnlock()
 
-	return b.GetInternal(k)
+	return b.GetInternal(ctx, k)
 }
 
-func (b *FileBackend) GetInternal(k string) (*physical.Entry, error) {
+func (b *FileBackend) GetInternal(ctx context.Context, k string) (*physical.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if err := b.validatePath(k); err != nil {
 		return nil, err
 	}
@@ -171,17 +199,21 @@ func (b *FileBackend) GetInternal(k string) (*physical.Entry, error) {
 	return &entry, nil
 }
 
-func (b *FileBackend) Put(entry *physical.Entry) error {
+func (b *FileBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	b.permitPool.Acquire()
 	defer b.permitPool.Release()
 
 	b.Lock()
 	defer b.Unlock()
 
-	return b.PutInternal(entry)
+	return b.PutInternal(ctx, entry)
 }
 
-func (b *FileBackend) PutInternal(entry *physical.Entry) error {
+func (b *FileBackend) PutInternal(ctx context.Context, entry *physical.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if err := b.validatePath(entry.Key); err != nil {
 		return err
 	}
@@ -208,19 +240,59 @@ func (b *FileBackend) PutInternal(entry *physical.Entry) error {
 	return enc.Encode(entry)
 }
 
-func (b *FileBackend) List(prefix string) ([]string, error) {
+func (b *FileBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	b.permitPool.Acquire()
 	defer b.permitPool.Release()
 
 	b.RLock()
 	defer b.RUnlock()
 
-	return b.ListInternal(prefix)
+	return b.ListInternal(ctx, prefix)
+}
+
+func (b *FileBackend) ListInternal(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := b.readKeys(ctx, prefix, func(batch []string) {
+		names = append(names, batch...)
+	})
+	return names, err
+}
+
+// ListPage lists a page of the keys under the prefix. Directory entries are
+// not sorted on disk, so all of them are read, but only the requested page
+// is kept in memory.
+func (b *FileBackend) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	b.RLock()
+	defer b.RUnlock()
+
+	var page []string
+	err := b.readKeys(ctx, prefix, func(batch []string) {
+		for _, name := range batch {
+			if after != "" && name <= after {
+				continue
+			}
+			i := sort.SearchStrings(page, name)
+			if limit > 0 && i >= limit {
+				continue
+			}
+			page = append(page, "")
+			copy(page[i+1:], page[i:])
+			page[i] = name
+			if limit > 0 && len(page) > limit {
+				page = page[:limit]
+			}
+		}
+	})
+	return page, err
 }
 
-func (b *FileBackend) ListInternal(prefix string) ([]string, error) {
+// readKeys calls f with batches of the keys found under the prefix.
+func (b *FileBackend) readKeys(ctx context.Context, prefix string, f func([]string)) error {
 	if err := b.validatePath(prefix); err != nil {
-		return nil, err
+		return err
 	}
 
 	path := b.path
@@ -229,32 +301,44 @@ func (b *FileBackend) ListInternal(prefix string) ([]string, error) {
 	}
 
 	// Read the directory contents
-	f, err := os.Open(path)
-	if f != nil {
-		defer f.Close()
+	dir, err := os.Open(path)
+	if dir != nil {
+		defer dir.Close()
 	}
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return nil
 		}
 
-		return nil, err
+		return err
 	}
 
-	names, err := f.Readdirnames(-1)
-	if err != nil {
-		return nil, err
-	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	for i, name := range names {
-		if name[0] == '_' {
-			names[i] = name[1:]
-		} else {
-			names[i] = name + "/"
+		names, err := dir.Readdirnames(fileListBatchSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
-	}
 
-	return names, nil
+		keys := names[:0]
+		for _, name := range names {
+			switch {
+			case strings.HasPrefix(name, ".."):
+				// The journal is not an entry
+			case name[0] == '_':
+				keys = append(keys, name[1:])
+			default:
+				keys = append(keys, name+"/")
+			}
+		}
+		f(keys)
+	}
 }
 
 func (b *FileBackend) expandPath(k string) (string, string) {
@@ -273,12 +357,161 @@ func (b *FileBackend) validatePath(path string) error {
 	return nil
 }
 
-func (b *TransactionalFileBackend) Transaction(txns []physical.TxnEntry) error {
+// Transaction applies the operations so that either all or none of them
+// take effect. Before anything is changed, the current state of the keys is
+// written to a journal, which is removed once all operations have been
+// applied. If an operation fails, or Vault stops before the journal was
+// removed, the keys are restored from the journal.
+func (b *FileBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
 	b.permitPool.Acquire()
 	defer b.permitPool.Release()
 
 	b.Lock()
 	defer b.Unlock()
 
-	return physical.GenericTransactionHandler(b, txns)
+	undo, err := b.undoEntries(ctx, txns)
+	if err != nil {
+		return err
+	}
+	if err := b.writeJournal(undo); err != nil {
+		return err
+	}
+
+	err = b.applyEntries(ctx, txns)
+	if err == nil {
+		err = b.removeJournal()
+	}
+	if err != nil {
+		if rollbackErr := b.applyEntries(context.Background(), undo); rollbackErr != nil {
+			// The journal stays in place so the rollback is retried when
+			// the backend is next created
+			return multierror.Append(err, rollbackErr)
+		}
+		if removeErr := b.removeJournal(); removeErr != nil {
+			return multierror.Append(err, removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// undoEntries returns the operations that restore the current state of the
+// keys changed by the transaction.
+func (b *FileBackend) undoEntries(ctx context.Context, txns []physical.TxnEntry) ([]physical.TxnEntry, error) {
+	seen := make(map[string]struct{}, len(txns))
+	undo := make([]physical.TxnEntry, 0, len(txns))
+	for _, txn := range txns {
+		if _, ok := seen[txn.Entry.Key]; ok {
+			continue
+		}
+		seen[txn.Entry.Key] = struct{}{}
+
+		entry, err := b.GetInternal(ctx, txn.Entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			undo = append(undo, physical.TxnEntry{
+				Operation: physical.DeleteOperation,
+				Entry:     &physical.Entry{Key: txn.Entry.Key},
+			})
+		} else {
+			undo = append(undo, physical.TxnEntry{
+				Operation: physical.PutOperation,
+				Entry:     entry,
+			})
+		}
+	}
+	return undo, nil
+}
+
+// applyEntries applies the operations in order, stopping at the first one
+// that fails.
+func (b *FileBackend) applyEntries(ctx context.Context, txns []physical.TxnEntry) error {
+	for _, txn := range txns {
+		var err error
+		switch txn.Operation {
+		case physical.PutOperation:
+			err = b.PutInternal(ctx, txn.Entry)
+		case physical.DeleteOperation:
+			err = b.DeleteInternal(ctx, txn.Entry.Key)
+		default:
+			err = fmt.Errorf("%q is not a supported transaction operation", txn.Operation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJournal durably stores the operations that undo a transaction. The
+// journal is written to a temporary file first and renamed into place, so
+// that an incomplete journal is never used.
+func (b *FileBackend) writeJournal(undo []physical.TxnEntry) error {
+	if err := os.MkdirAll(b.path, 0700); err != nil {
+		return err
+	}
+
+	journalPath := filepath.Join(b.path, fileJournalName)
+	f, err := os.OpenFile(journalPath+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(undo); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(journalPath+".tmp", journalPath)
+}
+
+// removeJournal removes the journal of a transaction, after which it can no
+// longer be undone.
+func (b *FileBackend) removeJournal() error {
+	err := os.Remove(filepath.Join(b.path, fileJournalName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// recoverJournal undoes a transaction that was interrupted before it was
+// completely applied.
+func (b *FileBackend) recoverJournal() error {
+	// Nothing can have been journaled until the directory is created
+	if fi, err := os.Stat(b.path); err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	journalPath := filepath.Join(b.path, fileJournalName)
+	if err := os.Remove(journalPath + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Open(journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var undo []physical.TxnEntry
+	if err := jsonutil.DecodeJSONFromReader(f, &undo); err != nil {
+		return fmt.Errorf("failed to decode transaction journal: %v", err)
+	}
+	if err := b.applyEntries(context.Background(), undo); err != nil {
+		return fmt.Errorf("failed to roll back interrupted transaction: %v", err)
+	}
+	b.logger.Warn("file: rolled back interrupted transaction", "keys", len(undo))
+
+	return b.removeJournal()
 }
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -30,7 +31,7 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 	}
 
 	// List the entries. Length should be zero.
-	keys, err := b.List("")
+	keys, err := b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -52,7 +53,7 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 	f.Close()
 
 	// Get should work
-	out, err := b.Get("foo")
+	out, err := b.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -61,7 +62,7 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 	}
 
 	// List the entries. There should be one entry.
-	keys, err = b.List("")
+	keys, err = b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -69,13 +70,13 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 		t.Fatalf("bad: len(keys): expected: 1, actual: %d", len(keys))
 	}
 
-	err = b.Put(e)
+	err = b.Put(context.Background(), e)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// List the entries again. There should still be one entry.
-	keys, err = b.List("")
+	keys, err = b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -84,7 +85,7 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 	}
 
 	// Get should work
-	out, err = b.Get("foo")
+	out, err = b.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -92,12 +93,12 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 		t.Fatalf("bad: %v expected: %v", out, e)
 	}
 
-	err = b.Delete("foo")
+	err = b.Delete(context.Background(), "foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
-	out, err = b.Get("foo")
+	out, err = b.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -105,7 +106,7 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 		t.Fatalf("bad: entry: expected: nil, actual: %#v", e)
 	}
 
-	keys, err = b.List("")
+	keys, err = b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -123,7 +124,7 @@ func TestFileBackend_Base64URLEncoding(t *testing.T) {
 	json.NewEncoder(f).Encode(e)
 	f.Close()
 
-	keys, err = b.List("")
+	keys, err = b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -148,10 +149,10 @@ func TestFileBackend_ValidatePath(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if err := b.Delete("foo/bar/../zip"); err == nil {
+	if err := b.Delete(context.Background(), "foo/bar/../zip"); err == nil {
 		t.Fatal("expected error")
 	}
-	if err := b.Delete("foo/bar/zip"); err != nil {
+	if err := b.Delete(context.Background(), "foo/bar/zip"); err != nil {
 		t.Fatal("did not expect error")
 	}
 }
@@ -174,4 +175,126 @@ func TestFileBackend(t *testing.T) {
 
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
+	physical.ExerciseBackend_ListPage(t, b)
+}
+
+func TestFileBackend_Transaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	b, err := NewFileBackend(map[string]string{
+		"path": dir,
+	}, logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	physical.ExerciseTransactionalBackend(t, b)
+
+	if _, err := os.Stat(filepath.Join(dir, fileJournalName)); !os.IsNotExist(err) {
+		t.Fatalf("journal should be removed, got: %v", err)
+	}
+
+	// A failing operation rolls back the ones applied before it
+	err = b.(physical.Transactional).Transaction(context.Background(), []physical.TxnEntry{
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo", Value: []byte("changed")}},
+		{Operation: physical.DeleteOperation, Entry: &physical.Entry{Key: "zip"}},
+		{Operation: "bad", Entry: &physical.Entry{Key: "new"}},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	entry, err := b.Get(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || string(entry.Value) != "bar3" {
+		t.Fatalf("bad: %#v", entry)
+	}
+	entry, err = b.Get(context.Background(), "zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || string(entry.Value) != "zap3" {
+		t.Fatalf("bad: %#v", entry)
+	}
+}
+
+func TestFileBackend_TransactionRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	raw, err := NewFileBackend(map[string]string{
+		"path": dir,
+	}, logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	b := raw.(*FileBackend)
+
+	if err := b.Put(context.Background(), &physical.Entry{Key: "foo/bar", Value: []byte("baz")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Apply half of a transaction as if Vault stopped while applying it
+	txns := []physical.TxnEntry{
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/bar", Value: []byte("changed")}},
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/new", Value: []byte("new")}},
+		{Operation: physical.DeleteOperation, Entry: &physical.Entry{Key: "other"}},
+	}
+	undo, err := b.undoEntries(context.Background(), txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeJournal(undo); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.applyEntries(context.Background(), txns[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The journal is not listed as a key
+	keys, err := b.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"foo/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Creating the backend again rolls the transaction back
+	raw, err = NewFileBackend(map[string]string{
+		"path": dir,
+	}, logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	b = raw.(*FileBackend)
+
+	entry, err := b.Get(context.Background(), "foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || string(entry.Value) != "baz" {
+		t.Fatalf("bad: %#v", entry)
+	}
+	entry, err = b.Get(context.Background(), "foo/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatalf("bad: %#v", entry)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fileJournalName)); !os.IsNotExist(err) {
+		t.Fatalf("journal should be removed, got: %v", err)
+	}
 }
@@ -3,6 +3,7 @@ package gcs
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"sort"
 	"strconv"
@@ -16,6 +17,7 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/armon/go-metrics"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -27,6 +29,7 @@ type GCSBackend struct {
 	client     *storage.Client
 	permitPool *physical.PermitPool
 	logger     log.Logger
+	haEnabled  bool
 }
 
 // NewGCSBackend constructs a Google Cloud Storage backend using a pre-existing
@@ -66,11 +69,20 @@ func NewGCSBackend(conf map[string]string, logger log.Logger) (physical.Backend,
 		}
 	}
 
+	var haEnabled bool
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
 	g := GCSBackend{
 		bucketName: bucketName,
 		client:     client,
 		permitPool: physical.NewPermitPool(maxParInt),
 		logger:     logger,
+		haEnabled:  haEnabled,
 	}
 
 	return &g, nil
@@ -100,11 +112,11 @@ func newGCSClient(ctx context.Context, conf map[string]string, logger log.Logger
 }
 
 // Put is used to insert or update an entry
-func (g *GCSBackend) Put(entry *physical.Entry) error {
+func (g *GCSBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"gcs", "put"}, time.Now())
 
 	bucket := g.client.Bucket(g.bucketName)
-	writer := bucket.Object(entry.Key).NewWriter(context.Background())
+	writer := bucket.Object(entry.Key).NewWriter(ctx)
 
 	g.permitPool.Acquire()
 	defer g.permitPool.Release()
@@ -116,11 +128,11 @@ func (g *GCSBackend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch an entry
-func (g *GCSBackend) Get(key string) (*physical.Entry, error) {
+func (g *GCSBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"gcs", "get"}, time.Now())
 
 	bucket := g.client.Bucket(g.bucketName)
-	reader, err := bucket.Object(key).NewReader(context.Background())
+	reader, err := bucket.Object(key).NewReader(ctx)
 
 	// return (nil, nil) if object doesn't exist
 	if err == storage.ErrObjectNotExist {
@@ -147,7 +159,7 @@ func (g *GCSBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (g *GCSBackend) Delete(key string) error {
+func (g *GCSBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"gcs", "delete"}, time.Now())
 
 	bucket := g.client.Bucket(g.bucketName)
@@ -155,7 +167,7 @@ func (g *GCSBackend) Delete(key string) error {
 	g.permitPool.Acquire()
 	defer g.permitPool.Release()
 
-	err := bucket.Object(key).Delete(context.Background())
+	err := bucket.Object(key).Delete(ctx)
 
 	// deletion of non existent object is OK
 	if err == storage.ErrObjectNotExist {
@@ -169,13 +181,13 @@ func (g *GCSBackend) Delete(key string) error {
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (g *GCSBackend) List(prefix string) ([]string, error) {
+func (g *GCSBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"gcs", "list"}, time.Now())
 
 	bucket := g.client.Bucket(g.bucketName)
 
 	objects_it := bucket.Objects(
-		context.Background(),
+		ctx,
 		&storage.Query{
 			Prefix:    prefix,
 			Delimiter: "/",
@@ -214,3 +226,115 @@ func (g *GCSBackend) List(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// GetVersion is used to fetch an entry along with its generation
+func (g *GCSBackend) GetVersion(ctx context.Context, key string) (*physical.Entry, string, error) {
+	defer metrics.MeasureSince([]string{"gcs", "get-version"}, time.Now())
+
+	g.permitPool.Acquire()
+	defer g.permitPool.Release()
+
+	object := g.client.Bucket(g.bucketName).Object(key)
+	attrs, err := object.Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", fmt.Errorf("error reading attributes of object '%v': '%v'", key, err)
+	}
+
+	// Read the generation the attributes belong to. If it was replaced in
+	// the meantime, report the object as missing so that conditional writes
+	// fail.
+	reader, err := object.Generation(attrs.Generation).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", fmt.Errorf("error creating bucket reader: '%v'", err)
+	}
+	defer reader.Close()
+
+	value, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading object '%v': '%v'", key, err)
+	}
+
+	ent := physical.Entry{
+		Key:   key,
+		Value: value,
+	}
+	return &ent, strconv.FormatInt(attrs.Generation, 10), nil
+}
+
+// PutIfVersion is used to insert or update an entry only if its generation
+// matches the given one
+func (g *GCSBackend) PutIfVersion(ctx context.Context, entry *physical.Entry, version string) error {
+	defer metrics.MeasureSince([]string{"gcs", "put-if-version"}, time.Now())
+
+	conds, err := versionConditions(version)
+	if err != nil {
+		return err
+	}
+
+	g.permitPool.Acquire()
+	defer g.permitPool.Release()
+
+	writer := g.client.Bucket(g.bucketName).Object(entry.Key).If(conds).NewWriter(ctx)
+	if _, err := writer.Write(entry.Value); err != nil {
+		writer.Close()
+		return conditionError(err)
+	}
+	return conditionError(writer.Close())
+}
+
+// DeleteIfVersion is used to permanently delete an entry only if its
+// generation matches the given one
+func (g *GCSBackend) DeleteIfVersion(ctx context.Context, key, version string) error {
+	defer metrics.MeasureSince([]string{"gcs", "delete-if-version"}, time.Now())
+
+	conds, err := versionConditions(version)
+	if err != nil {
+		return err
+	}
+
+	g.permitPool.Acquire()
+	defer g.permitPool.Release()
+
+	err = g.client.Bucket(g.bucketName).Object(key).If(conds).Delete(ctx)
+	return conditionError(err)
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (g *GCSBackend) LockWith(key, value string) (physical.Lock, error) {
+	return physical.NewConditionalLock(g, g.logger, "physical/gcs", key, value)
+}
+
+// HAEnabled returns whether conditional writes are used for locking.
+func (g *GCSBackend) HAEnabled() bool {
+	return g.haEnabled
+}
+
+// versionConditions returns the preconditions requiring the given
+// generation of an object. An empty version requires that the object does
+// not exist.
+func versionConditions(version string) (storage.Conditions, error) {
+	if version == "" {
+		return storage.Conditions{DoesNotExist: true}, nil
+	}
+	generation, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return storage.Conditions{}, fmt.Errorf("invalid object generation '%v': '%v'", version, err)
+	}
+	return storage.Conditions{GenerationMatch: generation}, nil
+}
+
+// conditionError translates the errors of conditional requests. GCS returns
+// 412 when the preconditions do not hold.
+func conditionError(err error) error {
+	if err == storage.ErrObjectNotExist {
+		return physical.ErrConditionFailed
+	}
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusPreconditionFailed {
+		return physical.ErrConditionFailed
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package inmem
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hashicorp/vault/helper/logformat"
@@ -33,16 +34,16 @@ func TestCache_Purge(t *testing.T) {
 		Key:   "foo",
 		Value: []byte("bar"),
 	}
-	err = cache.Put(ent)
+	err = cache.Put(context.Background(), ent)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Delete from under
-	inm.Delete("foo")
+	inm.Delete(context.Background(), "foo")
 
 	// Read should work
-	out, err := cache.Get("foo")
+	out, err := cache.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -54,7 +55,7 @@ func TestCache_Purge(t *testing.T) {
 	cache.Purge()
 
 	// Read should fail
-	out, err = cache.Get("foo")
+	out, err = cache.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -80,17 +81,17 @@ func TestCache_IgnoreCore(t *testing.T) {
 		Key:   "foo",
 		Value: []byte("bar"),
 	}
-	if err := cache.Put(ent); err != nil {
+	if err := cache.Put(context.Background(), ent); err != nil {
 		t.Fatal(err)
 	}
 	ent = &physical.Entry{
 		Key:   "foo",
 		Value: []byte("foobar"),
 	}
-	if err := inm.Put(ent); err != nil {
+	if err := inm.Put(context.Background(), ent); err != nil {
 		t.Fatal(err)
 	}
-	ent, err = cache.Get("foo")
+	ent, err = cache.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,17 +104,17 @@ func TestCache_IgnoreCore(t *testing.T) {
 		Key:   "core/foo",
 		Value: []byte("bar"),
 	}
-	if err := cache.Put(ent); err != nil {
+	if err := cache.Put(context.Background(), ent); err != nil {
 		t.Fatal(err)
 	}
 	ent = &physical.Entry{
 		Key:   "core/foo",
 		Value: []byte("foobar"),
 	}
-	if err := inm.Put(ent); err != nil {
+	if err := inm.Put(context.Background(), ent); err != nil {
 		t.Fatal(err)
 	}
-	ent, err = cache.Get("core/foo")
+	ent, err = cache.Get(context.Background(), "core/foo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -126,10 +127,10 @@ func TestCache_IgnoreCore(t *testing.T) {
 		Key:   "core/zip",
 		Value: []byte("zap"),
 	}
-	if err := inm.Put(ent); err != nil {
+	if err := inm.Put(context.Background(), ent); err != nil {
 		t.Fatal(err)
 	}
-	ent, err = cache.Get("core/zip")
+	ent, err = cache.Get(context.Background(), "core/zip")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -140,10 +141,10 @@ func TestCache_IgnoreCore(t *testing.T) {
 		Key:   "core/zip",
 		Value: []byte("zipzap"),
 	}
-	if err := inm.Put(ent); err != nil {
+	if err := inm.Put(context.Background(), ent); err != nil {
 		t.Fatal(err)
 	}
-	ent, err = cache.Get("core/zip")
+	ent, err = cache.Get(context.Background(), "core/zip")
 	if err != nil {
 		t.Fatal(err)
 	}
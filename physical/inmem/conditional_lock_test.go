@@ -0,0 +1,232 @@
+package inmem
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// conditionalInmem is a ConditionalBackend that versions its entries with
+// a counter, like the generations of an object store
+type conditionalInmem struct {
+	l        sync.Mutex
+	entries  map[string]*physical.Entry
+	versions map[string]string
+	counter  int
+	logger   log.Logger
+
+	// stalled makes requests hang until their context is done
+	stalled bool
+}
+
+func (c *conditionalInmem) stall(ctx context.Context) error {
+	c.l.Lock()
+	stalled := c.stalled
+	c.l.Unlock()
+	if !stalled {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newConditionalInmem() *conditionalInmem {
+	return &conditionalInmem{
+		entries:  make(map[string]*physical.Entry),
+		versions: make(map[string]string),
+		logger:   logformat.NewVaultLogger(log.LevelTrace),
+	}
+}
+
+func (c *conditionalInmem) GetVersion(ctx context.Context, key string) (*physical.Entry, string, error) {
+	if err := c.stall(ctx); err != nil {
+		return nil, "", err
+	}
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.entries[key], c.versions[key], nil
+}
+
+func (c *conditionalInmem) PutIfVersion(ctx context.Context, entry *physical.Entry, version string) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.versions[entry.Key] != version {
+		return physical.ErrConditionFailed
+	}
+	c.counter++
+	c.entries[entry.Key] = entry
+	c.versions[entry.Key] = strconv.Itoa(c.counter)
+	return nil
+}
+
+func (c *conditionalInmem) DeleteIfVersion(ctx context.Context, key, version string) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.versions[key] != version {
+		return physical.ErrConditionFailed
+	}
+	delete(c.entries, key)
+	delete(c.versions, key)
+	return nil
+}
+
+func (c *conditionalInmem) LockWith(key, value string) (physical.Lock, error) {
+	return physical.NewConditionalLock(c, c.logger, "inmem", key, value)
+}
+
+func (c *conditionalInmem) HAEnabled() bool {
+	return true
+}
+
+func TestConditionalLock(t *testing.T) {
+	c := newConditionalInmem()
+	physical.ExerciseHABackend(t, c, c)
+}
+
+func TestConditionalLock_Takeover(t *testing.T) {
+	c := newConditionalInmem()
+
+	lock, err := physical.NewConditionalLock(c, c.logger, "inmem", "takeover", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The lock expires before it is renewed
+	lock.TTL = 100 * time.Millisecond
+	lock.RenewInterval = 300 * time.Millisecond
+	lock.ExpiryMargin = 0
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh == nil {
+		t.Fatal("failed to get leader ch")
+	}
+
+	lock2, err := physical.NewConditionalLock(c, c.logger, "inmem", "takeover", "baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock2.RetryInterval = 10 * time.Millisecond
+	stopCh := make(chan struct{})
+	time.AfterFunc(time.Second, func() { close(stopCh) })
+	leaderCh2, err := lock2.Lock(stopCh)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh2 == nil {
+		t.Fatal("expired lock should be taken over")
+	}
+	defer lock2.Unlock()
+
+	held, val, err := lock2.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "baz" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+
+	// The first holder gave up leadership when its lock expired, and
+	// releasing it leaves the new holder alone
+	select {
+	case <-leaderCh:
+	case <-time.After(time.Second):
+		t.Fatal("leadership should be lost")
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	held, val, err = lock.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "baz" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+}
+
+func TestConditionalLock_Renew(t *testing.T) {
+	c := newConditionalInmem()
+
+	lock, err := physical.NewConditionalLock(c, c.logger, "inmem", "renew", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock.TTL = 200 * time.Millisecond
+	lock.RenewInterval = 20 * time.Millisecond
+	lock.ExpiryMargin = 50 * time.Millisecond
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer lock.Unlock()
+
+	// The lock stays held well past its TTL
+	select {
+	case <-leaderCh:
+		t.Fatal("leadership should not be lost")
+	case <-time.After(time.Second):
+	}
+
+	held, val, err := lock.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "bar" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+}
+
+func TestConditionalLock_StalledRenewal(t *testing.T) {
+	c := newConditionalInmem()
+
+	lock, err := physical.NewConditionalLock(c, c.logger, "inmem", "stalled", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock.TTL = 500 * time.Millisecond
+	lock.RenewInterval = 50 * time.Millisecond
+	lock.ExpiryMargin = 200 * time.Millisecond
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer func() {
+		c.l.Lock()
+		c.stalled = false
+		c.l.Unlock()
+		lock.Unlock()
+	}()
+
+	// Let a renewal go through, then make the backend hang
+	time.Sleep(100 * time.Millisecond)
+	c.l.Lock()
+	c.stalled = true
+	entry := c.entries["stalled"]
+	c.l.Unlock()
+	var record struct {
+		Expires int64 `json:"expires"`
+	}
+	if err := json.Unmarshal(entry.Value, &record); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Leadership is given up before the last written lock expires
+	select {
+	case <-leaderCh:
+	case <-time.After(time.Second):
+		t.Fatal("leadership should be lost")
+	}
+	if now := time.Now().UnixNano(); now >= record.Expires {
+		t.Fatalf("leadership was lost %v after the lock expired", time.Duration(now-record.Expires))
+	}
+}
@@ -1,6 +1,7 @@
 package inmem
 
 import (
+	"context"
 	"strings"
 	"sync"
 
@@ -48,33 +49,39 @@ func NewTransactionalInmem(_ map[string]string, logger log.Logger) (physical.Bac
 }
 
 // Put is used to insert or update an entry
-func (i *InmemBackend) Put(entry *physical.Entry) error {
+func (i *InmemBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
 	i.Lock()
 	defer i.Unlock()
 
-	return i.PutInternal(entry)
+	return i.PutInternal(ctx, entry)
 }
 
-func (i *InmemBackend) PutInternal(entry *physical.Entry) error {
+func (i *InmemBackend) PutInternal(ctx context.Context, entry *physical.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	i.root.Insert(entry.Key, entry)
 	return nil
 }
 
 // Get is used to fetch an entry
-func (i *InmemBackend) Get(key string) (*physical.Entry, error) {
+func (i *InmemBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
 	i.RLock()
 	defer i.RUnlock()
 
-	return i.GetInternal(key)
+	return i.GetInternal(ctx, key)
 }
 
-func (i *InmemBackend) GetInternal(key string) (*physical.Entry, error) {
+func (i *InmemBackend) GetInternal(ctx context.Context, key string) (*physical.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if raw, ok := i.root.Get(key); ok {
 		return raw.(*physical.Entry), nil
 	}
@@ -82,49 +89,64 @@ func (i *InmemBackend) GetInternal(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (i *InmemBackend) Delete(key string) error {
+func (i *InmemBackend) Delete(ctx context.Context, key string) error {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
 	i.Lock()
 	defer i.Unlock()
 
-	return i.DeleteInternal(key)
+	return i.DeleteInternal(ctx, key)
 }
 
-func (i *InmemBackend) DeleteInternal(key string) error {
+func (i *InmemBackend) DeleteInternal(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	i.root.Delete(key)
 	return nil
 }
 
 // List is used ot list all the keys under a given
 // prefix, up to the next prefix.
-func (i *InmemBackend) List(prefix string) ([]string, error) {
+func (i *InmemBackend) List(ctx context.Context, prefix string) ([]string, error) {
+	return i.ListPage(ctx, prefix, "", 0)
+}
+
+// ListPage is used to list a page of the keys under a given prefix, up to
+// the next prefix.
+func (i *InmemBackend) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
 	i.RLock()
 	defer i.RUnlock()
 
-	return i.ListInternal(prefix)
+	return i.ListPageInternal(ctx, prefix, after, limit)
 }
 
-func (i *InmemBackend) ListInternal(prefix string) ([]string, error) {
+func (i *InmemBackend) ListInternal(ctx context.Context, prefix string) ([]string, error) {
+	return i.ListPageInternal(ctx, prefix, "", 0)
+}
+
+func (i *InmemBackend) ListPageInternal(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// The tree is walked in lexical order, so the trimmed keys come out
+	// sorted, with the keys of a folder next to each other
 	var out []string
-	seen := make(map[string]interface{})
 	walkFn := func(s string, v interface{}) bool {
 		trimmed := strings.TrimPrefix(s, prefix)
-		sep := strings.Index(trimmed, "/")
-		if sep == -1 {
-			out = append(out, trimmed)
-		} else {
+		if sep := strings.Index(trimmed, "/"); sep != -1 {
 			trimmed = trimmed[:sep+1]
-			if _, ok := seen[trimmed]; !ok {
-				out = append(out, trimmed)
-				seen[trimmed] = struct{}{}
-			}
 		}
-		return false
+		if (after != "" && trimmed <= after) || (len(out) > 0 && out[len(out)-1] == trimmed) {
+			return false
+		}
+		out = append(out, trimmed)
+		return limit > 0 && len(out) >= limit
 	}
 	i.root.WalkPrefix(prefix, walkFn)
 
@@ -132,12 +154,12 @@ func (i *InmemBackend) ListInternal(prefix string) ([]string, error) {
 }
 
 // Implements the transaction interface
-func (t *TransactionalInmemBackend) Transaction(txns []physical.TxnEntry) error {
+func (t *TransactionalInmemBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
 	t.permitPool.Acquire()
 	defer t.permitPool.Release()
 
 	t.Lock()
 	defer t.Unlock()
 
-	return physical.GenericTransactionHandler(t, txns)
+	return physical.GenericTransactionHandler(ctx, t, txns)
 }
@@ -1,6 +1,7 @@
 package inmem
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sort"
@@ -15,53 +16,66 @@ import (
 type faultyPseudo struct {
 	underlying  InmemBackend
 	faultyPaths map[string]struct{}
+
+	// onFault, if set, is called before a fault is returned
+	onFault func()
 }
 
-func (f *faultyPseudo) Get(key string) (*physical.Entry, error) {
-	return f.underlying.Get(key)
+func (f *faultyPseudo) fault(key string) error {
+	if _, ok := f.faultyPaths[key]; !ok {
+		return nil
+	}
+	if f.onFault != nil {
+		f.onFault()
+	}
+	return fmt.Errorf("fault")
 }
 
-func (f *faultyPseudo) Put(entry *physical.Entry) error {
-	return f.underlying.Put(entry)
+func (f *faultyPseudo) Get(ctx context.Context, key string) (*physical.Entry, error) {
+	return f.underlying.Get(ctx, key)
 }
 
-func (f *faultyPseudo) Delete(key string) error {
-	return f.underlying.Delete(key)
+func (f *faultyPseudo) Put(ctx context.Context, entry *physical.Entry) error {
+	return f.underlying.Put(ctx, entry)
 }
 
-func (f *faultyPseudo) GetInternal(key string) (*physical.Entry, error) {
-	if _, ok := f.faultyPaths[key]; ok {
-		return nil, fmt.Errorf("fault")
+func (f *faultyPseudo) Delete(ctx context.Context, key string) error {
+	return f.underlying.Delete(ctx, key)
+}
+
+func (f *faultyPseudo) GetInternal(ctx context.Context, key string) (*physical.Entry, error) {
+	if err := f.fault(key); err != nil {
+		return nil, err
 	}
-	return f.underlying.GetInternal(key)
+	return f.underlying.GetInternal(ctx, key)
 }
 
-func (f *faultyPseudo) PutInternal(entry *physical.Entry) error {
-	if _, ok := f.faultyPaths[entry.Key]; ok {
-		return fmt.Errorf("fault")
+func (f *faultyPseudo) PutInternal(ctx context.Context, entry *physical.Entry) error {
+	if err := f.fault(entry.Key); err != nil {
+		return err
 	}
-	return f.underlying.PutInternal(entry)
+	return f.underlying.PutInternal(ctx, entry)
 }
 
-func (f *faultyPseudo) DeleteInternal(key string) error {
-	if _, ok := f.faultyPaths[key]; ok {
-		return fmt.Errorf("fault")
+func (f *faultyPseudo) DeleteInternal(ctx context.Context, key string) error {
+	if err := f.fault(key); err != nil {
+		return err
 	}
-	return f.underlying.DeleteInternal(key)
+	return f.underlying.DeleteInternal(ctx, key)
 }
 
-func (f *faultyPseudo) List(prefix string) ([]string, error) {
-	return f.underlying.List(prefix)
+func (f *faultyPseudo) List(ctx context.Context, prefix string) ([]string, error) {
+	return f.underlying.List(ctx, prefix)
 }
 
-func (f *faultyPseudo) Transaction(txns []physical.TxnEntry) error {
+func (f *faultyPseudo) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
 	f.underlying.permitPool.Acquire()
 	defer f.underlying.permitPool.Release()
 
 	f.underlying.Lock()
 	defer f.underlying.Unlock()
 
-	return physical.GenericTransactionHandler(f, txns)
+	return physical.GenericTransactionHandler(ctx, f, txns)
 }
 
 func newFaultyPseudo(logger log.Logger, faultyPaths []string) *faultyPseudo {
@@ -98,11 +112,11 @@ func TestPseudo_FailedTransaction(t *testing.T) {
 	p := newFaultyPseudo(logger, []string{"zip"})
 
 	txns := physical.SetupTestingTransactions(t, p)
-	if err := p.Transaction(txns); err == nil {
+	if err := p.Transaction(context.Background(), txns); err == nil {
 		t.Fatal("expected error during transaction")
 	}
 
-	keys, err := p.List("")
+	keys, err := p.List(context.Background(), "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -115,7 +129,7 @@ func TestPseudo_FailedTransaction(t *testing.T) {
 		t.Fatalf("mismatch: expected\n%#v\ngot\n%#v\n", expected, keys)
 	}
 
-	entry, err := p.Get("foo")
+	entry, err := p.Get(context.Background(), "foo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -129,7 +143,7 @@ func TestPseudo_FailedTransaction(t *testing.T) {
 		t.Fatal("values did not rollback correctly")
 	}
 
-	entry, err = p.Get("zip")
+	entry, err = p.Get(context.Background(), "zip")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -143,3 +157,35 @@ func TestPseudo_FailedTransaction(t *testing.T) {
 		t.Fatal("values did not rollback correctly")
 	}
 }
+
+func TestPseudo_FailedTransaction_CanceledContext(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	p := newFaultyPseudo(logger, []string{"zip"})
+
+	txns := physical.SetupTestingTransactions(t, p)
+
+	// Cancel the request as the transaction fails, the rollback must still
+	// be applied
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.onFault = cancel
+	if err := p.Transaction(ctx, txns); err == nil {
+		t.Fatal("expected error during transaction")
+	}
+
+	entry, err := p.Get(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || string(entry.Value) != "bar" {
+		t.Fatalf("values did not rollback correctly: %#v", entry)
+	}
+
+	entry, err = p.Get(context.Background(), "deleteme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Fatal("deleted value did not rollback correctly")
+	}
+}
@@ -1,6 +1,7 @@
 package physical
 
 import (
+	"context"
 	"math/rand"
 	"time"
 
@@ -60,31 +61,37 @@ func (l *LatencyInjector) addLatency() {
 }
 
 // Put is a latent put request
-func (l *LatencyInjector) Put(entry *Entry) error {
+func (l *LatencyInjector) Put(ctx context.Context, entry *Entry) error {
 	l.addLatency()
-	return l.backend.Put(entry)
+	return l.backend.Put(ctx, entry)
 }
 
 // Get is a latent get request
-func (l *LatencyInjector) Get(key string) (*Entry, error) {
+func (l *LatencyInjector) Get(ctx context.Context, key string) (*Entry, error) {
 	l.addLatency()
-	return l.backend.Get(key)
+	return l.backend.Get(ctx, key)
 }
 
 // Delete is a latent delete request
-func (l *LatencyInjector) Delete(key string) error {
+func (l *LatencyInjector) Delete(ctx context.Context, key string) error {
 	l.addLatency()
-	return l.backend.Delete(key)
+	return l.backend.Delete(ctx, key)
 }
 
 // List is a latent list request
-func (l *LatencyInjector) List(prefix string) ([]string, error) {
+func (l *LatencyInjector) List(ctx context.Context, prefix string) ([]string, error) {
 	l.addLatency()
-	return l.backend.List(prefix)
+	return l.backend.List(ctx, prefix)
+}
+
+// ListPage is a latent paginated list request
+func (l *LatencyInjector) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	l.addLatency()
+	return ListPage(ctx, l.backend, prefix, after, limit)
 }
 
 // Transaction is a latent transaction request
-func (l *TransactionalLatencyInjector) Transaction(txns []TxnEntry) error {
+func (l *TransactionalLatencyInjector) Transaction(ctx context.Context, txns []TxnEntry) error {
 	l.addLatency()
-	return l.Transactional.Transaction(txns)
+	return l.Transactional.Transaction(ctx, txns)
 }
@@ -1,6 +1,7 @@
 package mssql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"sort"
@@ -168,13 +169,13 @@ func (m *MSSQLBackend) prepare(name, query string) error {
 	return nil
 }
 
-func (m *MSSQLBackend) Put(entry *physical.Entry) error {
+func (m *MSSQLBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"mssql", "put"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	_, err := m.statements["put"].Exec(entry.Key, entry.Value, entry.Key, entry.Key, entry.Value)
+	_, err := m.statements["put"].ExecContext(ctx, entry.Key, entry.Value, entry.Key, entry.Key, entry.Value)
 	if err != nil {
 		return err
 	}
@@ -182,14 +183,14 @@ func (m *MSSQLBackend) Put(entry *physical.Entry) error {
 	return nil
 }
 
-func (m *MSSQLBackend) Get(key string) (*physical.Entry, error) {
+func (m *MSSQLBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"mssql", "get"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
 	var result []byte
-	err := m.statements["get"].QueryRow(key).Scan(&result)
+	err := m.statements["get"].QueryRowContext(ctx, key).Scan(&result)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -206,13 +207,13 @@ func (m *MSSQLBackend) Get(key string) (*physical.Entry, error) {
 	return ent, nil
 }
 
-func (m *MSSQLBackend) Delete(key string) error {
+func (m *MSSQLBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"mssql", "delete"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	_, err := m.statements["delete"].Exec(key)
+	_, err := m.statements["delete"].ExecContext(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -220,14 +221,14 @@ func (m *MSSQLBackend) Delete(key string) error {
 	return nil
 }
 
-func (m *MSSQLBackend) List(prefix string) ([]string, error) {
+func (m *MSSQLBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"mssql", "list"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
 	likePrefix := prefix + "%"
-	rows, err := m.statements["list"].Query(likePrefix)
+	rows, err := m.statements["list"].QueryContext(ctx, likePrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
@@ -17,10 +18,38 @@ import (
 	"github.com/armon/go-metrics"
 	mysql "github.com/go-sql-driver/mysql"
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/physical"
 )
 
+// mysqlListBatchSize is the number of keys read at once by paginated
+// listings.
+const mysqlListBatchSize = 1000
+
+const (
+	// MySQLLockTTL is the time a lock is valid for without being renewed.
+	// Expired locks can be taken over by other nodes.
+	MySQLLockTTL = 15 * time.Second
+
+	// MySQLLockRenewInterval is the amount of time to wait between lock
+	// renewals
+	MySQLLockRenewInterval = 5 * time.Second
+
+	// MySQLLockExpiryMargin is how long before the lock expires that its
+	// leadership is given up if it could not be renewed, so that the node
+	// has stepped down by the time another node can take the lock over
+	MySQLLockExpiryMargin = 3 * time.Second
+
+	// MySQLLockRetryInterval is the amount of time to wait if a lock fails
+	// before trying again
+	MySQLLockRetryInterval = time.Second
+
+	// mysqlDuplicateEntry is the error number MySQL returns when an insert
+	// conflicts with an existing row
+	mysqlDuplicateEntry = 1062
+)
+
 // Unreserved tls key
 // Reserved values are "true", "false", "skip-verify"
 const mysqlTLSKey = "default"
@@ -29,10 +58,25 @@ const mysqlTLSKey = "default"
 // within MySQL database.
 type MySQLBackend struct {
 	dbTable    string
+	dbHATable  string
 	client     *sql.DB
 	statements map[string]*sql.Stmt
 	logger     log.Logger
 	permitPool *physical.PermitPool
+	haEnabled  bool
+}
+
+// MySQLLock implements a lock using a row of the HA table. The row holds
+// the time until which the lock is valid, which the holder extends
+// periodically. Rows that were not renewed in time are taken over by other
+// nodes.
+type MySQLLock struct {
+	physical.TTLLock
+
+	backend  *MySQLBackend
+	key      string
+	value    string
+	identity string
 }
 
 // NewMySQLBackend constructs a MySQL backend using the given API client and
@@ -81,6 +125,19 @@ func NewMySQLBackend(conf map[string]string, logger log.Logger) (physical.Backen
 		maxParInt = physical.DefaultParallelOperations
 	}
 
+	var haEnabled bool
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+	haTable, ok := conf["ha_table"]
+	if !ok {
+		haTable = "vault_lock"
+	}
+	dbHATable := database + "." + haTable
+
 	dsnParams := url.Values{}
 	tlsCaFile, ok := conf["tls_ca_file"]
 	if ok {
@@ -112,13 +169,25 @@ func NewMySQLBackend(conf map[string]string, logger log.Logger) (physical.Backen
 		return nil, fmt.Errorf("failed to create mysql table: %v", err)
 	}
 
+	// Create the table holding the HA locks if it doesn't exists.
+	if haEnabled {
+		create_query := "CREATE TABLE IF NOT EXISTS " + dbHATable +
+			" (ha_key varbinary(512), ha_identity varchar(36) NOT NULL, ha_value varbinary(512)," +
+			" valid_until datetime(3) NOT NULL, PRIMARY KEY (ha_key))"
+		if _, err := db.Exec(create_query); err != nil {
+			return nil, fmt.Errorf("failed to create mysql HA table: %v", err)
+		}
+	}
+
 	// Setup the backend.
 	m := &MySQLBackend{
 		dbTable:    dbTable,
+		dbHATable:  dbHATable,
 		client:     db,
 		statements: make(map[string]*sql.Stmt),
 		logger:     logger,
 		permitPool: physical.NewPermitPool(maxParInt),
+		haEnabled:  haEnabled,
 	}
 
 	// Prepare all the statements required
@@ -128,6 +197,24 @@ func NewMySQLBackend(conf map[string]string, logger log.Logger) (physical.Backen
 		"get":    "SELECT vault_value FROM " + dbTable + " WHERE vault_key = ?",
 		"delete": "DELETE FROM " + dbTable + " WHERE vault_key = ?",
 		"list":   "SELECT vault_key FROM " + dbTable + " WHERE vault_key LIKE ?",
+		"list_page": "SELECT vault_key FROM " + dbTable +
+			" WHERE vault_key LIKE ? AND vault_key >= ? ORDER BY vault_key LIMIT ?",
+	}
+	// Lock validity is computed with the clock of the database, so that the
+	// clocks of the Vault nodes do not need to agree
+	if haEnabled {
+		statements["ha_takeover"] = "DELETE FROM " + dbHATable +
+			" WHERE ha_key = ? AND valid_until < UTC_TIMESTAMP(3)"
+		statements["ha_insert"] = "INSERT INTO " + dbHATable +
+			" (ha_key, ha_identity, ha_value, valid_until)" +
+			" VALUES (?, ?, ?, UTC_TIMESTAMP(3) + INTERVAL ? MICROSECOND)"
+		statements["ha_renew"] = "UPDATE " + dbHATable +
+			" SET valid_until = UTC_TIMESTAMP(3) + INTERVAL ? MICROSECOND" +
+			" WHERE ha_key = ? AND ha_identity = ?"
+		statements["ha_delete"] = "DELETE FROM " + dbHATable +
+			" WHERE ha_key = ? AND ha_identity = ?"
+		statements["ha_value"] = "SELECT ha_value FROM " + dbHATable +
+			" WHERE ha_key = ? AND valid_until > UTC_TIMESTAMP(3)"
 	}
 	for name, query := range statements {
 		if err := m.prepare(name, query); err != nil {
@@ -149,13 +236,13 @@ func (m *MySQLBackend) prepare(name, query string) error {
 }
 
 // Put is used to insert or update an entry.
-func (m *MySQLBackend) Put(entry *physical.Entry) error {
+func (m *MySQLBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"mysql", "put"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	_, err := m.statements["put"].Exec(entry.Key, entry.Value)
+	_, err := m.statements["put"].ExecContext(ctx, entry.Key, entry.Value)
 	if err != nil {
 		return err
 	}
@@ -163,14 +250,14 @@ func (m *MySQLBackend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch and entry.
-func (m *MySQLBackend) Get(key string) (*physical.Entry, error) {
+func (m *MySQLBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"mysql", "get"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
 	var result []byte
-	err := m.statements["get"].QueryRow(key).Scan(&result)
+	err := m.statements["get"].QueryRowContext(ctx, key).Scan(&result)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -186,13 +273,13 @@ func (m *MySQLBackend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (m *MySQLBackend) Delete(key string) error {
+func (m *MySQLBackend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"mysql", "delete"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	_, err := m.statements["delete"].Exec(key)
+	_, err := m.statements["delete"].ExecContext(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -201,7 +288,7 @@ func (m *MySQLBackend) Delete(key string) error {
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (m *MySQLBackend) List(prefix string) ([]string, error) {
+func (m *MySQLBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"mysql", "list"}, time.Now())
 
 	m.permitPool.Acquire()
@@ -209,7 +296,7 @@ func (m *MySQLBackend) List(prefix string) ([]string, error) {
 
 	// Add the % wildcard to the prefix to do the prefix search
 	likePrefix := prefix + "%"
-	rows, err := m.statements["list"].Query(likePrefix)
+	rows, err := m.statements["list"].QueryContext(ctx, likePrefix)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute statement: %v", err)
 	}
@@ -236,6 +323,215 @@ func (m *MySQLBackend) List(prefix string) ([]string, error) {
 	return keys, nil
 }
 
+// ListPage is used to list a page of the keys under a given prefix. Keys
+// are read in sorted batches, skipping over the contents of the folders
+// found along the way.
+func (m *MySQLBackend) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	defer metrics.MeasureSince([]string{"mysql", "list-page"}, time.Now())
+
+	m.permitPool.Acquire()
+	defer m.permitPool.Release()
+
+	likePrefix := prefix + "%"
+	start := prefix
+	if after != "" {
+		start = mysqlKeyAfter(prefix + after)
+	}
+
+	keys := []string{}
+	for limit <= 0 || len(keys) < limit {
+		batch, err := m.listBatch(ctx, likePrefix, start)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		next := ""
+		for _, full := range batch {
+			key := strings.TrimPrefix(full, prefix)
+			if i := strings.Index(key, "/"); i != -1 {
+				// Continue after the contents of the folder
+				keys = append(keys, key[:i+1])
+				next = mysqlKeyAfter(prefix + key[:i+1])
+				break
+			}
+			keys = append(keys, key)
+			if limit > 0 && len(keys) >= limit {
+				break
+			}
+		}
+		if next == "" {
+			if len(batch) < mysqlListBatchSize {
+				break
+			}
+			next = mysqlKeyAfter(batch[len(batch)-1])
+		}
+		start = next
+	}
+	return keys, nil
+}
+
+// listBatch returns the next batch of keys matching the prefix, starting at
+// the given key.
+func (m *MySQLBackend) listBatch(ctx context.Context, likePrefix, start string) ([]string, error) {
+	rows, err := m.statements["list_page"].QueryContext(ctx, likePrefix, start, mysqlListBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute statement: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan rows: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// mysqlKeyAfter returns the first possible key sorting after the given key
+// and, for a folder, after all keys in it.
+func mysqlKeyAfter(key string) string {
+	if strings.HasSuffix(key, "/") {
+		return key[:len(key)-1] + string('/'+1)
+	}
+	return key + "\x00"
+}
+
+// Transaction is used to run multiple entries via a transaction
+func (m *MySQLBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
+	defer metrics.MeasureSince([]string{"mysql", "transaction"}, time.Now())
+	if len(txns) == 0 {
+		return nil
+	}
+
+	m.permitPool.Acquire()
+	defer m.permitPool.Release()
+
+	tx, err := m.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := m.transaction(ctx, tx, txns); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *MySQLBackend) transaction(ctx context.Context, tx *sql.Tx, txns []physical.TxnEntry) error {
+	deleteStmt := tx.StmtContext(ctx, m.statements["delete"])
+	putStmt := tx.StmtContext(ctx, m.statements["put"])
+
+	for _, op := range txns {
+		var err error
+		switch op.Operation {
+		case physical.DeleteOperation:
+			_, err = deleteStmt.ExecContext(ctx, op.Entry.Key)
+		case physical.PutOperation:
+			_, err = putStmt.ExecContext(ctx, op.Entry.Key, op.Entry.Value)
+		default:
+			return fmt.Errorf("%q is not a supported transaction operation", op.Operation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (m *MySQLBackend) LockWith(key, value string) (physical.Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	l := &MySQLLock{
+		backend:  m,
+		key:      key,
+		value:    value,
+		identity: identity,
+	}
+	l.TTLLock = physical.TTLLock{
+		TryToLock:     l.tryToLock,
+		Renew:         l.renew,
+		Release:       l.release,
+		Logger:        m.logger,
+		Name:          "mysql",
+		TTL:           MySQLLockTTL,
+		RenewInterval: MySQLLockRenewInterval,
+		RetryInterval: MySQLLockRetryInterval,
+		ExpiryMargin:  MySQLLockExpiryMargin,
+	}
+	return l, nil
+}
+
+// HAEnabled returns whether the HA table is used for locking.
+func (m *MySQLBackend) HAEnabled() bool {
+	return m.haEnabled
+}
+
+// release deletes the row of the lock from the HA table.
+func (l *MySQLLock) release() error {
+	_, err := l.backend.statements["ha_delete"].Exec(l.key, l.identity)
+	return err
+}
+
+// Value checks whether or not the lock is held by any node, including this
+// one, and returns the current value.
+func (l *MySQLLock) Value() (bool, string, error) {
+	var value []byte
+	err := l.backend.statements["ha_value"].QueryRow(l.key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, string(value), nil
+}
+
+// tryToLock removes the row of an expired lock and tries to insert the row
+// of this lock. It returns false if another node holds the lock.
+func (l *MySQLLock) tryToLock(ctx context.Context) (bool, error) {
+	if _, err := l.backend.statements["ha_takeover"].ExecContext(ctx, l.key); err != nil {
+		return false, err
+	}
+
+	_, err := l.backend.statements["ha_insert"].ExecContext(ctx, l.key, l.identity, l.value, durationMicros(l.TTL))
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// renew extends the validity of the row of the lock. It returns false if
+// the lock was taken over by another node.
+func (l *MySQLLock) renew(ctx context.Context) (bool, error) {
+	result, err := l.backend.statements["ha_renew"].ExecContext(ctx, durationMicros(l.TTL), l.key, l.identity)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows != 0, nil
+}
+
+// durationMicros returns the duration in microseconds, as used for the
+// validity of locks.
+func durationMicros(d time.Duration) int64 {
+	return int64(d / time.Microsecond)
+}
+
 // Establish a TLS connection with a given CA certificate
 // Register a tsl.Config associted with the same key as the dns param from sql.Open
 // foo:bar@tcp(127.0.0.1:3306)/dbname?tls=default
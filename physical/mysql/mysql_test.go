@@ -3,6 +3,7 @@ package mysql
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/physical"
@@ -55,4 +56,108 @@ func TestMySQLBackend(t *testing.T) {
 
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
+	physical.ExerciseBackend_ListPage(t, b)
+	physical.ExerciseTransactionalBackend(t, b)
+}
+
+func testMySQLHABackend(t *testing.T) *MySQLBackend {
+	address := os.Getenv("MYSQL_ADDR")
+	if address == "" {
+		t.SkipNow()
+	}
+
+	database := os.Getenv("MYSQL_DB")
+	if database == "" {
+		database = "test"
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewMySQLBackend(map[string]string{
+		"address":    address,
+		"database":   database,
+		"table":      "test",
+		"username":   os.Getenv("MYSQL_USERNAME"),
+		"password":   os.Getenv("MYSQL_PASSWORD"),
+		"ha_enabled": "true",
+		"ha_table":   "test_lock",
+	}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+	return b.(*MySQLBackend)
+}
+
+func TestMySQLHABackend(t *testing.T) {
+	b := testMySQLHABackend(t)
+	b2 := testMySQLHABackend(t)
+	defer func() {
+		if _, err := b.client.Exec("DROP TABLE " + b.dbHATable); err != nil {
+			t.Fatalf("Failed to drop table: %v", err)
+		}
+	}()
+
+	if !b.HAEnabled() {
+		t.Fatal("HA should be enabled")
+	}
+	physical.ExerciseHABackend(t, b, b2)
+}
+
+func TestMySQLHABackend_Takeover(t *testing.T) {
+	b := testMySQLHABackend(t)
+	defer func() {
+		if _, err := b.client.Exec("DROP TABLE " + b.dbHATable); err != nil {
+			t.Fatalf("Failed to drop table: %v", err)
+		}
+	}()
+
+	raw, err := b.LockWith("takeover", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock := raw.(*MySQLLock)
+
+	// The lock expires before it is renewed
+	lock.TTL = time.Second
+	lock.RenewInterval = 2 * time.Second
+	lock.ExpiryMargin = 0
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh == nil {
+		t.Fatal("failed to get leader ch")
+	}
+
+	raw, err = b.LockWith("takeover", "baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock2 := raw.(*MySQLLock)
+	lock2.RetryInterval = 100 * time.Millisecond
+	stopCh := make(chan struct{})
+	time.AfterFunc(5*time.Second, func() { close(stopCh) })
+	leaderCh2, err := lock2.Lock(stopCh)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh2 == nil {
+		t.Fatal("expired lock should be taken over")
+	}
+	defer lock2.Unlock()
+
+	held, val, err := lock2.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "baz" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+
+	// The first holder gave up leadership when its lock expired
+	select {
+	case <-leaderCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership should be lost")
+	}
+	lock.Unlock()
 }
@@ -1,8 +1,9 @@
 package physical
 
 import (
+	"context"
+	"sort"
 	"strings"
-	"sync"
 
 	log "github.com/mgutz/logxi/v1"
 )
@@ -28,19 +29,34 @@ type ShutdownChannel chan struct{}
 // and is only accessed via a security barrier. The backends
 // must represent keys in a hierarchical manner. All methods
 // are expected to be thread safe.
+//
+// Every method takes a context that is cancelled when the caller is no
+// longer interested in the result, such as when the client of the request
+// that caused the call goes away. Backends should abort calls in flight
+// when it is done.
 type Backend interface {
 	// Put is used to insert or update an entry
-	Put(entry *Entry) error
+	Put(ctx context.Context, entry *Entry) error
 
 	// Get is used to fetch an entry
-	Get(key string) (*Entry, error)
+	Get(ctx context.Context, key string) (*Entry, error)
 
 	// Delete is used to permanently delete an entry
-	Delete(key string) error
+	Delete(ctx context.Context, key string) error
 
 	// List is used ot list all the keys under a given
 	// prefix, up to the next prefix.
-	List(prefix string) ([]string, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Paginated is an optional interface for backends that can list the keys
+// under a prefix a page at a time, without loading all of them at once.
+type Paginated interface {
+	// ListPage returns, in lexical order, up to limit of the keys that List
+	// would return for the prefix and that sort after the given key. An
+	// empty after starts at the first key, and a limit of zero or less
+	// returns all remaining keys.
+	ListPage(ctx context.Context, prefix string, after string, limit int) ([]string, error)
 }
 
 // HABackend is an extensions to the standard physical
@@ -61,6 +77,12 @@ type Purgable interface {
 	Purge()
 }
 
+// Invalidatable is an optional interface for backends that can drop
+// individual keys from their caches.
+type Invalidatable interface {
+	Invalidate(key string)
+}
+
 // RedirectDetect is an optional interface that an HABackend
 // can implement. If they do, a redirect address can be automatically
 // detected.
@@ -69,29 +91,6 @@ type RedirectDetect interface {
 	DetectHostAddr() (string, error)
 }
 
-// Callback signatures for RunServiceDiscovery
-type ActiveFunction func() bool
-type SealedFunction func() bool
-
-// ServiceDiscovery is an optional interface that an HABackend can implement.
-// If they do, the state of a backend is advertised to the service discovery
-// network.
-type ServiceDiscovery interface {
-	// NotifyActiveStateChange is used by Core to notify a backend
-	// capable of ServiceDiscovery that this Vault instance has changed
-	// its status to active or standby.
-	NotifyActiveStateChange() error
-
-	// NotifySealedStateChange is used by Core to notify a backend
-	// capable of ServiceDiscovery that Vault has changed its Sealed
-	// status to sealed or unsealed.
-	NotifySealedStateChange() error
-
-	// Run executes any background service discovery tasks until the
-	// shutdown channel is closed.
-	RunServiceDiscovery(waitGroup *sync.WaitGroup, shutdownCh ShutdownChannel, redirectAddr string, activeFunc ActiveFunction, sealedFunc SealedFunction) error
-}
-
 type Lock interface {
 	// Lock is used to acquire the given lock
 	// The stopCh is optional and if closed should interrupt the lock
@@ -141,6 +140,36 @@ func (c *PermitPool) Release() {
 	<-c.sem
 }
 
+// ListPage returns a page of the keys under the prefix, as described by
+// Paginated. Backends that are not paginated list all keys and return the
+// requested page of them.
+func ListPage(ctx context.Context, b Backend, prefix, after string, limit int) ([]string, error) {
+	if p, ok := b.(Paginated); ok {
+		return p.ListPage(ctx, prefix, after, limit)
+	}
+
+	keys, err := b.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return PageKeys(keys, after, limit), nil
+}
+
+// PageKeys sorts the keys and returns up to limit of those that sort after
+// the given key. It is used by backends that cannot filter keys themselves.
+func PageKeys(keys []string, after string, limit int) []string {
+	sort.Strings(keys)
+	start := sort.SearchStrings(keys, after)
+	if start < len(keys) && keys[start] == after {
+		start++
+	}
+	keys = keys[start:]
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
 // Prefixes is a shared helper function returns all parent 'folders' for a
 // given vault key.
 // e.g. for 'foo/bar/baz', it returns ['foo', 'foo/bar']
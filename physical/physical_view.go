@@ -1,6 +1,7 @@
 package physical
 
 import (
+	"context"
 	"errors"
 	"strings"
 )
@@ -25,19 +26,27 @@ func NewView(backend Backend, prefix string) *View {
 }
 
 // List the contents of the prefixed view
-func (v *View) List(prefix string) ([]string, error) {
+func (v *View) List(ctx context.Context, prefix string) ([]string, error) {
 	if err := v.sanityCheck(prefix); err != nil {
 		return nil, err
 	}
-	return v.backend.List(v.expandKey(prefix))
+	return v.backend.List(ctx, v.expandKey(prefix))
+}
+
+// ListPage lists a page of the contents of the prefixed view
+func (v *View) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	if err := v.sanityCheck(prefix); err != nil {
+		return nil, err
+	}
+	return ListPage(ctx, v.backend, v.expandKey(prefix), after, limit)
 }
 
 // Get the key of the prefixed view
-func (v *View) Get(key string) (*Entry, error) {
+func (v *View) Get(ctx context.Context, key string) (*Entry, error) {
 	if err := v.sanityCheck(key); err != nil {
 		return nil, err
 	}
-	entry, err := v.backend.Get(v.expandKey(key))
+	entry, err := v.backend.Get(ctx, v.expandKey(key))
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +64,7 @@ func (v *View) Get(key string) (*Entry, error) {
 }
 
 // Put the entry into the prefix view
-func (v *View) Put(entry *Entry) error {
+func (v *View) Put(ctx context.Context, entry *Entry) error {
 	if err := v.sanityCheck(entry.Key); err != nil {
 		return err
 	}
@@ -64,15 +73,15 @@ func (v *View) Put(entry *Entry) error {
 		Key:   v.expandKey(entry.Key),
 		Value: entry.Value,
 	}
-	return v.backend.Put(nested)
+	return v.backend.Put(ctx, nested)
 }
 
 // Delete the entry from the prefix view
-func (v *View) Delete(key string) error {
+func (v *View) Delete(ctx context.Context, key string) error {
 	if err := v.sanityCheck(key); err != nil {
 		return err
 	}
-	return v.backend.Delete(v.expandKey(key))
+	return v.backend.Delete(ctx, v.expandKey(key))
 }
 
 // sanityCheck is used to perform a sanity check on a key
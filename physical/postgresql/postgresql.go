@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/physical"
 	log "github.com/mgutz/logxi/v1"
 
@@ -15,17 +17,62 @@ import (
 	"github.com/lib/pq"
 )
 
+const (
+	// PostgreSQLLockTTL is the time a lock is valid for without being
+	// renewed. Expired locks can be taken over by other nodes.
+	PostgreSQLLockTTL = 15 * time.Second
+
+	// PostgreSQLLockRenewInterval is the amount of time to wait between
+	// lock renewals
+	PostgreSQLLockRenewInterval = 5 * time.Second
+
+	// PostgreSQLLockExpiryMargin is how long before the lock expires that its
+	// leadership is given up if it could not be renewed, so that the node
+	// has stepped down by the time another node can take the lock over
+	PostgreSQLLockExpiryMargin = 3 * time.Second
+
+	// PostgreSQLLockRetryInterval is the amount of time to wait if a lock
+	// fails before trying again
+	PostgreSQLLockRetryInterval = time.Second
+
+	// pqUniqueViolation is the error code PostgreSQL returns when an
+	// insert conflicts with an existing row
+	pqUniqueViolation = "23505"
+)
+
 // PostgreSQL Backend is a physical backend that stores data
 // within a PostgreSQL database.
 type PostgreSQLBackend struct {
-	table        string
-	client       *sql.DB
-	put_query    string
-	get_query    string
-	delete_query string
-	list_query   string
-	logger       log.Logger
-	permitPool   *physical.PermitPool
+	table           string
+	client          *sql.DB
+	put_query       string
+	get_query       string
+	delete_query    string
+	list_query      string
+	list_page_query string
+	logger          log.Logger
+	permitPool      *physical.PermitPool
+
+	haEnabled         bool
+	ha_table          string
+	ha_takeover_query string
+	ha_insert_query   string
+	ha_renew_query    string
+	ha_delete_query   string
+	ha_value_query    string
+}
+
+// PostgreSQLLock implements a lock using a row of the HA table. The row
+// holds the time until which the lock is valid, which the holder extends
+// periodically. Rows that were not renewed in time are taken over by
+// other nodes.
+type PostgreSQLLock struct {
+	physical.TTLLock
+
+	backend  *PostgreSQLBackend
+	key      string
+	value    string
+	identity string
 }
 
 // NewPostgreSQLBackend constructs a PostgreSQL backend using the given
@@ -58,6 +105,20 @@ func NewPostgreSQLBackend(conf map[string]string, logger log.Logger) (physical.B
 		maxParInt = physical.DefaultParallelOperations
 	}
 
+	var haEnabled bool
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
+	unquoted_ha_table, ok := conf["ha_table"]
+	if !ok {
+		unquoted_ha_table = "vault_ha_locks"
+	}
+	quoted_ha_table := pq.QuoteIdentifier(unquoted_ha_table)
+
 	// Create PostgreSQL handle for the database.
 	db, err := sql.Open("postgres", connURL)
 	if err != nil {
@@ -83,6 +144,10 @@ func NewPostgreSQLBackend(conf map[string]string, logger log.Logger) (physical.B
 			" UPDATE SET (parent_path, path, key, value) = ($1, $2, $3, $4)"
 	}
 
+	list_query := "SELECT key FROM " + quoted_table + " WHERE path = $1" +
+		"UNION SELECT DISTINCT substring(substr(path, length($1)+1) from '^.*?/') FROM " +
+		quoted_table + " WHERE parent_path LIKE $1 || '%'"
+
 	// Setup the backend.
 	m := &PostgreSQLBackend{
 		table:        quoted_table,
@@ -90,11 +155,28 @@ func NewPostgreSQLBackend(conf map[string]string, logger log.Logger) (physical.B
 		put_query:    put_query,
 		get_query:    "SELECT value FROM " + quoted_table + " WHERE path = $1 AND key = $2",
 		delete_query: "DELETE FROM " + quoted_table + " WHERE path = $1 AND key = $2",
-		list_query: "SELECT key FROM " + quoted_table + " WHERE path = $1" +
-			"UNION SELECT DISTINCT substring(substr(path, length($1)+1) from '^.*?/') FROM " +
-			quoted_table + " WHERE parent_path LIKE $1 || '%'",
+		list_query:   list_query,
+		list_page_query: "SELECT key FROM (" + list_query + ") AS keys" +
+			" WHERE key > $2 COLLATE \"C\" ORDER BY key COLLATE \"C\" LIMIT $3",
 		logger:     logger,
 		permitPool: physical.NewPermitPool(maxParInt),
+
+		// Lock validity is computed with the clock of the database, so
+		// that the clocks of the Vault nodes do not need to agree
+		haEnabled: haEnabled,
+		ha_table:  quoted_ha_table,
+		ha_takeover_query: "DELETE FROM " + quoted_ha_table +
+			" WHERE ha_key = $1 AND valid_until < NOW()",
+		ha_insert_query: "INSERT INTO " + quoted_ha_table +
+			" (ha_key, ha_identity, ha_value, valid_until)" +
+			" VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 millisecond')",
+		ha_renew_query: "UPDATE " + quoted_ha_table +
+			" SET valid_until = NOW() + $3 * INTERVAL '1 millisecond'" +
+			" WHERE ha_key = $1 AND ha_identity = $2",
+		ha_delete_query: "DELETE FROM " + quoted_ha_table +
+			" WHERE ha_key = $1 AND ha_identity = $2",
+		ha_value_query: "SELECT ha_value FROM " + quoted_ha_table +
+			" WHERE ha_key = $1 AND valid_until > NOW()",
 	}
 
 	return m, nil
@@ -125,7 +207,7 @@ func (m *PostgreSQLBackend) splitKey(fullPath string) (string, string, string) {
 }
 
 // Put is used to insert or update an entry.
-func (m *PostgreSQLBackend) Put(entry *physical.Entry) error {
+func (m *PostgreSQLBackend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"postgres", "put"}, time.Now())
 
 	m.permitPool.Acquire()
@@ -133,7 +215,7 @@ func (m *PostgreSQLBackend) Put(entry *physical.Entry) error {
 
 	parentPath, path, key := m.splitKey(entry.Key)
 
-	_, err := m.client.Exec(m.put_query, parentPath, path, key, entry.Value)
+	_, err := m.client.ExecContext(ctx, m.put_query, parentPath, path, key, entry.Value)
 	if err != nil {
 		return err
 	}
@@ -141,7 +223,7 @@ func (m *PostgreSQLBackend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch and entry.
-func (m *PostgreSQLBackend) Get(fullPath string) (*physical.Entry, error) {
+func (m *PostgreSQLBackend) Get(ctx context.Context, fullPath string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"postgres", "get"}, time.Now())
 
 	m.permitPool.Acquire()
@@ -150,7 +232,7 @@ func (m *PostgreSQLBackend) Get(fullPath string) (*physical.Entry, error) {
 	_, path, key := m.splitKey(fullPath)
 
 	var result []byte
-	err := m.client.QueryRow(m.get_query, path, key).Scan(&result)
+	err := m.client.QueryRowContext(ctx, m.get_query, path, key).Scan(&result)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -166,7 +248,7 @@ func (m *PostgreSQLBackend) Get(fullPath string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (m *PostgreSQLBackend) Delete(fullPath string) error {
+func (m *PostgreSQLBackend) Delete(ctx context.Context, fullPath string) error {
 	defer metrics.MeasureSince([]string{"postgres", "delete"}, time.Now())
 
 	m.permitPool.Acquire()
@@ -174,7 +256,7 @@ func (m *PostgreSQLBackend) Delete(fullPath string) error {
 
 	_, path, key := m.splitKey(fullPath)
 
-	_, err := m.client.Exec(m.delete_query, path, key)
+	_, err := m.client.ExecContext(ctx, m.delete_query, path, key)
 	if err != nil {
 		return err
 	}
@@ -183,22 +265,89 @@ func (m *PostgreSQLBackend) Delete(fullPath string) error {
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (m *PostgreSQLBackend) List(prefix string) ([]string, error) {
+func (m *PostgreSQLBackend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"postgres", "list"}, time.Now())
 
 	m.permitPool.Acquire()
 	defer m.permitPool.Release()
 
-	rows, err := m.client.Query(m.list_query, "/"+prefix)
+	rows, err := m.client.QueryContext(ctx, m.list_query, "/"+prefix)
 	if err != nil {
 		return nil, err
 	}
+	return scanKeys(rows)
+}
+
+// ListPage is used to list a page of the keys under a given prefix, sorted
+// by byte value like the keys of the other backends.
+func (m *PostgreSQLBackend) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	defer metrics.MeasureSince([]string{"postgres", "list-page"}, time.Now())
+
+	m.permitPool.Acquire()
+	defer m.permitPool.Release()
+
+	// A NULL limit returns all rows
+	var pageLimit interface{}
+	if limit > 0 {
+		pageLimit = limit
+	}
+
+	rows, err := m.client.QueryContext(ctx, m.list_page_query, "/"+prefix, after, pageLimit)
+	if err != nil {
+		return nil, err
+	}
+	return scanKeys(rows)
+}
+
+// Transaction is used to run multiple entries via a transaction
+func (m *PostgreSQLBackend) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
+	defer metrics.MeasureSince([]string{"postgres", "transaction"}, time.Now())
+	if len(txns) == 0 {
+		return nil
+	}
+
+	m.permitPool.Acquire()
+	defer m.permitPool.Release()
+
+	tx, err := m.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := m.transaction(ctx, tx, txns); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *PostgreSQLBackend) transaction(ctx context.Context, tx *sql.Tx, txns []physical.TxnEntry) error {
+	for _, op := range txns {
+		parentPath, path, key := m.splitKey(op.Entry.Key)
+
+		var err error
+		switch op.Operation {
+		case physical.DeleteOperation:
+			_, err = tx.ExecContext(ctx, m.delete_query, path, key)
+		case physical.PutOperation:
+			_, err = tx.ExecContext(ctx, m.put_query, parentPath, path, key, op.Entry.Value)
+		default:
+			return fmt.Errorf("%q is not a supported transaction operation", op.Operation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanKeys returns the keys of the rows of a list query and closes them.
+func scanKeys(rows *sql.Rows) ([]string, error) {
 	defer rows.Close()
 
 	var keys []string
 	for rows.Next() {
 		var key string
-		err = rows.Scan(&key)
+		err := rows.Scan(&key)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan rows: %v", err)
 		}
@@ -208,3 +357,91 @@ func (m *PostgreSQLBackend) List(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// LockWith is used for mutual exclusion based on the given key.
+func (m *PostgreSQLBackend) LockWith(key, value string) (physical.Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	l := &PostgreSQLLock{
+		backend:  m,
+		key:      key,
+		value:    value,
+		identity: identity,
+	}
+	l.TTLLock = physical.TTLLock{
+		TryToLock:     l.tryToLock,
+		Renew:         l.renew,
+		Release:       l.release,
+		Logger:        m.logger,
+		Name:          "postgres",
+		TTL:           PostgreSQLLockTTL,
+		RenewInterval: PostgreSQLLockRenewInterval,
+		RetryInterval: PostgreSQLLockRetryInterval,
+		ExpiryMargin:  PostgreSQLLockExpiryMargin,
+	}
+	return l, nil
+}
+
+// HAEnabled returns whether the HA table is used for locking.
+func (m *PostgreSQLBackend) HAEnabled() bool {
+	return m.haEnabled
+}
+
+// release deletes the row of the lock from the HA table.
+func (l *PostgreSQLLock) release() error {
+	_, err := l.backend.client.Exec(l.backend.ha_delete_query, l.key, l.identity)
+	return err
+}
+
+// Value checks whether or not the lock is held by any node, including this
+// one, and returns the current value.
+func (l *PostgreSQLLock) Value() (bool, string, error) {
+	var value string
+	err := l.backend.client.QueryRow(l.backend.ha_value_query, l.key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, value, nil
+}
+
+// tryToLock removes the row of an expired lock and tries to insert the row
+// of this lock. It returns false if another node holds the lock.
+func (l *PostgreSQLLock) tryToLock(ctx context.Context) (bool, error) {
+	if _, err := l.backend.client.ExecContext(ctx, l.backend.ha_takeover_query, l.key); err != nil {
+		return false, err
+	}
+
+	_, err := l.backend.client.ExecContext(ctx, l.backend.ha_insert_query, l.key, l.identity, l.value, durationMillis(l.TTL))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pqUniqueViolation {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// renew extends the validity of the row of the lock. It returns false if
+// the lock was taken over by another node.
+func (l *PostgreSQLLock) renew(ctx context.Context) (bool, error) {
+	result, err := l.backend.client.ExecContext(ctx, l.backend.ha_renew_query, l.key, l.identity, durationMillis(l.TTL))
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows != 0, nil
+}
+
+// durationMillis returns the duration in milliseconds, as used for the
+// validity of locks.
+func durationMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
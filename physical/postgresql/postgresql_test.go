@@ -3,6 +3,7 @@ package postgresql
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/physical"
@@ -43,4 +44,115 @@ func TestPostgreSQLBackend(t *testing.T) {
 
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
+	physical.ExerciseBackend_ListPage(t, b)
+	physical.ExerciseTransactionalBackend(t, b)
+}
+
+func testPostgreSQLHABackend(t *testing.T) *PostgreSQLBackend {
+	connURL := os.Getenv("PGURL")
+	if connURL == "" {
+		t.SkipNow()
+	}
+
+	haTable := os.Getenv("PGHATABLE")
+	if haTable == "" {
+		haTable = "vault_ha_locks"
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewPostgreSQLBackend(map[string]string{
+		"connection_url": connURL,
+		"ha_enabled":     "true",
+		"ha_table":       haTable,
+	}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+
+	pg := b.(*PostgreSQLBackend)
+	_, err = pg.client.Exec("CREATE TABLE IF NOT EXISTS " + pg.ha_table + " (" +
+		"ha_key TEXT COLLATE \"C\" NOT NULL, " +
+		"ha_identity TEXT COLLATE \"C\" NOT NULL, " +
+		"ha_value TEXT COLLATE \"C\", " +
+		"valid_until TIMESTAMP WITH TIME ZONE NOT NULL, " +
+		"CONSTRAINT ha_key PRIMARY KEY (ha_key))")
+	if err != nil {
+		t.Fatalf("Failed to create HA table: %v", err)
+	}
+	return pg
+}
+
+func TestPostgreSQLHABackend(t *testing.T) {
+	b := testPostgreSQLHABackend(t)
+	b2 := testPostgreSQLHABackend(t)
+	defer func() {
+		if _, err := b.client.Exec("TRUNCATE TABLE " + b.ha_table); err != nil {
+			t.Fatalf("Failed to truncate table: %v", err)
+		}
+	}()
+
+	if !b.HAEnabled() {
+		t.Fatal("HA should be enabled")
+	}
+	physical.ExerciseHABackend(t, b, b2)
+}
+
+func TestPostgreSQLHABackend_Takeover(t *testing.T) {
+	b := testPostgreSQLHABackend(t)
+	defer func() {
+		if _, err := b.client.Exec("TRUNCATE TABLE " + b.ha_table); err != nil {
+			t.Fatalf("Failed to truncate table: %v", err)
+		}
+	}()
+
+	raw, err := b.LockWith("takeover", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock := raw.(*PostgreSQLLock)
+
+	// The lock expires before it is renewed
+	lock.TTL = time.Second
+	lock.RenewInterval = 2 * time.Second
+	lock.ExpiryMargin = 0
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh == nil {
+		t.Fatal("failed to get leader ch")
+	}
+
+	raw, err = b.LockWith("takeover", "baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock2 := raw.(*PostgreSQLLock)
+	lock2.RetryInterval = 100 * time.Millisecond
+	stopCh := make(chan struct{})
+	time.AfterFunc(5*time.Second, func() { close(stopCh) })
+	leaderCh2, err := lock2.Lock(stopCh)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh2 == nil {
+		t.Fatal("expired lock should be taken over")
+	}
+	defer lock2.Unlock()
+
+	held, val, err := lock2.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "baz" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+
+	// The first holder gave up leadership when its lock expired
+	select {
+	case <-leaderCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership should be lost")
+	}
+	lock.Unlock()
 }
@@ -2,8 +2,10 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"sort"
@@ -16,6 +18,7 @@ import (
 	"github.com/armon/go-metrics"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/hashicorp/errwrap"
@@ -32,6 +35,7 @@ type S3Backend struct {
 	client     *s3.S3
 	logger     log.Logger
 	permitPool *physical.PermitPool
+	haEnabled  bool
 }
 
 // NewS3Backend constructs a S3 backend using a pre-existing
@@ -112,23 +116,32 @@ func NewS3Backend(conf map[string]string, logger log.Logger) (physical.Backend,
 		}
 	}
 
+	var haEnabled bool
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
 	s := &S3Backend{
 		client:     s3conn,
 		bucket:     bucket,
 		logger:     logger,
 		permitPool: physical.NewPermitPool(maxParInt),
+		haEnabled:  haEnabled,
 	}
 	return s, nil
 }
 
 // Put is used to insert or update an entry
-func (s *S3Backend) Put(entry *physical.Entry) error {
+func (s *S3Backend) Put(ctx context.Context, entry *physical.Entry) error {
 	defer metrics.MeasureSince([]string{"s3", "put"}, time.Now())
 
 	s.permitPool.Acquire()
 	defer s.permitPool.Release()
 
-	_, err := s.client.PutObject(&s3.PutObjectInput{
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(entry.Key),
 		Body:   bytes.NewReader(entry.Value),
@@ -142,13 +155,13 @@ func (s *S3Backend) Put(entry *physical.Entry) error {
 }
 
 // Get is used to fetch an entry
-func (s *S3Backend) Get(key string) (*physical.Entry, error) {
+func (s *S3Backend) Get(ctx context.Context, key string) (*physical.Entry, error) {
 	defer metrics.MeasureSince([]string{"s3", "get"}, time.Now())
 
 	s.permitPool.Acquire()
 	defer s.permitPool.Release()
 
-	resp, err := s.client.GetObject(&s3.GetObjectInput{
+	resp, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -181,13 +194,13 @@ func (s *S3Backend) Get(key string) (*physical.Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (s *S3Backend) Delete(key string) error {
+func (s *S3Backend) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"s3", "delete"}, time.Now())
 
 	s.permitPool.Acquire()
 	defer s.permitPool.Release()
 
-	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -201,7 +214,7 @@ func (s *S3Backend) Delete(key string) error {
 
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
-func (s *S3Backend) List(prefix string) ([]string, error) {
+func (s *S3Backend) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"s3", "list"}, time.Now())
 
 	s.permitPool.Acquire()
@@ -215,7 +228,7 @@ func (s *S3Backend) List(prefix string) ([]string, error) {
 
 	keys := []string{}
 
-	err := s.client.ListObjectsV2Pages(params,
+	err := s.client.ListObjectsV2PagesWithContext(ctx, params,
 		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
 			if page != nil {
 				// Add truncated 'folder' paths
@@ -250,3 +263,101 @@ func (s *S3Backend) List(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// GetVersion is used to fetch an entry along with its ETag
+func (s *S3Backend) GetVersion(ctx context.Context, key string) (*physical.Entry, string, error) {
+	defer metrics.MeasureSince([]string{"s3", "get-version"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	resp, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if awsErr, ok := err.(awserr.RequestFailure); ok && awsErr.StatusCode() == 404 {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ent := &physical.Entry{
+		Key:   key,
+		Value: data,
+	}
+	return ent, aws.StringValue(resp.ETag), nil
+}
+
+// PutIfVersion is used to insert or update an entry only if its ETag
+// matches the given one
+func (s *S3Backend) PutIfVersion(ctx context.Context, entry *physical.Entry, version string) error {
+	defer metrics.MeasureSince([]string{"s3", "put-if-version"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(entry.Key),
+		Body:   bytes.NewReader(entry.Value),
+	}, versionCondition(version))
+	return conditionError(err)
+}
+
+// DeleteIfVersion is used to permanently delete an entry only if its ETag
+// matches the given one
+func (s *S3Backend) DeleteIfVersion(ctx context.Context, key, version string) error {
+	defer metrics.MeasureSince([]string{"s3", "delete-if-version"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, versionCondition(version))
+	return conditionError(err)
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (s *S3Backend) LockWith(key, value string) (physical.Lock, error) {
+	return physical.NewConditionalLock(s, s.logger, "s3", key, value)
+}
+
+// HAEnabled returns whether conditional writes are used for locking.
+func (s *S3Backend) HAEnabled() bool {
+	return s.haEnabled
+}
+
+// versionCondition returns a request option that makes a request
+// conditional on the ETag of the object. An empty version requires that the
+// object does not exist.
+func versionCondition(version string) request.Option {
+	return func(r *request.Request) {
+		if version == "" {
+			r.HTTPRequest.Header.Set("If-None-Match", "*")
+		} else {
+			r.HTTPRequest.Header.Set("If-Match", version)
+		}
+	}
+}
+
+// conditionError translates the errors of conditional requests. S3 returns
+// 412 when the condition does not hold, 409 when a concurrent conditional
+// write won, and 404 when deleting an object that no longer exists.
+func conditionError(err error) error {
+	if awsErr, ok := err.(awserr.RequestFailure); ok {
+		switch awsErr.StatusCode() {
+		case http.StatusPreconditionFailed, http.StatusConflict, http.StatusNotFound:
+			return physical.ErrConditionFailed
+		}
+	}
+	return err
+}
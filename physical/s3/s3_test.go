@@ -1,9 +1,15 @@
 package s3
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +19,7 @@ import (
 	log "github.com/mgutz/logxi/v1"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -92,3 +99,174 @@ func TestS3Backend(t *testing.T) {
 	physical.ExerciseBackend(t, b)
 	physical.ExerciseBackend_ListPrefix(t, b)
 }
+
+// fakeS3 is a minimal S3 server that supports getting, putting and deleting
+// objects, including the If-Match and If-None-Match conditions
+type fakeS3 struct {
+	l       sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	counter int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	key := r.URL.Path
+	etag, exists := f.etags[key]
+
+	// Check the conditions of writes
+	if r.Method != "GET" {
+		if match := r.Header.Get("If-Match"); match != "" && match != etag {
+			if !exists {
+				f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			} else {
+				f.writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			}
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			f.writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+		if !exists {
+			f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.objects[key])))
+		w.Write(f.objects[key])
+	case "PUT":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.counter++
+		f.objects[key] = data
+		f.etags[key] = fmt.Sprintf("%q", strconv.Itoa(f.counter))
+		w.Header().Set("ETag", f.etags[key])
+	case "DELETE":
+		delete(f.objects, key)
+		delete(f.etags, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+}
+
+// testFakeS3Backend returns a backend with HA enabled that uses the given
+// fake server
+func testFakeS3Backend(t *testing.T, srv *httptest.Server) *S3Backend {
+	s3conn := s3.New(session.New(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("access", "secret", ""),
+		Endpoint:         aws.String(srv.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+
+	return &S3Backend{
+		client:     s3conn,
+		bucket:     "vault",
+		logger:     logformat.NewVaultLogger(log.LevelTrace),
+		permitPool: physical.NewPermitPool(0),
+		haEnabled:  true,
+	}
+}
+
+func TestS3HABackend(t *testing.T) {
+	srv := httptest.NewServer(&fakeS3{
+		objects: make(map[string][]byte),
+		etags:   make(map[string]string),
+	})
+	defer srv.Close()
+
+	b := testFakeS3Backend(t, srv)
+	b2 := testFakeS3Backend(t, srv)
+	physical.ExerciseHABackend(t, b, b2)
+}
+
+func TestS3HABackend_Takeover(t *testing.T) {
+	srv := httptest.NewServer(&fakeS3{
+		objects: make(map[string][]byte),
+		etags:   make(map[string]string),
+	})
+	defer srv.Close()
+
+	b := testFakeS3Backend(t, srv)
+	raw, err := b.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock := raw.(*physical.ConditionalLock)
+
+	// The lock expires before it is renewed
+	lock.TTL = 200 * time.Millisecond
+	lock.RenewInterval = time.Second
+	lock.ExpiryMargin = 0
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh == nil {
+		t.Fatal("failed to get leader ch")
+	}
+
+	raw, err = testFakeS3Backend(t, srv).LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock2 := raw.(*physical.ConditionalLock)
+	lock2.RetryInterval = 50 * time.Millisecond
+	stopCh := make(chan struct{})
+	time.AfterFunc(2*time.Second, func() { close(stopCh) })
+	leaderCh2, err := lock2.Lock(stopCh)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh2 == nil {
+		t.Fatal("expired lock should be taken over")
+	}
+	defer lock2.Unlock()
+
+	select {
+	case <-leaderCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("leadership should be lost")
+	}
+	lock.Unlock()
+
+	held, val, err := lock2.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "baz" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+
+	// Writing the lock object is conditional on its ETag
+	entry, etag, err := b.GetVersion(context.Background(), "core/lock")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil || etag == "" {
+		t.Fatalf("bad: %v %q", entry, etag)
+	}
+	if err := b.PutIfVersion(context.Background(), entry, ""); err != physical.ErrConditionFailed {
+		t.Fatalf("expected condition failure, got: %v", err)
+	}
+	if err := b.DeleteIfVersion(context.Background(), "core/lock", `"stale"`); err != physical.ErrConditionFailed {
+		t.Fatalf("expected condition failure, got: %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package physical
 
-import multierror "github.com/hashicorp/go-multierror"
+import (
+	"context"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
 
 // TxnEntry is an operation that takes atomically as part of
 // a transactional update. Only supported by Transactional backends.
@@ -14,20 +18,20 @@ type TxnEntry struct {
 // required for some features such as replication.
 type Transactional interface {
 	// The function to run a transaction
-	Transaction([]TxnEntry) error
+	Transaction(context.Context, []TxnEntry) error
 }
 
 type PseudoTransactional interface {
 	// An internal function should do no locking or permit pool acquisition.
 	// Depending on the backend and if it natively supports transactions, these
 	// may simply chain to the normal backend functions.
-	GetInternal(string) (*Entry, error)
-	PutInternal(*Entry) error
-	DeleteInternal(string) error
+	GetInternal(context.Context, string) (*Entry, error)
+	PutInternal(context.Context, *Entry) error
+	DeleteInternal(context.Context, string) error
 }
 
 // Implements the transaction interface
-func GenericTransactionHandler(t PseudoTransactional, txns []TxnEntry) (retErr error) {
+func GenericTransactionHandler(ctx context.Context, t PseudoTransactional, txns []TxnEntry) (retErr error) {
 	rollbackStack := make([]TxnEntry, 0, len(txns))
 	var dirty bool
 
@@ -37,7 +41,7 @@ TxnWalk:
 	for _, txn := range txns {
 		switch txn.Operation {
 		case DeleteOperation:
-			entry, err := t.GetInternal(txn.Entry.Key)
+			entry, err := t.GetInternal(ctx, txn.Entry.Key)
 			if err != nil {
 				retErr = multierror.Append(retErr, err)
 				dirty = true
@@ -54,7 +58,7 @@ TxnWalk:
 					Value: entry.Value,
 				},
 			}
-			err = t.DeleteInternal(txn.Entry.Key)
+			err = t.DeleteInternal(ctx, txn.Entry.Key)
 			if err != nil {
 				retErr = multierror.Append(retErr, err)
 				dirty = true
@@ -63,7 +67,7 @@ TxnWalk:
 			rollbackStack = append([]TxnEntry{rollbackEntry}, rollbackStack...)
 
 		case PutOperation:
-			entry, err := t.GetInternal(txn.Entry.Key)
+			entry, err := t.GetInternal(ctx, txn.Entry.Key)
 			if err != nil {
 				retErr = multierror.Append(retErr, err)
 				dirty = true
@@ -87,7 +91,7 @@ TxnWalk:
 					},
 				}
 			}
-			err = t.PutInternal(txn.Entry)
+			err = t.PutInternal(ctx, txn.Entry)
 			if err != nil {
 				retErr = multierror.Append(retErr, err)
 				dirty = true
@@ -100,16 +104,18 @@ TxnWalk:
 	// Need to roll back because we hit an error along the way
 	if dirty {
 		// While traversing this, if we get an error, we continue anyways in
-		// best-effort fashion
+		// best-effort fashion. The request context may be what failed the
+		// transaction, so it must not be allowed to cut the rollback short.
+		rollbackCtx := context.Background()
 		for _, txn := range rollbackStack {
 			switch txn.Operation {
 			case DeleteOperation:
-				err := t.DeleteInternal(txn.Entry.Key)
+				err := t.DeleteInternal(rollbackCtx, txn.Entry.Key)
 				if err != nil {
 					retErr = multierror.Append(retErr, err)
 				}
 			case PutOperation:
-				err := t.PutInternal(txn.Entry)
+				err := t.PutInternal(rollbackCtx, txn.Entry)
 				if err != nil {
 					retErr = multierror.Append(retErr, err)
 				}
@@ -0,0 +1,138 @@
+package physical
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+)
+
+// TTLLock implements acquiring, renewing and releasing a lock that is valid
+// for a TTL and has to be renewed periodically by its holder. The backend
+// specific operations are given as callbacks. Backends embed it and add the
+// Value method to implement Lock.
+type TTLLock struct {
+	// TryToLock tries once to acquire the lock. It returns false if another
+	// node holds the lock.
+	TryToLock func(ctx context.Context) (bool, error)
+
+	// Renew extends the validity of the held lock. It returns false if the
+	// lock was taken over by another node.
+	Renew func(ctx context.Context) (bool, error)
+
+	// Release gives up the held lock.
+	Release func() error
+
+	// Logger is used to report failed renewals, prefixed with Name
+	Logger log.Logger
+	Name   string
+
+	// TTL is the time the lock is valid for without being renewed,
+	// RenewInterval the time between renewals and RetryInterval the time
+	// between attempts to acquire the lock. Leadership is given up
+	// ExpiryMargin before the lock expires if it could not be renewed, so
+	// that the node has stepped down by the time another node can take the
+	// lock over. They may be changed before the lock is first used.
+	TTL           time.Duration
+	RenewInterval time.Duration
+	RetryInterval time.Duration
+	ExpiryMargin  time.Duration
+
+	held   bool
+	lock   sync.Mutex
+	stopCh chan struct{}
+}
+
+// Lock tries to acquire the lock until either the stop channel is closed or
+// the lock is acquired. The returned channel is closed once the lock can no
+// longer be renewed.
+func (l *TTLLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	var acquiredAt time.Time
+	for {
+		acquiredAt = time.Now()
+		acquired, err := l.TryToLock(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-time.After(l.RetryInterval):
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopCh = make(chan struct{})
+	leader := make(chan struct{})
+	go l.periodicallyRenewLock(l.stopCh, leader, acquiredAt)
+	return leader, nil
+}
+
+// Unlock stops renewing the lock and releases it.
+func (l *TTLLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+	return l.Release()
+}
+
+// periodicallyRenewLock extends the validity of the lock until it is
+// unlocked. The leader channel is closed once the lock was taken over, or
+// could not be renewed until shortly before it expires.
+func (l *TTLLock) periodicallyRenewLock(stopCh, leader chan struct{}, renewed time.Time) {
+	defer close(leader)
+
+	ticker := time.NewTicker(l.RenewInterval)
+	defer ticker.Stop()
+
+	// The lock is valid for its TTL from the start of the last successful
+	// renewal, leadership is given up a margin before that
+	deadline := renewed.Add(l.TTL - l.ExpiryMargin)
+	expired := time.NewTimer(time.Until(deadline))
+	defer expired.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			ctx, cancel := context.WithDeadline(context.Background(), deadline)
+			ok, err := l.Renew(ctx)
+			cancel()
+			switch {
+			case err != nil:
+				l.Logger.Warn(l.Name+": failed to renew HA lock", "error", err)
+			case !ok:
+				l.Logger.Warn(l.Name + ": HA lock was taken over by another node")
+				return
+			default:
+				deadline = start.Add(l.TTL - l.ExpiryMargin)
+				if !expired.Stop() {
+					<-expired.C
+				}
+				expired.Reset(time.Until(deadline))
+			}
+		case <-expired.C:
+			l.Logger.Error(l.Name + ": HA lock could not be renewed before it expires, giving up leadership")
+			return
+		case <-stopCh:
+			return
+		}
+	}
+}
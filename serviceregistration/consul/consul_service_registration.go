@@ -0,0 +1,465 @@
+package consul
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/lib"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/strutil"
+	physConsul "github.com/hashicorp/vault/physical/consul"
+	sr "github.com/hashicorp/vault/serviceregistration"
+)
+
+const (
+	// checkJitterFactor specifies the jitter factor used to stagger checks
+	checkJitterFactor = 16
+
+	// checkMinBuffer specifies provides a guarantee that a check will not
+	// be executed too close to the TTL check timeout
+	checkMinBuffer = 100 * time.Millisecond
+
+	// consulRetryInterval specifies the retry duration to use when an
+	// API call to the Consul agent fails.
+	consulRetryInterval = 1 * time.Second
+
+	// defaultCheckTimeout changes the timeout of TTL checks
+	defaultCheckTimeout = 5 * time.Second
+
+	// DefaultServiceName is the default Consul service name used when
+	// advertising a Vault instance.
+	DefaultServiceName = "vault"
+
+	// reconcileTimeout is how often Vault should query Consul to detect
+	// and fix any state drift.
+	reconcileTimeout = 60 * time.Second
+)
+
+type notifyEvent struct{}
+
+// ConsulServiceRegistration registers the Vault server as a service in
+// Consul, tagged as active or standby, along with a TTL check that passes
+// while the server is unsealed.
+type ConsulServiceRegistration struct {
+	logger              log.Logger
+	client              *api.Client
+	serviceLock         sync.RWMutex
+	redirectHost        string
+	redirectPort        int64
+	serviceName         string
+	serviceTags         []string
+	disableRegistration bool
+	checkTimeout        time.Duration
+
+	notifyActiveCh chan notifyEvent
+	notifySealedCh chan notifyEvent
+}
+
+// NewServiceRegistration constructs a Consul service registration using the
+// agent at the configured address.
+func NewServiceRegistration(conf map[string]string, logger log.Logger) (sr.ServiceRegistration, error) {
+	// Allow admins to disable consul integration
+	disableReg, ok := conf["disable_registration"]
+	var disableRegistration bool
+	if ok && disableReg != "" {
+		b, err := strconv.ParseBool(disableReg)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing disable_registration parameter: {{err}}", err)
+		}
+		disableRegistration = b
+	}
+	if logger.IsDebug() {
+		logger.Debug("service_registration/consul: config disable_registration set", "disable_registration", disableRegistration)
+	}
+
+	// Get the service name to advertise in Consul
+	service, ok := conf["service"]
+	if !ok {
+		service = DefaultServiceName
+	}
+	if logger.IsDebug() {
+		logger.Debug("service_registration/consul: config service set", "service", service)
+	}
+
+	// Get the additional tags to attach to the registered service name
+	tags := conf["service_tags"]
+
+	if logger.IsDebug() {
+		logger.Debug("service_registration/consul: config service_tags set", "service_tags", tags)
+	}
+
+	checkTimeout := defaultCheckTimeout
+	checkTimeoutStr, ok := conf["check_timeout"]
+	if ok {
+		d, err := time.ParseDuration(checkTimeoutStr)
+		if err != nil {
+			return nil, err
+		}
+
+		min, _ := lib.DurationMinusBufferDomain(d, checkMinBuffer, checkJitterFactor)
+		if min < checkMinBuffer {
+			return nil, fmt.Errorf("Consul check_timeout must be greater than %v", min)
+		}
+
+		checkTimeout = d
+		if logger.IsDebug() {
+			logger.Debug("service_registration/consul: config check_timeout set", "check_timeout", d)
+		}
+	}
+
+	// Configure the client
+	consulConf := api.DefaultConfig()
+
+	if addr, ok := conf["address"]; ok {
+		consulConf.Address = addr
+		if logger.IsDebug() {
+			logger.Debug("service_registration/consul: config address set", "address", addr)
+		}
+	}
+	if scheme, ok := conf["scheme"]; ok {
+		consulConf.Scheme = scheme
+		if logger.IsDebug() {
+			logger.Debug("service_registration/consul: config scheme set", "scheme", scheme)
+		}
+	}
+	if token, ok := conf["token"]; ok {
+		consulConf.Token = token
+		logger.Debug("service_registration/consul: config token set")
+	}
+
+	if consulConf.Scheme == "https" {
+		tlsClientConfig, err := physConsul.SetupTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		consulConf.Transport.TLSClientConfig = tlsClientConfig
+		if err := http2.ConfigureTransport(consulConf.Transport); err != nil {
+			return nil, err
+		}
+		logger.Debug("service_registration/consul: configured TLS")
+	}
+
+	consulConf.HttpClient = &http.Client{Transport: consulConf.Transport}
+	client, err := api.NewClient(consulConf)
+	if err != nil {
+		return nil, errwrap.Wrapf("client setup failed: {{err}}", err)
+	}
+
+	c := &ConsulServiceRegistration{
+		logger:              logger,
+		client:              client,
+		serviceName:         service,
+		serviceTags:         strutil.ParseDedupLowercaseAndSortStrings(tags, ","),
+		checkTimeout:        checkTimeout,
+		disableRegistration: disableRegistration,
+		notifyActiveCh:      make(chan notifyEvent),
+		notifySealedCh:      make(chan notifyEvent),
+	}
+	return c, nil
+}
+
+func (c *ConsulServiceRegistration) NotifyActiveStateChange() error {
+	select {
+	case c.notifyActiveCh <- notifyEvent{}:
+	default:
+		// NOTE: If this occurs Vault's active status could be out of
+		// sync with Consul until reconcileTimer expires.
+		c.logger.Warn("service_registration/consul: Concurrent state change notify dropped")
+	}
+
+	return nil
+}
+
+func (c *ConsulServiceRegistration) NotifySealedStateChange() error {
+	select {
+	case c.notifySealedCh <- notifyEvent{}:
+	default:
+		// NOTE: If this occurs Vault's sealed status could be out of
+		// sync with Consul until checkTimer expires.
+		c.logger.Warn("service_registration/consul: Concurrent sealed state change notify dropped")
+	}
+
+	return nil
+}
+
+func (c *ConsulServiceRegistration) checkDuration() time.Duration {
+	return lib.DurationMinusBuffer(c.checkTimeout, checkMinBuffer, checkJitterFactor)
+}
+
+func (c *ConsulServiceRegistration) Run(waitGroup *sync.WaitGroup, shutdownCh <-chan struct{}, redirectAddr string, activeFunc sr.ActiveFunction, sealedFunc sr.SealedFunction) (err error) {
+	if err := c.setRedirectAddr(redirectAddr); err != nil {
+		return err
+	}
+
+	// 'server' command will wait for the below goroutine to complete
+	waitGroup.Add(1)
+
+	go c.runEventDemuxer(waitGroup, shutdownCh, activeFunc, sealedFunc)
+
+	return nil
+}
+
+func (c *ConsulServiceRegistration) runEventDemuxer(waitGroup *sync.WaitGroup, shutdownCh <-chan struct{}, activeFunc sr.ActiveFunction, sealedFunc sr.SealedFunction) {
+	// This defer statement should be executed last. So push it first.
+	defer waitGroup.Done()
+
+	// Fire the reconcileTimer immediately upon starting the event demuxer
+	reconcileTimer := time.NewTimer(0)
+	defer reconcileTimer.Stop()
+
+	// Schedule the first check.  Consul TTL checks are passing by
+	// default, checkTimer does not need to be run immediately.
+	checkTimer := time.NewTimer(c.checkDuration())
+	defer checkTimer.Stop()
+
+	// Use a reactor pattern to handle and dispatch events to singleton
+	// goroutine handlers for execution.  It is not acceptable to drop
+	// inbound events from Notify*().
+	//
+	// goroutines are dispatched if the demuxer can acquire a lock (via
+	// an atomic CAS incr) on the handler.  Handlers are responsible for
+	// deregistering themselves (atomic CAS decr).  Handlers and the
+	// demuxer share a lock to synchronize information at the beginning
+	// and end of a handler's life (or after a handler wakes up from
+	// sleeping during a back-off/retry).
+	var shutdown int32
+	var checkLock int64
+	var registeredServiceID string
+	var serviceRegLock int64
+
+	for atomic.LoadInt32(&shutdown) == 0 {
+		select {
+		case <-c.notifyActiveCh:
+			// Run reconcile immediately upon active state change notification
+			reconcileTimer.Reset(0)
+		case <-c.notifySealedCh:
+			// Run check timer immediately upon a seal state change notification
+			checkTimer.Reset(0)
+		case <-reconcileTimer.C:
+			// Unconditionally rearm the reconcileTimer
+			reconcileTimer.Reset(reconcileTimeout - lib.RandomStagger(reconcileTimeout/checkJitterFactor))
+
+			// Abort if service discovery is disabled or a
+			// reconcile handler is already active
+			if !c.disableRegistration && atomic.CompareAndSwapInt64(&serviceRegLock, 0, 1) {
+				// Enter handler with serviceRegLock held
+				go func() {
+					defer atomic.CompareAndSwapInt64(&serviceRegLock, 1, 0)
+					for atomic.LoadInt32(&shutdown) == 0 {
+						c.serviceLock.RLock()
+						currentServiceID := registeredServiceID
+						c.serviceLock.RUnlock()
+
+						serviceID, err := c.reconcileConsul(currentServiceID, activeFunc, sealedFunc)
+						if err != nil {
+							if c.logger.IsWarn() {
+								c.logger.Warn("service_registration/consul: reconcile unable to talk with Consul backend", "error", err)
+							}
+							time.Sleep(consulRetryInterval)
+							continue
+						}
+
+						c.serviceLock.Lock()
+						defer c.serviceLock.Unlock()
+
+						registeredServiceID = serviceID
+						return
+					}
+				}()
+			}
+		case <-checkTimer.C:
+			checkTimer.Reset(c.checkDuration())
+			// Abort if service discovery is disabled or a
+			// reconcile handler is active
+			if !c.disableRegistration && atomic.CompareAndSwapInt64(&checkLock, 0, 1) {
+				// Enter handler with checkLock held
+				go func() {
+					defer atomic.CompareAndSwapInt64(&checkLock, 1, 0)
+					for atomic.LoadInt32(&shutdown) == 0 {
+						sealed := sealedFunc()
+						if err := c.runCheck(sealed); err != nil {
+							if c.logger.IsWarn() {
+								c.logger.Warn("service_registration/consul: check unable to talk with Consul backend", "error", err)
+							}
+							time.Sleep(consulRetryInterval)
+							continue
+						}
+						return
+					}
+				}()
+			}
+		case <-shutdownCh:
+			c.logger.Info("service_registration/consul: Shutting down consul service registration")
+			atomic.StoreInt32(&shutdown, 1)
+		}
+	}
+
+	c.serviceLock.RLock()
+	defer c.serviceLock.RUnlock()
+	if registeredServiceID == "" {
+		return
+	}
+	if err := c.client.Agent().ServiceDeregister(registeredServiceID); err != nil {
+		if c.logger.IsWarn() {
+			c.logger.Warn("service_registration/consul: service deregistration failed", "error", err)
+		}
+	}
+}
+
+// checkID returns the ID used for a Consul Check.  Assume at least a read
+// lock is held.
+func (c *ConsulServiceRegistration) checkID() string {
+	return fmt.Sprintf("%s:vault-sealed-check", c.serviceID())
+}
+
+// serviceID returns the Vault ServiceID for use in Consul.  Assume at least
+// a read lock is held.
+func (c *ConsulServiceRegistration) serviceID() string {
+	return fmt.Sprintf("%s:%s:%d", c.serviceName, c.redirectHost, c.redirectPort)
+}
+
+// reconcileConsul queries the state of Vault Core and Consul and fixes up
+// Consul's state according to what's in Vault.  reconcileConsul is called
+// without any locks held and can be run concurrently, therefore no changes
+// to ConsulServiceRegistration can be made in this method (i.e. wtb const
+// receiver for compiler enforced safety).
+func (c *ConsulServiceRegistration) reconcileConsul(registeredServiceID string, activeFunc sr.ActiveFunction, sealedFunc sr.SealedFunction) (serviceID string, err error) {
+	// Query vault Core for its current state
+	active := activeFunc()
+	sealed := sealedFunc()
+
+	agent := c.client.Agent()
+	catalog := c.client.Catalog()
+
+	serviceID = c.serviceID()
+
+	// Get the current state of Vault from Consul
+	var currentVaultService *api.CatalogService
+	if services, _, err := catalog.Service(c.serviceName, "", &api.QueryOptions{AllowStale: true}); err == nil {
+		for _, service := range services {
+			if serviceID == service.ServiceID {
+				currentVaultService = service
+				break
+			}
+		}
+	}
+
+	tags := c.fetchServiceTags(active)
+
+	var reregister bool
+
+	switch {
+	case currentVaultService == nil, registeredServiceID == "":
+		reregister = true
+	default:
+		switch {
+		case !strutil.EquivalentSlices(currentVaultService.ServiceTags, tags):
+			reregister = true
+		}
+	}
+
+	if !reregister {
+		// When re-registration is not required, return a valid serviceID
+		// to avoid registration in the next cycle.
+		return serviceID, nil
+	}
+
+	service := &api.AgentServiceRegistration{
+		ID:                serviceID,
+		Name:              c.serviceName,
+		Tags:              tags,
+		Port:              int(c.redirectPort),
+		Address:           c.redirectHost,
+		EnableTagOverride: false,
+	}
+
+	checkStatus := api.HealthCritical
+	if !sealed {
+		checkStatus = api.HealthPassing
+	}
+
+	sealedCheck := &api.AgentCheckRegistration{
+		ID:        c.checkID(),
+		Name:      "Vault Sealed Status",
+		Notes:     "Vault service is healthy when Vault is in an unsealed status and can become an active Vault server",
+		ServiceID: serviceID,
+		AgentServiceCheck: api.AgentServiceCheck{
+			TTL:    c.checkTimeout.String(),
+			Status: checkStatus,
+		},
+	}
+
+	if err := agent.ServiceRegister(service); err != nil {
+		return "", errwrap.Wrapf(`service registration failed: {{err}}`, err)
+	}
+
+	if err := agent.CheckRegister(sealedCheck); err != nil {
+		return serviceID, errwrap.Wrapf(`service check registration failed: {{err}}`, err)
+	}
+
+	return serviceID, nil
+}
+
+// runCheck immediately pushes a TTL check.
+func (c *ConsulServiceRegistration) runCheck(sealed bool) error {
+	// Run a TTL check
+	agent := c.client.Agent()
+	if !sealed {
+		return agent.PassTTL(c.checkID(), "Vault Unsealed")
+	} else {
+		return agent.FailTTL(c.checkID(), "Vault Sealed")
+	}
+}
+
+// fetchServiceTags returns all of the relevant tags for Consul.
+func (c *ConsulServiceRegistration) fetchServiceTags(active bool) []string {
+	activeTag := "standby"
+	if active {
+		activeTag = "active"
+	}
+	return append(c.serviceTags, activeTag)
+}
+
+func (c *ConsulServiceRegistration) setRedirectAddr(addr string) (err error) {
+	if addr == "" {
+		return fmt.Errorf("redirect address must not be empty")
+	}
+
+	url, err := url.Parse(addr)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf(`failed to parse redirect URL "%v": {{err}}`, addr), err)
+	}
+
+	var portStr string
+	c.redirectHost, portStr, err = net.SplitHostPort(url.Host)
+	if err != nil {
+		if url.Scheme == "http" {
+			portStr = "80"
+		} else if url.Scheme == "https" {
+			portStr = "443"
+		} else if url.Scheme == "unix" {
+			portStr = "-1"
+			c.redirectHost = url.Path
+		} else {
+			return errwrap.Wrapf(fmt.Sprintf(`failed to find a host:port in redirect address "%v": {{err}}`, url.Host), err)
+		}
+	}
+	c.redirectPort, err = strconv.ParseInt(portStr, 10, 0)
+	if err != nil || c.redirectPort < -1 || c.redirectPort > 65535 {
+		return errwrap.Wrapf(fmt.Sprintf(`failed to parse valid port "%v": {{err}}`, portStr), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,478 @@
+package consul
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/helper/strutil"
+	sr "github.com/hashicorp/vault/serviceregistration"
+)
+
+type consulConf map[string]string
+
+func testConsulServiceRegistration(t *testing.T) *ConsulServiceRegistration {
+	return testConsulServiceRegistrationConfig(t, &consulConf{})
+}
+
+func testConsulServiceRegistrationConfig(t *testing.T, conf *consulConf) *ConsulServiceRegistration {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	be, err := NewServiceRegistration(*conf, logger)
+	if err != nil {
+		t.Fatalf("Expected Consul to initialize: %v", err)
+	}
+
+	c, ok := be.(*ConsulServiceRegistration)
+	if !ok {
+		t.Fatalf("Expected ConsulServiceRegistration")
+	}
+
+	return c
+}
+
+func testActiveFunc(activePct float64) sr.ActiveFunction {
+	return func() bool {
+		var active bool
+		standbyProb := rand.Float64()
+		if standbyProb > activePct {
+			active = true
+		}
+		return active
+	}
+}
+
+func testSealedFunc(sealedPct float64) sr.SealedFunction {
+	return func() bool {
+		var sealed bool
+		unsealedProb := rand.Float64()
+		if unsealedProb > sealedPct {
+			sealed = true
+		}
+		return sealed
+	}
+}
+
+// fakeConsulAgent implements the parts of the Consul agent and catalog APIs
+// used for service registration
+type fakeConsulAgent struct {
+	l        sync.Mutex
+	services map[string]*api.AgentServiceRegistration
+	checks   map[string]string
+}
+
+func newFakeConsulAgent() (*fakeConsulAgent, *httptest.Server) {
+	f := &fakeConsulAgent{
+		services: make(map[string]*api.AgentServiceRegistration),
+		checks:   make(map[string]string),
+	}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeConsulAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var service api.AgentServiceRegistration
+		if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.services[service.ID] = &service
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		delete(f.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+	case r.URL.Path == "/v1/agent/check/register":
+		var check api.AgentCheckRegistration
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.checks[check.ID] = check.Status
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+		f.checks[strings.TrimPrefix(r.URL.Path, "/v1/agent/check/pass/")] = api.HealthPassing
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/fail/"):
+		f.checks[strings.TrimPrefix(r.URL.Path, "/v1/agent/check/fail/")] = api.HealthCritical
+	case strings.HasPrefix(r.URL.Path, "/v1/catalog/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/catalog/service/")
+		services := []*api.CatalogService{}
+		for _, service := range f.services {
+			if service.Name == name {
+				services = append(services, &api.CatalogService{
+					ServiceID:   service.ID,
+					ServiceName: service.Name,
+					ServiceTags: service.Tags,
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(services)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// service returns the tags of a registered service and the status of its
+// check
+func (f *fakeConsulAgent) service(id string) ([]string, string, bool) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	service, ok := f.services[id]
+	if !ok {
+		return nil, "", false
+	}
+	return service.Tags, f.checks[id+":vault-sealed-check"], true
+}
+
+func TestConsul_ServiceRegistration(t *testing.T) {
+	agent, server := newFakeConsulAgent()
+	defer server.Close()
+
+	c := testConsulServiceRegistrationConfig(t, &consulConf{
+		"address":      strings.TrimPrefix(server.URL, "http://"),
+		"service_tags": "foo",
+	})
+
+	var active, sealed bool
+	var stateLock sync.Mutex
+	activeFunc := func() bool {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return active
+	}
+	sealedFunc := func() bool {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return sealed
+	}
+
+	shutdownCh := make(chan struct{})
+	waitGroup := &sync.WaitGroup{}
+	if err := c.Run(waitGroup, shutdownCh, "http://127.0.0.1:8200", activeFunc, sealedFunc); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	waitFor := func(expectedTags []string, expectedStatus string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			tags, status, ok := agent.service("vault:127.0.0.1:8200")
+			if ok && strutil.EquivalentSlices(tags, expectedTags) && status == expectedStatus {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("bad: %v %v %q", ok, tags, status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Registered as an unsealed standby right away
+	waitFor([]string{"foo", "standby"}, api.HealthPassing)
+
+	stateLock.Lock()
+	active = true
+	stateLock.Unlock()
+	if err := c.NotifyActiveStateChange(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	waitFor([]string{"foo", "active"}, api.HealthPassing)
+
+	stateLock.Lock()
+	sealed = true
+	stateLock.Unlock()
+	if err := c.NotifySealedStateChange(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	waitFor([]string{"foo", "active"}, api.HealthCritical)
+
+	// The service is deregistered on shutdown
+	close(shutdownCh)
+	waitGroup.Wait()
+	if _, _, ok := agent.service("vault:127.0.0.1:8200"); ok {
+		t.Fatal("service should be deregistered")
+	}
+}
+
+func TestConsul_ServiceTags(t *testing.T) {
+	consulConfig := map[string]string{
+		"service":              "astronomy",
+		"service_tags":         "deadbeef, cafeefac, deadc0de, feedface",
+		"check_timeout":        "6s",
+		"address":              "127.0.0.2",
+		"scheme":               "https",
+		"token":                "deadbeef-cafeefac-deadc0de-feedface",
+		"disable_registration": "false",
+	}
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	be, err := NewServiceRegistration(consulConfig, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, ok := be.(*ConsulServiceRegistration)
+	if !ok {
+		t.Fatalf("failed to create Consul service registration")
+	}
+
+	expected := []string{"deadbeef", "cafeefac", "deadc0de", "feedface"}
+	actual := c.fetchServiceTags(false)
+	if !strutil.EquivalentSlices(actual, append(expected, "standby")) {
+		t.Fatalf("bad: expected:%s actual:%s", append(expected, "standby"), actual)
+	}
+
+	actual = c.fetchServiceTags(true)
+	if !strutil.EquivalentSlices(actual, append(expected, "active")) {
+		t.Fatalf("bad: expected:%s actual:%s", append(expected, "active"), actual)
+	}
+}
+
+func TestConsul_NewServiceRegistration(t *testing.T) {
+	tests := []struct {
+		name         string
+		consulConfig map[string]string
+		fail         bool
+		redirectAddr string
+		checkTimeout time.Duration
+		service      string
+		disableReg   bool
+	}{
+		{
+			name:         "Valid default config",
+			consulConfig: map[string]string{},
+			checkTimeout: 5 * time.Second,
+			redirectAddr: "http://127.0.0.1:8200",
+			service:      "vault",
+			disableReg:   false,
+		},
+		{
+			name: "Valid modified config",
+			consulConfig: map[string]string{
+				"service":              "astronomy",
+				"check_timeout":        "6s",
+				"address":              "127.0.0.2",
+				"scheme":               "https",
+				"token":                "deadbeef-cafeefac-deadc0de-feedface",
+				"disable_registration": "true",
+			},
+			checkTimeout: 6 * time.Second,
+			service:      "astronomy",
+			redirectAddr: "http://127.0.0.2:8200",
+			disableReg:   true,
+		},
+		{
+			name: "check timeout too short",
+			fail: true,
+			consulConfig: map[string]string{
+				"check_timeout": "99ms",
+			},
+		},
+		{
+			name: "invalid disable_registration",
+			fail: true,
+			consulConfig: map[string]string{
+				"disable_registration": "maybe",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		logger := logformat.NewVaultLogger(log.LevelTrace)
+
+		be, err := NewServiceRegistration(test.consulConfig, logger)
+		if test.fail {
+			if err == nil {
+				t.Fatalf(`Expected config "%s" to fail`, test.name)
+			} else {
+				continue
+			}
+		} else if !test.fail && err != nil {
+			t.Fatalf("Expected config %s to not fail: %v", test.name, err)
+		}
+
+		c, ok := be.(*ConsulServiceRegistration)
+		if !ok {
+			t.Fatalf("Expected ConsulServiceRegistration: %s", test.name)
+		}
+
+		if test.disableReg != c.disableRegistration {
+			t.Errorf("bad: %v != %v", test.disableReg, c.disableRegistration)
+		}
+		c.disableRegistration = true
+
+		shutdownCh := make(chan struct{})
+		waitGroup := &sync.WaitGroup{}
+		if err := c.Run(waitGroup, shutdownCh, test.redirectAddr, testActiveFunc(0.5), testSealedFunc(0.5)); err != nil {
+			t.Fatalf("bad: %v", err)
+		}
+		close(shutdownCh)
+		waitGroup.Wait()
+
+		if test.checkTimeout != c.checkTimeout {
+			t.Errorf("bad: %v != %v", test.checkTimeout, c.checkTimeout)
+		}
+
+		if test.service != c.serviceName {
+			t.Errorf("bad: %v != %v", test.service, c.serviceName)
+		}
+	}
+}
+
+func TestConsul_serviceTags(t *testing.T) {
+	tests := []struct {
+		active bool
+		tags   []string
+	}{
+		{
+			active: true,
+			tags:   []string{"active"},
+		},
+		{
+			active: false,
+			tags:   []string{"standby"},
+		},
+	}
+
+	c := testConsulServiceRegistration(t)
+
+	for _, test := range tests {
+		tags := c.fetchServiceTags(test.active)
+		if !reflect.DeepEqual(tags[:], test.tags[:]) {
+			t.Errorf("Bad %v: %v %v", test.active, tags, test.tags)
+		}
+	}
+}
+
+func TestConsul_setRedirectAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		host string
+		port int64
+		pass bool
+	}{
+		{
+			addr: "http://127.0.0.1:8200/",
+			host: "127.0.0.1",
+			port: 8200,
+			pass: true,
+		},
+		{
+			addr: "http://127.0.0.1:8200",
+			host: "127.0.0.1",
+			port: 8200,
+			pass: true,
+		},
+		{
+			addr: "https://127.0.0.1:8200",
+			host: "127.0.0.1",
+			port: 8200,
+			pass: true,
+		},
+		{
+			addr: "unix:///tmp/.vault.addr.sock",
+			host: "/tmp/.vault.addr.sock",
+			port: -1,
+			pass: true,
+		},
+		{
+			addr: "127.0.0.1:8200",
+			pass: false,
+		},
+		{
+			addr: "127.0.0.1",
+			pass: false,
+		},
+	}
+	for _, test := range tests {
+		c := testConsulServiceRegistration(t)
+		err := c.setRedirectAddr(test.addr)
+		if test.pass {
+			if err != nil {
+				t.Fatalf("bad: %v", err)
+			}
+		} else {
+			if err == nil {
+				t.Fatalf("bad, expected fail")
+			} else {
+				continue
+			}
+		}
+
+		if c.redirectHost != test.host {
+			t.Fatalf("bad: %v != %v", c.redirectHost, test.host)
+		}
+
+		if c.redirectPort != test.port {
+			t.Fatalf("bad: %v != %v", c.redirectPort, test.port)
+		}
+	}
+}
+
+func TestConsul_NotifyActiveStateChange(t *testing.T) {
+	c := testConsulServiceRegistration(t)
+
+	if err := c.NotifyActiveStateChange(); err != nil {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestConsul_NotifySealedStateChange(t *testing.T) {
+	c := testConsulServiceRegistration(t)
+
+	if err := c.NotifySealedStateChange(); err != nil {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestConsul_serviceID(t *testing.T) {
+	passingTests := []struct {
+		name         string
+		redirectAddr string
+		serviceName  string
+		expected     string
+	}{
+		{
+			name:         "valid host w/o slash",
+			redirectAddr: "http://127.0.0.1:8200",
+			serviceName:  "sea-tech-astronomy",
+			expected:     "sea-tech-astronomy:127.0.0.1:8200",
+		},
+		{
+			name:         "valid host w/ slash",
+			redirectAddr: "http://127.0.0.1:8200/",
+			serviceName:  "sea-tech-astronomy",
+			expected:     "sea-tech-astronomy:127.0.0.1:8200",
+		},
+		{
+			name:         "valid https host w/ slash",
+			redirectAddr: "https://127.0.0.1:8200/",
+			serviceName:  "sea-tech-astronomy",
+			expected:     "sea-tech-astronomy:127.0.0.1:8200",
+		},
+	}
+
+	for _, test := range passingTests {
+		c := testConsulServiceRegistrationConfig(t, &consulConf{
+			"service": test.serviceName,
+		})
+
+		if err := c.setRedirectAddr(test.redirectAddr); err != nil {
+			t.Fatalf("bad: %s %v", test.name, err)
+		}
+
+		serviceID := c.serviceID()
+		if serviceID != test.expected {
+			t.Fatalf("bad: %v != %v", serviceID, test.expected)
+		}
+	}
+}
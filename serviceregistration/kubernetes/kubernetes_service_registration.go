@@ -0,0 +1,240 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/errwrap"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	sr "github.com/hashicorp/vault/serviceregistration"
+	"github.com/hashicorp/vault/version"
+)
+
+const (
+	// Labels set on the pod of the Vault server
+	labelActive  = "vault-active"
+	labelSealed  = "vault-sealed"
+	labelVersion = "vault-version"
+
+	// defaultRetryInterval is the time to wait before trying again to
+	// label the pod after the Kubernetes API could not be reached
+	defaultRetryInterval = 5 * time.Second
+
+	// requestTimeout bounds each call to the Kubernetes API
+	requestTimeout = 10 * time.Second
+)
+
+var (
+	// The service account credentials mounted into every pod. These are
+	// variables so that tests can point them elsewhere.
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAPath    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// KubernetesServiceRegistration labels the pod that runs the Vault server
+// with whether it is active and whether it is sealed, so that Kubernetes
+// services can select the active node or the unsealed ones.
+type KubernetesServiceRegistration struct {
+	logger        log.Logger
+	client        *http.Client
+	podURL        string
+	retryInterval time.Duration
+
+	notifyCh chan struct{}
+}
+
+// NewServiceRegistration constructs a Kubernetes service registration for
+// the pod it runs in, using the API server and service account that
+// Kubernetes provides to every pod.
+func NewServiceRegistration(conf map[string]string, logger log.Logger) (sr.ServiceRegistration, error) {
+	namespace := conf["namespace"]
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_K8S_NAMESPACE")
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("'namespace' must be set")
+	}
+
+	podName := conf["pod_name"]
+	if podName == "" {
+		podName = os.Getenv("VAULT_K8S_POD_NAME")
+	}
+	if podName == "" {
+		return nil, fmt.Errorf("'pod_name' must be set")
+	}
+	if logger.IsDebug() {
+		logger.Debug("service_registration/kubernetes: config pod set", "namespace", namespace, "pod_name", podName)
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set; Vault must run in a Kubernetes pod")
+	}
+
+	caPEM, err := ioutil.ReadFile(serviceAccountCAPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read service account CA certificate: {{err}}", err)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("failed to parse service account CA certificate")
+	}
+
+	// Fail early rather than on the first update if there is no token
+	if _, err := ioutil.ReadFile(serviceAccountTokenPath); err != nil {
+		return nil, errwrap.Wrapf("failed to read service account token: {{err}}", err)
+	}
+
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    caPool,
+	}
+
+	podURL := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(host, port),
+		Path:   fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(namespace), url.PathEscape(podName)),
+	}
+
+	k := &KubernetesServiceRegistration{
+		logger: logger,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   requestTimeout,
+		},
+		podURL:        podURL.String(),
+		retryInterval: defaultRetryInterval,
+		notifyCh:      make(chan struct{}, 1),
+	}
+	return k, nil
+}
+
+func (k *KubernetesServiceRegistration) NotifyActiveStateChange() error {
+	k.notify()
+	return nil
+}
+
+func (k *KubernetesServiceRegistration) NotifySealedStateChange() error {
+	k.notify()
+	return nil
+}
+
+// notify schedules an update of the labels. As every update sets all of
+// them, a notification that is already pending covers this one.
+func (k *KubernetesServiceRegistration) notify() {
+	select {
+	case k.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (k *KubernetesServiceRegistration) Run(waitGroup *sync.WaitGroup, shutdownCh <-chan struct{}, redirectAddr string, activeFunc sr.ActiveFunction, sealedFunc sr.SealedFunction) error {
+	// 'server' command will wait for the below goroutine to complete
+	waitGroup.Add(1)
+
+	go k.run(waitGroup, shutdownCh, activeFunc, sealedFunc)
+
+	return nil
+}
+
+// run labels the pod on start and after every notification, retrying
+// until an update succeeds.
+func (k *KubernetesServiceRegistration) run(waitGroup *sync.WaitGroup, shutdownCh <-chan struct{}, activeFunc sr.ActiveFunction, sealedFunc sr.SealedFunction) {
+	defer waitGroup.Done()
+
+	retryTimer := time.NewTimer(0)
+	defer retryTimer.Stop()
+
+	for {
+		select {
+		case <-k.notifyCh:
+		case <-retryTimer.C:
+		case <-shutdownCh:
+			// The pod is going away, so stop routing requests to it as
+			// the active node if it still is one
+			if err := k.patchLabels(map[string]string{labelActive: "false"}); err != nil {
+				k.logger.Warn("service_registration/kubernetes: failed to update pod labels on shutdown", "error", err)
+			}
+			k.logger.Info("service_registration/kubernetes: shutting down kubernetes service registration")
+			return
+		}
+
+		labels := map[string]string{
+			labelActive:  strconv.FormatBool(activeFunc()),
+			labelSealed:  strconv.FormatBool(sealedFunc()),
+			labelVersion: versionLabel(),
+		}
+		if err := k.patchLabels(labels); err != nil {
+			k.logger.Warn("service_registration/kubernetes: failed to update pod labels", "error", err)
+			retryTimer.Reset(k.retryInterval)
+			continue
+		}
+		if k.logger.IsDebug() {
+			k.logger.Debug("service_registration/kubernetes: updated pod labels", "active", labels[labelActive], "sealed", labels[labelSealed])
+		}
+	}
+}
+
+// patchLabels sets the given labels on the pod with a JSON merge patch,
+// which leaves its other labels alone.
+func (k *KubernetesServiceRegistration) patchLabels(labels map[string]string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tokens can be rotated, so read it anew for every request
+	token, err := ioutil.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		return errwrap.Wrapf("failed to read service account token: {{err}}", err)
+	}
+
+	req, err := http.NewRequest("PATCH", k.podURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response from Kubernetes API: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// versionLabel returns the version of Vault in a form that is a valid label
+// value
+func versionLabel() string {
+	v := version.GetVersion()
+	if v.Version == "unknown" {
+		return "unknown"
+	}
+	return strings.Replace(v.VersionNumber(), "+", "_", -1)
+}
@@ -0,0 +1,249 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/vault/helper/logformat"
+)
+
+const testToken = "test-service-account-token"
+
+// fakeKubernetes implements the pod patch call of the Kubernetes API
+type fakeKubernetes struct {
+	l        sync.Mutex
+	labels   map[string]string
+	failures int
+}
+
+func (f *fakeKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if r.Method != "PATCH" || r.URL.Path != "/api/v1/namespaces/vault-ns/pods/vault-0" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+		http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if f.failures > 0 {
+		f.failures--
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var patch struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for k, v := range patch.Metadata.Labels {
+		f.labels[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func (f *fakeKubernetes) label(name string) string {
+	f.l.Lock()
+	defer f.l.Unlock()
+	return f.labels[name]
+}
+
+// testFakeKubernetes starts a fake API server and points the in-cluster
+// configuration at it
+func testFakeKubernetes(t *testing.T, failures int) (*fakeKubernetes, func()) {
+	f := &fakeKubernetes{
+		labels: map[string]string{
+			"app": "vault",
+		},
+		failures: failures,
+	}
+	server := httptest.NewTLSServer(f)
+
+	dir, err := ioutil.TempDir("", "vault-k8s")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	oldTokenPath, oldCAPath := serviceAccountTokenPath, serviceAccountCAPath
+	serviceAccountTokenPath = filepath.Join(dir, "token")
+	serviceAccountCAPath = filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(serviceAccountTokenPath, []byte(testToken+"\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.TLS.Certificates[0].Certificate[0],
+	})
+	if err := ioutil.WriteFile(serviceAccountCAPath, caPEM, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	os.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	return f, func() {
+		server.Close()
+		os.RemoveAll(dir)
+		serviceAccountTokenPath, serviceAccountCAPath = oldTokenPath, oldCAPath
+		os.Unsetenv("KUBERNETES_SERVICE_HOST")
+		os.Unsetenv("KUBERNETES_SERVICE_PORT")
+	}
+}
+
+func waitForLabel(t *testing.T, f *fakeKubernetes, name, expected string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for f.label(name) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("bad: label %s is %q, expected %q", name, f.label(name), expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKubernetes_ServiceRegistration(t *testing.T) {
+	f, cleanup := testFakeKubernetes(t, 0)
+	defer cleanup()
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	r, err := NewServiceRegistration(map[string]string{
+		"namespace": "vault-ns",
+		"pod_name":  "vault-0",
+	}, logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var active, sealed bool
+	var stateLock sync.Mutex
+	activeFunc := func() bool {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return active
+	}
+	sealedFunc := func() bool {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return sealed
+	}
+
+	sealed = true
+	shutdownCh := make(chan struct{})
+	waitGroup := &sync.WaitGroup{}
+	if err := r.Run(waitGroup, shutdownCh, "http://127.0.0.1:8200", activeFunc, sealedFunc); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The pod is labeled on start
+	waitForLabel(t, f, labelSealed, "true")
+	waitForLabel(t, f, labelActive, "false")
+	waitForLabel(t, f, labelVersion, versionLabel())
+
+	stateLock.Lock()
+	sealed = false
+	stateLock.Unlock()
+	if err := r.NotifySealedStateChange(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	waitForLabel(t, f, labelSealed, "false")
+
+	stateLock.Lock()
+	active = true
+	stateLock.Unlock()
+	if err := r.NotifyActiveStateChange(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	waitForLabel(t, f, labelActive, "true")
+
+	// The pod no longer claims to be active after shutdown, and other
+	// labels are left alone
+	close(shutdownCh)
+	waitGroup.Wait()
+	if v := f.label(labelActive); v != "false" {
+		t.Fatalf("bad: %q", v)
+	}
+	if v := f.label("app"); v != "vault" {
+		t.Fatalf("bad: %q", v)
+	}
+}
+
+func TestKubernetes_ServiceRegistration_Retry(t *testing.T) {
+	f, cleanup := testFakeKubernetes(t, 2)
+	defer cleanup()
+
+	os.Setenv("VAULT_K8S_NAMESPACE", "vault-ns")
+	os.Setenv("VAULT_K8S_POD_NAME", "vault-0")
+	defer os.Unsetenv("VAULT_K8S_NAMESPACE")
+	defer os.Unsetenv("VAULT_K8S_POD_NAME")
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	r, err := NewServiceRegistration(map[string]string{}, logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	r.(*KubernetesServiceRegistration).retryInterval = 10 * time.Millisecond
+
+	shutdownCh := make(chan struct{})
+	waitGroup := &sync.WaitGroup{}
+	if err := r.Run(waitGroup, shutdownCh, "http://127.0.0.1:8200", func() bool { return true }, func() bool { return false }); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer waitGroup.Wait()
+	defer close(shutdownCh)
+
+	// The labels are set once the API server recovers
+	waitForLabel(t, f, labelActive, "true")
+	waitForLabel(t, f, labelSealed, "false")
+}
+
+func TestKubernetes_NewServiceRegistration(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	// Outside of a pod
+	if _, err := NewServiceRegistration(map[string]string{
+		"namespace": "vault-ns",
+		"pod_name":  "vault-0",
+	}, logger); err == nil {
+		t.Fatal("expected error without the Kubernetes service environment")
+	}
+
+	_, cleanup := testFakeKubernetes(t, 0)
+	defer cleanup()
+
+	if _, err := NewServiceRegistration(map[string]string{
+		"pod_name": "vault-0",
+	}, logger); err == nil {
+		t.Fatal("expected error without a namespace")
+	}
+	if _, err := NewServiceRegistration(map[string]string{
+		"namespace": "vault-ns",
+	}, logger); err == nil {
+		t.Fatal("expected error without a pod name")
+	}
+}
@@ -0,0 +1,33 @@
+package serviceregistration
+
+import (
+	"sync"
+
+	log "github.com/mgutz/logxi/v1"
+)
+
+// Factory is the factory function to create a ServiceRegistration.
+type Factory func(config map[string]string, logger log.Logger) (ServiceRegistration, error)
+
+// Callback signatures for Run
+type ActiveFunction func() bool
+type SealedFunction func() bool
+
+// ServiceRegistration advertises the state of a Vault server, such as
+// whether it is active or sealed, to a service discovery system. It is
+// configured independently of the storage backend.
+type ServiceRegistration interface {
+	// Run starts advertising the state of the server at the given redirect
+	// address, which is queried with the given functions. It registers with
+	// the wait group and keeps running until the shutdown channel is
+	// closed.
+	Run(waitGroup *sync.WaitGroup, shutdownCh <-chan struct{}, redirectAddr string, activeFunc ActiveFunction, sealedFunc SealedFunction) error
+
+	// NotifyActiveStateChange is used by Core to notify that this Vault
+	// instance has changed its status to active or standby.
+	NotifyActiveStateChange() error
+
+	// NotifySealedStateChange is used by Core to notify that Vault has
+	// changed its sealed status.
+	NotifySealedStateChange() error
+}
@@ -74,6 +74,8 @@ func NewACL(policies []*Policy) (*ACL, error) {
 				existingPerms.CapabilitiesBitmap = DenyCapabilityInt
 				existingPerms.AllowedParameters = nil
 				existingPerms.DeniedParameters = nil
+				existingPerms.ControlGroup = nil
+				existingPerms.MFAMethods = nil
 				goto INSERT
 
 			default:
@@ -140,6 +142,22 @@ func NewACL(policies []*Policy) (*ACL, error) {
 				}
 			}
 
+			// A request must satisfy the control groups of every policy
+			// granting access to the path
+			if pc.Permissions.ControlGroup != nil {
+				if existingPerms.ControlGroup == nil {
+					existingPerms.ControlGroup = pc.Permissions.ControlGroup.Clone()
+				} else {
+					existingPerms.ControlGroup.merge(pc.Permissions.ControlGroup)
+				}
+			}
+
+			// Likewise, every MFA method required by any of the policies
+			// must be satisfied
+			if len(pc.Permissions.MFAMethods) > 0 {
+				existingPerms.MFAMethods = strutil.RemoveDuplicates(append(existingPerms.MFAMethods, pc.Permissions.MFAMethods...), false)
+			}
+
 		INSERT:
 			tree.Insert(pc.Prefix, existingPerms)
 
@@ -201,6 +219,54 @@ CHECK:
 	return
 }
 
+// ControlGroup returns the control group that must be satisfied before a
+// request to the given path is processed, or nil if there is none.
+func (a *ACL) ControlGroup(path string) *ControlGroup {
+	// Fast-path root
+	if a.root {
+		return nil
+	}
+
+	// Find an exact matching rule, look for glob if no match
+	raw, ok := a.exactRules.Get(path)
+	if !ok {
+		_, raw, ok = a.globRules.LongestPrefix(path)
+		if !ok {
+			return nil
+		}
+	}
+
+	perm := raw.(*Permissions)
+	if perm.CapabilitiesBitmap&DenyCapabilityInt > 0 {
+		return nil
+	}
+	return perm.ControlGroup
+}
+
+// MFAMethods returns the names of the MFA methods that must be validated
+// before a request to the given path is processed.
+func (a *ACL) MFAMethods(path string) []string {
+	// Fast-path root
+	if a.root {
+		return nil
+	}
+
+	// Find an exact matching rule, look for glob if no match
+	raw, ok := a.exactRules.Get(path)
+	if !ok {
+		_, raw, ok = a.globRules.LongestPrefix(path)
+		if !ok {
+			return nil
+		}
+	}
+
+	perm := raw.(*Permissions)
+	if perm.CapabilitiesBitmap&DenyCapabilityInt > 0 {
+		return nil
+	}
+	return perm.MFAMethods
+}
+
 // AllowOperation is used to check if the given operation is permitted. The
 // first bool indicates if an op is allowed, the second whether sudo priviliges
 // exist for that op and path.
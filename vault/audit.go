@@ -1,9 +1,11 @@
 package vault
 
 import (
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
@@ -87,7 +90,13 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 		entry.Accessor = accessor
 	}
 	viewPath := auditBarrierPrefix + entry.UUID + "/"
-	view := NewBarrierView(c.barrier, viewPath)
+	view := c.newBarrierView(viewPath)
+
+	// Parse the filter before creating the backend
+	filter, err := parseAuditFilter(entry.Options)
+	if err != nil {
+		return err
+	}
 
 	// Lookup the new backend
 	backend, err := c.newAuditBackend(entry, view, entry.Options)
@@ -107,7 +116,7 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 	c.audit = newTable
 
 	// Register the backend
-	c.auditBroker.Register(entry.Path, backend, view)
+	c.auditBroker.Register(entry.Path, backend, view, filter)
 	if c.logger.IsInfo() {
 		c.logger.Info("core: enabled audit backend", "path", entry.Path, "type", entry.Type)
 	}
@@ -163,12 +172,12 @@ func (c *Core) loadAudits() error {
 	localAuditTable := &MountTable{}
 
 	// Load the existing audit table
-	raw, err := c.barrier.Get(coreAuditConfigPath)
+	raw, err := c.barrier.Get(context.Background(), coreAuditConfigPath)
 	if err != nil {
 		c.logger.Error("core: failed to read audit table", "error", err)
 		return errLoadAuditFailed
 	}
-	rawLocal, err := c.barrier.Get(coreLocalAuditConfigPath)
+	rawLocal, err := c.barrier.Get(context.Background(), coreLocalAuditConfigPath)
 	if err != nil {
 		c.logger.Error("core: failed to read local audit table", "error", err)
 		return errLoadAuditFailed
@@ -233,6 +242,16 @@ func (c *Core) loadAudits() error {
 
 // persistAudit is used to persist the audit table after modification
 func (c *Core) persistAudit(table *MountTable, localOnly bool) error {
+	// Performance standbys leave any changes to the active node
+	if c.perfStandby {
+		return logical.ErrReadOnly
+	}
+
+	// Secondaries receive the shared table from their primary
+	if c.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		localOnly = true
+	}
+
 	if table.Type != auditTableType {
 		c.logger.Error("core: given table to persist has wrong type", "actual_type", table.Type, "expected_type", auditTableType)
 		return fmt.Errorf("invalid table type given, not persisting")
@@ -276,7 +295,7 @@ func (c *Core) persistAudit(table *MountTable, localOnly bool) error {
 		}
 
 		// Write to the physical backend
-		if err := c.barrier.Put(entry); err != nil {
+		if err := c.barrier.Put(context.Background(), entry); err != nil {
 			c.logger.Error("core: failed to persist audit table", "error", err)
 			return err
 		}
@@ -294,7 +313,7 @@ func (c *Core) persistAudit(table *MountTable, localOnly bool) error {
 		Value: compressedBytes,
 	}
 
-	if err := c.barrier.Put(entry); err != nil {
+	if err := c.barrier.Put(context.Background(), entry); err != nil {
 		c.logger.Error("core: failed to persist local audit table", "error", err)
 		return err
 	}
@@ -305,7 +324,11 @@ func (c *Core) persistAudit(table *MountTable, localOnly bool) error {
 // setupAudit is invoked after we've loaded the audit able to
 // initialize the audit backends
 func (c *Core) setupAudits() error {
+	// The audit devices set up while this node was a standby are replaced
+	c.teardownStandbyAudit()
+
 	broker := NewAuditBroker(c.logger)
+	broker.router = c.router
 
 	c.auditLock.Lock()
 	defer c.auditLock.Unlock()
@@ -315,7 +338,13 @@ func (c *Core) setupAudits() error {
 	for _, entry := range c.audit.Entries {
 		// Create a barrier view using the UUID
 		viewPath := auditBarrierPrefix + entry.UUID + "/"
-		view := NewBarrierView(c.barrier, viewPath)
+		view := c.newBarrierView(viewPath)
+
+		filter, err := parseAuditFilter(entry.Options)
+		if err != nil {
+			c.logger.Error("core: failed to parse audit filter", "path", entry.Path, "error", err)
+			continue
+		}
 
 		// Initialize the backend
 		backend, err := c.newAuditBackend(entry, view, entry.Options)
@@ -329,7 +358,7 @@ func (c *Core) setupAudits() error {
 		}
 
 		// Mount the backend
-		broker.Register(entry.Path, backend, view)
+		broker.Register(entry.Path, backend, view, filter)
 
 		successCount += 1
 	}
@@ -351,6 +380,9 @@ func (c *Core) teardownAudits() error {
 	if c.audit != nil {
 		for _, entry := range c.audit.Entries {
 			c.removeAuditReloadFunc(entry)
+			if c.auditBroker != nil {
+				c.auditBroker.Deregister(entry.Path)
+			}
 		}
 	}
 
@@ -435,6 +467,7 @@ func defaultAuditTable() *MountTable {
 type backendEntry struct {
 	backend audit.Backend
 	view    *BarrierView
+	filter  *auditFilter
 }
 
 // AuditBroker is used to provide a single ingest interface to auditable
@@ -443,6 +476,9 @@ type AuditBroker struct {
 	sync.RWMutex
 	backends map[string]backendEntry
 	logger   log.Logger
+
+	// router is used to find the mount of requests for filtering
+	router *Router
 }
 
 // NewAuditBroker creates a new audit broker
@@ -454,21 +490,35 @@ func NewAuditBroker(log log.Logger) *AuditBroker {
 	return b
 }
 
-// Register is used to add new audit backend to the broker
-func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView) {
+// Register is used to add new audit backend to the broker. The filter
+// decides which entries the backend logs and may be nil.
+func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, f *auditFilter) {
 	a.Lock()
 	defer a.Unlock()
 	a.backends[name] = backendEntry{
 		backend: b,
 		view:    v,
+		filter:  f,
 	}
 }
 
 // Deregister is used to remove an audit backend from the broker
 func (a *AuditBroker) Deregister(name string) {
 	a.Lock()
-	defer a.Unlock()
+	be, ok := a.backends[name]
 	delete(a.backends, name)
+	a.Unlock()
+
+	// Backends sending entries in the background are closed outside of the
+	// lock, as they may take some time to flush
+	if !ok {
+		return
+	}
+	if closer, ok := be.backend.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			a.logger.Error("audit: failed to close backend", "path", name, "error", err)
+		}
+	}
 }
 
 // IsRegistered is used to check if a given audit backend is registered
@@ -527,7 +577,19 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, heade
 
 	// Ensure at least one backend logs
 	anyLogged := false
+	filtered := 0
+	var values map[string]string
 	for name, be := range a.backends {
+		if be.filter != nil && be.filter.expr != nil {
+			if values == nil {
+				values = auditFilterValues(a.router, req, 0)
+			}
+			if !be.filter.matches(values) {
+				filtered++
+				continue
+			}
+		}
+
 		req.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(headers, be.backend.GetHash)
 		if thErr != nil {
@@ -537,7 +599,8 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, heade
 		req.Headers = transHeaders
 
 		start := time.Now()
-		lrErr := be.backend.LogRequest(auth, req, outerErr)
+		fAuth, fReq, _ := be.filter.apply(auth, req, nil)
+		lrErr := be.backend.LogRequest(fAuth, fReq, outerErr)
 		metrics.MeasureSince([]string{"audit", name, "log_request"}, start)
 		if lrErr != nil {
 			a.logger.Error("audit: backend failed to log request", "backend", name, "error", lrErr)
@@ -545,7 +608,7 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, heade
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if !anyLogged && len(a.backends) > filtered {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
 	}
 
@@ -582,7 +645,19 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 
 	// Ensure at least one backend logs
 	anyLogged := false
+	filtered := 0
+	var values map[string]string
 	for name, be := range a.backends {
+		if be.filter != nil && be.filter.expr != nil {
+			if values == nil {
+				values = auditFilterValues(a.router, req, audit.ResponseStatus(req, resp, err))
+			}
+			if !be.filter.matches(values) {
+				filtered++
+				continue
+			}
+		}
+
 		req.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(headers, be.backend.GetHash)
 		if thErr != nil {
@@ -592,7 +667,8 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 		req.Headers = transHeaders
 
 		start := time.Now()
-		lrErr := be.backend.LogResponse(auth, req, resp, err)
+		fAuth, fReq, fResp := be.filter.apply(auth, req, resp)
+		lrErr := be.backend.LogResponse(fAuth, fReq, fResp, err)
 		metrics.MeasureSince([]string{"audit", name, "log_response"}, start)
 		if lrErr != nil {
 			a.logger.Error("audit: backend failed to log response", "backend", name, "error", lrErr)
@@ -600,7 +676,7 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if !anyLogged && len(a.backends) > filtered {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the response"))
 	}
 
@@ -0,0 +1,426 @@
+package vault
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// auditFilterOption is the audit device option holding the filter
+	// expression that entries must match to be logged by the device
+	auditFilterOption = "filter"
+
+	// auditExcludeOption is the audit device option holding the
+	// comma-separated list of fields left out of the device's entries
+	auditExcludeOption = "exclude"
+)
+
+// auditFilterFields are the fields filter expressions can refer to. The
+// string fields support a trailing "*" to match on a prefix, and the
+// response status can be compared with any operator.
+var auditFilterFields = map[string]bool{
+	"mount_type":      false,
+	"mount_path":      false,
+	"operation":       false,
+	"path":            false,
+	"response_status": true,
+}
+
+// auditExcludeFields maps the fields that can be excluded from audit
+// entries to the function clearing them from a copy of the logged values
+var auditExcludeFields = map[string]func(*auditEntryValues){
+	"auth.client_token":             func(v *auditEntryValues) { v.auth.ClientToken = "" },
+	"auth.accessor":                 func(v *auditEntryValues) { v.auth.Accessor = "" },
+	"auth.display_name":             func(v *auditEntryValues) { v.auth.DisplayName = "" },
+	"auth.policies":                 func(v *auditEntryValues) { v.auth.Policies = nil },
+	"auth.metadata":                 func(v *auditEntryValues) { v.auth.Metadata = nil },
+	"auth.entity_id":                func(v *auditEntryValues) { v.auth.EntityID = "" },
+	"request.client_token":          func(v *auditEntryValues) { v.req.ClientToken = "" },
+	"request.client_token_accessor": func(v *auditEntryValues) { v.req.ClientTokenAccessor = "" },
+	"request.data":                  func(v *auditEntryValues) { v.req.Data = nil },
+	"request.headers":               func(v *auditEntryValues) { v.req.Headers = nil },
+	"request.remote_address":        func(v *auditEntryValues) { v.connection().RemoteAddr = "" },
+	"request.remote_port":           func(v *auditEntryValues) { v.connection().RemotePort = 0 },
+	"request.user_agent":            func(v *auditEntryValues) { v.connection().UserAgent = "" },
+	"response.auth":                 func(v *auditEntryValues) { v.resp.Auth = nil },
+	"response.secret":               func(v *auditEntryValues) { v.resp.Secret = nil },
+	"response.data":                 func(v *auditEntryValues) { v.resp.Data = nil },
+	"response.redirect":             func(v *auditEntryValues) { v.resp.Redirect = "" },
+	"response.warnings":             func(v *auditEntryValues) { v.resp.Warnings = nil },
+	"response.wrap_info":            func(v *auditEntryValues) { v.resp.WrapInfo = nil },
+}
+
+// auditFilter decides which entries an audit device logs and which of
+// their fields are left out. It is applied by the audit broker before the
+// entries are handed to the device for formatting.
+type auditFilter struct {
+	expr    auditExpr
+	exclude []string
+}
+
+// auditEntryValues holds the values an audit entry is formatted from
+type auditEntryValues struct {
+	auth *logical.Auth
+	req  *logical.Request
+	resp *logical.Response
+}
+
+// connection returns a copy of the connection of the request that can be
+// modified without affecting the original
+func (v *auditEntryValues) connection() *logical.Connection {
+	conn := &logical.Connection{}
+	if v.req.Connection != nil {
+		*conn = *v.req.Connection
+	}
+	v.req.Connection = conn
+	return conn
+}
+
+// parseAuditFilter parses the filter and exclusion options of an audit
+// device. A nil filter is returned if the device logs everything.
+func parseAuditFilter(options map[string]string) (*auditFilter, error) {
+	f := &auditFilter{}
+
+	if raw := strings.TrimSpace(options[auditFilterOption]); raw != "" {
+		expr, err := parseAuditExpr(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit filter %q: %v", raw, err)
+		}
+		f.expr = expr
+	}
+
+	if raw := options[auditExcludeOption]; raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if _, ok := auditExcludeFields[field]; !ok {
+				return nil, fmt.Errorf("invalid audit exclusion: unknown field %q", field)
+			}
+			f.exclude = append(f.exclude, field)
+		}
+	}
+
+	if f.expr == nil && len(f.exclude) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// matches returns whether an entry with the given field values should be
+// logged
+func (f *auditFilter) matches(values map[string]string) bool {
+	if f == nil || f.expr == nil {
+		return true
+	}
+	return f.expr.eval(values)
+}
+
+// apply returns the values to format an entry from, with the excluded
+// fields cleared. The values passed in are left untouched.
+func (f *auditFilter) apply(auth *logical.Auth, req *logical.Request, resp *logical.Response) (*logical.Auth, *logical.Request, *logical.Response) {
+	if f == nil || len(f.exclude) == 0 {
+		return auth, req, resp
+	}
+
+	v := &auditEntryValues{
+		auth: &logical.Auth{},
+		req:  &logical.Request{},
+		resp: &logical.Response{},
+	}
+	if auth != nil {
+		*v.auth = *auth
+	}
+	if req != nil {
+		*v.req = *req
+	}
+	if resp != nil {
+		*v.resp = *resp
+	}
+	for _, field := range f.exclude {
+		auditExcludeFields[field](v)
+	}
+
+	if auth == nil {
+		v.auth = nil
+	}
+	if req == nil {
+		v.req = nil
+	}
+	if resp == nil {
+		v.resp = nil
+	}
+	return v.auth, v.req, v.resp
+}
+
+// auditFilterValues returns the values of the filter fields for an entry
+// about the request. The mount is looked up with the router if one is
+// given, as requests are logged before being routed.
+func auditFilterValues(router *Router, req *logical.Request, status int) map[string]string {
+	values := map[string]string{
+		"mount_type":      req.MountType,
+		"mount_path":      req.MountPoint,
+		"operation":       string(req.Operation),
+		"path":            req.Path,
+		"response_status": strconv.Itoa(status),
+	}
+	if router != nil {
+		if entry := router.MatchingMountEntry(req.Path); entry != nil {
+			values["mount_type"] = entry.Type
+			values["mount_path"] = router.MatchingMount(req.Path)
+		}
+	}
+	return values
+}
+
+// auditExpr is a node of a parsed filter expression
+type auditExpr interface {
+	eval(values map[string]string) bool
+}
+
+type auditAnd struct{ left, right auditExpr }
+
+func (e *auditAnd) eval(values map[string]string) bool {
+	return e.left.eval(values) && e.right.eval(values)
+}
+
+type auditOr struct{ left, right auditExpr }
+
+func (e *auditOr) eval(values map[string]string) bool {
+	return e.left.eval(values) || e.right.eval(values)
+}
+
+type auditNot struct{ expr auditExpr }
+
+func (e *auditNot) eval(values map[string]string) bool {
+	return !e.expr.eval(values)
+}
+
+// auditCompare compares a field to a value
+type auditCompare struct {
+	field string
+	op    string
+	value string
+}
+
+func (e *auditCompare) eval(values map[string]string) bool {
+	actual := values[e.field]
+
+	if auditFilterFields[e.field] {
+		a, _ := strconv.Atoi(actual)
+		b, _ := strconv.Atoi(e.value)
+		switch e.op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+		return false
+	}
+
+	match := actual == e.value
+	if strings.HasSuffix(e.value, "*") {
+		match = strings.HasPrefix(actual, strings.TrimSuffix(e.value, "*"))
+	}
+	if e.op == "!=" {
+		return !match
+	}
+	return match
+}
+
+// parseAuditExpr parses a filter expression. Comparisons of a field with a
+// value, such as `operation == "read"`, can be combined with "and", "or",
+// "not" and parentheses.
+func parseAuditExpr(raw string) (auditExpr, error) {
+	tokens, err := tokenizeAuditExpr(raw)
+	if err != nil {
+		return nil, err
+	}
+	p := &auditExprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].value)
+	}
+	return expr, nil
+}
+
+type auditToken struct {
+	value  string
+	quoted bool
+}
+
+func tokenizeAuditExpr(raw string) ([]auditToken, error) {
+	var tokens []auditToken
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, auditToken{value: string(c)})
+			i++
+		case c == '"':
+			end := strings.IndexByte(raw[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, auditToken{value: raw[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.IndexByte("=!<>", c) >= 0:
+			op := string(c)
+			if i+1 < len(raw) && raw[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("invalid operator %q", op)
+			}
+			tokens = append(tokens, auditToken{value: op})
+			i += len(op)
+		default:
+			start := i
+			for i < len(raw) && !unicode.IsSpace(rune(raw[i])) && strings.IndexByte("()\"=!<>", raw[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, auditToken{value: raw[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type auditExprParser struct {
+	tokens []auditToken
+	pos    int
+}
+
+// keyword consumes the next token if it is the given unquoted keyword
+func (p *auditExprParser) keyword(value string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *auditExprParser) next() (auditToken, error) {
+	if p.pos == len(p.tokens) {
+		return auditToken{}, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *auditExprParser) parseOr() (auditExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &auditOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *auditExprParser) parseAnd() (auditExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &auditAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *auditExprParser) parseUnary() (auditExpr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &auditNot{expr: expr}, nil
+	}
+
+	if p.keyword("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *auditExprParser) parseComparison() (auditExpr, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	numeric, ok := auditFilterFields[field.value]
+	if field.quoted || !ok {
+		return nil, fmt.Errorf("unknown field %q", field.value)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case op.quoted:
+		return nil, fmt.Errorf("expected an operator after %q, got %q", field.value, op.value)
+	case op.value == "==", op.value == "!=":
+	case op.value == "<", op.value == "<=", op.value == ">", op.value == ">=":
+		if !numeric {
+			return nil, fmt.Errorf("operator %q is not supported for field %q", op.value, field.value)
+		}
+	default:
+		return nil, fmt.Errorf("expected an operator after %q, got %q", field.value, op.value)
+	}
+
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if !value.quoted && (value.value == "(" || value.value == ")") {
+		return nil, fmt.Errorf("expected a value after %q", op.value)
+	}
+	if numeric {
+		if _, err := strconv.Atoi(value.value); err != nil {
+			return nil, fmt.Errorf("field %q must be compared to a number", field.value)
+		}
+	}
+
+	return &auditCompare{
+		field: field.value,
+		op:    op.value,
+		value: value.value,
+	}, nil
+}
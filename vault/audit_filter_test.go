@@ -0,0 +1,148 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestParseAuditFilter(t *testing.T) {
+	valid := []string{
+		`operation == "read"`,
+		`mount_type == kv and operation != read`,
+		`not (path == "sys/*" or mount_path == "auth/token/") and response_status >= 400`,
+		`response_status < 500`,
+	}
+	for _, raw := range valid {
+		f, err := parseAuditFilter(map[string]string{"filter": raw})
+		if err != nil || f == nil {
+			t.Fatalf("%s: err: %v", raw, err)
+		}
+	}
+
+	invalid := []string{
+		`operation`,
+		`operation = "read"`,
+		`foo == "bar"`,
+		`path > "sys/"`,
+		`response_status == ok`,
+		`(operation == "read"`,
+		`operation == "read" and`,
+		`operation == "read`,
+		`operation == "read" path == "sys/"`,
+	}
+	for _, raw := range invalid {
+		if _, err := parseAuditFilter(map[string]string{"filter": raw}); err == nil {
+			t.Fatalf("%s: expected error", raw)
+		}
+	}
+
+	if _, err := parseAuditFilter(map[string]string{"exclude": "request.data,foo"}); err == nil {
+		t.Fatalf("expected error for unknown excluded field")
+	}
+
+	// No filter or exclusion means everything is logged as is
+	f, err := parseAuditFilter(map[string]string{"path": "/var/log/audit.log"})
+	if err != nil || f != nil {
+		t.Fatalf("bad: %#v %v", f, err)
+	}
+}
+
+func TestAuditFilter_Matches(t *testing.T) {
+	values := map[string]string{
+		"mount_type":      "kv",
+		"mount_path":      "secret/",
+		"operation":       "read",
+		"path":            "secret/team-a/foo",
+		"response_status": "403",
+	}
+
+	cases := map[string]bool{
+		`operation == "read"`:                                                true,
+		`operation != "read"`:                                                false,
+		`mount_type == "kv" and mount_path == "secret/"`:                     true,
+		`path == "secret/team-a/*"`:                                          true,
+		`path == "secret/team-b/*"`:                                          false,
+		`path != "secret/team-b/*"`:                                          true,
+		`response_status >= 400 and response_status < 500`:                   true,
+		`response_status == 200 or operation == "read"`:                      true,
+		`not operation == "read"`:                                            false,
+		`not (operation == "list" or path == "sys/*")`:                       true,
+		`operation == "list" or operation == "read" and mount_type == "pki"`: false,
+	}
+	for raw, expected := range cases {
+		f, err := parseAuditFilter(map[string]string{"filter": raw})
+		if err != nil {
+			t.Fatalf("%s: err: %v", raw, err)
+		}
+		if f.matches(values) != expected {
+			t.Fatalf("%s: expected %t", raw, expected)
+		}
+	}
+}
+
+func TestAuditFilter_Apply(t *testing.T) {
+	f, err := parseAuditFilter(map[string]string{
+		"exclude": "auth.metadata, request.data,response.data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &logical.Auth{
+		ClientToken: "foo",
+		Metadata:    map[string]string{"user": "armon"},
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "secret/foo",
+		Data:      map[string]interface{}{"password": "bar"},
+	}
+	resp := &logical.Response{
+		Data:     map[string]interface{}{"password": "bar"},
+		Warnings: []string{"warning"},
+	}
+
+	fAuth, fReq, fResp := f.apply(auth, req, resp)
+	if fAuth.Metadata != nil || fAuth.ClientToken != "foo" {
+		t.Fatalf("bad: %#v", fAuth)
+	}
+	if fReq.Data != nil || fReq.Path != "secret/foo" {
+		t.Fatalf("bad: %#v", fReq)
+	}
+	if fResp.Data != nil || !reflect.DeepEqual(fResp.Warnings, []string{"warning"}) {
+		t.Fatalf("bad: %#v", fResp)
+	}
+
+	// The original values are left untouched
+	if auth.Metadata == nil || req.Data == nil || resp.Data == nil {
+		t.Fatalf("original values were modified")
+	}
+
+	// Missing values stay missing
+	fAuth, _, fResp = f.apply(nil, req, nil)
+	if fAuth != nil || fResp != nil {
+		t.Fatalf("bad: %#v %#v", fAuth, fResp)
+	}
+
+	// Connection fields are excluded on a copy of the connection
+	f, err = parseAuditFilter(map[string]string{
+		"exclude": "request.remote_port,request.user_agent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Connection = &logical.Connection{
+		RemoteAddr: "127.0.0.1",
+		RemotePort: 52000,
+		UserAgent:  "vault-test",
+	}
+	_, fReq, _ = f.apply(auth, req, resp)
+	if fReq.Connection.RemoteAddr != "127.0.0.1" || fReq.Connection.RemotePort != 0 || fReq.Connection.UserAgent != "" {
+		t.Fatalf("bad: %#v", fReq.Connection)
+	}
+	if req.Connection.RemotePort != 52000 || req.Connection.UserAgent != "vault-test" {
+		t.Fatalf("original connection was modified")
+	}
+}
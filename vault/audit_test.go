@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -242,7 +243,7 @@ func TestCore_EnableAudit_Local(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	rawLocal, err := c.barrier.Get(coreLocalAuditConfigPath)
+	rawLocal, err := c.barrier.Get(context.Background(), coreLocalAuditConfigPath)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -262,7 +263,7 @@ func TestCore_EnableAudit_Local(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	rawLocal, err = c.barrier.Get(coreLocalAuditConfigPath)
+	rawLocal, err = c.barrier.Get(context.Background(), coreLocalAuditConfigPath)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -401,8 +402,8 @@ func TestAuditBroker_LogRequest(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil)
-	b.Register("bar", a2, nil)
+	b.Register("foo", a1, nil, nil)
+	b.Register("bar", a2, nil, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -478,8 +479,8 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil)
-	b.Register("bar", a2, nil)
+	b.Register("foo", a1, nil, nil)
+	b.Register("bar", a2, nil, nil)
 
 	auth := &logical.Auth{
 		NumUses:     10,
@@ -572,8 +573,8 @@ func TestAuditBroker_AuditHeaders(t *testing.T) {
 	view := NewBarrierView(barrier, "headers/")
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil)
-	b.Register("bar", a2, nil)
+	b.Register("foo", a1, nil, nil)
+	b.Register("bar", a2, nil, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -637,3 +638,104 @@ func TestAuditBroker_AuditHeaders(t *testing.T) {
 		t.Fatalf("err: %v", err)
 	}
 }
+
+func TestAuditBroker_Filter(t *testing.T) {
+	l := logformat.NewVaultLogger(log.LevelTrace)
+	b := NewAuditBroker(l)
+	a1 := &NoopAudit{}
+	a2 := &NoopAudit{}
+	f1, err := parseAuditFilter(map[string]string{
+		"filter": `operation != "read" or response_status >= 400`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := parseAuditFilter(map[string]string{
+		"exclude": "request.data,response.data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Register("foo", a1, nil, f1)
+	b.Register("bar", a2, nil, f2)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "secret/foo",
+		Data:      map[string]interface{}{"foo": "bar"},
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{"foo": "bar"},
+	}
+	headersConf := &AuditedHeadersConfig{
+		Headers: make(map[string]*auditedHeaderSettings),
+	}
+
+	// Reads are only logged by the unfiltered backend, without the data
+	if err := b.LogRequest(nil, req, headersConf, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.LogResponse(nil, req, resp, headersConf, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(a1.Req) != 0 || len(a1.Resp) != 0 {
+		t.Fatalf("bad: %#v %#v", a1.Req, a1.Resp)
+	}
+	if len(a2.Req) != 1 || a2.Req[0].Data != nil || len(a2.Resp) != 1 || a2.Resp[0].Data != nil {
+		t.Fatalf("bad: %#v %#v", a2.Req, a2.Resp)
+	}
+	if req.Data == nil || resp.Data == nil {
+		t.Fatalf("logged values were modified")
+	}
+
+	// Failed reads are logged by both
+	if err := b.LogResponse(nil, req, nil, headersConf, logical.ErrPermissionDenied); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(a1.Resp) != 1 || len(a2.Resp) != 2 {
+		t.Fatalf("bad: %d %d", len(a1.Resp), len(a2.Resp))
+	}
+
+	// Entries filtered out by every backend are not a failure
+	b.Deregister("bar")
+	if err := b.LogRequest(nil, req, headersConf, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(a1.Req) != 0 {
+		t.Fatalf("bad: %#v", a1.Req)
+	}
+}
+
+func TestCore_EnableAudit_Filter(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+
+	me := &MountEntry{
+		Table: auditTableType,
+		Path:  "foo",
+		Type:  "noop",
+		Options: map[string]string{
+			"filter": `mount_type ==`,
+		},
+	}
+	if err := c.enableAudit(me); err == nil || !strings.Contains(err.Error(), "invalid audit filter") {
+		t.Fatalf("expected filter error, got: %v", err)
+	}
+	if c.auditBroker.IsRegistered("foo/") {
+		t.Fatalf("audit backend should not be registered")
+	}
+
+	// Requests are filtered by the mount they are routed to
+	me.Options["filter"] = `mount_type == "kv" and mount_path == "secret/"`
+	if err := c.enableAudit(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	values := auditFilterValues(c.router, &logical.Request{Path: "secret/foo"}, 0)
+	if values["mount_type"] != "kv" || values["mount_path"] != "secret/" {
+		t.Fatalf("bad: %#v", values)
+	}
+}
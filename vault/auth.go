@@ -1,12 +1,14 @@
 package vault
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -94,7 +96,7 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 		entry.Accessor = accessor
 	}
 	viewPath := credentialBarrierPrefix + entry.UUID + "/"
-	view := NewBarrierView(c.barrier, viewPath)
+	view := c.mountEntryBarrierView(entry, viewPath)
 	sysView := c.mountEntrySysView(entry)
 	conf := make(map[string]string)
 	if entry.Config.PluginName != "" {
@@ -255,12 +257,12 @@ func (c *Core) loadCredentials() error {
 	localAuthTable := &MountTable{}
 
 	// Load the existing mount table
-	raw, err := c.barrier.Get(coreAuthConfigPath)
+	raw, err := c.barrier.Get(context.Background(), coreAuthConfigPath)
 	if err != nil {
 		c.logger.Error("core: failed to read auth table", "error", err)
 		return errLoadAuthFailed
 	}
-	rawLocal, err := c.barrier.Get(coreLocalAuthConfigPath)
+	rawLocal, err := c.barrier.Get(context.Background(), coreLocalAuthConfigPath)
 	if err != nil {
 		c.logger.Error("core: failed to read local auth table", "error", err)
 		return errLoadAuthFailed
@@ -326,6 +328,16 @@ func (c *Core) loadCredentials() error {
 
 // persistAuth is used to persist the auth table after modification
 func (c *Core) persistAuth(table *MountTable, localOnly bool) error {
+	// Performance standbys leave any changes to the active node
+	if c.perfStandby {
+		return logical.ErrReadOnly
+	}
+
+	// Secondaries receive the shared table from their primary
+	if c.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		localOnly = true
+	}
+
 	if table.Type != credentialTableType {
 		c.logger.Error("core: given table to persist has wrong type", "actual_type", table.Type, "expected_type", credentialTableType)
 		return fmt.Errorf("invalid table type given, not persisting")
@@ -369,7 +381,7 @@ func (c *Core) persistAuth(table *MountTable, localOnly bool) error {
 		}
 
 		// Write to the physical backend
-		if err := c.barrier.Put(entry); err != nil {
+		if err := c.barrier.Put(context.Background(), entry); err != nil {
 			c.logger.Error("core: failed to persist auth table", "error", err)
 			return err
 		}
@@ -387,7 +399,7 @@ func (c *Core) persistAuth(table *MountTable, localOnly bool) error {
 		Value: compressedBytes,
 	}
 
-	if err := c.barrier.Put(entry); err != nil {
+	if err := c.barrier.Put(context.Background(), entry); err != nil {
 		c.logger.Error("core: failed to persist local auth table", "error", err)
 		return err
 	}
@@ -415,7 +427,7 @@ func (c *Core) setupCredentials() error {
 
 		// Create a barrier view using the UUID
 		viewPath := credentialBarrierPrefix + entry.UUID + "/"
-		view = NewBarrierView(c.barrier, viewPath)
+		view = c.mountEntryBarrierView(entry, viewPath)
 		sysView := c.mountEntrySysView(entry)
 		conf := make(map[string]string)
 		if entry.Config.PluginName != "" {
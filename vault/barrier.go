@@ -1,10 +1,12 @@
 package vault
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 var (
@@ -127,6 +129,14 @@ type SecurityBarrier interface {
 	// For replication we must send over the keyring, so this must be available
 	Keyring() (*Keyring, error)
 
+	// Snapshot calls the given function with the underlying physical backend
+	// while blocking writes through the barrier
+	Snapshot(func(physical.Backend) error) error
+
+	// VerifyKeyring checks that an encrypted keyring read from the physical
+	// backend can be decrypted with the current master key
+	VerifyKeyring([]byte) error
+
 	// SecurityBarrier must provide the storage APIs
 	BarrierStorage
 
@@ -135,19 +145,26 @@ type SecurityBarrier interface {
 }
 
 // BarrierStorage is the storage only interface required for a Barrier.
+// The context is passed down to the physical backend so that slow storage
+// calls can be cancelled.
 type BarrierStorage interface {
 	// Put is used to insert or update an entry
-	Put(entry *Entry) error
+	Put(ctx context.Context, entry *Entry) error
 
 	// Get is used to fetch an entry
-	Get(key string) (*Entry, error)
+	Get(ctx context.Context, key string) (*Entry, error)
 
 	// Delete is used to permanently delete an entry
-	Delete(key string) error
+	Delete(ctx context.Context, key string) error
 
 	// List is used ot list all the keys under a given
 	// prefix, up to the next prefix.
-	List(prefix string) ([]string, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// ListPage is used to list at most limit of the sorted keys under
+	// a given prefix that come after the given key. A limit of zero or
+	// less returns all of the remaining keys.
+	ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error)
 }
 
 // BarrierEncryptor is the in memory only interface that does not actually
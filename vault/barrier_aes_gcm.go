@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -48,6 +49,10 @@ type AESGCMBarrier struct {
 	l      sync.RWMutex
 	sealed bool
 
+	// writeLock is held for reading by writes through the barrier and for
+	// writing by snapshots, so that a snapshot only holds up writes
+	writeLock sync.RWMutex
+
 	// keyring is used to maintain all of the encryption keys, including
 	// the active key used for encryption, but also prior keys to allow
 	// decryption of keys encrypted under previous terms.
@@ -79,7 +84,7 @@ func NewAESGCMBarrier(physical physical.Backend) (*AESGCMBarrier, error) {
 // and has a master key set.
 func (b *AESGCMBarrier) Initialized() (bool, error) {
 	// Read the keyring file
-	out, err := b.backend.Get(keyringPath)
+	out, err := b.backend.Get(context.Background(), keyringPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to check for initialization: %v", err)
 	}
@@ -88,7 +93,7 @@ func (b *AESGCMBarrier) Initialized() (bool, error) {
 	}
 
 	// Fallback, check for the old sentinel file
-	out, err = b.backend.Get(barrierInitPath)
+	out, err = b.backend.Get(context.Background(), barrierInitPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to check for initialization: %v", err)
 	}
@@ -155,7 +160,7 @@ func (b *AESGCMBarrier) persistKeyring(keyring *Keyring) error {
 		Key:   keyringPath,
 		Value: value,
 	}
-	if err := b.backend.Put(pe); err != nil {
+	if err := b.backend.Put(context.Background(), pe); err != nil {
 		return fmt.Errorf("failed to persist keyring: %v", err)
 	}
 
@@ -184,7 +189,7 @@ func (b *AESGCMBarrier) persistKeyring(keyring *Keyring) error {
 		Key:   masterKeyPath,
 		Value: value,
 	}
-	if err := b.backend.Put(pe); err != nil {
+	if err := b.backend.Put(context.Background(), pe); err != nil {
 		return fmt.Errorf("failed to persist master key: %v", err)
 	}
 	return nil
@@ -238,7 +243,7 @@ func (b *AESGCMBarrier) ReloadKeyring() error {
 	}
 
 	// Read in the keyring
-	out, err := b.backend.Get(keyringPath)
+	out, err := b.backend.Get(context.Background(), keyringPath)
 	if err != nil {
 		return fmt.Errorf("failed to check for keyring: %v", err)
 	}
@@ -275,7 +280,7 @@ func (b *AESGCMBarrier) ReloadKeyring() error {
 // is available for keyring reloading.
 func (b *AESGCMBarrier) ReloadMasterKey() error {
 	// Read the masterKeyPath upgrade
-	out, err := b.Get(masterKeyPath)
+	out, err := b.Get(context.Background(), masterKeyPath)
 	if err != nil {
 		return fmt.Errorf("failed to read master key path: %v", err)
 	}
@@ -328,7 +333,7 @@ func (b *AESGCMBarrier) Unseal(key []byte) error {
 	}
 
 	// Read in the keyring
-	out, err := b.backend.Get(keyringPath)
+	out, err := b.backend.Get(context.Background(), keyringPath)
 	if err != nil {
 		return fmt.Errorf("failed to check for keyring: %v", err)
 	}
@@ -356,7 +361,7 @@ func (b *AESGCMBarrier) Unseal(key []byte) error {
 	}
 
 	// Read the barrier initialization key
-	out, err = b.backend.Get(barrierInitPath)
+	out, err = b.backend.Get(context.Background(), barrierInitPath)
 	if err != nil {
 		return fmt.Errorf("failed to check for initialization: %v", err)
 	}
@@ -400,7 +405,7 @@ func (b *AESGCMBarrier) Unseal(key []byte) error {
 	}
 
 	// Delete the old barrier entry
-	if err := b.backend.Delete(barrierInitPath); err != nil {
+	if err := b.backend.Delete(context.Background(), barrierInitPath); err != nil {
 		return fmt.Errorf("failed to delete barrier init file: %v", err)
 	}
 
@@ -465,6 +470,8 @@ func (b *AESGCMBarrier) Rotate() (uint32, error) {
 
 // CreateUpgrade creates an upgrade path key to the given term from the previous term
 func (b *AESGCMBarrier) CreateUpgrade(term uint32) error {
+	b.writeLock.RLock()
+	defer b.writeLock.RUnlock()
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
@@ -493,13 +500,13 @@ func (b *AESGCMBarrier) CreateUpgrade(term uint32) error {
 		Key:   key,
 		Value: value,
 	}
-	return b.backend.Put(pe)
+	return b.backend.Put(context.Background(), pe)
 }
 
 // DestroyUpgrade destroys the upgrade path key to the given term
 func (b *AESGCMBarrier) DestroyUpgrade(term uint32) error {
 	path := fmt.Sprintf("%s%d", keyringUpgradePrefix, term-1)
-	return b.Delete(path)
+	return b.Delete(context.Background(), path)
 }
 
 // CheckUpgrade looks for an upgrade to the current term and installs it
@@ -515,7 +522,7 @@ func (b *AESGCMBarrier) CheckUpgrade() (bool, uint32, error) {
 
 	// Check for an upgrade key
 	upgrade := fmt.Sprintf("%s%d", keyringUpgradePrefix, activeTerm)
-	entry, err := b.Get(upgrade)
+	entry, err := b.Get(context.Background(), upgrade)
 	if err != nil {
 		return false, 0, err
 	}
@@ -627,8 +634,10 @@ func (b *AESGCMBarrier) updateMasterKeyCommon(key []byte) (*Keyring, error) {
 }
 
 // Put is used to insert or update an entry
-func (b *AESGCMBarrier) Put(entry *Entry) error {
+func (b *AESGCMBarrier) Put(ctx context.Context, entry *Entry) error {
 	defer metrics.MeasureSince([]string{"barrier", "put"}, time.Now())
+	b.writeLock.RLock()
+	defer b.writeLock.RUnlock()
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
@@ -645,11 +654,11 @@ func (b *AESGCMBarrier) Put(entry *Entry) error {
 		Key:   entry.Key,
 		Value: b.encrypt(entry.Key, term, primary, entry.Value),
 	}
-	return b.backend.Put(pe)
+	return b.backend.Put(ctx, pe)
 }
 
 // Get is used to fetch an entry
-func (b *AESGCMBarrier) Get(key string) (*Entry, error) {
+func (b *AESGCMBarrier) Get(ctx context.Context, key string) (*Entry, error) {
 	defer metrics.MeasureSince([]string{"barrier", "get"}, time.Now())
 	b.l.RLock()
 	defer b.l.RUnlock()
@@ -658,7 +667,7 @@ func (b *AESGCMBarrier) Get(key string) (*Entry, error) {
 	}
 
 	// Read the key from the backend
-	pe, err := b.backend.Get(key)
+	pe, err := b.backend.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	} else if pe == nil {
@@ -680,20 +689,22 @@ func (b *AESGCMBarrier) Get(key string) (*Entry, error) {
 }
 
 // Delete is used to permanently delete an entry
-func (b *AESGCMBarrier) Delete(key string) error {
+func (b *AESGCMBarrier) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"barrier", "delete"}, time.Now())
+	b.writeLock.RLock()
+	defer b.writeLock.RUnlock()
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
 		return ErrBarrierSealed
 	}
 
-	return b.backend.Delete(key)
+	return b.backend.Delete(ctx, key)
 }
 
 // List is used ot list all the keys under a given
 // prefix, up to the next prefix.
-func (b *AESGCMBarrier) List(prefix string) ([]string, error) {
+func (b *AESGCMBarrier) List(ctx context.Context, prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"barrier", "list"}, time.Now())
 	b.l.RLock()
 	defer b.l.RUnlock()
@@ -701,7 +712,20 @@ func (b *AESGCMBarrier) List(prefix string) ([]string, error) {
 		return nil, ErrBarrierSealed
 	}
 
-	return b.backend.List(prefix)
+	return b.backend.List(ctx, prefix)
+}
+
+// ListPage is used to list at most limit of the sorted keys under a
+// given prefix that come after the given key.
+func (b *AESGCMBarrier) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	defer metrics.MeasureSince([]string{"barrier", "list-page"}, time.Now())
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return nil, ErrBarrierSealed
+	}
+
+	return physical.ListPage(ctx, b.backend, prefix, after, limit)
 }
 
 // aeadForTerm returns the AES-GCM AEAD for the given term
@@ -884,3 +908,50 @@ func (b *AESGCMBarrier) Keyring() (*Keyring, error) {
 
 	return b.keyring.Clone(), nil
 }
+
+// Snapshot calls the given function with the underlying physical backend
+// while no writes go through the barrier, so that the function sees a
+// consistent view of the encrypted storage. Reads through the barrier carry
+// on in the meantime.
+func (b *AESGCMBarrier) Snapshot(f func(physical.Backend) error) error {
+	defer metrics.MeasureSince([]string{"barrier", "snapshot"}, time.Now())
+	b.writeLock.Lock()
+	defer b.writeLock.Unlock()
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	return f(b.backend)
+}
+
+// VerifyKeyring checks that the given encrypted keyring, as stored in the
+// physical backend, can be decrypted with the current master key
+func (b *AESGCMBarrier) VerifyKeyring(ciphertext []byte) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	gcm, err := b.aeadFromKey(b.keyring.MasterKey())
+	if err != nil {
+		return err
+	}
+	if len(ciphertext) < 5+gcm.NonceSize() {
+		return fmt.Errorf("invalid keyring")
+	}
+	plain, err := b.decrypt(keyringPath, gcm, ciphertext)
+	defer memzero(plain)
+	if err != nil {
+		if strings.Contains(err.Error(), "message authentication failed") {
+			return ErrBarrierInvalidKey
+		}
+		return err
+	}
+	if _, err := DeserializeKeyring(plain); err != nil {
+		return fmt.Errorf("keyring deserialization failed: %v", err)
+	}
+	return nil
+}
@@ -2,8 +2,10 @@ package vault
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/physical"
@@ -131,7 +133,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 		Key:   barrierInitPath,
 		Value: value,
 	}
-	inm.Put(pe)
+	inm.Put(context.Background(), pe)
 
 	// Create a fake key
 	gcm, _ = b.aeadFromKey(encrypt)
@@ -139,7 +141,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 		Key:   "test/foo",
 		Value: b.encrypt("test/foo", initialKeyTerm, gcm, []byte("test")),
 	}
-	inm.Put(pe)
+	inm.Put(context.Background(), pe)
 
 	// Should still be initialized
 	isInit, err := b.Initialized()
@@ -157,7 +159,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 	}
 
 	// Check for migraiton
-	out, err := inm.Get(barrierInitPath)
+	out, err := inm.Get(context.Background(), barrierInitPath)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -166,7 +168,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 	}
 
 	// Should have keyring
-	out, err = inm.Get(keyringPath)
+	out, err = inm.Get(context.Background(), keyringPath)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -175,7 +177,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 	}
 
 	// Attempt to read encrypted key
-	entry, err := b.Get("test/foo")
+	entry, err := b.Get(context.Background(), "test/foo")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -202,13 +204,13 @@ func TestAESGCMBarrier_Confidential(t *testing.T) {
 
 	// Put a logical entry
 	entry := &Entry{Key: "test", Value: []byte("test")}
-	err = b.Put(entry)
+	err = b.Put(context.Background(), entry)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Check the physcial entry
-	pe, err := inm.Get("test")
+	pe, err := inm.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -242,21 +244,21 @@ func TestAESGCMBarrier_Integrity(t *testing.T) {
 
 	// Put a logical entry
 	entry := &Entry{Key: "test", Value: []byte("test")}
-	err = b.Put(entry)
+	err = b.Put(context.Background(), entry)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Change a byte in the underlying physical entry
-	pe, _ := inm.Get("test")
+	pe, _ := inm.Get(context.Background(), "test")
 	pe.Value[15]++
-	err = inm.Put(pe)
+	err = inm.Put(context.Background(), pe)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Read from the barrier
-	_, err = b.Get("test")
+	_, err = b.Get(context.Background(), "test")
 	if err == nil {
 		t.Fatalf("should fail!")
 	}
@@ -287,21 +289,21 @@ func TestAESGCMBarrier_MoveIntegrityV1(t *testing.T) {
 
 	// Put a logical entry
 	entry := &Entry{Key: "test", Value: []byte("test")}
-	err = b.Put(entry)
+	err = b.Put(context.Background(), entry)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Change the location of the underlying physical entry
-	pe, _ := inm.Get("test")
+	pe, _ := inm.Get(context.Background(), "test")
 	pe.Key = "moved"
-	err = inm.Put(pe)
+	err = inm.Put(context.Background(), pe)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Read from the barrier
-	_, err = b.Get("moved")
+	_, err = b.Get(context.Background(), "moved")
 	if err != nil {
 		t.Fatalf("should succeed with version 1!")
 	}
@@ -331,21 +333,21 @@ func TestAESGCMBarrier_MoveIntegrityV2(t *testing.T) {
 
 	// Put a logical entry
 	entry := &Entry{Key: "test", Value: []byte("test")}
-	err = b.Put(entry)
+	err = b.Put(context.Background(), entry)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Change the location of the underlying physical entry
-	pe, _ := inm.Get("test")
+	pe, _ := inm.Get(context.Background(), "test")
 	pe.Key = "moved"
-	err = inm.Put(pe)
+	err = inm.Put(context.Background(), pe)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Read from the barrier
-	_, err = b.Get("moved")
+	_, err = b.Get(context.Background(), "moved")
 	if err == nil {
 		t.Fatalf("should fail with version 2!")
 	}
@@ -375,7 +377,7 @@ func TestAESGCMBarrier_UpgradeV1toV2(t *testing.T) {
 
 	// Put a logical entry
 	entry := &Entry{Key: "test", Value: []byte("test")}
-	err = b.Put(entry)
+	err = b.Put(context.Background(), entry)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -400,7 +402,7 @@ func TestAESGCMBarrier_UpgradeV1toV2(t *testing.T) {
 	}
 
 	// Check successful decryption
-	_, err = b.Get("test")
+	_, err = b.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("Upgrade unsuccessful")
 	}
@@ -501,3 +503,39 @@ func TestEncrypt_BarrierEncryptor(t *testing.T) {
 		t.Fatalf("bad: %s", plain)
 	}
 }
+
+func TestAESGCMBarrier_Snapshot(t *testing.T) {
+	_, b, _ := mockBarrier(t)
+	if err := b.Put(context.Background(), &Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	putDone := make(chan error, 1)
+	err := b.Snapshot(func(backend physical.Backend) error {
+		// Reads go through while the snapshot is taken
+		entry, err := b.Get(context.Background(), "foo")
+		if err != nil {
+			return err
+		}
+		if entry == nil || string(entry.Value) != "bar" {
+			t.Fatalf("bad: %#v", entry)
+		}
+
+		// Writes wait for it to be done
+		go func() {
+			putDone <- b.Put(context.Background(), &Entry{Key: "foo", Value: []byte("baz")})
+		}()
+		select {
+		case err := <-putDone:
+			t.Fatalf("write went through during the snapshot: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-putDone; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
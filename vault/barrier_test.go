@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"reflect"
 	"testing"
 	"time"
@@ -32,16 +33,16 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 
 	// All operations should fail
 	e := &Entry{Key: "test", Value: []byte("test")}
-	if err := b.Put(e); err != ErrBarrierSealed {
+	if err := b.Put(context.Background(), e); err != ErrBarrierSealed {
 		t.Fatalf("err: %v", err)
 	}
-	if _, err := b.Get("test"); err != ErrBarrierSealed {
+	if _, err := b.Get(context.Background(), "test"); err != ErrBarrierSealed {
 		t.Fatalf("err: %v", err)
 	}
-	if err := b.Delete("test"); err != ErrBarrierSealed {
+	if err := b.Delete(context.Background(), "test"); err != ErrBarrierSealed {
 		t.Fatalf("err: %v", err)
 	}
-	if _, err := b.List(""); err != ErrBarrierSealed {
+	if _, err := b.List(context.Background(), ""); err != ErrBarrierSealed {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -118,7 +119,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Operations should work
-	out, err := b.Get("test")
+	out, err := b.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -127,7 +128,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// List should have only "core/"
-	keys, err := b.List("")
+	keys, err := b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -136,12 +137,12 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Try to write
-	if err := b.Put(e); err != nil {
+	if err := b.Put(context.Background(), e); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Should be equal
-	out, err = b.Get("test")
+	out, err = b.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -150,7 +151,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// List should show the items
-	keys, err = b.List("")
+	keys, err = b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -162,19 +163,19 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Delete should clear
-	err = b.Delete("test")
+	err = b.Delete(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Double Delete is fine
-	err = b.Delete("test")
+	err = b.Delete(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Should be nil
-	out, err = b.Get("test")
+	out, err = b.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -183,7 +184,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// List should have nothing
-	keys, err = b.List("")
+	keys, err = b.List(context.Background(), "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -192,7 +193,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Add the item back
-	if err := b.Put(e); err != nil {
+	if err := b.Put(context.Background(), e); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -202,7 +203,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// No access allowed
-	if _, err := b.Get("test"); err != ErrBarrierSealed {
+	if _, err := b.Get(context.Background(), "test"); err != ErrBarrierSealed {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -212,7 +213,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Should be equal
-	out, err = b.Get("test")
+	out, err = b.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -221,7 +222,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Final cleanup
-	err = b.Delete("test")
+	err = b.Delete(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -264,7 +265,7 @@ func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 
 	// Write a key
 	e1 := &Entry{Key: "test", Value: []byte("test")}
-	if err := b.Put(e1); err != nil {
+	if err := b.Put(context.Background(), e1); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -291,12 +292,12 @@ func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 
 	// Write another key
 	e2 := &Entry{Key: "foo", Value: []byte("test")}
-	if err := b.Put(e2); err != nil {
+	if err := b.Put(context.Background(), e2); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Reading both should work
-	out, err := b.Get(e1.Key)
+	out, err := b.Get(context.Background(), e1.Key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -304,7 +305,7 @@ func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 		t.Fatalf("bad: %v", out)
 	}
 
-	out, err = b.Get(e2.Key)
+	out, err = b.Get(context.Background(), e2.Key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -323,7 +324,7 @@ func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Reading both should work
-	out, err = b.Get(e1.Key)
+	out, err = b.Get(context.Background(), e1.Key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -331,7 +332,7 @@ func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 		t.Fatalf("bad: %v", out)
 	}
 
-	out, err = b.Get(e2.Key)
+	out, err = b.Get(context.Background(), e2.Key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -357,7 +358,7 @@ func testBarrier_Rekey(t *testing.T, b SecurityBarrier) {
 
 	// Write a key
 	e1 := &Entry{Key: "test", Value: []byte("test")}
-	if err := b.Put(e1); err != nil {
+	if err := b.Put(context.Background(), e1); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -384,7 +385,7 @@ func testBarrier_Rekey(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Reading should work
-	out, err := b.Get(e1.Key)
+	out, err := b.Get(context.Background(), e1.Key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -411,7 +412,7 @@ func testBarrier_Rekey(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Reading should work
-	out, err = b.Get(e1.Key)
+	out, err = b.Get(context.Background(), e1.Key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -14,10 +15,15 @@ import (
 //
 // BarrierView implements logical.Storage so it can be passed in as the
 // durable storage mechanism for logical views.
+//
+// Since logical.Storage carries no context, a view is bound to the context
+// of the request it serves with WithContext, and that context is passed to
+// the barrier on every call.
 type BarrierView struct {
 	barrier  BarrierStorage
 	prefix   string
 	readonly bool
+	ctx      context.Context
 }
 
 var (
@@ -33,6 +39,22 @@ func NewBarrierView(barrier BarrierStorage, prefix string) *BarrierView {
 	}
 }
 
+// WithContext returns a copy of the view whose storage calls are made
+// with the given context
+func (v *BarrierView) WithContext(ctx context.Context) *BarrierView {
+	view := *v
+	view.ctx = ctx
+	return &view
+}
+
+// Context returns the context storage calls are made with
+func (v *BarrierView) Context() context.Context {
+	if v.ctx == nil {
+		return context.Background()
+	}
+	return v.ctx
+}
+
 // sanityCheck is used to perform a sanity check on a key
 func (v *BarrierView) sanityCheck(key string) error {
 	if strings.Contains(key, "..") {
@@ -46,7 +68,15 @@ func (v *BarrierView) List(prefix string) ([]string, error) {
 	if err := v.sanityCheck(prefix); err != nil {
 		return nil, err
 	}
-	return v.barrier.List(v.expandKey(prefix))
+	return v.barrier.List(v.Context(), v.expandKey(prefix))
+}
+
+// logical.PaginatedStorage impl.
+func (v *BarrierView) ListPage(prefix, after string, limit int) ([]string, error) {
+	if err := v.sanityCheck(prefix); err != nil {
+		return nil, err
+	}
+	return v.barrier.ListPage(v.Context(), v.expandKey(prefix), after, limit)
 }
 
 // logical.Storage impl.
@@ -54,7 +84,7 @@ func (v *BarrierView) Get(key string) (*logical.StorageEntry, error) {
 	if err := v.sanityCheck(key); err != nil {
 		return nil, err
 	}
-	entry, err := v.barrier.Get(v.expandKey(key))
+	entry, err := v.barrier.Get(v.Context(), v.expandKey(key))
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +117,7 @@ func (v *BarrierView) Put(entry *logical.StorageEntry) error {
 		Key:   expandedKey,
 		Value: entry.Value,
 	}
-	return v.barrier.Put(nested)
+	return v.barrier.Put(v.Context(), nested)
 }
 
 // logical.Storage impl.
@@ -102,13 +132,13 @@ func (v *BarrierView) Delete(key string) error {
 		return logical.ErrReadOnly
 	}
 
-	return v.barrier.Delete(expandedKey)
+	return v.barrier.Delete(v.Context(), expandedKey)
 }
 
 // SubView constructs a nested sub-view using the given prefix
 func (v *BarrierView) SubView(prefix string) *BarrierView {
 	sub := v.expandKey(prefix)
-	return &BarrierView{barrier: v.barrier, prefix: sub, readonly: v.readonly}
+	return &BarrierView{barrier: v.barrier, prefix: sub, readonly: v.readonly, ctx: v.ctx}
 }
 
 // expandKey is used to expand to the full key path with the prefix
@@ -1,6 +1,8 @@
 package vault
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -10,6 +12,7 @@ import (
 
 func TestBarrierView_impl(t *testing.T) {
 	var _ logical.Storage = new(BarrierView)
+	var _ logical.PaginatedStorage = new(BarrierView)
 }
 
 func TestBarrierView_spec(t *testing.T) {
@@ -53,7 +56,7 @@ func TestBarrierView(t *testing.T) {
 
 	// Write a key outside of foo/
 	entry := &Entry{Key: "test", Value: []byte("test")}
-	if err := barrier.Put(entry); err != nil {
+	if err := barrier.Put(context.Background(), entry); err != nil {
 		t.Fatalf("bad: %v", err)
 	}
 
@@ -81,7 +84,7 @@ func TestBarrierView(t *testing.T) {
 	}
 
 	// Check it is nested
-	entry, err = barrier.Get("foo/test")
+	entry, err = barrier.Get(context.Background(), "foo/test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -95,7 +98,7 @@ func TestBarrierView(t *testing.T) {
 	}
 
 	// Check the nested key
-	entry, err = barrier.Get("foo/test")
+	entry, err = barrier.Get(context.Background(), "foo/test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -104,7 +107,7 @@ func TestBarrierView(t *testing.T) {
 	}
 
 	// Check the non-nested key
-	entry, err = barrier.Get("test")
+	entry, err = barrier.Get(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -143,7 +146,7 @@ func TestBarrierView_SubView(t *testing.T) {
 	}
 
 	// Check it is nested
-	bout, err := barrier.Get("foo/bar/test")
+	bout, err := barrier.Get(context.Background(), "foo/bar/test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -166,7 +169,7 @@ func TestBarrierView_SubView(t *testing.T) {
 	}
 
 	// Check the nested key
-	bout, err = barrier.Get("foo/bar/test")
+	bout, err = barrier.Get(context.Background(), "foo/bar/test")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -314,3 +317,103 @@ func TestBarrierView_Readonly(t *testing.T) {
 		t.Fatalf("key test missing")
 	}
 }
+
+func TestBarrierView_ListPage(t *testing.T) {
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "view/")
+
+	for _, key := range []string{"foo/c", "foo/a", "foo/d/e", "foo/b", "bar"} {
+		if err := view.Put(&logical.StorageEntry{Key: key}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	keys, err := view.ListPage("foo/", "", 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	keys, err = view.SubView("foo/").ListPage("", "b", 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"c", "d/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	if _, err := view.ListPage("../", "", 0); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestBarrierView_ScanPages(t *testing.T) {
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "view/")
+
+	// Enough keys for the scan to list more than one page
+	var expect []string
+	for i := 0; i < 2500; i++ {
+		key := fmt.Sprintf("foo/%04d", i)
+		if i%10 == 0 {
+			key += "/bar"
+		}
+		expect = append(expect, key)
+		if err := view.Put(&logical.StorageEntry{Key: key}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	out, err := logical.CollectKeys(view)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	sort.Strings(out)
+	if !reflect.DeepEqual(out, expect) {
+		t.Fatalf("bad: got %d keys, expected %d", len(out), len(expect))
+	}
+}
+
+func TestBarrierView_WithContext(t *testing.T) {
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "view/")
+
+	entry := &logical.StorageEntry{Key: "test", Value: []byte("test")}
+	if err := view.Put(entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := view.WithContext(ctx)
+	if bound.Context() != ctx || bound.SubView("foo/").Context() != ctx {
+		t.Fatalf("context not bound to the view")
+	}
+	if view.Context() != context.Background() {
+		t.Fatalf("original view should not be bound")
+	}
+
+	if out, err := bound.Get("test"); err != nil || out == nil {
+		t.Fatalf("bad: %v %v", out, err)
+	}
+
+	// Storage calls stop once the context is cancelled
+	cancel()
+	if _, err := bound.Get("test"); err != context.Canceled {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+	if err := bound.Put(entry); err != context.Canceled {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+	if _, err := bound.List(""); err != context.Canceled {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+	if _, err := bound.ListPage("", "", 0); err != context.Canceled {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+	if _, err := view.Get("test"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
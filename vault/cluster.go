@@ -2,6 +2,7 @@ package vault
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -60,7 +61,7 @@ func (c *Core) Cluster() (*Cluster, error) {
 	var cluster Cluster
 
 	// Fetch the storage entry. This call fails when Vault is sealed.
-	entry, err := c.barrier.Get(coreLocalClusterInfoPath)
+	entry, err := c.barrier.Get(context.Background(), coreLocalClusterInfoPath)
 	if err != nil {
 		return nil, err
 	}
@@ -269,7 +270,7 @@ func (c *Core) setupCluster() error {
 		}
 
 		// Store it
-		err = c.barrier.Put(&Entry{
+		err = c.barrier.Put(context.Background(), &Entry{
 			Key:   coreLocalClusterInfoPath,
 			Value: rawCluster,
 		})
@@ -399,6 +400,10 @@ func (c *Core) ClusterTLSConfig() (*tls.Config, error) {
 		for _, v := range clientHello.SupportedProtos {
 			switch v {
 			case "h2", requestForwardingALPN:
+			case replicationALPN:
+				// Secondaries authenticate with certificates issued by the
+				// replication CA rather than the cluster certificate
+				return c.replicationServerTLSConfig()
 			default:
 				return nil, fmt.Errorf("unknown ALPN proto %s", v)
 			}
@@ -0,0 +1,597 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/helper/wrapping"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// controlGroupSubPath is the sub-path used for the held control group
+	// requests. This is nested under the system view.
+	controlGroupSubPath = "control-group/"
+
+	// controlGroupDefaultTTL is how long a request is held waiting for
+	// authorization when the policy does not specify a TTL
+	controlGroupDefaultTTL = 24 * time.Hour
+
+	// controlGroupTidyPageSize is the number of held requests listed at a
+	// time when removing the expired ones
+	controlGroupTidyPageSize = 1000
+)
+
+var (
+	// controlGroupExemptPaths are never held by a control group, as they are
+	// needed to authorize and retrieve held requests
+	controlGroupExemptPaths = []string{
+		"sys/wrapping/",
+		"sys/control-group/",
+	}
+
+	errControlGroupPending = errors.New("request needs further approval")
+
+	// controlGroupTidyInterval is how often the expired held requests are
+	// removed. It's var not const so that tests can manipulate it.
+	controlGroupTidyInterval = time.Hour
+)
+
+// ControlGroup requires a number of authorizations from members of identity
+// groups before a request to a path is processed.
+type ControlGroup struct {
+	TTL     time.Duration
+	Factors []*ControlGroupFactor
+}
+
+// ControlGroupFactor is a single set of authorizers. All factors of a control
+// group must be satisfied for a request to be authorized.
+type ControlGroupFactor struct {
+	Name       string   `json:"name"`
+	GroupIDs   []string `json:"group_ids"`
+	GroupNames []string `json:"group_names"`
+	Approvals  int      `json:"approvals"`
+}
+
+// Clone returns a deep copy of the control group
+func (cg *ControlGroup) Clone() *ControlGroup {
+	ret := &ControlGroup{
+		TTL:     cg.TTL,
+		Factors: make([]*ControlGroupFactor, 0, len(cg.Factors)),
+	}
+	for _, factor := range cg.Factors {
+		ret.Factors = append(ret.Factors, &ControlGroupFactor{
+			Name:       factor.Name,
+			GroupIDs:   append([]string(nil), factor.GroupIDs...),
+			GroupNames: append([]string(nil), factor.GroupNames...),
+			Approvals:  factor.Approvals,
+		})
+	}
+	return ret
+}
+
+// merge combines another control group into this one. Every factor of both
+// groups must be satisfied, and the shorter of the TTLs wins. Factors with
+// the same name are merged into one that requires the larger number of
+// approvals from the members of the groups of either.
+func (cg *ControlGroup) merge(other *ControlGroup) {
+	if other.TTL < cg.TTL {
+		cg.TTL = other.TTL
+	}
+
+OUTER:
+	for _, factor := range other.Clone().Factors {
+		for _, existing := range cg.Factors {
+			if existing.Name != factor.Name {
+				continue
+			}
+			if factor.Approvals > existing.Approvals {
+				existing.Approvals = factor.Approvals
+			}
+			for _, id := range factor.GroupIDs {
+				if !strutil.StrListContains(existing.GroupIDs, id) {
+					existing.GroupIDs = append(existing.GroupIDs, id)
+				}
+			}
+			for _, name := range factor.GroupNames {
+				if !strutil.StrListContains(existing.GroupNames, name) {
+					existing.GroupNames = append(existing.GroupNames, name)
+				}
+			}
+			continue OUTER
+		}
+		cg.Factors = append(cg.Factors, factor)
+	}
+}
+
+func parseControlGroup(cgHCL *ControlGroupHCL) (*ControlGroup, error) {
+	cg := &ControlGroup{
+		TTL: controlGroupDefaultTTL,
+	}
+
+	if cgHCL.TTL != nil {
+		dur, err := parseutil.ParseDurationSecond(cgHCL.TTL)
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing control group ttl: {{err}}", err)
+		}
+		if dur > 0 {
+			cg.TTL = dur
+		}
+	}
+
+	if len(cgHCL.Factors) == 0 {
+		return nil, errors.New("control group must contain at least one factor")
+	}
+
+	// Sort the factor names so that the parsed control group is stable
+	names := make([]string, 0, len(cgHCL.Factors))
+	for name := range cgHCL.Factors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		factorHCL := cgHCL.Factors[name]
+		if factorHCL == nil || factorHCL.Identity == nil {
+			return nil, fmt.Errorf("control group factor %q: missing identity", name)
+		}
+		identity := factorHCL.Identity
+		if len(identity.GroupIDs) == 0 && len(identity.GroupNames) == 0 {
+			return nil, fmt.Errorf("control group factor %q: one of group_ids or group_names must be set", name)
+		}
+		factor := &ControlGroupFactor{
+			Name:       name,
+			GroupIDs:   identity.GroupIDs,
+			GroupNames: identity.GroupNames,
+			Approvals:  identity.Approvals,
+		}
+		if factor.Approvals <= 0 {
+			factor.Approvals = 1
+		}
+		cg.Factors = append(cg.Factors, factor)
+	}
+
+	return cg, nil
+}
+
+// controlGroupAuthorization records the approval of a held request by an
+// entity, along with the factors the approval counted towards.
+type controlGroupAuthorization struct {
+	EntityID string    `json:"entity_id"`
+	Factors  []string  `json:"factors"`
+	Time     time.Time `json:"time"`
+}
+
+// controlGroupRequest is a request held until its control group has been
+// satisfied. It is keyed by the accessor of the wrapping token returned to
+// the requester. Batch tokens have no accessor, so requests made with them
+// record the salted ID of the token instead.
+type controlGroupRequest struct {
+	Accessor           string                       `json:"accessor"`
+	Path               string                       `json:"path"`
+	Operation          logical.Operation            `json:"operation"`
+	Data               map[string]interface{}       `json:"data"`
+	RequesterAccessor  string                       `json:"requester_accessor"`
+	RequesterTokenHash string                       `json:"requester_token_hash"`
+	RequesterEntityID  string                       `json:"requester_entity_id"`
+	Factors            []*ControlGroupFactor        `json:"factors"`
+	Authorizations     []*controlGroupAuthorization `json:"authorizations"`
+	CreationTime       time.Time                    `json:"creation_time"`
+	TTL                time.Duration                `json:"ttl"`
+}
+
+// approved returns whether every factor has received enough authorizations
+func (r *controlGroupRequest) approved() bool {
+	for _, factor := range r.Factors {
+		var count int
+		for _, authz := range r.Authorizations {
+			if strutil.StrListContains(authz.Factors, factor.Name) {
+				count++
+			}
+		}
+		if count < factor.Approvals {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *controlGroupRequest) expired() bool {
+	return time.Now().After(r.CreationTime.Add(r.TTL))
+}
+
+// controlGroupExempt returns whether the path can never be held by a control
+// group
+func controlGroupExempt(path string) bool {
+	for _, prefix := range controlGroupExemptPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Core) controlGroupView() *BarrierView {
+	return c.systemBarrierView.SubView(controlGroupSubPath)
+}
+
+func (c *Core) controlGroupRequestByAccessor(accessor string) (*controlGroupRequest, error) {
+	saltedAccessor, err := c.tokenStore.SaltID(accessor)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := c.controlGroupView().Get(saltedAccessor)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read control group request: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var cgr controlGroupRequest
+	if err := entry.DecodeJSON(&cgr); err != nil {
+		return nil, errwrap.Wrapf("failed to decode control group request: {{err}}", err)
+	}
+
+	// The wrapping token has expired along with the request
+	if cgr.expired() {
+		if err := c.controlGroupView().Delete(saltedAccessor); err != nil {
+			return nil, errwrap.Wrapf("failed to delete expired control group request: {{err}}", err)
+		}
+		return nil, nil
+	}
+
+	return &cgr, nil
+}
+
+func (c *Core) storeControlGroupRequest(cgr *controlGroupRequest) error {
+	saltedAccessor, err := c.tokenStore.SaltID(cgr.Accessor)
+	if err != nil {
+		return err
+	}
+
+	entry, err := logical.StorageEntryJSON(saltedAccessor, cgr)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode control group request: {{err}}", err)
+	}
+	if err := c.controlGroupView().Put(entry); err != nil {
+		return errwrap.Wrapf("failed to persist control group request: {{err}}", err)
+	}
+	return nil
+}
+
+func (c *Core) deleteControlGroupRequest(accessor string) error {
+	saltedAccessor, err := c.tokenStore.SaltID(accessor)
+	if err != nil {
+		return err
+	}
+	return c.controlGroupView().Delete(saltedAccessor)
+}
+
+// startControlGroupTidy periodically removes the held requests that have
+// expired, which would otherwise only be removed when looked up
+func (c *Core) startControlGroupTidy() {
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	c.controlGroupTidyStopCh = stopCh
+	c.controlGroupTidyDoneCh = doneCh
+
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(controlGroupTidyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.tidyControlGroupRequests(stopCh); err != nil {
+					c.logger.Error("core: failed to tidy control group requests", "error", err)
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stopControlGroupTidy stops the removal of expired held requests and waits
+// for it to return
+func (c *Core) stopControlGroupTidy() {
+	if c.controlGroupTidyStopCh == nil {
+		return
+	}
+	close(c.controlGroupTidyStopCh)
+	<-c.controlGroupTidyDoneCh
+	c.controlGroupTidyStopCh = nil
+	c.controlGroupTidyDoneCh = nil
+}
+
+// tidyControlGroupRequests removes the held requests that have expired,
+// listing them a page at a time. It returns early once stopCh is closed.
+func (c *Core) tidyControlGroupRequests(stopCh <-chan struct{}) error {
+	view := c.controlGroupView()
+	var removed int
+	after := ""
+	for {
+		keys, err := view.ListPage("", after, controlGroupTidyPageSize)
+		if err != nil {
+			return errwrap.Wrapf("failed to list control group requests: {{err}}", err)
+		}
+		for _, key := range keys {
+			select {
+			case <-stopCh:
+				return nil
+			default:
+			}
+
+			ok, err := c.tidyControlGroupRequest(view, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				removed++
+			}
+		}
+		if len(keys) < controlGroupTidyPageSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+
+	if removed > 0 {
+		c.logger.Info("core: removed expired control group requests", "count", removed)
+	}
+	return nil
+}
+
+// tidyControlGroupRequest removes the held request stored under the key if
+// it has expired, and returns whether it did
+func (c *Core) tidyControlGroupRequest(view *BarrierView, key string) (bool, error) {
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+
+	entry, err := view.Get(key)
+	if err != nil {
+		return false, errwrap.Wrapf("failed to read control group request: {{err}}", err)
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	var cgr controlGroupRequest
+	if err := entry.DecodeJSON(&cgr); err != nil {
+		return false, errwrap.Wrapf("failed to decode control group request: {{err}}", err)
+	}
+	if !cgr.expired() {
+		return false, nil
+	}
+
+	if err := view.Delete(key); err != nil {
+		return false, errwrap.Wrapf("failed to delete expired control group request: {{err}}", err)
+	}
+	return true, nil
+}
+
+// holdForControlGroup stores the request instead of processing it and returns
+// a response wrapping token to the requester. Once the control group has been
+// satisfied, the requester processes the request by unwrapping the token.
+func (c *Core) holdForControlGroup(req *logical.Request, te *TokenEntry, cg *ControlGroup) (*logical.Response, error) {
+	var requesterTokenHash string
+	if te.IsBatch() {
+		var err error
+		requesterTokenHash, err = c.tokenStore.SaltID(te.ID)
+		if err != nil {
+			c.logger.Error("core: failed to salt requester token of control group request", "request_path", req.Path, "error", err)
+			return nil, ErrInternalError
+		}
+	}
+
+	resp := &logical.Response{
+		WrapInfo: &wrapping.ResponseWrapInfo{
+			TTL:          cg.TTL,
+			Format:       "uuid",
+			CreationPath: req.Path,
+		},
+	}
+
+	// Nothing is stored in the cubbyhole of a held request so it is always
+	// wrapped as a read; otherwise the listing rules would reject it.
+	wrapReq := &logical.Request{
+		ID:        req.ID,
+		Operation: logical.ReadOperation,
+		Path:      req.Path,
+	}
+	cubbyResp, err := c.wrapInCubbyhole(wrapReq, resp, nil)
+	if cubbyResp != nil || err != nil {
+		return cubbyResp, err
+	}
+
+	cgr := &controlGroupRequest{
+		Accessor:           resp.WrapInfo.Accessor,
+		Path:               req.Path,
+		Operation:          req.Operation,
+		Data:               req.Data,
+		RequesterAccessor:  te.Accessor,
+		RequesterTokenHash: requesterTokenHash,
+		RequesterEntityID:  te.EntityID,
+		Factors:            cg.Factors,
+		CreationTime:       resp.WrapInfo.CreationTime,
+		TTL:                cg.TTL,
+	}
+	c.controlGroupLock.Lock()
+	err = c.storeControlGroupRequest(cgr)
+	c.controlGroupLock.Unlock()
+	if err != nil {
+		c.tokenStore.Revoke(resp.WrapInfo.Token)
+		c.logger.Error("core: failed to store control group request", "request_path", req.Path, "error", err)
+		return nil, ErrInternalError
+	}
+
+	return &logical.Response{
+		WrapInfo: resp.WrapInfo,
+	}, nil
+}
+
+// controlGroupRequestForUnwrap returns the held request for the wrapping
+// token being unwrapped, if any, along with the wrapping token. It must be
+// called before the client token is used, so that a held request can never
+// be consumed without being processed.
+func (c *Core) controlGroupRequestForUnwrap(req *logical.Request) (*controlGroupRequest, string, error) {
+	token := req.GetString("token")
+	thirdParty := token != ""
+	if !thirdParty {
+		token = req.ClientToken
+	}
+	if token == "" {
+		return nil, "", nil
+	}
+
+	te, err := c.tokenStore.Lookup(token)
+	if err != nil {
+		c.logger.Error("core: failed to look up wrapping token", "error", err)
+		return nil, "", ErrInternalError
+	}
+	if te == nil || te.Accessor == "" {
+		return nil, "", nil
+	}
+
+	cgr, err := c.controlGroupRequestByAccessor(te.Accessor)
+	if err != nil {
+		c.logger.Error("core: failed to look up control group request", "error", err)
+		return nil, "", ErrInternalError
+	}
+	if cgr == nil {
+		return nil, "", nil
+	}
+
+	if !thirdParty {
+		return nil, "", errors.New("requests held by a control group must be unwrapped by the requesting token, supplying the wrapping token in the request body")
+	}
+	if !cgr.approved() {
+		return nil, "", errControlGroupPending
+	}
+
+	return cgr, token, nil
+}
+
+// controlGroupReplayRequest builds the original request held by an authorized
+// control group, to be processed with the token of the requester in place of
+// the unwrap.
+func (c *Core) controlGroupReplayRequest(req *logical.Request, te *TokenEntry, cgr *controlGroupRequest) (*logical.Request, error) {
+	if !c.controlGroupRequester(te, cgr) {
+		return nil, errors.New("requests held by a control group can only be unwrapped by the requesting token")
+	}
+
+	return &logical.Request{
+		ID:                       req.ID,
+		Operation:                cgr.Operation,
+		Path:                     cgr.Path,
+		Data:                     cgr.Data,
+		Headers:                  req.Headers,
+		Connection:               req.Connection,
+		ClientToken:              req.ClientToken,
+		ClientTokenAccessor:      req.ClientTokenAccessor,
+		ClientTokenRemainingUses: req.ClientTokenRemainingUses,
+		WrapInfo:                 req.WrapInfo,
+		MFACreds:                 req.MFACreds,
+	}, nil
+}
+
+// controlGroupRequester returns whether the token is the one that made the
+// held request
+func (c *Core) controlGroupRequester(te *TokenEntry, cgr *controlGroupRequest) bool {
+	if te == nil {
+		return false
+	}
+	if cgr.RequesterTokenHash != "" {
+		hash, err := c.tokenStore.SaltID(te.ID)
+		if err != nil {
+			c.logger.Error("core: failed to salt requester token of control group request", "error", err)
+			return false
+		}
+		return hash == cgr.RequesterTokenHash
+	}
+	return te.Accessor != "" && te.Accessor == cgr.RequesterAccessor
+}
+
+// consumeControlGroupRequest revokes the wrapping token of a held request and
+// removes the request, so that it can only be processed once.
+func (c *Core) consumeControlGroupRequest(cgr *controlGroupRequest, wrappingToken string) error {
+	if err := c.tokenStore.Revoke(wrappingToken); err != nil {
+		c.logger.Error("core: failed to revoke control group wrapping token", "error", err)
+		return ErrInternalError
+	}
+
+	c.controlGroupLock.Lock()
+	err := c.deleteControlGroupRequest(cgr.Accessor)
+	c.controlGroupLock.Unlock()
+	if err != nil {
+		c.logger.Error("core: failed to delete control group request", "error", err)
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+// authorizeControlGroupRequest records an authorization by the given entity
+// for the request held under the accessor.
+func (c *Core) authorizeControlGroupRequest(accessor, entityID string) (*controlGroupRequest, error) {
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+
+	cgr, err := c.controlGroupRequestByAccessor(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if cgr == nil {
+		return nil, logical.CodedError(400, "no control group request found for accessor")
+	}
+
+	if entityID == "" {
+		return nil, logical.CodedError(403, "authorizing a control group request requires a token tied to an identity entity")
+	}
+	if entityID == cgr.RequesterEntityID {
+		return nil, logical.CodedError(403, "requesters cannot authorize their own request")
+	}
+	for _, authz := range cgr.Authorizations {
+		if authz.EntityID == entityID {
+			return cgr, nil
+		}
+	}
+
+	groups, err := c.identityStore.transitiveGroupsByEntityID(entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	var factors []string
+	for _, factor := range cgr.Factors {
+		for _, group := range groups {
+			if strutil.StrListContains(factor.GroupIDs, group.ID) ||
+				strutil.StrListContains(factor.GroupNames, group.Name) {
+				factors = append(factors, factor.Name)
+				break
+			}
+		}
+	}
+	if len(factors) == 0 {
+		return nil, logical.CodedError(403, "entity is not an authorizer for this control group request")
+	}
+
+	cgr.Authorizations = append(cgr.Authorizations, &controlGroupAuthorization{
+		EntityID: entityID,
+		Factors:  factors,
+		Time:     time.Now(),
+	})
+	if err := c.storeControlGroupRequest(cgr); err != nil {
+		return nil, err
+	}
+
+	return cgr, nil
+}
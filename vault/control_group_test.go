@@ -0,0 +1,436 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+var controlGroupPolicy = `
+name = "breakglass"
+
+path "secret/foo" {
+	capabilities = ["read"]
+	control_group = {
+		ttl = "1h"
+		factor "managers" {
+			identity {
+				group_names = ["managers"]
+				approvals = 2
+			}
+		}
+	}
+}
+`
+
+var controlGroupApproverPolicy = `
+name = "approver"
+
+path "sys/control-group/*" {
+	capabilities = ["update"]
+}
+`
+
+func TestControlGroup_Parse(t *testing.T) {
+	p, err := Parse(controlGroupPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expected := &ControlGroup{
+		TTL: time.Hour,
+		Factors: []*ControlGroupFactor{
+			&ControlGroupFactor{
+				Name:       "managers",
+				GroupNames: []string{"managers"},
+				Approvals:  2,
+			},
+		},
+	}
+	if !reflect.DeepEqual(p.Paths[0].Permissions.ControlGroup, expected) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", p.Paths[0].Permissions.ControlGroup, expected)
+	}
+
+	_, err = Parse(`
+path "secret/foo" {
+	capabilities = ["read"]
+	control_group = {
+		ttl = "1h"
+	}
+}
+`)
+	if err == nil {
+		t.Fatalf("expected error parsing control group without factors")
+	}
+}
+
+func TestControlGroup_ACLMerge(t *testing.T) {
+	p1, err := Parse(controlGroupPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p2, err := Parse(`
+name = "other"
+
+path "secret/foo" {
+	capabilities = ["list"]
+	control_group = {
+		ttl = "30m"
+		factor "security" {
+			identity {
+				group_ids = ["abcd"]
+			}
+		}
+	}
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{p1, p2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cg := acl.ControlGroup("secret/foo")
+	if cg == nil {
+		t.Fatalf("expected a control group")
+	}
+	if cg.TTL != 30*time.Minute {
+		t.Fatalf("bad: ttl: %v", cg.TTL)
+	}
+	if len(cg.Factors) != 2 || cg.Factors[0].Name != "managers" || cg.Factors[1].Name != "security" {
+		t.Fatalf("bad: factors: %#v", cg.Factors)
+	}
+	if cg.Factors[1].Approvals != 1 {
+		t.Fatalf("bad: approvals: %d", cg.Factors[1].Approvals)
+	}
+
+	// The policies themselves must not have been modified by the merge
+	if len(p1.Paths[0].Permissions.ControlGroup.Factors) != 1 {
+		t.Fatalf("policy control group was modified")
+	}
+
+	if acl.ControlGroup("secret/bar") != nil {
+		t.Fatalf("expected no control group")
+	}
+}
+
+func TestControlGroup_ACLMergeSameFactor(t *testing.T) {
+	p1, err := Parse(controlGroupPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p2, err := Parse(`
+name = "other"
+
+path "secret/foo" {
+	capabilities = ["list"]
+	control_group = {
+		factor "managers" {
+			identity {
+				group_ids = ["abcd"]
+				group_names = ["managers"]
+				approvals = 3
+			}
+		}
+	}
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{p1, p2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Factors with the same name are merged rather than counted twice
+	cg := acl.ControlGroup("secret/foo")
+	if cg == nil || len(cg.Factors) != 1 {
+		t.Fatalf("bad: %#v", cg)
+	}
+	factor := cg.Factors[0]
+	if factor.Name != "managers" || factor.Approvals != 3 {
+		t.Fatalf("bad: %#v", factor)
+	}
+	if !reflect.DeepEqual(factor.GroupNames, []string{"managers"}) || !reflect.DeepEqual(factor.GroupIDs, []string{"abcd"}) {
+		t.Fatalf("bad: %#v", factor)
+	}
+
+	cgr := &controlGroupRequest{Factors: cg.Factors}
+	for i := 0; i < 3; i++ {
+		if cgr.approved() {
+			t.Fatalf("approved with %d authorizations", i)
+		}
+		cgr.Authorizations = append(cgr.Authorizations, &controlGroupAuthorization{
+			Factors: []string{"managers"},
+		})
+	}
+	if !cgr.approved() {
+		t.Fatal("expected request to be approved")
+	}
+
+	// The policies themselves must not have been modified by the merge
+	if p1.Paths[0].Permissions.ControlGroup.Factors[0].Approvals != 2 || len(p1.Paths[0].Permissions.ControlGroup.Factors[0].GroupIDs) != 0 {
+		t.Fatalf("policy control group was modified")
+	}
+}
+
+func testControlGroupEntity(t *testing.T, c *Core, name string) string {
+	resp, err := c.identityStore.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "entity",
+		Data: map[string]interface{}{
+			"name": name,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	return resp.Data["id"].(string)
+}
+
+func testControlGroupToken(t *testing.T, c *Core, entityID string, policies []string) string {
+	te := &TokenEntry{
+		Path:     "test",
+		Policies: policies,
+		EntityID: entityID,
+	}
+	if err := c.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return te.ID
+}
+
+func TestControlGroup_Workflow(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["foo"] = "bar"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, raw := range []string{controlGroupPolicy, controlGroupApproverPolicy} {
+		policy, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := c.policyStore.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	requesterID := testControlGroupEntity(t, c, "requester")
+	approver1ID := testControlGroupEntity(t, c, "approver1")
+	approver2ID := testControlGroupEntity(t, c, "approver2")
+
+	resp, err := c.identityStore.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "group",
+		Data: map[string]interface{}{
+			"name":              "managers",
+			"member_entity_ids": []string{approver1ID, approver2ID},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	requester := testControlGroupToken(t, c, requesterID, []string{"default", "breakglass", "approver"})
+	approver1 := testControlGroupToken(t, c, approver1ID, []string{"default", "approver"})
+	approver2 := testControlGroupToken(t, c, approver2ID, []string{"default", "approver"})
+
+	// The read is held and a wrapping token returned instead
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = requester
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" || resp.WrapInfo.Accessor == "" {
+		t.Fatalf("expected a wrapping token, got %#v", resp)
+	}
+	if resp.Data != nil {
+		t.Fatalf("held response must not contain data: %#v", resp.Data)
+	}
+	if resp.WrapInfo.TTL != time.Hour {
+		t.Fatalf("bad: wrapping ttl: %v", resp.WrapInfo.TTL)
+	}
+	wrappingToken := resp.WrapInfo.Token
+	accessor := resp.WrapInfo.Accessor
+
+	unwrap := func(clientToken string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/wrapping/unwrap")
+		req.ClientToken = clientToken
+		req.Data = data
+		return c.HandleRequest(req)
+	}
+	authorize := func(clientToken string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+		req.ClientToken = clientToken
+		req.Data["accessor"] = accessor
+		return c.HandleRequest(req)
+	}
+
+	// Unwrapping is blocked until the request is authorized
+	resp, err = unwrap(requester, map[string]interface{}{"token": wrappingToken})
+	if err == nil || resp == nil || resp.Data["error"] != errControlGroupPending.Error() {
+		t.Fatalf("expected pending error, got resp: %#v, err: %v", resp, err)
+	}
+
+	// The wrapping token cannot unwrap itself, and is not consumed trying
+	resp, err = unwrap(wrappingToken, nil)
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+	te, err := c.tokenStore.Lookup(wrappingToken)
+	if err != nil || te == nil {
+		t.Fatalf("wrapping token was consumed: te: %#v, err: %v", te, err)
+	}
+
+	// The requester cannot authorize their own request
+	resp, err = authorize(requester)
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+
+	resp, err = authorize(approver1)
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Data["approved"].(bool) {
+		t.Fatalf("request should not be approved after one authorization")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/request")
+	req.ClientToken = approver2
+	req.Data["accessor"] = accessor
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Data["request_path"] != "secret/foo" || resp.Data["approved"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["request_entity"].(map[string]interface{})["name"] != "requester" {
+		t.Fatalf("bad: request entity: %#v", resp.Data["request_entity"])
+	}
+	authorizations := resp.Data["authorizations"].([]map[string]interface{})
+	if len(authorizations) != 1 || authorizations[0]["entity_id"] != approver1ID {
+		t.Fatalf("bad: authorizations: %#v", authorizations)
+	}
+
+	resp, err = authorize(approver2)
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if !resp.Data["approved"].(bool) {
+		t.Fatalf("request should be approved")
+	}
+
+	// Only the requester can process the request
+	resp, err = unwrap(approver1, map[string]interface{}{"token": wrappingToken})
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+
+	resp, err = unwrap(requester, map[string]interface{}{"token": wrappingToken})
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp == nil || resp.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The wrapping token is consumed
+	resp, err = unwrap(requester, map[string]interface{}{"token": wrappingToken})
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+	cgr, err := c.controlGroupRequestByAccessor(accessor)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cgr != nil {
+		t.Fatalf("expected control group request to be removed")
+	}
+}
+
+func TestControlGroup_Tidy(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	for accessor, creation := range map[string]time.Time{
+		"expired": time.Now().Add(-2 * time.Hour),
+		"pending": time.Now(),
+	} {
+		err := c.storeControlGroupRequest(&controlGroupRequest{
+			Accessor:     accessor,
+			Path:         "secret/foo",
+			Operation:    logical.ReadOperation,
+			CreationTime: creation,
+			TTL:          time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	if err := c.tidyControlGroupRequests(nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	keys, err := c.controlGroupView().List("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected only the pending request to be kept, got %v", keys)
+	}
+	cgr, err := c.controlGroupRequestByAccessor("pending")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cgr == nil {
+		t.Fatal("expected pending request to be kept")
+	}
+}
+
+func TestControlGroup_Requester(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	service := &TokenEntry{ID: "service", Accessor: "service-accessor"}
+	batch := &TokenEntry{ID: "b.one", Type: logical.TokenTypeBatch}
+	otherBatch := &TokenEntry{ID: "b.two", Type: logical.TokenTypeBatch}
+
+	hash, err := c.tokenStore.SaltID(batch.ID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cases := []struct {
+		cgr      *controlGroupRequest
+		te       *TokenEntry
+		expected bool
+	}{
+		{&controlGroupRequest{RequesterAccessor: "service-accessor"}, service, true},
+		{&controlGroupRequest{RequesterAccessor: "other-accessor"}, service, false},
+		{&controlGroupRequest{RequesterTokenHash: hash}, batch, true},
+		{&controlGroupRequest{RequesterTokenHash: hash}, otherBatch, false},
+		{&controlGroupRequest{RequesterTokenHash: hash}, service, false},
+		// Requests held for batch tokens before they were bound to the
+		// token cannot be replayed by any batch token
+		{&controlGroupRequest{}, otherBatch, false},
+		{&controlGroupRequest{RequesterAccessor: "service-accessor"}, nil, false},
+	}
+	for i, tc := range cases {
+		if actual := c.controlGroupRequester(tc.te, tc.cgr); actual != tc.expected {
+			t.Fatalf("%d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/subtle"
+	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -29,11 +30,13 @@ import (
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
 	"github.com/hashicorp/vault/helper/reload"
 	"github.com/hashicorp/vault/helper/tlsutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
+	sr "github.com/hashicorp/vault/serviceregistration"
 	"github.com/hashicorp/vault/shamir"
 	cache "github.com/patrickmn/go-cache"
 )
@@ -101,8 +104,6 @@ var (
 	// Functions only in the Enterprise version
 	enterprisePostUnseal = enterprisePostUnsealImpl
 	enterprisePreSeal    = enterprisePreSealImpl
-	startReplication     = startReplicationImpl
-	stopReplication      = stopReplicationImpl
 	LastRemoteWAL        = lastRemoteWALImpl
 )
 
@@ -155,6 +156,10 @@ type Core struct {
 	// HABackend may be available depending on the physical backend
 	ha physical.HABackend
 
+	// serviceRegistration is notified of changes to the sealed and active
+	// state, if configured
+	serviceRegistration sr.ServiceRegistration
+
 	// redirectAddr is the address we advertise as leader if held
 	redirectAddr string
 
@@ -191,6 +196,17 @@ type Core struct {
 	standbyStopCh    chan struct{}
 	manualStepDownCh chan struct{}
 
+	// perfStandbyEnabled indicates whether this node serves read requests
+	// while it is a standby, and perfStandby whether it is currently doing
+	// so. When perfStandby is set the mounts and other state are loaded
+	// read-only from storage.
+	perfStandbyEnabled bool
+	perfStandby        bool
+
+	// invalidations records the keys written to storage, which performance
+	// standbys fetch from the active node to invalidate their state
+	invalidations *invalidationLog
+
 	// unlockInfo has the keys provided to Unseal until the threshold number of parts is available, as well as the operation nonce
 	unlockInfo *unlockInformation
 
@@ -263,6 +279,22 @@ type Core struct {
 	// identityStore is used to manage client entities
 	identityStore *IdentityStore
 
+	// controlGroupLock serializes updates to requests held by control groups
+	controlGroupLock sync.Mutex
+
+	// controlGroupTidyStopCh stops the periodic removal of expired held
+	// requests, and controlGroupTidyDoneCh is closed once it has stopped
+	controlGroupTidyStopCh chan struct{}
+	controlGroupTidyDoneCh chan struct{}
+
+	// mfaUsedCodesLock serializes the checks and updates of the TOTP
+	// passcodes used recently, which are kept in storage so that they can't
+	// be replayed against another node
+	mfaUsedCodesLock sync.Mutex
+
+	// quotas holds the quotas enforced on requests
+	quotas *quotaManager
+
 	// metricsCh is used to stop the metrics streaming
 	metricsCh chan struct{}
 
@@ -270,6 +302,30 @@ type Core struct {
 	// metrics emission and sealing leading to a nil pointer
 	metricsMutex sync.Mutex
 
+	// metricsHelper gives access to the in-memory metrics for sys/metrics
+	metricsHelper *metricsutil.MetricsHelper
+
+	// sanitizedConfig is the configuration of the server as served by
+	// sys/config/state/sanitized
+	sanitizedConfig map[string]interface{}
+
+	// inFlightReqs are the requests being served by this node, by ID, and
+	// inFlightWaiters are the callers waiting for some of them to be served.
+	// New requests are rejected while drains, the number of calls to
+	// DrainRequests not yet undone by ResumeRequests, is not zero.
+	inFlightLock    sync.Mutex
+	inFlightReqs    map[string]*InFlightRequest
+	inFlightWaiters map[*inFlightWaiter]struct{}
+	drains          int
+
+	// drainTimeout is how long in-flight requests are waited for before
+	// stepping down
+	drainTimeout time.Duration
+
+	// stateMetricsCh is used to stop emitting the seal and HA state
+	stateMetricsCh       chan struct{}
+	stateMetricsStopOnce sync.Once
+
 	defaultLeaseTTL time.Duration
 	maxLeaseTTL     time.Duration
 
@@ -341,12 +397,44 @@ type Core struct {
 	// The grpc forwarding client
 	rpcForwardingClient *forwardingClient
 
+	// nodeSystemBackend serves the node paths on standbys, which have no
+	// mounts set up
+	nodeSystemBackend     *SystemBackend
+	nodeSystemBackendOnce sync.Once
+
+	// standbyAudit holds the audit devices set up on a standby to audit the
+	// node paths it serves
+	standbyAudit     *standbyAudit
+	standbyAuditLock sync.Mutex
+
 	// CORS Information
 	corsConfig *CORSConfig
 
 	// replicationState keeps the current replication state cached for quick
 	// lookup
 	replicationState consts.ReplicationState
+	// replicationConfig is the replication configuration loaded on unseal
+	replicationConfig *replicationConfig
+	// replicationTLSCert and replicationCAPool are used by a primary to
+	// accept connections from its secondaries. They are protected by
+	// clusterParamsLock.
+	replicationTLSCert *tls.Certificate
+	replicationCAPool  *x509.CertPool
+	// replicationRPCServer is the grpc Server that streams to secondaries
+	replicationRPCServer *grpc.Server
+	// replicationSecondary tracks the progress of a secondary
+	replicationSecondary *secondaryReplication
+	// replicationWAL records the replicated keys written to storage, which
+	// a primary streams to its secondaries
+	replicationWAL *invalidationLog
+	// replicationMerkleTrees holds the merkle tree a primary built for each
+	// secondary at the start of its current reindex
+	replicationMerkleTrees     map[string]*merkleTree
+	replicationMerkleTreesLock sync.Mutex
+	// replicationPeers holds a channel per secondary streamed to, closed
+	// when the entry of the secondary changes
+	replicationPeers     map[string]chan struct{}
+	replicationPeersLock sync.Mutex
 
 	// uiEnabled indicates whether Vault Web UI is enabled or not
 	uiEnabled bool
@@ -383,6 +471,9 @@ type CoreConfig struct {
 	// May be nil, which disables HA operations
 	HAPhysical physical.HABackend `json:"ha_physical" structs:"ha_physical" mapstructure:"ha_physical"`
 
+	// May be nil, which disables service registration
+	ServiceRegistration sr.ServiceRegistration `json:"service_registration" structs:"service_registration" mapstructure:"service_registration"`
+
 	Seal Seal `json:"seal" structs:"seal" mapstructure:"seal"`
 
 	Logger log.Logger `json:"logger" structs:"logger" mapstructure:"logger"`
@@ -417,6 +508,20 @@ type CoreConfig struct {
 
 	PluginDirectory string `json:"plugin_directory" structs:"plugin_directory" mapstructure:"plugin_directory"`
 
+	// Serve read requests locally while in standby mode
+	PerformanceStandby bool `json:"performance_standby" structs:"performance_standby" mapstructure:"performance_standby"`
+
+	// May be nil, in which case sys/metrics is not available
+	MetricsHelper *metricsutil.MetricsHelper `json:"metrics_helper" structs:"metrics_helper" mapstructure:"metrics_helper"`
+
+	// The configuration of the server with its secrets removed, served by
+	// sys/config/state/sanitized
+	SanitizedConfig map[string]interface{} `json:"sanitized_config" structs:"sanitized_config" mapstructure:"sanitized_config"`
+
+	// How long in-flight requests are waited for before stepping down, or
+	// zero for the default
+	DrainTimeout time.Duration `json:"drain_timeout" structs:"drain_timeout" mapstructure:"drain_timeout"`
+
 	ReloadFuncs     *map[string][]reload.ReloadFunc
 	ReloadFuncsLock *sync.RWMutex
 }
@@ -460,6 +565,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	c := &Core{
 		devToken:                         conf.DevToken,
 		physical:                         conf.Physical,
+		serviceRegistration:              conf.ServiceRegistration,
 		redirectAddr:                     conf.RedirectAddr,
 		clusterAddr:                      conf.ClusterAddr,
 		seal:                             conf.Seal,
@@ -476,6 +582,19 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		clusterPeerClusterAddrsCache:     cache.New(3*heartbeatInterval, time.Second),
 		enableMlock:                      !conf.DisableMlock,
 		rawEnabled:                       conf.EnableRaw,
+		perfStandbyEnabled:               conf.PerformanceStandby,
+		replicationSecondary:             &secondaryReplication{},
+		replicationMerkleTrees:           make(map[string]*merkleTree),
+		replicationPeers:                 make(map[string]chan struct{}),
+		metricsHelper:                    conf.MetricsHelper,
+		sanitizedConfig:                  conf.SanitizedConfig,
+		inFlightReqs:                     make(map[string]*InFlightRequest),
+		drainTimeout:                     conf.DrainTimeout,
+		stateMetricsCh:                   make(chan struct{}),
+	}
+
+	if c.drainTimeout == 0 {
+		c.drainTimeout = DefaultDrainTimeout
 	}
 
 	if conf.ClusterCipherSuites != "" {
@@ -499,6 +618,16 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		}
 	}
 
+	// Record the keys written to storage so that performance standbys can be
+	// told about them
+	if conf.HAPhysical != nil && conf.HAPhysical.HAEnabled() {
+		c.invalidations = newInvalidationLog(nil)
+		c.replicationWAL = newInvalidationLog(func(key string) bool {
+			return replicatedKey(key, nil)
+		})
+		c.physical = newInvalidationRecorder(c.physical, c.invalidations, c.replicationWAL)
+	}
+
 	if !conf.DisableMlock {
 		// Ensure our memory usage is locked into physical RAM
 		if err := mlock.LockMemory(); err != nil {
@@ -585,6 +714,11 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	}
 	c.seal.SetCore(c)
 
+	// Only servers with telemetry set up have a use for the state metrics
+	if c.metricsHelper != nil {
+		go c.emitStateMetrics(c.stateMetricsCh)
+	}
+
 	// Attempt unsealing with stored keys; if there are no stored keys this
 	// returns nil, otherwise returns nil or an error
 	storedKeyErr := c.UnsealWithStoredKeys()
@@ -604,6 +738,10 @@ func (c *Core) Shutdown() error {
 	}
 	c.stateLock.RUnlock()
 
+	c.stateMetricsStopOnce.Do(func() {
+		close(c.stateMetricsCh)
+	})
+
 	// Seal the Vault, causes a leader stepdown
 	retChan := make(chan error)
 	go func() {
@@ -634,7 +772,7 @@ func (c *Core) LookupToken(token string) (*TokenEntry, error) {
 	if c.sealed {
 		return nil, consts.ErrSealed
 	}
-	if c.standby {
+	if c.standby && !c.perfStandby {
 		return nil, consts.ErrStandby
 	}
 
@@ -724,12 +862,12 @@ func (c *Core) fetchACLTokenEntryAndEntity(clientToken string) (*ACL, *TokenEntr
 	return acl, te, entity, nil
 }
 
-func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, error) {
+func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, *ControlGroup, error) {
 	defer metrics.MeasureSince([]string{"core", "check_token"}, time.Now())
 
-	acl, te, _, err := c.fetchACLTokenEntryAndEntity(req.ClientToken)
+	acl, te, entity, err := c.fetchACLTokenEntryAndEntity(req.ClientToken)
 	if err != nil {
-		return nil, te, err
+		return nil, te, nil, err
 	}
 
 	// Check if this is a root protected path
@@ -751,9 +889,9 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		default:
 			c.logger.Error("core: failed to run existence check", "error", err)
 			if _, ok := err.(errutil.UserError); ok {
-				return nil, nil, err
+				return nil, nil, nil, err
 			} else {
-				return nil, nil, ErrInternalError
+				return nil, nil, nil, ErrInternalError
 			}
 		}
 
@@ -791,14 +929,27 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 	allowed, rootPrivs := acl.AllowOperation(req)
 	if !allowed {
 		// Return auth for audit logging even if not allowed
-		return auth, te, logical.ErrPermissionDenied
+		return auth, te, nil, logical.ErrPermissionDenied
 	}
 	if rootPath && !rootPrivs {
 		// Return auth for audit logging even if not allowed
-		return auth, te, logical.ErrPermissionDenied
+		return auth, te, nil, logical.ErrPermissionDenied
 	}
 
-	return auth, te, nil
+	// Validate any MFA methods required for the path
+	if mfaMethods := acl.MFAMethods(req.Path); len(mfaMethods) > 0 {
+		if err := c.validateMFA(entity, mfaMethods, req.MFACreds); err != nil {
+			return auth, te, nil, err
+		}
+	}
+
+	// Return any control group the request must be held for
+	var cg *ControlGroup
+	if !controlGroupExempt(req.Path) {
+		cg = acl.ControlGroup(req.Path)
+	}
+
+	return auth, te, cg, nil
 }
 
 // Sealed checks if the Vault is current sealed
@@ -873,7 +1024,7 @@ func (c *Core) Leader() (isLeader bool, leaderAddr, clusterAddr string, err erro
 	}
 
 	key := coreLeaderPrefix + leaderUUID
-	entry, err := c.barrier.Get(key)
+	entry, err := c.barrier.Get(context.Background(), key)
 	if err != nil {
 		return false, "", "", err
 	}
@@ -1083,16 +1234,7 @@ func (c *Core) unsealInternal(masterKey []byte) (bool, error) {
 
 	// Success!
 	c.sealed = false
-	if c.ha != nil {
-		sd, ok := c.ha.(physical.ServiceDiscovery)
-		if ok {
-			if err := sd.NotifySealedStateChange(); err != nil {
-				if c.logger.IsWarn() {
-					c.logger.Warn("core: failed to notify unsealed status", "error", err)
-				}
-			}
-		}
-	}
+	c.notifySealedStateChange("unsealed")
 	return true, nil
 }
 
@@ -1375,16 +1517,7 @@ func (c *Core) sealInternal() error {
 		return err
 	}
 
-	if c.ha != nil {
-		sd, ok := c.ha.(physical.ServiceDiscovery)
-		if ok {
-			if err := sd.NotifySealedStateChange(); err != nil {
-				if c.logger.IsWarn() {
-					c.logger.Warn("core: failed to notify sealed status", "error", err)
-				}
-			}
-		}
-	}
+	c.notifySealedStateChange("sealed")
 
 	c.logger.Info("core: vault is sealed")
 
@@ -1411,6 +1544,13 @@ func (c *Core) postUnseal() (retErr error) {
 	c.clearForwardingClients()
 	c.requestForwardingConnectionLock.Unlock()
 
+	// Performance standbys following a previous active node need to load
+	// their state again
+	if c.invalidations != nil {
+		c.invalidations.reset()
+		c.replicationWAL.reset()
+	}
+
 	// Purge the backend if supported
 	if purgable, ok := c.physical.(physical.Purgable); ok {
 		purgable.Purge()
@@ -1425,6 +1565,9 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := enterprisePostUnseal(c); err != nil {
 		return err
 	}
+	if err := c.loadReplicationConfig(); err != nil {
+		return err
+	}
 	if err := c.ensureWrappingKey(); err != nil {
 		return err
 	}
@@ -1464,6 +1607,14 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupAuditedHeadersConfig(); err != nil {
 		return err
 	}
+	if err := c.setupQuotas(); err != nil {
+		return err
+	}
+	c.startControlGroupTidy()
+
+	if err := c.startReplication(); err != nil {
+		return err
+	}
 
 	if c.ha != nil {
 		if err := c.startClusterListener(); err != nil {
@@ -1494,8 +1645,15 @@ func (c *Core) preSeal() error {
 	}
 	var result error
 
+	if err := c.stopReplication(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("error stopping replication: {{err}}", err))
+	}
 	c.stopClusterListener()
 
+	c.stopControlGroupTidy()
+	if err := c.teardownQuotas(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("error tearing down quotas: {{err}}", err))
+	}
 	if err := c.teardownAudits(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error tearing down audits: {{err}}", err))
 	}
@@ -1534,14 +1692,6 @@ func enterprisePreSealImpl(c *Core) error {
 	return nil
 }
 
-func startReplicationImpl(c *Core) error {
-	return nil
-}
-
-func stopReplicationImpl(c *Core) error {
-	return nil
-}
-
 // runStandby is a long running routine that is used when an HA backend
 // is enabled. It waits until we are leader and switches this Vault to
 // active.
@@ -1585,8 +1735,11 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			return
 		}
 
-		// Attempt the acquisition
+		// Attempt the acquisition, serving reads in the meantime if this is
+		// a performance standby
+		stopPerfStandby := c.startPerfStandby()
 		leaderLostCh := c.acquireLock(lock, stopCh)
+		stopPerfStandby()
 
 		// Bail if we are being shutdown
 		if leaderLostCh == nil {
@@ -1675,6 +1828,12 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		case <-manualStepDownCh:
 			c.logger.Warn("core: stepping down from active operation to standby")
 			manualStepDown = true
+
+			// Let the requests being served complete before giving up
+			// leadership. New requests are still served in the meantime,
+			// and are forwarded or redirected to the new active node once
+			// leadership is lost.
+			c.WaitForRequests(c.drainTimeout)
 		}
 
 		metrics.MeasureSince([]string{"core", "leadership_lost"}, activeTime)
@@ -1744,7 +1903,7 @@ func (c *Core) periodicCheckKeyUpgrade(doneCh, stopCh chan struct{}) {
 			// Check for a poison pill. If we can read it, it means we have stale
 			// keys (e.g. from replication being activated) and we need to seal to
 			// be unsealed again.
-			entry, _ := c.barrier.Get(poisonPillPath)
+			entry, _ := c.barrier.Get(context.Background(), poisonPillPath)
 			if entry != nil && len(entry.Value) > 0 {
 				c.logger.Warn("core: encryption keys have changed out from underneath us (possibly due to replication enabling), must be unsealed again")
 				go c.Shutdown()
@@ -1785,7 +1944,7 @@ func (c *Core) checkKeyUpgrades() error {
 // are cleaned up in a timely manner if a leader failover takes place
 func (c *Core) scheduleUpgradeCleanup() error {
 	// List the upgrades
-	upgrades, err := c.barrier.List(keyringUpgradePrefix)
+	upgrades, err := c.barrier.List(context.Background(), keyringUpgradePrefix)
 	if err != nil {
 		return fmt.Errorf("failed to list upgrades: %v", err)
 	}
@@ -1808,7 +1967,7 @@ func (c *Core) scheduleUpgradeCleanup() error {
 		}
 		for _, upgrade := range upgrades {
 			path := fmt.Sprintf("%s%s", keyringUpgradePrefix, upgrade)
-			if err := c.barrier.Delete(path); err != nil {
+			if err := c.barrier.Delete(context.Background(), path); err != nil {
 				c.logger.Error("core: failed to cleanup upgrade", "path", path, "error", err)
 			}
 		}
@@ -1889,14 +2048,13 @@ func (c *Core) advertiseLeader(uuid string, leaderLostCh <-chan struct{}) error
 		Key:   coreLeaderPrefix + uuid,
 		Value: val,
 	}
-	err = c.barrier.Put(ent)
+	err = c.barrier.Put(context.Background(), ent)
 	if err != nil {
 		return err
 	}
 
-	sd, ok := c.ha.(physical.ServiceDiscovery)
-	if ok {
-		if err := sd.NotifyActiveStateChange(); err != nil {
+	if c.serviceRegistration != nil {
+		if err := c.serviceRegistration.NotifyActiveStateChange(); err != nil {
 			if c.logger.IsWarn() {
 				c.logger.Warn("core: failed to notify active status", "error", err)
 			}
@@ -1906,7 +2064,7 @@ func (c *Core) advertiseLeader(uuid string, leaderLostCh <-chan struct{}) error
 }
 
 func (c *Core) cleanLeaderPrefix(uuid string, leaderLostCh <-chan struct{}) {
-	keys, err := c.barrier.List(coreLeaderPrefix)
+	keys, err := c.barrier.List(context.Background(), coreLeaderPrefix)
 	if err != nil {
 		c.logger.Error("core: failed to list entries in core/leader", "error", err)
 		return
@@ -1915,7 +2073,7 @@ func (c *Core) cleanLeaderPrefix(uuid string, leaderLostCh <-chan struct{}) {
 		select {
 		case <-time.After(leaderPrefixCleanDelay):
 			if keys[0] != uuid {
-				c.barrier.Delete(coreLeaderPrefix + keys[0])
+				c.barrier.Delete(context.Background(), coreLeaderPrefix+keys[0])
 			}
 			keys = keys[1:]
 		case <-leaderLostCh:
@@ -1927,12 +2085,11 @@ func (c *Core) cleanLeaderPrefix(uuid string, leaderLostCh <-chan struct{}) {
 // clearLeader is used to clear our leadership entry
 func (c *Core) clearLeader(uuid string) error {
 	key := coreLeaderPrefix + uuid
-	err := c.barrier.Delete(key)
+	err := c.barrier.Delete(context.Background(), key)
 
 	// Advertise ourselves as a standby
-	sd, ok := c.ha.(physical.ServiceDiscovery)
-	if ok {
-		if err := sd.NotifyActiveStateChange(); err != nil {
+	if c.serviceRegistration != nil {
+		if err := c.serviceRegistration.NotifyActiveStateChange(); err != nil {
 			if c.logger.IsWarn() {
 				c.logger.Warn("core: failed to notify standby status", "error", err)
 			}
@@ -1942,8 +2099,32 @@ func (c *Core) clearLeader(uuid string) error {
 	return err
 }
 
+// notifySealedStateChange tells the service registration, if any, that the
+// core was sealed or unsealed. Without HA the core is active exactly when it
+// is unsealed, so that changed as well.
+func (c *Core) notifySealedStateChange(status string) {
+	if c.serviceRegistration == nil {
+		return
+	}
+	if err := c.serviceRegistration.NotifySealedStateChange(); err != nil {
+		if c.logger.IsWarn() {
+			c.logger.Warn(fmt.Sprintf("core: failed to notify %s status", status), "error", err)
+		}
+	}
+	if c.ha == nil {
+		if err := c.serviceRegistration.NotifyActiveStateChange(); err != nil {
+			if c.logger.IsWarn() {
+				c.logger.Warn("core: failed to notify active status", "error", err)
+			}
+		}
+	}
+}
+
 // emitMetrics is used to periodically expose metrics while runnig
 func (c *Core) emitMetrics(stopCh chan struct{}) {
+	usageTicker := time.NewTicker(usageMetricsInterval)
+	defer usageTicker.Stop()
+
 	for {
 		select {
 		case <-time.After(time.Second):
@@ -1952,6 +2133,8 @@ func (c *Core) emitMetrics(stopCh chan struct{}) {
 				c.expiration.emitMetrics()
 			}
 			c.metricsMutex.Unlock()
+		case <-usageTicker.C:
+			c.emitUsageMetrics()
 		case <-stopCh:
 			return
 		}
@@ -1983,7 +2166,3 @@ func (c *Core) BarrierKeyLength() (min, max int) {
 func (c *Core) AuditedHeadersConfig() *AuditedHeadersConfig {
 	return c.auditedHeaders
 }
-
-func lastRemoteWALImpl(c *Core) uint64 {
-	return 0
-}
@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"time"
+)
+
+// DefaultDrainTimeout is how long in-flight requests are waited for before
+// stepping down or shutting down unless configured otherwise
+const DefaultDrainTimeout = 10 * time.Second
+
+// InFlightRequest describes a request being served by this node
+type InFlightRequest struct {
+	Method           string
+	Path             string
+	ClientRemoteAddr string
+	StartTime        time.Time
+
+	// Streaming requests, such as log streams, last as long as the client
+	// wants and are not waited for when draining
+	Streaming bool
+}
+
+// inFlightWaiter is a caller of WaitForRequests. doneCh is closed once all
+// of the requests it waits for are served.
+type inFlightWaiter struct {
+	ids    map[string]struct{}
+	doneCh chan struct{}
+}
+
+// StartInFlightRequest records that a request is being served. It returns
+// false if the node is draining, in which case the request must be
+// rejected.
+func (c *Core) StartInFlightRequest(id string, req *InFlightRequest) bool {
+	c.inFlightLock.Lock()
+	defer c.inFlightLock.Unlock()
+	if c.drains > 0 {
+		return false
+	}
+	c.inFlightReqs[id] = req
+	return true
+}
+
+// FinishInFlightRequest records that a request has been served
+func (c *Core) FinishInFlightRequest(id string) {
+	c.inFlightLock.Lock()
+	defer c.inFlightLock.Unlock()
+	delete(c.inFlightReqs, id)
+	c.stopWaitingLocked(id)
+}
+
+// MarkInFlightRequestStreaming records that a request streams its response
+// for as long as the client wants, so that draining does not wait for it
+func (c *Core) MarkInFlightRequestStreaming(id string) {
+	c.inFlightLock.Lock()
+	defer c.inFlightLock.Unlock()
+	if req, ok := c.inFlightReqs[id]; ok {
+		req.Streaming = true
+	}
+	c.stopWaitingLocked(id)
+}
+
+// InFlightRequests returns a copy of the requests being served, by ID
+func (c *Core) InFlightRequests() map[string]InFlightRequest {
+	c.inFlightLock.Lock()
+	defer c.inFlightLock.Unlock()
+	reqs := make(map[string]InFlightRequest, len(c.inFlightReqs))
+	for id, req := range c.inFlightReqs {
+		reqs[id] = *req
+	}
+	return reqs
+}
+
+// DrainRequests stops accepting new requests and waits up to the timeout for
+// the in-flight ones to be served, streaming ones aside. It returns the
+// number of requests still in flight. New requests are rejected until
+// ResumeRequests is called as many times as DrainRequests was.
+func (c *Core) DrainRequests(timeout time.Duration) int {
+	c.inFlightLock.Lock()
+	c.drains++
+	c.inFlightLock.Unlock()
+	return c.WaitForRequests(timeout)
+}
+
+// ResumeRequests undoes a call to DrainRequests. New requests are accepted
+// again once every drain is undone.
+func (c *Core) ResumeRequests() {
+	c.inFlightLock.Lock()
+	defer c.inFlightLock.Unlock()
+	if c.drains > 0 {
+		c.drains--
+	}
+}
+
+// WaitForRequests waits up to the timeout for the requests in flight when it
+// is called to be served, streaming ones aside. Unlike DrainRequests it does
+// not reject new requests, nor wait for them. It returns the number of
+// requests it waited for that are still in flight.
+func (c *Core) WaitForRequests(timeout time.Duration) int {
+	c.inFlightLock.Lock()
+	w := &inFlightWaiter{
+		ids:    make(map[string]struct{}),
+		doneCh: make(chan struct{}),
+	}
+	for id, req := range c.inFlightReqs {
+		if !req.Streaming {
+			w.ids[id] = struct{}{}
+		}
+	}
+	if len(w.ids) == 0 {
+		c.inFlightLock.Unlock()
+		return 0
+	}
+	if c.inFlightWaiters == nil {
+		c.inFlightWaiters = make(map[*inFlightWaiter]struct{})
+	}
+	c.inFlightWaiters[w] = struct{}{}
+	c.inFlightLock.Unlock()
+
+	c.logger.Info("core: waiting for in-flight requests", "timeout", timeout)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.doneCh:
+		return 0
+	case <-timer.C:
+	}
+
+	c.inFlightLock.Lock()
+	defer c.inFlightLock.Unlock()
+	delete(c.inFlightWaiters, w)
+	remaining := len(w.ids)
+	if remaining > 0 {
+		c.logger.Warn("core: timed out waiting for in-flight requests", "remaining", remaining)
+	}
+	return remaining
+}
+
+// stopWaitingLocked is called when a request no longer needs to be waited
+// for, and wakes up the waiters for which it was the last one. The lock
+// must be held.
+func (c *Core) stopWaitingLocked(id string) {
+	for w := range c.inFlightWaiters {
+		if _, ok := w.ids[id]; !ok {
+			continue
+		}
+		delete(w.ids, id)
+		if len(w.ids) == 0 {
+			close(w.doneCh)
+			delete(c.inFlightWaiters, w)
+		}
+	}
+}
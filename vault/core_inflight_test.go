@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCore_InFlightRequests(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	if !c.StartInFlightRequest("one", &InFlightRequest{Path: "/v1/secret/foo"}) {
+		t.Fatal("request should have been accepted")
+	}
+	if !c.StartInFlightRequest("stream", &InFlightRequest{Path: "/v1/sys/monitor"}) {
+		t.Fatal("request should have been accepted")
+	}
+	c.MarkInFlightRequestStreaming("stream")
+
+	reqs := c.InFlightRequests()
+	if len(reqs) != 2 || reqs["one"].Path != "/v1/secret/foo" || !reqs["stream"].Streaming {
+		t.Fatalf("bad: %#v", reqs)
+	}
+
+	// Draining waits for the requests that are not streaming
+	doneCh := make(chan int)
+	go func() {
+		doneCh <- c.DrainRequests(5 * time.Second)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-doneCh:
+		t.Fatal("drain should wait for the request")
+	default:
+	}
+	if c.StartInFlightRequest("two", &InFlightRequest{}) {
+		t.Fatal("request should have been rejected while draining")
+	}
+
+	c.FinishInFlightRequest("one")
+	select {
+	case remaining := <-doneCh:
+		if remaining != 0 {
+			t.Fatalf("bad: %d", remaining)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not complete")
+	}
+
+	c.ResumeRequests()
+	if !c.StartInFlightRequest("two", &InFlightRequest{}) {
+		t.Fatal("request should have been accepted after resuming")
+	}
+
+	// Requests still in flight are reported once the timeout expires
+	if remaining := c.DrainRequests(10 * time.Millisecond); remaining != 1 {
+		t.Fatalf("bad: %d", remaining)
+	}
+
+	// Requests are only accepted again once every drain is undone
+	c.DrainRequests(10 * time.Millisecond)
+	c.ResumeRequests()
+	if c.StartInFlightRequest("three", &InFlightRequest{}) {
+		t.Fatal("request should have been rejected while still draining")
+	}
+	c.ResumeRequests()
+	if !c.StartInFlightRequest("three", &InFlightRequest{}) {
+		t.Fatal("request should have been accepted after resuming")
+	}
+	c.FinishInFlightRequest("two")
+	c.FinishInFlightRequest("three")
+}
+
+func TestCore_WaitForRequests(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	if remaining := c.WaitForRequests(time.Second); remaining != 0 {
+		t.Fatalf("bad: %d", remaining)
+	}
+
+	if !c.StartInFlightRequest("one", &InFlightRequest{}) {
+		t.Fatal("request should have been accepted")
+	}
+
+	doneCh := make(chan int)
+	go func() {
+		doneCh <- c.WaitForRequests(5 * time.Second)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// New requests are accepted while waiting, and not waited for
+	if !c.StartInFlightRequest("two", &InFlightRequest{}) {
+		t.Fatal("request should have been accepted while waiting")
+	}
+	c.FinishInFlightRequest("one")
+	select {
+	case remaining := <-doneCh:
+		if remaining != 0 {
+			t.Fatalf("bad: %d", remaining)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not complete")
+	}
+
+	if remaining := c.WaitForRequests(10 * time.Millisecond); remaining != 1 {
+		t.Fatalf("bad: %d", remaining)
+	}
+}
@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/metricsutil"
+)
+
+const (
+	// usageMetricsInterval is how often the gauges that are costly to
+	// compute, such as the number of tokens, are emitted. The number of
+	// tokens is only recounted every tokenCountInterval.
+	usageMetricsInterval = 10 * time.Second
+
+	// stateMetricsInterval is how often the seal and HA state is emitted
+	stateMetricsInterval = time.Second
+)
+
+// MetricsHelper returns the helper giving access to the in-memory metrics,
+// or nil if the server did not set one up
+func (c *Core) MetricsHelper() *metricsutil.MetricsHelper {
+	return c.metricsHelper
+}
+
+// emitUsageMetrics emits gauges describing what this node holds: the mounted
+// backends, the number of tokens and the number of leases of each mount. It
+// is only useful on the active node, which has them all loaded.
+func (c *Core) emitUsageMetrics() {
+	c.stateLock.RLock()
+	if c.sealed || c.standby {
+		c.stateLock.RUnlock()
+		return
+	}
+
+	c.mountsLock.RLock()
+	mountCounts := mountTypeCounts(c.mounts)
+	c.mountsLock.RUnlock()
+	c.authLock.RLock()
+	authCounts := mountTypeCounts(c.auth)
+	c.authLock.RUnlock()
+
+	for backendType, count := range mountCounts {
+		metrics.SetGaugeWithLabels([]string{"core", "mount_table", "num_entries"}, float32(count), []metrics.Label{
+			{Name: "table", Value: mountTableType},
+			{Name: "type", Value: backendType},
+		})
+	}
+	for backendType, count := range authCounts {
+		metrics.SetGaugeWithLabels([]string{"core", "mount_table", "num_entries"}, float32(count), []metrics.Label{
+			{Name: "table", Value: credentialTableType},
+			{Name: "type", Value: backendType},
+		})
+	}
+
+	if c.expiration != nil {
+		for mountPoint, count := range c.expiration.LeaseCounts() {
+			metrics.SetGaugeWithLabels([]string{"expire", "leases", "by_mount"}, float32(count), []metrics.Label{
+				{Name: "mount_point", Value: mountPoint},
+			})
+		}
+	}
+
+	// Counting the tokens reads storage, so it is done without holding the
+	// state lock
+	tokenStore := c.tokenStore
+	c.stateLock.RUnlock()
+
+	if tokenStore != nil {
+		count, err := tokenStore.tokenCount()
+		if err != nil {
+			c.logger.Error("core: failed to count tokens for metrics", "error", err)
+		} else {
+			metrics.SetGauge([]string{"token", "count"}, float32(count))
+		}
+	}
+}
+
+// mountTypeCounts returns the number of entries of each backend type in the
+// table, which may be nil
+func mountTypeCounts(table *MountTable) map[string]int {
+	counts := make(map[string]int)
+	if table == nil {
+		return counts
+	}
+	for _, entry := range table.Entries {
+		counts[entry.Type]++
+	}
+	return counts
+}
+
+// emitStateMetrics periodically emits whether the node is sealed, active or
+// a standby. Unlike the other metrics it runs for the whole life of the core
+// so that sealed and standby nodes report their state too.
+func (c *Core) emitStateMetrics(stopCh chan struct{}) {
+	ticker := time.NewTicker(stateMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.emitStateGauges()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (c *Core) emitStateGauges() {
+	c.stateLock.RLock()
+	sealed, standby, perfStandby := c.sealed, c.standby, c.perfStandby
+	c.stateLock.RUnlock()
+
+	metrics.SetGauge([]string{"core", "unsealed"}, boolGauge(!sealed))
+	metrics.SetGauge([]string{"core", "active"}, boolGauge(!sealed && !standby))
+	metrics.SetGauge([]string{"core", "standby"}, boolGauge(!sealed && standby))
+	metrics.SetGauge([]string{"core", "performance_standby"}, boolGauge(!sealed && perfStandby))
+}
+
+func boolGauge(b bool) float32 {
+	if b {
+		return 1
+	}
+	return 0
+}
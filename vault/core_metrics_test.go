@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testMetricsSink makes the global metrics go to a Prometheus sink for the
+// duration of the test
+func testMetricsSink(t *testing.T) (*metricsutil.PrometheusSink, func()) {
+	conf := metrics.DefaultConfig("vault")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+
+	sink := metricsutil.NewPrometheusSink(time.Minute)
+	if _, err := metrics.NewGlobal(conf, sink); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return sink, func() {
+		metrics.NewGlobal(conf, &metrics.BlackholeSink{})
+	}
+}
+
+func testExpectMetrics(t *testing.T, sink *metricsutil.PrometheusSink, expected []string) {
+	out := string(sink.Expose())
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("missing %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestCore_EmitUsageMetrics(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	sink, cleanup := testMetricsSink(t)
+	defer cleanup()
+
+	c.emitUsageMetrics()
+	testExpectMetrics(t, sink, []string{
+		`vault_core_mount_table_num_entries{table="auth",type="token"} 1`,
+		`vault_core_mount_table_num_entries{table="mounts",type="kv"} 1`,
+		`vault_token_count 2`,
+		`vault_expire_leases_by_mount{mount_point="auth/token/"} 1`,
+	})
+}
+
+func TestCore_EmitStateGauges(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	sink, cleanup := testMetricsSink(t)
+	defer cleanup()
+
+	c.emitStateGauges()
+	testExpectMetrics(t, sink, []string{
+		`vault_core_unsealed 1`,
+		`vault_core_active 1`,
+		`vault_core_standby 0`,
+	})
+
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c.emitStateGauges()
+	testExpectMetrics(t, sink, []string{
+		`vault_core_unsealed 0`,
+		`vault_core_active 0`,
+		`vault_core_standby 0`,
+	})
+}
+
+func TestTokenStore_TokenCount(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	count, err := ts.tokenCount()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 token, got %d", count)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The last count is reused until it is old enough
+	if count, err = ts.tokenCount(); err != nil || count != 1 {
+		t.Fatalf("expected cached count of 1, got %d (%v)", count, err)
+	}
+
+	ts.countLock.Lock()
+	ts.countTime = time.Now().Add(-tokenCountInterval)
+	ts.countLock.Unlock()
+	if count, err = ts.tokenCount(); err != nil || count != 2 {
+		t.Fatalf("expected count of 2, got %d (%v)", count, err)
+	}
+}
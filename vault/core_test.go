@@ -1,7 +1,11 @@
 package vault
 
 import (
+	"context"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,6 +17,7 @@ import (
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/physical/inmem"
+	sr "github.com/hashicorp/vault/serviceregistration"
 	log "github.com/mgutz/logxi/v1"
 )
 
@@ -707,6 +712,71 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 	}
 }
 
+func TestCore_HandleLogin_BatchToken(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:    []string{"foo"},
+				DisplayName: "armon",
+				LeaseOptions: logical.LeaseOptions{
+					Renewable: true,
+				},
+				TokenType: logical.TokenTypeBatch,
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	_, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Attempt to login
+	lreq := &logical.Request{
+		Path: "auth/foo/login",
+	}
+	lresp, err := c.HandleRequest(lreq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	clientToken := lresp.Auth.ClientToken
+	if !strings.HasPrefix(clientToken, batchTokenPrefix) {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+	if lresp.Auth.Renewable || lresp.Auth.Accessor != "" || lresp.Auth.TokenType != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+
+	te, err := c.tokenStore.Lookup(clientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te == nil || !te.IsBatch() || te.Parent != "" || te.Path != "auth/foo/login" {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// The token can be used like any other
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = clientToken
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["type"] != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
 func TestCore_HandleRequest_AuditTrail(t *testing.T) {
 	// Create a noop audit backend
 	noop := &NoopAudit{}
@@ -1347,13 +1417,13 @@ func TestCore_CleanLeaderPrefix(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		core.barrier.Put(&Entry{
+		core.barrier.Put(context.Background(), &Entry{
 			Key:   coreLeaderPrefix + keyUUID,
 			Value: []byte(valueUUID),
 		})
 	}
 
-	entries, err := core.barrier.List(coreLeaderPrefix)
+	entries, err := core.barrier.List(context.Background(), coreLeaderPrefix)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -1453,7 +1523,7 @@ func TestCore_CleanLeaderPrefix(t *testing.T) {
 	// Give time for the entries to clear out; it is conservative at 1/second
 	time.Sleep(10 * leaderPrefixCleanDelay)
 
-	entries, err = core2.barrier.List(coreLeaderPrefix)
+	entries, err = core2.barrier.List(context.Background(), coreLeaderPrefix)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -2137,3 +2207,69 @@ func TestCore_Standby_Rotate(t *testing.T) {
 		t.Fatalf("bad: %#v", resp)
 	}
 }
+
+// testServiceRegistration counts the notifications it receives
+type testServiceRegistration struct {
+	active int64
+	sealed int64
+}
+
+func (r *testServiceRegistration) Run(waitGroup *sync.WaitGroup, shutdownCh <-chan struct{}, redirectAddr string, activeFunc sr.ActiveFunction, sealedFunc sr.SealedFunction) error {
+	return nil
+}
+
+func (r *testServiceRegistration) NotifyActiveStateChange() error {
+	atomic.AddInt64(&r.active, 1)
+	return nil
+}
+
+func (r *testServiceRegistration) NotifySealedStateChange() error {
+	atomic.AddInt64(&r.sealed, 1)
+	return nil
+}
+
+func TestCore_ServiceRegistration(t *testing.T) {
+	logger = logformat.NewVaultLogger(log.LevelTrace)
+
+	inmha, err := inmem.NewInmemHA(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registration := &testServiceRegistration{}
+	core, err := NewCore(&CoreConfig{
+		Physical:            inmha,
+		HAPhysical:          inmha.(physical.HABackend),
+		ServiceRegistration: registration,
+		RedirectAddr:        "http://127.0.0.1:8200",
+		DisableMlock:        true,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, root := TestCoreInit(t, core)
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(core, TestKeyCopy(key)); err != nil {
+			t.Fatalf("unseal err: %s", err)
+		}
+	}
+	TestWaitActive(t, core)
+
+	if n := atomic.LoadInt64(&registration.sealed); n != 1 {
+		t.Fatalf("bad: sealed notified %d times", n)
+	}
+	if n := atomic.LoadInt64(&registration.active); n != 1 {
+		t.Fatalf("bad: active notified %d times", n)
+	}
+
+	// Sealing gives up leadership as well
+	if err := core.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n := atomic.LoadInt64(&registration.sealed); n != 2 {
+		t.Fatalf("bad: sealed notified %d times", n)
+	}
+	if n := atomic.LoadInt64(&registration.active); n != 2 {
+		t.Fatalf("bad: active notified %d times", n)
+	}
+}
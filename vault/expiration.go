@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -33,12 +34,18 @@ const (
 	// tokenViewPrefix is the prefix used for the token based lookup of leases.
 	tokenViewPrefix = "token/"
 
-	// maxRevokeAttempts limits how many revoke attempts are made
+	// maxRevokeAttempts limits how many revoke attempts are made before a
+	// lease is marked irrevocable
 	maxRevokeAttempts = 6
 
-	// revokeRetryBase is a baseline retry time
+	// revokeRetryBase is a baseline retry time, doubled with every failed
+	// attempt
 	revokeRetryBase = 10 * time.Second
 
+	// revokeWorkerCount limits how many expired leases are revoked
+	// concurrently
+	revokeWorkerCount = 64
+
 	// maxLeaseDuration is the default maximum lease duration
 	maxLeaseTTL = 32 * 24 * time.Hour
 
@@ -57,8 +64,8 @@ type ExpirationManager struct {
 	tokenStore *TokenStore
 	logger     log.Logger
 
-	pending     map[string]*time.Timer
-	pendingLock sync.RWMutex
+	// pending schedules the revocation of leases when they expire
+	pending *leaseScheduler
 
 	tidyLock int32
 
@@ -68,6 +75,34 @@ type ExpirationManager struct {
 	restoreLocks       []*locksutil.LockEntry
 	restoreLoaded      sync.Map
 	quitCh             chan struct{}
+
+	// leaseCountLock protects the number of outstanding leases of each mount
+	// and the lease count quotas that are kept up to date along with it
+	leaseCountLock   sync.Mutex
+	leaseCounts      map[string]int64
+	leaseCountQuotas map[*leaseCountQuota]struct{}
+
+	// leaseDeleteLocks serialize the deletion of a lease entry with the check
+	// that it still exists, so that a lease revoked twice concurrently is only
+	// uncounted once
+	leaseDeleteLocks []*locksutil.LockEntry
+
+	// revokeRetryBase is the delay before the first retry of a failed
+	// revocation
+	revokeRetryBase time.Duration
+
+	// irrevocable holds the leases that could not be revoked after
+	// maxRevokeAttempts attempts, keyed by lease ID
+	irrevocable     map[string]*IrrevocableLease
+	irrevocableLock sync.RWMutex
+}
+
+// IrrevocableLease describes a lease that expired but could not be revoked
+type IrrevocableLease struct {
+	LeaseID        string    `json:"lease_id"`
+	ExpireTime     time.Time `json:"expire_time"`
+	RevokeAttempts int       `json:"revoke_attempts"`
+	RevokeErr      string    `json:"error"`
 }
 
 // NewExpirationManager creates a new ExpirationManager that is backed
@@ -83,14 +118,21 @@ func NewExpirationManager(router *Router, view *BarrierView, ts *TokenStore, log
 		tokenView:  view.SubView(tokenViewPrefix),
 		tokenStore: ts,
 		logger:     logger,
-		pending:    make(map[string]*time.Timer),
 
 		// new instances of the expiration manager will go immediately into
 		// restore mode
 		restoreMode:  1,
 		restoreLocks: locksutil.CreateLocks(),
 		quitCh:       make(chan struct{}),
+
+		leaseCounts:      make(map[string]int64),
+		leaseCountQuotas: make(map[*leaseCountQuota]struct{}),
+		leaseDeleteLocks: locksutil.CreateLocks(),
+
+		revokeRetryBase: revokeRetryBase,
+		irrevocable:     make(map[string]*IrrevocableLease),
 	}
+	exp.pending = newLeaseScheduler(revokeWorkerCount, exp.expireID)
 	return exp
 }
 
@@ -109,6 +151,12 @@ func (c *Core) setupExpiration() error {
 	// Link the token store to this
 	c.tokenStore.SetExpirationManager(mgr)
 
+	// Leases are restored and expired by the active node
+	if c.perfStandby {
+		atomic.StoreInt32(&mgr.restoreMode, 0)
+		return nil
+	}
+
 	// Restore the existing state
 	c.logger.Info("expiration: restoring leases")
 	errorFunc := func() {
@@ -198,6 +246,11 @@ func (m *ExpirationManager) Tidy() error {
 		var isValid, ok bool
 		revokeLease := false
 		if le.ClientToken == "" {
+			// Leases created by orphan batch tokens have no token to be
+			// tied to and simply expire
+			if le.ClientTokenType == logical.TokenTypeBatch {
+				return
+			}
 			m.logger.Trace("expiration: revoking lease which has an empty token", "lease_id", leaseID)
 			revokeLease = true
 			deletedCountEmptyToken++
@@ -267,7 +320,9 @@ func (m *ExpirationManager) Tidy() error {
 }
 
 // Restore is used to recover the lease states when starting.
-// This is used after starting the vault.
+// This is used after starting the vault. Leases are restored in the
+// background by a pool of workers; until they are all loaded, leases used by
+// requests are restored on demand, so that requests can be served meanwhile.
 func (m *ExpirationManager) Restore(errorFunc func()) (retErr error) {
 	defer func() {
 		// Turn off restore mode. We can do this safely without the lock because
@@ -430,12 +485,7 @@ func (m *ExpirationManager) Stop() error {
 	m.logger.Debug("expiration: stop triggered")
 	defer m.logger.Debug("expiration: finished stopping")
 
-	m.pendingLock.Lock()
-	for _, timer := range m.pending {
-		timer.Stop()
-	}
-	m.pending = make(map[string]*time.Timer)
-	m.pendingLock.Unlock()
+	m.pending.stop()
 
 	close(m.quitCh)
 	if m.inRestoreMode() {
@@ -490,21 +540,17 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 	if err := m.deleteEntry(leaseID); err != nil {
 		return err
 	}
+	m.removeIrrevocable(leaseID)
 
 	// Delete the secondary index, but only if it's a leased secret (not auth)
-	if le.Secret != nil {
+	if le.Secret != nil && le.ClientToken != "" {
 		if err := m.removeIndexByToken(le.ClientToken, le.LeaseID); err != nil {
 			return err
 		}
 	}
 
 	// Clear the expiration handler
-	m.pendingLock.Lock()
-	if timer, ok := m.pending[leaseID]; ok {
-		timer.Stop()
-		delete(m.pending, leaseID)
-	}
-	m.pendingLock.Unlock()
+	m.pending.cancel(leaseID)
 	return nil
 }
 
@@ -778,6 +824,28 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 		return "", err
 	}
 
+	// Leases created with a batch token are tied to the token's parent,
+	// since the batch token itself is never persisted, and cannot outlive
+	// the batch token
+	clientToken := req.ClientToken
+	var clientTokenType logical.TokenType
+	if strings.HasPrefix(clientToken, batchTokenPrefix) {
+		te, err := m.tokenStore.Lookup(clientToken)
+		if err != nil {
+			return "", err
+		}
+		if te == nil {
+			return "", fmt.Errorf("expiration: cannot register a lease with an invalid batch token")
+		}
+		remaining := time.Unix(te.CreationTime, 0).Add(te.TTL).Sub(time.Now())
+		if resp.Secret.TTL == 0 || resp.Secret.TTL > remaining {
+			resp.Secret.TTL = remaining
+		}
+		resp.Secret.Renewable = false
+		clientToken = te.Parent
+		clientTokenType = logical.TokenTypeBatch
+	}
+
 	// Create a lease entry
 	leaseUUID, err := uuid.GenerateUUID()
 	if err != nil {
@@ -803,30 +871,35 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 				retErr = multierror.Append(retErr, errwrap.Wrapf("an additional error was encountered deleting any lease associated with the newly-generated secret: {{err}}", err))
 			}
 
-			if err := m.removeIndexByToken(req.ClientToken, leaseID); err != nil {
-				retErr = multierror.Append(retErr, errwrap.Wrapf("an additional error was encountered removing lease indexes associated with the newly-generated secret: {{err}}", err))
+			if clientToken != "" {
+				if err := m.removeIndexByToken(clientToken, leaseID); err != nil {
+					retErr = multierror.Append(retErr, errwrap.Wrapf("an additional error was encountered removing lease indexes associated with the newly-generated secret: {{err}}", err))
+				}
 			}
 		}
 	}()
 
 	le := leaseEntry{
-		LeaseID:     leaseID,
-		ClientToken: req.ClientToken,
-		Path:        req.Path,
-		Data:        resp.Data,
-		Secret:      resp.Secret,
-		IssueTime:   time.Now(),
-		ExpireTime:  resp.Secret.ExpirationTime(),
+		LeaseID:         leaseID,
+		ClientToken:     clientToken,
+		ClientTokenType: clientTokenType,
+		Path:            req.Path,
+		Data:            resp.Data,
+		Secret:          resp.Secret,
+		IssueTime:       time.Now(),
+		ExpireTime:      resp.Secret.ExpirationTime(),
 	}
 
 	// Encode the entry
-	if err := m.persistEntry(&le); err != nil {
+	if err := m.createEntry(&le); err != nil {
 		return "", err
 	}
 
 	// Maintain secondary index by token
-	if err := m.createIndexByToken(le.ClientToken, le.LeaseID); err != nil {
-		return "", err
+	if le.ClientToken != "" {
+		if err := m.createIndexByToken(le.ClientToken, le.LeaseID); err != nil {
+			return "", err
+		}
 	}
 
 	// Setup revocation timer if there is a lease
@@ -866,7 +939,7 @@ func (m *ExpirationManager) RegisterAuth(source string, auth *logical.Auth) erro
 	}
 
 	// Encode the entry
-	if err := m.persistEntry(&le); err != nil {
+	if err := m.createEntry(&le); err != nil {
 		return err
 	}
 
@@ -875,6 +948,79 @@ func (m *ExpirationManager) RegisterAuth(source string, auth *logical.Auth) erro
 	return nil
 }
 
+// CreateOrFetchRevocationLeaseByToken returns the ID of the auth lease of a
+// token. Tokens without a TTL have no lease, so one that does not expire is
+// created for them, which allows their revocation to be carried out by the
+// expiration manager like any other.
+func (m *ExpirationManager) CreateOrFetchRevocationLeaseByToken(te *TokenEntry) (string, error) {
+	if te.Path == "" {
+		return "", fmt.Errorf("expiration: cannot create a revocation lease for a token without a path")
+	}
+	if strings.Contains(te.Path, "..") {
+		return "", fmt.Errorf("expiration: %s", consts.ErrPathContainsParentReferences)
+	}
+
+	saltedID, err := m.tokenStore.SaltID(te.ID)
+	if err != nil {
+		return "", err
+	}
+	leaseID := path.Join(te.Path, saltedID)
+
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return "", err
+	}
+	if le != nil {
+		return leaseID, nil
+	}
+
+	le = &leaseEntry{
+		LeaseID:     leaseID,
+		ClientToken: te.ID,
+		Auth: &logical.Auth{
+			ClientToken: te.ID,
+			Accessor:    te.Accessor,
+			DisplayName: te.DisplayName,
+			Policies:    te.Policies,
+			Metadata:    te.Meta,
+		},
+		Path:      te.Path,
+		IssueTime: time.Now(),
+	}
+	if err := m.createEntry(le); err != nil {
+		return "", err
+	}
+	return leaseID, nil
+}
+
+// LazyRevoke marks a lease as expired so that it is revoked in the
+// background. As the expiration is persisted, the revocation is resumed
+// after a restart or on a new active node, and failed attempts are retried
+// like for any other expired lease.
+func (m *ExpirationManager) LazyRevoke(leaseID string) error {
+	defer metrics.MeasureSince([]string{"expire", "lazy-revoke"}, time.Now())
+
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil {
+		return nil
+	}
+
+	// An irrevocable lease is given another chance
+	le.ExpireTime = time.Now()
+	le.NextRevokeAttempt = time.Time{}
+	le.Irrevocable = false
+	if err := m.persistEntry(le); err != nil {
+		return err
+	}
+	m.removeIrrevocable(leaseID)
+
+	m.updatePending(le, 0)
+	return nil
+}
+
 // FetchLeaseTimesByToken is a helper function to use token values to compute
 // the leaseID, rather than pushing that logic back into the token store.
 func (m *ExpirationManager) FetchLeaseTimesByToken(source, token string) (*leaseEntry, error) {
@@ -908,6 +1054,9 @@ func (m *ExpirationManager) FetchLeaseTimes(leaseID string) (*leaseEntry, error)
 		IssueTime:       le.IssueTime,
 		ExpireTime:      le.ExpireTime,
 		LastRenewalTime: le.LastRenewalTime,
+		RevokeAttempts:  le.RevokeAttempts,
+		RevokeErr:       le.RevokeErr,
+		Irrevocable:     le.Irrevocable,
 	}
 	if le.Secret != nil {
 		ret.Secret = &logical.Secret{}
@@ -923,63 +1072,140 @@ func (m *ExpirationManager) FetchLeaseTimes(leaseID string) (*leaseEntry, error)
 	return ret, nil
 }
 
-// updatePending is used to update a pending invocation for a lease
+// updatePending is used to update a pending invocation for a lease. Only
+// the lease ID is kept by the scheduler, so the entry can be released.
 func (m *ExpirationManager) updatePending(le *leaseEntry, leaseTotal time.Duration) {
-	m.pendingLock.Lock()
-	defer m.pendingLock.Unlock()
-
-	// Check for an existing timer
-	timer, ok := m.pending[le.LeaseID]
-
-	// If there is no expiry time, don't do anything
-	if le.ExpireTime.IsZero() {
-		// if the timer happened to exist, stop the time and delete it from the
-		// pending timers.
-		if ok {
-			timer.Stop()
-			delete(m.pending, le.LeaseID)
+	// If there is no expiry time, or revocation has been given up on, don't
+	// do anything
+	if le.ExpireTime.IsZero() || le.Irrevocable {
+		// if the lease happened to be scheduled, remove it from the pending
+		// leases.
+		m.pending.cancel(le.LeaseID)
+		if le.Irrevocable {
+			m.addIrrevocable(le)
 		}
 		return
 	}
 
-	// Create entry if it does not exist
-	if !ok {
-		timer := time.AfterFunc(leaseTotal, func() {
-			m.expireID(le.LeaseID)
-		})
-		m.pending[le.LeaseID] = timer
-		return
+	// Leases whose revocation failed are retried on their own schedule
+	due := time.Now().Add(leaseTotal)
+	if !le.NextRevokeAttempt.IsZero() {
+		due = le.NextRevokeAttempt
 	}
-
-	// Extend the timer by the lease total
-	timer.Reset(leaseTotal)
+	m.pending.schedule(le.LeaseID, due)
 }
 
-// expireID is invoked when a given ID is expired
+// expireID is invoked by the scheduler's workers when a given ID is expired,
+// or when revocation of an expired lease is retried
 func (m *ExpirationManager) expireID(leaseID string) {
-	// Clear from the pending expiration
-	m.pendingLock.Lock()
-	delete(m.pending, leaseID)
-	m.pendingLock.Unlock()
+	select {
+	case <-m.quitCh:
+		m.logger.Error("expiration: shutting down, not attempting further revocation of lease", "lease_id", leaseID)
+		return
+	default:
+	}
 
-	for attempt := uint(0); attempt < maxRevokeAttempts; attempt++ {
-		select {
-		case <-m.quitCh:
-			m.logger.Error("expiration: shutting down, not attempting further revocation of lease", "lease_id", leaseID)
-			return
-		default:
+	err := m.Revoke(leaseID)
+	if err == nil {
+		if m.logger.IsInfo() {
+			m.logger.Info("expiration: revoked lease", "lease_id", leaseID)
 		}
-		err := m.Revoke(leaseID)
-		if err == nil {
-			if m.logger.IsInfo() {
-				m.logger.Info("expiration: revoked lease", "lease_id", leaseID)
-			}
-			return
+		return
+	}
+	m.logger.Error("expiration: failed to revoke lease", "lease_id", leaseID, "error", err)
+
+	if err := m.revokeFailed(leaseID, err); err != nil {
+		m.logger.Error("expiration: failed to schedule revocation retry", "lease_id", leaseID, "error", err)
+	}
+}
+
+// revokeFailed records a failed attempt to revoke an expired lease. The
+// attempt is persisted with the lease so that retries survive a restart.
+// The retry is scheduled with exponential backoff, until maxRevokeAttempts
+// attempts have failed and the lease is marked irrevocable.
+func (m *ExpirationManager) revokeFailed(leaseID string, revokeErr error) error {
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil {
+		return nil
+	}
+
+	le.RevokeAttempts++
+	le.RevokeErr = revokeErr.Error()
+	le.NextRevokeAttempt = time.Time{}
+
+	if le.RevokeAttempts >= maxRevokeAttempts {
+		le.Irrevocable = true
+		m.logger.Error("expiration: maximum revoke attempts reached, marking lease irrevocable", "lease_id", leaseID)
+		metrics.IncrCounter([]string{"expire", "irrevocable"}, 1)
+	} else {
+		backoff := (1 << uint(le.RevokeAttempts-1)) * m.revokeRetryBase
+		le.NextRevokeAttempt = time.Now().Add(backoff)
+		metrics.IncrCounter([]string{"expire", "revoke-retry"}, 1)
+	}
+
+	if err := m.persistEntry(le); err != nil {
+		return err
+	}
+	m.updatePending(le, 0)
+	return nil
+}
+
+// addIrrevocable records a lease as irrevocable
+func (m *ExpirationManager) addIrrevocable(le *leaseEntry) {
+	m.irrevocableLock.Lock()
+	defer m.irrevocableLock.Unlock()
+
+	m.irrevocable[le.LeaseID] = &IrrevocableLease{
+		LeaseID:        le.LeaseID,
+		ExpireTime:     le.ExpireTime,
+		RevokeAttempts: le.RevokeAttempts,
+		RevokeErr:      le.RevokeErr,
+	}
+}
+
+// removeIrrevocable forgets an irrevocable lease once it has been revoked
+func (m *ExpirationManager) removeIrrevocable(leaseID string) {
+	m.irrevocableLock.Lock()
+	defer m.irrevocableLock.Unlock()
+
+	delete(m.irrevocable, leaseID)
+}
+
+// IrrevocableLeases returns the irrevocable leases whose ID starts with the
+// prefix, sorted by lease ID. Until the leases are restored after
+// unsealing, only the leases loaded so far are returned.
+func (m *ExpirationManager) IrrevocableLeases(prefix string) []*IrrevocableLease {
+	m.irrevocableLock.RLock()
+	defer m.irrevocableLock.RUnlock()
+
+	leases := make([]*IrrevocableLease, 0, len(m.irrevocable))
+	for leaseID, lease := range m.irrevocable {
+		if strings.HasPrefix(leaseID, prefix) {
+			ret := *lease
+			leases = append(leases, &ret)
 		}
-		m.logger.Error("expiration: failed to revoke lease", "lease_id", leaseID, "error", err)
-		time.Sleep((1 << attempt) * revokeRetryBase)
 	}
-	m.logger.Error("expiration: maximum revoke attempts reached", "lease_id", leaseID)
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].LeaseID < leases[j].LeaseID
+	})
+	return leases
+}
+
+// LeaseCounts returns the number of outstanding leases of each mount, by
+// mount point. Until the leases are restored after unsealing, only the leases
+// loaded so far are counted.
+func (m *ExpirationManager) LeaseCounts() map[string]int64 {
+	m.leaseCountLock.Lock()
+	defer m.leaseCountLock.Unlock()
+
+	counts := make(map[string]int64, len(m.leaseCounts))
+	for mountPoint, count := range m.leaseCounts {
+		counts[mountPoint] = count
+	}
+	return counts
 }
 
 // revokeEntry is used to attempt revocation of an internal entry
@@ -1082,8 +1308,13 @@ func (m *ExpirationManager) loadEntryInternal(leaseID string, restoreMode bool,
 		}
 
 		// Update the cache of restored leases, either synchronously or through
-		// the lazy loaded restore process
-		m.restoreLoaded.Store(le.LeaseID, struct{}{})
+		// the lazy loaded restore process. A lease created since the restore
+		// started has been counted and scheduled already.
+		_, loaded := m.restoreLoaded.LoadOrStore(le.LeaseID, struct{}{})
+		if loaded {
+			return le, nil
+		}
+		m.trackLease(le.LeaseID)
 
 		// Setup revocation timer
 		m.updatePending(le, le.ExpireTime.Sub(time.Now()))
@@ -1091,6 +1322,132 @@ func (m *ExpirationManager) loadEntryInternal(leaseID string, restoreMode bool,
 	return le, nil
 }
 
+// trackLease counts a lease as outstanding in its mount and in the lease
+// count quotas it falls under. Callers must make sure that each lease is only
+// counted once.
+func (m *ExpirationManager) trackLease(leaseID string) {
+	m.leaseCountLock.Lock()
+	defer m.leaseCountLock.Unlock()
+
+	m.leaseCounts[m.router.MatchingMount(leaseID)]++
+
+	for quota := range m.leaseCountQuotas {
+		if !quotaPathMatches(quota.Path, leaseID) {
+			continue
+		}
+		if quota.pending != nil {
+			quota.pending[leaseID] = true
+			continue
+		}
+		atomic.AddInt64(&quota.count, 1)
+	}
+}
+
+// untrackLease stops counting a lease counted by trackLease
+func (m *ExpirationManager) untrackLease(leaseID string) {
+	m.leaseCountLock.Lock()
+	defer m.leaseCountLock.Unlock()
+
+	mountPoint := m.router.MatchingMount(leaseID)
+	switch count := m.leaseCounts[mountPoint]; {
+	case count > 1:
+		m.leaseCounts[mountPoint] = count - 1
+	default:
+		delete(m.leaseCounts, mountPoint)
+	}
+
+	for quota := range m.leaseCountQuotas {
+		if !quotaPathMatches(quota.Path, leaseID) {
+			continue
+		}
+		if quota.pending != nil {
+			quota.pending[leaseID] = false
+			continue
+		}
+		atomic.AddInt64(&quota.count, -1)
+	}
+}
+
+// addLeaseCountQuota starts keeping the count of a lease count quota up to
+// date, starting from the leases in storage under its path. Leases are
+// created and deleted as usual while storage is scanned: the quota records
+// them meanwhile, and they are applied to the leases found once the scan is
+// done. Until the leases are restored after unsealing, only the leases loaded
+// so far are counted; the others are counted as they are loaded.
+func (m *ExpirationManager) addLeaseCountQuota(quota *leaseCountQuota) error {
+	m.leaseCountLock.Lock()
+	quota.pending = make(map[string]bool)
+	m.leaseCountQuotas[quota] = struct{}{}
+	m.leaseCountLock.Unlock()
+
+	// The quota path need not end with a slash, so the keys under the
+	// directory holding it are filtered
+	dir := quota.Path[:strings.LastIndex(quota.Path, "/")+1]
+	found := make(map[string]struct{})
+	err := logical.ScanView(m.idView.SubView(dir), func(key string) {
+		leaseID := dir + key
+		if !quotaPathMatches(quota.Path, leaseID) {
+			return
+		}
+
+		m.restoreModeLock.RLock()
+		loaded := true
+		if m.inRestoreMode() {
+			_, loaded = m.restoreLoaded.Load(leaseID)
+		}
+		m.restoreModeLock.RUnlock()
+		if loaded {
+			found[leaseID] = struct{}{}
+		}
+	})
+
+	m.leaseCountLock.Lock()
+	defer m.leaseCountLock.Unlock()
+	if err != nil {
+		delete(m.leaseCountQuotas, quota)
+		return fmt.Errorf("failed to count the leases under %q: %v", quota.Path, err)
+	}
+
+	for leaseID, tracked := range quota.pending {
+		if tracked {
+			found[leaseID] = struct{}{}
+		} else {
+			delete(found, leaseID)
+		}
+	}
+	quota.pending = nil
+	atomic.StoreInt64(&quota.count, int64(len(found)))
+	return nil
+}
+
+// removeLeaseCountQuota stops keeping the count of a lease count quota
+func (m *ExpirationManager) removeLeaseCountQuota(quota *leaseCountQuota) {
+	m.leaseCountLock.Lock()
+	defer m.leaseCountLock.Unlock()
+
+	delete(m.leaseCountQuotas, quota)
+}
+
+// createEntry persists a new lease entry and counts it. While leases are
+// being restored it is marked as loaded, so that the restore does not count
+// it a second time.
+func (m *ExpirationManager) createEntry(le *leaseEntry) error {
+	m.restoreModeLock.RLock()
+	defer m.restoreModeLock.RUnlock()
+
+	if err := m.persistEntry(le); err != nil {
+		return err
+	}
+
+	if m.inRestoreMode() {
+		if _, loaded := m.restoreLoaded.LoadOrStore(le.LeaseID, struct{}{}); loaded {
+			return nil
+		}
+	}
+	m.trackLease(le.LeaseID)
+	return nil
+}
+
 // persistEntry is used to persist a lease entry
 func (m *ExpirationManager) persistEntry(le *leaseEntry) error {
 	// Encode the entry
@@ -1110,11 +1467,23 @@ func (m *ExpirationManager) persistEntry(le *leaseEntry) error {
 	return nil
 }
 
-// deleteEntry is used to delete a lease entry
+// deleteEntry is used to delete a lease entry, and stops counting it if it
+// existed
 func (m *ExpirationManager) deleteEntry(leaseID string) error {
+	lock := locksutil.LockForKey(m.leaseDeleteLocks, leaseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	existing, err := m.idView.Get(leaseID)
+	if err != nil {
+		return fmt.Errorf("failed to read lease entry: %v", err)
+	}
 	if err := m.idView.Delete(leaseID); err != nil {
 		return fmt.Errorf("failed to delete lease entry: %v", err)
 	}
+	if existing != nil {
+		m.untrackLease(leaseID)
+	}
 	return nil
 }
 
@@ -1210,9 +1579,7 @@ func (m *ExpirationManager) lookupByToken(token string) ([]string, error) {
 
 // emitMetrics is invoked periodically to emit statistics
 func (m *ExpirationManager) emitMetrics() {
-	m.pendingLock.RLock()
-	num := len(m.pending)
-	m.pendingLock.RUnlock()
+	num := m.pending.len()
 	metrics.SetGauge([]string{"expire", "num_leases"}, float32(num))
 }
 
@@ -1228,6 +1595,22 @@ type leaseEntry struct {
 	IssueTime       time.Time              `json:"issue_time"`
 	ExpireTime      time.Time              `json:"expire_time"`
 	LastRenewalTime time.Time              `json:"last_renewal_time"`
+
+	// ClientTokenType is the type of the token that created the lease. For
+	// batch tokens, ClientToken is the batch token's parent.
+	ClientTokenType logical.TokenType `json:"client_token_type"`
+
+	// RevokeAttempts is the number of failed attempts to revoke the lease
+	// after it expired and RevokeErr the error of the last one
+	RevokeAttempts int    `json:"revoke_attempts"`
+	RevokeErr      string `json:"revoke_err"`
+
+	// NextRevokeAttempt is when revocation of the lease will be retried
+	NextRevokeAttempt time.Time `json:"next_revoke_attempt"`
+
+	// Irrevocable is set once maxRevokeAttempts attempts to revoke the lease
+	// have failed, after which revocation is no longer retried
+	Irrevocable bool `json:"irrevocable"`
 }
 
 // encode is used to JSON encode the lease entry
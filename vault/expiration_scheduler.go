@@ -0,0 +1,241 @@
+package vault
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// leaseScheduler schedules the revocation of leases when they expire.
+// Rather than keeping a timer per lease, leases are kept in a heap ordered
+// by the time they are due. A single dispatcher waits for the earliest one
+// and hands due leases to a bounded pool of workers, so that the number of
+// concurrent revocations is limited and only the lease ID and due time are
+// kept in memory for each lease.
+type leaseScheduler struct {
+	l sync.Mutex
+
+	// queue holds the scheduled leases ordered by due time, and leases
+	// indexes them by lease ID
+	queue  leaseQueue
+	leases map[string]*scheduledLease
+
+	// wakeCh wakes up the dispatcher when the earliest lease changes
+	wakeCh chan struct{}
+
+	// workCh hands due leases to the workers
+	workCh chan string
+
+	quitCh   chan struct{}
+	stopOnce sync.Once
+
+	// expire is invoked by the workers for every due lease
+	expire func(leaseID string)
+}
+
+// scheduledLease is a lease waiting in the scheduler
+type scheduledLease struct {
+	leaseID string
+	due     time.Time
+
+	// index is the position of the lease in the heap
+	index int
+}
+
+// newLeaseScheduler creates a scheduler invoking expire for due leases from
+// the given number of workers and starts it
+func newLeaseScheduler(workers int, expire func(leaseID string)) *leaseScheduler {
+	s := &leaseScheduler{
+		leases: make(map[string]*scheduledLease),
+		wakeCh: make(chan struct{}, 1),
+		workCh: make(chan string),
+		quitCh: make(chan struct{}),
+		expire: expire,
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	go s.dispatch()
+
+	return s
+}
+
+// schedule schedules a lease to expire at the due time, replacing any
+// previous schedule of the lease
+func (s *leaseScheduler) schedule(leaseID string, due time.Time) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if lease, ok := s.leases[leaseID]; ok {
+		lease.due = due
+		heap.Fix(&s.queue, lease.index)
+	} else {
+		lease = &scheduledLease{
+			leaseID: leaseID,
+			due:     due,
+		}
+		heap.Push(&s.queue, lease)
+		s.leases[leaseID] = lease
+	}
+
+	// Only the dispatcher needs to know if the earliest lease changed
+	if s.queue[0].leaseID == leaseID {
+		s.wake()
+	}
+}
+
+// cancel removes a lease from the scheduler, returning whether it was
+// scheduled
+func (s *leaseScheduler) cancel(leaseID string) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	lease, ok := s.leases[leaseID]
+	if !ok {
+		return false
+	}
+	heap.Remove(&s.queue, lease.index)
+	delete(s.leases, leaseID)
+	return true
+}
+
+// scheduled returns the time a lease is due, if it is scheduled
+func (s *leaseScheduler) scheduled(leaseID string) (time.Time, bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	lease, ok := s.leases[leaseID]
+	if !ok {
+		return time.Time{}, false
+	}
+	return lease.due, true
+}
+
+// len returns the number of scheduled leases
+func (s *leaseScheduler) len() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return len(s.queue)
+}
+
+// stop stops dispatching leases and drops the scheduled ones. Revocations
+// that are in progress are not waited for.
+func (s *leaseScheduler) stop() {
+	s.stopOnce.Do(func() {
+		close(s.quitCh)
+	})
+
+	s.l.Lock()
+	s.queue = nil
+	s.leases = make(map[string]*scheduledLease)
+	s.l.Unlock()
+}
+
+// wake wakes up the dispatcher without blocking. The caller must hold the
+// lock.
+func (s *leaseScheduler) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the earliest lease if it is due. Otherwise it returns how long
+// to wait for it, or a negative duration if no lease is scheduled.
+func (s *leaseScheduler) next(now time.Time) (string, time.Duration) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if len(s.queue) == 0 {
+		return "", -1
+	}
+	lease := s.queue[0]
+	if wait := lease.due.Sub(now); wait > 0 {
+		return "", wait
+	}
+	heap.Pop(&s.queue)
+	delete(s.leases, lease.leaseID)
+	return lease.leaseID, 0
+}
+
+// dispatch hands due leases to the workers, blocking while all of them are
+// busy
+func (s *leaseScheduler) dispatch() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		leaseID, wait := s.next(time.Now())
+		if leaseID != "" {
+			select {
+			case s.workCh <- leaseID:
+			case <-s.quitCh:
+				return
+			}
+			continue
+		}
+
+		// Wait for the earliest lease to be due or for the schedule to change
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var timerCh <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			timerCh = timer.C
+		}
+
+		select {
+		case <-timerCh:
+		case <-s.wakeCh:
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// work expires the leases handed by the dispatcher
+func (s *leaseScheduler) work() {
+	for {
+		select {
+		case leaseID := <-s.workCh:
+			s.expire(leaseID)
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// leaseQueue implements heap.Interface, ordering leases by due time
+type leaseQueue []*scheduledLease
+
+func (q leaseQueue) Len() int { return len(q) }
+
+func (q leaseQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q leaseQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *leaseQueue) Push(x interface{}) {
+	lease := x.(*scheduledLease)
+	lease.index = len(*q)
+	*q = append(*q, lease)
+}
+
+func (q *leaseQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	lease := old[n-1]
+	old[n-1] = nil
+	lease.index = -1
+	*q = old[:n-1]
+	return lease
+}
@@ -0,0 +1,209 @@
+package vault
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLeaseScheduler_Order(t *testing.T) {
+	expired := make(chan string, 3)
+	s := newLeaseScheduler(1, func(leaseID string) {
+		expired <- leaseID
+	})
+	defer s.stop()
+
+	now := time.Now()
+	s.schedule("c", now.Add(30*time.Millisecond))
+	s.schedule("a", now.Add(10*time.Millisecond))
+	s.schedule("b", now.Add(20*time.Millisecond))
+
+	for _, expected := range []string{"a", "b", "c"} {
+		select {
+		case leaseID := <-expired:
+			if leaseID != expected {
+				t.Fatalf("expected %q to expire, got %q", expected, leaseID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+	if s.len() != 0 {
+		t.Fatalf("bad: %d leases still scheduled", s.len())
+	}
+}
+
+func TestLeaseScheduler_RescheduleCancel(t *testing.T) {
+	expired := make(chan string, 3)
+	s := newLeaseScheduler(1, func(leaseID string) {
+		expired <- leaseID
+	})
+	defer s.stop()
+
+	now := time.Now()
+	s.schedule("a", now.Add(10*time.Millisecond))
+	s.schedule("b", now.Add(20*time.Millisecond))
+
+	// Extend a and cancel b
+	later := now.Add(time.Hour)
+	s.schedule("a", later)
+	if !s.cancel("b") {
+		t.Fatalf("expected b to be scheduled")
+	}
+	if s.cancel("b") {
+		t.Fatalf("expected b to be cancelled")
+	}
+
+	select {
+	case leaseID := <-expired:
+		t.Fatalf("unexpected expiration of %q", leaseID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	due, ok := s.scheduled("a")
+	if !ok || !due.Equal(later) || s.len() != 1 {
+		t.Fatalf("bad: %s %t %d", due, ok, s.len())
+	}
+
+	// Bringing a lease forward wakes up the scheduler
+	s.schedule("a", time.Now())
+	select {
+	case leaseID := <-expired:
+		if leaseID != "a" {
+			t.Fatalf("bad: %q", leaseID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a")
+	}
+}
+
+func TestLeaseScheduler_Workers(t *testing.T) {
+	var running, maxRunning int32
+	release := make(chan struct{})
+	done := make(chan struct{}, 10)
+	s := newLeaseScheduler(2, func(leaseID string) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		done <- struct{}{}
+	})
+	defer s.stop()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		s.schedule(fmt.Sprintf("lease-%d", i), now)
+	}
+
+	// Only two leases can be revoked at a time
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&running); n != 2 {
+		t.Fatalf("expected 2 running revocations, got %d", n)
+	}
+
+	close(release)
+	for i := 0; i < 10; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for revocations")
+		}
+	}
+	if max := atomic.LoadInt32(&maxRunning); max != 2 {
+		t.Fatalf("expected at most 2 concurrent revocations, got %d", max)
+	}
+}
+
+func TestLeaseScheduler_Stop(t *testing.T) {
+	var count int32
+	s := newLeaseScheduler(1, func(leaseID string) {
+		atomic.AddInt32(&count, 1)
+	})
+
+	s.schedule("a", time.Now().Add(20*time.Millisecond))
+	s.stop()
+	s.stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&count) != 0 || s.len() != 0 {
+		t.Fatalf("leases expired after stopping")
+	}
+}
+
+// The following benchmarks compare scheduling leases with the scheduler to
+// the timer per lease it replaces
+
+func BenchmarkLeaseScheduler_Schedule(b *testing.B) {
+	s := newLeaseScheduler(revokeWorkerCount, func(string) {})
+	defer s.stop()
+
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.schedule(fmt.Sprintf("lease-%d", i), now.Add(time.Hour+time.Duration(i%3600)*time.Second))
+	}
+}
+
+func BenchmarkLeaseScheduler_Timers(b *testing.B) {
+	var l sync.Mutex
+	pending := make(map[string]*time.Timer)
+	defer func() {
+		for _, timer := range pending {
+			timer.Stop()
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		leaseID := fmt.Sprintf("lease-%d", i)
+		le := &leaseEntry{LeaseID: leaseID}
+		l.Lock()
+		pending[leaseID] = time.AfterFunc(time.Hour+time.Duration(i%3600)*time.Second, func() {
+			_ = le.LeaseID
+		})
+		l.Unlock()
+	}
+}
+
+func BenchmarkLeaseScheduler_Reschedule(b *testing.B) {
+	s := newLeaseScheduler(revokeWorkerCount, func(string) {})
+	defer s.stop()
+
+	now := time.Now()
+	const leases = 100000
+	for i := 0; i < leases; i++ {
+		s.schedule(fmt.Sprintf("lease-%d", i), now.Add(time.Hour))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.schedule(fmt.Sprintf("lease-%d", i%leases), now.Add(time.Hour+time.Duration(i)*time.Millisecond))
+	}
+}
+
+func BenchmarkLeaseScheduler_Expire(b *testing.B) {
+	var wg sync.WaitGroup
+	s := newLeaseScheduler(revokeWorkerCount, func(string) {
+		wg.Done()
+	})
+	defer s.stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	wg.Add(b.N)
+	now := time.Now()
+	for i := 0; i < b.N; i++ {
+		s.schedule(fmt.Sprintf("lease-%d", i), now)
+	}
+	wg.Wait()
+}
@@ -1478,3 +1478,157 @@ func badRenewFactory(conf *logical.BackendConfig) (logical.Backend, error) {
 
 	return be, nil
 }
+
+func TestExpiration_Irrevocable(t *testing.T) {
+	core, _, _, root := TestCoreWithTokenStore(t)
+	core.expiration.revokeRetryBase = 5 * time.Millisecond
+
+	core.logicalBackends["badrenew"] = badRenewFactory
+	me := &MountEntry{
+		Table:    mountTableType,
+		Path:     "badrenew/",
+		Type:     "badrenew",
+		Accessor: "badrenewaccessor",
+	}
+	if err := core.mount(me); err != nil {
+		t.Fatal(err)
+	}
+
+	// Register a lease that expires right away and can never be revoked
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "badrenew/creds",
+		ClientToken: root,
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: 10 * time.Millisecond,
+			},
+			InternalData: map[string]interface{}{
+				"secret_type": "badRenewBackend",
+			},
+		},
+	}
+	leaseID, err := core.expiration.Register(req, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for len(core.expiration.IrrevocableLeases("")) == 0 {
+		if time.Now().Sub(start) > 10*time.Second {
+			t.Fatalf("lease was not marked irrevocable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The failed attempts are persisted with the lease
+	le, err := core.expiration.loadEntry(leaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !le.Irrevocable || le.RevokeAttempts != maxRevokeAttempts || le.RevokeErr == "" {
+		t.Fatalf("bad: %#v", le)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/leases/irrevocable/badrenew/")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	leases := resp.Data["leases"].([]map[string]interface{})
+	if len(leases) != 1 || leases[0]["lease_id"] != leaseID || leases[0]["mount"] != "badrenew/" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if !strings.Contains(leases[0]["error"].(string), "always errors") {
+		t.Fatalf("bad: %#v", leases[0])
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/leases/irrevocable/secret/")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["lease_count"] != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/leases/count")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["irrevocable_lease_count"] != 1 || resp.Data["irrevocable_counts"].(map[string]int)["badrenew/"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["counts"].(map[string]int)["badrenew/"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Forcing revocation clears it
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/leases/revoke-force/badrenew/creds")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if leases := core.expiration.IrrevocableLeases(""); len(leases) != 0 {
+		t.Fatalf("bad: %#v", leases)
+	}
+}
+
+func TestExpiration_Irrevocable_Restore(t *testing.T) {
+	c, ts, _, _ := TestCoreWithTokenStore(t)
+	exp := c.expiration
+
+	now := time.Now()
+	irrevocable := &leaseEntry{
+		LeaseID:        "prod/aws/irrevocable",
+		Path:           "prod/aws/irrevocable",
+		Secret:         &logical.Secret{},
+		IssueTime:      now.Add(-time.Hour),
+		ExpireTime:     now.Add(-time.Minute),
+		RevokeAttempts: maxRevokeAttempts,
+		RevokeErr:      "backend unavailable",
+		Irrevocable:    true,
+	}
+	retrying := &leaseEntry{
+		LeaseID:           "prod/aws/retrying",
+		Path:              "prod/aws/retrying",
+		Secret:            &logical.Secret{},
+		IssueTime:         now.Add(-time.Hour),
+		ExpireTime:        now.Add(-time.Minute),
+		RevokeAttempts:    1,
+		RevokeErr:         "backend unavailable",
+		NextRevokeAttempt: now.Add(time.Hour),
+	}
+	for _, le := range []*leaseEntry{irrevocable, retrying} {
+		if err := exp.persistEntry(le); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Restore the leases in a new expiration manager
+	exp = NewExpirationManager(c.router, c.systemBarrierView.SubView(expirationSubPath), ts, c.logger)
+	if err := exp.Restore(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Stop()
+
+	leases := exp.IrrevocableLeases("")
+	if len(leases) != 1 || leases[0].LeaseID != irrevocable.LeaseID || leases[0].RevokeErr != "backend unavailable" {
+		t.Fatalf("bad: %#v", leases)
+	}
+
+	// The irrevocable lease is no longer retried, while the other one is
+	// retried when scheduled
+	_, irrevocablePending := exp.pending.scheduled(irrevocable.LeaseID)
+	_, retryingPending := exp.pending.scheduled(retrying.LeaseID)
+	if irrevocablePending || !retryingPending {
+		t.Fatalf("bad: irrevocable pending %t, retrying pending %t", irrevocablePending, retryingPending)
+	}
+}
@@ -1,16 +1,20 @@
 package vault
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fatih/structs"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/wrapping"
 	"github.com/hashicorp/vault/logical"
@@ -30,16 +34,126 @@ var (
 			&framework.Path{
 				Pattern: "replication/status",
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-						var state consts.ReplicationState
-						resp := &logical.Response{
-							Data: map[string]interface{}{
-								"mode": state.String(),
-							},
-						}
-						return resp, nil
+					logical.ReadOperation: b.handleReplicationStatus,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/primary/enable",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationPrimaryEnable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-primary-enable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-primary-enable"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/primary/secondary-token",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["replication-secondary-id"][0]),
+					},
+					"ttl": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Default:     int(replicationDefaultTokenTTL.Seconds()),
+						Description: strings.TrimSpace(sysHelp["replication-token-ttl"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationSecondaryToken,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-secondary-token"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-secondary-token"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/primary/revoke-secondary",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["replication-secondary-id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationRevokeSecondary,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-revoke-secondary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-revoke-secondary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/secondary/enable",
+
+				Fields: map[string]*framework.FieldSchema{
+					"token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["replication-activation-token"][0]),
+					},
+					"primary_cluster_addr": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["replication-primary-cluster-addr"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationSecondaryEnable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-secondary-enable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-secondary-enable"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/secondary/update-primary",
+
+				Fields: map[string]*framework.FieldSchema{
+					"token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["replication-activation-token"][0]),
 					},
+					"primary_cluster_addr": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["replication-primary-cluster-addr"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationUpdatePrimary,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-update-primary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-update-primary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/secondary/promote",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationPromote,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-promote"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-promote"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/reindex",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationReindex,
 				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-reindex"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-reindex"][1]),
 			},
 		}
 	}
@@ -61,7 +175,12 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				"audit/*",
 				"raw",
 				"raw/*",
+				"replication/primary/enable",
 				"replication/primary/secondary-token",
+				"replication/primary/revoke-secondary",
+				"replication/secondary/enable",
+				"replication/secondary/update-primary",
+				"replication/secondary/promote",
 				"replication/reindex",
 				"rotate",
 				"config/cors",
@@ -72,6 +191,16 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				"leases/revoke-prefix/*",
 				"leases/revoke-force/*",
 				"leases/lookup/*",
+				"leases/irrevocable",
+				"leases/irrevocable/*",
+				"loggers",
+				"loggers/*",
+				"monitor",
+				"pprof",
+				"pprof/*",
+				"host-info",
+				"config/state/sanitized",
+				"in-flight-req",
 			},
 
 			Unauthenticated: []string{
@@ -468,6 +597,191 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				HelpDescription: strings.TrimSpace(sysHelp["revoke-prefix"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "leases/irrevocable(/(?P<prefix>.+))?",
+
+				Fields: map[string]*framework.FieldSchema{
+					"prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["leases-irrevocable-prefix"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLeasesIrrevocable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-irrevocable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-irrevocable"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/count$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLeasesCount,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-count"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-count"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "metrics$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"format": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Format to export metrics into, either \"json\" (the default) or \"prometheus\".",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleMetrics,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["metrics"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["metrics"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "loggers$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"level": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Log level: one of trace, debug, info, notice, warn or err.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLoggersRead,
+					logical.UpdateOperation: b.handleLoggersUpdate,
+					logical.DeleteOperation: b.handleLoggersDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["loggers"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["loggers"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "loggers/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the subsystem, such as \"core\" or \"physical/consul\".",
+					},
+					"level": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Log level: one of trace, debug, info, notice, warn or err.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLoggerRead,
+					logical.UpdateOperation: b.handleLoggerUpdate,
+					logical.DeleteOperation: b.handleLoggerDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["logger"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["logger"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "pprof/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handlePprofIndex,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["pprof"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["pprof"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "pprof/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the profile, such as \"goroutine\", \"heap\" or \"profile\" for the CPU profile.",
+					},
+					"seconds": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "How long the CPU profile or the trace runs for. Defaults to 30 seconds for the CPU profile and 1 second for the trace.",
+					},
+					"debug": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "If greater than 0, the profile is returned as text rather than in the protobuf format; 2 dumps the full stack of each goroutine.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handlePprof,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["pprof"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["pprof"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "host-info$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleHostInfo,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["host-info"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["host-info"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "in-flight-req$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleInFlightRequests,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["in-flight-req"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["in-flight-req"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "config/state/sanitized$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleConfigStateSanitized,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["config/state/sanitized"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["config/state/sanitized"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "monitor$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"log_level": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     "info",
+						Description: "Least severe level of the streamed logs: one of trace, debug, info, notice, warn or err.",
+					},
+					"log_format": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     "standard",
+						Description: "Format of the streamed logs, either \"standard\" or \"json\".",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleMonitor,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["monitor"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["monitor"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "leases/tidy$",
 
@@ -753,91 +1067,434 @@ func NewSystemBackend(core *Core) *SystemBackend {
 			},
 
 			&framework.Path{
-				Pattern: "config/auditing/request-headers/(?P<header>.+)",
+				Pattern: "control-group/authorize$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"header": &framework.FieldSchema{
-						Type: framework.TypeString,
-					},
-					"hmac": &framework.FieldSchema{
-						Type: framework.TypeBool,
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control-group-accessor"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleAuditedHeaderUpdate,
-					logical.DeleteOperation: b.handleAuditedHeaderDelete,
-					logical.ReadOperation:   b.handleAuditedHeaderRead,
+					logical.UpdateOperation: b.handleControlGroupAuthorize,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audited-headers-name"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audited-headers-name"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-authorize"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-authorize"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "config/auditing/request-headers$",
+				Pattern: "control-group/request$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control-group-accessor"][0]),
+					},
+				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handleAuditedHeadersRead,
+					logical.UpdateOperation: b.handleControlGroupRequest,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audited-headers"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audited-headers"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-request"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-request"][1]),
 			},
-			&framework.Path{
-				Pattern: "plugins/catalog/?$",
 
-				Fields: map[string]*framework.FieldSchema{},
+			&framework.Path{
+				Pattern: "mfa/method/?$",
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ListOperation: b.handlePluginCatalogList,
+					logical.ListOperation: b.handleMFAMethodList,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["plugin-catalog"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["plugin-catalog"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-method-list"][1]),
 			},
+
 			&framework.Path{
-				Pattern: "plugins/catalog/(?P<name>.+)",
+				Pattern: "mfa/method/(?P<type>" + strings.Join(mfaMethodTypes, "|") + ")/" + framework.GenericNameRegex("name") + "$",
 
 				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa-method-type"][0]),
+					},
 					"name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["plugin-catalog_name"][0]),
+						Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
 					},
-					"sha256": &framework.FieldSchema{
+					"mount_accessor": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["plugin-catalog_sha-256"][0]),
+						Description: "The mount accessor of the auth method whose alias is used in the username format. Required for push based methods.",
 					},
-					"sha_256": &framework.FieldSchema{
+					"username_format": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["plugin-catalog_sha-256"][0]),
+						Description: "The format of the username sent to the push provider, for example \"{{alias.name}}@example.com\". Defaults to the alias name.",
 					},
-					"command": &framework.FieldSchema{
+					"issuer": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["plugin-catalog_command"][0]),
+						Description: "The name of the issuer of the TOTP keys.",
 					},
-				},
-
-				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handlePluginCatalogUpdate,
-					logical.DeleteOperation: b.handlePluginCatalogDelete,
-					logical.ReadOperation:   b.handlePluginCatalogRead,
-				},
-
-				HelpSynopsis:    strings.TrimSpace(sysHelp["plugin-catalog"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["plugin-catalog"][1]),
-			},
-			&framework.Path{
-				Pattern: "plugins/reload/backend$",
-
-				Fields: map[string]*framework.FieldSchema{
-					"plugin": &framework.FieldSchema{
+					"period": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Default:     30,
+						Description: "The number of seconds a TOTP passcode is valid for.",
+					},
+					"key_size": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     20,
+						Description: "The size in bytes of the generated TOTP keys.",
+					},
+					"digits": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     6,
+						Description: "The number of digits of a TOTP passcode, either 6 or 8.",
+					},
+					"algorithm": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["plugin-backend-reload-plugin"][0]),
+						Default:     "SHA1",
+						Description: "The hashing algorithm of the TOTP keys, one of SHA1, SHA256 or SHA512.",
 					},
-					"mounts": &framework.FieldSchema{
-						Type:        framework.TypeCommaStringSlice,
-						Description: strings.TrimSpace(sysHelp["plugin-backend-reload-mounts"][0]),
+					"skew": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     1,
+						Description: "The number of periods before or after the current one in which a TOTP passcode is accepted, either 0 or 1.",
+					},
+					"qr_size": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     200,
+						Description: "The pixel size of the generated square QR code.",
+					},
+					"integration_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Duo integration key.",
+					},
+					"secret_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Duo secret key.",
+					},
+					"api_hostname": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Duo API hostname.",
+					},
+					"push_info": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "URL-encoded key/value pairs shown in the Duo Mobile app.",
+					},
+					"org_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the Okta organization.",
+					},
+					"api_token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Okta API token.",
+					},
+					"base_url": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Okta base domain, for example \"okta-emea.com\". A full URL is used as is.",
+					},
+					"production": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Default:     true,
+						Description: "If no base URL is set, use \"okta.com\" when true and \"oktapreview.com\" when false.",
+					},
+					"settings_file_base64": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The base64 encoded contents of the PingID settings file.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFAMethodRead,
+					logical.UpdateOperation: b.handleMFAMethodUpdate,
+					logical.DeleteOperation: b.handleMFAMethodDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-method"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/generate$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFATOTPGenerate,
+					logical.UpdateOperation: b.handleMFATOTPGenerate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-generate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-generate"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-generate$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
+					},
+					"entity_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa-entity-id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPAdminGenerate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-admin-generate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-admin-generate"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-destroy$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
+					},
+					"entity_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa-entity-id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPAdminDestroy,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-admin-destroy"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-admin-destroy"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/login-enforcement/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleMFALoginEnforcementList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-login-enforcement-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-login-enforcement-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/login-enforcement/" + framework.GenericNameRegex("name") + "$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the login enforcement.",
+					},
+					"mfa_method_names": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The names of the MFA methods that must be validated.",
+					},
+					"auth_method_accessors": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The mount accessors of the auth methods the enforcement applies to.",
+					},
+					"auth_method_types": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The types of the auth methods the enforcement applies to.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFALoginEnforcementRead,
+					logical.UpdateOperation: b.handleMFALoginEnforcementUpdate,
+					logical.DeleteOperation: b.handleMFALoginEnforcementDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-login-enforcement"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-login-enforcement"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/rate-limit/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleRateLimitQuotasList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rate-limit-quota-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rate-limit-quota-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/rate-limit/" + framework.GenericNameRegex("name") + "$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the quota.",
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The mount or path prefix the quota applies to. Applies to all requests outside of sys/ if empty.",
+					},
+					"rate": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "The number of requests allowed per interval.",
+					},
+					"interval": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Default:     1,
+						Description: "The interval over which rate requests are allowed. Defaults to 1 second.",
+					},
+					"burst": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "The maximum number of requests allowed at once. Defaults to the rate.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRateLimitQuotasRead,
+					logical.UpdateOperation: b.handleRateLimitQuotasUpdate,
+					logical.DeleteOperation: b.handleRateLimitQuotasDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rate-limit-quota"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rate-limit-quota"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/lease-count/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleLeaseCountQuotasList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["lease-count-quota-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["lease-count-quota-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name") + "$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the quota.",
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The mount or path prefix the quota applies to. Applies to all leases outside of sys/ if empty.",
+					},
+					"max_leases": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "The maximum number of outstanding leases.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLeaseCountQuotasRead,
+					logical.UpdateOperation: b.handleLeaseCountQuotasUpdate,
+					logical.DeleteOperation: b.handleLeaseCountQuotasDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["lease-count-quota"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["lease-count-quota"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "config/auditing/request-headers/(?P<header>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"header": &framework.FieldSchema{
+						Type: framework.TypeString,
+					},
+					"hmac": &framework.FieldSchema{
+						Type: framework.TypeBool,
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleAuditedHeaderUpdate,
+					logical.DeleteOperation: b.handleAuditedHeaderDelete,
+					logical.ReadOperation:   b.handleAuditedHeaderRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audited-headers-name"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audited-headers-name"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "config/auditing/request-headers$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuditedHeadersRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audited-headers"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audited-headers"][1]),
+			},
+			&framework.Path{
+				Pattern: "plugins/catalog/?$",
+
+				Fields: map[string]*framework.FieldSchema{},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handlePluginCatalogList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["plugin-catalog"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["plugin-catalog"][1]),
+			},
+			&framework.Path{
+				Pattern: "plugins/catalog/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["plugin-catalog_name"][0]),
+					},
+					"sha256": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["plugin-catalog_sha-256"][0]),
+					},
+					"sha_256": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["plugin-catalog_sha-256"][0]),
+					},
+					"command": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["plugin-catalog_command"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handlePluginCatalogUpdate,
+					logical.DeleteOperation: b.handlePluginCatalogDelete,
+					logical.ReadOperation:   b.handlePluginCatalogRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["plugin-catalog"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["plugin-catalog"][1]),
+			},
+			&framework.Path{
+				Pattern: "plugins/reload/backend$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"plugin": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["plugin-backend-reload-plugin"][0]),
+					},
+					"mounts": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["plugin-backend-reload-mounts"][0]),
 					},
 				},
 
@@ -1690,22 +2347,255 @@ func (b *SystemBackend) handleLeaseLookupList(
 	return logical.ListResponse(keys), nil
 }
 
-// handleRenew is used to renew a lease with a given LeaseID
-func (b *SystemBackend) handleRenew(
+// handleLeasesIrrevocable lists the leases that could not be revoked
+func (b *SystemBackend) handleLeasesIrrevocable(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
-	if leaseID == "" {
-		leaseID = data.Get("url_lease_id").(string)
-	}
-	if leaseID == "" {
-		return logical.ErrorResponse("lease_id must be specified"),
-			logical.ErrInvalidRequest
+	prefix := data.Get("prefix").(string)
+
+	irrevocable := b.Core.expiration.IrrevocableLeases(prefix)
+	leases := make([]map[string]interface{}, 0, len(irrevocable))
+	for _, lease := range irrevocable {
+		leases = append(leases, map[string]interface{}{
+			"lease_id":        lease.LeaseID,
+			"mount":           b.Core.router.MatchingMount(lease.LeaseID),
+			"expire_time":     lease.ExpireTime,
+			"revoke_attempts": lease.RevokeAttempts,
+			"error":           lease.RevokeErr,
+		})
 	}
-	incrementRaw := data.Get("increment").(int)
 
-	// Convert the increment
-	increment := time.Duration(incrementRaw) * time.Second
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"leases":      leases,
+			"lease_count": len(leases),
+		},
+	}
+	if b.Core.expiration.inRestoreMode() {
+		resp.AddWarning("leases are still being restored; the list may be incomplete")
+	}
+	return resp, nil
+}
+
+// handleLeasesCount counts the outstanding and irrevocable leases by mount
+func (b *SystemBackend) handleLeasesCount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	counts := make(map[string]int)
+	var total int
+	for mountPoint, count := range b.Core.expiration.LeaseCounts() {
+		counts[mountPoint] = int(count)
+		total += int(count)
+	}
+
+	irrevocableCounts := make(map[string]int)
+	irrevocable := b.Core.expiration.IrrevocableLeases("")
+	for _, lease := range irrevocable {
+		irrevocableCounts[b.Core.router.MatchingMount(lease.LeaseID)]++
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"lease_count":             total,
+			"counts":                  counts,
+			"irrevocable_lease_count": len(irrevocable),
+			"irrevocable_counts":      irrevocableCounts,
+		},
+	}
+	if b.Core.expiration.inRestoreMode() {
+		resp.AddWarning("leases are still being restored; counts may be incomplete")
+	}
+	return resp, nil
+}
+
+// handleMetrics returns the metrics of this node in the requested format
+func (b *SystemBackend) handleMetrics(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	metricsHelper := b.Core.MetricsHelper()
+	if metricsHelper == nil {
+		return logical.ErrorResponse("metrics are not enabled on this server"), logical.ErrInvalidRequest
+	}
+
+	resp, err := metricsHelper.ResponseForFormat(data.Get("format").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return resp, nil
+}
+
+// controlledLogger returns the logger of the server if its level can be
+// changed
+func (b *SystemBackend) controlledLogger() (*logformat.ControlledLogger, error) {
+	logger, ok := b.Core.Logger().(*logformat.ControlledLogger)
+	if !ok {
+		return nil, fmt.Errorf("the logger of this server does not support runtime changes")
+	}
+	return logger, nil
+}
+
+// parseLevel parses the level of the request, which is required
+func parseLevel(data *framework.FieldData) (int, *logical.Response) {
+	name := data.Get("level").(string)
+	if name == "" {
+		return 0, logical.ErrorResponse("level must be provided")
+	}
+	level, err := logformat.ParseLevel(name)
+	if err != nil {
+		return 0, logical.ErrorResponse(err.Error())
+	}
+	return level, nil
+}
+
+// handleLoggersRead returns the global log level and the levels of the
+// subsystems that have their own
+func (b *SystemBackend) handleLoggersRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger, err := b.controlledLogger()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	subsystems := make(map[string]interface{})
+	for subsystem, level := range logger.SubsystemLevels() {
+		subsystems[subsystem] = logformat.LevelName(level)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"level":      logformat.LevelName(logger.Level()),
+			"subsystems": subsystems,
+		},
+	}, nil
+}
+
+// handleLoggersUpdate sets the global log level
+func (b *SystemBackend) handleLoggersUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger, err := b.controlledLogger()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	level, errResp := parseLevel(data)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	logger.SetLevel(level)
+	b.Backend.Logger().Info("sys: global log level changed", "level", logformat.LevelName(level))
+	return nil, nil
+}
+
+// handleLoggersDelete reverts all log levels to the configured one
+func (b *SystemBackend) handleLoggersDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger, err := b.controlledLogger()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	logger.Reset()
+	b.Backend.Logger().Info("sys: log levels reset", "level", logformat.LevelName(logger.Level()))
+	return nil, nil
+}
+
+// handleLoggerRead returns the log level applying to a subsystem
+func (b *SystemBackend) handleLoggerRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger, err := b.controlledLogger()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	name := data.Get("name").(string)
+	level, ok := logger.SubsystemLevels()[name]
+	if !ok {
+		level = logger.Level()
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":  name,
+			"level": logformat.LevelName(level),
+			"own":   ok,
+		},
+	}, nil
+}
+
+// handleLoggerUpdate sets the log level of a subsystem
+func (b *SystemBackend) handleLoggerUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger, err := b.controlledLogger()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	level, errResp := parseLevel(data)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	name := strings.Trim(data.Get("name").(string), "/")
+	if name == "" {
+		return logical.ErrorResponse("name must be provided"), logical.ErrInvalidRequest
+	}
+	logger.SetSubsystemLevel(name, level)
+	b.Backend.Logger().Info("sys: subsystem log level changed", "subsystem", name, "level", logformat.LevelName(level))
+	return nil, nil
+}
+
+// handleLoggerDelete makes a subsystem use the level of its parent again
+func (b *SystemBackend) handleLoggerDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger, err := b.controlledLogger()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	logger.ResetSubsystemLevel(strings.Trim(data.Get("name").(string), "/"))
+	return nil, nil
+}
+
+// handleMonitor validates the parameters of a request to stream the logs;
+// the streaming itself is done by the HTTP handler once the request is
+// authorized
+func (b *SystemBackend) handleMonitor(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.controlledLogger(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	levelName := data.Get("log_level").(string)
+	level, err := logformat.ParseLevel(levelName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	format := strings.ToLower(data.Get("log_format").(string))
+	switch format {
+	case "standard", "json":
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unknown log format %q", format)), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"log_level":  logformat.LevelName(level),
+			"log_format": format,
+		},
+	}, nil
+}
+
+// handleRenew is used to renew a lease with a given LeaseID
+func (b *SystemBackend) handleRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		leaseID = data.Get("url_lease_id").(string)
+	}
+	if leaseID == "" {
+		return logical.ErrorResponse("lease_id must be specified"),
+			logical.ErrInvalidRequest
+	}
+	incrementRaw := data.Get("increment").(int)
+
+	// Convert the increment
+	increment := time.Duration(incrementRaw) * time.Second
 
 	// Invoke the expiration manager directly
 	resp, err := b.Core.expiration.Renew(leaseID, increment)
@@ -2089,7 +2979,7 @@ func (b *SystemBackend) handleRawRead(
 		}
 	}
 
-	entry, err := b.Core.barrier.Get(path)
+	entry, err := b.Core.barrier.Get(req.Context(), path)
 	if err != nil {
 		return handleError(err)
 	}
@@ -2122,7 +3012,7 @@ func (b *SystemBackend) handleRawWrite(
 		Key:   path,
 		Value: []byte(value),
 	}
-	if err := b.Core.barrier.Put(entry); err != nil {
+	if err := b.Core.barrier.Put(req.Context(), entry); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 	return nil, nil
@@ -2141,7 +3031,7 @@ func (b *SystemBackend) handleRawDelete(
 		}
 	}
 
-	if err := b.Core.barrier.Delete(path); err != nil {
+	if err := b.Core.barrier.Delete(req.Context(), path); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
@@ -2163,7 +3053,7 @@ func (b *SystemBackend) handleRawList(
 		}
 	}
 
-	keys, err := b.Core.barrier.List(path)
+	keys, err := b.Core.barrier.List(req.Context(), path)
 	if err != nil {
 		return handleError(err)
 	}
@@ -2221,7 +3111,7 @@ func (b *SystemBackend) handleRotate(
 
 	// Write to the canary path, which will force a synchronous truing during
 	// replication
-	if err := b.Core.barrier.Put(&Entry{
+	if err := b.Core.barrier.Put(context.Background(), &Entry{
 		Key:   coreKeyringCanaryPath,
 		Value: []byte(fmt.Sprintf("new-rotation-term-%d", newTerm)),
 	}); err != nil {
@@ -2232,6 +3122,157 @@ func (b *SystemBackend) handleRotate(
 	return nil, nil
 }
 
+// handleReplicationStatus returns the replication status of the cluster
+func (b *SystemBackend) handleReplicationStatus(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	status, err := b.Core.replicationStatus()
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: status,
+	}, nil
+}
+
+// handleReplicationPrimaryEnable makes this cluster a replication primary
+func (b *SystemBackend) handleReplicationPrimaryEnable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if b.Core.replicationState != consts.ReplicationDisabled {
+		return logical.ErrorResponse("replication is already enabled"), logical.ErrInvalidRequest
+	}
+	if b.Core.replicationWAL == nil || b.Core.clusterAddr == "" {
+		return logical.ErrorResponse("replication requires an HA storage backend and a cluster address"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.enableReplicationPrimary(); err != nil {
+		b.Backend.Logger().Error("sys: failed to enable replication primary", "error", err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleReplicationSecondaryToken issues an activation token for a new
+// secondary
+func (b *SystemBackend) handleReplicationSecondaryToken(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !b.Core.replicationState.HasState(consts.ReplicationPerformancePrimary) {
+		return logical.ErrorResponse("replication primary mode is not enabled"), logical.ErrInvalidRequest
+	}
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("missing secondary id"), logical.ErrInvalidRequest
+	}
+	if strings.Contains(id, "/") {
+		return logical.ErrorResponse("secondary id cannot contain slashes"), logical.ErrInvalidRequest
+	}
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+	if ttl <= 0 {
+		ttl = replicationDefaultTokenTTL
+	}
+
+	token, err := b.Core.replicationSecondaryToken(id, ttl)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":    id,
+			"token": token,
+			"ttl":   int64(ttl.Seconds()),
+		},
+		// The token carries the private key of the secondary, so it is only
+		// ever handed out response-wrapped; should wrapping fail, the core
+		// returns the error instead of the response
+		WrapInfo: &wrapping.ResponseWrapInfo{
+			TTL: ttl,
+		},
+	}, nil
+}
+
+// handleReplicationRevokeSecondary stops a secondary from connecting to this
+// primary
+func (b *SystemBackend) handleReplicationRevokeSecondary(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !b.Core.replicationState.HasState(consts.ReplicationPerformancePrimary) {
+		return logical.ErrorResponse("replication primary mode is not enabled"), logical.ErrInvalidRequest
+	}
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("missing secondary id"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.barrier.Delete(context.Background(), coreReplicationSecondaryPrefix+id); err != nil {
+		return handleError(err)
+	}
+	b.Core.invalidateReplicationPeer(id)
+	return nil, nil
+}
+
+// handleReplicationSecondaryEnable makes this cluster a secondary of the
+// primary that issued the activation token
+func (b *SystemBackend) handleReplicationSecondaryEnable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if b.Core.replicationState != consts.ReplicationDisabled {
+		return logical.ErrorResponse("replication is already enabled"), logical.ErrInvalidRequest
+	}
+	if b.Core.replicationWAL == nil {
+		return logical.ErrorResponse("replication requires an HA storage backend"), logical.ErrInvalidRequest
+	}
+	return b.enableReplicationSecondary(data)
+}
+
+// handleReplicationUpdatePrimary points this secondary at a new primary
+func (b *SystemBackend) handleReplicationUpdatePrimary(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !b.Core.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		return logical.ErrorResponse("replication secondary mode is not enabled"), logical.ErrInvalidRequest
+	}
+	return b.enableReplicationSecondary(data)
+}
+
+func (b *SystemBackend) enableReplicationSecondary(data *framework.FieldData) (*logical.Response, error) {
+	rawToken := data.Get("token").(string)
+	if rawToken == "" {
+		return logical.ErrorResponse("missing activation token"), logical.ErrInvalidRequest
+	}
+	token, err := parseReplicationActivationToken(rawToken)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.enableReplicationSecondary(token, data.Get("primary_cluster_addr").(string)); err != nil {
+		b.Backend.Logger().Error("sys: failed to enable replication secondary", "error", err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleReplicationPromote turns this secondary into a primary
+func (b *SystemBackend) handleReplicationPromote(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !b.Core.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		return logical.ErrorResponse("replication secondary mode is not enabled"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.promoteReplicationSecondary(); err != nil {
+		b.Backend.Logger().Error("sys: failed to promote replication secondary", "error", err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleReplicationReindex makes this secondary compare its storage against
+// the primary again
+func (b *SystemBackend) handleReplicationReindex(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !b.Core.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		return logical.ErrorResponse("replication secondary mode is not enabled"), logical.ErrInvalidRequest
+	}
+
+	b.Core.replicationSecondary.reset()
+	return nil, nil
+}
+
 func (b *SystemBackend) handleWrappingPubkey(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	x, _ := b.Core.wrappingJWTKey.X.MarshalText()
@@ -2485,41 +3526,679 @@ func (b *SystemBackend) handleWrappingRewrap(
 	}, nil
 }
 
-func sanitizeMountPath(path string) string {
-	if !strings.HasSuffix(path, "/") {
-		path += "/"
+// handleControlGroupAuthorize records an authorization of a request held by a
+// control group by the entity of the calling token
+func (b *SystemBackend) handleControlGroupAuthorize(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing \"accessor\" value in input"), logical.ErrInvalidRequest
 	}
 
-	if strings.HasPrefix(path, "/") {
-		path = path[1:]
+	cgr, err := b.Core.authorizeControlGroupRequest(accessor, req.EntityID)
+	if err != nil {
+		if _, ok := err.(logical.HTTPCodedError); ok {
+			return handleError(err)
+		}
+		return nil, err
 	}
 
-	return path
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved": cgr.approved(),
+		},
+	}, nil
 }
 
-const sysHelpRoot = `
-The system backend is built-in to Vault and cannot be remounted or
-unmounted. It contains the paths that are used to configure Vault itself
-as well as perform core operations.
-`
+// handleControlGroupRequest returns the status of a request held by a control
+// group
+func (b *SystemBackend) handleControlGroupRequest(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing \"accessor\" value in input"), logical.ErrInvalidRequest
+	}
 
-// sysHelp is all the help text for the sys backend.
-var sysHelp = map[string][2]string{
-	"config/cors": {
-		"Configures or returns the current configuration of CORS settings.",
-		`
-This path responds to the following HTTP methods.
+	cgr, err := b.Core.controlGroupRequestByAccessor(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if cgr == nil {
+		return logical.ErrorResponse("no control group request found for accessor"), logical.ErrInvalidRequest
+	}
 
-    GET /
-        Returns the configuration of the CORS setting.
+	requestEntity := map[string]interface{}{
+		"id": cgr.RequesterEntityID,
+	}
+	if cgr.RequesterEntityID != "" {
+		entity, err := b.Core.identityStore.memDBEntityByID(cgr.RequesterEntityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity != nil {
+			requestEntity["name"] = entity.Name
+		}
+	}
 
-    POST /
-        Sets the comma-separated list of origins that can make cross-origin requests.
+	authorizations := make([]map[string]interface{}, 0, len(cgr.Authorizations))
+	for _, authz := range cgr.Authorizations {
+		authzData := map[string]interface{}{
+			"entity_id": authz.EntityID,
+			"factors":   authz.Factors,
+			"time":      authz.Time.Format(time.RFC3339Nano),
+		}
+		entity, err := b.Core.identityStore.memDBEntityByID(authz.EntityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity != nil {
+			authzData["entity_name"] = entity.Name
+		}
+		authorizations = append(authorizations, authzData)
+	}
 
-    DELETE /
-        Clears the CORS configuration and disables acceptance of CORS requests.
-		`,
-	},
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved":          cgr.approved(),
+			"request_path":      cgr.Path,
+			"request_operation": string(cgr.Operation),
+			"request_entity":    requestEntity,
+			"authorizations":    authorizations,
+			"creation_time":     cgr.CreationTime.Format(time.RFC3339Nano),
+			"ttl":               int64(cgr.TTL.Seconds()),
+		},
+	}, nil
+}
+
+// handleMFAMethodList lists the configured MFA methods
+func (b *SystemBackend) handleMFAMethodList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.mfaView(mfaMethodSubPath).List("")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(names), nil
+}
+
+// handleMFAMethodRead returns the configuration of an MFA method
+func (b *SystemBackend) handleMFAMethodRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	method, err := b.Core.mfaMethodByName(data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if method == nil || method.Type != data.Get("type").(string) {
+		return nil, nil
+	}
+
+	respData := map[string]interface{}{
+		"id":              method.ID,
+		"name":            method.Name,
+		"type":            method.Type,
+		"mount_accessor":  method.MountAccessor,
+		"username_format": method.UsernameFormat,
+	}
+	switch method.Type {
+	case "totp":
+		respData["issuer"] = method.Issuer
+		respData["period"] = method.Period
+		respData["key_size"] = method.KeySize
+		respData["digits"] = method.Digits
+		respData["algorithm"] = method.Algorithm
+		respData["skew"] = method.Skew
+		respData["qr_size"] = method.QRSize
+	case "duo":
+		respData["integration_key"] = method.IntegrationKey
+		respData["secret_key"] = method.SecretKey
+		respData["api_hostname"] = method.APIHostname
+		respData["pushinfo"] = method.PushInfo
+	case "okta":
+		respData["org_name"] = method.OrgName
+		respData["api_token"] = method.APIToken
+		respData["base_url"] = method.BaseURL
+		respData["production"] = method.Production
+	case "pingid":
+		respData["use_signature"] = method.UseSignature
+		respData["idp_url"] = method.IDPURL
+		respData["org_alias"] = method.OrgAlias
+		respData["admin_url"] = method.AdminURL
+		respData["authenticator_url"] = method.AuthenticatorURL
+	}
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// handleMFAMethodUpdate creates or updates an MFA method
+func (b *SystemBackend) handleMFAMethodUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	methodType := data.Get("type").(string)
+
+	method, err := b.Core.mfaMethodByName(name)
+	if err != nil {
+		return nil, err
+	}
+	isNew := method == nil
+	switch {
+	case isNew:
+		methodID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		method = &MFAMethod{
+			ID:   methodID,
+			Name: name,
+			Type: methodType,
+		}
+	case method.Type != methodType:
+		return logical.ErrorResponse(fmt.Sprintf("MFA method %q already exists with type %q", name, method.Type)), logical.ErrInvalidRequest
+	}
+
+	if mountAccessor, ok := data.GetOk("mount_accessor"); ok {
+		method.MountAccessor = mountAccessor.(string)
+		if method.MountAccessor != "" && b.Core.router.MatchingMountByAccessor(method.MountAccessor) == nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid mount accessor %q", method.MountAccessor)), logical.ErrInvalidRequest
+		}
+	}
+	if usernameFormat, ok := data.GetOk("username_format"); ok {
+		method.UsernameFormat = usernameFormat.(string)
+		if err := validateMFAUsernameFormat(method.UsernameFormat); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	if methodType != "totp" && method.MountAccessor == "" {
+		return logical.ErrorResponse("missing \"mount_accessor\" value in input"), logical.ErrInvalidRequest
+	}
+
+	switch methodType {
+	case "totp":
+		if issuer, ok := data.GetOk("issuer"); ok {
+			method.Issuer = issuer.(string)
+		}
+		if method.Issuer == "" {
+			return logical.ErrorResponse("missing \"issuer\" value in input"), logical.ErrInvalidRequest
+		}
+		if _, ok := data.GetOk("period"); ok || isNew {
+			period := data.Get("period").(int)
+			if period <= 0 {
+				return logical.ErrorResponse("\"period\" must be greater than zero"), logical.ErrInvalidRequest
+			}
+			method.Period = uint(period)
+		}
+		if _, ok := data.GetOk("key_size"); ok || isNew {
+			keySize := data.Get("key_size").(int)
+			if keySize <= 0 {
+				return logical.ErrorResponse("\"key_size\" must be greater than zero"), logical.ErrInvalidRequest
+			}
+			method.KeySize = uint(keySize)
+		}
+		if _, ok := data.GetOk("digits"); ok || isNew {
+			method.Digits = data.Get("digits").(int)
+			if method.Digits != 6 && method.Digits != 8 {
+				return logical.ErrorResponse("\"digits\" must be either 6 or 8"), logical.ErrInvalidRequest
+			}
+		}
+		if _, ok := data.GetOk("algorithm"); ok || isNew {
+			method.Algorithm = data.Get("algorithm").(string)
+			switch method.Algorithm {
+			case "SHA1", "SHA256", "SHA512":
+			default:
+				return logical.ErrorResponse("\"algorithm\" must be one of SHA1, SHA256 or SHA512"), logical.ErrInvalidRequest
+			}
+		}
+		if _, ok := data.GetOk("skew"); ok || isNew {
+			skew := data.Get("skew").(int)
+			if skew != 0 && skew != 1 {
+				return logical.ErrorResponse("\"skew\" must be either 0 or 1"), logical.ErrInvalidRequest
+			}
+			method.Skew = uint(skew)
+		}
+		if _, ok := data.GetOk("qr_size"); ok || isNew {
+			method.QRSize = data.Get("qr_size").(int)
+			if method.QRSize <= 0 {
+				return logical.ErrorResponse("\"qr_size\" must be greater than zero"), logical.ErrInvalidRequest
+			}
+		}
+
+	case "duo":
+		if integrationKey, ok := data.GetOk("integration_key"); ok {
+			method.IntegrationKey = integrationKey.(string)
+		}
+		if secretKey, ok := data.GetOk("secret_key"); ok {
+			method.SecretKey = secretKey.(string)
+		}
+		if apiHostname, ok := data.GetOk("api_hostname"); ok {
+			method.APIHostname = apiHostname.(string)
+		}
+		if pushInfo, ok := data.GetOk("push_info"); ok {
+			method.PushInfo = pushInfo.(string)
+		}
+		if method.IntegrationKey == "" || method.SecretKey == "" || method.APIHostname == "" {
+			return logical.ErrorResponse("\"integration_key\", \"secret_key\" and \"api_hostname\" are required"), logical.ErrInvalidRequest
+		}
+
+	case "okta":
+		if orgName, ok := data.GetOk("org_name"); ok {
+			method.OrgName = orgName.(string)
+		}
+		if apiToken, ok := data.GetOk("api_token"); ok {
+			method.APIToken = apiToken.(string)
+		}
+		if baseURL, ok := data.GetOk("base_url"); ok {
+			method.BaseURL = baseURL.(string)
+		}
+		if _, ok := data.GetOk("production"); ok || isNew {
+			method.Production = data.Get("production").(bool)
+		}
+		if method.OrgName == "" && !strings.Contains(method.BaseURL, "://") {
+			return logical.ErrorResponse("missing \"org_name\" value in input"), logical.ErrInvalidRequest
+		}
+		if method.APIToken == "" {
+			return logical.ErrorResponse("missing \"api_token\" value in input"), logical.ErrInvalidRequest
+		}
+
+	case "pingid":
+		if settingsRaw, ok := data.GetOk("settings_file_base64"); ok {
+			settings, err := base64.StdEncoding.DecodeString(settingsRaw.(string))
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error decoding settings file: %v", err)), logical.ErrInvalidRequest
+			}
+			if err := parsePingIDSettings(method, settings); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error parsing settings file: %v", err)), logical.ErrInvalidRequest
+			}
+		}
+		if method.IDPURL == "" {
+			return logical.ErrorResponse("missing \"settings_file_base64\" value in input"), logical.ErrInvalidRequest
+		}
+	}
+
+	if err := b.Core.setMFAMethod(method); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleMFAMethodDelete deletes an MFA method
+func (b *SystemBackend) handleMFAMethodDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	method, err := b.Core.mfaMethodByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if method == nil || method.Type != data.Get("type").(string) {
+		return nil, nil
+	}
+
+	return nil, b.Core.deleteMFAMethod(name)
+}
+
+// mfaTOTPMethod returns the TOTP method given in the request
+func (b *SystemBackend) mfaTOTPMethod(data *framework.FieldData) (*MFAMethod, *logical.Response, error) {
+	name := data.Get("name").(string)
+	method, err := b.Core.mfaMethodByName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if method == nil || method.Type != "totp" {
+		return nil, logical.ErrorResponse(fmt.Sprintf("no TOTP method named %q", name)), logical.ErrInvalidRequest
+	}
+	return method, nil, nil
+}
+
+// mfaTOTPGenerate enrolls the entity in the TOTP method given in the request
+func (b *SystemBackend) mfaTOTPGenerate(data *framework.FieldData, entityID string) (*logical.Response, error) {
+	method, resp, err := b.mfaTOTPMethod(data)
+	if method == nil {
+		return resp, err
+	}
+
+	entity, err := b.Core.identityStore.memDBEntityByID(entityID, false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse(fmt.Sprintf("no entity found with ID %q", entityID)), logical.ErrInvalidRequest
+	}
+
+	url, barcode, err := b.Core.generateMFATOTPSecret(method, entity)
+	if err != nil {
+		return nil, err
+	}
+	if url == "" {
+		resp := &logical.Response{}
+		resp.AddWarning("Entity already has a secret for the TOTP method")
+		return resp, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url":     url,
+			"barcode": barcode,
+		},
+	}, nil
+}
+
+// handleMFATOTPGenerate enrolls the entity of the calling token in a TOTP
+// method
+func (b *SystemBackend) handleMFATOTPGenerate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.EntityID == "" {
+		return logical.ErrorResponse("token is not tied to an entity"), logical.ErrInvalidRequest
+	}
+	return b.mfaTOTPGenerate(data, req.EntityID)
+}
+
+// handleMFATOTPAdminGenerate enrolls the given entity in a TOTP method
+func (b *SystemBackend) handleMFATOTPAdminGenerate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing \"entity_id\" value in input"), logical.ErrInvalidRequest
+	}
+	return b.mfaTOTPGenerate(data, entityID)
+}
+
+// handleMFATOTPAdminDestroy removes the TOTP secret of the given entity
+func (b *SystemBackend) handleMFATOTPAdminDestroy(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing \"entity_id\" value in input"), logical.ErrInvalidRequest
+	}
+
+	method, resp, err := b.mfaTOTPMethod(data)
+	if method == nil {
+		return resp, err
+	}
+
+	return nil, b.Core.deleteMFATOTPSecret(method.Name, entityID)
+}
+
+// handleMFALoginEnforcementList lists the MFA login enforcements
+func (b *SystemBackend) handleMFALoginEnforcementList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.mfaLoginEnforcementNames()
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(names), nil
+}
+
+// handleMFALoginEnforcementRead returns an MFA login enforcement
+func (b *SystemBackend) handleMFALoginEnforcementRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	enforcement, err := b.Core.mfaLoginEnforcementByName(data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if enforcement == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                  enforcement.Name,
+			"mfa_method_names":      enforcement.MFAMethodNames,
+			"auth_method_accessors": enforcement.AuthMethodAccessors,
+			"auth_method_types":     enforcement.AuthMethodTypes,
+		},
+	}, nil
+}
+
+// handleMFALoginEnforcementUpdate creates or updates an MFA login enforcement
+func (b *SystemBackend) handleMFALoginEnforcementUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	enforcement, err := b.Core.mfaLoginEnforcementByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if enforcement == nil {
+		enforcement = &MFALoginEnforcement{
+			Name: name,
+		}
+	}
+
+	if methodNames, ok := data.GetOk("mfa_method_names"); ok {
+		enforcement.MFAMethodNames = methodNames.([]string)
+	}
+	if accessors, ok := data.GetOk("auth_method_accessors"); ok {
+		enforcement.AuthMethodAccessors = accessors.([]string)
+	}
+	if types, ok := data.GetOk("auth_method_types"); ok {
+		enforcement.AuthMethodTypes = types.([]string)
+	}
+
+	if len(enforcement.MFAMethodNames) == 0 {
+		return logical.ErrorResponse("missing \"mfa_method_names\" value in input"), logical.ErrInvalidRequest
+	}
+	for _, methodName := range enforcement.MFAMethodNames {
+		method, err := b.Core.mfaMethodByName(methodName)
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return logical.ErrorResponse(fmt.Sprintf("MFA method %q does not exist", methodName)), logical.ErrInvalidRequest
+		}
+	}
+	if len(enforcement.AuthMethodAccessors) == 0 && len(enforcement.AuthMethodTypes) == 0 {
+		return logical.ErrorResponse("one of \"auth_method_accessors\" or \"auth_method_types\" must be specified"), logical.ErrInvalidRequest
+	}
+	for _, accessor := range enforcement.AuthMethodAccessors {
+		if b.Core.router.MatchingMountByAccessor(accessor) == nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid auth method accessor %q", accessor)), logical.ErrInvalidRequest
+		}
+	}
+
+	if err := b.Core.setMFALoginEnforcement(enforcement); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleMFALoginEnforcementDelete deletes an MFA login enforcement
+func (b *SystemBackend) handleMFALoginEnforcementDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.mfaView(mfaLoginEnforcementSubPath).Delete(data.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleRateLimitQuotasList lists the names of the rate limit quotas
+func (b *SystemBackend) handleRateLimitQuotasList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names := b.Core.quotas.rateLimitQuotaNames()
+	sort.Strings(names)
+	return logical.ListResponse(names), nil
+}
+
+// handleRateLimitQuotasRead returns the configuration of a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotasRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	quota := b.Core.quotas.rateLimitQuota(data.Get("name").(string))
+	if quota == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":     quota.Name,
+			"type":     quotaTypeRateLimit,
+			"path":     quota.Path,
+			"rate":     quota.Rate,
+			"interval": int64(quota.Interval.Seconds()),
+			"burst":    quota.Burst,
+		},
+	}, nil
+}
+
+// handleRateLimitQuotasUpdate creates or updates a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotasUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	quota := b.Core.quotas.rateLimitQuota(name)
+	isNew := quota == nil
+	if isNew {
+		quota = &RateLimitQuota{
+			Name: name,
+		}
+	}
+
+	if path, ok := data.GetOk("path"); ok {
+		path, err := b.Core.validateQuotaPath(path.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		quota.Path = path
+	}
+	if rate, ok := data.GetOk("rate"); ok {
+		quota.Rate = rate.(int)
+	}
+	if quota.Rate <= 0 {
+		return logical.ErrorResponse("\"rate\" must be greater than zero"), logical.ErrInvalidRequest
+	}
+	if _, ok := data.GetOk("interval"); ok || isNew {
+		quota.Interval = time.Duration(data.Get("interval").(int)) * time.Second
+		if quota.Interval <= 0 {
+			return logical.ErrorResponse("\"interval\" must be greater than zero"), logical.ErrInvalidRequest
+		}
+	}
+	if burst, ok := data.GetOk("burst"); ok {
+		quota.Burst = burst.(int)
+	} else if isNew {
+		quota.Burst = quota.Rate
+	}
+	if quota.Burst <= 0 {
+		return logical.ErrorResponse("\"burst\" must be greater than zero"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.quotas.setRateLimitQuota(quota); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRateLimitQuotasDelete removes a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotasDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.quotas.deleteRateLimitQuota(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleLeaseCountQuotasList lists the names of the lease count quotas
+func (b *SystemBackend) handleLeaseCountQuotasList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names := b.Core.quotas.leaseCountQuotaNames()
+	sort.Strings(names)
+	return logical.ListResponse(names), nil
+}
+
+// handleLeaseCountQuotasRead returns the configuration and the current count
+// of a lease count quota
+func (b *SystemBackend) handleLeaseCountQuotasRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	quota, count := b.Core.quotas.leaseCountQuota(data.Get("name").(string))
+	if quota == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":       quota.Name,
+			"type":       quotaTypeLeaseCount,
+			"path":       quota.Path,
+			"max_leases": quota.MaxLeases,
+			"counter":    count,
+		},
+	}, nil
+}
+
+// handleLeaseCountQuotasUpdate creates or updates a lease count quota
+func (b *SystemBackend) handleLeaseCountQuotasUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	quota, _ := b.Core.quotas.leaseCountQuota(name)
+	if quota == nil {
+		quota = &LeaseCountQuota{
+			Name: name,
+		}
+	}
+
+	if path, ok := data.GetOk("path"); ok {
+		path, err := b.Core.validateQuotaPath(path.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		quota.Path = path
+	}
+	if maxLeases, ok := data.GetOk("max_leases"); ok {
+		quota.MaxLeases = int64(maxLeases.(int))
+	}
+	if quota.MaxLeases <= 0 {
+		return logical.ErrorResponse("\"max_leases\" must be greater than zero"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.quotas.setLeaseCountQuota(quota); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleLeaseCountQuotasDelete removes a lease count quota
+func (b *SystemBackend) handleLeaseCountQuotasDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.quotas.deleteLeaseCountQuota(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+func sanitizeMountPath(path string) string {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	if strings.HasPrefix(path, "/") {
+		path = path[1:]
+	}
+
+	return path
+}
+
+const sysHelpRoot = `
+The system backend is built-in to Vault and cannot be remounted or
+unmounted. It contains the paths that are used to configure Vault itself
+as well as perform core operations.
+`
+
+// sysHelp is all the help text for the sys backend.
+var sysHelp = map[string][2]string{
+	"config/cors": {
+		"Configures or returns the current configuration of CORS settings.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the configuration of the CORS setting.
+
+    POST /
+        Sets the comma-separated list of origins that can make cross-origin requests.
+
+    DELETE /
+        Clears the CORS configuration and disables acceptance of CORS requests.
+		`,
+	},
 	"init": {
 		"Initializes or returns the initialization status of the Vault.",
 		`
@@ -2948,6 +4627,108 @@ it.`,
 		`Rotates a response-wrapped token; the output is a new token with the same
 		response wrapped inside and the same creation TTL. The original token is revoked.`,
 	},
+	"control-group-authorize": {
+		"Authorizes a request held by a control group.",
+		`Records an authorization of the request held by a control group under the
+		given wrapping token accessor. The entity of the calling token must be a
+		member of one of the identity groups of a factor of the control group.`,
+	},
+	"control-group-request": {
+		"Returns the status of a request held by a control group.",
+		`Returns the path and requester of the request held by a control group under
+		the given wrapping token accessor, the authorizations it has received, and
+		whether it has been approved.`,
+	},
+	"control-group-accessor": {
+		"The accessor of the wrapping token returned for the held request.",
+		"",
+	},
+	"mfa-method-list": {
+		"Lists the configured MFA methods.",
+		"",
+	},
+	"mfa-method": {
+		"Configures an MFA method.",
+		`
+MFA methods can be required on paths through the "mfa_methods" key of
+policies, or on logins through login enforcements. The credentials of a
+method are supplied in the X-Vault-MFA header as "method_name:passcode",
+or just "method_name" for push based methods.
+
+TOTP methods require entities to be enrolled through the "generate" or
+"admin-generate" endpoints. Duo, Okta and PingID methods derive the
+username sent to the provider from the entity using "username_format".
+		`,
+	},
+	"mfa-method-type": {
+		"The type of the MFA method, one of totp, duo, okta or pingid.",
+		"",
+	},
+	"mfa-method-name": {
+		"Name of the MFA method.",
+		"",
+	},
+	"mfa-entity-id": {
+		"The ID of the entity.",
+		"",
+	},
+	"mfa-totp-generate": {
+		"Generates a TOTP secret for the entity of the calling token.",
+		`
+Returns the key URL and a base64 encoded PNG barcode of it. If the entity
+already has a secret for the method, a warning is returned instead.
+		`,
+	},
+	"mfa-totp-admin-generate": {
+		"Generates a TOTP secret for the given entity.",
+		`
+Returns the key URL and a base64 encoded PNG barcode of it. If the entity
+already has a secret for the method, a warning is returned instead.
+		`,
+	},
+	"mfa-totp-admin-destroy": {
+		"Removes the TOTP secret of the given entity.",
+		"",
+	},
+	"mfa-login-enforcement-list": {
+		"Lists the MFA login enforcements.",
+		"",
+	},
+	"mfa-login-enforcement": {
+		"Configures MFA enforced on logins.",
+		`
+A login enforcement requires the given MFA methods to be validated on logins
+through auth methods matching either the given mount accessors or types. The
+authenticated alias must map to an entity for the validation to succeed.
+		`,
+	},
+	"rate-limit-quota-list": {
+		"Lists the rate limit quotas.",
+		"",
+	},
+	"rate-limit-quota": {
+		"Configures a rate limit quota.",
+		`
+A rate limit quota caps the rate of requests to a mount or path prefix, or to
+all paths if no path is given. The most specific quota matching a request is
+applied. Requests exceeding the quota are rejected with a 429 status code.
+Requests to sys/ paths are never rate limited.
+		`,
+	},
+	"lease-count-quota-list": {
+		"Lists the lease count quotas.",
+		"",
+	},
+	"lease-count-quota": {
+		"Configures a lease count quota.",
+		`
+A lease count quota caps the number of outstanding leases, including token
+leases, under a mount or path prefix, or under all paths if no path is given.
+The most specific quota matching a request is applied. Once the maximum is
+reached, requests that would create a new lease are rejected with a 429
+status code until leases are revoked or expire.
+		`,
+	},
 	"audited-headers-name": {
 		"Configures the headers sent to the audit logs.",
 		`
@@ -3016,6 +4797,97 @@ This path responds to the following HTTP methods.
 		`The path to list leases under. Example: "aws/creds/deploy"`,
 		"",
 	},
+
+	"leases-irrevocable": {
+		"List the leases that could not be revoked.",
+		`
+When revoking an expired lease fails, revocation is retried with exponential
+backoff. Once every attempt has failed, the lease is marked irrevocable and
+kept along with the last error until it is revoked manually, for instance
+with sys/leases/revoke-force. This path lists those leases, optionally under
+a lease ID prefix.
+		`,
+	},
+
+	"leases-irrevocable-prefix": {
+		`The lease ID prefix to list irrevocable leases under. Example: "aws/creds/deploy"`,
+		"",
+	},
+
+	"leases-count": {
+		"Count the outstanding and irrevocable leases by mount.",
+		`
+Returns the total number of outstanding leases, including tokens, and the
+number of leases that could not be revoked, each broken down by mount.
+		`,
+	},
+	"metrics": {
+		"Export the metrics aggregated for telemetry purpose.",
+		`
+Returns the metrics of this node in JSON, or in the Prometheus text format if
+the format parameter is set to "prometheus" and Prometheus is enabled in the
+telemetry configuration.
+		`,
+	},
+	"loggers": {
+		"Read and change the log level of the server.",
+		`
+Reading returns the global log level and the subsystems that have a level of
+their own. Writing a level sets the global level, and deleting reverts all
+levels to the one the server was started with. Changes apply to the node
+handling the request and are not persisted.
+		`,
+	},
+	"logger": {
+		"Read and change the log level of a subsystem.",
+		`
+A subsystem is named after the prefix of its messages, such as "core" or
+"physical/consul", and its level also applies to the subsystems nested in it.
+Deleting the level of a subsystem makes it use the level of its parent, or the
+global level, again.
+		`,
+	},
+	"monitor": {
+		"Stream the logs of the server.",
+		`
+Streams the logs of the node handling the request at the given level or more
+severe, whatever the level of the server, as text or JSON. The stream lasts
+until the client disconnects.
+		`,
+	},
+	"pprof": {
+		"Read the runtime profiles of the server.",
+		`
+Returns the runtime profiles of the node handling the request in the format
+of net/http/pprof, so that they can be read with "go tool pprof". Reading
+sys/pprof lists the available profiles. The CPU profile and the execution
+trace are collected for the given number of seconds before being returned.
+		`,
+	},
+	"host-info": {
+		"Read information about the host of the server.",
+		`
+Returns the hostname, platform, number of CPUs, memory statistics and, where
+available, the load average of the node handling the request.
+		`,
+	},
+	"in-flight-req": {
+		"List the requests being served by the server.",
+		`
+Returns the requests the node handling the request is serving, by ID, with
+their method, path, client address and start time. Streaming requests, such
+as log streams, are flagged as they are not waited for when the node drains
+before stepping down or shutting down.
+		`,
+	},
+	"config/state/sanitized": {
+		"Read the configuration of the server.",
+		`
+Returns the configuration the node handling the request was started with.
+The options of the storage, seal and service registration stanzas and the
+credentials of the telemetry providers are left out.
+		`,
+	},
 	"plugin-reload": {
 		"Reload mounts that use a particular backend plugin.",
 		`Reload mounts that use a particular backend plugin. Either the plugin name
@@ -3031,4 +4903,83 @@ This path responds to the following HTTP methods.
 		`The mount paths of the plugin backends to reload.`,
 		"",
 	},
+	"replication-status": {
+		"Returns the replication status of the cluster.",
+		`
+Returns the replication mode of the cluster. Primaries also return the
+secondaries they issued activation tokens for and the index of their last
+write; secondaries return their primary, the index of the last write they
+received from it and whether they are streaming or reindexing.
+		`,
+	},
+	"replication-primary-enable": {
+		"Makes this cluster a replication primary.",
+		`
+Makes this cluster a replication primary, which streams its writes to the
+secondaries it issues activation tokens for over the cluster port. Tokens,
+leases and the storage of local mounts are not replicated.
+		`,
+	},
+	"replication-secondary-token": {
+		"Issues an activation token for a new secondary.",
+		`
+Issues an activation token carrying the certificate a new secondary uses to
+connect to this primary. The token is always returned response-wrapped, and
+can only be used to activate the secondary until its TTL expires.
+		`,
+	},
+	"replication-secondary-id": {
+		"The identifier of the secondary.",
+		"",
+	},
+	"replication-token-ttl": {
+		"The time the activation token can be used for. Defaults to 30 minutes.",
+		"",
+	},
+	"replication-revoke-secondary": {
+		"Revokes the activation token of a secondary.",
+		`
+Revokes the activation token of a secondary, which stops the secondary from
+connecting to this primary.
+		`,
+	},
+	"replication-activation-token": {
+		"The activation token issued by the primary.",
+		"",
+	},
+	"replication-primary-cluster-addr": {
+		"Overrides the cluster address of the primary in the activation token.",
+		"",
+	},
+	"replication-secondary-enable": {
+		"Makes this cluster a replication secondary.",
+		`
+Makes this cluster a secondary of the primary that issued the given activation
+token. Data written on the primary is replicated to the secondary, which
+rejects writes to it. Data the primary does not have is removed when the
+secondary first reindexes against it.
+		`,
+	},
+	"replication-update-primary": {
+		"Points this secondary at a new primary.",
+		`
+Points this secondary at a new primary, for instance after another secondary
+was promoted. The activation token must be issued by the new primary.
+		`,
+	},
+	"replication-promote": {
+		"Promotes this secondary to a primary.",
+		`
+Promotes this secondary to a primary, keeping the data replicated so far. This
+is used for disaster recovery when the primary is lost. Other secondaries have
+to be pointed at the new primary with update-primary.
+		`,
+	},
+	"replication-reindex": {
+		"Reindexes this secondary against its primary.",
+		`
+Compares the storage of this secondary against its primary using merkle trees
+and fetches the keys that differ.
+		`,
+	},
 }
@@ -0,0 +1,227 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// defaultCPUProfileSeconds and defaultTraceSeconds are how long the
+	// CPU profile and the execution trace run for unless asked otherwise
+	defaultCPUProfileSeconds = 30
+	defaultTraceSeconds      = 1
+
+	// maxProfileSeconds bounds how long a profile or trace may run for
+	maxProfileSeconds = 60
+)
+
+// handleConfigStateSanitized returns the configuration of the server with
+// its secrets removed
+func (b *SystemBackend) handleConfigStateSanitized(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := b.Core.sanitizedConfig
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+	return &logical.Response{
+		Data: config,
+	}, nil
+}
+
+// handleHostInfo returns information about the host and the process of this
+// node
+func (b *SystemBackend) handleHostInfo(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the hostname: %v", err)
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	info := map[string]interface{}{
+		"timestamp":  time.Now().UTC().Format(time.RFC3339Nano),
+		"hostname":   hostname,
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"num_cpu":    runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"go_version": runtime.Version(),
+		"pid":        os.Getpid(),
+		"goroutines": runtime.NumGoroutine(),
+		"memory": map[string]interface{}{
+			"alloc":        mem.Alloc,
+			"total_alloc":  mem.TotalAlloc,
+			"sys":          mem.Sys,
+			"heap_alloc":   mem.HeapAlloc,
+			"heap_inuse":   mem.HeapInuse,
+			"heap_objects": mem.HeapObjects,
+			"num_gc":       mem.NumGC,
+		},
+	}
+
+	// The load average is only available where procfs is
+	if loadavg, err := ioutil.ReadFile("/proc/loadavg"); err == nil {
+		if fields := strings.Fields(string(loadavg)); len(fields) >= 3 {
+			info["load_average"] = fields[:3]
+		}
+	}
+
+	return &logical.Response{
+		Data: info,
+	}, nil
+}
+
+// handleInFlightRequests lists the requests being served by this node
+func (b *SystemBackend) handleInFlightRequests(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	reqs := make(map[string]interface{})
+	for id, inFlight := range b.Core.InFlightRequests() {
+		reqs[id] = map[string]interface{}{
+			"method":                inFlight.Method,
+			"path":                  inFlight.Path,
+			"client_remote_address": inFlight.ClientRemoteAddr,
+			"start_time":            inFlight.StartTime.UTC().Format(time.RFC3339Nano),
+			"streaming":             inFlight.Streaming,
+		}
+	}
+	return &logical.Response{
+		Data: reqs,
+	}, nil
+}
+
+// handlePprofIndex lists the profiles that can be read under sys/pprof
+func (b *SystemBackend) handlePprofIndex(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	profiles := []string{"cmdline", "profile", "trace"}
+	for _, p := range pprof.Profiles() {
+		profiles = append(profiles, p.Name())
+	}
+	sort.Strings(profiles)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"profiles": profiles,
+		},
+	}, nil
+}
+
+// handlePprof returns a runtime profile of this node, in the format of
+// net/http/pprof so that the go tool can read it. The CPU profile and the
+// execution trace take a while to collect, so only their parameters are
+// checked and returned here: the caller collects them with Profile once the
+// request, and the state lock it holds, is done.
+func (b *SystemBackend) handlePprof(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	var buf bytes.Buffer
+	contentType := "application/octet-stream"
+	switch name {
+	case "cmdline":
+		buf.WriteString(strings.Join(os.Args, "\x00"))
+		contentType = "text/plain; charset=utf-8"
+
+	case "profile", "trace":
+		defaultSeconds := defaultCPUProfileSeconds
+		if name == "trace" {
+			defaultSeconds = defaultTraceSeconds
+		}
+		seconds, errResp := profileSeconds(data, defaultSeconds)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":    name,
+				"seconds": seconds,
+			},
+		}, nil
+
+	default:
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown profile %q", name)), logical.ErrInvalidRequest
+		}
+		debug := data.Get("debug").(int)
+		if debug > 0 {
+			contentType = "text/plain; charset=utf-8"
+		}
+		if err := profile.WriteTo(&buf, debug); err != nil {
+			return nil, fmt.Errorf("failed to write the %s profile: %v", name, err)
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     buf.Bytes(),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+// Profile collects the CPU profile or the execution trace of this node for
+// the given number of seconds, stopping early if the context is canceled.
+// It must not be called while holding the state lock.
+func Profile(ctx context.Context, name string, seconds int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch name {
+	case "profile":
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			// Only one CPU profile can run at a time
+			return nil, fmt.Errorf("could not start the CPU profile: %v", err)
+		}
+		sleepForProfile(ctx, seconds)
+		pprof.StopCPUProfile()
+
+	case "trace":
+		if err := trace.Start(&buf); err != nil {
+			return nil, fmt.Errorf("could not start the trace: %v", err)
+		}
+		sleepForProfile(ctx, seconds)
+		trace.Stop()
+
+	default:
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return buf.Bytes(), nil
+}
+
+// profileSeconds returns how long the profile should run for
+func profileSeconds(data *framework.FieldData, defaultSeconds int) (int, *logical.Response) {
+	seconds := data.Get("seconds").(int)
+	switch {
+	case seconds == 0:
+		return defaultSeconds, nil
+	case seconds < 0 || seconds > maxProfileSeconds:
+		return 0, logical.ErrorResponse(fmt.Sprintf("seconds must be between 1 and %d", maxProfileSeconds))
+	}
+	return seconds, nil
+}
+
+// sleepForProfile waits while a profile runs, stopping early if the client
+// goes away
+func sleepForProfile(ctx context.Context, seconds int) {
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
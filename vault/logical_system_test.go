@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -15,9 +16,12 @@ import (
 	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/builtinplugins"
+	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/helper/pluginutil"
 	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
+	log "github.com/mgutz/logxi/v1"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -29,7 +33,12 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"audit/*",
 		"raw",
 		"raw/*",
+		"replication/primary/enable",
 		"replication/primary/secondary-token",
+		"replication/primary/revoke-secondary",
+		"replication/secondary/enable",
+		"replication/secondary/update-primary",
+		"replication/secondary/promote",
 		"replication/reindex",
 		"rotate",
 		"config/cors",
@@ -40,6 +49,16 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"leases/revoke-prefix/*",
 		"leases/revoke-force/*",
 		"leases/lookup/*",
+		"leases/irrevocable",
+		"leases/irrevocable/*",
+		"loggers",
+		"loggers/*",
+		"monitor",
+		"pprof",
+		"pprof/*",
+		"host-info",
+		"config/state/sanitized",
+		"in-flight-req",
 	}
 
 	b := testSystemBackend(t)
@@ -1599,6 +1618,251 @@ func TestSystemBackend_rotate(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_loggers(t *testing.T) {
+	logger := logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo)
+	c, _, _ := TestCoreUnsealedWithLogger(t, logger)
+	b := testSystemBackendInternal(t, c)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "loggers")
+	req.Data["level"] = "debug"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "loggers/physical/consul")
+	req.Data["level"] = "trace"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "loggers")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"level": "debug",
+		"subsystems": map[string]interface{}{
+			"physical/consul": "trace",
+		},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+	if !logger.IsTrace() {
+		t.Fatal("trace should be enabled")
+	}
+
+	// A subsystem without a level of its own uses the global one
+	req = logical.TestRequest(t, logical.ReadOperation, "loggers/core")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["level"] != "debug" || resp.Data["own"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "loggers")
+	req.Data["level"] = "verbose"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "loggers/physical/consul")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if logger.IsTrace() || len(logger.SubsystemLevels()) != 0 {
+		t.Fatalf("bad: %#v", logger.SubsystemLevels())
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "loggers")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if logger.Level() != log.LevelInfo {
+		t.Fatalf("bad: %d", logger.Level())
+	}
+}
+
+func TestSystemBackend_loggersUnsupported(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "loggers")
+	req.Data["level"] = "debug"
+	resp, err := b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+}
+
+func TestSystemBackend_monitor(t *testing.T) {
+	logger := logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo)
+	c, _, _ := TestCoreUnsealedWithLogger(t, logger)
+	b := testSystemBackendInternal(t, c)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "monitor")
+	req.Data["log_format"] = "JSON"
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"log_level":  "info",
+		"log_format": "json",
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "monitor")
+	req.Data["log_format"] = "xml"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+}
+
+func TestSystemBackend_pprof(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "pprof/")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	profiles := resp.Data["profiles"].([]string)
+	if !strutil.StrListContains(profiles, "goroutine") || !strutil.StrListContains(profiles, "profile") {
+		t.Fatalf("bad: %#v", profiles)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "pprof/goroutine")
+	req.Data["debug"] = 1
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ct := resp.Data[logical.HTTPContentType]; ct != "text/plain; charset=utf-8" {
+		t.Fatalf("bad: %#v", ct)
+	}
+	if body := string(resp.Data[logical.HTTPRawBody].([]byte)); !strings.HasPrefix(body, "goroutine profile:") {
+		t.Fatalf("bad: %s", body)
+	}
+
+	// The CPU profile is left for the caller to collect
+	req = logical.TestRequest(t, logical.ReadOperation, "pprof/profile")
+	req.Data["seconds"] = 1
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["name"] != "profile" || resp.Data["seconds"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	profile, err := Profile(context.Background(), "profile", 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(profile) == 0 {
+		t.Fatal("empty CPU profile")
+	}
+
+	// Profiles stop with the client
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err := Profile(ctx, "trace", maxProfileSeconds); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("trace did not stop with the context")
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "pprof/profile")
+	req.Data["seconds"] = maxProfileSeconds + 1
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "pprof/unknown")
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+}
+
+func TestSystemBackend_hostInfo(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "host-info")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, key := range []string{"timestamp", "hostname", "os", "num_cpu", "go_version", "memory"} {
+		if _, ok := resp.Data[key]; !ok {
+			t.Fatalf("missing %q in %#v", key, resp.Data)
+		}
+	}
+}
+
+func TestSystemBackend_inFlightRequests(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	start := time.Date(2017, 8, 30, 14, 21, 5, 0, time.UTC)
+	c.StartInFlightRequest("id", &InFlightRequest{
+		Method:           "GET",
+		Path:             "/v1/secret/foo",
+		ClientRemoteAddr: "127.0.0.1:54321",
+		StartTime:        start,
+	})
+	defer c.FinishInFlightRequest("id")
+
+	req := logical.TestRequest(t, logical.ReadOperation, "in-flight-req")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"id": map[string]interface{}{
+			"method":                "GET",
+			"path":                  "/v1/secret/foo",
+			"client_remote_address": "127.0.0.1:54321",
+			"start_time":            "2017-08-30T14:21:05Z",
+			"streaming":             false,
+		},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+}
+
+func TestSystemBackend_configStateSanitized(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "config/state/sanitized")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(resp.Data) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	c.sanitizedConfig = map[string]interface{}{
+		"cluster_name": "vault-cluster",
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data, c.sanitizedConfig) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
 func testSystemBackend(t *testing.T) logical.Backend {
 	c, _, _ := TestCoreUnsealed(t)
 	return testSystemBackendInternal(t, c)
@@ -0,0 +1,556 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	otplib "github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// mfaMethodSubPath is the sub-path used for the MFA method
+	// configurations. This is nested under the system view.
+	mfaMethodSubPath = "mfa/method/"
+
+	// mfaLoginEnforcementSubPath is the sub-path used for the MFA login
+	// enforcements. This is nested under the system view.
+	mfaLoginEnforcementSubPath = "mfa/login-enforcement/"
+
+	// mfaTOTPSecretSubPath is the sub-path used for the TOTP secrets of
+	// enrolled entities. This is nested under the system view.
+	mfaTOTPSecretSubPath = "mfa/totp-secret/"
+
+	// mfaUsedCodeSubPath is the sub-path used for the TOTP passcodes used
+	// recently by enrolled entities. This is nested under the system view.
+	mfaUsedCodeSubPath = "mfa/used-code/"
+
+	mfaDefaultUsernameFormat = "{{alias.name}}"
+)
+
+var (
+	// mfaMethodTypes are the supported MFA method types
+	mfaMethodTypes = []string{"totp", "duo", "okta", "pingid"}
+
+	mfaUsernameTemplateRe = regexp.MustCompile(`{{\s*([^}\s]+)\s*}}`)
+
+	errMFANoEntity = errors.New("MFA validation requires the token to be tied to an identity entity")
+
+	// errMFAStateChanged is returned when the node was sealed or stepped down
+	// while waiting for a push to be accepted
+	errMFAStateChanged = errors.New("the state of the node changed while waiting for MFA")
+)
+
+// MFAMethod is the configuration of a single MFA method. Only the fields
+// relevant to the method type are set.
+type MFAMethod struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	MountAccessor  string `json:"mount_accessor"`
+	UsernameFormat string `json:"username_format"`
+
+	// TOTP
+	Issuer    string `json:"issuer"`
+	Period    uint   `json:"period"`
+	KeySize   uint   `json:"key_size"`
+	Digits    int    `json:"digits"`
+	Algorithm string `json:"algorithm"`
+	Skew      uint   `json:"skew"`
+	QRSize    int    `json:"qr_size"`
+
+	// Duo
+	IntegrationKey string `json:"integration_key"`
+	SecretKey      string `json:"secret_key"`
+	APIHostname    string `json:"api_hostname"`
+	PushInfo       string `json:"push_info"`
+
+	// Okta
+	OrgName    string `json:"org_name"`
+	APIToken   string `json:"api_token"`
+	BaseURL    string `json:"base_url"`
+	Production bool   `json:"production"`
+
+	// PingID
+	UseBase64Key     string `json:"use_base64_key"`
+	UseSignature     bool   `json:"use_signature"`
+	IDPURL           string `json:"idp_url"`
+	OrgAlias         string `json:"org_alias"`
+	AdminURL         string `json:"admin_url"`
+	AuthenticatorURL string `json:"authenticator_url"`
+	PingIDToken      string `json:"pingid_token"`
+}
+
+// MFALoginEnforcement requires the given MFA methods to be validated on
+// logins through the matching auth methods.
+type MFALoginEnforcement struct {
+	Name                string   `json:"name"`
+	MFAMethodNames      []string `json:"mfa_method_names"`
+	AuthMethodAccessors []string `json:"auth_method_accessors"`
+	AuthMethodTypes     []string `json:"auth_method_types"`
+}
+
+// mfaTOTPSecret is the TOTP key generated for an entity
+type mfaTOTPSecret struct {
+	Secret string `json:"secret"`
+}
+
+// mfaUsedCodes are the TOTP passcodes used by an entity, with the time until
+// which they would still be valid
+type mfaUsedCodes struct {
+	Codes map[string]time.Time `json:"codes"`
+}
+
+// mfaValidationError marks err as a failed MFA validation so that the request
+// is rejected as permission denied while keeping the reason.
+func mfaValidationError(err error) error {
+	return errwrap.Wrap(fmt.Errorf("MFA validation failed: %v", err), logical.ErrPermissionDenied)
+}
+
+func (c *Core) mfaView(subPath string) *BarrierView {
+	return c.systemBarrierView.SubView(subPath)
+}
+
+// mfaMethodByName returns the MFA method with the given name, or nil if it
+// does not exist
+func (c *Core) mfaMethodByName(name string) (*MFAMethod, error) {
+	entry, err := c.mfaView(mfaMethodSubPath).Get(name)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read MFA method: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var method MFAMethod
+	if err := entry.DecodeJSON(&method); err != nil {
+		return nil, errwrap.Wrapf("failed to decode MFA method: {{err}}", err)
+	}
+	return &method, nil
+}
+
+func (c *Core) setMFAMethod(method *MFAMethod) error {
+	entry, err := logical.StorageEntryJSON(method.Name, method)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode MFA method: {{err}}", err)
+	}
+	if err := c.mfaView(mfaMethodSubPath).Put(entry); err != nil {
+		return errwrap.Wrapf("failed to persist MFA method: {{err}}", err)
+	}
+	return nil
+}
+
+// deleteMFAMethod removes an MFA method along with the TOTP secrets of the
+// entities enrolled in it
+func (c *Core) deleteMFAMethod(name string) error {
+	if err := c.mfaView(mfaMethodSubPath).Delete(name); err != nil {
+		return errwrap.Wrapf("failed to delete MFA method: {{err}}", err)
+	}
+	if err := logical.ClearView(c.mfaView(mfaTOTPSecretSubPath + name + "/")); err != nil {
+		return errwrap.Wrapf("failed to delete TOTP secrets: {{err}}", err)
+	}
+	if err := logical.ClearView(c.mfaView(mfaUsedCodeSubPath + name + "/")); err != nil {
+		return errwrap.Wrapf("failed to delete used TOTP passcodes: {{err}}", err)
+	}
+	return nil
+}
+
+func (c *Core) mfaLoginEnforcementByName(name string) (*MFALoginEnforcement, error) {
+	entry, err := c.mfaView(mfaLoginEnforcementSubPath).Get(name)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read MFA login enforcement: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var enforcement MFALoginEnforcement
+	if err := entry.DecodeJSON(&enforcement); err != nil {
+		return nil, errwrap.Wrapf("failed to decode MFA login enforcement: {{err}}", err)
+	}
+	return &enforcement, nil
+}
+
+func (c *Core) setMFALoginEnforcement(enforcement *MFALoginEnforcement) error {
+	entry, err := logical.StorageEntryJSON(enforcement.Name, enforcement)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode MFA login enforcement: {{err}}", err)
+	}
+	if err := c.mfaView(mfaLoginEnforcementSubPath).Put(entry); err != nil {
+		return errwrap.Wrapf("failed to persist MFA login enforcement: {{err}}", err)
+	}
+	return nil
+}
+
+// mfaTOTPSecretByEntity returns the TOTP secret of the entity for the given
+// method, or nil if the entity is not enrolled
+func (c *Core) mfaTOTPSecretByEntity(methodName, entityID string) (*mfaTOTPSecret, error) {
+	entry, err := c.mfaView(mfaTOTPSecretSubPath + methodName + "/").Get(entityID)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read TOTP secret: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var secret mfaTOTPSecret
+	if err := entry.DecodeJSON(&secret); err != nil {
+		return nil, errwrap.Wrapf("failed to decode TOTP secret: {{err}}", err)
+	}
+	return &secret, nil
+}
+
+func (c *Core) deleteMFATOTPSecret(methodName, entityID string) error {
+	if err := c.mfaView(mfaTOTPSecretSubPath + methodName + "/").Delete(entityID); err != nil {
+		return errwrap.Wrapf("failed to delete TOTP secret: {{err}}", err)
+	}
+	return nil
+}
+
+// generateMFATOTPSecret enrolls the entity in the TOTP method, returning the
+// key URL and a base64 encoded PNG barcode of it. If the entity is already
+// enrolled nothing is returned.
+func (c *Core) generateMFATOTPSecret(method *MFAMethod, entity *identity.Entity) (string, string, error) {
+	existing, err := c.mfaTOTPSecretByEntity(method.Name, entity.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if existing != nil {
+		return "", "", nil
+	}
+
+	accountName := entity.Name
+	if accountName == "" {
+		accountName = entity.ID
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      method.Issuer,
+		AccountName: accountName,
+		Period:      method.Period,
+		SecretSize:  method.KeySize,
+		Digits:      otplib.Digits(method.Digits),
+		Algorithm:   mfaTOTPAlgorithm(method.Algorithm),
+	})
+	if err != nil {
+		return "", "", errwrap.Wrapf("failed to generate TOTP key: {{err}}", err)
+	}
+
+	image, err := key.Image(method.QRSize, method.QRSize)
+	if err != nil {
+		return "", "", errwrap.Wrapf("failed to generate TOTP barcode: {{err}}", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image); err != nil {
+		return "", "", errwrap.Wrapf("failed to encode TOTP barcode: {{err}}", err)
+	}
+
+	entry, err := logical.StorageEntryJSON(entity.ID, &mfaTOTPSecret{
+		Secret: key.Secret(),
+	})
+	if err != nil {
+		return "", "", errwrap.Wrapf("failed to encode TOTP secret: {{err}}", err)
+	}
+	if err := c.mfaView(mfaTOTPSecretSubPath + method.Name + "/").Put(entry); err != nil {
+		return "", "", errwrap.Wrapf("failed to persist TOTP secret: {{err}}", err)
+	}
+
+	return key.URL(), base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func mfaTOTPAlgorithm(algorithm string) otplib.Algorithm {
+	switch algorithm {
+	case "SHA256":
+		return otplib.AlgorithmSHA256
+	case "SHA512":
+		return otplib.AlgorithmSHA512
+	default:
+		return otplib.AlgorithmSHA1
+	}
+}
+
+// enforceLoginMFA validates the MFA methods of every login enforcement
+// matching the auth method of the login request
+func (c *Core) enforceLoginMFA(req *logical.Request, entity *identity.Entity) error {
+	names, err := c.mfaLoginEnforcementNames()
+	if err != nil {
+		return err
+	}
+
+	var methodNames []string
+	for _, name := range names {
+		enforcement, err := c.mfaLoginEnforcementByName(name)
+		if err != nil {
+			return err
+		}
+		if enforcement == nil {
+			continue
+		}
+		if strutil.StrListContains(enforcement.AuthMethodAccessors, req.MountAccessor) ||
+			strutil.StrListContains(enforcement.AuthMethodTypes, req.MountType) {
+			methodNames = append(methodNames, enforcement.MFAMethodNames...)
+		}
+	}
+	if len(methodNames) == 0 {
+		return nil
+	}
+
+	return c.validateMFA(entity, strutil.RemoveDuplicates(methodNames, false), req.MFACreds)
+}
+
+func (c *Core) mfaLoginEnforcementNames() ([]string, error) {
+	names, err := c.mfaView(mfaLoginEnforcementSubPath).List("")
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to list MFA login enforcements: {{err}}", err)
+	}
+	return names, nil
+}
+
+// validateMFA validates every given MFA method for the entity using the
+// supplied credentials. Failed validations are returned as errors wrapping
+// logical.ErrPermissionDenied; any other error is internal. The state lock
+// must be held for reading; it is released while waiting on push based
+// methods.
+func (c *Core) validateMFA(entity *identity.Entity, methodNames []string, creds logical.MFACreds) error {
+	// Used passcodes are written to storage, so performance standbys leave
+	// any request requiring MFA to the active node
+	if c.perfStandby {
+		return ErrPerfStandbyForward
+	}
+
+	if entity == nil {
+		return mfaValidationError(errMFANoEntity)
+	}
+
+	for _, name := range methodNames {
+		method, err := c.mfaMethodByName(name)
+		if err != nil {
+			c.logger.Error("core: failed to look up MFA method", "method", name, "error", err)
+			return ErrInternalError
+		}
+		if method == nil {
+			return mfaValidationError(fmt.Errorf("MFA method %q does not exist", name))
+		}
+
+		switch method.Type {
+		case "totp":
+			err = c.validateMFATOTP(method, entity, creds[name])
+		case "duo":
+			err = c.withoutStateLock(func() error {
+				return c.validateMFADuo(method, entity, creds[name])
+			})
+		case "okta":
+			err = c.withoutStateLock(func() error {
+				return c.validateMFAOkta(method, entity)
+			})
+		case "pingid":
+			err = c.withoutStateLock(func() error {
+				return c.validateMFAPingID(method, entity)
+			})
+		default:
+			err = fmt.Errorf("unsupported MFA method type %q", method.Type)
+		}
+		if err == errMFAStateChanged {
+			c.logger.Warn("core: sealed or stepped down while waiting for MFA", "method", name)
+			return ErrInternalError
+		}
+		if err == ErrInternalError {
+			return err
+		}
+		if err != nil {
+			return mfaValidationError(errwrap.Wrapf(fmt.Sprintf("method %q: {{err}}", name), err))
+		}
+	}
+
+	return nil
+}
+
+// withoutStateLock runs f with the state lock, which the caller holds for
+// reading, released. Push based MFA methods may wait on the user for up to
+// mfaPushTimeout, and holding the lock for that long would stall sealing
+// and stepping down, and every request queued behind them. If the node
+// was sealed or stepped down in the meantime errMFAStateChanged is
+// returned, since the state the request was checked against is gone.
+func (c *Core) withoutStateLock(f func() error) error {
+	requestContext := c.requestContext
+
+	c.stateLock.RUnlock()
+	err := f()
+	c.stateLock.RLock()
+
+	if c.sealed || c.standby || c.requestContext != requestContext {
+		return errMFAStateChanged
+	}
+	return err
+}
+
+func (c *Core) validateMFATOTP(method *MFAMethod, entity *identity.Entity, creds []string) error {
+	if len(creds) == 0 || creds[0] == "" {
+		return errors.New("missing TOTP passcode")
+	}
+	passcode := creds[0]
+
+	secret, err := c.mfaTOTPSecretByEntity(method.Name, entity.ID)
+	if err != nil {
+		c.logger.Error("core: failed to look up TOTP secret", "method", method.Name, "error", err)
+		return ErrInternalError
+	}
+	if secret == nil {
+		return errors.New("entity is not enrolled in the method")
+	}
+
+	// A passcode can only be used once while it is valid. Used passcodes
+	// are kept in storage so that every node of the cluster sees them.
+	c.mfaUsedCodesLock.Lock()
+	defer c.mfaUsedCodesLock.Unlock()
+
+	used, err := c.mfaUsedCodesByEntity(method.Name, entity.ID)
+	if err != nil {
+		c.logger.Error("core: failed to look up used TOTP passcodes", "method", method.Name, "error", err)
+		return ErrInternalError
+	}
+	now := time.Now().UTC()
+	if validUntil, ok := used.Codes[passcode]; ok && now.Before(validUntil) {
+		return errors.New("passcode has already been used")
+	}
+
+	valid, err := totp.ValidateCustom(passcode, secret.Secret, now, totp.ValidateOpts{
+		Period:    method.Period,
+		Skew:      method.Skew,
+		Digits:    otplib.Digits(method.Digits),
+		Algorithm: mfaTOTPAlgorithm(method.Algorithm),
+	})
+	if err != nil || !valid {
+		return errors.New("invalid TOTP passcode")
+	}
+
+	for code, validUntil := range used.Codes {
+		if !now.Before(validUntil) {
+			delete(used.Codes, code)
+		}
+	}
+	validFor := time.Duration(method.Period*(2*method.Skew+1)) * time.Second
+	used.Codes[passcode] = now.Add(validFor)
+	if err := c.setMFAUsedCodes(method.Name, entity.ID, used); err != nil {
+		c.logger.Error("core: failed to persist used TOTP passcodes", "method", method.Name, "error", err)
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+// mfaUsedCodesByEntity returns the TOTP passcodes used by the entity for the
+// given method
+func (c *Core) mfaUsedCodesByEntity(methodName, entityID string) (*mfaUsedCodes, error) {
+	used := &mfaUsedCodes{
+		Codes: make(map[string]time.Time),
+	}
+
+	entry, err := c.mfaView(mfaUsedCodeSubPath + methodName + "/").Get(entityID)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read used TOTP passcodes: {{err}}", err)
+	}
+	if entry == nil {
+		return used, nil
+	}
+
+	if err := entry.DecodeJSON(used); err != nil {
+		return nil, errwrap.Wrapf("failed to decode used TOTP passcodes: {{err}}", err)
+	}
+	if used.Codes == nil {
+		used.Codes = make(map[string]time.Time)
+	}
+	return used, nil
+}
+
+func (c *Core) setMFAUsedCodes(methodName, entityID string, used *mfaUsedCodes) error {
+	view := c.mfaView(mfaUsedCodeSubPath + methodName + "/")
+	if len(used.Codes) == 0 {
+		return view.Delete(entityID)
+	}
+
+	entry, err := logical.StorageEntryJSON(entityID, used)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode used TOTP passcodes: {{err}}", err)
+	}
+	return view.Put(entry)
+}
+
+// mfaUsername renders the username format of a push based method for the
+// entity. The format may reference {{entity.id}}, {{entity.name}},
+// {{entity.metadata.<key>}}, {{alias.name}} and {{alias.metadata.<key>}},
+// where the alias is the one of the entity on the method's mount accessor.
+// Aliases may also be referenced by their former name, "persona".
+func (m *MFAMethod) mfaUsername(entity *identity.Entity) (string, error) {
+	format := m.UsernameFormat
+	if format == "" {
+		format = mfaDefaultUsernameFormat
+	}
+
+	var alias *identity.Alias
+	for _, a := range entity.Aliases {
+		if a.MountAccessor == m.MountAccessor {
+			alias = a
+			break
+		}
+	}
+
+	var retErr error
+	username := mfaUsernameTemplateRe.ReplaceAllStringFunc(format, func(match string) string {
+		key := mfaUsernameTemplateKey(mfaUsernameTemplateRe.FindStringSubmatch(match)[1])
+		var value string
+		var ok bool
+		switch {
+		case key == "entity.id":
+			value, ok = entity.ID, true
+		case key == "entity.name":
+			value, ok = entity.Name, true
+		case strings.HasPrefix(key, "entity.metadata."):
+			value, ok = entity.Metadata[strings.TrimPrefix(key, "entity.metadata.")]
+		case key == "alias.name" && alias != nil:
+			value, ok = alias.Name, true
+		case strings.HasPrefix(key, "alias.metadata.") && alias != nil:
+			value, ok = alias.Metadata[strings.TrimPrefix(key, "alias.metadata.")]
+		}
+		if !ok || value == "" {
+			retErr = fmt.Errorf("unable to resolve %q in username format", match)
+		}
+		return value
+	})
+	if retErr != nil {
+		return "", retErr
+	}
+
+	return username, nil
+}
+
+// validateMFAUsernameFormat checks that a username format only references
+// supported values
+func validateMFAUsernameFormat(format string) error {
+	for _, match := range mfaUsernameTemplateRe.FindAllStringSubmatch(format, -1) {
+		key := mfaUsernameTemplateKey(match[1])
+		switch {
+		case key == "entity.id", key == "entity.name", key == "alias.name":
+		case strings.HasPrefix(key, "entity.metadata."), strings.HasPrefix(key, "alias.metadata."):
+		default:
+			return fmt.Errorf("unsupported value %q in username format", match[0])
+		}
+	}
+	return nil
+}
+
+func mfaUsernameTemplateKey(key string) string {
+	if strings.HasPrefix(key, "persona.") {
+		return "alias." + strings.TrimPrefix(key, "persona.")
+	}
+	return key
+}
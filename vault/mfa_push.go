@@ -0,0 +1,354 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	duoapi "github.com/duosecurity/duo_api_golang"
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/mfa/duo"
+)
+
+var (
+	// mfaPushTimeout is how long to wait for a push to be accepted
+	mfaPushTimeout = 60 * time.Second
+
+	// mfaPushPollInterval is how often the status of an Okta push is polled
+	mfaPushPollInterval = time.Second
+
+	// mfaHTTPClient is used to talk to the Okta and PingID APIs
+	mfaHTTPClient = cleanhttp.DefaultClient()
+
+	// newMFADuoAuthClient returns the Duo Auth API client for a method
+	newMFADuoAuthClient = func(method *MFAMethod) duo.AuthClient {
+		return authapi.NewAuthApi(*duoapi.NewDuoApi(
+			method.IntegrationKey,
+			method.SecretKey,
+			method.APIHostname,
+			"vault",
+			duoapi.SetTimeout(mfaPushTimeout),
+		))
+	}
+)
+
+func (c *Core) validateMFADuo(method *MFAMethod, entity *identity.Entity, creds []string) error {
+	username, err := method.mfaUsername(entity)
+	if err != nil {
+		return err
+	}
+
+	client := newMFADuoAuthClient(method)
+
+	preauth, err := client.Preauth(authapi.PreauthUsername(username))
+	if err != nil || preauth == nil {
+		return errors.New("could not call Duo preauth")
+	}
+	if preauth.StatResult.Stat != "OK" {
+		return duoStatError("could not look up Duo user information", preauth.StatResult)
+	}
+
+	switch preauth.Response.Result {
+	case "allow":
+		return nil
+	case "auth":
+	case "enroll":
+		return fmt.Errorf("%s (%s)", preauth.Response.Status_Msg, preauth.Response.Enroll_Portal_Url)
+	default:
+		return errors.New(preauth.Response.Status_Msg)
+	}
+
+	factor := "push"
+	options := []func(*url.Values){authapi.AuthUsername(username)}
+	if len(creds) > 0 && creds[0] != "" {
+		factor = "passcode"
+		options = append(options, authapi.AuthPasscode(strings.TrimPrefix(creds[0], "passcode=")))
+	} else {
+		options = append(options, authapi.AuthDevice("auto"))
+		if method.PushInfo != "" {
+			options = append(options, authapi.AuthPushinfo(method.PushInfo))
+		}
+	}
+
+	result, err := client.Auth(factor, options...)
+	if err != nil || result == nil {
+		return errors.New("could not call Duo auth")
+	}
+	if result.StatResult.Stat != "OK" {
+		return duoStatError("could not authenticate Duo user", result.StatResult)
+	}
+	if result.Response.Result != "allow" {
+		return errors.New(result.Response.Status_Msg)
+	}
+
+	return nil
+}
+
+func duoStatError(msg string, stat authapi.StatResult) error {
+	if stat.Message != nil {
+		msg = msg + ": " + *stat.Message
+	}
+	if stat.Message_Detail != nil {
+		msg = msg + " (" + *stat.Message_Detail + ")"
+	}
+	return errors.New(msg)
+}
+
+// oktaURL returns the API URL of the Okta organization. A base URL with a
+// scheme is used as is, which allows pointing at a proxy or a private
+// deployment.
+func (m *MFAMethod) oktaURL() string {
+	if strings.Contains(m.BaseURL, "://") {
+		return strings.TrimSuffix(m.BaseURL, "/")
+	}
+	baseURL := m.BaseURL
+	switch {
+	case baseURL != "":
+	case m.Production:
+		baseURL = "okta.com"
+	default:
+		baseURL = "oktapreview.com"
+	}
+	return fmt.Sprintf("https://%s.%s", m.OrgName, baseURL)
+}
+
+func (c *Core) validateMFAOkta(method *MFAMethod, entity *identity.Entity) error {
+	username, err := method.mfaUsername(entity)
+	if err != nil {
+		return err
+	}
+
+	call := func(httpMethod, u string, out interface{}) error {
+		req, err := http.NewRequest(httpMethod, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "SSWS "+method.APIToken)
+
+		resp, err := mfaHTTPClient.Do(req)
+		if err != nil {
+			return errwrap.Wrapf("error calling Okta: {{err}}", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status code %d from Okta", resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errwrap.Wrapf("error decoding Okta response: {{err}}", err)
+		}
+		return nil
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	if err := call("GET", fmt.Sprintf("%s/api/v1/users/%s", method.oktaURL(), url.PathEscape(username)), &user); err != nil {
+		return err
+	}
+
+	var factors []struct {
+		ID         string `json:"id"`
+		FactorType string `json:"factorType"`
+		Provider   string `json:"provider"`
+	}
+	if err := call("GET", fmt.Sprintf("%s/api/v1/users/%s/factors", method.oktaURL(), user.ID), &factors); err != nil {
+		return err
+	}
+
+	var factorID string
+	for _, factor := range factors {
+		if factor.FactorType == "push" && factor.Provider == "OKTA" {
+			factorID = factor.ID
+			break
+		}
+	}
+	if factorID == "" {
+		return errors.New("user has no Okta push factor enrolled")
+	}
+
+	type verifyResult struct {
+		FactorResult string `json:"factorResult"`
+		Links        struct {
+			Poll struct {
+				Href string `json:"href"`
+			} `json:"poll"`
+		} `json:"_links"`
+	}
+
+	var result verifyResult
+	if err := call("POST", fmt.Sprintf("%s/api/v1/users/%s/factors/%s/verify", method.oktaURL(), user.ID, factorID), &result); err != nil {
+		return err
+	}
+
+	pollURL := result.Links.Poll.Href
+	deadline := time.Now().Add(mfaPushTimeout)
+	for {
+		switch result.FactorResult {
+		case "SUCCESS":
+			return nil
+		case "WAITING":
+		default:
+			return fmt.Errorf("push verification failed: %s", strings.ToLower(result.FactorResult))
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("push verification timed out")
+		}
+		if pollURL == "" {
+			return errors.New("missing poll link in Okta response")
+		}
+		time.Sleep(mfaPushPollInterval)
+
+		result = verifyResult{}
+		if err := call("GET", pollURL, &result); err != nil {
+			return err
+		}
+		if result.Links.Poll.Href != "" {
+			pollURL = result.Links.Poll.Href
+		}
+	}
+}
+
+// parsePingIDSettings parses the contents of a PingID properties file into
+// the method
+func parsePingIDSettings(method *MFAMethod, settings []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(settings))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		splitLine := strings.SplitN(line, "=", 2)
+		if len(splitLine) != 2 {
+			return fmt.Errorf("invalid line in settings file: %q", line)
+		}
+		key, value := strings.TrimSpace(splitLine[0]), strings.TrimSpace(splitLine[1])
+		switch key {
+		case "use_base64_key":
+			method.UseBase64Key = value
+		case "use_signature":
+			method.UseSignature = value == "true"
+		case "token":
+			method.PingIDToken = value
+		case "idp_url":
+			method.IDPURL = value
+		case "org_alias":
+			method.OrgAlias = value
+		case "admin_url":
+			method.AdminURL = value
+		case "authenticator_url":
+			method.AuthenticatorURL = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case method.UseBase64Key == "":
+		return errors.New("missing use_base64_key in settings file")
+	case method.PingIDToken == "":
+		return errors.New("missing token in settings file")
+	case method.IDPURL == "":
+		return errors.New("missing idp_url in settings file")
+	case method.OrgAlias == "":
+		return errors.New("missing org_alias in settings file")
+	}
+	return nil
+}
+
+func (c *Core) validateMFAPingID(method *MFAMethod, entity *identity.Entity) error {
+	username, err := method.mfaUsername(entity)
+	if err != nil {
+		return err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(method.UseBase64Key)
+	if err != nil {
+		return errwrap.Wrapf("error decoding PingID key: {{err}}", err)
+	}
+
+	// The request is a JWT signed with the organization key, and the
+	// response is signed the same way
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"reqHeader": map[string]interface{}{
+			"locale":    "en",
+			"orgAlias":  method.OrgAlias,
+			"secretKey": method.PingIDToken,
+			"timestamp": time.Now().Format("2006-01-02 15:04:05.000"),
+			"version":   "4.9",
+		},
+		"reqBody": map[string]interface{}{
+			"spAlias":  "web",
+			"userName": username,
+			"authType": "CONFIRM",
+			"clientData": []map[string]interface{}{
+				map[string]interface{}{"type": "vault"},
+			},
+		},
+	})
+	token.Header["org_alias"] = method.OrgAlias
+	token.Header["token"] = method.PingIDToken
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return errwrap.Wrapf("error signing PingID request: {{err}}", err)
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(method.IDPURL, "/")+"/rest/4/startauthentication/do", strings.NewReader(signed))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := *mfaHTTPClient
+	client.Timeout = mfaPushTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return errwrap.Wrapf("error calling PingID: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errwrap.Wrapf("error reading PingID response: {{err}}", err)
+	}
+
+	parsed, err := jwt.Parse(strings.TrimSpace(string(body)), func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %q", t.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return errwrap.Wrapf("error parsing PingID response: {{err}}", err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return errors.New("invalid PingID response")
+	}
+	respBody, ok := claims["responseBody"].(map[string]interface{})
+	if !ok {
+		return errors.New("missing response body in PingID response")
+	}
+	if errorID, _ := respBody["errorId"].(float64); errorID != 200 {
+		return fmt.Errorf("push verification failed: %v", respBody["errorMsg"])
+	}
+
+	return nil
+}
@@ -0,0 +1,486 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	duoapi "github.com/duosecurity/duo_api_golang"
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/mfa/duo"
+	"github.com/hashicorp/vault/logical"
+	otplib "github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func testMFAHandleRequest(t *testing.T, c *Core, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	req := logical.TestRequest(t, op, path)
+	req.ClientToken = token
+	req.Data = data
+	resp, err := c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: path: %s, resp: %#v, err: %v", path, resp, err)
+	}
+	return resp
+}
+
+func TestMFA_PathTOTP(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/totp/my_totp", map[string]interface{}{
+		"issuer": "vault",
+	})
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	policy, err := Parse(`
+name = "mfa"
+
+path "secret/foo" {
+	capabilities = ["read"]
+	mfa_methods = ["my_totp"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entityID := testControlGroupEntity(t, c, "mfa-user")
+	token := testControlGroupToken(t, c, entityID, []string{"default", "mfa"})
+
+	read := func(creds logical.MFACreds) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = token
+		req.MFACreds = creds
+		return c.HandleRequest(req)
+	}
+
+	// Not enrolled yet
+	resp, err := read(logical.MFACreds{"my_totp": []string{"123456"}})
+	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got resp: %#v, err: %v", resp, err)
+	}
+
+	resp = testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/totp/my_totp/admin-generate", map[string]interface{}{
+		"entity_id": entityID,
+	})
+	if resp.Data["barcode"].(string) == "" {
+		t.Fatalf("missing barcode")
+	}
+	key, err := otplib.NewKeyFromURL(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Generating again returns a warning rather than a new secret
+	resp = testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/totp/my_totp/admin-generate", map[string]interface{}{
+		"entity_id": entityID,
+	})
+	if len(resp.Warnings) == 0 || resp.Data != nil {
+		t.Fatalf("expected a warning, got %#v", resp)
+	}
+
+	// Missing and invalid passcodes are rejected
+	resp, err = read(nil)
+	if err == nil || !strings.Contains(resp.Data["error"].(string), "missing TOTP passcode") {
+		t.Fatalf("expected missing passcode error, got resp: %#v, err: %v", resp, err)
+	}
+	resp, err = read(logical.MFACreds{"my_totp": []string{"000000"}})
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err = read(logical.MFACreds{"my_totp": []string{code}})
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A passcode cannot be used twice
+	resp, err = read(logical.MFACreds{"my_totp": []string{code}})
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+
+	// Used passcodes are kept in storage so that they can't be replayed
+	// against another node either
+	used, err := c.mfaUsedCodesByEntity("my_totp", entityID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := used.Codes[code]; !ok {
+		t.Fatalf("bad: %#v", used)
+	}
+
+	// Root tokens are not subject to MFA
+	testMFAHandleRequest(t, c, root, logical.ReadOperation, "secret/foo", nil)
+
+	// Removing the secret unenrolls the entity
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/totp/my_totp/admin-destroy", map[string]interface{}{
+		"entity_id": entityID,
+	})
+	secret, err := c.mfaTOTPSecretByEntity("my_totp", entityID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if secret != nil {
+		t.Fatalf("expected secret to be removed")
+	}
+}
+
+func TestMFA_MethodConfig(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/okta/my_okta", map[string]interface{}{
+		"org_name":        "example",
+		"api_token":       "secret-token",
+		"mount_accessor":  c.router.MatchingMountEntry("auth/token/").Accessor,
+		"username_format": "{{entity.metadata.email}}",
+	})
+
+	resp := testMFAHandleRequest(t, c, root, logical.ReadOperation, "sys/mfa/method/okta/my_okta", nil)
+	if resp.Data["org_name"] != "example" || resp.Data["username_format"] != "{{entity.metadata.email}}" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["id"] == "" || resp.Data["production"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A mount accessor is required for push based methods
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/duo/my_duo")
+	req.ClientToken = root
+	req.Data["integration_key"] = "ikey"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// The name is already used by another type
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/my_okta")
+	req.ClientToken = root
+	req.Data["issuer"] = "vault"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Unsupported username format values are rejected
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/okta/my_okta")
+	req.ClientToken = root
+	req.Data["username_format"] = "{{token.id}}"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	resp = testMFAHandleRequest(t, c, root, logical.ListOperation, "sys/mfa/method", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "my_okta" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testMFAHandleRequest(t, c, root, logical.DeleteOperation, "sys/mfa/method/okta/my_okta", nil)
+	method, err := c.mfaMethodByName("my_okta")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if method != nil {
+		t.Fatalf("expected method to be deleted")
+	}
+}
+
+// testMFALogin enables a noop credential backend returning an alias, and
+// returns a function logging in through it with the given MFA credentials
+func testMFALogin(t *testing.T, c *Core, root string) func(logical.MFACreds) (*logical.Response, error) {
+	c.credentialBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return &NoopBackend{
+			Login: []string{"login"},
+			Response: &logical.Response{
+				Auth: &logical.Auth{
+					Policies: []string{"default"},
+					Alias: &logical.Alias{
+						Name: "mfa-user",
+					},
+				},
+			},
+		}, nil
+	}
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+
+	return func(creds logical.MFACreds) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "auth/foo/login",
+			Connection: &logical.Connection{},
+			MFACreds:   creds,
+		})
+	}
+}
+
+func TestMFA_LoginOkta(t *testing.T) {
+	oldInterval := mfaPushPollInterval
+	mfaPushPollInterval = 10 * time.Millisecond
+	defer func() {
+		mfaPushPollInterval = oldInterval
+	}()
+
+	var factorResult string
+	var polled, stateLocked bool
+	var c *Core
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "SSWS secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/api/v1/users/mfa-user":
+			fmt.Fprint(w, `{"id": "user1"}`)
+		case r.URL.Path == "/api/v1/users/user1/factors":
+			fmt.Fprint(w, `[{"id": "sms1", "factorType": "sms", "provider": "OKTA"}, {"id": "push1", "factorType": "push", "provider": "OKTA"}]`)
+		case r.URL.Path == "/api/v1/users/user1/factors/push1/verify" && r.Method == "POST":
+			polled = false
+			fmt.Fprintf(w, `{"factorResult": "WAITING", "_links": {"poll": {"href": "%s/poll"}}}`, ts.URL)
+		case r.URL.Path == "/poll":
+			if !polled {
+				polled = true
+
+				// The state lock is not held while waiting on the user
+				lockedCh := make(chan struct{})
+				go func() {
+					c.stateLock.Lock()
+					c.stateLock.Unlock()
+					close(lockedCh)
+				}()
+				select {
+				case <-lockedCh:
+				case <-time.After(5 * time.Second):
+					stateLocked = true
+				}
+
+				fmt.Fprint(w, `{"factorResult": "WAITING"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"factorResult": "%s"}`, factorResult)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	var root string
+	c, _, root = TestCoreUnsealed(t)
+	login := testMFALogin(t, c, root)
+
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/okta/my_okta", map[string]interface{}{
+		"api_token":       "secret-token",
+		"base_url":        ts.URL,
+		"username_format": "{{alias.name}}",
+		"mount_accessor":  c.router.MatchingMountEntry("auth/foo/").Accessor,
+	})
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/login-enforcement/noop", map[string]interface{}{
+		"mfa_method_names":  "my_okta",
+		"auth_method_types": "noop",
+	})
+
+	factorResult = "REJECTED"
+	resp, err := login(logical.MFACreds{"my_okta": nil})
+	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got resp: %#v, err: %v", resp, err)
+	}
+	if resp == nil || !strings.Contains(resp.Data["error"].(string), "rejected") {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	factorResult = "SUCCESS"
+	resp, err = login(logical.MFACreds{"my_okta": nil})
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("expected a token, got %#v", resp)
+	}
+	if stateLocked {
+		t.Fatal("the state lock was held while waiting on the push")
+	}
+}
+
+func TestMFA_LoginDuo(t *testing.T) {
+	var authFactor, authPasscode string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("username") != "mfa-user@example.com" {
+			fmt.Fprint(w, `{"stat": "OK", "response": {"result": "deny", "status_msg": "unknown user"}}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/auth/v2/preauth":
+			fmt.Fprint(w, `{"stat": "OK", "response": {"result": "auth"}}`)
+		case "/auth/v2/auth":
+			authFactor = r.Form.Get("factor")
+			authPasscode = r.Form.Get("passcode")
+			fmt.Fprint(w, `{"stat": "OK", "response": {"result": "allow"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	oldClient := newMFADuoAuthClient
+	newMFADuoAuthClient = func(method *MFAMethod) duo.AuthClient {
+		return authapi.NewAuthApi(*duoapi.NewDuoApi(
+			method.IntegrationKey,
+			method.SecretKey,
+			method.APIHostname,
+			"vault",
+			duoapi.SetInsecure(),
+		))
+	}
+	defer func() {
+		newMFADuoAuthClient = oldClient
+	}()
+
+	c, _, root := TestCoreUnsealed(t)
+	login := testMFALogin(t, c, root)
+
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/duo/my_duo", map[string]interface{}{
+		"integration_key": "ikey",
+		"secret_key":      "skey",
+		"api_hostname":    strings.TrimPrefix(ts.URL, "https://"),
+		"mount_accessor":  c.router.MatchingMountEntry("auth/foo/").Accessor,
+		"username_format": "{{entity.name}}@example.com",
+	})
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/login-enforcement/noop", map[string]interface{}{
+		"mfa_method_names":      "my_duo",
+		"auth_method_accessors": c.router.MatchingMountEntry("auth/foo/").Accessor,
+	})
+
+	// The entity is created by the first login, so the username does not
+	// resolve to a known Duo user until it is renamed
+	resp, err := login(nil)
+	if err == nil {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+	entity, err := c.identityStore.EntityByAliasFactors(c.router.MatchingMountEntry("auth/foo/").Accessor, "mfa-user", false)
+	if err != nil || entity == nil {
+		t.Fatalf("bad: entity: %#v, err: %v", entity, err)
+	}
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "identity/entity/id/"+entity.ID, map[string]interface{}{
+		"name": "mfa-user",
+	})
+
+	resp, err = login(nil)
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if authFactor != "push" {
+		t.Fatalf("bad: factor: %q", authFactor)
+	}
+
+	resp, err = login(logical.MFACreds{"my_duo": []string{"123456"}})
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if authFactor != "passcode" || authPasscode != "123456" {
+		t.Fatalf("bad: factor: %q, passcode: %q", authFactor, authPasscode)
+	}
+}
+
+func TestMFA_PathPingID(t *testing.T) {
+	key := []byte("pingid-org-key")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pingid/rest/4/startauthentication/do" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		token, err := jwt.Parse(string(body), func(*jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		errorID := 200
+		if err != nil {
+			errorID = 10002
+		} else {
+			reqBody := token.Claims.(jwt.MapClaims)["reqBody"].(map[string]interface{})
+			if reqBody["userName"] != "mfa-user" {
+				errorID = 10003
+			}
+		}
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"responseBody": map[string]interface{}{
+				"errorId":  errorID,
+				"errorMsg": "done",
+			},
+		}).SignedString(key)
+		fmt.Fprint(w, signed)
+	}))
+	defer ts.Close()
+
+	c, _, root := TestCoreUnsealed(t)
+
+	settings := strings.Join([]string{
+		"use_base64_key=" + base64.StdEncoding.EncodeToString(key),
+		"use_signature=true",
+		"token=org-token",
+		"idp_url=" + ts.URL + "/pingid",
+		"org_alias=org-alias",
+		"admin_url=" + ts.URL + "/admin",
+		"authenticator_url=" + ts.URL + "/auth",
+	}, "\n")
+	testMFAHandleRequest(t, c, root, logical.UpdateOperation, "sys/mfa/method/pingid/my_pingid", map[string]interface{}{
+		"settings_file_base64": base64.StdEncoding.EncodeToString([]byte(settings)),
+		"mount_accessor":       c.router.MatchingMountEntry("auth/token/").Accessor,
+		"username_format":      "{{entity.name}}",
+	})
+	resp := testMFAHandleRequest(t, c, root, logical.ReadOperation, "sys/mfa/method/pingid/my_pingid", nil)
+	if resp.Data["org_alias"] != "org-alias" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if raw, _ := json.Marshal(resp.Data); strings.Contains(string(raw), "org-token") {
+		t.Fatalf("token must not be returned: %s", raw)
+	}
+
+	policy, err := Parse(`
+name = "mfa"
+
+path "sys/policy" {
+	capabilities = ["list"]
+	mfa_methods = ["my_pingid"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entityID := testControlGroupEntity(t, c, "mfa-user")
+	token := testControlGroupToken(t, c, entityID, []string{"default", "mfa"})
+	testMFAHandleRequest(t, c, token, logical.ListOperation, "sys/policy", nil)
+
+	// A token without an entity cannot satisfy MFA
+	token = testControlGroupToken(t, c, "", []string{"default", "mfa"})
+	req := logical.TestRequest(t, logical.ListOperation, "sys/policy")
+	req.ClientToken = token
+	resp, err = c.HandleRequest(req)
+	if err == nil || !strings.Contains(resp.Data["error"].(string), errMFANoEntity.Error()) {
+		t.Fatalf("expected error, got resp: %#v, err: %v", resp, err)
+	}
+}
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/json"
 	"errors"
@@ -231,7 +232,7 @@ func (c *Core) mount(entry *MountEntry) error {
 		entry.Accessor = accessor
 	}
 	viewPath := backendBarrierPrefix + entry.UUID + "/"
-	view := NewBarrierView(c.barrier, viewPath)
+	view := c.mountEntryBarrierView(entry, viewPath)
 	sysView := c.mountEntrySysView(entry)
 	conf := make(map[string]string)
 	if entry.Config.PluginName != "" {
@@ -493,12 +494,12 @@ func (c *Core) loadMounts() error {
 	mountTable := &MountTable{}
 	localMountTable := &MountTable{}
 	// Load the existing mount table
-	raw, err := c.barrier.Get(coreMountConfigPath)
+	raw, err := c.barrier.Get(context.Background(), coreMountConfigPath)
 	if err != nil {
 		c.logger.Error("core: failed to read mount table", "error", err)
 		return errLoadMountsFailed
 	}
-	rawLocal, err := c.barrier.Get(coreLocalMountConfigPath)
+	rawLocal, err := c.barrier.Get(context.Background(), coreLocalMountConfigPath)
 	if err != nil {
 		c.logger.Error("core: failed to read local mount table", "error", err)
 		return errLoadMountsFailed
@@ -598,6 +599,16 @@ func (c *Core) loadMounts() error {
 
 // persistMounts is used to persist the mount table after modification
 func (c *Core) persistMounts(table *MountTable, localOnly bool) error {
+	// Performance standbys leave any changes to the active node
+	if c.perfStandby {
+		return logical.ErrReadOnly
+	}
+
+	// Secondaries receive the shared table from their primary
+	if c.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		localOnly = true
+	}
+
 	if table.Type != mountTableType {
 		c.logger.Error("core: given table to persist has wrong type", "actual_type", table.Type, "expected_type", mountTableType)
 		return fmt.Errorf("invalid table type given, not persisting")
@@ -641,7 +652,7 @@ func (c *Core) persistMounts(table *MountTable, localOnly bool) error {
 		}
 
 		// Write to the physical backend
-		if err := c.barrier.Put(entry); err != nil {
+		if err := c.barrier.Put(context.Background(), entry); err != nil {
 			c.logger.Error("core: failed to persist mount table", "error", err)
 			return err
 		}
@@ -659,7 +670,7 @@ func (c *Core) persistMounts(table *MountTable, localOnly bool) error {
 		Value: compressedBytes,
 	}
 
-	if err := c.barrier.Put(entry); err != nil {
+	if err := c.barrier.Put(context.Background(), entry); err != nil {
 		c.logger.Error("core: failed to persist local mount table", "error", err)
 		return err
 	}
@@ -686,7 +697,7 @@ func (c *Core) setupMounts() error {
 		}
 
 		// Create a barrier view using the UUID
-		view = NewBarrierView(c.barrier, barrierPath)
+		view = c.mountEntryBarrierView(entry, barrierPath)
 		sysView := c.mountEntrySysView(entry)
 		// Set up conf to pass in plugin_name
 		conf := make(map[string]string)
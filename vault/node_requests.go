@@ -0,0 +1,316 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+// nodePaths are the paths of the system backend that report on or control
+// the node handling the request rather than the cluster, so standbys serve
+// them instead of sending the client to the active node. Paths ending in a
+// slash match anything below them.
+var nodePaths = []string{
+	"sys/config/state/sanitized",
+	"sys/host-info",
+	"sys/in-flight-req",
+	"sys/loggers",
+	"sys/loggers/",
+	"sys/monitor",
+	"sys/pprof",
+	"sys/pprof/",
+}
+
+// isNodePath returns whether the request path is one of the node paths
+func isNodePath(path string) bool {
+	for _, nodePath := range nodePaths {
+		if path == nodePath || (strings.HasSuffix(nodePath, "/") && strings.HasPrefix(path, nodePath)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleNodeRequest handles a request that may be for one of the node
+// paths. Active nodes and performance standbys handle these like any other
+// request. Other standbys have neither the token store nor the policies set
+// up, so they read the token and its policies from storage and pass the
+// request to the system backend directly.
+func (c *Core) HandleNodeRequest(req *logical.Request) (*logical.Response, error) {
+	if !isNodePath(req.Path) {
+		return c.HandleRequest(req)
+	}
+
+	c.stateLock.RLock()
+	if c.sealed || !c.standby || c.perfStandby {
+		c.stateLock.RUnlock()
+		return c.HandleRequest(req)
+	}
+	defer c.stateLock.RUnlock()
+
+	return c.handleStandbyNodeRequest(req)
+}
+
+// handleStandbyNodeRequest authorizes a request for a node path on a standby
+// and hands it to the system backend. As all the node paths are root paths,
+// the token needs sudo on them. The request and response are audited by the
+// audit devices of the cluster, set up on the standby for these requests,
+// and the request is refused if they can't be. The state lock must be held.
+func (c *Core) handleStandbyNodeRequest(req *logical.Request) (retResp *logical.Response, retErr error) {
+	defer metrics.MeasureSince([]string{"core", "handle_standby_node_request"}, time.Now())
+
+	if req.ClientToken == "" {
+		return logical.ErrorResponse("missing client token"), logical.ErrInvalidRequest
+	}
+
+	broker, headers, err := c.standbyAuditBroker()
+	if err != nil {
+		c.logger.Error("core: failed to set up audit devices on standby", "error", err)
+		return nil, ErrInternalError
+	}
+
+	// Route the request the way the router would for the sys/ mount, so
+	// that audit filters on the mount match
+	req.MountPoint = "sys/"
+	req.MountType = "system"
+	defer func() {
+		req.MountPoint = ""
+		req.MountType = ""
+	}()
+
+	auth, err := c.checkStandbyNodeToken(req)
+	if auditErr := broker.LogRequest(auth, req, headers, err); auditErr != nil {
+		c.logger.Error("core: failed to audit request", "path", req.Path, "error", auditErr)
+		return nil, ErrInternalError
+	}
+	if err != nil {
+		if err == ErrInternalError {
+			return nil, err
+		}
+		return logical.ErrorResponse(err.Error()), logical.ErrPermissionDenied
+	}
+
+	originalPath := req.Path
+	req.Path = strings.TrimPrefix(req.Path, "sys/")
+	resp, err := c.standbySystemBackend().HandleRequest(req)
+	req.Path = originalPath
+
+	if auditErr := broker.LogResponse(auth, req, resp, headers, err); auditErr != nil {
+		c.logger.Error("core: failed to audit response", "request_path", req.Path, "error", auditErr)
+		return nil, ErrInternalError
+	}
+	return resp, err
+}
+
+// checkStandbyNodeToken checks that the token of a request for a node path
+// on a standby has sudo on it, and returns the auth to audit the request
+// with
+func (c *Core) checkStandbyNodeToken(req *logical.Request) (*logical.Auth, error) {
+	acl, te, err := c.standbyACL(req.ClientToken)
+	if err != nil {
+		c.logger.Error("core: failed to check token on standby", "error", err)
+		return nil, ErrInternalError
+	}
+	if te == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	auth := &logical.Auth{
+		ClientToken: req.ClientToken,
+		Accessor:    te.Accessor,
+		Policies:    te.Policies,
+		Metadata:    te.Meta,
+		DisplayName: te.DisplayName,
+		EntityID:    te.EntityID,
+	}
+
+	// Using up a limited use token, validating MFA and holding the request
+	// for a control group all need the active node
+	switch {
+	case te.NumUses != 0:
+		return auth, fmt.Errorf("tokens with a limited number of uses cannot be used on standby nodes")
+	case len(acl.MFAMethods(req.Path)) > 0, acl.ControlGroup(req.Path) != nil:
+		return auth, fmt.Errorf("paths requiring MFA or a control group cannot be used on standby nodes")
+	}
+
+	allowed, rootPrivs := acl.AllowOperation(req)
+	if !allowed || !rootPrivs {
+		return auth, logical.ErrPermissionDenied
+	}
+
+	req.DisplayName = te.DisplayName
+	req.EntityID = te.EntityID
+	return auth, nil
+}
+
+// standbyACL looks up a token and builds its ACL straight from storage.
+// Policies granted through identity are not taken into account, and leases
+// are left for the active node to expire, as on performance standbys.
+func (c *Core) standbyACL(clientToken string) (*ACL, *TokenEntry, error) {
+	// The cache of a standby is not kept up to date with the writes of the
+	// active node, so the entries read are refreshed from storage
+	view := NewBarrierView(c.barrier, systemBarrierPrefix).WithContext(physical.CacheRefreshContext(context.Background()))
+	view.readonly = true
+
+	ts := &TokenStore{
+		view:                view.SubView(tokenSubPath),
+		batchTokenEncryptor: c.barrier,
+		logger:              c.logger,
+		tokenLocks:          locksutil.CreateLocks(),
+		saltLock:            sync.RWMutex{},
+		saltConfig: &salt.Config{
+			HashFunc: salt.SHA1Hash,
+			Location: salt.DefaultLocation,
+		},
+		expiration: &ExpirationManager{},
+	}
+	te, err := ts.Lookup(clientToken)
+	if err != nil || te == nil {
+		return nil, nil, err
+	}
+
+	ps := NewPolicyStore(view.SubView(policySubPath), &dynamicSystemView{core: c})
+	acl, err := ps.ACL(te.Policies...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to construct ACL: %v", err)
+	}
+	return acl, te, nil
+}
+
+// standbyAudit holds the audit devices set up on a standby to audit the
+// requests it serves for the node paths
+type standbyAudit struct {
+	// tables are the audit tables read from storage that the broker was
+	// set up from
+	tables  []byte
+	entries []*MountEntry
+	broker  *AuditBroker
+}
+
+// standbyAuditBroker returns an audit broker with the audit devices of the
+// cluster as they are in storage, and the audited headers configuration. The
+// broker is kept until the audit tables change. Audit devices that need to
+// write to storage, such as to create their salt, fail until the active node
+// has done so.
+func (c *Core) standbyAuditBroker() (*AuditBroker, *AuditedHeadersConfig, error) {
+	ctx := physical.CacheRefreshContext(context.Background())
+
+	var tables []byte
+	table := &MountTable{}
+	for _, path := range []string{coreAuditConfigPath, coreLocalAuditConfigPath} {
+		raw, err := c.barrier.Get(ctx, path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read audit table: %v", err)
+		}
+		if raw == nil {
+			continue
+		}
+		tables = append(tables, raw.Value...)
+
+		var t MountTable
+		if err := jsonutil.DecodeJSON(raw.Value, &t); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode audit table: %v", err)
+		}
+		table.Entries = append(table.Entries, t.Entries...)
+	}
+
+	headers := &AuditedHeadersConfig{
+		Headers: make(map[string]*auditedHeaderSettings),
+	}
+	view := NewBarrierView(c.barrier, systemBarrierPrefix+auditedHeadersSubPath).WithContext(ctx)
+	out, err := view.Get(auditedHeadersEntry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read audited headers: %v", err)
+	}
+	if out != nil {
+		var config map[string]*auditedHeaderSettings
+		if err := out.DecodeJSON(&config); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode audited headers: %v", err)
+		}
+		for k, v := range config {
+			headers.Headers[strings.ToLower(k)] = v
+		}
+	}
+
+	c.standbyAuditLock.Lock()
+	defer c.standbyAuditLock.Unlock()
+
+	if c.standbyAudit != nil && bytes.Equal(c.standbyAudit.tables, tables) {
+		return c.standbyAudit.broker, headers, nil
+	}
+	c.teardownStandbyAuditLocked()
+
+	broker := NewAuditBroker(c.logger)
+	var successCount int
+	for _, entry := range table.Entries {
+		view := NewBarrierView(c.barrier, auditBarrierPrefix+entry.UUID+"/").WithContext(ctx)
+		view.readonly = true
+
+		filter, err := parseAuditFilter(entry.Options)
+		if err != nil {
+			c.logger.Error("core: failed to parse audit filter", "path", entry.Path, "error", err)
+			continue
+		}
+		backend, err := c.newAuditBackend(entry, view, entry.Options)
+		if err != nil {
+			c.logger.Error("core: failed to create audit entry", "path", entry.Path, "error", err)
+			continue
+		}
+		broker.Register(entry.Path, backend, view, filter)
+		successCount++
+	}
+	if len(table.Entries) > 0 && successCount == 0 {
+		return nil, nil, errLoadAuditFailed
+	}
+
+	c.standbyAudit = &standbyAudit{
+		tables:  tables,
+		entries: table.Entries,
+		broker:  broker,
+	}
+	return broker, headers, nil
+}
+
+// teardownStandbyAudit removes the audit devices set up on a standby, once it
+// becomes active and sets up its own
+func (c *Core) teardownStandbyAudit() {
+	c.standbyAuditLock.Lock()
+	defer c.standbyAuditLock.Unlock()
+
+	c.teardownStandbyAuditLocked()
+}
+
+// teardownStandbyAuditLocked is teardownStandbyAudit with the lock held
+func (c *Core) teardownStandbyAuditLocked() {
+	if c.standbyAudit == nil {
+		return
+	}
+	for _, entry := range c.standbyAudit.entries {
+		c.removeAuditReloadFunc(entry)
+	}
+	c.standbyAudit = nil
+}
+
+// standbySystemBackend returns the system backend used to serve the node
+// paths on a standby, which has no mounts set up
+func (c *Core) standbySystemBackend() *SystemBackend {
+	c.nodeSystemBackendOnce.Do(func() {
+		b := NewSystemBackend(c)
+		b.Setup(&logical.BackendConfig{
+			Logger: c.logger,
+			System: &dynamicSystemView{core: c},
+		})
+		c.nodeSystemBackend = b
+	})
+	return c.nodeSystemBackend
+}
@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/logical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestCore_HandleNodeRequest_Standby(t *testing.T) {
+	logger := logformat.NewControlledVaultLogger(ioutil.Discard, log.LevelInfo)
+	var auditLock sync.Mutex
+	var audits []*NoopAudit
+	cluster := NewTestCluster(t, &CoreConfig{
+		Logger: logger,
+		AuditBackends: map[string]audit.Factory{
+			"noop": func(config *audit.BackendConfig) (audit.Backend, error) {
+				auditLock.Lock()
+				defer auditLock.Unlock()
+				noop := &NoopAudit{
+					Config: config,
+				}
+				audits = append(audits, noop)
+				return noop, nil
+			},
+		},
+	}, nil)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	active := cluster.Cores[0].Core
+	standby := cluster.Cores[1].Core
+	root := cluster.RootToken
+	TestWaitActive(t, active)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other paths send the client to the active node
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/mounts")
+	req.ClientToken = root
+	if _, err := standby.HandleNodeRequest(req); err != consts.ErrStandby {
+		t.Fatalf("expected standby error, got %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/loggers")
+	if _, err := standby.HandleNodeRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/loggers/core")
+	req.Data["level"] = "debug"
+	req.ClientToken = root
+	if _, err := standby.HandleNodeRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/loggers/core")
+	req.ClientToken = root
+	resp, err := standby.HandleNodeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["level"] != "debug" || resp.Data["own"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Requests are audited by the audit devices of the cluster, and refused
+	// if they can't be
+	auditLock.Lock()
+	noop := audits[len(audits)-1]
+	auditLock.Unlock()
+	if len(noop.Req) != 2 || noop.Req[0].Path != "sys/loggers/core" || noop.Req[0].Operation != logical.UpdateOperation {
+		t.Fatalf("bad: %#v", noop.Req)
+	}
+	if len(noop.Resp) != 2 || noop.Resp[1].Data["level"] != "debug" {
+		t.Fatalf("bad: %#v", noop.Resp)
+	}
+	noop.ReqErr = fmt.Errorf("audit failure")
+	if _, err := standby.HandleNodeRequest(req); err != ErrInternalError {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	noop.ReqErr = nil
+
+	// Tokens need sudo on the path, through the policies they have in
+	// storage
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policy/loggers")
+	req.Data["rules"] = `path "sys/loggers*" { capabilities = ["read", "sudo"] }`
+	req.ClientToken = root
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	sudoToken := testCreateToken(t, active, root, []string{"loggers"})
+	token := testCreateToken(t, active, root, []string{"default"})
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/loggers")
+	req.ClientToken = sudoToken
+	if _, err := standby.HandleNodeRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	req.ClientToken = token
+	if _, err := standby.HandleNodeRequest(req); err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	// Revocations on the active node are seen right away
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/revoke")
+	req.Data["token"] = sudoToken
+	req.ClientToken = root
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/loggers")
+	req.ClientToken = sudoToken
+	if _, err := standby.HandleNodeRequest(req); err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
+
+func testCreateToken(t *testing.T, c *Core, root string, policies []string) string {
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.Data["policies"] = policies
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Auth.ClientToken
+}
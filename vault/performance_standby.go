@@ -0,0 +1,642 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+	"golang.org/x/net/context"
+)
+
+const (
+	// invalidationLogSize is the number of written keys kept by the active
+	// node for performance standbys. A standby that falls further behind
+	// reloads all of its state.
+	invalidationLogSize = 4096
+)
+
+var (
+	// ErrPerfStandbyForward is returned by a performance standby for requests
+	// that must be handled by the active node
+	ErrPerfStandbyForward = errors.New("request must be handled by the active node")
+
+	// perfStandbyInvalidationInterval is how often a performance standby
+	// fetches the keys written by the active node, and so about how far
+	// behind the active node the reads it serves may be. It's var not const
+	// so that tests can manipulate it.
+	perfStandbyInvalidationInterval = 500 * time.Millisecond
+
+	// perfStandbyMaxSyncFailures and perfStandbyMaxStaleness bound how long
+	// a performance standby keeps serving reads while it cannot sync with
+	// the active node. Past either, everything is forwarded until a sync
+	// succeeds again. They're var not const so that tests can manipulate
+	// them.
+	perfStandbyMaxSyncFailures = 10
+	perfStandbyMaxStaleness    = 10 * time.Second
+)
+
+// PerfStandby returns whether this node is a standby that is currently
+// serving read requests
+func (c *Core) PerfStandby() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	return c.perfStandby
+}
+
+// newBarrierView returns a view of the barrier at the given prefix. Views
+// created while setting up a performance standby are read-only.
+func (c *Core) newBarrierView(prefix string) *BarrierView {
+	view := NewBarrierView(c.barrier, prefix)
+	view.readonly = c.perfStandby
+	return view
+}
+
+// perfStandbyLocal returns whether a request can be handled by a performance
+// standby. Anything that may write to storage is left to the active node.
+func (c *Core) perfStandbyLocal(req *logical.Request) bool {
+	// Requests about the node itself are served whatever they do
+	if isNodePath(req.Path) {
+		return true
+	}
+
+	switch req.Operation {
+	case logical.ReadOperation, logical.ListOperation, logical.HelpOperation:
+	default:
+		return false
+	}
+
+	// Wrapping writes the response to a cubbyhole, and used MFA passcodes are
+	// written to storage
+	if req.WrapInfo != nil || len(req.MFACreds) > 0 {
+		return false
+	}
+	if c.router.LoginPath(req.Path) {
+		return false
+	}
+
+	// Leases are only registered by the active node, so reads from mounts
+	// that may return them are left to it
+	return req.Operation != logical.ReadOperation || !c.generatesLeases(req.Path)
+}
+
+// leaseGenerator is implemented by backends that can tell whether they may
+// return leased secrets
+type leaseGenerator interface {
+	GeneratesLeases() bool
+}
+
+// generatesLeases returns whether the backend mounted at the path may return
+// leased secrets. Backends that cannot tell are assumed to.
+func (c *Core) generatesLeases(path string) bool {
+	backend := c.router.MatchingBackend(path)
+	if backend == nil {
+		return false
+	}
+	if lg, ok := backend.(leaseGenerator); ok {
+		return lg.GeneratesLeases()
+	}
+	return true
+}
+
+// perfStandbyForward returns whether the outcome of a request handled by a
+// performance standby shows that it needs to be handled by the active node
+func perfStandbyForward(resp *logical.Response, err error) bool {
+	readOnly := logical.ErrReadOnly.Error()
+	switch {
+	case err == nil:
+	case err == ErrPerfStandbyForward, strings.Contains(err.Error(), ErrPerfStandbyForward.Error()):
+		return true
+	case strings.Contains(err.Error(), readOnly):
+		return true
+	}
+	return resp != nil && resp.IsError() && strings.Contains(resp.Error().Error(), readOnly)
+}
+
+// heldAuditKey is the context key of the request entries held for a request
+// by holdAudit
+type heldAuditKey struct{}
+
+// heldAuditEntry is a request entry held until flushHeldAudit
+type heldAuditEntry struct {
+	auth     *logical.Auth
+	req      logical.Request
+	outerErr error
+}
+
+// holdAudit makes the request entries of the request be held until
+// flushHeldAudit is called rather than logged right away. Performance
+// standbys hold them as requests forwarded to the active node are audited
+// there, and would otherwise be audited twice.
+func holdAudit(req *logical.Request) {
+	req.SetContext(context.WithValue(req.Context(), heldAuditKey{}, &[]heldAuditEntry{}))
+}
+
+// auditRequest logs the request entry of the request, or holds it if
+// holdAudit was called on the request
+func (c *Core) auditRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
+	if held, ok := req.Context().Value(heldAuditKey{}).(*[]heldAuditEntry); ok {
+		*held = append(*held, heldAuditEntry{
+			auth:     auth,
+			req:      *req,
+			outerErr: outerErr,
+		})
+		return nil
+	}
+	return c.auditBroker.LogRequest(auth, req, c.auditedHeaders, outerErr)
+}
+
+// flushHeldAudit logs the request entries held for the request
+func (c *Core) flushHeldAudit(req *logical.Request) error {
+	held, ok := req.Context().Value(heldAuditKey{}).(*[]heldAuditEntry)
+	if !ok {
+		return nil
+	}
+	entries := *held
+	*held = nil
+	for i := range entries {
+		if err := c.auditBroker.LogRequest(entries[i].auth, &entries[i].req, c.auditedHeaders, entries[i].outerErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startPerfStandby starts serving read requests locally if enabled. It
+// returns a function that stops doing so, which must be called without the
+// state lock held.
+func (c *Core) startPerfStandby() func() {
+	if !c.perfStandbyEnabled {
+		return func() {}
+	}
+
+	doneCh := make(chan struct{})
+	stopCh := make(chan struct{})
+	go c.runPerfStandby(doneCh, stopCh)
+
+	return func() {
+		close(stopCh)
+		<-doneCh
+
+		c.stateLock.Lock()
+		if c.perfStandby {
+			c.teardownPerfStandby()
+		}
+		c.stateLock.Unlock()
+	}
+}
+
+// runPerfStandby keeps the state of a performance standby in sync with the
+// writes made by the active node
+func (c *Core) runPerfStandby(doneCh, stopCh chan struct{}) {
+	defer close(doneCh)
+
+	var epoch string
+	var index uint64
+	var failures int
+	lastSync := time.Now()
+	for {
+		if err := c.syncPerfStandby(&epoch, &index); err != nil {
+			failures++
+			c.logger.Warn("core: failed to sync performance standby", "error", err, "failures", failures)
+			if failures >= perfStandbyMaxSyncFailures || time.Since(lastSync) >= perfStandbyMaxStaleness {
+				c.stopPerfStandbyReads(time.Since(lastSync))
+			}
+		} else {
+			failures = 0
+			lastSync = time.Now()
+		}
+
+		select {
+		case <-time.After(perfStandbyInvalidationInterval):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// stopPerfStandbyReads tears the performance standby down when it could not
+// sync with the active node for too long, so that every request is
+// forwarded. It is set up again by the next successful sync.
+func (c *Core) stopPerfStandbyReads(stale time.Duration) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if !c.perfStandby {
+		return
+	}
+	c.logger.Error("core: performance standby is out of sync with the active node, forwarding all requests", "since", stale)
+	c.teardownPerfStandby()
+	metrics.IncrCounter([]string{"core", "perf_standby", "stale"}, 1)
+}
+
+// syncPerfStandby fetches the keys written by the active node since the
+// given index and invalidates them. The standby state is loaded again from
+// storage if it has not been set up yet, if the active node changed, or if
+// one of the tables it is built from was written.
+func (c *Core) syncPerfStandby(epoch *string, index *uint64) error {
+	// Make sure that we're talking to the current active node
+	isLeader, _, _, err := c.Leader()
+	if err != nil {
+		return err
+	}
+	if isLeader {
+		return nil
+	}
+
+	reply, err := c.fetchInvalidations(*epoch, *index)
+	if err != nil {
+		return err
+	}
+
+	c.stateLock.RLock()
+	reload := !c.perfStandby
+	c.stateLock.RUnlock()
+	if reply.Epoch != *epoch || reply.Truncated {
+		reload = true
+	}
+	for _, key := range reply.Keys {
+		if perfStandbyReloadKey(key) {
+			reload = true
+			break
+		}
+	}
+
+	if reload {
+		if err := c.reloadPerfStandby(); err != nil {
+			return err
+		}
+	} else {
+		c.invalidateKeys(reply.Keys)
+		metrics.IncrCounter([]string{"core", "perf_standby", "invalidations"}, float32(len(reply.Keys)))
+	}
+
+	*epoch = reply.Epoch
+	*index = reply.Index
+	return nil
+}
+
+// perfStandbyReloadKey returns whether a write to the given key affects state
+// that is only read when the standby is set up
+func perfStandbyReloadKey(key string) bool {
+	switch {
+	case strings.HasPrefix(key, coreLeaderPrefix):
+		return false
+	case strings.HasPrefix(key, "core/"):
+		return true
+	}
+
+	key = strings.TrimPrefix(key, systemBarrierPrefix)
+	for _, prefix := range []string{"config/", auditedHeadersSubPath, quotaSubPath} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchInvalidations asks the active node for the keys written since the
+// given index
+func (c *Core) fetchInvalidations(epoch string, index uint64) (*PerfStandbyInvalidationsReply, error) {
+	c.requestForwardingConnectionLock.RLock()
+	defer c.requestForwardingConnectionLock.RUnlock()
+
+	if c.rpcForwardingClient == nil {
+		return nil, ErrCannotForward
+	}
+
+	ctx, cancel := context.WithTimeout(c.rpcClientConnContext, 2*time.Second)
+	defer cancel()
+	reply, err := c.rpcForwardingClient.PerfStandbyInvalidations(ctx, &PerfStandbyInvalidationsRequest{
+		Epoch: epoch,
+		Index: index,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching invalidations from active node: %v", err)
+	}
+	return reply, nil
+}
+
+// invalidateKeys drops the given keys from the cache and lets the backends
+// owning them reset any state built from them
+func (c *Core) invalidateKeys(keys []string) {
+	invalidatable, _ := c.physical.(physical.Invalidatable)
+	for _, key := range keys {
+		if invalidatable != nil {
+			invalidatable.Invalidate(key)
+		}
+
+		if strings.HasPrefix(key, auditBarrierPrefix) {
+			c.stateLock.RLock()
+			if c.auditBroker != nil {
+				c.auditBroker.Invalidate(key)
+			}
+			c.stateLock.RUnlock()
+			continue
+		}
+
+		if strings.HasPrefix(key, coreReplicationSecondaryPrefix) {
+			c.invalidateReplicationPeer(strings.TrimPrefix(key, coreReplicationSecondaryPrefix))
+			continue
+		}
+
+		// The token store is mounted with the storage of an auth mount, but
+		// keeps tokens in the system view
+		if strings.HasPrefix(key, systemBarrierPrefix+tokenSubPath) {
+			c.stateLock.RLock()
+			if c.tokenStore != nil {
+				c.tokenStore.invalidate(strings.TrimPrefix(key, systemBarrierPrefix+tokenSubPath))
+			}
+			c.stateLock.RUnlock()
+			continue
+		}
+
+		mountPath, prefix, ok := c.router.MatchingStoragePrefix(key)
+		if !ok {
+			continue
+		}
+		if backend := c.router.MatchingBackend(mountPath); backend != nil {
+			backend.InvalidateKey(strings.TrimPrefix(key, prefix))
+		}
+	}
+}
+
+// reloadPerfStandby loads the standby state again from storage
+func (c *Core) reloadPerfStandby() error {
+	defer metrics.MeasureSince([]string{"core", "perf_standby", "reload"}, time.Now())
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.sealed || !c.standby {
+		return nil
+	}
+	if c.perfStandby {
+		c.teardownPerfStandby()
+	}
+	if purgable, ok := c.physical.(physical.Purgable); ok {
+		purgable.Purge()
+	}
+	return c.setupPerfStandby()
+}
+
+// setupPerfStandby loads the mount tables, policies and other state needed
+// to serve read requests, without writing anything to storage. If the
+// active node has not finished setting up storage this fails, and is tried
+// again later. The state lock must be held.
+func (c *Core) setupPerfStandby() (retErr error) {
+	c.perfStandby = true
+	defer func() {
+		if retErr != nil {
+			c.teardownPerfStandby()
+		}
+	}()
+
+	if err := c.loadReplicationConfig(); err != nil {
+		return err
+	}
+	if err := c.ensureWrappingKey(); err != nil {
+		return err
+	}
+	if err := c.setupPluginCatalog(); err != nil {
+		return err
+	}
+	if err := c.loadMounts(); err != nil {
+		return err
+	}
+	if err := c.setupMounts(); err != nil {
+		return err
+	}
+	if err := c.setupPolicyStore(); err != nil {
+		return err
+	}
+	if err := c.loadCORSConfig(); err != nil {
+		return err
+	}
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
+	if err := c.setupCredentials(); err != nil {
+		return err
+	}
+	if err := c.setupExpiration(); err != nil {
+		return err
+	}
+	if err := c.loadAudits(); err != nil {
+		return err
+	}
+	if err := c.setupAudits(); err != nil {
+		return err
+	}
+	if err := c.setupAuditedHeadersConfig(); err != nil {
+		return err
+	}
+	if err := c.setupQuotas(); err != nil {
+		return err
+	}
+
+	c.requestContext, c.requestContextCancelFunc = context.WithCancel(context.Background())
+	c.logger.Info("core: performance standby setup complete")
+	return nil
+}
+
+// teardownPerfStandby reverses setupPerfStandby. The state lock must be held.
+func (c *Core) teardownPerfStandby() {
+	if c.requestContextCancelFunc != nil {
+		c.requestContextCancelFunc()
+	}
+	c.requestContext = nil
+
+	if err := c.teardownQuotas(); err != nil {
+		c.logger.Error("core: error tearing down quotas", "error", err)
+	}
+	if err := c.teardownAudits(); err != nil {
+		c.logger.Error("core: error tearing down audits", "error", err)
+	}
+	if err := c.stopExpiration(); err != nil {
+		c.logger.Error("core: error stopping expiration", "error", err)
+	}
+	if err := c.teardownCredentials(); err != nil {
+		c.logger.Error("core: error tearing down credentials", "error", err)
+	}
+	if err := c.teardownPolicyStore(); err != nil {
+		c.logger.Error("core: error tearing down policy store", "error", err)
+	}
+	if err := c.unloadMounts(); err != nil {
+		c.logger.Error("core: error unloading mounts", "error", err)
+	}
+
+	c.perfStandby = false
+}
+
+// invalidationLog records the keys written to storage by the active node.
+// Each active term has its own epoch, so that standbys can tell when they
+// missed writes.
+type invalidationLog struct {
+	l     sync.Mutex
+	epoch string
+	index uint64
+	keys  []string
+
+	// filter picks the keys that are recorded; all keys are if nil
+	filter func(string) bool
+}
+
+func newInvalidationLog(filter func(string) bool) *invalidationLog {
+	l := &invalidationLog{
+		filter: filter,
+	}
+	l.reset()
+	return l
+}
+
+// reset starts a new epoch
+func (l *invalidationLog) reset() {
+	epoch, err := uuid.GenerateUUID()
+	if err != nil {
+		epoch = time.Now().String()
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.epoch = epoch
+	l.index = 0
+	l.keys = nil
+}
+
+func (l *invalidationLog) record(keys ...string) {
+	if l.filter != nil {
+		var recorded []string
+		for _, key := range keys {
+			if l.filter(key) {
+				recorded = append(recorded, key)
+			}
+		}
+		if len(recorded) == 0 {
+			return
+		}
+		keys = recorded
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.keys = append(l.keys, keys...)
+	l.index += uint64(len(keys))
+	if len(l.keys) > 2*invalidationLogSize {
+		l.keys = append([]string(nil), l.keys[len(l.keys)-invalidationLogSize:]...)
+	}
+}
+
+// since returns the keys recorded after the given index
+func (l *invalidationLog) since(epoch string, index uint64) *PerfStandbyInvalidationsReply {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	reply := &PerfStandbyInvalidationsReply{
+		Epoch: l.epoch,
+		Index: l.index,
+	}
+	switch {
+	case epoch != l.epoch:
+	case index > l.index, l.index-index > uint64(len(l.keys)):
+		reply.Truncated = true
+	default:
+		reply.Keys = append([]string(nil), l.keys[uint64(len(l.keys))-(l.index-index):]...)
+	}
+	return reply
+}
+
+// invalidationRecorder wraps the physical backend to record the keys written
+// in the given logs
+type invalidationRecorder struct {
+	physical.Backend
+	logs []*invalidationLog
+}
+
+// transactionalInvalidationRecorder is an invalidationRecorder wrapping a
+// transactional backend
+type transactionalInvalidationRecorder struct {
+	*invalidationRecorder
+	transactional physical.Transactional
+}
+
+func newInvalidationRecorder(b physical.Backend, logs ...*invalidationLog) physical.Backend {
+	r := &invalidationRecorder{
+		Backend: b,
+		logs:    logs,
+	}
+	if txn, ok := b.(physical.Transactional); ok {
+		return &transactionalInvalidationRecorder{
+			invalidationRecorder: r,
+			transactional:        txn,
+		}
+	}
+	return r
+}
+
+func (r *invalidationRecorder) Put(ctx context.Context, entry *physical.Entry) error {
+	if err := r.Backend.Put(ctx, entry); err != nil {
+		return err
+	}
+	r.record(entry.Key)
+	return nil
+}
+
+func (r *invalidationRecorder) Delete(ctx context.Context, key string) error {
+	if err := r.Backend.Delete(ctx, key); err != nil {
+		return err
+	}
+	r.record(key)
+	return nil
+}
+
+func (r *invalidationRecorder) record(keys ...string) {
+	for _, log := range r.logs {
+		log.record(keys...)
+	}
+}
+
+func (r *invalidationRecorder) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, error) {
+	return physical.ListPage(ctx, r.Backend, prefix, after, limit)
+}
+
+func (r *invalidationRecorder) Purge() {
+	if purgable, ok := r.Backend.(physical.Purgable); ok {
+		purgable.Purge()
+	}
+}
+
+func (r *invalidationRecorder) Invalidate(key string) {
+	if invalidatable, ok := r.Backend.(physical.Invalidatable); ok {
+		invalidatable.Invalidate(key)
+	}
+}
+
+func (r *transactionalInvalidationRecorder) Transaction(ctx context.Context, txns []physical.TxnEntry) error {
+	if err := r.transactional.Transaction(ctx, txns); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		keys = append(keys, txn.Entry.Key)
+	}
+	r.record(keys...)
+	return nil
+}
+
+// PerfStandbyInvalidations returns the keys written since the index given by
+// a performance standby
+func (s *forwardedRequestRPCServer) PerfStandbyInvalidations(ctx context.Context, in *PerfStandbyInvalidationsRequest) (*PerfStandbyInvalidationsReply, error) {
+	s.core.stateLock.RLock()
+	standby := s.core.standby
+	s.core.stateLock.RUnlock()
+	if standby || s.core.invalidations == nil {
+		return nil, fmt.Errorf("not the active node")
+	}
+	return s.core.invalidations.since(in.Epoch, in.Index), nil
+}
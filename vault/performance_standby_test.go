@@ -0,0 +1,352 @@
+package vault
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestInvalidationLog(t *testing.T) {
+	l := newInvalidationLog(nil)
+	epoch := l.epoch
+
+	l.record("foo", "bar")
+	l.record("baz")
+
+	reply := l.since(epoch, 0)
+	if reply.Epoch != epoch || reply.Index != 3 || reply.Truncated {
+		t.Fatalf("bad: %#v", reply)
+	}
+	if !reflect.DeepEqual(reply.Keys, []string{"foo", "bar", "baz"}) {
+		t.Fatalf("bad: %#v", reply.Keys)
+	}
+
+	reply = l.since(epoch, 2)
+	if !reflect.DeepEqual(reply.Keys, []string{"baz"}) {
+		t.Fatalf("bad: %#v", reply.Keys)
+	}
+
+	reply = l.since(epoch, 3)
+	if len(reply.Keys) != 0 || reply.Truncated {
+		t.Fatalf("bad: %#v", reply)
+	}
+
+	// An unknown epoch only returns the current position
+	reply = l.since("", 0)
+	if reply.Epoch != epoch || reply.Index != 3 || len(reply.Keys) != 0 || reply.Truncated {
+		t.Fatalf("bad: %#v", reply)
+	}
+
+	// An index ahead of the log cannot be served
+	reply = l.since(epoch, 4)
+	if !reply.Truncated {
+		t.Fatalf("bad: %#v", reply)
+	}
+
+	// Keys that were trimmed from the log cannot be served
+	for i := 0; i < 2*invalidationLogSize; i++ {
+		l.record(fmt.Sprintf("key%d", i))
+	}
+	reply = l.since(epoch, 3)
+	if !reply.Truncated || len(reply.Keys) != 0 {
+		t.Fatalf("bad: %#v", reply)
+	}
+	reply = l.since(epoch, reply.Index-1)
+	if reply.Truncated || !reflect.DeepEqual(reply.Keys, []string{fmt.Sprintf("key%d", 2*invalidationLogSize-1)}) {
+		t.Fatalf("bad: %#v", reply)
+	}
+
+	// A new epoch starts from scratch
+	l.reset()
+	if l.epoch == epoch || l.index != 0 || len(l.keys) != 0 {
+		t.Fatalf("bad: %#v", l)
+	}
+	reply = l.since(epoch, 3)
+	if reply.Epoch == epoch || reply.Index != 0 || len(reply.Keys) != 0 {
+		t.Fatalf("bad: %#v", reply)
+	}
+}
+
+func TestPerfStandbyReloadKey(t *testing.T) {
+	cases := map[string]bool{
+		"core/mounts":                      true,
+		"core/auth":                        true,
+		"core/leader/1234":                 false,
+		"sys/config/cors":                  true,
+		"sys/policy/default":               false,
+		"sys/token/id/1234":                false,
+		"logical/1234/foo":                 false,
+		"sys/expire/id/secret/foo/1234":    false,
+		systemBarrierPrefix + quotaSubPath: true,
+	}
+	for key, expected := range cases {
+		if actual := perfStandbyReloadKey(key); actual != expected {
+			t.Fatalf("%s: expected %v, got %v", key, expected, actual)
+		}
+	}
+}
+
+func TestCore_HeldAudit(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	noop := &NoopAudit{}
+	c.auditBroker.Register("noop", noop, nil, nil)
+
+	// Held request entries are only logged once flushed
+	req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	holdAudit(req)
+	if err := c.auditRequest(nil, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(noop.Req) != 0 {
+		t.Fatalf("held request was audited: %#v", noop.Req)
+	}
+	if err := c.flushHeldAudit(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.flushHeldAudit(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(noop.Req) != 1 || noop.Req[0].Path != "secret/foo" {
+		t.Fatalf("bad: %#v", noop.Req)
+	}
+
+	// Other requests are logged right away
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/bar")
+	if err := c.auditRequest(nil, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.flushHeldAudit(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(noop.Req) != 2 || noop.Req[1].Path != "secret/bar" {
+		t.Fatalf("bad: %#v", noop.Req)
+	}
+}
+
+func TestCore_PerfStandby(t *testing.T) {
+	oldInterval := perfStandbyInvalidationInterval
+	oldMaxFailures := perfStandbyMaxSyncFailures
+	perfStandbyInvalidationInterval = 50 * time.Millisecond
+	perfStandbyMaxSyncFailures = 3
+	defer func() {
+		perfStandbyInvalidationInterval = oldInterval
+		perfStandbyMaxSyncFailures = oldMaxFailures
+	}()
+
+	cluster := NewTestCluster(t, &CoreConfig{
+		PerformanceStandby: true,
+		LogicalBackends: map[string]logical.Factory{
+			"leased-kv": LeasedPassthroughBackendFactory,
+		},
+	}, nil)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	cores := cluster.Cores
+	root := cluster.RootToken
+
+	TestWaitActive(t, cores[0].Core)
+	if cores[0].PerfStandby() {
+		t.Fatal("active node should not be a performance standby")
+	}
+
+	standby := cores[1].Core
+	waitFor(t, func() error {
+		if !standby.PerfStandby() {
+			return fmt.Errorf("core is not a performance standby yet")
+		}
+		return nil
+	})
+
+	// Writes are left to the active node
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if _, err := standby.HandleRequest(req); err != ErrPerfStandbyForward {
+		t.Fatalf("expected forwarding error, got %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads are served by the standby once it sees the write
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(standby, root, "secret/foo", "bar")
+	})
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "baz"
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(standby, root, "secret/foo", "baz")
+	})
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "secret/foo")
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(standby, root, "secret/foo", "")
+	})
+
+	// Mounts made on the active node show up on the standby
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/other")
+	req.Data["type"] = "kv"
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "other/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(standby, root, "other/foo", "bar")
+	})
+
+	// Reads that may return leases are left to the active node
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/leased")
+	req.Data["type"] = "leased-kv"
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "leased/foo")
+	req.Data["value"] = "bar"
+	req.Data["ttl"] = "1h"
+	req.ClientToken = root
+	if _, err := cores[0].HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() error {
+		if standby.router.MatchingBackend("leased/foo") == nil {
+			return fmt.Errorf("leased mount not loaded yet")
+		}
+		return nil
+	})
+	req = logical.TestRequest(t, logical.ReadOperation, "leased/foo")
+	req.ClientToken = root
+	if _, err := standby.HandleRequest(req); err != ErrPerfStandbyForward {
+		t.Fatalf("expected forwarding error, got %v", err)
+	}
+	req = logical.TestRequest(t, logical.ListOperation, "leased/")
+	req.ClientToken = root
+	if _, err := standby.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// A standby that cannot sync stops serving reads until it can again
+	standby.requestForwardingConnectionLock.Lock()
+	client := standby.rpcForwardingClient
+	standby.rpcForwardingClient = nil
+	standby.requestForwardingConnectionLock.Unlock()
+	waitFor(t, func() error {
+		if standby.PerfStandby() {
+			return fmt.Errorf("stale standby is still serving reads")
+		}
+		return nil
+	})
+	if err := checkPerfStandbyRead(standby, root, "other/foo", "bar"); err != consts.ErrStandby {
+		t.Fatalf("expected standby error, got %v", err)
+	}
+	standby.requestForwardingConnectionLock.Lock()
+	standby.rpcForwardingClient = client
+	standby.requestForwardingConnectionLock.Unlock()
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(standby, root, "other/foo", "bar")
+	})
+
+	// Tokens created on the active node are usable on the standby
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	resp, err := cores[0].HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := resp.Auth.ClientToken
+	waitFor(t, func() error {
+		req := logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+		req.ClientToken = token
+		resp, err := standby.HandleRequest(req)
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.Data["id"] != token {
+			return fmt.Errorf("bad: %#v", resp)
+		}
+		return nil
+	})
+
+	// Logins are handled by the active node
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	if _, err := standby.HandleRequest(req); err != ErrPerfStandbyForward {
+		t.Fatalf("expected forwarding error, got %v", err)
+	}
+
+	// The standby is torn down when it becomes active
+	err = cores[0].StepDown(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "sys/step-down",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() error {
+		for _, core := range cores {
+			if isLeader, _, _, _ := core.Leader(); isLeader {
+				if core.PerfStandby() {
+					return fmt.Errorf("active node is still a performance standby")
+				}
+				return checkPerfStandbyRead(core.Core, root, "other/foo", "bar")
+			}
+		}
+		return fmt.Errorf("no active node")
+	})
+}
+
+func checkPerfStandbyRead(c *Core, token, path, expected string) error {
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        path,
+		ClientToken: token,
+	}
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		return err
+	}
+	var actual string
+	if resp != nil {
+		actual, _ = resp.Data["value"].(string)
+	}
+	if actual != expected {
+		return fmt.Errorf("expected %q, got %q", expected, actual)
+	}
+	return nil
+}
+
+func waitFor(t *testing.T, f func() error) {
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = f(); err == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal(err)
+}
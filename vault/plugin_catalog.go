@@ -34,7 +34,7 @@ type PluginCatalog struct {
 
 func (c *Core) setupPluginCatalog() error {
 	c.pluginCatalog = &PluginCatalog{
-		catalogView: NewBarrierView(c.barrier, pluginCatalogPath),
+		catalogView: c.replicatedBarrierView(pluginCatalogPath),
 		directory:   c.pluginDirectory,
 	}
 
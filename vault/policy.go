@@ -11,6 +11,7 @@ import (
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/mitchellh/copystructure"
 )
 
@@ -75,6 +76,28 @@ type PathCapabilities struct {
 	MaxWrappingTTLHCL    interface{}              `hcl:"max_wrapping_ttl"`
 	AllowedParametersHCL map[string][]interface{} `hcl:"allowed_parameters"`
 	DeniedParametersHCL  map[string][]interface{} `hcl:"denied_parameters"`
+	ControlGroupHCL      *ControlGroupHCL         `hcl:"control_group"`
+	MFAMethodsHCL        []string                 `hcl:"mfa_methods"`
+}
+
+// ControlGroupHCL is the HCL representation of a control group stanza.
+type ControlGroupHCL struct {
+	TTL     interface{}                       `hcl:"ttl"`
+	Factors map[string]*ControlGroupFactorHCL `hcl:"factor"`
+}
+
+// ControlGroupFactorHCL is the HCL representation of a single factor of a
+// control group.
+type ControlGroupFactorHCL struct {
+	Identity *IdentityFactorHCL `hcl:"identity"`
+}
+
+// IdentityFactorHCL describes which identity groups may authorize a request
+// and how many distinct authorizations are required.
+type IdentityFactorHCL struct {
+	GroupIDs   []string `hcl:"group_ids"`
+	GroupNames []string `hcl:"group_names"`
+	Approvals  int      `hcl:"approvals"`
 }
 
 type Permissions struct {
@@ -83,6 +106,8 @@ type Permissions struct {
 	MaxWrappingTTL     time.Duration
 	AllowedParameters  map[string][]interface{}
 	DeniedParameters   map[string][]interface{}
+	ControlGroup       *ControlGroup
+	MFAMethods         []string
 }
 
 func (p *Permissions) Clone() (*Permissions, error) {
@@ -116,6 +141,14 @@ func (p *Permissions) Clone() (*Permissions, error) {
 		ret.DeniedParameters = clonedDenied.(map[string][]interface{})
 	}
 
+	if p.ControlGroup != nil {
+		ret.ControlGroup = p.ControlGroup.Clone()
+	}
+
+	if p.MFAMethods != nil {
+		ret.MFAMethods = append([]string(nil), p.MFAMethods...)
+	}
+
 	return ret, nil
 }
 
@@ -174,6 +207,8 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 			"denied_parameters",
 			"min_wrapping_ttl",
 			"max_wrapping_ttl",
+			"control_group",
+			"mfa_methods",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
@@ -264,6 +299,16 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 			pc.Permissions.MaxWrappingTTL < pc.Permissions.MinWrappingTTL {
 			return errors.New("max_wrapping_ttl cannot be less than min_wrapping_ttl")
 		}
+		if pc.ControlGroupHCL != nil {
+			cg, err := parseControlGroup(pc.ControlGroupHCL)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
+			}
+			pc.Permissions.ControlGroup = cg
+		}
+		if len(pc.MFAMethodsHCL) > 0 {
+			pc.Permissions.MFAMethods = strutil.RemoveDuplicates(pc.MFAMethodsHCL, false)
+		}
 
 	PathFinished:
 		paths = append(paths, &pc)
@@ -0,0 +1,148 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// quotaSubPath is the sub-path used for the quota store view. This is
+	// nested under the system view.
+	quotaSubPath = "quotas/"
+
+	// quotaTypeRateLimit is the type of quotas limiting the rate of requests
+	quotaTypeRateLimit = "rate-limit"
+
+	// quotaTypeLeaseCount is the type of quotas limiting the number of
+	// outstanding leases
+	quotaTypeLeaseCount = "lease-count"
+)
+
+// quotaManager holds the quotas that are enforced on requests. The
+// configuration of every quota is persisted in the quota view, while the
+// state used to enforce them is only kept in memory.
+type quotaManager struct {
+	l sync.RWMutex
+
+	view *BarrierView
+
+	// expiration maintains the counts of the lease count quotas
+	expiration *ExpirationManager
+
+	// rateLimits maps the name of a rate limit quota to the quota
+	rateLimits map[string]*rateLimitQuota
+
+	// leaseCounts maps the name of a lease count quota to the quota
+	leaseCounts map[string]*leaseCountQuota
+
+	// leaseCountLock serializes changes to the lease count quotas, which
+	// count the leases in storage without holding l
+	leaseCountLock sync.Mutex
+}
+
+// setupQuotas is invoked after we've loaded the mount table to load the
+// configured quotas
+func (c *Core) setupQuotas() error {
+	view := c.systemBarrierView.SubView(quotaSubPath)
+
+	qm := &quotaManager{
+		view:        view,
+		expiration:  c.expiration,
+		rateLimits:  make(map[string]*rateLimitQuota),
+		leaseCounts: make(map[string]*leaseCountQuota),
+	}
+
+	names, err := logical.CollectKeys(view.SubView(quotaTypeRateLimit + "/"))
+	if err != nil {
+		return fmt.Errorf("failed to list rate limit quotas: %v", err)
+	}
+	for _, name := range names {
+		quota, err := qm.readRateLimitQuota(name)
+		if err != nil {
+			return err
+		}
+		if quota == nil {
+			continue
+		}
+		qm.rateLimits[name] = newRateLimitQuota(quota)
+	}
+
+	names, err = logical.CollectKeys(view.SubView(quotaTypeLeaseCount + "/"))
+	if err != nil {
+		return fmt.Errorf("failed to list lease count quotas: %v", err)
+	}
+	for _, name := range names {
+		quota, err := qm.readLeaseCountQuota(name)
+		if err != nil {
+			return err
+		}
+		if quota == nil {
+			continue
+		}
+		if err := qm.startLeaseCountQuota(quota); err != nil {
+			return err
+		}
+	}
+
+	c.quotas = qm
+	return nil
+}
+
+// teardownQuotas is used to remove the quotas when sealing
+func (c *Core) teardownQuotas() error {
+	if c.quotas == nil {
+		return nil
+	}
+
+	qm := c.quotas
+	qm.l.Lock()
+	for _, quota := range qm.leaseCounts {
+		qm.expiration.removeLeaseCountQuota(quota)
+	}
+	qm.l.Unlock()
+
+	c.quotas = nil
+	return nil
+}
+
+// quotaPathMatches reports whether a quota scoped to quotaPath applies to a
+// request to path. An empty quota path applies globally. Paths are matched on
+// whole segments, so that a quota on secret/foo does not apply to
+// secret/foobar.
+func quotaPathMatches(quotaPath, path string) bool {
+	if quotaPath == "" || strings.HasSuffix(quotaPath, "/") {
+		return strings.HasPrefix(path, quotaPath)
+	}
+	return path == quotaPath || strings.HasPrefix(path, quotaPath+"/")
+}
+
+// quotaExempt reports whether requests to the path are never subject to a
+// quota, so that operators can always manage a cluster that is under load
+func quotaExempt(path string) bool {
+	return strings.HasPrefix(path, "sys/")
+}
+
+// validateQuotaPath normalizes the path a quota is scoped to and ensures it
+// falls within a mount
+func (c *Core) validateQuotaPath(path string) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", nil
+	}
+	if quotaExempt(path) {
+		return "", fmt.Errorf("quotas cannot be applied to %q", path)
+	}
+	if c.router.MatchingMount(path) == "" {
+		if c.router.MatchingMount(path+"/") == "" {
+			return "", fmt.Errorf("no mount found for path %q", path)
+		}
+
+		// A quota on a mount is stored with a trailing slash, so that it
+		// does not apply to sibling mounts sharing its name as a prefix
+		path += "/"
+	}
+	return path, nil
+}
@@ -0,0 +1,253 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+// LeaseCountQuota is the persisted configuration of a lease count quota,
+// which caps the number of outstanding leases under a path
+type LeaseCountQuota struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	MaxLeases int64  `json:"max_leases"`
+}
+
+// leaseCountQuota enforces a lease count quota. The count is kept up to date
+// by the expiration manager as leases are created and revoked.
+type leaseCountQuota struct {
+	*LeaseCountQuota
+
+	// count is the number of outstanding leases under the path, accessed
+	// atomically
+	count int64
+
+	// pending records whether each lease created (true) or deleted (false)
+	// under the path while the count is first taken was counted. It is nil
+	// once the count is kept up to date, and is protected by the lease count
+	// lock of the expiration manager.
+	pending map[string]bool
+}
+
+// Count returns the number of outstanding leases counted by the quota
+func (q *leaseCountQuota) Count() int64 {
+	return atomic.LoadInt64(&q.count)
+}
+
+// leaseCountReservation is room held in the lease count quotas applying to a
+// request for a lease that it may create
+type leaseCountReservation struct {
+	// quotas are the quotas in which room was reserved
+	quotas []*leaseCountQuota
+
+	// exceeded is the quota in which no room was left, if any, in which case
+	// nothing is reserved
+	exceeded *leaseCountQuota
+}
+
+// reserveLeaseCount reserves room for a lease the request may create in every
+// lease count quota applying to it, before the request reaches the backend,
+// so that concurrent requests can't exceed the quotas. Requests that can't
+// create a lease reserve nothing. The caller must hold the state lock.
+func (c *Core) reserveLeaseCount(req *logical.Request) *leaseCountReservation {
+	if !c.mayCreateLease(req) {
+		return &leaseCountReservation{}
+	}
+	return c.reserveLeaseCountPath(req.Path)
+}
+
+// mayCreateLease reports whether the backend handling a request may return a
+// lease or a token with one
+func (c *Core) mayCreateLease(req *logical.Request) bool {
+	switch req.Operation {
+	case logical.ReadOperation, logical.CreateOperation, logical.UpdateOperation:
+	default:
+		return false
+	}
+
+	// Only token creation returns a lease from the token store
+	if strings.HasPrefix(req.Path, "auth/token/") {
+		return strings.HasPrefix(req.Path, "auth/token/create")
+	}
+
+	switch be := c.router.MatchingBackend(req.Path).(type) {
+	case *PassthroughBackend:
+		return be.GeneratesLeases()
+	case *CubbyholeBackend:
+		return false
+	}
+	return true
+}
+
+// reserveLeaseCountPath reserves room for a lease created under the path in
+// every lease count quota applying to it. If any of them is full, the room
+// reserved in the others is given back and check returns an error.
+func (c *Core) reserveLeaseCountPath(path string) *leaseCountReservation {
+	r := &leaseCountReservation{}
+	if c.quotas == nil || quotaExempt(path) {
+		return r
+	}
+
+	// Leases are created under the request path
+	leasePath := strings.TrimSuffix(path, "/") + "/"
+
+	var quotas []*leaseCountQuota
+	qm := c.quotas
+	qm.l.RLock()
+	for _, quota := range qm.leaseCounts {
+		if quotaPathMatches(quota.Path, leasePath) {
+			quotas = append(quotas, quota)
+		}
+	}
+	qm.l.RUnlock()
+
+	for _, quota := range quotas {
+		if !quota.reserve() {
+			r.release()
+			r.exceeded = quota
+			return r
+		}
+		r.quotas = append(r.quotas, quota)
+	}
+	return r
+}
+
+// reserve takes room for one lease in the quota, unless it is full
+func (q *leaseCountQuota) reserve() bool {
+	for {
+		count := q.Count()
+		if count >= q.MaxLeases {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&q.count, count, count+1) {
+			return true
+		}
+	}
+}
+
+// check returns an error if a lease count quota applies but no room could be
+// reserved in it, in which case the request must be rejected
+func (r *leaseCountReservation) check() error {
+	if r.exceeded == nil {
+		return nil
+	}
+
+	metrics.IncrCounter([]string{"quota", "lease_count", "violation"}, 1)
+	metrics.IncrCounter([]string{"quota", "lease_count", r.exceeded.Name, "violation"}, 1)
+	return logical.ErrLeaseCountQuotaExceeded
+}
+
+// release gives back the room reserved. It must be called once any lease
+// created has been registered, which counts it.
+func (r *leaseCountReservation) release() {
+	for _, quota := range r.quotas {
+		atomic.AddInt64(&quota.count, -1)
+	}
+	r.quotas = nil
+}
+
+func (qm *quotaManager) leaseCountView() *BarrierView {
+	return qm.view.SubView(quotaTypeLeaseCount + "/")
+}
+
+// readLeaseCountQuota reads the configuration of a lease count quota from
+// storage
+func (qm *quotaManager) readLeaseCountQuota(name string) (*LeaseCountQuota, error) {
+	entry, err := qm.leaseCountView().Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease count quota %q: %v", name, err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var quota LeaseCountQuota
+	if err := entry.DecodeJSON(&quota); err != nil {
+		return nil, fmt.Errorf("failed to decode lease count quota %q: %v", name, err)
+	}
+	return &quota, nil
+}
+
+// leaseCountQuota returns the configuration and current count of a lease
+// count quota
+func (qm *quotaManager) leaseCountQuota(name string) (*LeaseCountQuota, int64) {
+	qm.l.RLock()
+	defer qm.l.RUnlock()
+
+	quota, ok := qm.leaseCounts[name]
+	if !ok {
+		return nil, 0
+	}
+	ret := *quota.LeaseCountQuota
+	return &ret, quota.Count()
+}
+
+// startLeaseCountQuota begins enforcing a lease count quota, replacing any
+// quota with the same name. The leases are counted before the lock is taken,
+// so that requests are not held up meanwhile.
+func (qm *quotaManager) startLeaseCountQuota(config *LeaseCountQuota) error {
+	quota := &leaseCountQuota{
+		LeaseCountQuota: config,
+	}
+	if err := qm.expiration.addLeaseCountQuota(quota); err != nil {
+		return err
+	}
+
+	qm.l.Lock()
+	defer qm.l.Unlock()
+
+	if existing, ok := qm.leaseCounts[config.Name]; ok {
+		qm.expiration.removeLeaseCountQuota(existing)
+	}
+	qm.leaseCounts[config.Name] = quota
+	return nil
+}
+
+// setLeaseCountQuota persists a lease count quota and starts enforcing it
+func (qm *quotaManager) setLeaseCountQuota(quota *LeaseCountQuota) error {
+	entry, err := logical.StorageEntryJSON(quota.Name, quota)
+	if err != nil {
+		return err
+	}
+
+	qm.leaseCountLock.Lock()
+	defer qm.leaseCountLock.Unlock()
+
+	if err := qm.leaseCountView().Put(entry); err != nil {
+		return fmt.Errorf("failed to persist lease count quota %q: %v", quota.Name, err)
+	}
+	return qm.startLeaseCountQuota(quota)
+}
+
+// deleteLeaseCountQuota removes a lease count quota
+func (qm *quotaManager) deleteLeaseCountQuota(name string) error {
+	qm.leaseCountLock.Lock()
+	defer qm.leaseCountLock.Unlock()
+	qm.l.Lock()
+	defer qm.l.Unlock()
+
+	if err := qm.leaseCountView().Delete(name); err != nil {
+		return fmt.Errorf("failed to delete lease count quota %q: %v", name, err)
+	}
+	if quota, ok := qm.leaseCounts[name]; ok {
+		qm.expiration.removeLeaseCountQuota(quota)
+		delete(qm.leaseCounts, name)
+	}
+	return nil
+}
+
+// leaseCountQuotaNames returns the names of all lease count quotas
+func (qm *quotaManager) leaseCountQuotaNames() []string {
+	qm.l.RLock()
+	defer qm.l.RUnlock()
+
+	names := make([]string, 0, len(qm.leaseCounts))
+	for name := range qm.leaseCounts {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,213 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+// ErrRateLimitQuotaExceeded is returned when a request is rejected because
+// a rate limit quota is exhausted
+var ErrRateLimitQuotaExceeded = errors.New("rate limit quota exceeded")
+
+// RateLimitQuota is the persisted configuration of a rate limit quota. Rate
+// requests are allowed per interval, with bursts of up to Burst requests.
+type RateLimitQuota struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Rate     int           `json:"rate"`
+	Interval time.Duration `json:"interval"`
+	Burst    int           `json:"burst"`
+}
+
+// rateLimitQuota enforces a rate limit quota using a token bucket
+type rateLimitQuota struct {
+	*RateLimitQuota
+
+	l sync.Mutex
+
+	// tokens is the number of requests that can currently be made
+	tokens float64
+
+	// last is the time the bucket was last refilled
+	last time.Time
+}
+
+// RateLimitResult describes the outcome of applying a rate limit quota to a
+// request
+type RateLimitResult struct {
+	// Allowed is false if the request must be rejected
+	Allowed bool
+
+	// Quota is the name of the quota that was applied
+	Quota string
+
+	// Limit is the size of the bucket of the quota
+	Limit int
+
+	// Remaining is the number of requests that can be made immediately
+	Remaining int
+
+	// RetryAfter is how long to wait before a rejected request can succeed
+	RetryAfter time.Duration
+
+	// Reset is how long it takes for the bucket to be full again
+	Reset time.Duration
+}
+
+func newRateLimitQuota(quota *RateLimitQuota) *rateLimitQuota {
+	return &rateLimitQuota{
+		RateLimitQuota: quota,
+		tokens:         float64(quota.Burst),
+		last:           time.Now(),
+	}
+}
+
+// allow consumes a token from the bucket if one is available
+func (q *rateLimitQuota) allow(now time.Time) *RateLimitResult {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	// Tokens are refilled continuously at rate per interval
+	perSecond := float64(q.Rate) / q.Interval.Seconds()
+	if elapsed := now.Sub(q.last).Seconds(); elapsed > 0 {
+		q.tokens = math.Min(float64(q.Burst), q.tokens+elapsed*perSecond)
+		q.last = now
+	}
+
+	result := &RateLimitResult{
+		Quota: q.Name,
+		Limit: q.Burst,
+	}
+	if q.tokens >= 1 {
+		q.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - q.tokens) / perSecond)
+	}
+	result.Remaining = int(q.tokens)
+	result.Reset = secondsToDuration((float64(q.Burst) - q.tokens) / perSecond)
+
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ApplyRateLimitQuota consumes a request from the most specific rate limit
+// quota that applies to the path. It returns nil if no quota applies.
+func (c *Core) ApplyRateLimitQuota(path string) *RateLimitResult {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	if c.sealed || (c.standby && !c.perfStandby) || c.quotas == nil || quotaExempt(path) {
+		return nil
+	}
+
+	qm := c.quotas
+	qm.l.RLock()
+	var match *rateLimitQuota
+	for _, quota := range qm.rateLimits {
+		if !quotaPathMatches(quota.Path, path) {
+			continue
+		}
+		if match == nil || len(quota.Path) > len(match.Path) {
+			match = quota
+		}
+	}
+	qm.l.RUnlock()
+
+	if match == nil {
+		return nil
+	}
+
+	result := match.allow(time.Now())
+	if !result.Allowed {
+		metrics.IncrCounter([]string{"quota", "rate_limit", "violation"}, 1)
+		metrics.IncrCounter([]string{"quota", "rate_limit", match.Name, "violation"}, 1)
+	}
+	return result
+}
+
+func (qm *quotaManager) rateLimitView() *BarrierView {
+	return qm.view.SubView(quotaTypeRateLimit + "/")
+}
+
+// readRateLimitQuota reads the configuration of a rate limit quota from
+// storage
+func (qm *quotaManager) readRateLimitQuota(name string) (*RateLimitQuota, error) {
+	entry, err := qm.rateLimitView().Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit quota %q: %v", name, err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var quota RateLimitQuota
+	if err := entry.DecodeJSON(&quota); err != nil {
+		return nil, fmt.Errorf("failed to decode rate limit quota %q: %v", name, err)
+	}
+	return &quota, nil
+}
+
+// rateLimitQuota returns the configuration of a rate limit quota
+func (qm *quotaManager) rateLimitQuota(name string) *RateLimitQuota {
+	qm.l.RLock()
+	defer qm.l.RUnlock()
+
+	quota, ok := qm.rateLimits[name]
+	if !ok {
+		return nil
+	}
+	ret := *quota.RateLimitQuota
+	return &ret
+}
+
+// setRateLimitQuota persists a rate limit quota and starts enforcing it
+// with a full bucket
+func (qm *quotaManager) setRateLimitQuota(quota *RateLimitQuota) error {
+	entry, err := logical.StorageEntryJSON(quota.Name, quota)
+	if err != nil {
+		return err
+	}
+
+	qm.l.Lock()
+	defer qm.l.Unlock()
+
+	if err := qm.rateLimitView().Put(entry); err != nil {
+		return fmt.Errorf("failed to persist rate limit quota %q: %v", quota.Name, err)
+	}
+	qm.rateLimits[quota.Name] = newRateLimitQuota(quota)
+	return nil
+}
+
+// deleteRateLimitQuota removes a rate limit quota
+func (qm *quotaManager) deleteRateLimitQuota(name string) error {
+	qm.l.Lock()
+	defer qm.l.Unlock()
+
+	if err := qm.rateLimitView().Delete(name); err != nil {
+		return fmt.Errorf("failed to delete rate limit quota %q: %v", name, err)
+	}
+	delete(qm.rateLimits, name)
+	return nil
+}
+
+// rateLimitQuotaNames returns the names of all rate limit quotas
+func (qm *quotaManager) rateLimitQuotaNames() []string {
+	qm.l.RLock()
+	defer qm.l.RUnlock()
+
+	names := make([]string, 0, len(qm.rateLimits))
+	for name := range qm.rateLimits {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,398 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRateLimitQuota_Allow(t *testing.T) {
+	quota := newRateLimitQuota(&RateLimitQuota{
+		Name:     "test",
+		Rate:     10,
+		Interval: time.Second,
+		Burst:    2,
+	})
+	now := quota.last
+
+	for i := 0; i < 2; i++ {
+		if result := quota.allow(now); !result.Allowed {
+			t.Fatalf("request %d rejected: %#v", i, result)
+		}
+	}
+	result := quota.allow(now)
+	if result.Allowed {
+		t.Fatalf("expected request to be rejected")
+	}
+	if result.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Tokens are refilled at the rate but never above the burst
+	if result := quota.allow(now.Add(100 * time.Millisecond)); !result.Allowed {
+		t.Fatalf("expected request to be allowed: %#v", result)
+	}
+	result = quota.allow(now.Add(time.Hour))
+	if !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestRateLimitQuota_Path(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/rate-limit/global")
+	req.ClientToken = root
+	req.Data["rate"] = 100
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/rate-limit/secret")
+	req.ClientToken = root
+	req.Data["path"] = "secret/foo"
+	req.Data["rate"] = 5
+	req.Data["interval"] = "1m"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/quotas/rate-limit/secret")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"name":     "secret",
+		"type":     "rate-limit",
+		"path":     "secret/foo",
+		"rate":     5,
+		"interval": int64(60),
+		"burst":    5,
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The most specific quota applies and sys paths are exempt
+	if result := c.ApplyRateLimitQuota("secret/foo/bar"); result == nil || result.Quota != "secret" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result := c.ApplyRateLimitQuota("secret/bar"); result == nil || result.Quota != "global" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result := c.ApplyRateLimitQuota("sys/mounts"); result != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Quotas must be scoped to a mount
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/rate-limit/bad")
+	req.ClientToken = root
+	req.Data["path"] = "nonexistent/"
+	req.Data["rate"] = 5
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Quotas are restored after unsealing
+	c.preSeal()
+	if err := c.postUnseal(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ListOperation, "sys/quotas/rate-limit")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys := resp.Data["keys"].([]string); !reflect.DeepEqual(keys, []string{"global", "secret"}) {
+		t.Fatalf("bad: %#v", keys)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/quotas/rate-limit/secret")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if result := c.ApplyRateLimitQuota("secret/foo/bar"); result == nil || result.Quota != "global" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestQuotaPathMatches(t *testing.T) {
+	cases := []struct {
+		quotaPath string
+		path      string
+		expected  bool
+	}{
+		{"", "secret/foo", true},
+		{"secret/", "secret/foo", true},
+		{"secret/", "secret2/foo", false},
+		{"secret", "secret/foo", true},
+		{"secret", "secret2/foo", false},
+		{"secret/foo", "secret/foo", true},
+		{"secret/foo", "secret/foo/bar", true},
+		{"secret/foo", "secret/foobar", false},
+	}
+	for _, tc := range cases {
+		if actual := quotaPathMatches(tc.quotaPath, tc.path); actual != tc.expected {
+			t.Fatalf("%q on %q: expected %v, got %v", tc.quotaPath, tc.path, tc.expected, actual)
+		}
+	}
+}
+
+func TestRateLimitQuota_SiblingMount(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/secret2")
+	req.Data["type"] = "kv"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/rate-limit/secret")
+	req.ClientToken = root
+	req.Data["path"] = "secret"
+	req.Data["rate"] = 5
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The quota is scoped to the mount
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/quotas/rate-limit/secret")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["path"] != "secret/" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	if result := c.ApplyRateLimitQuota("secret/foo"); result == nil || result.Quota != "secret" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result := c.ApplyRateLimitQuota("secret2/foo"); result != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestLeaseCountQuota(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	createToken := func() (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+		req.ClientToken = root
+		return c.HandleRequest(req)
+	}
+	counter := func() int64 {
+		req := logical.TestRequest(t, logical.ReadOperation, "sys/quotas/lease-count/tokens")
+		req.ClientToken = root
+		resp, err := c.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp.Data["counter"].(int64)
+	}
+
+	// Leases outstanding when the quota is created are counted
+	if _, err := createToken(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/lease-count/tokens")
+	req.ClientToken = root
+	req.Data["path"] = "auth/token/"
+	req.Data["max_leases"] = 2
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := counter(); count != 1 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	resp, err := createToken()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := counter(); count != 2 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	if _, err := createToken(); err == nil || !strings.Contains(err.Error(), logical.ErrLeaseCountQuotaExceeded.Error()) {
+		t.Fatalf("expected quota error, got: %v", err)
+	}
+	if count := counter(); count != 2 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	// Revoking a lease makes room for a new one
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/revoke")
+	req.ClientToken = root
+	req.Data["token"] = resp.Auth.ClientToken
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The token is revoked in the background
+	for i := 0; counter() != 1; i++ {
+		if i == 100 {
+			t.Fatalf("bad: %d", counter())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := createToken(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Counts are rebuilt from the restored leases after unsealing
+	c.preSeal()
+	if err := c.postUnseal(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; c.expiration.inRestoreMode(); i++ {
+		if i == 100 {
+			t.Fatalf("leases not restored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := counter(); count != 2 {
+		t.Fatalf("bad: %d", count)
+	}
+}
+
+func TestLeaseCountQuota_Concurrent(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/lease-count/tokens")
+	req.ClientToken = root
+	req.Data["path"] = "auth/token/"
+	req.Data["max_leases"] = 5
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Room is reserved before the token store is called, so concurrent
+	// requests can't exceed the quota
+	var wg sync.WaitGroup
+	var created int64
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+			req.ClientToken = root
+			if _, err := c.HandleRequest(req); err == nil {
+				atomic.AddInt64(&created, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 5 {
+		t.Fatalf("bad: %d", created)
+	}
+	if _, count := c.quotas.leaseCountQuota("tokens"); count != 5 {
+		t.Fatalf("bad: %d", count)
+	}
+	if counts := c.expiration.LeaseCounts(); counts["auth/token/"] != 5 {
+		t.Fatalf("bad: %#v", counts)
+	}
+}
+
+func TestLeaseCountQuota_Nested(t *testing.T) {
+	noop := &NoopBackend{
+		Response: &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.logicalBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for name, config := range map[string]map[string]interface{}{
+		"global": {"max_leases": 2},
+		"noop":   {"path": "noop/", "max_leases": 1},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/lease-count/"+name)
+		req.ClientToken = root
+		req.Data = config
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	read := func() error {
+		req := logical.TestRequest(t, logical.ReadOperation, "noop/foo")
+		req.ClientToken = root
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	counts := func() (int64, int64) {
+		_, global := c.quotas.leaseCountQuota("global")
+		_, noop := c.quotas.leaseCountQuota("noop")
+		return global, noop
+	}
+
+	// A lease counts towards every quota it falls under
+	if err := read(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if global, count := counts(); global != 1 || count != 1 {
+		t.Fatalf("bad: %d %d", global, count)
+	}
+
+	// Requests that may create a lease are refused before they reach the
+	// backend once a quota is full, and the room reserved in the other quotas
+	// is given back
+	if err := read(); err == nil || !strings.Contains(err.Error(), logical.ErrLeaseCountQuotaExceeded.Error()) {
+		t.Fatalf("expected quota error, got: %v", err)
+	}
+	if len(noop.Requests) != 1 {
+		t.Fatalf("bad: %d", len(noop.Requests))
+	}
+	if global, count := counts(); global != 1 || count != 1 {
+		t.Fatalf("bad: %d %d", global, count)
+	}
+
+	// Other mounts are only limited by the global quota
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil || !strings.Contains(err.Error(), logical.ErrLeaseCountQuotaExceeded.Error()) {
+		t.Fatalf("expected quota error, got: %v", err)
+	}
+
+	// Requests that can't create a lease are still handled
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/lookup-self")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if global, count := counts(); global != 2 || count != 1 {
+		t.Fatalf("bad: %d %d", global, count)
+	}
+}
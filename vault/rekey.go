@@ -2,6 +2,7 @@ package vault
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -384,7 +385,7 @@ func (c *Core) BarrierRekeyUpdate(key []byte, nonce string) (*RekeyResult, error
 				Key:   coreBarrierUnsealKeysBackupPath,
 				Value: buf,
 			}
-			if err = c.physical.Put(pe); err != nil {
+			if err = c.physical.Put(context.Background(), pe); err != nil {
 				c.logger.Error("core: failed to save unseal key backup", "error", err)
 				return nil, fmt.Errorf("failed to save unseal key backup: %v", err)
 			}
@@ -413,7 +414,7 @@ func (c *Core) BarrierRekeyUpdate(key []byte, nonce string) (*RekeyResult, error
 
 	// Write to the canary path, which will force a synchronous truing during
 	// replication
-	if err := c.barrier.Put(&Entry{
+	if err := c.barrier.Put(context.Background(), &Entry{
 		Key:   coreKeyringCanaryPath,
 		Value: []byte(c.barrierRekeyConfig.Nonce),
 	}); err != nil {
@@ -572,7 +573,7 @@ func (c *Core) RecoveryRekeyUpdate(key []byte, nonce string) (*RekeyResult, erro
 				Key:   coreRecoveryUnsealKeysBackupPath,
 				Value: buf,
 			}
-			if err = c.physical.Put(pe); err != nil {
+			if err = c.physical.Put(context.Background(), pe); err != nil {
 				c.logger.Error("core: failed to save unseal key backup", "error", err)
 				return nil, fmt.Errorf("failed to save unseal key backup: %v", err)
 			}
@@ -591,7 +592,7 @@ func (c *Core) RecoveryRekeyUpdate(key []byte, nonce string) (*RekeyResult, erro
 
 	// Write to the canary path, which will force a synchronous truing during
 	// replication
-	if err := c.barrier.Put(&Entry{
+	if err := c.barrier.Put(context.Background(), &Entry{
 		Key:   coreKeyringCanaryPath,
 		Value: []byte(c.recoveryRekeyConfig.Nonce),
 	}); err != nil {
@@ -648,9 +649,9 @@ func (c *Core) RekeyRetrieveBackup(recovery bool) (*RekeyBackup, error) {
 	var entry *physical.Entry
 	var err error
 	if recovery {
-		entry, err = c.physical.Get(coreRecoveryUnsealKeysBackupPath)
+		entry, err = c.physical.Get(context.Background(), coreRecoveryUnsealKeysBackupPath)
 	} else {
-		entry, err = c.physical.Get(coreBarrierUnsealKeysBackupPath)
+		entry, err = c.physical.Get(context.Background(), coreBarrierUnsealKeysBackupPath)
 	}
 	if err != nil {
 		return nil, err
@@ -683,7 +684,7 @@ func (c *Core) RekeyDeleteBackup(recovery bool) error {
 	defer c.rekeyLock.Unlock()
 
 	if recovery {
-		return c.physical.Delete(coreRecoveryUnsealKeysBackupPath)
+		return c.physical.Delete(context.Background(), coreRecoveryUnsealKeysBackupPath)
 	}
-	return c.physical.Delete(coreBarrierUnsealKeysBackupPath)
+	return c.physical.Delete(context.Background(), coreBarrierUnsealKeysBackupPath)
 }
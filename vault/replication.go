@@ -0,0 +1,1481 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// replicationALPN is the protocol negotiated on the cluster port by
+	// secondaries connecting to their primary
+	replicationALPN = "repl_v1"
+
+	// coreReplicationConfigPath is used to store the replication configuration
+	// of the cluster. Like everything else under core/ it is never replicated.
+	coreReplicationConfigPath = "core/replication/config"
+
+	// coreReplicationSecondaryPrefix is the prefix under which a primary
+	// stores the secondaries it has issued activation tokens for
+	coreReplicationSecondaryPrefix = "core/replication/secondaries/"
+
+	// replicationMerklePages is the number of pages the replicated keys are
+	// hashed into when comparing the storage of two clusters
+	replicationMerklePages = 256
+
+	// replicationBatchSize is the maximum number of entries sent at once
+	replicationBatchSize = 128
+
+	// replicationDefaultTokenTTL is how long an activation token can be used
+	// to activate a secondary by default
+	replicationDefaultTokenTTL = 30 * time.Minute
+)
+
+const (
+	replicationStateConnecting = "connecting"
+	replicationStateMerkleSync = "merkle-sync"
+	replicationStateStreamWALs = "stream-wals"
+)
+
+var (
+	// replicationStreamInterval is how often a primary checks for new writes
+	// to stream to a secondary. It's var not const so that tests can
+	// manipulate it.
+	replicationStreamInterval = 250 * time.Millisecond
+
+	// replicationRetryInterval is how long a secondary waits before
+	// connecting to its primary again. It's var not const so that tests can
+	// manipulate it.
+	replicationRetryInterval = 5 * time.Second
+
+	// errReplicationReload is used by a secondary to stop streaming when the
+	// replicated tables it was set up from have changed
+	errReplicationReload = errors.New("replicated tables changed")
+)
+
+// replicationConfig is the replication configuration of a cluster
+type replicationConfig struct {
+	Mode consts.ReplicationState `json:"mode"`
+
+	// The certificate authority of a primary, which issues the client
+	// certificates of its secondaries
+	CACert []byte `json:"ca_cert,omitempty"`
+	CAKey  []byte `json:"ca_key,omitempty"`
+
+	// The parameters of a secondary, taken from its activation token
+	ID                 string `json:"id,omitempty"`
+	PrimaryClusterAddr string `json:"primary_cluster_addr,omitempty"`
+	PrimaryCACert      []byte `json:"primary_ca_cert,omitempty"`
+	ClientCert         []byte `json:"client_cert,omitempty"`
+	ClientKey          []byte `json:"client_key,omitempty"`
+}
+
+// replicationSecondaryEntry is a secondary known to a primary
+type replicationSecondaryEntry struct {
+	ID                 string    `json:"id"`
+	SerialNumber       string    `json:"serial_number"`
+	ActivationDeadline time.Time `json:"activation_deadline"`
+	Activated          bool      `json:"activated"`
+}
+
+// replicationActivationToken carries what a secondary needs to connect to
+// its primary
+type replicationActivationToken struct {
+	ID                 string `json:"id"`
+	PrimaryClusterAddr string `json:"primary_cluster_addr"`
+	CACert             []byte `json:"ca_cert"`
+	ClientCert         []byte `json:"client_cert"`
+	ClientKey          []byte `json:"client_key"`
+}
+
+// secondaryReplication tracks the progress of a secondary. It is kept across
+// reloads so that streaming resumes from where it stopped.
+type secondaryReplication struct {
+	l           sync.RWMutex
+	epoch       string
+	index       uint64
+	state       string
+	lastReindex time.Time
+	cancelFunc  context.CancelFunc
+
+	// client is connected to the primary while streaming, and is used to
+	// forward writes
+	client ReplicationClient
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func (r *secondaryReplication) position() (string, uint64) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return r.epoch, r.index
+}
+
+func (r *secondaryReplication) setPosition(epoch string, index uint64) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.epoch = epoch
+	r.index = index
+	r.state = replicationStateStreamWALs
+}
+
+func (r *secondaryReplication) setState(state string) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.state = state
+}
+
+// reset forgets the position of the secondary, which makes it reindex
+// against the primary the next time it connects
+func (r *secondaryReplication) reset() {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.epoch = ""
+	r.index = 0
+	if r.cancelFunc != nil {
+		r.cancelFunc()
+	}
+}
+
+// loadReplicationConfig reads the replication configuration of the cluster
+// and sets the replication state from it
+func (c *Core) loadReplicationConfig() error {
+	entry, err := c.barrier.Get(context.Background(), coreReplicationConfigPath)
+	if err != nil {
+		return errwrap.Wrapf("failed to read replication configuration: {{err}}", err)
+	}
+
+	c.replicationConfig = nil
+	c.replicationState = consts.ReplicationDisabled
+	if entry == nil {
+		return nil
+	}
+
+	var config replicationConfig
+	if err := json.Unmarshal(entry.Value, &config); err != nil {
+		return errwrap.Wrapf("failed to decode replication configuration: {{err}}", err)
+	}
+	c.replicationConfig = &config
+	c.replicationState = config.Mode
+	return nil
+}
+
+// persistReplicationConfig stores the replication configuration of the
+// cluster. It takes effect once the active node reloads.
+func (c *Core) persistReplicationConfig(config *replicationConfig) error {
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(context.Background(), &Entry{
+		Key:   coreReplicationConfigPath,
+		Value: value,
+	})
+}
+
+// startReplication starts replication according to the configuration
+// loaded on unseal. Primaries start accepting connections from secondaries on
+// the cluster port, and secondaries start streaming from their primary.
+func (c *Core) startReplication() error {
+	config := c.replicationConfig
+	if config == nil {
+		return nil
+	}
+
+	switch {
+	case config.Mode.HasState(consts.ReplicationPerformancePrimary):
+		caCert, caKey, err := config.parseCA()
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(caCert)
+
+		c.clusterParamsLock.Lock()
+		c.replicationTLSCert = &tls.Certificate{
+			Certificate: [][]byte{config.CACert},
+			PrivateKey:  caKey,
+			Leaf:        caCert,
+		}
+		c.replicationCAPool = pool
+		c.clusterParamsLock.Unlock()
+
+	case config.Mode.HasState(consts.ReplicationPerformanceSecondary):
+		tlsConfig, err := c.replicationClientTLSConfig(config)
+		if err != nil {
+			return err
+		}
+
+		r := c.replicationSecondary
+		r.l.Lock()
+		r.stopCh = make(chan struct{})
+		r.doneCh = make(chan struct{})
+		r.state = replicationStateConnecting
+		go c.runReplicationSecondary(config, tlsConfig, r.stopCh, r.doneCh)
+		r.l.Unlock()
+	}
+
+	return nil
+}
+
+// stopReplication stops accepting connections from secondaries, or stops
+// streaming from the primary
+func (c *Core) stopReplication() error {
+	c.clusterParamsLock.Lock()
+	c.replicationTLSCert = nil
+	c.replicationCAPool = nil
+	c.clusterParamsLock.Unlock()
+
+	c.replicationMerkleTreesLock.Lock()
+	c.replicationMerkleTrees = make(map[string]*merkleTree)
+	c.replicationMerkleTreesLock.Unlock()
+
+	r := c.replicationSecondary
+	r.l.Lock()
+	stopCh, doneCh := r.stopCh, r.doneCh
+	r.stopCh, r.doneCh = nil, nil
+	r.l.Unlock()
+
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+	return nil
+}
+
+// lastRemoteWALImpl returns the index of the last write a secondary received
+// from its primary
+func lastRemoteWALImpl(c *Core) uint64 {
+	if !c.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		return 0
+	}
+	_, index := c.replicationSecondary.position()
+	return index
+}
+
+// reloadReplication sets up the active node again, after the replication
+// configuration or the replicated tables have changed
+func (c *Core) reloadReplication() {
+	defer metrics.MeasureSince([]string{"replication", "reload"}, time.Now())
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.sealed || c.standby {
+		return
+	}
+
+	c.logger.Info("core: reloading replicated state")
+	if c.requestContextCancelFunc != nil {
+		c.requestContextCancelFunc()
+	}
+	if err := c.preSeal(); err != nil {
+		c.logger.Error("core: error tearing down replicated state", "error", err)
+	}
+	if err := c.postUnseal(); err != nil {
+		// There is little we can do without our mounts, so shut down; this
+		// is run in a goroutine as sealing needs the state lock
+		c.logger.Error("core: failed to reload replicated state", "error", err)
+		go c.Shutdown()
+	}
+}
+
+// enableReplicationPrimary makes this cluster a primary
+func (c *Core) enableReplicationPrimary() error {
+	config, err := newPrimaryReplicationConfig()
+	if err != nil {
+		return err
+	}
+	if err := c.persistReplicationConfig(config); err != nil {
+		return err
+	}
+
+	// The request holds the state lock, so this only proceeds once it is done
+	go c.reloadReplication()
+	return nil
+}
+
+// enableReplicationSecondary makes this cluster a secondary of the primary
+// that issued the given activation token. The primary cluster address in the
+// token can be overridden, for instance when the primary is behind a load
+// balancer.
+func (c *Core) enableReplicationSecondary(token *replicationActivationToken, primaryClusterAddr string) error {
+	if primaryClusterAddr == "" {
+		primaryClusterAddr = token.PrimaryClusterAddr
+	}
+	config := &replicationConfig{
+		Mode:               consts.ReplicationPerformanceSecondary,
+		ID:                 token.ID,
+		PrimaryClusterAddr: primaryClusterAddr,
+		PrimaryCACert:      token.CACert,
+		ClientCert:         token.ClientCert,
+		ClientKey:          token.ClientKey,
+	}
+	if _, err := c.replicationClientTLSConfig(config); err != nil {
+		return err
+	}
+	if err := c.persistReplicationConfig(config); err != nil {
+		return err
+	}
+
+	// Start over from a reindex against the new primary
+	c.replicationSecondary.reset()
+	go c.reloadReplication()
+	return nil
+}
+
+// promoteReplicationSecondary turns this secondary into a primary, which
+// keeps the data replicated so far. Secondaries of the former primary have
+// to be pointed at it with new activation tokens.
+func (c *Core) promoteReplicationSecondary() error {
+	c.logger.Info("core: promoting replication secondary to primary")
+	return c.enableReplicationPrimary()
+}
+
+// replicatedKey returns whether the given storage key is replicated from a
+// primary to its secondaries. Tokens, leases, control group requests and used
+// MFA passcodes are local to each cluster, as are local mounts, whose UUIDs
+// are given.
+func replicatedKey(key string, localUUIDs map[string]bool) bool {
+	switch {
+	case key == coreMountConfigPath, key == coreAuthConfigPath, key == coreAuditConfigPath:
+		return true
+	case strings.HasPrefix(key, pluginCatalogPath):
+		return true
+	case strings.HasPrefix(key, systemBarrierPrefix):
+		key = strings.TrimPrefix(key, systemBarrierPrefix)
+		for _, prefix := range []string{tokenSubPath, expirationSubPath, controlGroupSubPath, mfaUsedCodeSubPath} {
+			if strings.HasPrefix(key, prefix) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, prefix := range []string{backendBarrierPrefix, credentialBarrierPrefix, auditBarrierPrefix} {
+		if strings.HasPrefix(key, prefix) {
+			mountUUID := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+			return !localUUIDs[mountUUID]
+		}
+	}
+	return false
+}
+
+// localMountUUIDs returns the UUIDs of the local mounts, auth methods and
+// audit devices
+func (c *Core) localMountUUIDs() map[string]bool {
+	local := make(map[string]bool)
+	addLocal := func(lock *sync.RWMutex, table **MountTable) {
+		lock.RLock()
+		defer lock.RUnlock()
+		if *table == nil {
+			return
+		}
+		for _, entry := range (*table).Entries {
+			if entry.Local {
+				local[entry.UUID] = true
+			}
+		}
+	}
+	addLocal(&c.mountsLock, &c.mounts)
+	addLocal(&c.authLock, &c.auth)
+	addLocal(&c.auditLock, &c.audit)
+	return local
+}
+
+// secondaryReadOnlyPaths are the system paths that write configuration a
+// secondary receives from its primary. Writes to them on a secondary would
+// be overwritten by replication, so they are rejected.
+var secondaryReadOnlyPaths = []string{
+	"sys/config/auditing/",
+	"sys/config/cors",
+	"sys/mfa/",
+	"sys/plugins/catalog",
+	"sys/policy",
+	"sys/quotas/",
+}
+
+// secondaryReadOnly returns whether the request writes replicated
+// configuration on a secondary
+func (c *Core) secondaryReadOnly(req *logical.Request) bool {
+	if !c.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		return false
+	}
+	switch req.Operation {
+	case logical.CreateOperation, logical.UpdateOperation, logical.DeleteOperation:
+	default:
+		return false
+	}
+	for _, prefix := range secondaryReadOnlyPaths {
+		if strings.HasPrefix(req.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secondaryBarrier rejects writes to the keys a secondary receives from its
+// primary, except for those it forwards to the primary
+type secondaryBarrier struct {
+	BarrierStorage
+	core *Core
+}
+
+func (b *secondaryBarrier) Put(ctx context.Context, entry *Entry) error {
+	switch {
+	case b.core.replicationForwardedKey(entry.Key):
+		return b.core.forwardReplicatedWrite(ctx, b.BarrierStorage, &ReplicationEntry{
+			Key:   entry.Key,
+			Value: entry.Value,
+		})
+	case replicatedKey(entry.Key, nil):
+		return logical.ErrReadOnly
+	}
+	return b.BarrierStorage.Put(ctx, entry)
+}
+
+func (b *secondaryBarrier) Delete(ctx context.Context, key string) error {
+	switch {
+	case b.core.replicationForwardedKey(key):
+		return b.core.forwardReplicatedWrite(ctx, b.BarrierStorage, &ReplicationEntry{
+			Key:     key,
+			Deleted: true,
+		})
+	case replicatedKey(key, nil):
+		return logical.ErrReadOnly
+	}
+	return b.BarrierStorage.Delete(ctx, key)
+}
+
+// replicationForwardedKey returns whether a write to the given key made on a
+// secondary is forwarded to its primary. Logins write to the storage of auth
+// methods and of the identity store, so writes to the storage of replicated
+// auth methods and of the identity store are.
+func (c *Core) replicationForwardedKey(key string) bool {
+	var mountUUID string
+	for _, prefix := range []string{backendBarrierPrefix, credentialBarrierPrefix} {
+		if strings.HasPrefix(key, prefix) {
+			mountUUID = strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+			break
+		}
+	}
+
+	entry := c.router.MatchingMountByUUID(mountUUID)
+	if entry == nil || entry.UUID != mountUUID || entry.Local {
+		return false
+	}
+	return entry.Table == credentialTableType || entry.Type == "identity"
+}
+
+// forwardReplicatedWrite makes a write on the primary of this secondary. It
+// is applied to the given storage as well, so that it can be read back
+// before the primary streams it.
+func (c *Core) forwardReplicatedWrite(ctx context.Context, storage BarrierStorage, entry *ReplicationEntry) error {
+	r := c.replicationSecondary
+	r.l.RLock()
+	client := r.client
+	r.l.RUnlock()
+	if client == nil {
+		return errwrap.Wrapf("not connected to the replication primary: {{err}}", logical.ErrReadOnly)
+	}
+
+	if _, err := client.Write(ctx, entry); err != nil {
+		return errwrap.Wrapf("failed to forward write to the replication primary: {{err}}", err)
+	}
+	metrics.IncrCounter([]string{"replication", "forwarded_writes"}, 1)
+
+	if entry.Deleted {
+		return storage.Delete(ctx, entry.Key)
+	}
+	return storage.Put(ctx, &Entry{
+		Key:   entry.Key,
+		Value: entry.Value,
+	})
+}
+
+// mountEntryBarrierView returns the view for the storage of a mount entry. On
+// a secondary, the storage of mounts that are not local can only be written
+// to by replication.
+func (c *Core) mountEntryBarrierView(entry *MountEntry, prefix string) *BarrierView {
+	if entry.Local {
+		return c.newBarrierView(prefix)
+	}
+	return c.replicatedBarrierView(prefix)
+}
+
+// replicatedBarrierView returns a view of storage that is replicated from a
+// primary, which on a secondary can only be written to by replication
+func (c *Core) replicatedBarrierView(prefix string) *BarrierView {
+	view := c.newBarrierView(prefix)
+	if c.replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		view.barrier = &secondaryBarrier{
+			BarrierStorage: view.barrier,
+			core:           c,
+		}
+	}
+	return view
+}
+
+// merkleTree hashes the replicated keys of a cluster into pages, so that two
+// clusters can find the keys they differ on without exchanging all of them
+type merkleTree struct {
+	pages [replicationMerklePages]map[string][]byte
+}
+
+func newMerkleTree() *merkleTree {
+	t := &merkleTree{}
+	for i := range t.pages {
+		t.pages[i] = make(map[string][]byte)
+	}
+	return t
+}
+
+func merklePage(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return uint32(sum[0]) % replicationMerklePages
+}
+
+func (t *merkleTree) add(key string, value []byte) {
+	sum := sha256.Sum256(value)
+	t.pages[merklePage(key)][key] = sum[:]
+}
+
+func (t *merkleTree) hash(key string) []byte {
+	return t.pages[merklePage(key)][key]
+}
+
+func (t *merkleTree) pageHash(page uint32) []byte {
+	keys := make([]string, 0, len(t.pages[page]))
+	for key := range t.pages[page] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(t.pages[page][key])
+	}
+	return h.Sum(nil)
+}
+
+func (t *merkleTree) pageHashes() [][]byte {
+	hashes := make([][]byte, replicationMerklePages)
+	for i := range hashes {
+		hashes[i] = t.pageHash(uint32(i))
+	}
+	return hashes
+}
+
+func merkleRoot(pageHashes [][]byte) []byte {
+	h := sha256.New()
+	for _, hash := range pageHashes {
+		h.Write(hash)
+	}
+	return h.Sum(nil)
+}
+
+// replicationMerkleTree builds the merkle tree of the replicated keys
+func (c *Core) replicationMerkleTree() (*merkleTree, error) {
+	defer metrics.MeasureSince([]string{"replication", "merkle", "build"}, time.Now())
+
+	local := c.localMountUUIDs()
+	tree := newMerkleTree()
+
+	addKey := func(key string) error {
+		entry, err := c.barrier.Get(context.Background(), key)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			tree.add(key, entry.Value)
+		}
+		return nil
+	}
+
+	var walk func(prefix string) error
+	walk = func(prefix string) error {
+		keys, err := c.barrier.List(context.Background(), prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			key = prefix + key
+
+			// Skip anything that is not replicated, including whole subtrees
+			// such as the storage of local mounts
+			if !replicatedKey(key, local) {
+				continue
+			}
+			if strings.HasSuffix(key, "/") {
+				err = walk(key)
+			} else {
+				err = addKey(key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, key := range []string{coreMountConfigPath, coreAuthConfigPath, coreAuditConfigPath} {
+		if err := addKey(key); err != nil {
+			return nil, err
+		}
+	}
+	for _, prefix := range []string{pluginCatalogPath, systemBarrierPrefix, backendBarrierPrefix, credentialBarrierPrefix, auditBarrierPrefix} {
+		if err := walk(prefix); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// replicationMerkleTreeFor returns the merkle tree of the current reindex of
+// the given secondary, building it if a reindex starts or none was built
+func (c *Core) replicationMerkleTreeFor(id string, rebuild bool) (*merkleTree, error) {
+	c.replicationMerkleTreesLock.Lock()
+	tree := c.replicationMerkleTrees[id]
+	c.replicationMerkleTreesLock.Unlock()
+	if tree != nil && !rebuild {
+		return tree, nil
+	}
+
+	tree, err := c.replicationMerkleTree()
+	if err != nil {
+		return nil, err
+	}
+	c.replicationMerkleTreesLock.Lock()
+	c.replicationMerkleTrees[id] = tree
+	c.replicationMerkleTreesLock.Unlock()
+	return tree, nil
+}
+
+// clearReplicationMerkleTree drops the merkle tree kept for a secondary
+func (c *Core) clearReplicationMerkleTree(id string) {
+	c.replicationMerkleTreesLock.Lock()
+	delete(c.replicationMerkleTrees, id)
+	c.replicationMerkleTreesLock.Unlock()
+}
+
+// replicationEntries reads the current value of the given replicated keys
+func (c *Core) replicationEntries(keys []string) ([]*ReplicationEntry, error) {
+	local := c.localMountUUIDs()
+	seen := make(map[string]bool, len(keys))
+
+	var entries []*ReplicationEntry
+	for _, key := range keys {
+		if seen[key] || !replicatedKey(key, local) {
+			continue
+		}
+		seen[key] = true
+
+		entry, err := c.barrier.Get(context.Background(), key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			entries = append(entries, &ReplicationEntry{Key: key, Deleted: true})
+			continue
+		}
+		entries = append(entries, &ReplicationEntry{Key: key, Value: entry.Value})
+	}
+	return entries, nil
+}
+
+// applyReplicationEntries writes the entries received from the primary and
+// returns whether the active node needs to reload
+func (c *Core) applyReplicationEntries(entries []*ReplicationEntry) (bool, error) {
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	local := c.localMountUUIDs()
+	keys := make([]string, 0, len(entries))
+	var reload bool
+	for _, entry := range entries {
+		if !replicatedKey(entry.Key, local) {
+			c.logger.Warn("core: ignoring replicated write to a local key", "key", entry.Key)
+			continue
+		}
+
+		var err error
+		if entry.Deleted {
+			err = c.barrier.Delete(context.Background(), entry.Key)
+		} else {
+			err = c.barrier.Put(context.Background(), &Entry{
+				Key:   entry.Key,
+				Value: entry.Value,
+			})
+		}
+		if err != nil {
+			return false, errwrap.Wrapf("failed to apply replicated write: {{err}}", err)
+		}
+
+		// Audit devices are set up again rather than invalidated, as that
+		// would need the state lock held while this secondary is stopped
+		switch {
+		case perfStandbyReloadKey(entry.Key), strings.HasPrefix(entry.Key, auditBarrierPrefix):
+			reload = true
+		default:
+			keys = append(keys, entry.Key)
+		}
+	}
+
+	c.invalidateKeys(keys)
+	metrics.IncrCounter([]string{"replication", "wal", "applied"}, float32(len(entries)))
+	return reload, nil
+}
+
+// runReplicationSecondary streams the writes made on the primary until
+// stopped
+func (c *Core) runReplicationSecondary(config *replicationConfig, tlsConfig *tls.Config, stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	r := c.replicationSecondary
+	for {
+		err := c.replicateFromPrimary(config, tlsConfig, stopCh)
+
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		if err == errReplicationReload {
+			// The reload stops this goroutine, so it has to run separately
+			go c.reloadReplication()
+			return
+		}
+		if err != nil {
+			c.logger.Error("core: error replicating from primary", "primary_cluster_addr", config.PrimaryClusterAddr, "error", err)
+		}
+
+		r.setState(replicationStateConnecting)
+		select {
+		case <-time.After(replicationRetryInterval):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// replicateFromPrimary connects to the primary and applies the writes it
+// streams, reindexing first if the primary cannot stream from the position of
+// this secondary
+func (c *Core) replicateFromPrimary(config *replicationConfig, tlsConfig *tls.Config, stopCh chan struct{}) error {
+	r := c.replicationSecondary
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	r.l.Lock()
+	r.cancelFunc = cancel
+	r.l.Unlock()
+
+	clusterURL, err := url.Parse(config.PrimaryClusterAddr)
+	if err != nil {
+		return errwrap.Wrapf("error parsing primary cluster address: {{err}}", err)
+	}
+
+	conn, err := grpc.DialContext(ctx, clusterURL.Host,
+		grpc.WithDialer(replicationDialer(tlsConfig)),
+		grpc.WithInsecure(), // it's not, we handle it in the dialer
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time: 2 * heartbeatInterval,
+		}))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := NewReplicationClient(conn)
+
+	r.l.Lock()
+	r.client = client
+	r.l.Unlock()
+	defer func() {
+		r.l.Lock()
+		r.client = nil
+		r.l.Unlock()
+	}()
+
+	epoch, index := r.position()
+	stream, err := client.Stream(ctx, &ReplicationStreamRequest{
+		Epoch: epoch,
+		Index: index,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		batch, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		var reload bool
+		if batch.Reindex {
+			r.setState(replicationStateMerkleSync)
+			if reload, err = c.replicationReindex(ctx, client); err != nil {
+				return errwrap.Wrapf("error reindexing: {{err}}", err)
+			}
+		}
+
+		changed, err := c.applyReplicationEntries(batch.Entries)
+		if err != nil {
+			return err
+		}
+		r.setPosition(batch.Epoch, batch.Index)
+
+		if reload || changed {
+			return errReplicationReload
+		}
+	}
+}
+
+// replicationReindex brings the replicated keys of a secondary in line with
+// its primary by comparing the merkle trees of both clusters, and returns
+// whether the active node needs to reload
+func (c *Core) replicationReindex(ctx context.Context, client ReplicationClient) (bool, error) {
+	defer metrics.MeasureSince([]string{"replication", "reindex"}, time.Now())
+
+	tree, err := c.replicationMerkleTree()
+	if err != nil {
+		return false, err
+	}
+	remote, err := client.Merkle(ctx, &MerkleRequest{})
+	if err != nil {
+		return false, err
+	}
+	if len(remote.PageHashes) != replicationMerklePages {
+		return false, fmt.Errorf("expected %d merkle pages, got %d", replicationMerklePages, len(remote.PageHashes))
+	}
+
+	var pages []uint32
+	for i, hash := range remote.PageHashes {
+		if !bytes.Equal(tree.pageHash(uint32(i)), hash) {
+			pages = append(pages, uint32(i))
+		}
+	}
+
+	// Find the keys that differ on the pages that differ
+	var fetch []string
+	var deleted []*ReplicationEntry
+	for len(pages) > 0 {
+		n := 32
+		if n > len(pages) {
+			n = len(pages)
+		}
+		reply, err := client.Merkle(ctx, &MerkleRequest{Pages: pages[:n]})
+		if err != nil {
+			return false, err
+		}
+
+		remoteKeys := make(map[string]bool, len(reply.Keys))
+		for _, key := range reply.Keys {
+			remoteKeys[key.Key] = true
+			if !bytes.Equal(tree.hash(key.Key), key.Hash) {
+				fetch = append(fetch, key.Key)
+			}
+		}
+		for _, page := range pages[:n] {
+			for key := range tree.pages[page] {
+				if !remoteKeys[key] {
+					deleted = append(deleted, &ReplicationEntry{Key: key, Deleted: true})
+				}
+			}
+		}
+		pages = pages[n:]
+	}
+
+	written := len(fetch)
+	reload, err := c.applyReplicationEntries(deleted)
+	if err != nil {
+		return false, err
+	}
+	for len(fetch) > 0 {
+		n := replicationBatchSize
+		if n > len(fetch) {
+			n = len(fetch)
+		}
+		batch, err := client.FetchEntries(ctx, &FetchEntriesRequest{Keys: fetch[:n]})
+		if err != nil {
+			return false, err
+		}
+		changed, err := c.applyReplicationEntries(batch.Entries)
+		if err != nil {
+			return false, err
+		}
+		reload = reload || changed
+		fetch = fetch[n:]
+	}
+
+	r := c.replicationSecondary
+	r.l.Lock()
+	r.lastReindex = time.Now()
+	r.l.Unlock()
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: reindexed replicated keys", "written", written, "deleted", len(deleted))
+	}
+	return reload, nil
+}
+
+// replicationDialer returns a dialer connecting to the cluster port of a
+// primary with the TLS configuration of the secondary
+func replicationDialer(tlsConfig *tls.Config) func(string, time.Duration) (net.Conn, error) {
+	return func(addr string, timeout time.Duration) (net.Conn, error) {
+		dialer := &net.Dialer{
+			Timeout: timeout,
+		}
+		return tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	}
+}
+
+// replicationClientTLSConfig returns the TLS configuration a secondary uses
+// to connect to its primary
+func (c *Core) replicationClientTLSConfig(config *replicationConfig) (*tls.Config, error) {
+	caCert, err := x509.ParseCertificate(config.PrimaryCACert)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing primary CA certificate: {{err}}", err)
+	}
+	clientCert, err := x509.ParseCertificate(config.ClientCert)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing client certificate: {{err}}", err)
+	}
+	clientKey, err := x509.ParseECPrivateKey(config.ClientKey)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing client key: {{err}}", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{
+			{
+				Certificate: [][]byte{config.ClientCert},
+				PrivateKey:  clientKey,
+				Leaf:        clientCert,
+			},
+		},
+		RootCAs:      pool,
+		ServerName:   caCert.Subject.CommonName,
+		NextProtos:   []string{replicationALPN},
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: c.clusterCipherSuites,
+	}, nil
+}
+
+// replicationServerTLSConfig returns the TLS configuration used by a primary
+// for connections from its secondaries
+func (c *Core) replicationServerTLSConfig() (*tls.Config, error) {
+	c.clusterParamsLock.RLock()
+	cert := c.replicationTLSCert
+	pool := c.replicationCAPool
+	c.clusterParamsLock.RUnlock()
+
+	if cert == nil {
+		return nil, fmt.Errorf("got replication connection but replication is not enabled")
+	}
+
+	return &tls.Config{
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		Certificates: []tls.Certificate{*cert},
+		ClientCAs:    pool,
+		NextProtos:   []string{replicationALPN},
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: c.clusterCipherSuites,
+	}, nil
+}
+
+func (config *replicationConfig) parseCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caCert, err := x509.ParseCertificate(config.CACert)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("error parsing replication CA certificate: {{err}}", err)
+	}
+	caKey, err := x509.ParseECPrivateKey(config.CAKey)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("error parsing replication CA key: {{err}}", err)
+	}
+	return caCert, caKey, nil
+}
+
+// newPrimaryReplicationConfig returns the configuration of a new primary,
+// with a new certificate authority for its secondaries
+func newPrimaryReplicationConfig() (*replicationConfig, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	host = fmt.Sprintf("repl-%s", host)
+	serial, err := replicationSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: host,
+		},
+		DNSNames: []string{host},
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement | x509.KeyUsageCertSign,
+		SerialNumber:          serial,
+		NotBefore:             time.Now().Add(-30 * time.Second),
+		NotAfter:              time.Now().Add(262980 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, errwrap.Wrapf("unable to generate replication CA certificate: {{err}}", err)
+	}
+
+	return &replicationConfig{
+		Mode:   consts.ReplicationPerformancePrimary,
+		CACert: certBytes,
+		CAKey:  keyBytes,
+	}, nil
+}
+
+func replicationSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// replicationSecondaryToken issues an activation token for a new secondary
+// with the given identifier
+func (c *Core) replicationSecondaryToken(id string, ttl time.Duration) (string, error) {
+	config := c.replicationConfig
+	if config == nil || !config.Mode.HasState(consts.ReplicationPerformancePrimary) {
+		return "", fmt.Errorf("replication primary mode is not enabled")
+	}
+	if c.clusterAddr == "" {
+		return "", fmt.Errorf("no cluster address is configured")
+	}
+
+	existing, err := c.replicationSecondaryEntry(id)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return "", fmt.Errorf("a secondary with ID %q already exists", id)
+	}
+
+	caCert, caKey, err := config.parseCA()
+	if err != nil {
+		return "", err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	serial, err := replicationSerialNumber()
+	if err != nil {
+		return "", err
+	}
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: id,
+		},
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth,
+		},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-30 * time.Second),
+		NotAfter:     time.Now().Add(262980 * time.Hour),
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return "", errwrap.Wrapf("unable to generate secondary certificate: {{err}}", err)
+	}
+
+	entry := &replicationSecondaryEntry{
+		ID:                 id,
+		SerialNumber:       serial.String(),
+		ActivationDeadline: time.Now().Add(ttl),
+	}
+	if err := c.persistReplicationSecondaryEntry(entry); err != nil {
+		return "", err
+	}
+
+	token, err := json.Marshal(&replicationActivationToken{
+		ID:                 id,
+		PrimaryClusterAddr: c.clusterAddr,
+		CACert:             config.CACert,
+		ClientCert:         certBytes,
+		ClientKey:          keyBytes,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// parseReplicationActivationToken decodes an activation token issued by a
+// primary
+func parseReplicationActivationToken(token string) (*replicationActivationToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid activation token")
+	}
+	var parsed replicationActivationToken
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid activation token")
+	}
+	if parsed.ID == "" || parsed.PrimaryClusterAddr == "" || len(parsed.CACert) == 0 || len(parsed.ClientCert) == 0 || len(parsed.ClientKey) == 0 {
+		return nil, fmt.Errorf("incomplete activation token")
+	}
+	return &parsed, nil
+}
+
+func (c *Core) replicationSecondaryEntry(id string) (*replicationSecondaryEntry, error) {
+	raw, err := c.barrier.Get(context.Background(), coreReplicationSecondaryPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	var entry replicationSecondaryEntry
+	if err := json.Unmarshal(raw.Value, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (c *Core) persistReplicationSecondaryEntry(entry *replicationSecondaryEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(context.Background(), &Entry{
+		Key:   coreReplicationSecondaryPrefix + entry.ID,
+		Value: value,
+	})
+}
+
+// checkReplicationPeer verifies that the secondary on the other end of a
+// replication connection is known to this primary, and marks it as
+// activated on its first connection. The ID of the secondary is returned.
+func (c *Core) checkReplicationPeer(ctx context.Context) (string, error) {
+	c.clusterParamsLock.RLock()
+	primary := c.replicationTLSCert != nil
+	c.clusterParamsLock.RUnlock()
+	if !primary {
+		return "", fmt.Errorf("replication primary mode is not enabled")
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("missing peer information")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return "", fmt.Errorf("missing peer certificate")
+	}
+	cert := tlsInfo.State.PeerCertificates[0]
+
+	entry, err := c.replicationSecondaryEntry(cert.Subject.CommonName)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil || entry.SerialNumber != cert.SerialNumber.String() {
+		return "", fmt.Errorf("unknown secondary")
+	}
+	if entry.Activated {
+		return entry.ID, nil
+	}
+
+	if time.Now().After(entry.ActivationDeadline) {
+		return "", fmt.Errorf("activation token has expired")
+	}
+	entry.Activated = true
+	if err := c.persistReplicationSecondaryEntry(entry); err != nil {
+		return "", err
+	}
+	c.logger.Info("core: replication secondary activated", "id", entry.ID)
+	return entry.ID, nil
+}
+
+// replicationPeerInvalidated returns a channel that is closed once the entry
+// of the given secondary changes. Streams check the entry again then rather
+// than reading it from storage all the time.
+func (c *Core) replicationPeerInvalidated(id string) <-chan struct{} {
+	c.replicationPeersLock.Lock()
+	defer c.replicationPeersLock.Unlock()
+	ch, ok := c.replicationPeers[id]
+	if !ok {
+		ch = make(chan struct{})
+		c.replicationPeers[id] = ch
+	}
+	return ch
+}
+
+// invalidateReplicationPeer tells the streams to the given secondary that its
+// entry changed, such as when it is revoked
+func (c *Core) invalidateReplicationPeer(id string) {
+	c.replicationPeersLock.Lock()
+	defer c.replicationPeersLock.Unlock()
+	if ch, ok := c.replicationPeers[id]; ok {
+		close(ch)
+		delete(c.replicationPeers, id)
+	}
+}
+
+// replicationStatus returns the replication status of the cluster
+func (c *Core) replicationStatus() (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"mode": c.replicationState.String(),
+	}
+
+	switch {
+	case c.replicationState.HasState(consts.ReplicationPerformancePrimary):
+		ids, err := c.barrier.List(context.Background(), coreReplicationSecondaryPrefix)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(ids)
+		data["known_secondaries"] = ids
+
+		var lastWAL uint64
+		if c.replicationWAL != nil {
+			lastWAL = c.replicationWAL.since("", 0).Index
+		}
+		data["last_wal"] = lastWAL
+
+	case c.replicationState.HasState(consts.ReplicationPerformanceSecondary):
+		r := c.replicationSecondary
+		r.l.RLock()
+		data["state"] = r.state
+		data["last_remote_wal"] = r.index
+		if !r.lastReindex.IsZero() {
+			data["last_reindex"] = r.lastReindex.Format(time.RFC3339)
+		}
+		r.l.RUnlock()
+
+		if config := c.replicationConfig; config != nil {
+			data["secondary_id"] = config.ID
+			data["primary_cluster_addr"] = config.PrimaryClusterAddr
+		}
+	}
+
+	return data, nil
+}
+
+type replicationRPCServer struct {
+	core *Core
+}
+
+// Stream sends the writes made on the primary to a secondary, starting from
+// the given position. If the writes since then are not known anymore, the
+// secondary is told to reindex.
+func (s *replicationRPCServer) Stream(in *ReplicationStreamRequest, stream Replication_StreamServer) error {
+	c := s.core
+	ctx := stream.Context()
+	id, err := c.checkReplicationPeer(ctx)
+	if err != nil {
+		return err
+	}
+	if c.replicationWAL == nil {
+		return fmt.Errorf("no write log available")
+	}
+
+	// The merkle tree of a reindex is only needed while the secondary is
+	// connected
+	defer c.clearReplicationMerkleTree(id)
+
+	invalidated := c.replicationPeerInvalidated(id)
+	epoch, index := in.Epoch, in.Index
+	for {
+		reply := c.replicationWAL.since(epoch, index)
+		switch {
+		case reply.Epoch != epoch || reply.Truncated:
+			err := stream.Send(&ReplicationBatch{
+				Epoch:   reply.Epoch,
+				Index:   reply.Index,
+				Reindex: true,
+			})
+			if err != nil {
+				return err
+			}
+
+		case reply.Index != index:
+			entries, err := c.replicationEntries(reply.Keys)
+			if err != nil {
+				return err
+			}
+			for len(entries) > replicationBatchSize {
+				err := stream.Send(&ReplicationBatch{
+					Epoch:   epoch,
+					Index:   index,
+					Entries: entries[:replicationBatchSize],
+				})
+				if err != nil {
+					return err
+				}
+				entries = entries[replicationBatchSize:]
+			}
+			err = stream.Send(&ReplicationBatch{
+				Epoch:   reply.Epoch,
+				Index:   reply.Index,
+				Entries: entries,
+			})
+			if err != nil {
+				return err
+			}
+			metrics.IncrCounter([]string{"replication", "wal", "sent"}, float32(len(entries)))
+		}
+		epoch, index = reply.Epoch, reply.Index
+
+		select {
+		case <-time.After(replicationStreamInterval):
+		case <-invalidated:
+			// Stop streaming to secondaries that have been revoked
+			invalidated = c.replicationPeerInvalidated(id)
+			if _, err := c.checkReplicationPeer(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Merkle returns the hashes of all pages of the merkle tree of the primary,
+// or the hashes of the keys on the requested pages. A request for the hashes
+// of all pages starts a reindex: the tree is built then and kept for the
+// requests for keys that follow, so that the secondary compares against a
+// single view of the primary.
+func (s *replicationRPCServer) Merkle(ctx context.Context, in *MerkleRequest) (*MerkleReply, error) {
+	c := s.core
+	id, err := c.checkReplicationPeer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.replicationMerkleTreeFor(id, len(in.Pages) == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.Pages) == 0 {
+		pageHashes := tree.pageHashes()
+		return &MerkleReply{
+			Root:       merkleRoot(pageHashes),
+			PageHashes: pageHashes,
+		}, nil
+	}
+
+	reply := &MerkleReply{}
+	for _, page := range in.Pages {
+		if page >= replicationMerklePages {
+			return nil, fmt.Errorf("invalid merkle page %d", page)
+		}
+		for key, hash := range tree.pages[page] {
+			reply.Keys = append(reply.Keys, &MerkleKey{
+				Key:  key,
+				Hash: hash,
+			})
+		}
+	}
+	return reply, nil
+}
+
+// FetchEntries returns the current value of the requested keys
+func (s *replicationRPCServer) FetchEntries(ctx context.Context, in *FetchEntriesRequest) (*ReplicationBatch, error) {
+	c := s.core
+	if _, err := c.checkReplicationPeer(ctx); err != nil {
+		return nil, err
+	}
+
+	entries, err := c.replicationEntries(in.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicationBatch{
+		Entries: entries,
+	}, nil
+}
+
+// Write applies a write forwarded by a secondary. Secondaries forward the
+// writes logins make to the storage of auth methods and the identity store.
+func (s *replicationRPCServer) Write(ctx context.Context, in *ReplicationEntry) (*ReplicationWriteReply, error) {
+	c := s.core
+	if _, err := c.checkReplicationPeer(ctx); err != nil {
+		return nil, err
+	}
+	if !c.replicationForwardedKey(in.Key) {
+		return nil, fmt.Errorf("writes to %q cannot be forwarded", in.Key)
+	}
+
+	var err error
+	if in.Deleted {
+		err = c.barrier.Delete(ctx, in.Key)
+	} else {
+		err = c.barrier.Put(ctx, &Entry{
+			Key:   in.Key,
+			Value: in.Value,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The backend owning the key may keep state built from it
+	c.invalidateKeys([]string{in.Key})
+	return &ReplicationWriteReply{}, nil
+}
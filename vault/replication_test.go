@@ -0,0 +1,323 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestReplicatedKey(t *testing.T) {
+	local := map[string]bool{
+		"5678": true,
+	}
+	cases := map[string]bool{
+		"core/mounts":                    true,
+		"core/local-mounts":              false,
+		"core/auth":                      true,
+		"core/audit":                     true,
+		"core/keyring":                   false,
+		"core/replication/config":        false,
+		"core/plugin-catalog/foo":        true,
+		"sys/policy/default":             true,
+		"sys/token/id/1234":              false,
+		"sys/expire/id/secret/foo/1234":  false,
+		"sys/control-group/request/1234": false,
+		"sys/mfa/used-code/1234":         false,
+		"sys/mfa/method/totp/foo":        true,
+		"logical/1234/foo":               true,
+		"logical/5678/foo":               false,
+		"auth/1234/foo":                  true,
+		"auth/5678/":                     false,
+		"audit/5678/salt":                false,
+		"other/foo":                      false,
+	}
+	for key, expected := range cases {
+		if actual := replicatedKey(key, local); actual != expected {
+			t.Fatalf("%s: expected %v, got %v", key, expected, actual)
+		}
+	}
+}
+
+func TestReplicationWAL(t *testing.T) {
+	l := newInvalidationLog(func(key string) bool {
+		return replicatedKey(key, nil)
+	})
+	epoch := l.epoch
+
+	// Tokens and leases are written far more often than anything else, and
+	// are never replicated, so they are left out
+	l.record("sys/token/id/1234", "logical/1234/foo")
+	l.record("sys/expire/id/secret/foo/1234")
+	l.record("sys/policy/default")
+
+	reply := l.since(epoch, 0)
+	if reply.Index != 2 || !reflect.DeepEqual(reply.Keys, []string{"logical/1234/foo", "sys/policy/default"}) {
+		t.Fatalf("bad: %#v", reply)
+	}
+}
+
+func TestMerkleTree(t *testing.T) {
+	a := newMerkleTree()
+	b := newMerkleTree()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("logical/1234/key%d", i)
+		a.add(key, []byte("value"))
+		b.add(key, []byte("value"))
+	}
+	if !bytes.Equal(merkleRoot(a.pageHashes()), merkleRoot(b.pageHashes())) {
+		t.Fatal("expected equal roots")
+	}
+
+	// Only the page holding a changed key differs
+	b.add("logical/1234/key5", []byte("other"))
+	if bytes.Equal(merkleRoot(a.pageHashes()), merkleRoot(b.pageHashes())) {
+		t.Fatal("expected different roots")
+	}
+	changed := merklePage("logical/1234/key5")
+	for i := uint32(0); i < replicationMerklePages; i++ {
+		equal := bytes.Equal(a.pageHash(i), b.pageHash(i))
+		if equal == (i == changed) {
+			t.Fatalf("page %d: unexpected hash", i)
+		}
+	}
+	if bytes.Equal(a.hash("logical/1234/key5"), b.hash("logical/1234/key5")) {
+		t.Fatal("expected different key hashes")
+	}
+}
+
+func TestReplicationActivationToken(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.clusterAddr = "https://127.0.0.1:8201"
+
+	config, err := newPrimaryReplicationConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.replicationConfig = config
+
+	raw, err := c.replicationSecondaryToken("sec1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.replicationSecondaryToken("sec1", time.Minute); err == nil {
+		t.Fatal("expected error issuing a second token for the same secondary")
+	}
+
+	token, err := parseReplicationActivationToken(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID != "sec1" || token.PrimaryClusterAddr != c.clusterAddr {
+		t.Fatalf("bad: %#v", token)
+	}
+
+	// The token has everything a secondary needs to connect
+	tlsConfig, err := c.replicationClientTLSConfig(&replicationConfig{
+		PrimaryCACert: token.CACert,
+		ClientCert:    token.ClientCert,
+		ClientKey:     token.ClientKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsConfig.Certificates) != 1 || tlsConfig.Certificates[0].Leaf.Subject.CommonName != "sec1" {
+		t.Fatalf("bad: %#v", tlsConfig.Certificates)
+	}
+
+	if _, err := parseReplicationActivationToken("foo"); err == nil {
+		t.Fatal("expected error parsing an invalid token")
+	}
+}
+
+func TestCore_Replication(t *testing.T) {
+	oldStreamInterval := replicationStreamInterval
+	oldRetryInterval := replicationRetryInterval
+	replicationStreamInterval = 50 * time.Millisecond
+	replicationRetryInterval = 100 * time.Millisecond
+	defer func() {
+		replicationStreamInterval = oldStreamInterval
+		replicationRetryInterval = oldRetryInterval
+	}()
+
+	coreConfig := &CoreConfig{
+		CredentialBackends: map[string]logical.Factory{
+			"userpass": credUserpass.Factory,
+		},
+	}
+
+	primaryCluster := NewTestCluster(t, coreConfig, nil)
+	primaryCluster.Start()
+	defer primaryCluster.Cleanup()
+	primary := primaryCluster.Cores[0].Core
+	primaryRoot := primaryCluster.RootToken
+	TestWaitActive(t, primary)
+
+	secondaryCluster := NewTestCluster(t, coreConfig, nil)
+	secondaryCluster.Start()
+	defer secondaryCluster.Cleanup()
+	secondary := secondaryCluster.Cores[0].Core
+	secondaryRoot := secondaryCluster.RootToken
+	TestWaitActive(t, secondary)
+
+	handle := func(c *Core, token string, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, op, path)
+		req.ClientToken = token
+		if data != nil {
+			req.Data = data
+		}
+		return c.HandleRequest(req)
+	}
+	mustHandle := func(c *Core, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := handle(c, token, op, path, data)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return resp
+	}
+	waitForState := func(c *Core, state consts.ReplicationState) {
+		waitFor(t, func() error {
+			if !c.ReplicationState().HasState(state) {
+				return fmt.Errorf("expected %s, got %s", state, c.ReplicationState())
+			}
+			return nil
+		})
+	}
+
+	// Local mounts stay on the primary
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "sys/mounts/local", map[string]interface{}{
+		"type":  "kv",
+		"local": true,
+	})
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "local/foo", map[string]interface{}{"value": "bar"})
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "secret/foo", map[string]interface{}{"value": "bar"})
+
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "sys/replication/primary/enable", nil)
+	waitForState(primary, consts.ReplicationPerformancePrimary)
+
+	// The activation token is only handed out response-wrapped
+	resp := mustHandle(primary, primaryRoot, logical.UpdateOperation, "sys/replication/primary/secondary-token", map[string]interface{}{"id": "sec1"})
+	if resp.WrapInfo == nil || resp.WrapInfo.Token == "" || resp.Data != nil {
+		t.Fatalf("expected a wrapped response, got %#v", resp)
+	}
+	resp = mustHandle(primary, resp.WrapInfo.Token, logical.UpdateOperation, "sys/wrapping/unwrap", nil)
+	var unwrapped struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &unwrapped); err != nil {
+		t.Fatal(err)
+	}
+	token := unwrapped.Data["token"].(string)
+
+	mustHandle(secondary, secondaryRoot, logical.UpdateOperation, "sys/replication/secondary/enable", map[string]interface{}{"token": token})
+	waitForState(secondary, consts.ReplicationPerformanceSecondary)
+
+	// Data written before the secondary was enabled is reindexed, and later
+	// writes are streamed
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(secondary, secondaryRoot, "secret/foo", "bar")
+	})
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "secret/foo", map[string]interface{}{"value": "baz"})
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(secondary, secondaryRoot, "secret/foo", "baz")
+	})
+
+	resp = mustHandle(secondary, secondaryRoot, logical.ReadOperation, "sys/mounts", nil)
+	if _, ok := resp.Data["local/"]; ok {
+		t.Fatal("local mount was replicated")
+	}
+
+	resp = mustHandle(primary, primaryRoot, logical.ReadOperation, "sys/replication/status", nil)
+	if resp.Data["mode"] != "perf-primary" || len(resp.Data["known_secondaries"].([]string)) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = mustHandle(secondary, secondaryRoot, logical.ReadOperation, "sys/replication/status", nil)
+	if resp.Data["mode"] != "perf-secondary" || resp.Data["secondary_id"] != "sec1" || resp.Data["state"] != replicationStateStreamWALs {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// New mounts show up on the secondary
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "sys/mounts/other", map[string]interface{}{"type": "kv"})
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "other/foo", map[string]interface{}{"value": "bar"})
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(secondary, secondaryRoot, "other/foo", "bar")
+	})
+
+	// Logins through replicated auth methods work on the secondary, with the
+	// writes to the identity store forwarded to the primary
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "sys/auth/userpass", map[string]interface{}{"type": "userpass"})
+	mustHandle(primary, primaryRoot, logical.UpdateOperation, "auth/userpass/users/test", map[string]interface{}{"password": "foo"})
+	var login *logical.Response
+	waitFor(t, func() error {
+		resp, err := handle(secondary, "", logical.UpdateOperation, "auth/userpass/login/test", map[string]interface{}{"password": "foo"})
+		if err != nil {
+			return err
+		}
+		if resp.IsError() {
+			return resp.Error()
+		}
+		login = resp
+		return nil
+	})
+	if login == nil || login.Auth == nil || login.Auth.ClientToken == "" || login.Auth.EntityID == "" {
+		t.Fatalf("bad: %#v", login)
+	}
+	resp = mustHandle(secondary, login.Auth.ClientToken, logical.ReadOperation, "auth/token/lookup-self", nil)
+	if resp.Data["display_name"] != "userpass-test" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = mustHandle(primary, primaryRoot, logical.ReadOperation, "identity/entity/id/"+login.Auth.EntityID, nil)
+	if resp == nil || resp.Data["id"] != login.Auth.EntityID {
+		t.Fatalf("entity was not forwarded to the primary: %#v", resp)
+	}
+
+	// Replicated data cannot be written on the secondary, but local mounts
+	// can be used
+	if _, err := handle(secondary, secondaryRoot, logical.UpdateOperation, "secret/foo", map[string]interface{}{"value": "qux"}); err == nil {
+		t.Fatal("expected error writing replicated data on the secondary")
+	}
+	for _, path := range []string{"sys/policy/foo", "sys/plugins/catalog/foo"} {
+		_, err := handle(secondary, secondaryRoot, logical.UpdateOperation, path, map[string]interface{}{
+			"rules":   `path "secret/*" { capabilities = ["read"] }`,
+			"sha_256": "d130b9a0fbfddef9709d8ff92e5e6053ccd246b78632fc03b8548457026961e9",
+			"command": "foo",
+		})
+		if err == nil || !strings.Contains(err.Error(), logical.ErrReadOnly.Error()) {
+			t.Fatalf("%s: expected read-only error, got %v", path, err)
+		}
+	}
+	mustHandle(secondary, secondaryRoot, logical.UpdateOperation, "sys/mounts/seclocal", map[string]interface{}{
+		"type":  "kv",
+		"local": true,
+	})
+	mustHandle(secondary, secondaryRoot, logical.UpdateOperation, "seclocal/foo", map[string]interface{}{"value": "bar"})
+	if err := checkPerfStandbyRead(secondary, secondaryRoot, "seclocal/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustHandle(primary, primaryRoot, logical.DeleteOperation, "secret/foo", nil)
+	waitFor(t, func() error {
+		return checkPerfStandbyRead(secondary, secondaryRoot, "secret/foo", "")
+	})
+
+	// A promoted secondary accepts writes, and keeps its local mounts
+	mustHandle(secondary, secondaryRoot, logical.UpdateOperation, "sys/replication/secondary/promote", nil)
+	waitForState(secondary, consts.ReplicationPerformancePrimary)
+	waitFor(t, func() error {
+		_, err := handle(secondary, secondaryRoot, logical.UpdateOperation, "secret/foo", map[string]interface{}{"value": "qux"})
+		return err
+	})
+	if err := checkPerfStandbyRead(secondary, secondaryRoot, "other/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPerfStandbyRead(secondary, secondaryRoot, "seclocal/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -46,7 +46,7 @@ func (c *Core) startForwarding() error {
 	}
 
 	// The server supports all of the possible protos
-	tlsConfig.NextProtos = []string{"h2", requestForwardingALPN}
+	tlsConfig.NextProtos = []string{"h2", requestForwardingALPN, replicationALPN}
 
 	// Create our RPC server and register the request handler server
 	c.clusterParamsLock.Lock()
@@ -68,6 +68,17 @@ func (c *Core) startForwarding() error {
 			handler: c.clusterHandler,
 		})
 	}
+
+	// Secondaries are served by their own RPC server, as they connect with
+	// different credentials
+	c.replicationRPCServer = grpc.NewServer(
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time: 2 * heartbeatInterval,
+		}),
+	)
+	RegisterReplicationServer(c.replicationRPCServer, &replicationRPCServer{
+		core: c,
+	})
 	c.clusterParamsLock.Unlock()
 
 	// Create the HTTP/2 server that will be shared by both RPC and regular
@@ -156,6 +167,21 @@ func (c *Core) startForwarding() error {
 						Handler: c.rpcServer,
 					})
 
+				case replicationALPN:
+					c.logger.Trace("core: got replication connection")
+
+					// Secondaries speak HTTP/2 without TLS on top of the
+					// connection, so the TLS state needed to identify them
+					// is added to each request
+					state := tlsConn.ConnectionState()
+					server := c.replicationRPCServer
+					go fws.ServeConn(conn, &http2.ServeConnOpts{
+						Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							r.TLS = &state
+							server.ServeHTTP(w, r)
+						}),
+					})
+
 				default:
 					c.logger.Debug("core: unknown negotiated protocol on cluster port")
 					conn.Close()
@@ -180,6 +206,8 @@ func (c *Core) startForwarding() error {
 		c.clusterParamsLock.Lock()
 		c.rpcServer.Stop()
 		c.rpcServer = nil
+		c.replicationRPCServer.Stop()
+		c.replicationRPCServer = nil
 		c.clusterParamsLock.Unlock()
 		c.logger.Info("core: forwarding rpc listeners stopped")
 
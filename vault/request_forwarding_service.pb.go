@@ -6,10 +6,20 @@ Package vault is a generated protocol buffer package.
 
 It is generated from these files:
 	request_forwarding_service.proto
+	replication_service.proto
 
 It has these top-level messages:
 	EchoRequest
 	EchoReply
+	PerfStandbyInvalidationsRequest
+	PerfStandbyInvalidationsReply
+	ReplicationStreamRequest
+	ReplicationEntry
+	ReplicationBatch
+	MerkleRequest
+	MerkleKey
+	MerkleReply
+	FetchEntriesRequest
 */
 package vault
 
@@ -82,9 +92,79 @@ func (m *EchoReply) GetClusterAddrs() []string {
 	return nil
 }
 
+type PerfStandbyInvalidationsRequest struct {
+	Epoch string `protobuf:"bytes,1,opt,name=epoch" json:"epoch,omitempty"`
+	Index uint64 `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+}
+
+func (m *PerfStandbyInvalidationsRequest) Reset()         { *m = PerfStandbyInvalidationsRequest{} }
+func (m *PerfStandbyInvalidationsRequest) String() string { return proto.CompactTextString(m) }
+func (*PerfStandbyInvalidationsRequest) ProtoMessage()    {}
+func (*PerfStandbyInvalidationsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{2}
+}
+
+func (m *PerfStandbyInvalidationsRequest) GetEpoch() string {
+	if m != nil {
+		return m.Epoch
+	}
+	return ""
+}
+
+func (m *PerfStandbyInvalidationsRequest) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+type PerfStandbyInvalidationsReply struct {
+	Epoch     string   `protobuf:"bytes,1,opt,name=epoch" json:"epoch,omitempty"`
+	Index     uint64   `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Keys      []string `protobuf:"bytes,3,rep,name=keys" json:"keys,omitempty"`
+	Truncated bool     `protobuf:"varint,4,opt,name=truncated" json:"truncated,omitempty"`
+}
+
+func (m *PerfStandbyInvalidationsReply) Reset()         { *m = PerfStandbyInvalidationsReply{} }
+func (m *PerfStandbyInvalidationsReply) String() string { return proto.CompactTextString(m) }
+func (*PerfStandbyInvalidationsReply) ProtoMessage()    {}
+func (*PerfStandbyInvalidationsReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{3}
+}
+
+func (m *PerfStandbyInvalidationsReply) GetEpoch() string {
+	if m != nil {
+		return m.Epoch
+	}
+	return ""
+}
+
+func (m *PerfStandbyInvalidationsReply) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *PerfStandbyInvalidationsReply) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+func (m *PerfStandbyInvalidationsReply) GetTruncated() bool {
+	if m != nil {
+		return m.Truncated
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*EchoRequest)(nil), "vault.EchoRequest")
 	proto.RegisterType((*EchoReply)(nil), "vault.EchoReply")
+	proto.RegisterType((*PerfStandbyInvalidationsRequest)(nil), "vault.PerfStandbyInvalidationsRequest")
+	proto.RegisterType((*PerfStandbyInvalidationsReply)(nil), "vault.PerfStandbyInvalidationsReply")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -100,6 +180,7 @@ const _ = grpc.SupportPackageIsVersion4
 type RequestForwardingClient interface {
 	ForwardRequest(ctx context.Context, in *forwarding.Request, opts ...grpc.CallOption) (*forwarding.Response, error)
 	Echo(ctx context.Context, in *EchoRequest, opts ...grpc.CallOption) (*EchoReply, error)
+	PerfStandbyInvalidations(ctx context.Context, in *PerfStandbyInvalidationsRequest, opts ...grpc.CallOption) (*PerfStandbyInvalidationsReply, error)
 }
 
 type requestForwardingClient struct {
@@ -128,11 +209,21 @@ func (c *requestForwardingClient) Echo(ctx context.Context, in *EchoRequest, opt
 	return out, nil
 }
 
+func (c *requestForwardingClient) PerfStandbyInvalidations(ctx context.Context, in *PerfStandbyInvalidationsRequest, opts ...grpc.CallOption) (*PerfStandbyInvalidationsReply, error) {
+	out := new(PerfStandbyInvalidationsReply)
+	err := grpc.Invoke(ctx, "/vault.RequestForwarding/PerfStandbyInvalidations", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for RequestForwarding service
 
 type RequestForwardingServer interface {
 	ForwardRequest(context.Context, *forwarding.Request) (*forwarding.Response, error)
 	Echo(context.Context, *EchoRequest) (*EchoReply, error)
+	PerfStandbyInvalidations(context.Context, *PerfStandbyInvalidationsRequest) (*PerfStandbyInvalidationsReply, error)
 }
 
 func RegisterRequestForwardingServer(s *grpc.Server, srv RequestForwardingServer) {
@@ -175,6 +266,24 @@ func _RequestForwarding_Echo_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RequestForwarding_PerfStandbyInvalidations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PerfStandbyInvalidationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RequestForwardingServer).PerfStandbyInvalidations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/vault.RequestForwarding/PerfStandbyInvalidations",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RequestForwardingServer).PerfStandbyInvalidations(ctx, req.(*PerfStandbyInvalidationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _RequestForwarding_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "vault.RequestForwarding",
 	HandlerType: (*RequestForwardingServer)(nil),
@@ -187,6 +296,10 @@ var _RequestForwarding_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Echo",
 			Handler:    _RequestForwarding_Echo_Handler,
 		},
+		{
+			MethodName: "PerfStandbyInvalidations",
+			Handler:    _RequestForwarding_PerfStandbyInvalidations_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "request_forwarding_service.proto",
@@ -195,21 +308,28 @@ var _RequestForwarding_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("request_forwarding_service.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 254 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x90, 0x3d, 0x4f, 0xc3, 0x30,
-	0x10, 0x86, 0xdb, 0xf2, 0xa5, 0xb8, 0x05, 0x81, 0x61, 0x88, 0x32, 0x85, 0xb0, 0x74, 0x72, 0x24,
-	0x58, 0x58, 0x18, 0x18, 0x60, 0xe8, 0x98, 0x3f, 0x10, 0xb9, 0xf6, 0x11, 0x47, 0x72, 0x6b, 0x73,
-	0xe7, 0x14, 0x65, 0xe5, 0x97, 0x23, 0x92, 0x94, 0xa6, 0x0b, 0xe3, 0xbd, 0x27, 0x3d, 0xf7, 0xdc,
-	0xcb, 0x52, 0x84, 0xcf, 0x06, 0x28, 0x94, 0x1f, 0x0e, 0xbf, 0x24, 0xea, 0x7a, 0x5b, 0x95, 0x04,
-	0xb8, 0xab, 0x15, 0x08, 0x8f, 0x2e, 0x38, 0x7e, 0xb6, 0x93, 0x8d, 0x0d, 0xc9, 0x73, 0x55, 0x07,
-	0xd3, 0xac, 0x85, 0x72, 0x9b, 0xdc, 0x48, 0x32, 0xb5, 0x72, 0xe8, 0xf3, 0x6e, 0x97, 0x1b, 0xb0,
-	0x1e, 0x30, 0x3f, 0x20, 0xf2, 0xd0, 0x7a, 0xa0, 0x1e, 0x90, 0xad, 0xd8, 0xfc, 0x4d, 0x19, 0x57,
-	0xf4, 0x87, 0x78, 0xcc, 0x2e, 0x36, 0x40, 0x24, 0x2b, 0x88, 0xa7, 0xe9, 0x74, 0x19, 0x15, 0xfb,
-	0x91, 0xdf, 0xb3, 0x85, 0xb2, 0x0d, 0x05, 0xc0, 0x52, 0x6a, 0x8d, 0xf1, 0xac, 0x5b, 0xcf, 0x87,
-	0xec, 0x55, 0x6b, 0xcc, 0x56, 0x2c, 0xea, 0x59, 0xde, 0xb6, 0xff, 0x90, 0x1e, 0xd8, 0xe5, 0x98,
-	0x44, 0xf1, 0x2c, 0x3d, 0x59, 0x46, 0xc5, 0x62, 0x84, 0xa2, 0xc7, 0xef, 0x29, 0xbb, 0x19, 0xa4,
-	0xde, 0xff, 0xcc, 0xf9, 0x0b, 0xbb, 0x1a, 0xa6, 0xbd, 0xf0, 0xad, 0x38, 0x3c, 0x26, 0x86, 0x30,
-	0xb9, 0x3b, 0x0e, 0xc9, 0xbb, 0x2d, 0x41, 0x36, 0xe1, 0x82, 0x9d, 0xfe, 0x0a, 0x72, 0x2e, 0xba,
-	0x6a, 0xc4, 0xe8, 0xf3, 0xe4, 0xfa, 0x28, 0xf3, 0xb6, 0xcd, 0x26, 0xeb, 0xf3, 0xae, 0xa3, 0xa7,
-	0x9f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x6a, 0x13, 0x7f, 0xc2, 0x88, 0x01, 0x00, 0x00,
+	// 362 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x92, 0x41, 0x4f, 0xe3, 0x30,
+	0x10, 0x85, 0x9b, 0x36, 0xdd, 0xdd, 0x4c, 0xbb, 0xab, 0x5d, 0x6f, 0x0f, 0x51, 0xb4, 0x2b, 0x42,
+	0x40, 0xa8, 0xa7, 0x44, 0x82, 0x0b, 0x17, 0x0e, 0x1c, 0x40, 0xa2, 0x12, 0x12, 0x0a, 0x3f, 0xa0,
+	0x72, 0xe3, 0x69, 0x13, 0x48, 0x63, 0x63, 0x3b, 0x85, 0x1c, 0xf8, 0xcb, 0xfc, 0x06, 0x54, 0x27,
+	0xa5, 0xed, 0xa1, 0x54, 0xdc, 0xf2, 0x9e, 0xad, 0x6f, 0x5e, 0xe6, 0x19, 0x7c, 0x89, 0x4f, 0x25,
+	0x2a, 0x3d, 0x9e, 0x72, 0xf9, 0x4c, 0x25, 0xcb, 0x8a, 0xd9, 0x58, 0xa1, 0x5c, 0x64, 0x09, 0x86,
+	0x42, 0x72, 0xcd, 0x49, 0x77, 0x41, 0xcb, 0x5c, 0x7b, 0xe7, 0xb3, 0x4c, 0xa7, 0xe5, 0x24, 0x4c,
+	0xf8, 0x3c, 0x4a, 0xa9, 0x4a, 0xb3, 0x84, 0x4b, 0x11, 0x99, 0xb3, 0x28, 0xc5, 0x5c, 0xa0, 0x8c,
+	0xd6, 0x88, 0x48, 0x57, 0x02, 0x55, 0x0d, 0x08, 0x46, 0xd0, 0xbb, 0x4a, 0x52, 0x1e, 0xd7, 0x83,
+	0x88, 0x0b, 0xdf, 0xe7, 0xa8, 0x14, 0x9d, 0xa1, 0x6b, 0xf9, 0xd6, 0xd0, 0x89, 0x57, 0x92, 0x1c,
+	0x42, 0x3f, 0xc9, 0x4b, 0xa5, 0x51, 0x8e, 0x29, 0x63, 0xd2, 0x6d, 0x9b, 0xe3, 0x5e, 0xe3, 0x5d,
+	0x32, 0x26, 0x83, 0x11, 0x38, 0x35, 0x4b, 0xe4, 0xd5, 0x27, 0xa4, 0x23, 0xf8, 0xb9, 0x49, 0x52,
+	0x6e, 0xdb, 0xef, 0x0c, 0x9d, 0xb8, 0xbf, 0x81, 0x52, 0xc1, 0x2d, 0x1c, 0xdc, 0xa1, 0x9c, 0xde,
+	0x6b, 0x5a, 0xb0, 0x49, 0x75, 0x53, 0x2c, 0x68, 0x9e, 0x31, 0xaa, 0x33, 0x5e, 0xa8, 0x55, 0xd6,
+	0x01, 0x74, 0x51, 0xf0, 0x24, 0x6d, 0xf8, 0xb5, 0x58, 0xba, 0x59, 0xc1, 0xf0, 0xc5, 0x04, 0xb4,
+	0xe3, 0x5a, 0x04, 0xaf, 0xf0, 0x7f, 0x37, 0x6e, 0x19, 0xf7, 0x0b, 0x30, 0x42, 0xc0, 0x7e, 0xc4,
+	0x4a, 0xb9, 0x1d, 0x93, 0xdb, 0x7c, 0x93, 0x7f, 0xe0, 0x68, 0x59, 0x16, 0x09, 0xd5, 0xc8, 0x5c,
+	0xdb, 0xb7, 0x86, 0x3f, 0xe2, 0xb5, 0x71, 0xfa, 0x66, 0xc1, 0x9f, 0x26, 0xf6, 0xf5, 0x47, 0x0f,
+	0xe4, 0x02, 0x7e, 0x35, 0x6a, 0xf5, 0x4b, 0x7f, 0xc3, 0x75, 0x4d, 0x61, 0x63, 0x7a, 0x83, 0x6d,
+	0x53, 0x09, 0x5e, 0x28, 0x0c, 0x5a, 0x24, 0x04, 0x7b, 0xb9, 0x6e, 0x42, 0x42, 0x53, 0x74, 0xb8,
+	0xd1, 0xa3, 0xf7, 0x7b, 0xcb, 0x13, 0x79, 0x15, 0xb4, 0xc8, 0x03, 0xb8, 0xbb, 0x76, 0x40, 0x4e,
+	0x9a, 0xfb, 0x7b, 0x76, 0xee, 0x1d, 0xef, 0xbd, 0x67, 0x66, 0x4d, 0xbe, 0x99, 0xd7, 0x75, 0xf6,
+	0x3e, 0x00, 0x4a, 0xb5, 0x6d, 0x05, 0xc2, 0x02, 0x00, 0x00,
 }
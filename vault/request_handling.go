@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/identity"
@@ -23,9 +24,22 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	if c.sealed {
 		return nil, consts.ErrSealed
 	}
-	if c.standby {
+	if c.standby && !c.perfStandby {
 		return nil, consts.ErrStandby
 	}
+	if c.perfStandby && !c.perfStandbyLocal(req) {
+		return nil, ErrPerfStandbyForward
+	}
+
+	if req.StartTime.IsZero() {
+		req.StartTime = time.Now()
+	}
+
+	// Whether a performance standby forwards the request may only be known
+	// once it is handled, so its request entries are held until then
+	if c.perfStandby {
+		holdAudit(req)
+	}
 
 	// Allowing writing to a path ending in / makes it extremely difficult to
 	// understand user intent for the filesystem-like backends (kv,
@@ -46,6 +60,12 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		resp, auth, err = c.handleRequest(req)
 	}
 
+	// Anything that turned out to need a write is handled again by the
+	// active node, which audits it
+	if c.perfStandby && perfStandbyForward(resp, err) {
+		return nil, ErrPerfStandbyForward
+	}
+
 	// Ensure we don't leak internal data
 	if resp != nil {
 		if resp.Secret != nil {
@@ -59,13 +79,24 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	// We are wrapping if there is anything to wrap (not a nil response) and a
 	// TTL was specified for the token. Errors on a call should be returned to
 	// the caller, so wrapping is turned off if an error is hit and the error
-	// is logged to the audit log.
+	// is logged to the audit log. Responses held by a control group have
+	// already been wrapped.
 	wrapping := resp != nil &&
 		err == nil &&
 		!resp.IsError() &&
 		resp.WrapInfo != nil &&
-		resp.WrapInfo.TTL != 0
+		resp.WrapInfo.TTL != 0 &&
+		resp.WrapInfo.Token == ""
 
+	if wrapping && c.perfStandby {
+		return nil, ErrPerfStandbyForward
+	}
+
+	// The request is not forwarded, so audit it now
+	if err := c.flushHeldAudit(req); err != nil {
+		c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
+		return nil, ErrInternalError
+	}
 	if wrapping {
 		cubbyResp, cubbyErr := c.wrapInCubbyhole(req, resp, auth)
 		// If not successful, returns either an error response from the
@@ -116,8 +147,34 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, retAuth *logical.Auth, retErr error) {
 	defer metrics.MeasureSince([]string{"core", "handle_request"}, time.Now())
 
+	// If a request held by a control group is being unwrapped, look it up
+	// before the token is used so that the wrapping token is never consumed
+	// without the request being processed
+	var cgr *controlGroupRequest
+	var cgWrappingToken string
+	if req.Path == "sys/wrapping/unwrap" {
+		var cgErr error
+		cgr, cgWrappingToken, cgErr = c.controlGroupRequestForUnwrap(req)
+		if cgErr != nil {
+			if err := c.auditRequest(nil, req, cgErr); err != nil {
+				c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
+			}
+			if cgErr == ErrInternalError {
+				return nil, nil, cgErr
+			}
+			return logical.ErrorResponse(cgErr.Error()), nil, logical.ErrPermissionDenied
+		}
+	}
+
 	// Validate the token
-	auth, te, ctErr := c.checkToken(req)
+	auth, te, cg, ctErr := c.checkToken(req)
+	// Using up a limited use token, validating MFA or holding the request for
+	// a control group all need writes, so performance standbys leave them to
+	// the active node
+	if c.perfStandby && (ctErr == ErrPerfStandbyForward || (te != nil && te.NumUses != 0) || cg != nil) {
+		return nil, nil, ErrPerfStandbyForward
+	}
+
 	// We run this logic first because we want to decrement the use count even in the case of an error
 	if te != nil {
 		// Attempt to use the token (decrement NumUses)
@@ -158,14 +215,18 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		// If it is an internal error we return that, otherwise we
 		// return invalid request so that the status codes can be correct
 		var errType error
-		switch ctErr {
-		case ErrInternalError, logical.ErrPermissionDenied:
+		switch {
+		case ctErr == ErrInternalError, ctErr == logical.ErrPermissionDenied:
 			errType = ctErr
+		case errwrap.Contains(ctErr, logical.ErrPermissionDenied.Error()):
+			// Failed MFA validations carry their reason but are still
+			// permission denied
+			errType = logical.ErrPermissionDenied
 		default:
 			errType = logical.ErrInvalidRequest
 		}
 
-		if err := c.auditBroker.LogRequest(auth, req, c.auditedHeaders, ctErr); err != nil {
+		if err := c.auditRequest(auth, req, ctErr); err != nil {
 			c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
 		}
 
@@ -178,16 +239,91 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		return logical.ErrorResponse(ctErr.Error()), auth, retErr
 	}
 
+	// Batch tokens have no storage of their own, so nothing would ever clean
+	// up a cubbyhole written with one
+	if te != nil && te.IsBatch() && strings.HasPrefix(req.Path, "cubbyhole/") {
+		err := fmt.Errorf("batch tokens cannot use the cubbyhole")
+		if auditErr := c.auditRequest(auth, req, err); auditErr != nil {
+			c.logger.Error("core: failed to audit request", "path", req.Path, "error", auditErr)
+		}
+		retErr = multierror.Append(retErr, logical.ErrInvalidRequest)
+		return logical.ErrorResponse(err.Error()), auth, retErr
+	}
+
+	// Secondaries receive their configuration from their primary, which would
+	// overwrite anything written here
+	if c.secondaryReadOnly(req) {
+		err := fmt.Errorf("cannot write replicated configuration on a replication secondary")
+		if auditErr := c.auditRequest(auth, req, err); auditErr != nil {
+			c.logger.Error("core: failed to audit request", "path", req.Path, "error", auditErr)
+		}
+		retErr = multierror.Append(retErr, logical.ErrReadOnly)
+		return logical.ErrorResponse(err.Error()), auth, retErr
+	}
+
 	// Attach the display name
 	req.DisplayName = auth.DisplayName
 
 	// Create an audit trail of the request
-	if err := c.auditBroker.LogRequest(auth, req, c.auditedHeaders, nil); err != nil {
+	if err := c.auditRequest(auth, req, nil); err != nil {
 		c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
 		retErr = multierror.Append(retErr, ErrInternalError)
 		return nil, auth, retErr
 	}
 
+	switch {
+	case cgr != nil:
+		// The control group has been satisfied, so the original request is
+		// processed in place of the unwrap
+		cgReq, err := c.controlGroupReplayRequest(req, te, cgr)
+		if err != nil {
+			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+			return logical.ErrorResponse(err.Error()), auth, retErr
+		}
+
+		// The requester must still be allowed to make the request
+		cgAuth, _, _, err := c.checkToken(cgReq)
+		if auditErr := c.auditRequest(cgAuth, cgReq, err); auditErr != nil {
+			c.logger.Error("core: failed to audit request", "path", cgReq.Path, "error", auditErr)
+			retErr = multierror.Append(retErr, ErrInternalError)
+			return nil, auth, retErr
+		}
+		if err != nil {
+			if err == ErrInternalError {
+				retErr = multierror.Append(retErr, err)
+				return nil, auth, retErr
+			}
+			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+			return logical.ErrorResponse(err.Error()), auth, retErr
+		}
+
+		if err := c.consumeControlGroupRequest(cgr, cgWrappingToken); err != nil {
+			retErr = multierror.Append(retErr, err)
+			return nil, auth, retErr
+		}
+
+		cgReq.DisplayName = cgAuth.DisplayName
+		req = cgReq
+
+	case cg != nil:
+		// Hold the request until the control group has been satisfied
+		resp, err := c.holdForControlGroup(req, te, cg)
+		if err != nil {
+			retErr = multierror.Append(retErr, err)
+		}
+		return resp, auth, retErr
+	}
+
+	// Reserve room for any lease the request creates before the backend is
+	// called, so that concurrent requests can't exceed a lease count quota.
+	// Requests that may create a lease are refused once a quota is full.
+	leaseCount := c.reserveLeaseCount(req)
+	defer leaseCount.release()
+	if err := leaseCount.check(); err != nil {
+		retErr = multierror.Append(retErr, err)
+		return nil, auth, retErr
+	}
+
 	// Route the request
 	resp, routeErr := c.router.Route(req)
 	if resp != nil {
@@ -270,6 +406,16 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		}
 
 		if registerLease {
+			// Leases are only registered by the active node. Reads from
+			// mounts that may return them are forwarded beforehand, so
+			// this only catches backends that return a secret otherwise.
+			if c.perfStandby {
+				if err := c.revokeUnregisteredSecret(req, resp); err != nil {
+					c.logger.Error("core: failed to revoke secret created by performance standby", "request_path", req.Path, "error", err)
+				}
+				return nil, auth, ErrPerfStandbyForward
+			}
+
 			leaseID, err := c.expiration.Register(req, resp)
 			if err != nil {
 				c.logger.Error("core: failed to register lease", "request_path", req.Path, "error", err)
@@ -299,11 +445,15 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			return nil, auth, retErr
 		}
 
-		if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
-			c.tokenStore.Revoke(te.ID)
-			c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
-			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+		// Batch tokens are not persisted and expire on their own, so they
+		// have no lease
+		if te != nil && !te.IsBatch() {
+			if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
+				c.tokenStore.Revoke(te.ID)
+				c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+				return nil, auth, retErr
+			}
 		}
 	}
 
@@ -321,13 +471,23 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 	return resp, auth, retErr
 }
 
+// revokeUnregisteredSecret revokes a secret returned by a backend for which
+// no lease will be registered
+func (c *Core) revokeUnregisteredSecret(req *logical.Request, resp *logical.Response) error {
+	revResp, err := c.router.Route(logical.RevokeRequest(req.Path, resp.Secret, resp.Data))
+	if err == nil && revResp != nil && revResp.IsError() {
+		err = revResp.Error()
+	}
+	return err
+}
+
 // handleLoginRequest is used to handle a login request, which is an
 // unauthenticated request to the backend.
 func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *logical.Auth, error) {
 	defer metrics.MeasureSince([]string{"core", "handle_login_request"}, time.Now())
 
 	// Create an audit trail of the request, auth is not available on login requests
-	if err := c.auditBroker.LogRequest(nil, req, c.auditedHeaders, nil); err != nil {
+	if err := c.auditRequest(nil, req, nil); err != nil {
 		c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
 		return nil, nil, ErrInternalError
 	}
@@ -424,6 +584,18 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			auth.EntityID = entity.ID
 		}
 
+		// Validate any MFA enforced on logins through this auth method
+		if err := c.enforceLoginMFA(req, entity); err != nil {
+			if err == ErrInternalError {
+				return nil, nil, err
+			}
+			if errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+				return logical.ErrorResponse(err.Error()), nil, err
+			}
+			c.logger.Error("core: failed to enforce login MFA", "request_path", req.Path, "error", err)
+			return nil, nil, ErrInternalError
+		}
+
 		if strutil.StrListSubset(auth.Policies, []string{"root"}) {
 			return logical.ErrorResponse("authentication backends cannot create root tokens"), nil, logical.ErrInvalidRequest
 		}
@@ -452,6 +624,23 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			auth.TTL = sysView.MaxLeaseTTL()
 		}
 
+		// Determine the type of token the backend asked for; backends that
+		// don't set one get service tokens
+		tokenType, err := auth.TokenType.Resolve(logical.TokenTypeDefault)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil, logical.ErrInvalidRequest
+		}
+
+		// Batch tokens have no lease, so they are not subject to lease count
+		// quotas
+		if tokenType != logical.TokenTypeBatch {
+			leaseCount := c.reserveLeaseCountPath(req.Path)
+			defer leaseCount.release()
+			if err := leaseCount.check(); err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// Generate a token
 		te := TokenEntry{
 			Path:         req.Path,
@@ -462,6 +651,9 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			TTL:          auth.TTL,
 			NumUses:      auth.NumUses,
 		}
+		if tokenType == logical.TokenTypeBatch {
+			te.Type = logical.TokenTypeBatch
+		}
 
 		te.Policies = policyutil.SanitizePolicies(te.Policies, true)
 
@@ -472,6 +664,15 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			}
 		}
 
+		if te.IsBatch() {
+			// Batch tokens cannot be renewed and carry no usage limit or
+			// period
+			if auth.NumUses != 0 || auth.Period != 0 {
+				return logical.ErrorResponse("batch tokens cannot have a use limit or a period"), nil, logical.ErrInvalidRequest
+			}
+			auth.Renewable = false
+		}
+
 		if err := c.tokenStore.create(&te); err != nil {
 			c.logger.Error("core: failed to create token", "error", err)
 			return nil, auth, ErrInternalError
@@ -481,12 +682,16 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 		auth.ClientToken = te.ID
 		auth.Accessor = te.Accessor
 		auth.Policies = te.Policies
-
-		// Register with the expiration manager
-		if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
-			c.tokenStore.Revoke(te.ID)
-			c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
-			return nil, auth, ErrInternalError
+		auth.TokenType = tokenType
+
+		// Register with the expiration manager. Batch tokens are not
+		// persisted and expire on their own, so they have no lease.
+		if !te.IsBatch() {
+			if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
+				c.tokenStore.Revoke(te.ID)
+				c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
+				return nil, auth, ErrInternalError
+			}
 		}
 
 		// Attach the display name, might be used by audit backends
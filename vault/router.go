@@ -352,8 +352,9 @@ func (r *Router) routeCommon(req *logical.Request, existenceCheck bool) (*logica
 		req.Path = ""
 	}
 
-	// Attach the storage view for the request
-	req.Storage = re.storageView
+	// Attach the storage view for the request, bound to its context so
+	// that storage calls are cancelled along with the request
+	req.Storage = re.storageView.WithContext(req.Context())
 
 	originalEntityID := req.EntityID
 
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"reflect"
@@ -164,6 +165,43 @@ func TestRouter_Mount(t *testing.T) {
 	}
 }
 
+func TestRouter_RequestContext(t *testing.T) {
+	r := NewRouter()
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &NoopBackend{}
+	if err := r.Mount(n, "prod/aws/", &MountEntry{Path: "prod/aws/", UUID: meUUID, Accessor: "awsaccessor"}, view); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := &logical.Request{
+		Path: "prod/aws/foo",
+	}
+	req.SetContext(ctx)
+	if _, err := r.Route(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The storage of the request is bound to its context
+	storage, ok := n.Requests[0].Storage.(*BarrierView)
+	if !ok {
+		t.Fatalf("bad: %#v", n.Requests[0].Storage)
+	}
+	if storage.Context() != ctx {
+		t.Fatalf("storage not bound to the request context")
+	}
+	if view.Context() != context.Background() {
+		t.Fatalf("mount view should not be bound")
+	}
+}
+
 func TestRouter_MountCredential(t *testing.T) {
 	r := NewRouter()
 	_, barrier, _ := mockBarrier(t)
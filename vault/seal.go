@@ -2,6 +2,7 @@ package vault
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -115,7 +116,7 @@ func (d *DefaultSeal) BarrierConfig() (*SealConfig, error) {
 	}
 
 	// Fetch the core configuration
-	pe, err := d.core.physical.Get(barrierSealConfigPath)
+	pe, err := d.core.physical.Get(context.Background(), barrierSealConfigPath)
 	if err != nil {
 		d.core.logger.Error("core: failed to read seal configuration", "error", err)
 		return nil, fmt.Errorf("failed to check seal configuration: %v", err)
@@ -181,7 +182,7 @@ func (d *DefaultSeal) SetBarrierConfig(config *SealConfig) error {
 		Value: buf,
 	}
 
-	if err := d.core.physical.Put(pe); err != nil {
+	if err := d.core.physical.Put(context.Background(), pe); err != nil {
 		d.core.logger.Error("core: failed to write seal configuration", "error", err)
 		return fmt.Errorf("failed to write seal configuration: %v", err)
 	}
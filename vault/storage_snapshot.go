@@ -0,0 +1,545 @@
+package vault
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// snapshotVersion is the version of the snapshot archive format
+	snapshotVersion = 1
+
+	// The files making up a snapshot archive
+	snapshotMetaFile  = "meta.json"
+	snapshotStateFile = "state.bin"
+	snapshotSumsFile  = "SHA256SUMS"
+
+	// snapshotListPageSize is the number of keys listed at once when
+	// walking the physical backend
+	snapshotListPageSize = 1000
+
+	// snapshotRestoreAttempts is the number of times restoring the entries
+	// of a snapshot is attempted before giving up, waiting a multiple of
+	// snapshotRestoreRetryInterval in between
+	snapshotRestoreAttempts      = 3
+	snapshotRestoreRetryInterval = time.Second
+)
+
+// snapshotMeta describes the contents of a snapshot
+type snapshotMeta struct {
+	Version     int       `json:"version"`
+	CreatedTime time.Time `json:"created_time"`
+	Entries     int       `json:"entries"`
+}
+
+// snapshotEntry is a single physical entry in a snapshot. Values are stored
+// as found in the physical backend, so they remain encrypted by the barrier.
+type snapshotEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// snapshotSkippedKey returns whether the given physical key is left out of
+// snapshots, and left alone on restore. These keys coordinate the HA nodes of
+// the running cluster.
+func snapshotSkippedKey(key string) bool {
+	return key == coreLockPath || strings.HasPrefix(key, coreLeaderPrefix)
+}
+
+// SaveSnapshot writes a snapshot of all entries in the physical backend to
+// the given writer. The snapshot is taken while writes through the barrier
+// are blocked, so it is consistent. Root or sudo privileges are required.
+func (c *Core) SaveSnapshot(req *logical.Request, w io.Writer) error {
+	defer metrics.MeasureSince([]string{"core", "snapshot", "save"}, time.Now())
+
+	state, err := ioutil.TempFile("", "vault-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(state.Name())
+	defer state.Close()
+
+	meta, stateSum, err := c.writeSnapshotState(req, state)
+	if err != nil {
+		return err
+	}
+	if _, err := state.Seek(0, 0); err != nil {
+		return err
+	}
+	return writeSnapshotArchive(w, meta, state, stateSum)
+}
+
+func (c *Core) writeSnapshotState(req *logical.Request, state io.Writer) (*snapshotMeta, []byte, error) {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed {
+		return nil, nil, consts.ErrSealed
+	}
+	if c.standby {
+		return nil, nil, consts.ErrStandby
+	}
+	if err := c.checkSnapshotRequest(req); err != nil {
+		return nil, nil, err
+	}
+
+	meta := &snapshotMeta{
+		Version:     snapshotVersion,
+		CreatedTime: time.Now().UTC(),
+	}
+	sum := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(state, sum))
+	enc := json.NewEncoder(buf)
+
+	ctx := req.Context()
+	err := c.barrier.Snapshot(func(backend physical.Backend) error {
+		return walkPhysical(ctx, backend, "", func(key string) error {
+			if snapshotSkippedKey(key) {
+				return nil
+			}
+			entry, err := backend.Get(ctx, key)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				return nil
+			}
+			meta.Entries++
+			return enc.Encode(&snapshotEntry{
+				Key:   entry.Key,
+				Value: entry.Value,
+			})
+		})
+	})
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to read storage: {{err}}", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, nil, err
+	}
+
+	c.logger.Info("core: storage snapshot saved", "entries", meta.Entries)
+	return meta, sum.Sum(nil), nil
+}
+
+// writeSnapshotArchive writes the snapshot archive, a gzipped tarball holding
+// the metadata, the entries and the checksums of both
+func writeSnapshotArchive(w io.Writer, meta *snapshotMeta, state *os.File, stateSum []byte) error {
+	metaRaw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	metaSum := sha256.Sum256(metaRaw)
+	stateInfo, err := state.Stat()
+	if err != nil {
+		return err
+	}
+
+	var sums bytes.Buffer
+	fmt.Fprintf(&sums, "%x  %s\n", metaSum, snapshotMetaFile)
+	fmt.Fprintf(&sums, "%x  %s\n", stateSum, snapshotStateFile)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeFile := func(name string, size int64, r io.Reader) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    size,
+			ModTime: meta.CreatedTime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, r)
+		return err
+	}
+
+	if err := writeFile(snapshotMetaFile, int64(len(metaRaw)), bytes.NewReader(metaRaw)); err != nil {
+		return err
+	}
+	if err := writeFile(snapshotStateFile, stateInfo.Size(), state); err != nil {
+		return err
+	}
+	if err := writeFile(snapshotSumsFile, int64(sums.Len()), &sums); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// RestoreSnapshot replaces all entries in the physical backend with the ones
+// in the given snapshot. Requests are blocked and the HA lock is kept until
+// the restore is done. Snapshots taken with a different keyring are only
+// restored if forced, after which Vault is sealed and has to be unsealed with
+// the keys of the cluster the snapshot was taken on. Root or sudo privileges
+// are required.
+func (c *Core) RestoreSnapshot(req *logical.Request, r io.Reader, force bool) error {
+	defer metrics.MeasureSince([]string{"core", "snapshot", "restore"}, time.Now())
+
+	// Check the request before reading what may be a large body
+	c.stateLock.RLock()
+	err := c.checkRestoreAllowed(req)
+	c.stateLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	state, err := ioutil.TempFile("", "vault-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(state.Name())
+	defer state.Close()
+
+	meta, keyring, err := readSnapshotArchive(r, state)
+	if err != nil {
+		return logical.CodedError(http.StatusBadRequest, fmt.Sprintf("invalid snapshot: %v", err))
+	}
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.sealed {
+		return consts.ErrSealed
+	}
+	if c.standby {
+		return consts.ErrStandby
+	}
+
+	foreign := false
+	switch err := c.barrier.VerifyKeyring(keyring); err {
+	case nil:
+	case ErrBarrierInvalidKey:
+		if !force {
+			return logical.CodedError(http.StatusBadRequest, "snapshot was taken with a different keyring; use force to restore it")
+		}
+		foreign = true
+	default:
+		return logical.CodedError(http.StatusBadRequest, fmt.Sprintf("invalid snapshot keyring: %v", err))
+	}
+
+	// Tell any requests that know about this to stop
+	if c.requestContextCancelFunc != nil {
+		c.requestContextCancelFunc()
+	}
+
+	// Tear down, but hold on to the state lock and the HA lock until the
+	// entries and the keyring are in place, so that no requests are served
+	// and no other node takes over storage that is half restored
+	if err := c.preSeal(); err != nil {
+		c.logger.Error("core: pre-seal teardown failed", "error", err)
+	}
+
+	if err := c.restoreSnapshotStateWithRetries(state); err != nil {
+		// Storage is in an unknown state, so don't serve anything from it
+		c.logger.Error("core: failed to restore snapshot; storage is left partially restored", "error", err)
+		c.sealInternal()
+		return err
+	}
+
+	c.seal.SetBarrierConfig(nil)
+	if c.seal.RecoveryKeySupported() {
+		c.seal.SetRecoveryConfig(nil)
+	}
+	c.logger.Info("core: storage snapshot restored", "entries", meta.Entries, "created_time", meta.CreatedTime)
+
+	// The current keyring cannot read a foreign snapshot, so seal now that
+	// storage holds its keyring
+	if foreign {
+		c.logger.Warn("core: restored snapshot taken with a different keyring; sealing")
+		return c.sealInternal()
+	}
+
+	if err := c.barrier.ReloadKeyring(); err != nil {
+		c.logger.Error("core: failed to reload keyring", "error", err)
+		c.sealInternal()
+		return err
+	}
+	if err := c.postUnseal(); err != nil {
+		c.logger.Error("core: post-unseal setup failed", "error", err)
+		c.sealInternal()
+		return err
+	}
+	return nil
+}
+
+func (c *Core) checkRestoreAllowed(req *logical.Request) error {
+	if c.sealed {
+		return consts.ErrSealed
+	}
+	if c.standby {
+		return consts.ErrStandby
+	}
+	return c.checkSnapshotRequest(req)
+}
+
+// restoreSnapshotStateWithRetries restores the entries of a snapshot, trying
+// again a few times if storage fails part way, since giving up leaves the
+// storage half restored
+func (c *Core) restoreSnapshotStateWithRetries(state io.ReadSeeker) error {
+	var err error
+	for attempt := 0; attempt < snapshotRestoreAttempts; attempt++ {
+		if attempt > 0 {
+			c.logger.Warn("core: retrying snapshot restore", "error", err)
+			time.Sleep(time.Duration(attempt) * snapshotRestoreRetryInterval)
+		}
+		if _, err = state.Seek(0, 0); err != nil {
+			return err
+		}
+		if err = c.restoreSnapshotState(state); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// restoreSnapshotState writes the entries of a snapshot to the physical
+// backend and deletes all others. It does not use the request context, as
+// stopping part way would leave the storage half restored.
+func (c *Core) restoreSnapshotState(state io.Reader) error {
+	ctx := context.Background()
+	restored := make(map[string]bool)
+	dec := json.NewDecoder(bufio.NewReader(state))
+	for {
+		var entry snapshotEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if snapshotSkippedKey(entry.Key) {
+			continue
+		}
+
+		err = c.physical.Put(ctx, &physical.Entry{
+			Key:   entry.Key,
+			Value: entry.Value,
+		})
+		if err != nil {
+			return err
+		}
+		restored[entry.Key] = true
+	}
+
+	var stale []string
+	err := walkPhysical(ctx, c.physical, "", func(key string) error {
+		if !restored[key] && !snapshotSkippedKey(key) {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := c.physical.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshotArchive reads a snapshot archive, copying its entries to the
+// given file. The checksums and entries are verified, and the encrypted
+// keyring found in the snapshot is returned.
+func readSnapshotArchive(r io.Reader, state io.ReadWriteSeeker) (*snapshotMeta, []byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+
+	var metaRaw, sumsRaw []byte
+	var stateSum hash.Hash
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch hdr.Name {
+		case snapshotMetaFile:
+			metaRaw, err = ioutil.ReadAll(tr)
+		case snapshotSumsFile:
+			sumsRaw, err = ioutil.ReadAll(tr)
+		case snapshotStateFile:
+			stateSum = sha256.New()
+			_, err = io.Copy(io.MultiWriter(state, stateSum), tr)
+		default:
+			err = fmt.Errorf("unexpected file %q", hdr.Name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if metaRaw == nil || sumsRaw == nil || stateSum == nil {
+		return nil, nil, errors.New("missing files")
+	}
+
+	// Verify the checksums
+	metaSum := sha256.Sum256(metaRaw)
+	expected := map[string]string{
+		snapshotMetaFile:  hex.EncodeToString(metaSum[:]),
+		snapshotStateFile: hex.EncodeToString(stateSum.Sum(nil)),
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(sumsRaw)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, errors.New("malformed checksums")
+		}
+		sum, ok := expected[fields[1]]
+		if !ok {
+			return nil, nil, fmt.Errorf("checksum for unexpected file %q", fields[1])
+		}
+		if sum != fields[0] {
+			return nil, nil, fmt.Errorf("checksum mismatch for %q", fields[1])
+		}
+		delete(expected, fields[1])
+	}
+	if len(expected) != 0 {
+		return nil, nil, errors.New("missing checksums")
+	}
+
+	var meta snapshotMeta
+	if err := json.Unmarshal(metaRaw, &meta); err != nil {
+		return nil, nil, err
+	}
+	if meta.Version != snapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported version %d", meta.Version)
+	}
+
+	// Make sure the entries can be read back, and find the keyring
+	if _, err := state.Seek(0, 0); err != nil {
+		return nil, nil, err
+	}
+	var keyring []byte
+	var count int
+	dec := json.NewDecoder(bufio.NewReader(state))
+	for {
+		var entry snapshotEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry.Key == keyringPath {
+			keyring = entry.Value
+		}
+		count++
+	}
+	if count != meta.Entries {
+		return nil, nil, fmt.Errorf("expected %d entries, found %d", meta.Entries, count)
+	}
+	if keyring == nil {
+		return nil, nil, errors.New("missing keyring")
+	}
+	return &meta, keyring, nil
+}
+
+// walkPhysical calls the given function for every key in the physical
+// backend under the given prefix. Keys are listed a page at a time so that
+// large prefixes are not held in memory at once.
+func walkPhysical(ctx context.Context, backend physical.Backend, prefix string, f func(string) error) error {
+	var after string
+	for {
+		keys, err := physical.ListPage(ctx, backend, prefix, after, snapshotListPageSize)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if strings.HasSuffix(key, "/") {
+				err = walkPhysical(ctx, backend, prefix+key, f)
+			} else {
+				err = f(prefix + key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(keys) < snapshotListPageSize {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// checkSnapshotRequest verifies that the token of the request has root or
+// sudo privileges on the request path, and audits the request. The state
+// lock must be held.
+func (c *Core) checkSnapshotRequest(req *logical.Request) (retErr error) {
+	acl, te, _, err := c.fetchACLTokenEntryAndEntity(req.ClientToken)
+	if err != nil {
+		return err
+	}
+
+	// Audit-log the request before going any further
+	auth := &logical.Auth{
+		ClientToken: req.ClientToken,
+		Policies:    te.Policies,
+		Metadata:    te.Meta,
+		DisplayName: te.DisplayName,
+	}
+	if err := c.auditBroker.LogRequest(auth, req, c.auditedHeaders, nil); err != nil {
+		c.logger.Error("core: failed to audit request", "request_path", req.Path, "error", err)
+		return errors.New("failed to audit request, cannot continue")
+	}
+
+	// Attempt to use the token (decrement num_uses)
+	te, err = c.tokenStore.UseToken(te)
+	if err != nil {
+		c.logger.Error("core: failed to use token", "error", err)
+		return ErrInternalError
+	}
+	if te == nil {
+		// Token has been revoked
+		return logical.ErrPermissionDenied
+	}
+	if te.NumUses == -1 {
+		// Token needs to be revoked
+		defer func(id string) {
+			err = c.tokenStore.Revoke(id)
+			if err != nil {
+				c.logger.Error("core: token needed revocation after snapshot but failed to revoke", "error", err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+			}
+		}(te.ID)
+	}
+
+	// We always require root privileges for this operation
+	allowed, rootPrivs := acl.AllowOperation(req)
+	if !allowed || !rootPrivs {
+		return logical.ErrPermissionDenied
+	}
+	return nil
+}
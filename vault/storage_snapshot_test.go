@@ -0,0 +1,193 @@
+package vault
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func testSnapshotRequest(op logical.Operation, token string) *logical.Request {
+	return &logical.Request{
+		Operation:   op,
+		Path:        "sys/storage/snapshot",
+		ClientToken: token,
+	}
+}
+
+func testSnapshotWrite(t *testing.T, c *Core, token, path, value string) {
+	req := logical.TestRequest(t, logical.UpdateOperation, path)
+	req.Data["value"] = value
+	req.ClientToken = token
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testSnapshotSealed(t *testing.T, c *Core) bool {
+	sealed, err := c.Sealed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func TestCore_Snapshot(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	testSnapshotWrite(t, c, root, "secret/foo", "bar")
+
+	var snapshot bytes.Buffer
+	if err := c.SaveSnapshot(testSnapshotRequest(logical.ReadOperation, root), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	testSnapshotWrite(t, c, root, "secret/foo", "baz")
+	testSnapshotWrite(t, c, root, "secret/other", "bar")
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/other")
+	req.Data["type"] = "kv"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.RestoreSnapshot(testSnapshotRequest(logical.UpdateOperation, root), bytes.NewReader(snapshot.Bytes()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testSnapshotSealed(t, c) {
+		t.Fatal("should not be sealed")
+	}
+
+	// Everything written after the snapshot is gone
+	if err := checkPerfStandbyRead(c, root, "secret/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPerfStandbyRead(c, root, "secret/other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if match := c.router.MatchingMount("other/"); match != "" {
+		t.Fatalf("mount made after the snapshot still exists: %q", match)
+	}
+}
+
+func TestCore_Snapshot_Invalid(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	var snapshot bytes.Buffer
+	if err := c.SaveSnapshot(testSnapshotRequest(logical.ReadOperation, root), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the archive with a tampered state file
+	gz, err := gzip.NewReader(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var tampered bytes.Buffer
+	gzw := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(gzw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == snapshotStateFile {
+			contents[len(contents)/2] ^= 0xff
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gzw.Close()
+
+	err = c.RestoreSnapshot(testSnapshotRequest(logical.UpdateOperation, root), &tampered, false)
+	if err == nil {
+		t.Fatal("expected error restoring a tampered snapshot")
+	}
+	if testSnapshotSealed(t, c) {
+		t.Fatal("should not be sealed")
+	}
+
+	err = c.RestoreSnapshot(testSnapshotRequest(logical.UpdateOperation, root), bytes.NewReader([]byte("foo")), false)
+	if err == nil {
+		t.Fatal("expected error restoring garbage")
+	}
+}
+
+func TestCore_Snapshot_Permissions(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["policies"] = []string{"default"}
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := resp.Auth.ClientToken
+
+	var snapshot bytes.Buffer
+	err = c.SaveSnapshot(testSnapshotRequest(logical.ReadOperation, token), &snapshot)
+	if err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	if snapshot.Len() != 0 {
+		t.Fatal("snapshot should not be written")
+	}
+}
+
+func TestCore_Snapshot_ForeignKeyring(t *testing.T) {
+	source, keys, sourceRoot := TestCoreUnsealed(t)
+	testSnapshotWrite(t, source, sourceRoot, "secret/foo", "bar")
+
+	var snapshot bytes.Buffer
+	if err := source.SaveSnapshot(testSnapshotRequest(logical.ReadOperation, sourceRoot), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _, root := TestCoreUnsealed(t)
+	err := c.RestoreSnapshot(testSnapshotRequest(logical.UpdateOperation, root), bytes.NewReader(snapshot.Bytes()), false)
+	if err == nil {
+		t.Fatal("expected error restoring a snapshot with a different keyring")
+	}
+	if testSnapshotSealed(t, c) {
+		t.Fatal("should not be sealed")
+	}
+
+	err = c.RestoreSnapshot(testSnapshotRequest(logical.UpdateOperation, root), bytes.NewReader(snapshot.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !testSnapshotSealed(t, c) {
+		t.Fatal("should be sealed")
+	}
+
+	// The keys of the source cluster unseal the restored data
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(c, TestKeyCopy(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if testSnapshotSealed(t, c) {
+		t.Fatal("should not be sealed")
+	}
+	if err := checkPerfStandbyRead(c, sourceRoot, "secret/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/reload"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
@@ -227,6 +228,42 @@ func TestCoreUnsealedRaw(t testing.T) (*Core, [][]byte, string) {
 	return testCoreUnsealed(t, core)
 }
 
+// TestCoreUnsealedWithMetrics returns a pure in-memory core that is already
+// initialized and unsealed, and serves sys/metrics with the given helper.
+func TestCoreUnsealedWithMetrics(t testing.T, metricsHelper *metricsutil.MetricsHelper) (*Core, [][]byte, string) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	physicalBackend, err := physInmem.NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := testCoreConfig(t, physicalBackend, logger)
+	conf.MetricsHelper = metricsHelper
+
+	core, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return testCoreUnsealed(t, core)
+}
+
+// TestCoreUnsealedWithLogger returns a pure in-memory core that is already
+// initialized and unsealed, and logs with the given logger.
+func TestCoreUnsealedWithLogger(t testing.T, logger log.Logger) (*Core, [][]byte, string) {
+	physicalBackend, err := physInmem.NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := testCoreConfig(t, physicalBackend, logger)
+
+	core, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return testCoreUnsealed(t, core)
+}
+
 func testCoreUnsealed(t testing.T, core *Core) (*Core, [][]byte, string) {
 	keys, token := TestCoreInit(t, core)
 	for _, key := range keys {
@@ -1008,6 +1045,7 @@ func NewTestCluster(t testing.T, base *CoreConfig, opts *TestClusterOptions) *Te
 		coreConfig.PluginDirectory = base.PluginDirectory
 		coreConfig.Seal = base.Seal
 		coreConfig.DevToken = base.DevToken
+		coreConfig.PerformanceStandby = base.PerformanceStandby
 
 		if !coreConfig.DisableMlock {
 			base.DisableMlock = false
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/golang-lru"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
@@ -47,6 +49,26 @@ const (
 	// rolesPrefix is the prefix used to store role information
 	rolesPrefix = "roles/"
 
+	// tokenAncestorCacheSize is the number of tokens whose ancestry is cached
+	tokenAncestorCacheSize = 16 * 1024
+
+	// tokenCountPageSize is the number of token IDs listed at a time when
+	// counting the tokens
+	tokenCountPageSize = 1000
+
+	// tokenCountInterval is how long a count of the tokens is reused before
+	// the tokens are counted again
+	tokenCountInterval = 10 * time.Minute
+
+	// batchTokenPrefix is the prefix of the IDs of batch tokens, which
+	// distinguishes them from the IDs of service tokens
+	batchTokenPrefix = "b."
+
+	// batchTokenEncryptionPath is the path whose key encrypts batch tokens.
+	// Batch tokens can only be decrypted with the keyring of the cluster
+	// that issued them.
+	batchTokenEncryptionPath = "core/batch-token"
+
 	// tokenRevocationDeferred indicates that the token should not be used
 	// again but is currently fulfilling its final use
 	tokenRevocationDeferred = -1
@@ -60,6 +82,11 @@ const (
 	// again (or when the revocation function is run again), but all other uses
 	// will report the token invalid
 	tokenRevocationFailed = -3
+
+	// tokenRevocationPending indicates that the token and its children are
+	// queued for revocation in the background. The token is invalid while
+	// the revocation is pending.
+	tokenRevocationPending = -4
 )
 
 var (
@@ -96,6 +123,9 @@ type TokenStore struct {
 
 	cubbyholeDestroyer func(*TokenStore, string) error
 
+	// batchTokenEncryptor encrypts and decrypts batch tokens
+	batchTokenEncryptor BarrierEncryptor
+
 	logger log.Logger
 
 	saltLock   sync.RWMutex
@@ -103,6 +133,23 @@ type TokenStore struct {
 	saltConfig *salt.Config
 
 	tidyLock int64
+
+	// ancestorCache caches whether a token or one of its ancestors is being
+	// revoked, by salted token ID, so that lookups don't read the parent
+	// chain every time. ancestorChildren indexes the cached tokens by
+	// parent, so that a token and its descendants are evicted together when
+	// the token is marked for revocation or deleted. ancestorWalks are the
+	// lookups of the chain in progress, which must not cache what was
+	// evicted meanwhile. All are guarded by ancestorLock.
+	ancestorLock     sync.Mutex
+	ancestorCache    *lru.Cache
+	ancestorChildren map[string]map[string]struct{}
+	ancestorWalks    map[*ancestorWalk]struct{}
+
+	// countLock guards the last count of the tokens and when it was made
+	countLock sync.Mutex
+	count     int
+	countTime time.Time
 }
 
 // NewTokenStore is used to construct a token store that is
@@ -113,12 +160,16 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 
 	// Initialize the store
 	t := &TokenStore{
-		view:               view,
-		cubbyholeDestroyer: destroyCubbyhole,
-		logger:             c.logger,
-		tokenLocks:         locksutil.CreateLocks(),
-		saltLock:           sync.RWMutex{},
+		view:                view,
+		cubbyholeDestroyer:  destroyCubbyhole,
+		batchTokenEncryptor: c.barrier,
+		logger:              c.logger,
+		tokenLocks:          locksutil.CreateLocks(),
+		saltLock:            sync.RWMutex{},
 	}
+	t.ancestorChildren = make(map[string]map[string]struct{})
+	t.ancestorWalks = make(map[*ancestorWalk]struct{})
+	t.ancestorCache, _ = lru.NewWithEvict(tokenAncestorCacheSize, t.ancestorEvicted)
 
 	if c.policyStore != nil {
 		t.policyLookupFunc = c.policyStore.GetPolicy
@@ -211,6 +262,12 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 						Description: tokenExplicitMaxTTLHelp,
 					},
 
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     string(logical.TokenTypeDefaultService),
+						Description: tokenTypeHelp,
+					},
+
 					"renewable": &framework.FieldSchema{
 						Type:        framework.TypeBool,
 						Default:     true,
@@ -583,6 +640,15 @@ type TokenEntry struct {
 	ExplicitMaxTTLDeprecated time.Duration `json:"ExplicitMaxTTL" mapstructure:"ExplicitMaxTTL" structs:"ExplicitMaxTTL"`
 
 	EntityID string `json:"entity_id" mapstructure:"entity_id" structs:"entity_id"`
+
+	// Type is set to batch for batch tokens. It is empty for service tokens,
+	// matching the entries stored before token types existed.
+	Type logical.TokenType `json:"type" mapstructure:"type" structs:"type"`
+}
+
+// IsBatch returns true if the token is a batch token
+func (te *TokenEntry) IsBatch() bool {
+	return te.Type == logical.TokenTypeBatch
 }
 
 // tsRoleEntry contains token store role information
@@ -614,6 +680,9 @@ type tsRoleEntry struct {
 	// If set, the token entry will have an explicit maximum TTL set, rather
 	// than deferring to role/mount values
 	ExplicitMaxTTL time.Duration `json:"explicit_max_ttl" mapstructure:"explicit_max_ttl" structs:"explicit_max_ttl"`
+
+	// The type of tokens created using this role
+	TokenType logical.TokenType `json:"token_type" mapstructure:"token_type" structs:"token_type"`
 }
 
 type accessorEntry struct {
@@ -720,6 +789,11 @@ func (ts *TokenStore) createAccessor(entry *TokenEntry) error {
 // a newly generated ID if not provided.
 func (ts *TokenStore) create(entry *TokenEntry) error {
 	defer metrics.MeasureSince([]string{"token", "create"}, time.Now())
+
+	if entry.IsBatch() {
+		return ts.createBatchToken(entry)
+	}
+
 	// Generate an ID if necessary
 	if entry.ID == "" {
 		entryUUID, err := uuid.GenerateUUID()
@@ -748,6 +822,78 @@ func (ts *TokenStore) create(entry *TokenEntry) error {
 	return ts.storeCommon(entry, true)
 }
 
+// createBatchToken generates the ID of a batch token, which is the
+// encrypted token entry itself. Nothing is written to storage.
+func (ts *TokenStore) createBatchToken(entry *TokenEntry) error {
+	switch {
+	case entry.ID != "":
+		return fmt.Errorf("batch tokens cannot have a custom ID")
+	case entry.NumUses != 0:
+		return fmt.Errorf("batch tokens cannot have a limited number of uses")
+	case entry.Period != 0:
+		return fmt.Errorf("batch tokens cannot be periodic")
+	case entry.TTL <= 0:
+		return fmt.Errorf("batch tokens must have a TTL")
+	case strutil.StrListContains(entry.Policies, "root"):
+		return fmt.Errorf("batch tokens cannot be root tokens")
+	}
+
+	entry.Policies = policyutil.SanitizePolicies(entry.Policies, policyutil.DoNotAddDefaultPolicy)
+	entry.Accessor = ""
+
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch token: %v", err)
+	}
+	ciphertext, err := ts.batchTokenEncryptor.Encrypt(batchTokenEncryptionPath, plain)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt batch token: %v", err)
+	}
+
+	entry.ID = batchTokenPrefix + base64.RawURLEncoding.EncodeToString(ciphertext)
+	return nil
+}
+
+// lookupBatchToken decrypts a batch token. Expired batch tokens and batch
+// tokens whose parent has been revoked are not returned.
+func (ts *TokenStore) lookupBatchToken(id string) (*TokenEntry, error) {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, batchTokenPrefix))
+	if err != nil {
+		return nil, nil
+	}
+	plain, err := ts.batchTokenEncryptor.Decrypt(batchTokenEncryptionPath, ciphertext)
+	if err != nil {
+		// The token was not issued by this cluster or was tampered with
+		return nil, nil
+	}
+
+	entry := new(TokenEntry)
+	if err := jsonutil.DecodeJSON(plain, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode batch token: %v", err)
+	}
+	entry.ID = id
+
+	if !entry.IsBatch() {
+		return nil, nil
+	}
+	if time.Unix(entry.CreationTime, 0).Add(entry.TTL).Before(time.Now()) {
+		return nil, nil
+	}
+
+	// A batch token is only valid as long as its parent is
+	if entry.Parent != "" {
+		parent, err := ts.Lookup(entry.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up batch token parent: %v", err)
+		}
+		if parent == nil {
+			return nil, nil
+		}
+	}
+
+	return entry, nil
+}
+
 // Store is used to store an updated token entry without writing the
 // secondary index.
 func (ts *TokenStore) store(entry *TokenEntry) error {
@@ -803,6 +949,11 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 	if err := ts.view.Put(le); err != nil {
 		return fmt.Errorf("failed to persist entry: %v", err)
 	}
+
+	// The descendants of a token marked for revocation are invalid
+	if entry.NumUses < tokenRevocationDeferred {
+		ts.evictAncestry(saltedId)
+	}
 	return nil
 }
 
@@ -882,6 +1033,10 @@ func (ts *TokenStore) Lookup(id string) (*TokenEntry, error) {
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return ts.lookupBatchToken(id)
+	}
+
 	lock := locksutil.LockForKey(ts.tokenLocks, id)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -920,8 +1075,21 @@ func (ts *TokenStore) lookupSalted(saltedID string, tainted bool) (*TokenEntry,
 		return nil, nil
 	}
 
+	// Children are revoked in the background after their parent, so a token
+	// is invalid as soon as one of its ancestors is being revoked
+	if !tainted && entry.Parent != "" {
+		revoked, err := ts.ancestorRevoked(entry)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, nil
+		}
+	}
+
 	// If we are still restoring the expiration manager, we want to ensure the
-	// token is not expired
+	// token is not expired. Tainted lookups load the lease all the same but
+	// return expired tokens, since they are used to revoke them.
 	if ts.expiration == nil {
 		return nil, nil
 	}
@@ -929,7 +1097,7 @@ func (ts *TokenStore) lookupSalted(saltedID string, tainted bool) (*TokenEntry,
 	if err != nil {
 		return nil, fmt.Errorf("failed to check token in restore mode: %v", err)
 	}
-	if !check {
+	if !check && !tainted {
 		return nil, nil
 	}
 
@@ -985,6 +1153,9 @@ func (ts *TokenStore) Revoke(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	saltedID, err := ts.SaltID(id)
 	if err != nil {
@@ -1110,6 +1281,9 @@ func (ts *TokenStore) revokeSalted(saltedId string) (ret error) {
 		return fmt.Errorf("failed to delete entry: %v", err)
 	}
 
+	// The children of an orphaned token are valid again
+	ts.evictAncestry(saltedId)
+
 	return nil
 }
 
@@ -1121,6 +1295,9 @@ func (ts *TokenStore) RevokeTree(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot tree-revoke blank token")
 	}
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	// Get the salted ID
 	saltedId, err := ts.SaltID(id)
@@ -1136,31 +1313,102 @@ func (ts *TokenStore) RevokeTree(id string) error {
 }
 
 // revokeTreeSalted is used to invalide a given token and all
-// child tokens using a saltedID.
+// child tokens using a saltedID. The tree is walked depth-first without
+// recursion, revoking each token after its children, so that deep trees
+// do not exhaust the stack and a failed revocation can be resumed from
+// the remaining tokens.
 func (ts *TokenStore) revokeTreeSalted(saltedId string) error {
-	// Scan for child tokens
-	path := parentPrefix + saltedId + "/"
-	children, err := ts.view.List(path)
-	if err != nil {
-		return fmt.Errorf("failed to scan for children: %v", err)
+	type node struct {
+		saltedID string
+		expanded bool
 	}
+	dfs := []*node{&node{saltedID: saltedId}}
 
-	// Recursively nuke the children. The subtle nuance here is that
-	// we don't have the acutal ID of the child, but we have the salted
-	// value. Turns out, this is good enough!
-	for _, child := range children {
-		if err := ts.revokeTreeSalted(child); err != nil {
-			return err
+	for len(dfs) > 0 {
+		n := dfs[len(dfs)-1]
+
+		// The children of this token have been revoked, revoke the token
+		if n.expanded {
+			if err := ts.revokeSalted(n.saltedID); err != nil {
+				return fmt.Errorf("failed to revoke entry: %v", err)
+			}
+			dfs = dfs[:len(dfs)-1]
+			continue
 		}
-	}
 
-	// Revoke this entry
-	if err := ts.revokeSalted(saltedId); err != nil {
-		return fmt.Errorf("failed to revoke entry: %v", err)
+		// Scan for child tokens. The subtle nuance here is that we don't
+		// have the acutal ID of the child, but we have the salted value.
+		// Turns out, this is good enough!
+		path := parentPrefix + n.saltedID + "/"
+		children, err := ts.view.List(path)
+		if err != nil {
+			return fmt.Errorf("failed to scan for children: %v", err)
+		}
+		n.expanded = true
+		for _, child := range children {
+			dfs = append(dfs, &node{saltedID: child})
+		}
 	}
+
 	return nil
 }
 
+// lazyRevokeTree invalidates a token immediately and revokes it, along
+// with its children and their leases, in the background. The revocation is
+// carried out by the expiration manager through the token's auth lease, so
+// it survives restarts and leader changes, and failed attempts are retried.
+func (ts *TokenStore) lazyRevokeTree(id string) error {
+	defer metrics.MeasureSince([]string{"token", "lazy-revoke-tree"}, time.Now())
+	if id == "" {
+		return fmt.Errorf("cannot tree-revoke blank token")
+	}
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
+
+	saltedID, err := ts.SaltID(id)
+	if err != nil {
+		return err
+	}
+
+	lock := locksutil.LockForKey(ts.tokenLocks, id)
+	lock.Lock()
+
+	entry, err := ts.lookupSalted(saltedID, true)
+	if err != nil {
+		lock.Unlock()
+		return err
+	}
+	if entry == nil || entry.NumUses == tokenRevocationInProgress {
+		lock.Unlock()
+		return nil
+	}
+
+	// Tokens that are not tied to a path have no lease, so they are
+	// revoked in place
+	if entry.Path == "" {
+		lock.Unlock()
+		return ts.RevokeTree(id)
+	}
+
+	leaseID, err := ts.expiration.CreateOrFetchRevocationLeaseByToken(entry)
+	if err != nil {
+		lock.Unlock()
+		return err
+	}
+
+	// Mark the token as pending revocation, which makes it invalid from
+	// here on
+	entry.NumUses = tokenRevocationPending
+	err = ts.storeCommon(entry, false)
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return ts.expiration.LazyRevoke(leaseID)
+}
+
 // handleCreateAgainstRole handles the auth/token/create path for a role
 func (ts *TokenStore) handleCreateAgainstRole(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -1176,6 +1424,194 @@ func (ts *TokenStore) handleCreateAgainstRole(
 	return ts.handleCreateCommon(req, d, false, roleEntry)
 }
 
+// ancestorCacheEntry is the cached result of ancestorRevoked for a token,
+// along with the salted ID of the parent it was computed from
+type ancestorCacheEntry struct {
+	revoked bool
+	parent  string
+}
+
+// ancestorWalk is a call to ancestorRevoked in progress. evicted collects
+// the salted IDs evicted from the cache since it started.
+type ancestorWalk struct {
+	evicted map[string]struct{}
+}
+
+// ancestorRevoked returns whether an ancestor of the token is being revoked.
+// Trees are revoked from the leaves up, so the marked ancestor outlives its
+// descendants; a missing ancestor means the token was orphaned. The result is
+// cached for every ancestor read, so that the chain is only read again once
+// one of them is written.
+func (ts *TokenStore) ancestorRevoked(entry *TokenEntry) (bool, error) {
+	var walk *ancestorWalk
+	if ts.ancestorCache != nil {
+		walk = &ancestorWalk{evicted: make(map[string]struct{})}
+		ts.ancestorLock.Lock()
+		ts.ancestorWalks[walk] = struct{}{}
+		ts.ancestorLock.Unlock()
+		defer func() {
+			ts.ancestorLock.Lock()
+			delete(ts.ancestorWalks, walk)
+			ts.ancestorLock.Unlock()
+		}()
+	}
+
+	// read are the salted IDs of the ancestors read, each the parent of the
+	// one before, and cachedParent the cached ancestor the walk stopped at
+	var read []string
+	var cachedParent string
+	revoked := false
+	for parentID := entry.Parent; parentID != ""; {
+		saltedParentID, err := ts.SaltID(parentID)
+		if err != nil {
+			return false, err
+		}
+		if ts.ancestorCache != nil {
+			if cached, ok := ts.ancestorCache.Get(saltedParentID); ok {
+				revoked = cached.(*ancestorCacheEntry).revoked
+				cachedParent = saltedParentID
+				break
+			}
+		}
+		read = append(read, saltedParentID)
+
+		raw, err := ts.view.Get(lookupPrefix + saltedParentID)
+		if err != nil {
+			return false, fmt.Errorf("failed to read parent entry: %v", err)
+		}
+		if raw == nil {
+			break
+		}
+
+		parent := new(TokenEntry)
+		if err := jsonutil.DecodeJSON(raw.Value, parent); err != nil {
+			return false, fmt.Errorf("failed to decode parent entry: %v", err)
+		}
+		switch parent.NumUses {
+		case tokenRevocationInProgress, tokenRevocationFailed, tokenRevocationPending:
+			revoked = true
+		}
+		if revoked {
+			break
+		}
+		parentID = parent.Parent
+	}
+
+	// Every ancestor read shares the result, unless one of them, or the
+	// cached ancestor the result came from, was evicted in the meantime
+	if walk == nil {
+		return revoked, nil
+	}
+	ts.ancestorLock.Lock()
+	defer ts.ancestorLock.Unlock()
+	if _, ok := walk.evicted[cachedParent]; ok && cachedParent != "" {
+		return revoked, nil
+	}
+	for _, id := range read {
+		if _, ok := walk.evicted[id]; ok {
+			return revoked, nil
+		}
+	}
+	for i, id := range read {
+		// The last ancestor read depends on the cached one, if any; a
+		// revoked or missing ancestor has nothing further to depend on
+		parent := cachedParent
+		if i+1 < len(read) {
+			parent = read[i+1]
+		}
+		ts.ancestorCache.Add(id, &ancestorCacheEntry{
+			revoked: revoked,
+			parent:  parent,
+		})
+		if parent != "" {
+			children, ok := ts.ancestorChildren[parent]
+			if !ok {
+				children = make(map[string]struct{})
+				ts.ancestorChildren[parent] = children
+			}
+			children[id] = struct{}{}
+		}
+	}
+	return revoked, nil
+}
+
+// ancestorEvicted is called by the cache when a token is evicted from it,
+// with ancestorLock held, and removes the token from the index of children
+func (ts *TokenStore) ancestorEvicted(key, value interface{}) {
+	parent := value.(*ancestorCacheEntry).parent
+	children, ok := ts.ancestorChildren[parent]
+	if !ok {
+		return
+	}
+	delete(children, key.(string))
+	if len(children) == 0 {
+		delete(ts.ancestorChildren, parent)
+	}
+}
+
+// evictAncestry drops the cached results of ancestorRevoked for the token
+// with the salted ID and for its descendants, which depend on it
+func (ts *TokenStore) evictAncestry(saltedID string) {
+	if ts.ancestorCache == nil {
+		return
+	}
+	ts.ancestorLock.Lock()
+	defer ts.ancestorLock.Unlock()
+
+	queue := []string{saltedID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for walk := range ts.ancestorWalks {
+			walk.evicted[id] = struct{}{}
+		}
+		for child := range ts.ancestorChildren[id] {
+			queue = append(queue, child)
+		}
+		delete(ts.ancestorChildren, id)
+		ts.ancestorCache.Remove(id)
+	}
+}
+
+// tokenCount returns the number of tokens in storage. The token IDs are
+// listed a page at a time, and the count is only redone once it is older
+// than tokenCountInterval.
+func (ts *TokenStore) tokenCount() (int, error) {
+	ts.countLock.Lock()
+	defer ts.countLock.Unlock()
+
+	if !ts.countTime.IsZero() && time.Since(ts.countTime) < tokenCountInterval {
+		return ts.count, nil
+	}
+
+	count := 0
+	after := ""
+	for {
+		keys, err := ts.view.ListPage(lookupPrefix, after, tokenCountPageSize)
+		if err != nil {
+			return 0, err
+		}
+		count += len(keys)
+		if len(keys) < tokenCountPageSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+
+	ts.count = count
+	ts.countTime = time.Now()
+	return count, nil
+}
+
+// invalidate is called by performance standbys when a key of the token
+// store is written by the active node
+func (ts *TokenStore) invalidate(key string) {
+	if strings.HasPrefix(key, lookupPrefix) {
+		ts.evictAncestry(strings.TrimPrefix(key, lookupPrefix))
+	}
+}
+
 func (ts *TokenStore) lookupByAccessor(accessor string, tainted bool) (accessorEntry, error) {
 	saltedID, err := ts.SaltID(accessor)
 	if err != nil {
@@ -1455,8 +1891,8 @@ func (ts *TokenStore) handleUpdateRevokeAccessor(req *logical.Request, data *fra
 		return nil, err
 	}
 
-	// Revoke the token and its children
-	if err := ts.RevokeTree(aEntry.TokenID); err != nil {
+	// Invalidate the token and revoke it and its children in the background
+	if err := ts.lazyRevokeTree(aEntry.TokenID); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 
@@ -1492,6 +1928,12 @@ func (ts *TokenStore) handleCreateCommon(
 		return logical.ErrorResponse("parent token lookup failed"), logical.ErrInvalidRequest
 	}
 
+	// Batch tokens are not persisted so they cannot be the parent of other
+	// tokens
+	if parent.IsBatch() {
+		return logical.ErrorResponse("batch tokens cannot create more tokens"), logical.ErrInvalidRequest
+	}
+
 	// A token with a restricted number of uses cannot create a new token
 	// otherwise it could escape the restriction count.
 	if parent.NumUses > 0 {
@@ -1516,6 +1958,7 @@ func (ts *TokenStore) handleCreateCommon(
 		DisplayName     string `mapstructure:"display_name"`
 		NumUses         int    `mapstructure:"num_uses"`
 		Period          string
+		Type            string
 	}
 	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -1528,6 +1971,22 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	requestedType, err := logical.ParseTokenType(data.Type)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if requestedType != logical.TokenTypeDefault && requestedType != logical.TokenTypeService && requestedType != logical.TokenTypeBatch {
+		return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", data.Type)), logical.ErrInvalidRequest
+	}
+	roleType := logical.TokenTypeDefaultService
+	if role != nil && role.TokenType != logical.TokenTypeDefault {
+		roleType = role.TokenType
+	}
+	tokenType, err := roleType.Resolve(requestedType)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
 	// Setup the token entry
 	te := TokenEntry{
 		Parent: req.ClientToken,
@@ -1542,12 +2001,20 @@ func (ts *TokenStore) handleCreateCommon(
 		NumUses:      data.NumUses,
 		CreationTime: time.Now().Unix(),
 	}
+	if tokenType == logical.TokenTypeBatch {
+		te.Type = logical.TokenTypeBatch
+	}
 
 	renewable := true
 	if data.Renewable != nil {
 		renewable = *data.Renewable
 	}
 
+	// Batch tokens are never renewable
+	if te.IsBatch() {
+		renewable = false
+	}
+
 	// If the role is not nil, we add the role name as part of the token's
 	// path. This makes it much easier to later revoke tokens that were issued
 	// by a role (using revoke-prefix). Users can further specify a PathSuffix
@@ -1882,6 +2349,7 @@ func (ts *TokenStore) handleCreateCommon(
 		ClientToken: te.ID,
 		Accessor:    te.Accessor,
 		EntityID:    te.EntityID,
+		TokenType:   tokenType,
 	}
 
 	if ts.policyLookupFunc != nil {
@@ -1904,8 +2372,8 @@ func (ts *TokenStore) handleCreateCommon(
 // the token and all children anyways, but that is only available when there is a lease.
 func (ts *TokenStore) handleRevokeSelf(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Revoke the token and its children
-	if err := ts.RevokeTree(req.ClientToken); err != nil {
+	// Invalidate the token and revoke it and its children in the background
+	if err := ts.lazyRevokeTree(req.ClientToken); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 	return nil, nil
@@ -1926,8 +2394,8 @@ func (ts *TokenStore) handleRevokeTree(
 		urltoken = true
 	}
 
-	// Revoke the token and its children
-	if err := ts.RevokeTree(id); err != nil {
+	// Invalidate the token and revoke it and its children in the background
+	if err := ts.lazyRevokeTree(id); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 
@@ -2011,16 +2479,22 @@ func (ts *TokenStore) handleLookup(
 		return logical.ErrorResponse("missing token ID"), logical.ErrInvalidRequest
 	}
 
-	lock := locksutil.LockForKey(ts.tokenLocks, id)
-	lock.RLock()
-	defer lock.RUnlock()
+	var out *TokenEntry
+	var err error
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		out, err = ts.lookupBatchToken(id)
+	} else {
+		lock := locksutil.LockForKey(ts.tokenLocks, id)
+		lock.RLock()
+		defer lock.RUnlock()
 
-	// Lookup the token
-	saltedId, err := ts.SaltID(id)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		// Lookup the token
+		saltedId, err := ts.SaltID(id)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		out, err = ts.lookupSalted(saltedId, true)
 	}
-	out, err := ts.lookupSalted(saltedId, true)
 
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
@@ -2048,6 +2522,7 @@ func (ts *TokenStore) handleLookup(
 			"ttl":              int64(0),
 			"explicit_max_ttl": int64(out.ExplicitMaxTTL.Seconds()),
 			"entity_id":        out.EntityID,
+			"type":             logical.TokenTypeService,
 		},
 	}
 
@@ -2062,6 +2537,23 @@ func (ts *TokenStore) handleLookup(
 		resp.Data["period"] = int64(out.Period.Seconds())
 	}
 
+	// Batch tokens have no lease, their expiration is computed from the
+	// token itself
+	if out.IsBatch() {
+		issueTime := time.Unix(out.CreationTime, 0)
+		expireTime := issueTime.Add(out.TTL)
+		resp.Data["type"] = logical.TokenTypeBatch
+		resp.Data["issue_time"] = issueTime
+		resp.Data["expire_time"] = expireTime
+		resp.Data["ttl"] = int64(time.Until(expireTime).Seconds())
+		resp.Data["renewable"] = false
+
+		if urltoken {
+			resp.AddWarning(`Using a token in the path is unsafe as the token can be logged in many places. Please use POST or PUT with the token passed in via the "token" parameter.`)
+		}
+		return resp, nil
+	}
+
 	// Fetch the last renewal time
 	leaseTimes, err := ts.expiration.FetchLeaseTimesByToken(out.Path, out.ID)
 	if err != nil {
@@ -2079,6 +2571,26 @@ func (ts *TokenStore) handleLookup(
 		renewable, _ := leaseTimes.renewable()
 		resp.Data["renewable"] = renewable
 		resp.Data["issue_time"] = leaseTimes.IssueTime
+
+		// Failed attempts at revoking the token are retried by the
+		// expiration manager
+		if leaseTimes.RevokeAttempts > 0 {
+			resp.Data["revocation_attempts"] = leaseTimes.RevokeAttempts
+			resp.Data["revocation_error"] = leaseTimes.RevokeErr
+		}
+	}
+
+	// Report the progress of the revocation of the token
+	switch out.NumUses {
+	case tokenRevocationPending:
+		resp.Data["revocation_status"] = "pending"
+	case tokenRevocationInProgress:
+		resp.Data["revocation_status"] = "in_progress"
+	case tokenRevocationFailed:
+		resp.Data["revocation_status"] = "failed"
+	}
+	if leaseTimes != nil && leaseTimes.Irrevocable {
+		resp.Data["revocation_status"] = "irrevocable"
 	}
 
 	if urltoken {
@@ -2122,6 +2634,9 @@ func (ts *TokenStore) handleRenew(
 	if te == nil {
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
+	if te.IsBatch() {
+		return logical.ErrorResponse("batch tokens cannot be renewed"), logical.ErrInvalidRequest
+	}
 
 	// Renew the token and its children
 	resp, err := ts.expiration.RenewToken(req, te.Path, te.ID, increment)
@@ -2271,6 +2786,12 @@ func (ts *TokenStore) tokenStoreRoleRead(
 		return nil, nil
 	}
 
+	// Roles created before token types existed issue service tokens
+	tokenType := role.TokenType
+	if tokenType == logical.TokenTypeDefault {
+		tokenType = logical.TokenTypeDefaultService
+	}
+
 	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"period":              int64(role.Period.Seconds()),
@@ -2281,6 +2802,7 @@ func (ts *TokenStore) tokenStoreRoleRead(
 			"orphan":              role.Orphan,
 			"path_suffix":         role.PathSuffix,
 			"renewable":           role.Renewable,
+			"token_type":          tokenType,
 		},
 	}
 
@@ -2392,6 +2914,24 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 		entry.AllowedPolicies = policyutil.SanitizePolicies(strings.Split(data.Get("allowed_policies").(string), ","), policyutil.DoNotAddDefaultPolicy)
 	}
 
+	tokenTypeRaw, ok := data.GetOk("token_type")
+	if ok || req.Operation == logical.CreateOperation {
+		if !ok {
+			tokenTypeRaw = data.Get("token_type")
+		}
+		tokenType, err := logical.ParseTokenType(tokenTypeRaw.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if tokenType == logical.TokenTypeDefault {
+			tokenType = logical.TokenTypeDefaultService
+		}
+		entry.TokenType = tokenType
+	}
+	if entry.TokenType == logical.TokenTypeBatch && entry.Period != 0 {
+		return logical.ErrorResponse("batch tokens cannot be periodic"), nil
+	}
+
 	disallowedPoliciesStr, ok := data.GetOk("disallowed_policies")
 	if ok {
 		entry.DisallowedPolicies = strutil.ParseDedupLowercaseAndSortStrings(disallowedPoliciesStr.(string), ",")
@@ -2467,6 +3007,11 @@ no effect on the token being renewed.`
 	tokenRenewableHelp = `Tokens created via this role will be
 renewable or not according to this value.
 Defaults to "true".`
+	tokenTypeHelp = `The type of tokens created via this role,
+either "service", "batch", "default-service"
+or "default-batch". With the "default-" types,
+the type can be chosen at creation time.
+Defaults to "default-service".`
 	tokenListAccessorsHelp = `List token accessors, which can then be
 be used to iterate and discover their properities
 or revoke them. Because this can be used to
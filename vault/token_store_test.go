@@ -211,6 +211,30 @@ func testMakeToken(t *testing.T, ts *TokenStore, root, client, ttl string, polic
 	}
 }
 
+// testWaitForTokenRevocation waits for the background revocation of a token
+// to remove its entry
+func testWaitForTokenRevocation(t *testing.T, ts *TokenStore, id string) {
+	saltedID, err := ts.SaltID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		out, err := ts.view.Get(lookupPrefix + saltedID)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("token %q was not revoked", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func testCoreMakeToken(t *testing.T, c *Core, root, client, ttl string, policy []string) {
 	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
 	req.ClientToken = root
@@ -1343,7 +1367,8 @@ func TestTokenStore_HandleRequest_Revoke(t *testing.T) {
 		t.Fatalf("bad: %v", out)
 	}
 
-	// Sub-child should not exist
+	// Sub-child should not exist once the revocation has run
+	testWaitForTokenRevocation(t, ts, "child")
 	out, err = ts.Lookup("sub-child")
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -1353,6 +1378,195 @@ func TestTokenStore_HandleRequest_Revoke(t *testing.T) {
 	}
 }
 
+func TestTokenStore_HandleRequest_Revoke_Lazy(t *testing.T) {
+	c, ts, _, root := TestCoreWithTokenStore(t)
+	c.expiration.revokeRetryBase = time.Hour
+
+	// Revoke through the token store under test, so that its cubbyhole
+	// destroyer is used
+	c.expiration.tokenStore = ts
+
+	// Build a deep tree of tokens
+	const depth = 50
+	parent := root
+	for i := 0; i < depth; i++ {
+		id := fmt.Sprintf("child-%d", i)
+		testMakeToken(t, ts, parent, id, "", []string{"root", "foo"})
+		parent = id
+	}
+
+	// Make revocation fail
+	ts.cubbyholeDestroyer = func(*TokenStore, string) error {
+		return fmt.Errorf("cubbyhole unavailable")
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "revoke")
+	req.Data = map[string]interface{}{
+		"token": "child-0",
+	}
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	// The token is invalid immediately, while its children are revoked in
+	// the background
+	out, err := ts.Lookup("child-0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != nil {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// The failed revocation is visible with a lookup
+	lookup := func() map[string]interface{} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "lookup")
+		req.ClientToken = root
+		req.Data = map[string]interface{}{
+			"token": "child-0",
+		}
+		resp, err := ts.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v %v", err, resp)
+		}
+		return resp.Data
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	data := lookup()
+	for data["revocation_attempts"] == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("revocation was not attempted: %#v", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+		data = lookup()
+	}
+	if data["revocation_status"] != "pending" || data["revocation_attempts"] != 1 ||
+		!strings.Contains(data["revocation_error"].(string), "cubbyhole unavailable") {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	// Revoking again resumes the revocation
+	ts.cubbyholeDestroyer = destroyCubbyhole
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	testWaitForTokenRevocation(t, ts, "child-0")
+	for i := 0; i < depth; i++ {
+		testWaitForTokenRevocation(t, ts, fmt.Sprintf("child-%d", i))
+	}
+}
+
+func TestTokenStore_HandleRequest_Revoke_Restore(t *testing.T) {
+	c, ts, _, root := TestCoreWithTokenStore(t)
+	testMakeToken(t, ts, root, "child", "", []string{"root", "foo"})
+	testMakeToken(t, ts, "child", "sub-child", "", []string{"root", "foo"})
+	testMakeToken(t, ts, "sub-child", "sub-sub-child", "", []string{"foo"})
+
+	// Queue the revocation while automatic revocations are stopped, as they
+	// would be when sealing
+	if err := c.expiration.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.lazyRevokeTree("child"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"sub-child", "sub-sub-child"} {
+		out, err := ts.Lookup(id)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out != nil {
+			t.Fatalf("%s should be invalid while its ancestor is revoked: %#v", id, out)
+		}
+	}
+
+	// The revocation is resumed once the leases are restored
+	exp := NewExpirationManager(c.router, c.systemBarrierView.SubView(expirationSubPath), ts, c.logger)
+	ts.SetExpirationManager(exp)
+	if err := exp.Restore(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Stop()
+
+	testWaitForTokenRevocation(t, ts, "child")
+	testWaitForTokenRevocation(t, ts, "sub-child")
+	testWaitForTokenRevocation(t, ts, "sub-sub-child")
+}
+
+func TestTokenStore_AncestorCache(t *testing.T) {
+	c, ts, _, root := TestCoreWithTokenStore(t)
+	testMakeToken(t, ts, root, "child", "", []string{"root", "foo"})
+	testMakeToken(t, ts, "child", "sub-child", "", []string{"root", "foo"})
+	testMakeToken(t, ts, "sub-child", "sub-sub-child", "", []string{"foo"})
+
+	salted := func(id string) string {
+		saltedID, err := ts.SaltID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saltedID
+	}
+	cached := func(id string) (bool, bool) {
+		entry, ok := ts.ancestorCache.Get(salted(id))
+		if !ok {
+			return false, false
+		}
+		return entry.(*ancestorCacheEntry).revoked, true
+	}
+
+	// The ancestry read by a lookup is cached
+	out, err := ts.Lookup("sub-sub-child")
+	if err != nil || out == nil {
+		t.Fatalf("bad: %v %#v", err, out)
+	}
+	for _, id := range []string{"sub-child", "child", root} {
+		if revoked, ok := cached(id); !ok || revoked {
+			t.Fatalf("%s: bad: %v %v", id, revoked, ok)
+		}
+	}
+
+	// Writing a token that no cached token descends from keeps the cache
+	ts.invalidate(lookupPrefix + salted("unrelated"))
+	if ts.ancestorCache.Len() != 3 {
+		t.Fatalf("bad: %v", ts.ancestorCache.Keys())
+	}
+
+	// Writing a token evicts it and its descendants only
+	ts.invalidate(lookupPrefix + salted("child"))
+	if ts.ancestorCache.Len() != 1 {
+		t.Fatalf("bad: %v", ts.ancestorCache.Keys())
+	}
+	if _, ok := cached(root); !ok {
+		t.Fatal("ancestors of the written token should be kept")
+	}
+	if out, err = ts.Lookup("sub-sub-child"); err != nil || out == nil {
+		t.Fatalf("bad: %v %#v", err, out)
+	}
+
+	// Marking a token for revocation invalidates its descendants at once
+	if err := c.expiration.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.lazyRevokeTree("child"); err != nil {
+		t.Fatal(err)
+	}
+	if ts.ancestorCache.Len() != 1 {
+		t.Fatalf("bad: %v", ts.ancestorCache.Keys())
+	}
+	out, err = ts.Lookup("sub-sub-child")
+	if err != nil || out != nil {
+		t.Fatalf("bad: %v %#v", err, out)
+	}
+	if revoked, ok := cached("sub-child"); !ok || !revoked {
+		t.Fatalf("bad: %v %v", revoked, ok)
+	}
+	if len(ts.ancestorChildren[salted(root)]) != 0 {
+		t.Fatalf("revoked ancestors should not depend on their parents: %v", ts.ancestorChildren)
+	}
+}
+
 func TestTokenStore_HandleRequest_RevokeOrphan(t *testing.T) {
 	_, ts, _, root := TestCoreWithTokenStore(t)
 	testMakeToken(t, ts, root, "child", "", []string{"root", "foo"})
@@ -1449,6 +1663,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"explicit_max_ttl": int64(0),
 		"expire_time":      nil,
 		"entity_id":        "",
+		"type":             logical.TokenTypeService,
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1489,6 +1704,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
 		"entity_id":        "",
+		"type":             logical.TokenTypeService,
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1540,6 +1756,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
 		"entity_id":        "",
+		"type":             logical.TokenTypeService,
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1622,6 +1839,7 @@ func TestTokenStore_HandleRequest_LookupSelf(t *testing.T) {
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
 		"entity_id":        "",
+		"type":             logical.TokenTypeService,
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1792,6 +2010,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           true,
+		"token_type":          logical.TokenTypeDefaultService,
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1836,6 +2055,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           false,
+		"token_type":          logical.TokenTypeDefaultService,
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1873,6 +2093,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"period":              int64(0),
 		"renewable":           false,
+		"token_type":          logical.TokenTypeDefaultService,
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -3583,3 +3804,249 @@ func TestTokenStore_TidyLeaseRevocation(t *testing.T) {
 		t.Fatal("found leases")
 	}
 }
+
+func TestTokenStore_BatchToken(t *testing.T) {
+	c, ts, _, root := TestCoreWithTokenStore(t)
+
+	// Create a service token to act as the parent of the batch token
+	testMakeToken(t, ts, root, "parent", "", []string{"foo"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = "parent"
+	req.Data["type"] = "batch"
+	req.Data["ttl"] = "1h"
+	resp, err := ts.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	batch := resp.Auth.ClientToken
+	if !strings.HasPrefix(batch, batchTokenPrefix) {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if resp.Auth.Accessor != "" || resp.Auth.Renewable || resp.Auth.TokenType != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Batch tokens are not persisted
+	saltedID, err := ts.SaltID(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ts.view.Get(lookupPrefix + saltedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		t.Fatalf("batch token was persisted")
+	}
+
+	te, err := ts.Lookup(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te == nil || !te.IsBatch() || te.Parent != "parent" {
+		t.Fatalf("bad: %#v", te)
+	}
+	if !reflect.DeepEqual(te.Policies, []string{"default", "foo"}) {
+		t.Fatalf("bad: %#v", te.Policies)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "lookup")
+	req.ClientToken = root
+	req.Data["token"] = batch
+	resp, err = ts.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["type"] != logical.TokenTypeBatch || resp.Data["renewable"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Batch tokens cannot be renewed, revoked or create children
+	req = logical.TestRequest(t, logical.UpdateOperation, "renew")
+	req.ClientToken = root
+	req.Data["token"] = batch
+	resp, err = ts.HandleRequest(req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error renewing batch token: %v", resp)
+	}
+	if err := ts.RevokeTree(batch); err == nil {
+		t.Fatalf("expected error revoking batch token")
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = batch
+	resp, err = ts.HandleRequest(req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error creating child of batch token: %v", resp)
+	}
+
+	// Batch tokens cannot use the cubbyhole
+	req = logical.TestRequest(t, logical.UpdateOperation, "cubbyhole/foo")
+	req.ClientToken = batch
+	req.Data["foo"] = "bar"
+	resp, err = c.HandleRequest(req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error writing to the cubbyhole: %v", resp)
+	}
+
+	// Tokens issued by another cluster or tampered with are rejected
+	tampered := batch[:len(batch)-2] + "AA"
+	if tampered == batch {
+		tampered = batch[:len(batch)-2] + "BB"
+	}
+	te, err = ts.Lookup(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te != nil {
+		t.Fatalf("tampered batch token was accepted: %#v", te)
+	}
+
+	// Revoking the parent invalidates the batch token
+	if err := ts.RevokeTree("parent"); err != nil {
+		t.Fatal(err)
+	}
+	te, err = ts.Lookup(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te != nil {
+		t.Fatalf("batch token outlived its parent: %#v", te)
+	}
+}
+
+func TestTokenStore_BatchToken_Leases(t *testing.T) {
+	c, ts, _, root := TestCoreWithTokenStore(t)
+
+	view := NewBarrierView(c.barrier, "noop/")
+	noop := &NoopBackend{}
+	err := ts.expiration.router.Mount(noop, "noop/", &MountEntry{UUID: "noopuuid", Accessor: "noopaccessor"}, view)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testMakeToken(t, ts, root, "parent", "", []string{"foo"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = "parent"
+	req.Data["type"] = "batch"
+	req.Data["ttl"] = "1h"
+	resp, err := ts.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	batch := resp.Auth.ClientToken
+
+	// Register a lease with a TTL longer than the batch token's
+	lreq := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "noop/foo",
+		ClientToken: batch,
+	}
+	lresp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       2 * time.Hour,
+				Renewable: true,
+			},
+		},
+		Data: map[string]interface{}{
+			"access_key": "xyz",
+		},
+	}
+	leaseID, err := ts.expiration.Register(lreq, lresp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	le, err := ts.expiration.loadEntry(leaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if le.ClientToken != "parent" || le.ClientTokenType != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", le)
+	}
+	if le.Secret.TTL > time.Hour || le.Secret.Renewable {
+		t.Fatalf("lease can outlive the batch token: %#v", le.Secret)
+	}
+
+	// Revoking the parent revokes the lease
+	if err := ts.RevokeTree("parent"); err != nil {
+		t.Fatal(err)
+	}
+	le, err = ts.expiration.loadEntry(leaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if le != nil {
+		t.Fatalf("bad: %#v", le)
+	}
+}
+
+func TestTokenStore_RoleTokenType(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	for _, tokenType := range []string{"batch", "default-batch", "service"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "roles/"+tokenType)
+		req.ClientToken = root
+		req.Data["token_type"] = tokenType
+		resp, err := ts.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v %v", err, resp)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "roles/batch")
+	req.ClientToken = root
+	resp, err := ts.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["token_type"] != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Batch roles cannot be periodic
+	req = logical.TestRequest(t, logical.UpdateOperation, "roles/batch")
+	req.ClientToken = root
+	req.Data["period"] = 3600
+	resp, err = ts.HandleRequest(req)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %v %v", err, resp)
+	}
+
+	cases := []struct {
+		role      string
+		requested string
+		expected  logical.TokenType
+	}{
+		{"batch", "", logical.TokenTypeBatch},
+		{"batch", "service", ""},
+		{"default-batch", "", logical.TokenTypeBatch},
+		{"default-batch", "service", logical.TokenTypeService},
+		{"service", "", logical.TokenTypeService},
+		{"service", "batch", ""},
+	}
+	for _, tc := range cases {
+		req = logical.TestRequest(t, logical.UpdateOperation, "create/"+tc.role)
+		req.ClientToken = root
+		req.Data["ttl"] = "1h"
+		req.Data["policies"] = []string{"foo"}
+		if tc.requested != "" {
+			req.Data["type"] = tc.requested
+		}
+		resp, err = ts.HandleRequest(req)
+		if tc.expected == "" {
+			if err == nil || resp == nil || !resp.IsError() {
+				t.Fatalf("%s/%s: expected error: %v", tc.role, tc.requested, resp)
+			}
+			continue
+		}
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s/%s: err: %v %v", tc.role, tc.requested, err, resp)
+		}
+		if resp.Auth.TokenType != tc.expected {
+			t.Fatalf("%s/%s: bad: %#v", tc.role, tc.requested, resp.Auth)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -24,7 +25,7 @@ const (
 )
 
 func (c *Core) ensureWrappingKey() error {
-	entry, err := c.barrier.Get(coreWrappingJWTKeyPath)
+	entry, err := c.barrier.Get(context.Background(), coreWrappingJWTKeyPath)
 	if err != nil {
 		return err
 	}
@@ -32,6 +33,11 @@ func (c *Core) ensureWrappingKey() error {
 	var keyParams clusterKeyParams
 
 	if entry == nil {
+		// The active node creates the key
+		if c.perfStandby {
+			return logical.ErrReadOnly
+		}
+
 		key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
 		if err != nil {
 			return errwrap.Wrapf("failed to generate wrapping key: {{err}}", err)
@@ -48,7 +54,7 @@ func (c *Core) ensureWrappingKey() error {
 			Key:   coreWrappingJWTKeyPath,
 			Value: val,
 		}
-		if err = c.barrier.Put(entry); err != nil {
+		if err = c.barrier.Put(context.Background(), entry); err != nil {
 			return errwrap.Wrapf("failed to store wrapping key: {{err}}", err)
 		}
 	}
@@ -114,6 +120,7 @@ func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response, aut
 	}
 
 	resp.WrapInfo.Token = te.ID
+	resp.WrapInfo.Accessor = te.Accessor
 	resp.WrapInfo.CreationTime = creationTime
 	// If this is not a rewrap, store the request path as creation_path
 	if req.Path != "sys/wrapping/rewrap" {